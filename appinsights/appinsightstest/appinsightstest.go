@@ -0,0 +1,288 @@
+// Package appinsightstest provides a fake Application Insights ingestion
+// endpoint, so that channel behavior can be tested end to end without
+// Azure.  The server decodes the gzipped, newline-delimited batches posted
+// by telemetry channels, validates each envelope against the schema, and
+// answers with the responses of the real service, including throttling,
+// partial success, and server errors queued by the test.
+//
+// The package also provides a conformance test suite for integrations with
+// HTTP frameworks and clients.  Community-built middleware adapters and
+// instrumented transports can run TestMiddleware and TestTransport from
+// their own tests to prove that they extract and inject correlation
+// headers, track complete telemetry, respect sampling, and let panics
+// through like the integrations built into the appinsights package:
+//
+//	func TestConformance(t *testing.T) {
+//		appinsightstest.TestMiddleware(t, func(client appinsights.TelemetryClient, next http.Handler) http.Handler {
+//			return mymiddleware.New(client).Wrap(next)
+//		})
+//	}
+package appinsightstest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Response is a response to a single submission, queued with
+// FakeIngestionServer.Respond.
+type Response struct {
+	// HTTP status code of the response, e.g. 429, 206 or 500
+	StatusCode int
+
+	// Time at which the client may retry, sent as the Retry-After header
+	// (optional)
+	RetryAfter time.Time
+
+	// Items rejected by a partial success response, by index in the batch
+	Errors []ItemError
+}
+
+// ItemError is an item rejected by the server.
+type ItemError struct {
+	Index      int    `json:"index"`
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// Throttled returns a 429 response asking the client to retry after the
+// specified time.
+func Throttled(retryAfter time.Time) Response {
+	return Response{StatusCode: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+// PartialSuccess returns a 206 response rejecting the items at the
+// specified indexes with statusCode, e.g. 500 for items the client should
+// retry, or 400 for items it should drop.
+func PartialSuccess(statusCode int, indexes ...int) Response {
+	response := Response{StatusCode: http.StatusPartialContent}
+	for _, index := range indexes {
+		response.Errors = append(response.Errors, ItemError{index, statusCode, http.StatusText(statusCode)})
+	}
+
+	return response
+}
+
+// ServerError returns a 500 response, which clients retry.
+func ServerError() Response {
+	return Response{StatusCode: http.StatusInternalServerError}
+}
+
+// Batch is a submission received by the server.
+type Batch struct {
+	// Headers of the request
+	Header http.Header
+
+	// Decoded envelopes of the batch, in order.  Items that failed to
+	// decode are nil.
+	Items []*contracts.Envelope
+
+	// Schema violations of the batch, by item index
+	SchemaErrors map[int][]string
+
+	// Status code the server responded with
+	StatusCode int
+}
+
+type backendResponse struct {
+	ItemsReceived int         `json:"itemsReceived"`
+	ItemsAccepted int         `json:"itemsAccepted"`
+	Errors        []ItemError `json:"errors"`
+}
+
+// FakeIngestionServer is an in-process ingestion endpoint.  Point a
+// configuration at it with ConnectionString or by setting EndpointUrl to
+// URL.
+type FakeIngestionServer struct {
+	// Base URL of the server
+	URL string
+
+	server *httptest.Server
+
+	lock      sync.Mutex
+	changed   *sync.Cond
+	responses []Response
+	batches   []*Batch
+	items     []*contracts.Envelope
+}
+
+// NewFakeIngestionServer starts a server accepting every valid item until
+// responses are queued with Respond.  Close it when done.
+func NewFakeIngestionServer() *FakeIngestionServer {
+	server := &FakeIngestionServer{}
+	server.changed = sync.NewCond(&server.lock)
+	server.server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	server.URL = server.server.URL
+	return server
+}
+
+// Close shuts down the server.
+func (server *FakeIngestionServer) Close() {
+	server.server.Close()
+}
+
+// ConnectionString returns a connection string submitting telemetry for
+// the instrumentation key to the server.
+func (server *FakeIngestionServer) ConnectionString(instrumentationKey string) string {
+	return "InstrumentationKey=" + instrumentationKey + ";IngestionEndpoint=" + server.URL
+}
+
+// Respond queues responses for the next submissions, in order.  Once the
+// queue is empty, the server accepts valid items again.
+func (server *FakeIngestionServer) Respond(responses ...Response) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.responses = append(server.responses, responses...)
+}
+
+// Items returns the items accepted by the server, in the order received.
+func (server *FakeIngestionServer) Items() []*contracts.Envelope {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return append([]*contracts.Envelope(nil), server.items...)
+}
+
+// Batches returns every submission received by the server, including
+// rejected ones.
+func (server *FakeIngestionServer) Batches() []*Batch {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return append([]*Batch(nil), server.batches...)
+}
+
+// WaitForItems waits until the server has accepted at least count items,
+// and returns them.  Returns false if the timeout expires first.
+func (server *FakeIngestionServer) WaitForItems(count int, timeout time.Duration) ([]*contracts.Envelope, bool) {
+	timer := time.AfterFunc(timeout, func() {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		server.changed.Broadcast()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for len(server.items) < count && time.Now().Before(deadline) {
+		server.changed.Wait()
+	}
+
+	return append([]*contracts.Envelope(nil), server.items...), len(server.items) >= count
+}
+
+// Reset forgets received items and queued responses.
+func (server *FakeIngestionServer) Reset() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.responses = nil
+	server.batches = nil
+	server.items = nil
+}
+
+func (server *FakeIngestionServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch := &Batch{Header: r.Header.Clone(), SchemaErrors: make(map[int][]string)}
+	for index, line := range splitLines(body) {
+		envelope, problems := decodeEnvelope(line)
+		batch.Items = append(batch.Items, envelope)
+		if len(problems) > 0 {
+			batch.SchemaErrors[index] = problems
+		}
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	response := Response{StatusCode: http.StatusOK}
+	if len(server.responses) > 0 {
+		response = server.responses[0]
+		server.responses = server.responses[1:]
+	} else if len(batch.SchemaErrors) > 0 {
+		response.StatusCode = http.StatusPartialContent
+		for index, problems := range batch.SchemaErrors {
+			response.Errors = append(response.Errors, ItemError{index, http.StatusBadRequest, strings.Join(problems, "; ")})
+		}
+	}
+
+	result := backendResponse{ItemsReceived: len(batch.Items), Errors: response.Errors}
+	if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusPartialContent {
+		rejected := make(map[int]bool)
+		for _, itemError := range response.Errors {
+			rejected[itemError.Index] = true
+		}
+
+		for index, envelope := range batch.Items {
+			if !rejected[index] && batch.SchemaErrors[index] == nil {
+				server.items = append(server.items, envelope)
+				result.ItemsAccepted++
+			}
+		}
+	}
+
+	batch.StatusCode = response.StatusCode
+	server.batches = append(server.batches, batch)
+	server.changed.Broadcast()
+
+	if !response.RetryAfter.IsZero() {
+		w.Header().Set("Retry-After", response.RetryAfter.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.StatusCode)
+	json.NewEncoder(w).Encode(result)
+}
+
+// readBody reads the request body, decompressing it if gzipped
+func readBody(r *http.Request) ([]byte, error) {
+	var reader io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %s", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	return io.ReadAll(reader)
+}
+
+// splitLines splits a newline-delimited JSON body into its non-empty lines
+func splitLines(body []byte) [][]byte {
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,127 @@
+package appinsightstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+const testIkey = "01234567-0000-89ab-cdef-000000000000"
+
+func newTestClient(server *FakeIngestionServer) appinsights.TelemetryClient {
+	config := appinsights.NewTelemetryConfiguration(server.ConnectionString(testIkey))
+	config.MaxBatchInterval = 10 * time.Millisecond
+	return appinsights.NewTelemetryClientFromConfig(config)
+}
+
+func TestChannelSubmission(t *testing.T) {
+	server := NewFakeIngestionServer()
+	defer server.Close()
+
+	client := newTestClient(server)
+	defer client.Channel().Close()
+
+	client.TrackEvent("checkout")
+	client.TrackTrace("message", appinsights.Warning)
+	client.TrackRequest("GET", "https://example.com/", time.Second, "200")
+
+	items, ok := server.WaitForItems(3, 5*time.Second)
+	if !ok {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+
+	for _, batch := range server.Batches() {
+		if batch.Header.Get("Content-Encoding") != "gzip" || len(batch.SchemaErrors) > 0 {
+			t.Errorf("Unexpected batch: %v %v", batch.Header, batch.SchemaErrors)
+		}
+	}
+
+	event, ok := items[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if !ok || event.Name != "checkout" {
+		t.Errorf("Expected the event to be decoded, got %#v", items[0].Data)
+	}
+	if _, ok := items[2].Data.(*contracts.Data).BaseData.(*contracts.RequestData); !ok {
+		t.Errorf("Expected the request to be decoded, got %#v", items[2].Data)
+	}
+}
+
+func post(t *testing.T, server *FakeIngestionServer, lines ...string) (*http.Response, backendResponse) {
+	resp, err := http.Post(server.URL+"/v2/track", "application/x-json-stream", bytes.NewBufferString(joinLines(lines)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result backendResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp, result
+}
+
+func joinLines(lines []string) string {
+	var buffer bytes.Buffer
+	for _, line := range lines {
+		buffer.WriteString(line + "\n")
+	}
+	return buffer.String()
+}
+
+const (
+	validItem   = `{"name":"Microsoft.ApplicationInsights.Event","time":"2024-01-01T00:00:00.0000000Z","iKey":"` + testIkey + `","data":{"baseType":"EventData","baseData":{"ver":2,"name":"event"}}}`
+	invalidItem = `{"name":"Microsoft.ApplicationInsights.Request","time":"yesterday","iKey":"` + testIkey + `","data":{"baseType":"RequestData","baseData":{"ver":2,"duration":"1s"}}}`
+)
+
+func TestSchemaValidation(t *testing.T) {
+	server := NewFakeIngestionServer()
+	defer server.Close()
+
+	resp, result := post(t, server, validItem, invalidItem)
+	if resp.StatusCode != http.StatusPartialContent || result.ItemsAccepted != 1 || len(result.Errors) != 1 || result.Errors[0].Index != 1 {
+		t.Fatalf("Expected the invalid item to be rejected, got %d %+v", resp.StatusCode, result)
+	}
+
+	problems := server.Batches()[0].SchemaErrors[1]
+	if len(problems) != 4 {
+		t.Errorf("Expected time, id, responseCode and duration problems, got %v", problems)
+	}
+	if len(server.Items()) != 1 {
+		t.Errorf("Expected only the valid item to be kept, got %d", len(server.Items()))
+	}
+}
+
+func TestSimulatedResponses(t *testing.T) {
+	server := NewFakeIngestionServer()
+	defer server.Close()
+
+	retryAfter := time.Now().Add(time.Minute).Truncate(time.Second)
+	server.Respond(Throttled(retryAfter), ServerError(), PartialSuccess(http.StatusInternalServerError, 0))
+
+	resp, _ := post(t, server, validItem)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected 429, got %d", resp.StatusCode)
+	}
+	if at, err := time.Parse(time.RFC1123, resp.Header.Get("Retry-After")); err != nil || !at.Equal(retryAfter) {
+		t.Errorf("Expected Retry-After %s, got %q", retryAfter, resp.Header.Get("Retry-After"))
+	}
+
+	if resp, _ := post(t, server, validItem); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", resp.StatusCode)
+	}
+
+	resp, result := post(t, server, validItem, validItem)
+	if resp.StatusCode != http.StatusPartialContent || result.ItemsAccepted != 1 || result.Errors[0].StatusCode != 500 {
+		t.Errorf("Expected a partial success, got %d %+v", resp.StatusCode, result)
+	}
+
+	if resp, _ := post(t, server, validItem); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the queue to be drained, got %d", resp.StatusCode)
+	}
+
+	if len(server.Items()) != 2 || len(server.Batches()) != 4 {
+		t.Errorf("Expected 2 accepted items in 4 batches, got %d in %d", len(server.Items()), len(server.Batches()))
+	}
+}
@@ -0,0 +1,430 @@
+package appinsightstest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Middleware wraps next with the middleware under test, which tracks the
+// requests it handles with client.
+type Middleware func(client appinsights.TelemetryClient, next http.Handler) http.Handler
+
+// Transport wraps base with the round tripper under test, which injects
+// correlation headers into the requests it sends and tracks them as
+// dependencies with client.
+type Transport func(client appinsights.TelemetryClient, base http.RoundTripper) http.RoundTripper
+
+// Correlation IDs of the incoming requests simulated by the suite
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+// telemetryCapture creates telemetry clients that record the items they
+// keep instead of transmitting them
+type telemetryCapture struct {
+	lock  sync.Mutex
+	items []*contracts.Envelope
+}
+
+// newClient creates a client recording the items it keeps, sampled at the
+// specified percentage.  Items that violate the schema fail the test.
+func (capture *telemetryCapture) newClient(t *testing.T, samplingRate float64) appinsights.TelemetryClient {
+	config := appinsights.NewTelemetryConfiguration("InstrumentationKey=00000000-0000-0000-0000-000000000000")
+	config.Recorder = appinsights.NewTelemetryRecorder(appinsights.RecordingConfig{})
+	config.SamplingProcessor = appinsights.NewFixedRateSamplingProcessor(samplingRate)
+	config.OnTracked = func(envelope *contracts.Envelope) {
+		encoded, err := envelope.AppendJSON(nil)
+		if err != nil {
+			t.Errorf("Failed to encode tracked item: %s", err)
+			return
+		}
+
+		item, problems := decodeEnvelope(encoded)
+		for _, problem := range problems {
+			t.Errorf("Tracked item %s: %s", envelope.Name, problem)
+		}
+		if item == nil {
+			return
+		}
+
+		capture.lock.Lock()
+		defer capture.lock.Unlock()
+		capture.items = append(capture.items, item)
+	}
+
+	client := appinsights.NewTelemetryClientFromConfig(config)
+	t.Cleanup(func() { client.Channel().Stop() })
+	return client
+}
+
+// captured returns the captured items holding data of type T
+func captured[T any](capture *telemetryCapture) []*contracts.Envelope {
+	capture.lock.Lock()
+	defer capture.lock.Unlock()
+
+	var items []*contracts.Envelope
+	for _, item := range capture.items {
+		if _, ok := item.Data.(*contracts.Data).BaseData.(T); ok {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// single returns the only captured item holding data of type T, and its
+// data
+func single[T any](t *testing.T, capture *telemetryCapture) (*contracts.Envelope, T) {
+	t.Helper()
+
+	items := captured[T](capture)
+	if len(items) != 1 {
+		var data T
+		t.Fatalf("Expected exactly one %T item, got %d", data, len(items))
+	}
+
+	return items[0], items[0].Data.(*contracts.Data).BaseData.(T)
+}
+
+// TestMiddleware runs the conformance suite against a middleware.
+func TestMiddleware(t *testing.T, middleware Middleware) {
+	t.Run("RequestTelemetry", func(t *testing.T) {
+		for _, status := range []int{http.StatusCreated, http.StatusInternalServerError} {
+			capture := &telemetryCapture{}
+			handler := middleware(capture.newClient(t, 100), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			serve(handler, httptest.NewRequest(http.MethodGet, "/conformance/items?id=1", nil))
+
+			_, request := single[*contracts.RequestData](t, capture)
+			if !strings.Contains(request.Name, "/conformance/items") {
+				t.Errorf("Expected the request name to contain the path, got %q", request.Name)
+			}
+			if !strings.Contains(request.Url, "/conformance/items") {
+				t.Errorf("Expected the request URL to contain the path, got %q", request.Url)
+			}
+			if request.Id == "" || request.Duration == "" {
+				t.Errorf("Expected the request to have an ID and duration, got %q and %q", request.Id, request.Duration)
+			}
+			if request.ResponseCode != strconv.Itoa(status) {
+				t.Errorf("Expected response code %d, got %q", status, request.ResponseCode)
+			}
+			if success := status < 500; request.Success != success {
+				t.Errorf("Expected success=%t for status %d", success, status)
+			}
+		}
+	})
+
+	t.Run("W3CExtraction", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/conformance", nil)
+		req.Header.Set(appinsights.TraceParentHeader, "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+		checkExtraction(t, middleware, req)
+	})
+
+	t.Run("RequestIDExtraction", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/conformance", nil)
+		req.Header.Set(appinsights.RequestIDHeader, "|"+incomingTraceID+"."+incomingSpanID+".")
+		checkExtraction(t, middleware, req)
+	})
+
+	t.Run("NewTrace", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		var corrCtx *appinsights.CorrelationContext
+		handler := middleware(capture.newClient(t, 100), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			corrCtx = appinsights.GetCorrelationContext(r.Context())
+		}))
+
+		serve(handler, httptest.NewRequest(http.MethodGet, "/conformance", nil))
+
+		if corrCtx == nil {
+			t.Fatal("Expected a correlation context in the handler's request context")
+		}
+
+		request, data := single[*contracts.RequestData](t, capture)
+		if request.Tags[contracts.OperationId] != corrCtx.GetOperationID() {
+			t.Errorf("Expected operation ID %s, got %s", corrCtx.GetOperationID(), request.Tags[contracts.OperationId])
+		}
+		if data.Id != corrCtx.SpanID {
+			t.Errorf("Expected request ID %s, got %s", corrCtx.SpanID, data.Id)
+		}
+	})
+
+	t.Run("MalformedHeaders", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		handler := middleware(capture.newClient(t, 100), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/conformance", nil)
+		req.Header.Set(appinsights.TraceParentHeader, "00-not-a-trace-01")
+		req.Header.Set(appinsights.RequestIDHeader, "|.")
+		if recovered := serve(handler, req); recovered != nil {
+			t.Fatalf("Expected malformed correlation headers to be ignored, panicked with %v", recovered)
+		}
+
+		if request, _ := single[*contracts.RequestData](t, capture); request.Tags[contracts.OperationId] == "" {
+			t.Error("Expected a new operation for a request with malformed correlation headers")
+		}
+	})
+
+	t.Run("ChildTelemetry", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		client := capture.newClient(t, 100)
+		handler := middleware(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client.TrackTraceWithContext(r.Context(), "within request", appinsights.Information)
+		}))
+
+		serve(handler, httptest.NewRequest(http.MethodGet, "/conformance", nil))
+
+		request, _ := single[*contracts.RequestData](t, capture)
+		trace, _ := single[*contracts.MessageData](t, capture)
+		if trace.Tags[contracts.OperationId] != request.Tags[contracts.OperationId] {
+			t.Errorf("Expected telemetry tracked in the handler to share operation %s, got %s", request.Tags[contracts.OperationId], trace.Tags[contracts.OperationId])
+		}
+	})
+
+	t.Run("Sampling", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		called := false
+		handler := middleware(capture.newClient(t, 0), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		serve(handler, httptest.NewRequest(http.MethodGet, "/conformance", nil))
+
+		if !called {
+			t.Error("Expected the handler to be called for requests that are sampled out")
+		}
+		if items := captured[*contracts.RequestData](capture); len(items) != 0 {
+			t.Errorf("Expected requests to be tracked through the client's sampling, got %d items sampled at 0%%", len(items))
+		}
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		sentinel := errors.New("conformance panic")
+		handler := middleware(capture.newClient(t, 100), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(sentinel)
+		}))
+
+		if recovered := serve(handler, httptest.NewRequest(http.MethodGet, "/conformance", nil)); recovered != sentinel {
+			t.Errorf("Expected the handler's panic to propagate through the middleware, got %v", recovered)
+		}
+	})
+}
+
+// checkExtraction verifies that the middleware continues the trace of the
+// simulated incoming request
+func checkExtraction(t *testing.T, middleware Middleware, req *http.Request) {
+	capture := &telemetryCapture{}
+	var corrCtx *appinsights.CorrelationContext
+	handler := middleware(capture.newClient(t, 100), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		corrCtx = appinsights.GetCorrelationContext(r.Context())
+	}))
+
+	serve(handler, req)
+
+	if corrCtx == nil {
+		t.Fatal("Expected a correlation context in the handler's request context")
+	}
+	if corrCtx.TraceID != incomingTraceID {
+		t.Errorf("Expected the handler's trace ID to be %s, got %s", incomingTraceID, corrCtx.TraceID)
+	}
+
+	request, data := single[*contracts.RequestData](t, capture)
+	if request.Tags[contracts.OperationId] != incomingTraceID {
+		t.Errorf("Expected operation ID %s, got %s", incomingTraceID, request.Tags[contracts.OperationId])
+	}
+	if request.Tags[contracts.OperationParentId] != incomingSpanID {
+		t.Errorf("Expected the incoming span %s as parent, got %s", incomingSpanID, request.Tags[contracts.OperationParentId])
+	}
+	if data.Id != corrCtx.SpanID {
+		t.Errorf("Expected the request ID to be the handler's span %s, got %s", corrCtx.SpanID, data.Id)
+	}
+}
+
+// TestTransport runs the conformance suite against a round tripper.
+func TestTransport(t *testing.T, transport Transport) {
+	t.Run("Injection", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		var header http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Clone()
+		}))
+		defer server.Close()
+
+		parent := appinsights.NewCorrelationContext()
+		ctx := appinsights.WithCorrelationContext(context.Background(), parent)
+		if _, err := roundTrip(ctx, transport(capture.newClient(t, 100), http.DefaultTransport), server.URL+"/conformance"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		injected := injectedCorrelation(t, header)
+		if injected.TraceID != parent.TraceID {
+			t.Errorf("Expected the injected trace ID to be %s, got %s", parent.TraceID, injected.TraceID)
+		}
+		if injected.SpanID == parent.SpanID {
+			t.Error("Expected a new span to be injected for the outgoing request")
+		}
+
+		dependency, data := single[*contracts.RemoteDependencyData](t, capture)
+		if data.Id != injected.SpanID {
+			t.Errorf("Expected the dependency ID to be the injected span %s, got %s", injected.SpanID, data.Id)
+		}
+		if dependency.Tags[contracts.OperationId] != parent.TraceID {
+			t.Errorf("Expected operation ID %s, got %s", parent.TraceID, dependency.Tags[contracts.OperationId])
+		}
+		if dependency.Tags[contracts.OperationParentId] != parent.SpanID {
+			t.Errorf("Expected the calling span %s as parent, got %s", parent.SpanID, dependency.Tags[contracts.OperationParentId])
+		}
+	})
+
+	t.Run("DependencyTelemetry", func(t *testing.T) {
+		for _, status := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+			capture := &telemetryCapture{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			ctx := appinsights.WithCorrelationContext(context.Background(), appinsights.NewCorrelationContext())
+			_, err := roundTrip(ctx, transport(capture.newClient(t, 100), http.DefaultTransport), server.URL+"/conformance/items")
+			server.Close()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			_, dependency := single[*contracts.RemoteDependencyData](t, capture)
+			if !strings.EqualFold(dependency.Type, appinsights.DependencyTypeHTTP) {
+				t.Errorf("Expected dependency type %s, got %q", appinsights.DependencyTypeHTTP, dependency.Type)
+			}
+			if host := strings.TrimPrefix(server.URL, "http://"); !strings.Contains(dependency.Target, host) {
+				t.Errorf("Expected the dependency target to contain %s, got %q", host, dependency.Target)
+			}
+			if !strings.Contains(dependency.Name, "/conformance/items") {
+				t.Errorf("Expected the dependency name to contain the path, got %q", dependency.Name)
+			}
+			if dependency.ResultCode != strconv.Itoa(status) {
+				t.Errorf("Expected result code %d, got %q", status, dependency.ResultCode)
+			}
+			if success := status < 400; dependency.Success != success {
+				t.Errorf("Expected success=%t for status %d", success, status)
+			}
+		}
+	})
+
+	t.Run("ConnectionFailure", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.Close()
+
+		ctx := appinsights.WithCorrelationContext(context.Background(), appinsights.NewCorrelationContext())
+		if _, err := roundTrip(ctx, transport(capture.newClient(t, 100), http.DefaultTransport), server.URL); err == nil {
+			t.Fatal("Expected the connection error to be returned")
+		}
+
+		if _, dependency := single[*contracts.RemoteDependencyData](t, capture); dependency.Success {
+			t.Error("Expected a failed dependency for a connection error")
+		}
+	})
+
+	t.Run("Sampling", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		called := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer server.Close()
+
+		ctx := appinsights.WithCorrelationContext(context.Background(), appinsights.NewCorrelationContext())
+		if _, err := roundTrip(ctx, transport(capture.newClient(t, 0), http.DefaultTransport), server.URL); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !called {
+			t.Error("Expected requests to be sent when they are sampled out")
+		}
+		if items := captured[*contracts.RemoteDependencyData](capture); len(items) != 0 {
+			t.Errorf("Expected dependencies to be tracked through the client's sampling, got %d items sampled at 0%%", len(items))
+		}
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		capture := &telemetryCapture{}
+		sentinel := errors.New("conformance panic")
+		base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			panic(sentinel)
+		})
+
+		recovered := func() (recovered interface{}) {
+			defer func() { recovered = recover() }()
+			ctx := appinsights.WithCorrelationContext(context.Background(), appinsights.NewCorrelationContext())
+			roundTrip(ctx, transport(capture.newClient(t, 100), base), "http://conformance.invalid/")
+			return nil
+		}()
+
+		if recovered != sentinel {
+			t.Errorf("Expected the base transport's panic to propagate through the round tripper, got %v", recovered)
+		}
+	})
+}
+
+// serve calls handler and returns the value it panicked with, if any
+func serve(handler http.Handler, req *http.Request) (recovered interface{}) {
+	defer func() { recovered = recover() }()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return nil
+}
+
+// roundTrip sends a GET request through rt
+func roundTrip(ctx context.Context, rt http.RoundTripper, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	return resp, err
+}
+
+// injectedCorrelation parses the correlation headers of an outgoing request
+func injectedCorrelation(t *testing.T, header http.Header) *appinsights.CorrelationContext {
+	t.Helper()
+
+	if traceParent := header.Get(appinsights.TraceParentHeader); traceParent != "" {
+		corrCtx, err := appinsights.ParseW3CTraceParent(traceParent)
+		if err != nil {
+			t.Fatalf("Invalid %s header %q: %s", appinsights.TraceParentHeader, traceParent, err)
+		}
+		return corrCtx
+	}
+
+	if requestID := header.Get(appinsights.RequestIDHeader); requestID != "" {
+		corrCtx, err := appinsights.ParseRequestID(requestID)
+		if err != nil {
+			t.Fatalf("Invalid %s header %q: %s", appinsights.RequestIDHeader, requestID, err)
+		}
+		return corrCtx
+	}
+
+	t.Fatalf("Expected a %s or %s header to be injected", appinsights.TraceParentHeader, appinsights.RequestIDHeader)
+	return nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,26 @@
+package appinsightstest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// The integrations built into the appinsights package are the reference
+// implementations of the suite.
+
+func TestHTTPMiddlewareConformance(t *testing.T) {
+	TestMiddleware(t, func(client appinsights.TelemetryClient, next http.Handler) http.Handler {
+		middleware := appinsights.NewHTTPMiddleware()
+		middleware.GetClient = func(*http.Request) appinsights.TelemetryClient { return client }
+		return middleware.Middleware(next)
+	})
+}
+
+func TestHTTPClientConformance(t *testing.T) {
+	TestTransport(t, func(client appinsights.TelemetryClient, base http.RoundTripper) http.RoundTripper {
+		httpClient := appinsights.NewHTTPClientWithClient(&http.Client{Transport: base}, client)
+		return roundTripperFunc(httpClient.Do)
+	})
+}
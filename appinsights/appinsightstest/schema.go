@@ -0,0 +1,130 @@
+package appinsightstest
+
+import (
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// durationPattern matches the "d.hh:mm:ss.fffffff" format of durations
+var durationPattern = regexp.MustCompile(`^(\d+\.)?\d{2}:\d{2}:\d{2}(\.\d{1,7})?$`)
+
+// newBaseData returns an empty value of the data type named by baseType
+func newBaseData(baseType string) interface{} {
+	switch baseType {
+	case "RequestData":
+		return &contracts.RequestData{}
+	case "RemoteDependencyData":
+		return &contracts.RemoteDependencyData{}
+	case "EventData":
+		return &contracts.EventData{}
+	case "MessageData":
+		return &contracts.MessageData{}
+	case "ExceptionData":
+		return &contracts.ExceptionData{}
+	case "MetricData":
+		return &contracts.MetricData{}
+	case "AvailabilityData":
+		return &contracts.AvailabilityData{}
+	case "PageViewData":
+		return &contracts.PageViewData{}
+	}
+
+	return nil
+}
+
+// decodeEnvelope decodes a line of a batch into an envelope whose Data is a
+// *contracts.Data holding the concrete data type, and returns the ways in
+// which it violates the schema
+func decodeEnvelope(line []byte) (*contracts.Envelope, []string) {
+	var raw struct {
+		contracts.Envelope
+		Data *struct {
+			BaseType string          `json:"baseType"`
+			BaseData json.RawMessage `json:"baseData"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, []string{"invalid JSON: " + err.Error()}
+	}
+
+	envelope := &raw.Envelope
+	problems := envelope.Sanitize()
+
+	if envelope.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if envelope.IKey == "" {
+		problems = append(problems, "iKey is required")
+	}
+	if _, err := time.Parse(time.RFC3339, envelope.Time); err != nil {
+		problems = append(problems, "time must be an ISO 8601 timestamp")
+	}
+	if raw.Data == nil {
+		return envelope, append(problems, "data is required")
+	}
+
+	baseData := newBaseData(raw.Data.BaseType)
+	if baseData == nil {
+		return envelope, append(problems, "unknown baseType "+raw.Data.BaseType)
+	}
+	if err := json.Unmarshal(raw.Data.BaseData, baseData); err != nil {
+		return envelope, append(problems, "invalid baseData: "+err.Error())
+	}
+
+	envelope.Data = &contracts.Data{
+		Base:     contracts.Base{BaseType: raw.Data.BaseType},
+		BaseData: baseData,
+	}
+
+	if sanitizer, ok := baseData.(interface{ Sanitize() []string }); ok {
+		problems = append(problems, sanitizer.Sanitize()...)
+	}
+
+	return envelope, append(problems, validateBaseData(baseData)...)
+}
+
+// validateBaseData checks the required fields of each data type
+func validateBaseData(baseData interface{}) []string {
+	var problems []string
+	require := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+	duration := func(value string) bool {
+		return durationPattern.MatchString(value)
+	}
+
+	switch data := baseData.(type) {
+	case *contracts.RequestData:
+		require(data.Id != "", "RequestData.id is required")
+		require(data.ResponseCode != "", "RequestData.responseCode is required")
+		require(duration(data.Duration), "RequestData.duration must be formatted as d.hh:mm:ss.fffffff")
+	case *contracts.RemoteDependencyData:
+		require(data.Name != "", "RemoteDependencyData.name is required")
+		require(duration(data.Duration), "RemoteDependencyData.duration must be formatted as d.hh:mm:ss.fffffff")
+	case *contracts.EventData:
+		require(data.Name != "", "EventData.name is required")
+	case *contracts.MessageData:
+		require(data.Message != "", "MessageData.message is required")
+	case *contracts.ExceptionData:
+		require(len(data.Exceptions) > 0, "ExceptionData.exceptions is required")
+	case *contracts.MetricData:
+		require(len(data.Metrics) > 0, "MetricData.metrics is required")
+		for _, metric := range data.Metrics {
+			require(metric != nil && metric.Name != "", "DataPoint.name is required")
+		}
+	case *contracts.AvailabilityData:
+		require(data.Id != "", "AvailabilityData.id is required")
+		require(data.Name != "", "AvailabilityData.name is required")
+		require(duration(data.Duration), "AvailabilityData.duration must be formatted as d.hh:mm:ss.fffffff")
+	case *contracts.PageViewData:
+		require(data.Name != "", "PageViewData.name is required")
+	}
+
+	return problems
+}
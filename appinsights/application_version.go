@@ -0,0 +1,62 @@
+package appinsights
+
+import (
+	"runtime/debug"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// EnvironmentProperty holds TelemetryConfiguration.Environment on all
+// telemetry, so that it can be sliced by deployment stage.
+const EnvironmentProperty = "environment"
+
+// SetVersion sets the application version (ai.application.ver) stamped on
+// all telemetry created with this context, so that requests and failures
+// can be compared across deployments, e.g. during a canary rollout.  An
+// empty version removes it.  It is safe for concurrent use.
+func (context *TelemetryContext) SetVersion(version string) {
+	context.SetTag(contracts.ApplicationVersion, version)
+}
+
+// BuildInfoVersion returns the version of the running binary from its
+// build information: the main module's version when built from a tagged
+// module, otherwise the source control revision, suffixed with "-dirty" if
+// the working tree had local changes.  Returns an empty string if neither is
+// known.  Use it to set TelemetryConfiguration.ApplicationVersion.
+func BuildInfoVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	return buildInfoVersion(info)
+}
+
+func buildInfoVersion(info *debug.BuildInfo) string {
+	if version := info.Main.Version; version != "" && version != "(devel)" {
+		return version
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if revision == "" {
+		return ""
+	}
+
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+
+	return revision
+}
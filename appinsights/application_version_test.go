@@ -0,0 +1,55 @@
+package appinsights
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestApplicationVersionAndEnvironment(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.ApplicationVersion = "1.4.0"
+	config.Environment = "staging"
+	client, testChannel := newTestClient(config)
+
+	client.TrackRequest("GET", "/orders", 0, "200")
+	client.Context().SetVersion("1.5.0-canary")
+	client.TrackRequest("GET", "/orders", 0, "200")
+	TrackDeployment(client, "1.6.0", "", nil)
+
+	if testChannel.getSentCount() != 3 {
+		t.Fatalf("Expected 3 items, got %d", testChannel.getSentCount())
+	}
+
+	for i, expected := range []string{"1.4.0", "1.5.0-canary", "1.6.0"} {
+		envelope := testChannel.sentItems[i]
+		if version := envelope.Tags[contracts.ApplicationVersion]; version != expected {
+			t.Errorf("Item %d: expected version %q, got %q", i, expected, version)
+		}
+		if environment := envelopeProperties(envelope)[EnvironmentProperty]; environment != "staging" {
+			t.Errorf("Item %d: expected environment staging, got %q", i, environment)
+		}
+	}
+}
+
+func TestBuildInfoVersion(t *testing.T) {
+	revision := []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef0123"}}
+	dirty := append(revision, debug.BuildSetting{Key: "vcs.modified", Value: "true"})
+
+	tests := []struct {
+		info     debug.BuildInfo
+		expected string
+	}{
+		{debug.BuildInfo{Main: debug.Module{Version: "v1.2.3"}, Settings: revision}, "v1.2.3"},
+		{debug.BuildInfo{Main: debug.Module{Version: "(devel)"}, Settings: revision}, "0123456789ab"},
+		{debug.BuildInfo{Settings: dirty}, "0123456789ab-dirty"},
+		{debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, ""},
+	}
+
+	for i, test := range tests {
+		if version := buildInfoVersion(&test.info); version != test.expected {
+			t.Errorf("Case %d: expected %q, got %q", i, test.expected, version)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package appinsights
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsyncTrackingConfig configures asynchronous tracking, where enveloping
+// and sampling run on a bounded pool of worker goroutines rather than on
+// the goroutine that calls Track.  This reduces the latency that tracking
+// adds to request handlers at high volume.  Telemetry items must not be
+// modified after they are passed to Track.
+type AsyncTrackingConfig struct {
+	// Number of worker goroutines
+	Workers int
+
+	// Maximum number of items waiting for a worker
+	QueueSize int
+
+	// Whether Track blocks when the queue is full.  Otherwise, items that
+	// don't fit in the queue are dropped.
+	BlockWhenFull bool
+}
+
+// NewAsyncTrackingConfig creates an asynchronous tracking configuration
+// with default values.
+func NewAsyncTrackingConfig() *AsyncTrackingConfig {
+	return &AsyncTrackingConfig{
+		Workers:   4,
+		QueueSize: 4096,
+	}
+}
+
+type trackingJob struct {
+	ctx  context.Context
+	item Telemetry
+}
+
+// trackingPool runs tracking jobs on a fixed set of workers
+type trackingPool struct {
+	queue         chan trackingJob
+	process       func(ctx context.Context, item Telemetry)
+	blockWhenFull bool
+
+	// Guards closing the queue against concurrent sends
+	closeLock sync.RWMutex
+	closed    bool
+	workers   sync.WaitGroup
+
+	// Number of jobs queued or in progress
+	pendingLock sync.Mutex
+	pending     int
+	idle        *sync.Cond
+
+	dropped atomic.Int64
+	full    atomic.Bool
+}
+
+func newTrackingPool(config *AsyncTrackingConfig, process func(ctx context.Context, item Telemetry)) *trackingPool {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	pool := &trackingPool{
+		queue:         make(chan trackingJob, config.QueueSize),
+		process:       process,
+		blockWhenFull: config.BlockWhenFull,
+	}
+	pool.idle = sync.NewCond(&pool.pendingLock)
+
+	pool.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.run()
+	}
+
+	return pool
+}
+
+func (pool *trackingPool) run() {
+	defer pool.workers.Done()
+
+	for job := range pool.queue {
+		pool.processJob(job)
+	}
+}
+
+func (pool *trackingPool) processJob(job trackingJob) {
+	defer pool.done()
+	defer func() {
+		if r := recover(); r != nil {
+			diagnosticsWriter.Printf("Panic while tracking telemetry asynchronously: %v", r)
+		}
+	}()
+
+	pool.process(job.ctx, job.item)
+}
+
+// enqueue queues an item for processing.  Returns false if the pool has
+// been closed and the item must be processed by the caller.
+func (pool *trackingPool) enqueue(ctx context.Context, item Telemetry) bool {
+	pool.closeLock.RLock()
+	defer pool.closeLock.RUnlock()
+
+	if pool.closed {
+		return false
+	}
+
+	pool.pendingLock.Lock()
+	pool.pending++
+	pool.pendingLock.Unlock()
+
+	job := trackingJob{ctx, item}
+	if pool.blockWhenFull {
+		pool.queue <- job
+		return true
+	}
+
+	select {
+	case pool.queue <- job:
+		pool.full.Store(false)
+	default:
+		pool.done()
+		pool.dropped.Add(1)
+		if !pool.full.Swap(true) {
+			diagnosticsWriter.Printf("Asynchronous tracking queue is full; dropping telemetry")
+		}
+	}
+
+	return true
+}
+
+func (pool *trackingPool) done() {
+	pool.pendingLock.Lock()
+	defer pool.pendingLock.Unlock()
+
+	pool.pending--
+	if pool.pending == 0 {
+		pool.idle.Broadcast()
+	}
+}
+
+// wait blocks until all queued items have been processed
+func (pool *trackingPool) wait() {
+	pool.pendingLock.Lock()
+	defer pool.pendingLock.Unlock()
+
+	for pool.pending > 0 {
+		pool.idle.Wait()
+	}
+}
+
+// close processes the remaining queued items and stops the workers.  Items
+// tracked afterward are processed on the caller's goroutine.
+func (pool *trackingPool) close() {
+	pool.closeLock.Lock()
+	if !pool.closed {
+		pool.closed = true
+		close(pool.queue)
+	}
+	pool.closeLock.Unlock()
+
+	pool.workers.Wait()
+}
+
+// asyncTrackingChannel wraps a client's channel so that flushing and
+// closing it first finish processing queued items.
+type asyncTrackingChannel struct {
+	TelemetryChannel
+	pool *trackingPool
+}
+
+func (channel *asyncTrackingChannel) Flush() {
+	channel.pool.wait()
+	channel.TelemetryChannel.Flush()
+}
+
+func (channel *asyncTrackingChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	channel.pool.close()
+	return channel.TelemetryChannel.Close(retryTimeout...)
+}
+
+func (channel *asyncTrackingChannel) Stop() {
+	channel.pool.close()
+	channel.TelemetryChannel.Stop()
+}
@@ -0,0 +1,107 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Blocks in ShouldSample until released
+type blockingSamplingProcessor struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingSamplingProcessor) ShouldSample(envelope *contracts.Envelope) bool {
+	p.entered <- struct{}{}
+	<-p.release
+	return true
+}
+
+func (p *blockingSamplingProcessor) GetSamplingRate() float64 {
+	return 100
+}
+
+func newAsyncTestClient(config *AsyncTrackingConfig, processor SamplingProcessor) (TelemetryClient, *TestTelemetryChannel) {
+	telemetryConfig := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	telemetryConfig.AsyncTracking = config
+	telemetryConfig.SamplingProcessor = processor
+	return newTestClient(telemetryConfig)
+}
+
+func TestAsyncTracking(t *testing.T) {
+	client, testChannel := newAsyncTestClient(NewAsyncTrackingConfig(), nil)
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+	for i := 0; i < 100; i++ {
+		client.TrackEvent("event")
+		client.TrackEventWithContext(ctx, "correlated")
+	}
+
+	client.Channel().Flush()
+	if testChannel.getSentCount() != 200 {
+		t.Fatalf("Expected all items to be processed by Flush, got %d", testChannel.getSentCount())
+	}
+
+	correlated := 0
+	for _, envelope := range testChannel.sentItems {
+		if envelope.Tags[contracts.OperationId] == corrCtx.GetOperationID() {
+			correlated++
+		}
+	}
+	if correlated != 100 {
+		t.Errorf("Expected 100 correlated items, got %d", correlated)
+	}
+}
+
+func TestAsyncTrackingDoesNotBlockCaller(t *testing.T) {
+	processor := &blockingSamplingProcessor{make(chan struct{}), make(chan struct{})}
+	config := &AsyncTrackingConfig{Workers: 1, QueueSize: 1}
+	client, testChannel := newAsyncTestClient(config, processor)
+
+	// The first item occupies the worker, the second fills the queue and
+	// the third is dropped
+	client.TrackEvent("first")
+	<-processor.entered
+	client.TrackEvent("second")
+	client.TrackEvent("third")
+
+	pool := client.(*telemetryClient).asyncTracking
+	if pool.dropped.Load() != 1 {
+		t.Errorf("Expected 1 dropped item, got %d", pool.dropped.Load())
+	}
+
+	go func() {
+		for range processor.entered {
+		}
+	}()
+	close(processor.release)
+
+	client.Channel().Flush()
+	if testChannel.getSentCount() != 2 {
+		t.Errorf("Expected 2 items, got %d", testChannel.getSentCount())
+	}
+
+	close(processor.entered)
+}
+
+func TestAsyncTrackingClose(t *testing.T) {
+	client, testChannel := newAsyncTestClient(NewAsyncTrackingConfig(), nil)
+
+	for i := 0; i < 50; i++ {
+		client.TrackEvent("event")
+	}
+
+	<-client.Channel().Close()
+	if testChannel.getSentCount() != 50 {
+		t.Errorf("Expected queued items to be processed on Close, got %d", testChannel.getSentCount())
+	}
+
+	// Items tracked after closing are processed on the caller's goroutine
+	client.TrackEvent("late")
+	if testChannel.getSentCount() != 51 {
+		t.Errorf("Expected late item to be processed synchronously, got %d", testChannel.getSentCount())
+	}
+}
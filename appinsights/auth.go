@@ -0,0 +1,160 @@
+package appinsights
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Request properties used to record authentication and authorization
+// outcomes
+const (
+	// AuthSchemeProperty holds the authentication scheme, e.g. "Bearer"
+	AuthSchemeProperty = "auth.scheme"
+
+	// AuthRoleProperty holds the role the caller was authorized as
+	AuthRoleProperty = "auth.role"
+
+	// AuthOutcomeProperty holds the authorization outcome of the request
+	AuthOutcomeProperty = "auth.outcome"
+)
+
+// maxAuthRoleLength bounds the size of the recorded role
+const maxAuthRoleLength = 128
+
+// AuthOutcome describes the result of authenticating and authorizing a
+// request.
+type AuthOutcome string
+
+const (
+	// AuthOutcomeAnonymous indicates the request carried no credentials
+	AuthOutcomeAnonymous AuthOutcome = "anonymous"
+
+	// AuthOutcomeUnauthenticated indicates the credentials were rejected
+	AuthOutcomeUnauthenticated AuthOutcome = "unauthenticated"
+
+	// AuthOutcomeDenied indicates the caller was authenticated but not
+	// permitted to perform the request
+	AuthOutcomeDenied AuthOutcome = "denied"
+
+	// AuthOutcomeAllowed indicates the caller was authenticated and
+	// permitted to perform the request
+	AuthOutcomeAllowed AuthOutcome = "allowed"
+)
+
+// AuthInfo holds the authentication and authorization dimensions recorded on
+// request telemetry.  Fields must never contain credentials or user
+// identifiers: Scheme is reduced to the scheme name and Role is truncated
+// when the request telemetry is sanitized.  Record user identity through the user context tags
+// instead, where it is subject to the application's privacy settings.
+type AuthInfo struct {
+	// Scheme is the authentication scheme, e.g. "Bearer" or "Basic"
+	Scheme string
+
+	// Role is the role or permission group the caller was authorized as
+	Role string
+
+	// Outcome is the authorization outcome.  If empty, it is derived from
+	// the response status code.
+	Outcome AuthOutcome
+}
+
+// AuthInfoFunc returns the authentication and authorization dimensions for
+// a completed request, or nil to record nothing.
+type AuthInfoFunc func(r *http.Request, statusCode int) *AuthInfo
+
+// AuthSchemeFromRequest returns the scheme of the request's Authorization
+// header, without the credentials.  Returns an empty string if the request
+// carries no Authorization header.
+func AuthSchemeFromRequest(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	return authSchemeName(r.Header.Get("Authorization"))
+}
+
+// DefaultAuthInfo records the scheme of the Authorization header and derives
+// the outcome from the response status code.  It does not record a role.
+func DefaultAuthInfo(r *http.Request, statusCode int) *AuthInfo {
+	return &AuthInfo{
+		Scheme: AuthSchemeFromRequest(r),
+	}
+}
+
+// authOutcomeFromStatus derives an authorization outcome from the response
+// status code and whether the request carried credentials
+func authOutcomeFromStatus(statusCode int, hasScheme bool) AuthOutcome {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return AuthOutcomeUnauthenticated
+	case statusCode == http.StatusForbidden:
+		return AuthOutcomeDenied
+	case !hasScheme:
+		return AuthOutcomeAnonymous
+	default:
+		return AuthOutcomeAllowed
+	}
+}
+
+// authSchemeName reduces a scheme or full Authorization header value to the
+// scheme name so that credentials are never recorded
+func authSchemeName(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
+
+// applyAuthInfo records the redacted auth dimensions on the request
+// telemetry
+func applyAuthInfo(request *RequestTelemetry, info *AuthInfo, statusCode int) {
+	if info == nil {
+		return
+	}
+
+	scheme := strings.TrimSpace(info.Scheme)
+	if scheme != "" {
+		request.Properties[AuthSchemeProperty] = scheme
+	}
+
+	if role := strings.TrimSpace(info.Role); role != "" {
+		request.Properties[AuthRoleProperty] = role
+	}
+
+	outcome := info.Outcome
+	if outcome == "" {
+		outcome = authOutcomeFromStatus(statusCode, scheme != "")
+	}
+	request.Properties[AuthOutcomeProperty] = string(outcome)
+}
+
+// sanitizeAuthProperties reduces the recorded auth scheme to the scheme name
+// and truncates the recorded role.  It is applied to every request by the
+// sanitizer stage, so that the auth dimensions are redacted however they were
+// set.
+func sanitizeAuthProperties(properties map[string]string) {
+	if scheme, ok := properties[AuthSchemeProperty]; ok {
+		properties[AuthSchemeProperty] = authSchemeName(scheme)
+	}
+
+	if role, ok := properties[AuthRoleProperty]; ok && len(role) > maxAuthRoleLength {
+		properties[AuthRoleProperty] = truncateUTF8(role, maxAuthRoleLength)
+	}
+}
+
+// truncateUTF8 truncates s to at most n bytes without splitting a
+// multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
@@ -0,0 +1,198 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits of the timestamps accepted by the ingestion service.  Items outside
+// of them are rejected.
+const (
+	// MaxTelemetryAge is how old a timestamp may be
+	MaxTelemetryAge = 48 * time.Hour
+
+	// MaxTelemetryClockSkew is how far in the future a timestamp may be
+	MaxTelemetryClockSkew = 2 * time.Hour
+)
+
+var (
+	// ErrTimestampTooOld is returned for timestamps older than
+	// MaxTelemetryAge
+	ErrTimestampTooOld = errors.New("timestamp is too old to be accepted by ingestion")
+
+	// ErrTimestampInFuture is returned for timestamps more than
+	// MaxTelemetryClockSkew in the future
+	ErrTimestampInFuture = errors.New("timestamp is too far in the future to be accepted by ingestion")
+)
+
+// ValidateTimestamp returns an error if ingestion would reject telemetry
+// with the specified timestamp.
+func ValidateTimestamp(timestamp time.Time) error {
+	now := currentClock.Now()
+	if timestamp.Before(now.Add(-MaxTelemetryAge)) {
+		return ErrTimestampTooOld
+	}
+	if timestamp.After(now.Add(MaxTelemetryClockSkew)) {
+		return ErrTimestampInFuture
+	}
+
+	return nil
+}
+
+// TrackAt submits a telemetry item with an explicit timestamp, such as one
+// read from a log.  The item is not tracked if ingestion would reject the
+// timestamp.
+func TrackAt(ctx context.Context, client TelemetryClient, item Telemetry, timestamp time.Time) error {
+	if err := ValidateTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	item.SetTime(timestamp)
+	client.TrackWithContext(ctx, item)
+	return nil
+}
+
+// BackfillConfig configures a Backfiller.
+type BackfillConfig struct {
+	// Number of items tracked together, oldest first.  Defaults to 500.
+	BatchSize int
+
+	// Items whose timestamps are within this margin of MaxTelemetryAge are
+	// reported to diagnostics, as they risk being rejected if they aren't
+	// transmitted promptly.  Defaults to one hour.
+	WarningMargin time.Duration
+}
+
+// NewBackfillConfig creates a new configuration with default values.
+func NewBackfillConfig() *BackfillConfig {
+	return &BackfillConfig{
+		BatchSize:     500,
+		WarningMargin: time.Hour,
+	}
+}
+
+type backfillItem struct {
+	ctx  context.Context
+	item Telemetry
+}
+
+// Backfiller tracks historical telemetry, such as items parsed from logs,
+// in batches ordered by timestamp.  Items that ingestion would reject as too
+// old or too far in the future are dropped and reported to diagnostics.
+type Backfiller struct {
+	client TelemetryClient
+	config BackfillConfig
+
+	lock     sync.Mutex
+	pending  []backfillItem
+	rejected int
+}
+
+// NewBackfiller creates a backfiller that tracks items with the specified
+// client.  If config is nil, default values are used.
+func NewBackfiller(client TelemetryClient, config *BackfillConfig) *Backfiller {
+	defaults := NewBackfillConfig()
+	if config == nil {
+		config = defaults
+	}
+
+	resolved := *config
+	if resolved.BatchSize <= 0 {
+		resolved.BatchSize = defaults.BatchSize
+	}
+	if resolved.WarningMargin < 0 {
+		resolved.WarningMargin = 0
+	}
+
+	return &Backfiller{
+		client: client,
+		config: resolved,
+	}
+}
+
+// Track queues an item with the specified timestamp, and tracks the queued
+// items once a batch is full.  Returns an error, without queueing the item,
+// if ingestion would reject the timestamp.
+func (backfiller *Backfiller) Track(ctx context.Context, item Telemetry, timestamp time.Time) error {
+	if err := backfiller.validate(timestamp); err != nil {
+		return err
+	}
+
+	item.SetTime(timestamp)
+
+	backfiller.lock.Lock()
+	backfiller.pending = append(backfiller.pending, backfillItem{ctx, item})
+	full := len(backfiller.pending) >= backfiller.config.BatchSize
+	backfiller.lock.Unlock()
+
+	if full {
+		backfiller.Flush()
+	}
+
+	return nil
+}
+
+// Flush tracks the queued items, oldest first, and flushes the client's
+// channel.  Items that have become too old while queued are dropped.
+func (backfiller *Backfiller) Flush() {
+	backfiller.lock.Lock()
+	pending := backfiller.pending
+	backfiller.pending = nil
+	backfiller.lock.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].item.Time().Before(pending[j].item.Time())
+	})
+
+	for _, queued := range pending {
+		if err := ValidateTimestamp(queued.item.Time()); err != nil {
+			backfiller.reject(queued.item.Time(), err)
+			continue
+		}
+
+		backfiller.client.TrackWithContext(queued.ctx, queued.item)
+	}
+
+	backfiller.client.Channel().Flush()
+}
+
+// Rejected returns the number of items dropped because ingestion would
+// reject their timestamps.
+func (backfiller *Backfiller) Rejected() int {
+	backfiller.lock.Lock()
+	defer backfiller.lock.Unlock()
+
+	return backfiller.rejected
+}
+
+// validate checks a timestamp, counting and reporting rejected items and
+// warning about items at risk of being rejected
+func (backfiller *Backfiller) validate(timestamp time.Time) error {
+	if err := ValidateTimestamp(timestamp); err != nil {
+		backfiller.reject(timestamp, err)
+		return err
+	}
+
+	remaining := MaxTelemetryAge - currentClock.Now().Sub(timestamp)
+	if remaining < backfiller.config.WarningMargin {
+		diagnosticsWriter.Printf("Backfill item %s will be rejected as too old unless transmitted within %s", timestamp.Format(time.RFC3339), remaining.Round(time.Second))
+	}
+
+	return nil
+}
+
+// reject counts and reports an item dropped because of its timestamp
+func (backfiller *Backfiller) reject(timestamp time.Time, err error) {
+	backfiller.lock.Lock()
+	backfiller.rejected++
+	backfiller.lock.Unlock()
+
+	diagnosticsWriter.Printf("Backfill item dropped: %s: %s", timestamp.Format(time.RFC3339), err.Error())
+}
@@ -0,0 +1,70 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestTrackAt(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	client, testChannel := newTestClient()
+
+	now := currentClock.Now()
+	if err := TrackAt(context.Background(), client, NewEventTelemetry("old"), now.Add(-MaxTelemetryAge-time.Second)); err != ErrTimestampTooOld {
+		t.Errorf("Expected ErrTimestampTooOld, got %v", err)
+	}
+	if err := TrackAt(context.Background(), client, NewEventTelemetry("future"), now.Add(3*time.Hour)); err != ErrTimestampInFuture {
+		t.Errorf("Expected ErrTimestampInFuture, got %v", err)
+	}
+
+	timestamp := now.Add(-24 * time.Hour)
+	if err := TrackAt(context.Background(), client, NewEventTelemetry("backfilled"), timestamp); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if testChannel.getSentCount() != 1 || testChannel.sentItems[0].Time != timestamp.UTC().Format(time.RFC3339Nano) {
+		t.Errorf("Expected the item to be tracked at its timestamp, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestBackfiller(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	client, testChannel := newTestClient()
+
+	config := NewBackfillConfig()
+	config.BatchSize = 3
+	backfiller := NewBackfiller(client, config)
+
+	now := currentClock.Now()
+	backfiller.Track(context.Background(), NewTraceTelemetry("second", Information), now.Add(-time.Hour))
+	backfiller.Track(context.Background(), NewTraceTelemetry("expiring", Information), now.Add(-MaxTelemetryAge+time.Minute))
+	if err := backfiller.Track(context.Background(), NewTraceTelemetry("rejected", Information), now.Add(-MaxTelemetryAge-time.Minute)); err == nil {
+		t.Error("Expected the item to be rejected")
+	}
+	if testChannel.getSentCount() != 0 {
+		t.Fatalf("Expected items to be queued, got %d", testChannel.getSentCount())
+	}
+
+	// The queued item becomes too old before the batch is flushed
+	fakeClock.Increment(2 * time.Minute)
+	backfiller.Track(context.Background(), NewTraceTelemetry("first", Information), now.Add(-2*time.Hour))
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected the batch to be tracked, got %d items", testChannel.getSentCount())
+	}
+	for i, expected := range []string{"first", "second"} {
+		if message := testChannel.sentItems[i].Data.(*contracts.Data).BaseData.(*contracts.MessageData).Message; message != expected {
+			t.Errorf("Item %d: expected %q, got %q", i, expected, message)
+		}
+	}
+	if backfiller.Rejected() != 2 {
+		t.Errorf("Expected 2 rejected items, got %d", backfiller.Rejected())
+	}
+}
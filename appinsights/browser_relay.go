@@ -0,0 +1,316 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Types of the items accepted by BrowserTelemetryRelay
+const (
+	BrowserPageView = "pageView"
+	BrowserEvent    = "event"
+)
+
+// Limits applied to browser telemetry items
+const (
+	maxBrowserNameLength     = 512
+	maxBrowserURLLength      = 2048
+	maxBrowserProperties     = 50
+	maxBrowserPropertyKey    = 150
+	maxBrowserPropertyValue  = 8192
+	maxBrowserPageViewLength = 24 * time.Hour
+)
+
+// BrowserTelemetryPayload is the JSON document posted to a
+// BrowserTelemetryRelay by front-end code.
+type BrowserTelemetryPayload struct {
+	// Anonymous user and session IDs generated by the browser (optional)
+	UserID    string `json:"userId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+
+	Items []BrowserTelemetryItem `json:"items"`
+}
+
+// BrowserTelemetryItem is a page view or custom event reported by a
+// browser.
+type BrowserTelemetryItem struct {
+	// BrowserPageView or BrowserEvent
+	Type string `json:"type"`
+
+	// Page or event name
+	Name string `json:"name"`
+
+	// URL of the page (optional)
+	URL string `json:"url,omitempty"`
+
+	// Page load duration in milliseconds (page views only, optional)
+	DurationMs float64 `json:"durationMs,omitempty"`
+
+	// When the item occurred, in RFC 3339 format (optional).  Times
+	// further than MaxClockSkew from the server's clock are replaced.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	Properties   map[string]string  `json:"properties,omitempty"`
+	Measurements map[string]float64 `json:"measurements,omitempty"`
+}
+
+// BrowserTelemetryResponse is the JSON response of a BrowserTelemetryRelay.
+type BrowserTelemetryResponse struct {
+	Accepted int                         `json:"accepted"`
+	Rejected []BrowserTelemetryRejection `json:"rejected,omitempty"`
+}
+
+// BrowserTelemetryRejection describes an item rejected by a
+// BrowserTelemetryRelay.
+type BrowserTelemetryRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BrowserTelemetryRelay is an http.Handler accepting page views and custom
+// events from front-end code that can't use the JavaScript SDK, and
+// tracking them through a telemetry client.  Items are validated against
+// strict limits, since the payload is controlled by the browser, and are
+// stamped with the server's tags and the correlation context of the relay
+// request.  Mount it behind HTTPMiddleware so that items are correlated
+// with the browser's traceparent header.
+//
+// The handler responds with a BrowserTelemetryResponse: 200 if every item
+// was accepted, 206 if some were rejected, and 400 if none were.
+type BrowserTelemetryRelay struct {
+	// Client tracking the relayed items
+	Client TelemetryClient
+
+	// Maximum size of a payload in bytes.  Defaults to 64KB.
+	MaxBodySize int64
+
+	// Maximum number of items in a payload.  Defaults to 50.
+	MaxItems int
+
+	// Maximum difference between reported timestamps and the server's
+	// clock.  Defaults to one hour.
+	MaxClockSkew time.Duration
+
+	// ClientIP controls how the browser's IP address is recorded.
+	// Defaults to leaving it unset.
+	ClientIP ClientIPMode
+
+	// TrustForwardedFor uses the X-Forwarded-For header to determine the
+	// client IP address.  Only enable this behind a trusted proxy.
+	TrustForwardedFor bool
+}
+
+// NewBrowserTelemetryRelay creates a relay tracking items through client.
+func NewBrowserTelemetryRelay(client TelemetryClient) *BrowserTelemetryRelay {
+	return &BrowserTelemetryRelay{
+		Client:       client,
+		MaxBodySize:  64 * 1024,
+		MaxItems:     50,
+		MaxClockSkew: time.Hour,
+	}
+}
+
+// ServeHTTP validates and tracks the items posted in the request body.
+func (relay *BrowserTelemetryRelay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxBodySize := relay.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = 64 * 1024
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > maxBodySize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var payload BrowserTelemetryPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxItems := relay.MaxItems
+	if maxItems <= 0 {
+		maxItems = 50
+	}
+	if len(payload.Items) > maxItems {
+		http.Error(w, fmt.Sprintf("too many items: the limit is %d", maxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ip := applyClientIP(r, relay.ClientIP, relay.TrustForwardedFor)
+
+	var response BrowserTelemetryResponse
+	for index, item := range payload.Items {
+		telemetry, err := relay.convert(&payload, &item)
+		if err != nil {
+			response.Rejected = append(response.Rejected, BrowserTelemetryRejection{index, err.Error()})
+			continue
+		}
+
+		if ip != "" {
+			contracts.ContextTags(telemetry.ContextTags()).Location().SetIp(ip)
+		}
+
+		relay.Client.TrackWithContext(r.Context(), telemetry)
+		response.Accepted++
+	}
+
+	status := http.StatusOK
+	if response.Accepted == 0 && len(response.Rejected) > 0 {
+		status = http.StatusBadRequest
+	} else if len(response.Rejected) > 0 {
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// convert validates a browser item and creates the corresponding
+// telemetry
+func (relay *BrowserTelemetryRelay) convert(payload *BrowserTelemetryPayload, item *BrowserTelemetryItem) (Telemetry, error) {
+	if item.Name == "" || len(item.Name) > maxBrowserNameLength {
+		return nil, fmt.Errorf("name must be between 1 and %d characters", maxBrowserNameLength)
+	}
+	if err := validateBrowserURL(item.URL); err != nil {
+		return nil, err
+	}
+	if err := validateBrowserProperties(item.Properties, item.Measurements); err != nil {
+		return nil, err
+	}
+
+	var telemetry Telemetry
+	switch item.Type {
+	case BrowserPageView:
+		if item.DurationMs < 0 || math.IsNaN(item.DurationMs) || time.Duration(item.DurationMs*float64(time.Millisecond)) > maxBrowserPageViewLength {
+			return nil, fmt.Errorf("durationMs must be between 0 and %d", maxBrowserPageViewLength.Milliseconds())
+		}
+
+		pageView := NewPageViewTelemetry(item.Name, item.URL)
+		pageView.Duration = time.Duration(item.DurationMs * float64(time.Millisecond))
+		copyBrowserProperties(item, pageView.Properties, pageView.Measurements)
+		telemetry = pageView
+	case BrowserEvent:
+		if item.DurationMs != 0 {
+			return nil, fmt.Errorf("durationMs is only valid for page views")
+		}
+
+		event := NewEventTelemetry(item.Name)
+		copyBrowserProperties(item, event.Properties, event.Measurements)
+		if item.URL != "" {
+			event.Properties["url"] = item.URL
+		}
+		telemetry = event
+	default:
+		return nil, fmt.Errorf("unsupported type %q", item.Type)
+	}
+
+	if timestamp, ok := relay.timestamp(item.Timestamp); ok {
+		telemetry.SetTime(timestamp)
+	}
+
+	tags := contracts.ContextTags(telemetry.ContextTags())
+	tags.Device().SetType("Browser")
+	if payload.UserID != "" && len(payload.UserID) <= 128 {
+		tags.User().SetId(payload.UserID)
+	}
+	if payload.SessionID != "" && len(payload.SessionID) <= 64 {
+		tags.Session().SetId(payload.SessionID)
+	}
+
+	return telemetry, nil
+}
+
+// timestamp returns the reported timestamp if it is within the allowed
+// clock skew
+func (relay *BrowserTelemetryRelay) timestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	skew := currentClock.Since(timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	maxClockSkew := relay.MaxClockSkew
+	if maxClockSkew <= 0 {
+		maxClockSkew = time.Hour
+	}
+
+	return timestamp, skew <= maxClockSkew
+}
+
+func validateBrowserURL(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	if len(value) > maxBrowserURLLength {
+		return fmt.Errorf("url must not exceed %d characters", maxBrowserURLLength)
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	return nil
+}
+
+func validateBrowserProperties(properties map[string]string, measurements map[string]float64) error {
+	if len(properties)+len(measurements) > maxBrowserProperties {
+		return fmt.Errorf("at most %d properties and measurements are allowed", maxBrowserProperties)
+	}
+
+	for key, value := range properties {
+		if key == "" || len(key) > maxBrowserPropertyKey || len(value) > maxBrowserPropertyValue {
+			return fmt.Errorf("property %q exceeds the size limits", key)
+		}
+	}
+
+	for key, value := range measurements {
+		if key == "" || len(key) > maxBrowserPropertyKey {
+			return fmt.Errorf("measurement %q exceeds the size limits", key)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("measurement %q must be finite", key)
+		}
+	}
+
+	return nil
+}
+
+func copyBrowserProperties(item *BrowserTelemetryItem, properties map[string]string, measurements map[string]float64) {
+	for key, value := range item.Properties {
+		properties[key] = value
+	}
+
+	for key, value := range item.Measurements {
+		measurements[key] = value
+	}
+}
@@ -0,0 +1,102 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newBrowserRelayTest() (*BrowserTelemetryRelay, *TestTelemetryChannel) {
+	client, testChannel := newTestClient()
+
+	relay := NewBrowserTelemetryRelay(client)
+	relay.ClientIP = ClientIPMask
+	return relay, testChannel
+}
+
+func postBrowserTelemetry(handler http.Handler, body string) (*httptest.ResponseRecorder, BrowserTelemetryResponse) {
+	req := httptest.NewRequest("POST", "/telemetry", strings.NewReader(body))
+	req.RemoteAddr = "198.51.100.7:5000"
+	req.Header.Set(TraceParentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	var response BrowserTelemetryResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func TestBrowserTelemetryRelay(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	relay, testChannel := newBrowserRelayTest()
+	handler := NewHTTPMiddleware().Middleware(relay)
+
+	reported := currentClock.Now().Add(-time.Minute).Format(time.RFC3339)
+	recorder, response := postBrowserTelemetry(handler, `{
+		"userId": "user-1",
+		"sessionId": "session-1",
+		"items": [
+			{"type": "pageView", "name": "Home", "url": "https://example.com/", "durationMs": 1500, "timestamp": "`+reported+`"},
+			{"type": "event", "name": "clicked", "properties": {"button": "buy"}, "timestamp": "1999-01-01T00:00:00Z"},
+			{"type": "exception", "name": "boom"},
+			{"type": "event", "name": "", "measurements": {"value": 1}}
+		]
+	}`)
+
+	if recorder.Code != http.StatusPartialContent || response.Accepted != 2 || len(response.Rejected) != 2 || response.Rejected[0].Index != 2 {
+		t.Fatalf("Expected two items to be accepted, got %d %+v", recorder.Code, response)
+	}
+
+	pageView := testChannel.sentItems[0]
+	data := pageView.Data.(*contracts.Data).BaseData.(*contracts.PageViewData)
+	if data.Name != "Home" || data.Duration != "0.00:00:01.5000000" {
+		t.Errorf("Unexpected page view: %+v", data)
+	}
+	if pageView.Time != currentClock.Now().Add(-time.Minute).UTC().Format("2006-01-02T15:04:05.999999Z") {
+		t.Errorf("Expected the reported timestamp, got %s", pageView.Time)
+	}
+	if pageView.Tags[contracts.OperationId] != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("Expected the browser's operation, got %q", pageView.Tags[contracts.OperationId])
+	}
+	if pageView.Tags[contracts.UserId] != "user-1" || pageView.Tags[contracts.SessionId] != "session-1" || pageView.Tags[contracts.DeviceType] != "Browser" {
+		t.Errorf("Unexpected tags: %v", pageView.Tags)
+	}
+	if pageView.Tags[contracts.LocationIp] != "198.51.100.0" {
+		t.Errorf("Expected the masked client IP, got %q", pageView.Tags[contracts.LocationIp])
+	}
+
+	event := testChannel.sentItems[1]
+	if event.Time != currentClock.Now().UTC().Format("2006-01-02T15:04:05.999999Z") {
+		t.Errorf("Expected a skewed timestamp to be replaced, got %s", event.Time)
+	}
+}
+
+func TestBrowserTelemetryRelayLimits(t *testing.T) {
+	relay, testChannel := newBrowserRelayTest()
+	relay.MaxBodySize = 64
+	relay.MaxItems = 1
+
+	if recorder, _ := postBrowserTelemetry(relay, `{"items":[{"type":"event","name":"`+strings.Repeat("x", 64)+`"}]}`); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected an oversized payload to be rejected, got %d", recorder.Code)
+	}
+	if recorder, _ := postBrowserTelemetry(relay, `{"items":[{"type":"event","name":"a"},{"type":"event","name":"b"}]}`); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected too many items to be rejected, got %d", recorder.Code)
+	}
+	if recorder, _ := postBrowserTelemetry(relay, `{"items":[{"type":"event","name":"a","url":"javascript:x"}]}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid URL to be rejected, got %d", recorder.Code)
+	}
+	if recorder, _ := postBrowserTelemetry(relay, `not json`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid JSON to be rejected, got %d", recorder.Code)
+	}
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected nothing to be tracked, got %d items", testChannel.getSentCount())
+	}
+}
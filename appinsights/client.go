@@ -3,14 +3,41 @@ package appinsights
 import (
 	"context"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
+// Tracker submits telemetry items.  Integrations that only track telemetry
+// accept a Tracker rather than a TelemetryClient, which makes them simple to
+// test with a fake.
+type Tracker interface {
+	// Submits the specified telemetry item.
+	Track(telemetry Telemetry)
+}
+
+// ContextTracker submits telemetry items correlated with the operation found
+// in a context.
+type ContextTracker interface {
+	// Submits the specified telemetry item with correlation context support.
+	TrackWithContext(ctx context.Context, telemetry Telemetry)
+}
+
+// Flusher forces buffered telemetry to be sent.
+type Flusher interface {
+	// Forces the current queue to be sent
+	Flush()
+}
+
 // Application Insights telemetry client provides interface to track telemetry
-// items.
+// items.  It is composed of Tracker and ContextTracker along with methods to
+// configure the client and convenience tracking methods; prefer accepting the
+// smaller interfaces where they suffice.
 type TelemetryClient interface {
+	Tracker
+	ContextTracker
+
 	// Gets the telemetry context for this client. Values found on this
 	// context will get written out to every telemetry item tracked by
 	// this client.
@@ -29,12 +56,6 @@ type TelemetryClient interface {
 	// is silently swallowed by the client. Defaults to enabled.
 	SetIsEnabled(enabled bool)
 
-	// Submits the specified telemetry item.
-	Track(telemetry Telemetry)
-
-	// Submits the specified telemetry item with correlation context support.
-	TrackWithContext(ctx context.Context, telemetry Telemetry)
-
 	// Log a user action with the specified name
 	TrackEvent(name string)
 
@@ -100,11 +121,32 @@ type TelemetryClient interface {
 type telemetryClient struct {
 	channel               TelemetryChannel
 	context               *TelemetryContext
-	isEnabled             bool
+	isEnabled             atomic.Bool
 	samplingProcessor     SamplingProcessor
 	performanceManager    *PerformanceCounterManager
 	errorAutoCollector    *ErrorAutoCollector
 	autoCollectionManager *AutoCollectionManager
+	durationHistograms    *DurationHistogramCollector
+	dependencySummaries   *DependencySummaryCollector
+	samplingRates         *samplingRateReporter
+	enrichment            *enrichmentStage
+	errorTraces           *errorTraceBuffer
+	operationBudget       *operationBudget
+	retryStorms           *retryStormDetector
+	diagnostics           *diagnosticLimiter
+	shadow                *ShadowChannel
+
+	// Whether to prefix event names with the operation name
+	hierarchicalEventNames bool
+
+	// Schema versions applied to custom events, if any
+	eventVersioning *EventVersioning
+
+	// Callback invoked with each envelope before it is sent
+	onTracked func(envelope *contracts.Envelope)
+
+	// Worker pool for asynchronous tracking, if enabled
+	asyncTracking *trackingPool
 }
 
 // Creates a new telemetry client instance that submits telemetry with the
@@ -119,8 +161,23 @@ func NewTelemetryClient(iKey string) TelemetryClient {
 }
 
 // Creates a new telemetry client instance configured by the specified
-// TelemetryConfiguration object.
+// TelemetryConfiguration object.  The configuration is validated first; see
+// TelemetryConfiguration.StrictValidation.
 func NewTelemetryClientFromConfig(config *TelemetryConfiguration) TelemetryClient {
+	if err := config.Validate(); err != nil {
+		if config.StrictValidation {
+			panic(err)
+		}
+
+		diagnosticsWriter.Printf("%s", err)
+	}
+
+	return newTelemetryClient(config, NewInMemoryChannel(config))
+}
+
+// newTelemetryClient creates a client submitting telemetry to the specified
+// channel, which may be shared with other clients.
+func newTelemetryClient(config *TelemetryConfiguration, channel TelemetryChannel) *telemetryClient {
 	samplingProcessor := config.SamplingProcessor
 	if samplingProcessor == nil {
 		// Default to no sampling (100% rate) for backward compatibility
@@ -128,13 +185,27 @@ func NewTelemetryClientFromConfig(config *TelemetryConfiguration) TelemetryClien
 	}
 
 	client := &telemetryClient{
-		channel:           NewInMemoryChannel(config),
+		channel:           channel,
 		context:           config.setupContext(),
-		isEnabled:         true,
 		samplingProcessor: samplingProcessor,
+		samplingRates:     newSamplingRateReporter(config),
+		enrichment:        newEnrichmentStage(config.Enrichment),
+		errorTraces:       newErrorTraceBuffer(config.ErrorTraceBuffer),
+		operationBudget:   newOperationBudget(config.OperationBudget),
+		retryStorms:       newRetryStormDetector(config.RetryStorms),
+		diagnostics:       newDiagnosticLimiter(config.MaxDiagnosticsPerMinute),
+
+		hierarchicalEventNames: config.HierarchicalEventNames,
+		eventVersioning:        config.EventVersioning,
+		onTracked:              config.OnTracked,
 	}
 
-	client.context.Tags.Application().SetId(config.ApplicationId)
+	client.isEnabled.Store(true)
+	client.context.SetTag(contracts.ApplicationId, config.ApplicationId)
+	client.context.clockOffset = config.ClockOffset
+	client.context.propertyLimit = config.PropertyLimit
+	client.context.sanitizer = config.URLSanitizer
+	client.context.redaction = newRedactionStage(config.RedactionPolicy)
 
 	// Initialize error auto-collection if configured
 	if config.ErrorAutoCollection != nil {
@@ -146,6 +217,41 @@ func NewTelemetryClientFromConfig(config *TelemetryConfiguration) TelemetryClien
 		client.autoCollectionManager = NewAutoCollectionManager(client, config.AutoCollection)
 	}
 
+	// Initialize duration histograms if configured
+	if config.DurationHistograms != nil && config.DurationHistograms.Enabled {
+		client.durationHistograms = NewDurationHistogramCollector(client, config.DurationHistograms)
+		client.durationHistograms.Start()
+	}
+
+	// Initialize dependency summaries if configured.  They bypass sampling.
+	if config.DependencySummaries != nil {
+		client.dependencySummaries = newDependencySummaryCollector(func(item Telemetry) {
+			client.channel.Send(client.context.envelop(item))
+		}, config.DependencySummaries)
+		client.dependencySummaries.Start()
+	}
+
+	// Duplicate telemetry to a shadow destination if configured
+	if config.Shadow != nil && config.Shadow.Config != nil {
+		client.shadow = NewShadowChannel(client.channel, config.Shadow)
+		client.channel = client.shadow
+	}
+
+	// Stop the periodic collectors when the channel is closed
+	if client.durationHistograms != nil || client.dependencySummaries != nil {
+		client.channel = &collectorChannel{client.channel, client}
+	}
+
+	// Initialize asynchronous tracking if configured
+	if config.AsyncTracking != nil {
+		client.asyncTracking = newTrackingPool(config.AsyncTracking, client.process)
+		client.channel = &asyncTrackingChannel{client.channel, client.asyncTracking}
+	}
+
+	if config.TrackDeploymentOnStartup {
+		trackDeploymentFromEnvironment(client)
+	}
+
 	return client
 }
 
@@ -165,74 +271,205 @@ func (tc *telemetryClient) InstrumentationKey() string {
 	return tc.context.InstrumentationKey()
 }
 
-// Gets whether this client is enabled and will accept telemetry.
+// Gets whether this client is enabled and will accept telemetry.  Always
+// false while telemetry is disabled globally with SetTelemetryDisabled.
 func (tc *telemetryClient) IsEnabled() bool {
-	return tc.isEnabled
+	return tc.isEnabled.Load() && !IsTelemetryDisabled()
 }
 
 // Enables or disables the telemetry client.  When disabled, telemetry is
 // silently swallowed by the client.  Defaults to enabled.
 func (tc *telemetryClient) SetIsEnabled(isEnabled bool) {
-	tc.isEnabled = isEnabled
+	tc.isEnabled.Store(isEnabled)
 }
 
 // Submits the specified telemetry item.
 func (tc *telemetryClient) Track(item Telemetry) {
-	if tc.isEnabled && item != nil {
-		envelope := tc.context.envelop(item)
-		if tc.samplingProcessor.ShouldSample(envelope) {
-			tc.channel.Send(envelope)
+	if tc.IsEnabled() && item != nil && !isTrackingSuppressed(nil) {
+		if tc.asyncTracking != nil && tc.asyncTracking.enqueue(nil, item) {
+			return
 		}
+
+		tc.process(nil, item)
 	}
 }
 
 // Submits the specified telemetry item with correlation context support.
 func (tc *telemetryClient) TrackWithContext(ctx context.Context, item Telemetry) {
-	if tc.isEnabled && item != nil {
-		envelope := tc.context.envelopWithContext(ctx, item)
-		if tc.samplingProcessor.ShouldSample(envelope) {
-			tc.channel.Send(envelope)
+	if tc.IsEnabled() && item != nil && !isTrackingSuppressed(ctx) {
+		if tc.asyncTracking != nil && tc.asyncTracking.enqueue(ctx, item) {
+			return
+		}
+
+		tc.process(ctx, item)
+	}
+}
+
+// Envelops the specified telemetry item with the optional correlation
+// context, and submits it.
+func (tc *telemetryClient) process(ctx context.Context, item Telemetry) {
+	// Items queued for asynchronous tracking are dropped as soon as
+	// telemetry is disabled globally
+	if IsTelemetryDisabled() {
+		return
+	}
+
+	if event, ok := item.(*EventTelemetry); ok {
+		// Versioned by the name used at the call site
+		if tc.eventVersioning != nil {
+			tc.eventVersioning.Apply(event)
+		}
+
+		if ctx != nil && tc.hierarchicalEventNames {
+			event.Name = hierarchicalEventName(ctx, event.Name)
+		}
+	}
+
+	tc.durationHistograms.Observe(item)
+	tc.dependencySummaries.Observe(item)
+	storm := tc.retryStorms.observe(item)
+	tc.submit(tc.context.envelopWithContext(ctx, item))
+
+	// Reported within the operation whose dependency started the storm
+	if storm != nil {
+		tc.submit(tc.context.envelopWithContext(ctx, storm))
+	}
+}
+
+// Passes an envelope through the processor stage and sends it to the
+// channel if it is kept.
+func (tc *telemetryClient) submit(envelope *contracts.Envelope) {
+	bindDeliveryReceipts(envelope)
+
+	if IsEssentialTelemetryOnly() && !IsEssentialTelemetry(envelope) {
+		releaseFinalizers(envelope)
+		return
+	}
+
+	if !tc.operationBudget.admit(envelope) {
+		releaseFinalizers(envelope)
+		return
+	}
+
+	tc.shadow.Duplicate(envelope)
+
+	kept := tc.samplingProcessor.ShouldSample(envelope)
+	for _, report := range tc.samplingRates.observe(envelope, kept) {
+		tc.channel.Send(report)
+	}
+
+	// Failed operations keep the items that sampling dropped
+	if failed, held := tc.errorTraces.complete(envelope); failed {
+		for _, item := range held {
+			retainOnError(item)
+			tc.send(item)
+		}
+
+		if !kept {
+			retainOnError(envelope)
+			kept = true
 		}
 	}
+
+	if kept {
+		tc.send(envelope)
+	} else if !tc.errorTraces.hold(envelope) {
+		releaseFinalizers(envelope)
+	}
+}
+
+// Enriches a kept envelope and sends it to the channel.
+func (tc *telemetryClient) send(envelope *contracts.Envelope) {
+	tc.enrichment.enrich(envelope)
+
+	if tc.onTracked != nil {
+		tc.notifyTracked(envelope)
+	}
+
+	tc.channel.Send(envelope)
+}
+
+// Invokes the OnTracked callback, recovering from any panic so that a
+// faulty callback does not prevent the envelope from being sent.
+func (tc *telemetryClient) notifyTracked(envelope *contracts.Envelope) {
+	defer enterTelemetryCallback()()
+	defer func() {
+		if r := recover(); r != nil {
+			diagnosticsWriter.Printf("OnTracked callback panicked: %v", r)
+		}
+	}()
+
+	tc.onTracked(envelope)
 }
 
+// The helpers below check IsEnabled before constructing telemetry items so
+// that tracking with a disabled client costs next to nothing.
+
 // Log a user action with the specified name
 func (tc *telemetryClient) TrackEvent(name string) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewEventTelemetry(name))
 }
 
 // Log a numeric value that is not specified with a specific event.
 // Typically used to send regular reports of performance indicators.
 func (tc *telemetryClient) TrackMetric(name string, value float64) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewMetricTelemetry(name, value))
 }
 
 // Log a trace message with the specified severity level.
 func (tc *telemetryClient) TrackTrace(message string, severity contracts.SeverityLevel) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewTraceTelemetry(message, severity))
 }
 
 // Log an HTTP request with the specified method, URL, duration and response
 // code.
 func (tc *telemetryClient) TrackRequest(method, url string, duration time.Duration, responseCode string) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewRequestTelemetry(method, url, duration, responseCode))
 }
 
 // Log a dependency with the specified name, type, target, and success
 // status.
 func (tc *telemetryClient) TrackRemoteDependency(name, dependencyType, target string, success bool) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewRemoteDependencyTelemetry(name, dependencyType, target, success))
 }
 
 // Log an availability test result with the specified test name, duration,
 // and success status.
 func (tc *telemetryClient) TrackAvailability(name string, duration time.Duration, success bool) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(NewAvailabilityTelemetry(name, duration, success))
 }
 
 // Log an exception with the specified error, which may be a string, error
 // or Stringer.  The current callstack is collected automatically.
 func (tc *telemetryClient) TrackException(err interface{}) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.Track(newExceptionTelemetry(err, 1))
 }
 
@@ -240,26 +477,46 @@ func (tc *telemetryClient) TrackException(err interface{}) {
 
 // Log a user action with the specified name and correlation context
 func (tc *telemetryClient) TrackEventWithContext(ctx context.Context, name string) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.TrackWithContext(ctx, NewEventTelemetry(name))
 }
 
 // Log a trace message with the specified severity level and correlation context
 func (tc *telemetryClient) TrackTraceWithContext(ctx context.Context, message string, severity contracts.SeverityLevel) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.TrackWithContext(ctx, NewTraceTelemetry(message, severity))
 }
 
 // Log an HTTP request with correlation context
 func (tc *telemetryClient) TrackRequestWithContext(ctx context.Context, method, url string, duration time.Duration, responseCode string) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.TrackWithContext(ctx, NewRequestTelemetryWithContext(ctx, method, url, duration, responseCode))
 }
 
 // Log a dependency with correlation context
 func (tc *telemetryClient) TrackRemoteDependencyWithContext(ctx context.Context, name, dependencyType, target string, success bool) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.TrackWithContext(ctx, NewRemoteDependencyTelemetryWithContext(ctx, name, dependencyType, target, success))
 }
 
 // Log an availability test result with correlation context
 func (tc *telemetryClient) TrackAvailabilityWithContext(ctx context.Context, name string, duration time.Duration, success bool) {
+	if !tc.IsEnabled() {
+		return
+	}
+
 	tc.TrackWithContext(ctx, NewAvailabilityTelemetryWithContext(ctx, name, duration, success))
 }
 
@@ -0,0 +1,105 @@
+package appinsights
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ForwardedForHeader is the de-facto standard header used by proxies to
+// convey the originating client address.
+const ForwardedForHeader = "X-Forwarded-For"
+
+// ClientIPMode controls how the client IP address of incoming requests is
+// recorded in the ai.location.ip tag.
+type ClientIPMode int
+
+const (
+	// ClientIPDefault leaves ai.location.ip unset.  The ingestion endpoint
+	// will apply its own handling based on the address of the sender.
+	ClientIPDefault ClientIPMode = iota
+
+	// ClientIPCapture records the full client IP address.
+	ClientIPCapture
+
+	// ClientIPMask records the client IP address with the last octet of an
+	// IPv4 address (or the interface identifier of an IPv6 address) zeroed.
+	ClientIPMask
+
+	// ClientIPDrop records 0.0.0.0 so that no client address is retained,
+	// including the address of the sender seen by the ingestion endpoint.
+	ClientIPDrop
+)
+
+// droppedClientIP is the value recorded when client IPs are dropped
+const droppedClientIP = "0.0.0.0"
+
+// ClientIPFromRequest determines the client IP address of an incoming
+// request.  If trustForwardedFor is set, the left-most address of the
+// X-Forwarded-For header is preferred over the connection's remote address.
+// Only enable this behind a proxy that sets the header, since clients can
+// otherwise spoof it.  Returns an empty string if no address is found.
+func ClientIPFromRequest(r *http.Request, trustForwardedFor bool) string {
+	if r == nil {
+		return ""
+	}
+
+	if trustForwardedFor {
+		if forwarded := r.Header.Get(ForwardedForHeader); forwarded != "" {
+			first := strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			if ip := net.ParseIP(stripPort(first)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	if ip := net.ParseIP(stripPort(r.RemoteAddr)); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
+
+// MaskClientIP zeroes the last octet of an IPv4 address, or the lower 64
+// bits of an IPv6 address.  Returns an empty string if ip is not a valid
+// address.
+func MaskClientIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return net.IPv4(v4[0], v4[1], v4[2], 0).String()
+	}
+
+	masked := make(net.IP, net.IPv6len)
+	copy(masked, parsed.To16()[:8])
+	return masked.String()
+}
+
+// applyClientIP returns the value to record for the client IP of the
+// specified request according to mode, or an empty string if nothing should
+// be recorded.
+func applyClientIP(r *http.Request, mode ClientIPMode, trustForwardedFor bool) string {
+	switch mode {
+	case ClientIPCapture:
+		return ClientIPFromRequest(r, trustForwardedFor)
+	case ClientIPMask:
+		return MaskClientIP(ClientIPFromRequest(r, trustForwardedFor))
+	case ClientIPDrop:
+		return droppedClientIP
+	default:
+		return ""
+	}
+}
+
+// stripPort removes an optional port (and IPv6 brackets) from a host
+// address.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,116 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestClientIPFromRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		trust      bool
+		expected   string
+	}{
+		{"remote addr", "203.0.113.7:5000", "", false, "203.0.113.7"},
+		{"remote addr without port", "203.0.113.7", "", false, "203.0.113.7"},
+		{"ipv6 remote addr", "[2001:db8::1]:443", "", false, "2001:db8::1"},
+		{"untrusted forwarded for", "10.0.0.1:5000", "198.51.100.2", false, "10.0.0.1"},
+		{"trusted forwarded for", "10.0.0.1:5000", "198.51.100.2, 10.0.0.5", true, "198.51.100.2"},
+		{"trusted forwarded for with port", "10.0.0.1:5000", "198.51.100.2:1234", true, "198.51.100.2"},
+		{"invalid forwarded for", "10.0.0.1:5000", "garbage", true, "10.0.0.1"},
+		{"invalid remote addr", "pipe", "", false, ""},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tst.remoteAddr
+			if tst.forwarded != "" {
+				req.Header.Set(ForwardedForHeader, tst.forwarded)
+			}
+
+			if ip := ClientIPFromRequest(req, tst.trust); ip != tst.expected {
+				t.Errorf("Expected %q, got %q", tst.expected, ip)
+			}
+		})
+	}
+}
+
+func TestMaskClientIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":                          "203.0.113.0",
+		"2001:db8:85a3:8d3:1319:8a2e:370:7348": "2001:db8:85a3:8d3::",
+		"not an ip":                            "",
+	}
+
+	for ip, expected := range tests {
+		if masked := MaskClientIP(ip); masked != expected {
+			t.Errorf("MaskClientIP(%q): expected %q, got %q", ip, expected, masked)
+		}
+	}
+}
+
+func TestMiddlewareClientIPModes(t *testing.T) {
+	tests := []struct {
+		mode     ClientIPMode
+		expected string
+		present  bool
+	}{
+		{ClientIPDefault, "", false},
+		{ClientIPCapture, "203.0.113.7", true},
+		{ClientIPMask, "203.0.113.0", true},
+		{ClientIPDrop, "0.0.0.0", true},
+	}
+
+	for _, tst := range tests {
+		var captured *RequestTelemetry
+		middleware := NewHTTPMiddleware()
+		middleware.ClientIP = tst.mode
+		middleware.GetClient = func(*http.Request) TelemetryClient {
+			return &mockTelemetryClient{trackFunc: func(item interface{}) {
+				captured = item.(*RequestTelemetry)
+			}}
+		}
+
+		handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if captured == nil {
+			t.Fatalf("Mode %d: expected request telemetry", tst.mode)
+		}
+
+		ip, ok := captured.Tags[contracts.LocationIp]
+		if ok != tst.present || ip != tst.expected {
+			t.Errorf("Mode %d: expected ip %q (present=%v), got %q (present=%v)", tst.mode, tst.expected, tst.present, ip, ok)
+		}
+	}
+}
+
+func TestMiddlewareClientIPTrustForwardedFor(t *testing.T) {
+	var captured *RequestTelemetry
+	middleware := NewHTTPMiddleware()
+	middleware.ClientIP = ClientIPCapture
+	middleware.TrustForwardedFor = true
+	middleware.GetClient = func(*http.Request) TelemetryClient {
+		return &mockTelemetryClient{trackFunc: func(item interface{}) {
+			captured = item.(*RequestTelemetry)
+		}}
+	}
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set(ForwardedForHeader, "198.51.100.2, 10.0.0.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if ip := captured.Tags[contracts.LocationIp]; ip != "198.51.100.2" {
+		t.Errorf("Expected forwarded client ip, got %q", ip)
+	}
+}
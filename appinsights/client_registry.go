@@ -0,0 +1,158 @@
+package appinsights
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// ClientRegistration configures a client created by a ClientRegistry.
+type ClientRegistration struct {
+	// Cloud role name of the telemetry tracked by the client.  Defaults to
+	// the name the client is registered under.
+	RoleName string
+
+	// Sampling processor of the client.  Defaults to the registry
+	// configuration's sampling processor.
+	SamplingProcessor SamplingProcessor
+}
+
+// ClientRegistry manages named telemetry clients for the logical services or
+// modules of a single process.  The clients share one channel, and therefore
+// one buffer and connection to the ingestion endpoint, but each records its
+// own cloud role name and may sample differently.
+type ClientRegistry struct {
+	config  *TelemetryConfiguration
+	channel TelemetryChannel
+
+	lock    sync.Mutex
+	clients map[string]*telemetryClient
+	closed  bool
+}
+
+// NewClientRegistry creates a registry whose clients are configured by
+// config, except for their role names and sampling processors.
+func NewClientRegistry(config *TelemetryConfiguration) *ClientRegistry {
+	return &ClientRegistry{
+		config:  config,
+		channel: NewInMemoryChannel(config),
+		clients: make(map[string]*telemetryClient),
+	}
+}
+
+// Register creates a client under the specified name.  registration may be
+// nil to use the defaults.  Returns an error if the name is already
+// registered or the registry has been shut down.
+func (registry *ClientRegistry) Register(name string, registration *ClientRegistration) (TelemetryClient, error) {
+	if registration == nil {
+		registration = &ClientRegistration{}
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if registry.closed {
+		return nil, fmt.Errorf("client registry is shut down")
+	}
+	if _, ok := registry.clients[name]; ok {
+		return nil, fmt.Errorf("client %q is already registered", name)
+	}
+
+	config := *registry.config
+	if registration.SamplingProcessor != nil {
+		config.SamplingProcessor = registration.SamplingProcessor
+	}
+
+	client := newTelemetryClient(&config, registry.channel)
+
+	roleName := registration.RoleName
+	if roleName == "" {
+		roleName = name
+	}
+	client.context.SetTag(contracts.CloudRole, roleName)
+
+	registry.clients[name] = client
+	return client, nil
+}
+
+// Client returns the client registered under the specified name, or nil.
+func (registry *ClientRegistry) Client(name string) TelemetryClient {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if client, ok := registry.clients[name]; ok {
+		return client
+	}
+
+	return nil
+}
+
+// Names returns the sorted names of the registered clients.
+func (registry *ClientRegistry) Names() []string {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	names := make([]string, 0, len(registry.clients))
+	for name := range registry.clients {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Channel returns the channel shared by the registered clients.
+func (registry *ClientRegistry) Channel() TelemetryChannel {
+	return registry.channel
+}
+
+// Shutdown stops the background collection of every registered client,
+// then closes the shared channel.  retryTimeout has the same meaning as for
+// TelemetryChannel.Close.  Returns a channel that is closed when the pending
+// telemetry has been submitted.  Further registrations fail.
+func (registry *ClientRegistry) Shutdown(retryTimeout ...time.Duration) <-chan struct{} {
+	registry.lock.Lock()
+	clients := registry.clients
+	alreadyClosed := registry.closed
+	registry.closed = true
+	registry.lock.Unlock()
+
+	if alreadyClosed {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	for _, client := range clients {
+		client.shutdownCollection()
+	}
+
+	return registry.channel.Close(retryTimeout...)
+}
+
+// shutdownCollection stops the client's background collection and processes
+// the items queued for asynchronous tracking, leaving the channel open
+func (tc *telemetryClient) shutdownCollection() {
+	tc.StopPerformanceCounterCollection()
+
+	if tc.autoCollectionManager != nil {
+		tc.autoCollectionManager.Stop()
+	}
+
+	if tc.durationHistograms != nil {
+		tc.durationHistograms.Stop()
+	}
+
+	if tc.dependencySummaries != nil {
+		tc.dependencySummaries.Stop()
+	}
+
+	if tc.asyncTracking != nil {
+		tc.asyncTracking.close()
+	}
+
+	tc.context.redaction.Stop()
+}
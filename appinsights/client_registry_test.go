@@ -0,0 +1,93 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// closeCountingChannel is a test channel counting how often it is closed
+type closeCountingChannel struct {
+	TestTelemetryChannel
+	closes int
+}
+
+func (c *closeCountingChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	c.closes++
+	return c.TestTelemetryChannel.Close(retryTimeout...)
+}
+
+func newTestClientRegistry() (*ClientRegistry, *closeCountingChannel) {
+	registry := NewClientRegistry(NewTelemetryConfiguration("InstrumentationKey=" + test_ikey))
+	registry.channel.Stop()
+
+	testChannel := &closeCountingChannel{}
+	registry.channel = testChannel
+	return registry, testChannel
+}
+
+func TestClientRegistry(t *testing.T) {
+	registry, testChannel := newTestClientRegistry()
+
+	orders, err := registry.Register("orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing, err := registry.Register("billing", &ClientRegistration{
+		RoleName:          "billing-worker",
+		SamplingProcessor: NewFixedRateSamplingProcessor(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Register("orders", nil); err == nil {
+		t.Error("Expected registering a duplicate name to fail")
+	}
+	if registry.Client("orders") != orders || registry.Client("missing") != nil {
+		t.Error("Unexpected client lookup")
+	}
+	if names := registry.Names(); len(names) != 2 || names[0] != "billing" || names[1] != "orders" {
+		t.Errorf("Unexpected names: %v", names)
+	}
+	if orders.Channel() != billing.Channel() {
+		t.Error("Expected the clients to share a channel")
+	}
+
+	orders.TrackEvent("placed")
+	billing.TrackEvent("charged")
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected billing telemetry to be sampled out, got %d items", testChannel.getSentCount())
+	}
+	if role := testChannel.sentItems[0].Tags[contracts.CloudRole]; role != "orders" {
+		t.Errorf("Expected the role to default to the name, got %q", role)
+	}
+	if role, _ := billing.Context().GetTag(contracts.CloudRole); role != "billing-worker" {
+		t.Errorf("Expected the configured role, got %q", role)
+	}
+}
+
+func TestClientRegistryShutdown(t *testing.T) {
+	registry, testChannel := newTestClientRegistry()
+
+	client, err := registry.Register("orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.(*telemetryClient).StartPerformanceCounterCollection(PerformanceCounterConfig{CollectionInterval: time.Hour})
+
+	<-registry.Shutdown()
+	<-registry.Shutdown()
+
+	if testChannel.closes != 1 {
+		t.Errorf("Expected the shared channel to be closed once, got %d", testChannel.closes)
+	}
+	if client.(*telemetryClient).IsPerformanceCounterCollectionEnabled() {
+		t.Error("Expected performance counter collection to be stopped")
+	}
+	if _, err := registry.Register("billing", nil); err == nil {
+		t.Error("Expected registering after shutdown to fail")
+	}
+}
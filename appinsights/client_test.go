@@ -3,9 +3,12 @@ package appinsights
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"io/ioutil"
 	"testing"
 	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
 func BenchmarkClientBurstPerformance(b *testing.B) {
@@ -53,6 +56,124 @@ func TestClientProperties(t *testing.T) {
 	}
 }
 
+func TestTrackTraceVariants(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+	properties := map[string]string{"orderId": "o-1"}
+
+	TrackTracef(client, Warning, "retrying %s after %d attempts", "checkout", 3)
+	TrackTraceWithProperties(client, "order placed", Information, properties)
+	TrackTracefWithContext(ctx, client, Error, "failed: %v", "timeout")
+	TrackTraceWithPropertiesAndContext(ctx, client, "order shipped", Verbose, properties)
+
+	// The caller's map must not be shared with tracked items
+	properties["orderId"] = "changed"
+
+	if testChannel.getSentCount() != 4 {
+		t.Fatalf("Expected 4 items, got %d", testChannel.getSentCount())
+	}
+
+	expected := []struct {
+		message    string
+		severity   contracts.SeverityLevel
+		orderId    string
+		correlated bool
+	}{
+		{"retrying checkout after 3 attempts", Warning, "", false},
+		{"order placed", Information, "o-1", false},
+		{"failed: timeout", Error, "", true},
+		{"order shipped", Verbose, "o-1", true},
+	}
+
+	for i, exp := range expected {
+		envelope := testChannel.sentItems[i]
+		data := envelope.Data.(*contracts.Data).BaseData.(*contracts.MessageData)
+		if data.Message != exp.message {
+			t.Errorf("Item %d: expected message %q, got %q", i, exp.message, data.Message)
+		}
+		if data.SeverityLevel != exp.severity {
+			t.Errorf("Item %d: expected severity %v, got %v", i, exp.severity, data.SeverityLevel)
+		}
+		if data.Properties["orderId"] != exp.orderId {
+			t.Errorf("Item %d: expected orderId %q, got %q", i, exp.orderId, data.Properties["orderId"])
+		}
+		if correlated := envelope.Tags[contracts.OperationId] == corrCtx.GetOperationID(); correlated != exp.correlated {
+			t.Errorf("Item %d: expected correlated=%v", i, exp.correlated)
+		}
+	}
+}
+
+func TestTrackEventWithMeasurements(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+	properties := map[string]string{"cart": "c-1"}
+	measurements := map[string]float64{"items": 3, "total": 42.5}
+
+	TrackEventWithMeasurements(client, "checkout", properties, measurements)
+	TrackEventWithMeasurementsAndContext(ctx, client, "checkout", properties, measurements)
+	TrackEventWithMeasurements(client, "empty", nil, nil)
+
+	// The caller's maps must not be shared with tracked items
+	measurements["items"] = 4
+
+	if testChannel.getSentCount() != 3 {
+		t.Fatalf("Expected 3 items, got %d", testChannel.getSentCount())
+	}
+
+	for i, envelope := range testChannel.sentItems[:2] {
+		data := envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData)
+		if data.Name != "checkout" || data.Properties["cart"] != "c-1" {
+			t.Errorf("Item %d: unexpected event %q with properties %v", i, data.Name, data.Properties)
+		}
+		if data.Measurements["items"] != 3 || data.Measurements["total"] != 42.5 {
+			t.Errorf("Item %d: unexpected measurements %v", i, data.Measurements)
+		}
+		if correlated := envelope.Tags[contracts.OperationId] == corrCtx.GetOperationID(); correlated != (i == 1) {
+			t.Errorf("Item %d: expected correlated=%v", i, i == 1)
+		}
+	}
+
+	if data := testChannel.sentItems[2].Data.(*contracts.Data).BaseData.(*contracts.EventData); len(data.Measurements) != 0 {
+		t.Errorf("Expected no measurements, got %v", data.Measurements)
+	}
+}
+
+func TestOnTracked(t *testing.T) {
+	var tracked []string
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	processor := NewIntelligentSamplingProcessor(100)
+	processor.AddRule(NewCustomSamplingRule("drop", 10, 0, func(envelope *contracts.Envelope) bool {
+		return envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData).Name == "sampled-out"
+	}))
+	config.SamplingProcessor = processor
+	config.OnTracked = func(envelope *contracts.Envelope) {
+		name := envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData).Name
+		tracked = append(tracked, name)
+		if name == "panic" {
+			panic("callback failure")
+		}
+	}
+
+	client, testChannel := newTestClient(config)
+
+	client.TrackEvent("kept")
+	client.TrackEvent("sampled-out")
+	client.TrackEventWithContext(context.Background(), "panic")
+
+	if len(tracked) != 2 || tracked[0] != "kept" || tracked[1] != "panic" {
+		t.Errorf("Expected callback for kept items only, got %v", tracked)
+	}
+
+	// A panicking callback must not prevent the item from being sent
+	if testChannel.getSentCount() != 2 {
+		t.Errorf("Expected 2 items to be sent, got %d", testChannel.getSentCount())
+	}
+}
+
 func TestEndToEnd(t *testing.T) {
 	mockClock(time.Unix(1511001321, 0))
 	defer resetClock()
@@ -125,3 +246,46 @@ func TestEndToEnd(t *testing.T) {
 	j[3].assertPath(t, "name", "Microsoft.ApplicationInsights.01234567000089abcdef000000000000.Request")
 	j[3].assertPath(t, "time", "2017-11-18T10:34:21Z")
 }
+
+// recordingTracker is a minimal fake of the segregated tracking interfaces
+type recordingTracker struct {
+	items []Telemetry
+}
+
+func (tracker *recordingTracker) Track(telemetry Telemetry) {
+	tracker.items = append(tracker.items, telemetry)
+}
+
+func (tracker *recordingTracker) TrackWithContext(ctx context.Context, telemetry Telemetry) {
+	tracker.items = append(tracker.items, telemetry)
+}
+
+func TestSegregatedInterfaces(t *testing.T) {
+	var _ Tracker = NewTelemetryClient(test_ikey)
+	var _ ContextTracker = NewTelemetryClient(test_ikey)
+	var _ Flusher = NewTelemetryClient(test_ikey).Channel()
+
+	tracker := &recordingTracker{}
+
+	TrackInProcDependency(context.Background(), "work", tracker, func(context.Context) error { return nil })
+	if err := TrackStruct(context.Background(), "order", struct{ ID string }{"42"}, tracker); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer TrackPanic(tracker, false)
+		panic("boom")
+	}()
+
+	if len(tracker.items) != 3 {
+		t.Fatalf("Expected 3 items tracked through the fake, got %d", len(tracker.items))
+	}
+	if _, ok := tracker.items[0].(*RemoteDependencyTelemetry); !ok {
+		t.Errorf("Expected a dependency, got %T", tracker.items[0])
+	}
+	if _, ok := tracker.items[1].(*EventTelemetry); !ok {
+		t.Errorf("Expected an event, got %T", tracker.items[1])
+	}
+	if _, ok := tracker.items[2].(*ExceptionTelemetry); !ok {
+		t.Errorf("Expected an exception, got %T", tracker.items[2])
+	}
+}
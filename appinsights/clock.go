@@ -2,10 +2,70 @@ package appinsights
 
 // We need to mock out the clock for tests; we'll use this to do it.
 
-import "code.cloudfoundry.org/clock"
+import (
+	"sync/atomic"
+	"time"
 
-var currentClock clock.Clock
+	"code.cloudfoundry.org/clock"
+)
+
+var currentClock = &swappableClock{}
 
 func init() {
-	currentClock = clock.NewClock()
+	currentClock.set(clock.NewClock())
+}
+
+// swappableClock forwards to a clock that can be replaced while channels
+// and collectors are reading it from their own goroutines.
+type swappableClock struct {
+	clock atomic.Pointer[clock.Clock]
+}
+
+func (c *swappableClock) set(clk clock.Clock) {
+	c.clock.Store(&clk)
+}
+
+func (c *swappableClock) get() clock.Clock {
+	return *c.clock.Load()
+}
+
+func (c *swappableClock) Now() time.Time                         { return c.get().Now() }
+func (c *swappableClock) Sleep(d time.Duration)                  { c.get().Sleep(d) }
+func (c *swappableClock) Since(t time.Time) time.Duration        { return c.get().Since(t) }
+func (c *swappableClock) After(d time.Duration) <-chan time.Time { return c.get().After(d) }
+func (c *swappableClock) NewTimer(d time.Duration) clock.Timer   { return c.get().NewTimer(d) }
+func (c *swappableClock) NewTicker(d time.Duration) clock.Ticker { return c.get().NewTicker(d) }
+
+// elapsed returns the time between start and end.  Durations are measured
+// with the monotonic clock readings of times obtained from time.Now, but
+// fall back to wall clock readings for times without one, e.g. times that
+// were parsed, deserialized or converted with UTC.  Those can go backwards
+// when the wall clock is stepped, so negative durations are clamped to zero.
+func elapsed(start, end time.Time) time.Duration {
+	if d := end.Sub(start); d > 0 {
+		return d
+	}
+
+	return 0
+}
+
+// alignedDelay returns the time until the next multiple of interval on the
+// wall clock, e.g. until :00 or :30 for an interval of 30 seconds, so that
+// instances flushing with the same interval flush at the same times.
+func alignedDelay(now time.Time, interval time.Duration) time.Duration {
+	return interval - now.Sub(now.Truncate(interval))
+}
+
+// waitForAlignment waits until the next multiple of interval on the wall
+// clock.  Returns false if done is closed first.
+func waitForAlignment(done <-chan struct{}, interval time.Duration) bool {
+	timer := time.NewTimer(alignedDelay(time.Now(), interval))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
 }
@@ -0,0 +1,155 @@
+package appinsights
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClockOffsetProvider supplies a correction applied to the timestamps of
+// all telemetry tracked by a client, so that machines with skewed clocks
+// don't produce traces where children start before their parents.
+type ClockOffsetProvider interface {
+	// Returns the duration to add to local timestamps.
+	Offset() time.Duration
+}
+
+// ClockOffsetFunc adapts a function to a ClockOffsetProvider.
+type ClockOffsetFunc func() time.Duration
+
+func (f ClockOffsetFunc) Offset() time.Duration {
+	return f()
+}
+
+// FixedClockOffset returns a provider that always applies the specified
+// offset.
+func FixedClockOffset(offset time.Duration) ClockOffsetProvider {
+	return ClockOffsetFunc(func() time.Duration { return offset })
+}
+
+// applyClockOffset corrects a timestamp with the specified provider, if any
+func applyClockOffset(provider ClockOffsetProvider, timestamp time.Time) time.Time {
+	if provider == nil {
+		return timestamp
+	}
+
+	return timestamp.Add(provider.Offset())
+}
+
+// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// SNTPClockOffset periodically measures the local clock's offset from an
+// NTP server.  Measurement happens in the background; until the first
+// measurement succeeds, the offset is zero.
+type SNTPClockOffset struct {
+	server  string
+	timeout time.Duration
+
+	offset   atomic.Int64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSNTPClockOffset starts measuring the clock offset from the specified
+// NTP server ("host:port") at the specified interval.  Call Stop to end
+// measurement.
+func NewSNTPClockOffset(server string, interval time.Duration) *SNTPClockOffset {
+	provider := &SNTPClockOffset{
+		server:  server,
+		timeout: 5 * time.Second,
+		stop:    make(chan struct{}),
+	}
+
+	go provider.run(interval)
+	return provider
+}
+
+// Offset returns the most recently measured clock offset.
+func (provider *SNTPClockOffset) Offset() time.Duration {
+	return time.Duration(provider.offset.Load())
+}
+
+// Stop ends background measurement.  The last measured offset continues
+// to be applied.
+func (provider *SNTPClockOffset) Stop() {
+	provider.stopOnce.Do(func() {
+		close(provider.stop)
+	})
+}
+
+func (provider *SNTPClockOffset) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if offset, err := MeasureSNTPOffset(provider.server, provider.timeout); err == nil {
+			provider.offset.Store(int64(offset))
+		} else {
+			diagnosticsWriter.Printf("Failed to measure clock offset from %s: %s", provider.server, err.Error())
+		}
+
+		select {
+		case <-provider.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MeasureSNTPOffset queries an NTP server ("host:port") once and returns
+// the offset of the server's clock relative to the local clock.
+func MeasureSNTPOffset(server string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	// Version 4, client mode
+	request := make([]byte, 48)
+	request[0] = 0x23
+
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 48 || response[0]&0x07 != 4 {
+		return 0, errors.New("appinsights: invalid NTP response")
+	}
+
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+	if serverSent.IsZero() {
+		return 0, errors.New("appinsights: NTP response has no transmit time")
+	}
+
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	if seconds == 0 && fraction == 0 {
+		return time.Time{}
+	}
+
+	nanos := (int64(fraction) * int64(time.Second)) >> 32
+	return time.Unix(int64(seconds)-ntpEpochOffset, nanos)
+}
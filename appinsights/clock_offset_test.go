@@ -0,0 +1,87 @@
+package appinsights
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClockOffsetAppliedToEnvelopes(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.ClockOffset = FixedClockOffset(-1500 * time.Millisecond)
+	client, testChannel := newTestClient(config)
+
+	ev := NewEventTelemetry("event")
+	ev.Timestamp = time.Unix(1523667421, 500000000)
+	client.Track(ev)
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 item, got %d", testChannel.getSentCount())
+	}
+	if envelope := testChannel.sentItems[0]; envelope.Time != "2018-04-14T00:57:00Z" {
+		t.Errorf("Unexpected corrected timestamp: %s", envelope.Time)
+	}
+}
+
+// Serves a single NTP response from a clock running ahead by the specified offset
+func newTestNTPServer(t *testing.T, offset time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Cannot listen on UDP: %s", err)
+	}
+
+	go func() {
+		defer conn.Close()
+
+		request := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+
+		now := time.Now().Add(offset)
+		seconds := uint32(now.Unix() + ntpEpochOffset)
+		fraction := uint32((int64(now.Nanosecond()) << 32) / int64(time.Second))
+
+		response := make([]byte, 48)
+		response[0] = 0x24 // Version 4, server mode
+		for _, at := range []int{32, 40} {
+			binary.BigEndian.PutUint32(response[at:], seconds)
+			binary.BigEndian.PutUint32(response[at+4:], fraction)
+		}
+
+		conn.WriteTo(response, addr)
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestMeasureSNTPOffset(t *testing.T) {
+	server := newTestNTPServer(t, 3*time.Second)
+
+	offset, err := MeasureSNTPOffset(server, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if offset < 2900*time.Millisecond || offset > 3100*time.Millisecond {
+		t.Errorf("Expected an offset of about 3s, got %s", offset)
+	}
+}
+
+func TestSNTPClockOffset(t *testing.T) {
+	server := newTestNTPServer(t, -2*time.Second)
+
+	provider := NewSNTPClockOffset(server, time.Hour)
+	defer provider.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for provider.Offset() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if offset := provider.Offset(); offset > -1900*time.Millisecond || offset < -2100*time.Millisecond {
+		t.Errorf("Expected an offset of about -2s, got %s", offset)
+	}
+}
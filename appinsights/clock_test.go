@@ -16,12 +16,12 @@ func mockClock(timestamp ...time.Time) {
 		fakeClock = fakeclock.NewFakeClock(time.Now().Round(time.Minute))
 	}
 
-	currentClock = fakeClock
+	currentClock.set(fakeClock)
 }
 
 func resetClock() {
 	fakeClock = nil
-	currentClock = clock.NewClock()
+	currentClock.set(clock.NewClock())
 }
 
 func slowTick(seconds int) {
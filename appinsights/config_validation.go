@@ -0,0 +1,188 @@
+package appinsights
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ConfigurationError describes an invalid field of a
+// TelemetryConfiguration.
+type ConfigurationError struct {
+	// Name of the field, e.g. "MaxBatchInterval" or "AsyncTracking.Workers"
+	Field string
+
+	// What is wrong with the field and how to fix it
+	Message string
+}
+
+func (err *ConfigurationError) Error() string {
+	return err.Field + ": " + err.Message
+}
+
+// ConfigurationErrors lists every invalid field found by
+// TelemetryConfiguration.Validate.
+type ConfigurationErrors []*ConfigurationError
+
+func (errs ConfigurationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return "invalid telemetry configuration: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual errors, for errors.As and errors.Is.
+func (errs ConfigurationErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+
+	return unwrapped
+}
+
+// Validate checks the configuration for values that would be ignored or
+// misbehave, such as negative intervals, missing endpoints, and conflicting
+// options.  It returns ConfigurationErrors listing every invalid field, or
+// nil if the configuration is valid.
+func (config *TelemetryConfiguration) Validate() error {
+	var errs ConfigurationErrors
+	invalid := func(field, message string) {
+		errs = append(errs, &ConfigurationError{field, message})
+	}
+
+	if config.InstrumentationKey == "" {
+		invalid("InstrumentationKey", "must be set; use the key from the resource's connection string")
+	}
+
+	switch config.IngestionProtocol {
+	case IngestionProtocolApplicationInsights:
+		if message := validateEndpoint(config.EndpointUrl); message != "" {
+			invalid("EndpointUrl", message)
+		}
+	case IngestionProtocolOTLP:
+		if message := validateEndpoint(config.OTLPEndpoint); message != "" {
+			invalid("OTLPEndpoint", message+" when IngestionProtocol is IngestionProtocolOTLP")
+		}
+		if config.Recorder != nil {
+			invalid("Recorder", "replaces the OTLP transmitter; unset IngestionProtocol or Recorder")
+		}
+	default:
+		invalid("IngestionProtocol", "is not a known protocol")
+	}
+
+	if config.MaxBatchSize <= 0 {
+		invalid("MaxBatchSize", "must be positive; the default is 1024")
+	}
+	if config.MaxBatchInterval <= 0 {
+		invalid("MaxBatchInterval", "must be positive; the default is 10s")
+	}
+	if config.MaxPendingBytes < 0 {
+		invalid("MaxPendingBytes", "must not be negative; use 0 for no limit")
+	}
+	if config.TransmitTimeout < 0 {
+		invalid("TransmitTimeout", "must not be negative; use 0 for no limit")
+	}
+	if config.SlowTransmitThreshold < 0 {
+		invalid("SlowTransmitThreshold", "must not be negative; use 0 to disable")
+	}
+	if config.MaxDiagnosticsPerMinute < 0 {
+		invalid("MaxDiagnosticsPerMinute", "must not be negative; use 0 for the default")
+	}
+	if config.SamplingRateReportInterval < 0 {
+		invalid("SamplingRateReportInterval", "must not be negative; use 0 to disable")
+	}
+	if config.SamplingRateReportInterval > 0 && config.SamplingProcessor == nil {
+		invalid("SamplingRateReportInterval", "requires a SamplingProcessor; without one every rate is 100%")
+	}
+
+	if async := config.AsyncTracking; async != nil {
+		if async.Workers < 0 {
+			invalid("AsyncTracking.Workers", "must not be negative")
+		}
+		if async.QueueSize < 0 {
+			invalid("AsyncTracking.QueueSize", "must not be negative")
+		}
+	}
+
+	if histograms := config.DurationHistograms; histograms != nil && histograms.FlushInterval < 0 {
+		invalid("DurationHistograms.FlushInterval", "must not be negative")
+	}
+
+	if summaries := config.DependencySummaries; summaries != nil && summaries.FlushInterval < 0 {
+		invalid("DependencySummaries.FlushInterval", "must not be negative")
+	}
+
+	if buffer := config.ErrorTraceBuffer; buffer != nil {
+		if buffer.MaxItemsPerOperation < 0 {
+			invalid("ErrorTraceBuffer.MaxItemsPerOperation", "must not be negative")
+		}
+		if buffer.MaxOperations < 0 {
+			invalid("ErrorTraceBuffer.MaxOperations", "must not be negative")
+		}
+		if buffer.MaxAge < 0 {
+			invalid("ErrorTraceBuffer.MaxAge", "must not be negative")
+		}
+	}
+
+	if shadow := config.Shadow; shadow != nil {
+		if shadow.Config == nil {
+			invalid("Shadow.Config", "is required")
+		} else if shadow.Config.InstrumentationKey == "" {
+			invalid("Shadow.Config.InstrumentationKey", "is required")
+		}
+		if shadow.Percentage < 0 || shadow.Percentage > 100 {
+			invalid("Shadow.Percentage", "must be between 0 and 100")
+		}
+	}
+
+	if storms := config.RetryStorms; storms != nil {
+		if storms.Failures < 0 {
+			invalid("RetryStorms.Failures", "must not be negative")
+		}
+		if storms.Window < 0 {
+			invalid("RetryStorms.Window", "must not be negative")
+		}
+		if storms.MaxTargets < 0 {
+			invalid("RetryStorms.MaxTargets", "must not be negative")
+		}
+	}
+
+	if redaction := config.RedactionPolicy; redaction != nil && redaction.ReloadInterval < 0 {
+		invalid("RedactionPolicy.ReloadInterval", "must not be negative")
+	}
+
+	if budget := config.OperationBudget; budget != nil {
+		if budget.MaxItemsPerOperation < 0 {
+			invalid("OperationBudget.MaxItemsPerOperation", "must not be negative")
+		}
+		if budget.MaxOperations < 0 {
+			invalid("OperationBudget.MaxOperations", "must not be negative")
+		}
+		if budget.MaxAge < 0 {
+			invalid("OperationBudget.MaxAge", "must not be negative")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// validateEndpoint returns why endpoint isn't a usable absolute URL, or an
+// empty string
+func validateEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return "must be set"
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "must be an absolute http or https URL"
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package appinsights
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConfiguration(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected the default configuration to be valid: %s", err)
+	}
+
+	config.EndpointUrl = "in.applicationinsights.azure.com"
+	config.MaxBatchInterval = -time.Second
+	config.TransmitTimeout = -time.Second
+	config.SamplingRateReportInterval = time.Minute
+	config.AsyncTracking = &AsyncTrackingConfig{Workers: -1}
+
+	err := config.Validate()
+	var errs ConfigurationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ConfigurationErrors, got %v", err)
+	}
+
+	var fields []string
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+	expected := "EndpointUrl MaxBatchInterval TransmitTimeout SamplingRateReportInterval AsyncTracking.Workers"
+	if strings.Join(fields, " ") != expected {
+		t.Errorf("Expected errors for %s, got %s", expected, strings.Join(fields, " "))
+	}
+
+	var fieldErr *ConfigurationError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "EndpointUrl" {
+		t.Errorf("Expected the individual errors to be unwrapped, got %v", fieldErr)
+	}
+	if !strings.Contains(err.Error(), "MaxBatchInterval: must be positive") {
+		t.Errorf("Unexpected message: %s", err)
+	}
+}
+
+func TestValidateOTLPConfiguration(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.IngestionProtocol = IngestionProtocolOTLP
+	config.Recorder = NewTelemetryRecorder(RecordingConfig{})
+
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "OTLPEndpoint: must be set") || !strings.Contains(err.Error(), "Recorder:") {
+		t.Errorf("Expected missing endpoint and conflicting recorder errors, got %v", err)
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.MaxBatchSize = 0
+
+	client := NewTelemetryClientFromConfig(config)
+	client.Channel().Stop()
+
+	config.StrictValidation = true
+	defer func() {
+		if _, ok := recover().(ConfigurationErrors); !ok {
+			t.Error("Expected a panic with the validation errors")
+		}
+	}()
+	NewTelemetryClientFromConfig(config)
+}
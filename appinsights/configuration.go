@@ -7,6 +7,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
 const DefaultIngestionEndpoint = "https://in.applicationinsights.azure.com"
@@ -19,9 +21,28 @@ type TelemetryConfiguration struct {
 	// Endpoint URL where data will be submitted.
 	EndpointUrl string
 
+	// Protocol used to submit telemetry.  Defaults to the Application
+	// Insights ingestion protocol.
+	IngestionProtocol IngestionProtocol
+
+	// Base URL of the OTLP/HTTP endpoint used when IngestionProtocol is
+	// IngestionProtocolOTLP.  Signals are posted to /v1/traces, /v1/logs and
+	// /v1/metrics beneath it.
+	OTLPEndpoint string
+
 	// Application ID associated with the Application Insights resource.
 	ApplicationId string
 
+	// Version of the application (ai.application.ver) stamped on all
+	// telemetry, so that the portal can slice requests by deployment.  See
+	// BuildInfoVersion to take it from the binary's build information, and
+	// TelemetryContext.SetVersion to change it later.
+	ApplicationVersion string
+
+	// Deployment environment, e.g. "staging" or "production", recorded in
+	// EnvironmentProperty on all telemetry.
+	Environment string
+
 	// Maximum number of telemetry items that can be submitted in each
 	// request.  If this many items are buffered, the buffer will be
 	// flushed before MaxBatchInterval expires.
@@ -30,17 +51,145 @@ type TelemetryConfiguration struct {
 	// Maximum time to wait before sending a batch of telemetry.
 	MaxBatchInterval time.Duration
 
+	// If true, batches are sent on multiples of MaxBatchInterval on the
+	// wall clock, e.g. at :00 and :30 with an interval of 30 seconds,
+	// rather than MaxBatchInterval after their first item, so that
+	// aggregates across instances line up in queries.
+	AlignBatchesToWallClock bool
+
+	// Maximum approximate number of bytes of telemetry held in memory,
+	// including batches waiting to be retransmitted after a failure.  Once
+	// reached, telemetry is discarded according to BackpressurePolicy.  Zero
+	// means no limit.
+	MaxPendingBytes int64
+
+	// Determines which telemetry is discarded once MaxPendingBytes is
+	// reached.  Defaults to discarding incoming telemetry.
+	BackpressurePolicy BackpressurePolicy
+
 	// Customized http client if desired (will use http.DefaultClient otherwise)
 	Client *http.Client
 
+	// Maximum time a single submission of a batch may take before it is
+	// cancelled and retried.  Zero means no limit.
+	TransmitTimeout time.Duration
+
+	// Submissions taking longer than this are considered slow (optional).
+	// When several consecutive submissions are slow or time out, the
+	// endpoint is flagged through diagnostics and a SlowIngestionMetricName
+	// metric is tracked.
+	SlowTransmitThreshold time.Duration
+
+	// Acquires bearer tokens for ingestion endpoints requiring Azure AD
+	// authentication (optional).  Tokens are cached in MetadataCache until
+	// shortly before they expire.
+	AccessToken TokenFetcher
+
+	// Cache of application IDs, ingestion redirect targets and access
+	// tokens (optional).  Defaults to an in-memory cache shared by all
+	// clients of the process; see MetadataCache for distributed caches.
+	MetadataCache MetadataCache
+
+	// Records batches instead of transmitting them (optional).  Nothing
+	// leaves the host while a recorder is set; see NewTelemetryRecorder.
+	Recorder *TelemetryRecorder
+
 	// Sampling processor for controlling telemetry volume (optional)
 	SamplingProcessor SamplingProcessor
 
+	// Interval at which the effective sampling percentage of each
+	// telemetry type is reported as a SamplingRateMetricName metric
+	// (optional).  Zero disables the report.
+	SamplingRateReportInterval time.Duration
+
 	// Error auto-collection configuration (optional)
 	ErrorAutoCollection *ErrorAutoCollectionConfig
 
 	// Automatic event collection configuration (optional)
 	AutoCollection *AutoCollectionConfig
+
+	// Request and dependency duration histogram configuration (optional)
+	DurationHistograms *DurationHistogramConfig
+
+	// Per-target dependency summary configuration (optional).  See
+	// NewDependencySummaryConfig.
+	DependencySummaries *DependencySummaryConfig
+
+	// Asynchronous tracking configuration (optional).  When set, enveloping
+	// and sampling run on a pool of worker goroutines.
+	AsyncTracking *AsyncTrackingConfig
+
+	// Prefix custom event names tracked with a correlation context with the
+	// operation name, separated by EventNameSeparator.  For example, an
+	// event "checkout-started" within operation "POST /cart" is tracked as
+	// "POST /cart/checkout-started".
+	HierarchicalEventNames bool
+
+	// Schema versions and migrations applied to custom events (optional).
+	// See NewEventVersioning.
+	EventVersioning *EventVersioning
+
+	// Correction applied to the timestamps of all telemetry, for machines
+	// whose clocks are known to be skewed (optional).  See FixedClockOffset
+	// and NewSNTPClockOffset.
+	ClockOffset ClockOffsetProvider
+
+	// Limit on the number of properties of each telemetry item (optional).
+	// Overflowing properties are spilled into a single JSON-encoded
+	// property or dropped, by priority.
+	PropertyLimit *PropertyLimitConfig
+
+	// Bounded lookups, such as GeoIP or reverse DNS, whose results are
+	// added to kept telemetry before it is queued (optional).  See
+	// NewEnrichmentConfig.
+	Enrichment *EnrichmentConfig
+
+	// Retention of the telemetry that sampling drops from operations whose
+	// request fails (optional).  See NewErrorTraceBufferConfig.
+	ErrorTraceBuffer *ErrorTraceBufferConfig
+
+	// Cap on the number of telemetry items tracked within each operation
+	// (optional).  See NewOperationBudgetConfig.
+	OperationBudget *OperationBudgetConfig
+
+	// Duplication of a percentage of telemetry to a second destination,
+	// such as a staging resource (optional).  See ShadowConfig.
+	Shadow *ShadowConfig
+
+	// Detection and tagging of dependency targets failing repeatedly within
+	// a short window (optional).  See NewRetryStormConfig.
+	RetryStorms *RetryStormConfig
+
+	// Declarative redaction rules loaded from a file or environment
+	// variable, and reloaded when the file changes (optional).  See
+	// NewRedactionPolicyConfig.
+	RedactionPolicy *RedactionPolicyConfig
+
+	// Maximum number of traces tracked with TrackDiagnostic per minute;
+	// further ones are dropped.  Defaults to
+	// DefaultMaxDiagnosticsPerMinute when zero.
+	MaxDiagnosticsPerMinute int
+
+	// Sanitizer applied to request URLs, availability messages and, if
+	// enabled, trace messages (optional).  See NewSanitizer.
+	URLSanitizer *Sanitizer
+
+	// Callback invoked with each envelope kept by sampling, just before it
+	// is sent to the channel (optional).  Useful for audits, counters, and
+	// golden-file tests.  The envelope must not be retained or modified
+	// after the callback returns.
+	OnTracked func(envelope *contracts.Envelope)
+
+	// Track a deployment event when the client is created, for the version
+	// and changeset found in the APPINSIGHTS_DEPLOYMENT_VERSION and
+	// APPINSIGHTS_DEPLOYMENT_CHANGESET environment variables.  Nothing is
+	// tracked if the version isn't set.
+	TrackDeploymentOnStartup bool
+
+	// Panic in NewTelemetryClientFromConfig if Validate reports errors.
+	// Otherwise, they are written to the diagnostics listeners and the
+	// client is created anyway.
+	StrictValidation bool
 }
 
 // Creates a new TelemetryConfiguration object with the specified
@@ -58,6 +207,7 @@ func NewTelemetryConfiguration(connectionString string) *TelemetryConfiguration
 		ApplicationId:      appId,
 		MaxBatchSize:       1024,
 		MaxBatchInterval:   time.Duration(10) * time.Second,
+		TransmitTimeout:    time.Duration(60) * time.Second,
 	}
 }
 
@@ -99,12 +249,21 @@ func splitAndTrim(connectionString, s string) []string {
 
 func (config *TelemetryConfiguration) setupContext() *TelemetryContext {
 	context := NewTelemetryContext(config.InstrumentationKey)
-	context.Tags.Internal().SetSdkVersion(sdkName + ":" + Version)
-	context.Tags.Device().SetOsVersion(runtime.GOOS)
+	context.UpdateTags(func(tags contracts.ContextTags) {
+		tags.Internal().SetSdkVersion(sdkName + ":" + Version)
+		tags.Device().SetOsVersion(runtime.GOOS)
+
+		if hostname, err := os.Hostname(); err == nil {
+			tags.Device().SetId(hostname)
+			tags.Cloud().SetRoleInstance(hostname)
+		}
 
-	if hostname, err := os.Hostname(); err == nil {
-		context.Tags.Device().SetId(hostname)
-		context.Tags.Cloud().SetRoleInstance(hostname)
+		if config.ApplicationVersion != "" {
+			tags.Application().SetVer(config.ApplicationVersion)
+		}
+	})
+	if config.Environment != "" {
+		context.CommonProperties[EnvironmentProperty] = config.Environment
 	}
 
 	return context
@@ -9,6 +9,10 @@ const (
 	// always about the application that is sending the telemetry.
 	ApplicationVersion string = "ai.application.ver"
 
+	// Application Id. Information in the application context fields is
+	// always about the application that is sending the telemetry.
+	ApplicationId string = "ai.application.id"
+
 	// Unique client device id. Computer name in most cases.
 	DeviceId string = "ai.device.id"
 
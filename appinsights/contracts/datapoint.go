@@ -1,10 +1,17 @@
 package contracts
 
 // NOTE: This file was automatically generated.
+//
+// The Ns field and its length check were added by hand: the Bond schema in
+// ApplicationInsights-Home that generateschema.ps1 consumes does not carry
+// the metric namespace yet.  Keep them if the file is regenerated.
 
 // Metric data single measurement.
 type DataPoint struct {
 
+	// Namespace of the metric.
+	Ns string `json:"ns,omitempty"`
+
 	// Name of the metric.
 	Name string `json:"name"`
 
@@ -38,6 +45,11 @@ type DataPoint struct {
 func (data *DataPoint) Sanitize() []string {
 	var warnings []string
 
+	if len(data.Ns) > 256 {
+		data.Ns = data.Ns[:256]
+		warnings = append(warnings, "DataPoint.Ns exceeded maximum length of 256")
+	}
+
 	if len(data.Name) > 1024 {
 		data.Name = data.Name[:1024]
 		warnings = append(warnings, "DataPoint.Name exceeded maximum length of 1024")
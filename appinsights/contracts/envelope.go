@@ -1,6 +1,9 @@
 package contracts
 
 // NOTE: This file was automatically generated.
+//
+// The fields tagged `json:"-"` were added by hand: they carry SDK state that
+// is not part of the schema.  Keep them if the file is regenerated.
 
 // System variables for a telemetry item.
 type Envelope struct {
@@ -42,6 +45,18 @@ type Envelope struct {
 
 	// Telemetry data item.
 	Data interface{} `json:"data"`
+
+	// Transmission priority within the SDK.  Not part of the schema and
+	// never serialized.
+	Priority int `json:"-"`
+
+	// Work deferred until the envelope is serialized.  Not part of the
+	// schema and never serialized.
+	Finalizers []Finalizer `json:"-"`
+
+	// Notified of the outcome of the envelope's transmission.  Not part of
+	// the schema and never serialized.
+	Deliveries []DeliveryNotifier `json:"-"`
 }
 
 // Truncates string fields that exceed their maximum supported sizes for this
@@ -0,0 +1,19 @@
+package contracts
+
+// NOTE: This file is maintained by hand.
+
+// Finalizer is work deferred until an envelope is serialized.  Each
+// finalizer attached to an envelope is either finalized just before the
+// envelope is serialized, or released without running if the envelope is
+// dropped.
+type Finalizer interface {
+	Finalize(envelope *Envelope)
+	Release()
+}
+
+// DeliveryNotifier is notified once of the outcome of an envelope's
+// transmission: a nil error if ingestion accepted it, or the reason it was
+// rejected, dropped or abandoned.
+type DeliveryNotifier interface {
+	Complete(err error)
+}
@@ -0,0 +1,583 @@
+package contracts
+
+// NOTE: This file is maintained by hand.  It provides reflection-free JSON
+// encoders for the contract types that make up the bulk of transmitted
+// payloads.  The output is byte-for-byte identical to encoding/json.
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// jsonAppender is implemented by contract types that can append their JSON
+// encoding to a buffer without reflection.
+type jsonAppender interface {
+	AppendJSON(dst []byte) ([]byte, error)
+}
+
+// AppendJSON appends the JSON encoding of the envelope to dst.  On error, the
+// returned slice may contain partial output and should be truncated by the
+// caller.
+func (data *Envelope) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	dst = append(dst, `,"time":`...)
+	dst = appendJSONString(dst, data.Time)
+	dst = append(dst, `,"sampleRate":`...)
+	dst, err := appendJSONFloat(dst, data.SampleRate)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"seq":`...)
+	dst = appendJSONString(dst, data.Seq)
+	dst = append(dst, `,"iKey":`...)
+	dst = appendJSONString(dst, data.IKey)
+	if len(data.Tags) > 0 {
+		dst = append(dst, `,"tags":`...)
+		dst = appendJSONStringMap(dst, data.Tags)
+	}
+	dst = append(dst, `,"data":`...)
+	if dst, err = appendJSONValue(dst, data.Data); err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *Envelope) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the data container to dst.
+func (data *Data) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"baseType":`...)
+	dst = appendJSONString(dst, data.BaseType)
+	dst = append(dst, `,"baseData":`...)
+	dst, err := appendJSONValue(dst, data.BaseData)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *Data) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the event to dst.
+func (data *EventData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, '{')
+	dst, err := data.appendJSONFields(dst)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONFields appends the event fields without the enclosing braces so
+// that they can be shared with PageViewData.
+func (data *EventData) appendJSONFields(dst []byte) ([]byte, error) {
+	dst = append(dst, `"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	return appendJSONCustomDimensions(dst, data.Properties, data.Measurements)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *EventData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the page view to dst.
+func (data *PageViewData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, '{')
+	dst, err := data.EventData.appendJSONFields(dst)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"url":`...)
+	dst = appendJSONString(dst, data.Url)
+	dst = append(dst, `,"duration":`...)
+	dst = appendJSONString(dst, data.Duration)
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *PageViewData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the message to dst.
+func (data *MessageData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"message":`...)
+	dst = appendJSONString(dst, data.Message)
+	dst = append(dst, `,"severityLevel":`...)
+	dst = strconv.AppendInt(dst, int64(data.SeverityLevel), 10)
+	if len(data.Properties) > 0 {
+		dst = append(dst, `,"properties":`...)
+		dst = appendJSONStringMap(dst, data.Properties)
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *MessageData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the request to dst.
+func (data *RequestData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"id":`...)
+	dst = appendJSONString(dst, data.Id)
+	dst = append(dst, `,"source":`...)
+	dst = appendJSONString(dst, data.Source)
+	dst = append(dst, `,"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	dst = append(dst, `,"duration":`...)
+	dst = appendJSONString(dst, data.Duration)
+	dst = append(dst, `,"responseCode":`...)
+	dst = appendJSONString(dst, data.ResponseCode)
+	dst = append(dst, `,"success":`...)
+	dst = strconv.AppendBool(dst, data.Success)
+	dst = append(dst, `,"url":`...)
+	dst = appendJSONString(dst, data.Url)
+	dst, err := appendJSONCustomDimensions(dst, data.Properties, data.Measurements)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *RequestData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the remote dependency to dst.
+func (data *RemoteDependencyData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	dst = append(dst, `,"id":`...)
+	dst = appendJSONString(dst, data.Id)
+	dst = append(dst, `,"resultCode":`...)
+	dst = appendJSONString(dst, data.ResultCode)
+	dst = append(dst, `,"duration":`...)
+	dst = appendJSONString(dst, data.Duration)
+	dst = append(dst, `,"success":`...)
+	dst = strconv.AppendBool(dst, data.Success)
+	dst = append(dst, `,"data":`...)
+	dst = appendJSONString(dst, data.Data)
+	dst = append(dst, `,"target":`...)
+	dst = appendJSONString(dst, data.Target)
+	dst = append(dst, `,"type":`...)
+	dst = appendJSONString(dst, data.Type)
+	dst, err := appendJSONCustomDimensions(dst, data.Properties, data.Measurements)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *RemoteDependencyData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the availability result to dst.
+func (data *AvailabilityData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"id":`...)
+	dst = appendJSONString(dst, data.Id)
+	dst = append(dst, `,"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	dst = append(dst, `,"duration":`...)
+	dst = appendJSONString(dst, data.Duration)
+	dst = append(dst, `,"success":`...)
+	dst = strconv.AppendBool(dst, data.Success)
+	dst = append(dst, `,"runLocation":`...)
+	dst = appendJSONString(dst, data.RunLocation)
+	dst = append(dst, `,"message":`...)
+	dst = appendJSONString(dst, data.Message)
+	dst, err := appendJSONCustomDimensions(dst, data.Properties, data.Measurements)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *AvailabilityData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the metric to dst.
+func (data *MetricData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"metrics":`...)
+	if data.Metrics == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i, point := range data.Metrics {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = appendJSONValue(dst, point); err != nil {
+				return dst, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	if len(data.Properties) > 0 {
+		dst = append(dst, `,"properties":`...)
+		dst = appendJSONStringMap(dst, data.Properties)
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *MetricData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the data point to dst.
+func (data *DataPoint) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+	dst = append(dst, '{')
+	if data.Ns != "" {
+		dst = append(dst, `"ns":`...)
+		dst = appendJSONString(dst, data.Ns)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `"name":`...)
+	dst = appendJSONString(dst, data.Name)
+	dst = append(dst, `,"kind":`...)
+	dst = strconv.AppendInt(dst, int64(data.Kind), 10)
+	dst = append(dst, `,"value":`...)
+	if dst, err = appendJSONFloat(dst, data.Value); err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"count":`...)
+	dst = strconv.AppendInt(dst, int64(data.Count), 10)
+	dst = append(dst, `,"min":`...)
+	if dst, err = appendJSONFloat(dst, data.Min); err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"max":`...)
+	if dst, err = appendJSONFloat(dst, data.Max); err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"stdDev":`...)
+	if dst, err = appendJSONFloat(dst, data.StdDev); err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *DataPoint) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the exception to dst.
+func (data *ExceptionData) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"ver":`...)
+	dst = strconv.AppendInt(dst, int64(data.Ver), 10)
+	dst = append(dst, `,"exceptions":`...)
+	if data.Exceptions == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i, details := range data.Exceptions {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = appendJSONValue(dst, details); err != nil {
+				return dst, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	dst = append(dst, `,"severityLevel":`...)
+	dst = strconv.AppendInt(dst, int64(data.SeverityLevel), 10)
+	dst = append(dst, `,"problemId":`...)
+	dst = appendJSONString(dst, data.ProblemId)
+	dst, err := appendJSONCustomDimensions(dst, data.Properties, data.Measurements)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *ExceptionData) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the exception details to dst.
+func (data *ExceptionDetails) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"id":`...)
+	dst = strconv.AppendInt(dst, int64(data.Id), 10)
+	dst = append(dst, `,"outerId":`...)
+	dst = strconv.AppendInt(dst, int64(data.OuterId), 10)
+	dst = append(dst, `,"typeName":`...)
+	dst = appendJSONString(dst, data.TypeName)
+	dst = append(dst, `,"message":`...)
+	dst = appendJSONString(dst, data.Message)
+	dst = append(dst, `,"hasFullStack":`...)
+	dst = strconv.AppendBool(dst, data.HasFullStack)
+	dst = append(dst, `,"stack":`...)
+	dst = appendJSONString(dst, data.Stack)
+	if len(data.ParsedStack) > 0 {
+		dst = append(dst, `,"parsedStack":[`...)
+		for i, frame := range data.ParsedStack {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = appendJSONValue(dst, frame); err != nil {
+				return dst, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *ExceptionDetails) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the stack frame to dst.
+func (data *StackFrame) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"level":`...)
+	dst = strconv.AppendInt(dst, int64(data.Level), 10)
+	dst = append(dst, `,"method":`...)
+	dst = appendJSONString(dst, data.Method)
+	dst = append(dst, `,"assembly":`...)
+	dst = appendJSONString(dst, data.Assembly)
+	dst = append(dst, `,"fileName":`...)
+	dst = appendJSONString(dst, data.FileName)
+	dst = append(dst, `,"line":`...)
+	dst = strconv.AppendInt(dst, int64(data.Line), 10)
+	return append(dst, '}'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data *StackFrame) MarshalJSON() ([]byte, error) {
+	return data.AppendJSON(nil)
+}
+
+// appendJSONValue appends an arbitrary value, using the fast path when the
+// value supports it and falling back to encoding/json otherwise.
+func appendJSONValue(dst []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case jsonAppender:
+		// Typed nil pointers encode as null, as with encoding/json
+		if isNilAppender(v) {
+			return append(dst, "null"...), nil
+		}
+		return v.AppendJSON(dst)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, encoded...), nil
+}
+
+// isNilAppender reports whether the appender is a typed nil pointer.
+func isNilAppender(v jsonAppender) bool {
+	switch p := v.(type) {
+	case *Envelope:
+		return p == nil
+	case *Data:
+		return p == nil
+	case *EventData:
+		return p == nil
+	case *PageViewData:
+		return p == nil
+	case *MessageData:
+		return p == nil
+	case *RequestData:
+		return p == nil
+	case *RemoteDependencyData:
+		return p == nil
+	case *AvailabilityData:
+		return p == nil
+	case *MetricData:
+		return p == nil
+	case *DataPoint:
+		return p == nil
+	case *ExceptionData:
+		return p == nil
+	case *ExceptionDetails:
+		return p == nil
+	case *StackFrame:
+		return p == nil
+	}
+	return false
+}
+
+// appendJSONCustomDimensions appends the optional properties and
+// measurements fields shared by most data types.
+func appendJSONCustomDimensions(dst []byte, properties map[string]string, measurements map[string]float64) ([]byte, error) {
+	if len(properties) > 0 {
+		dst = append(dst, `,"properties":`...)
+		dst = appendJSONStringMap(dst, properties)
+	}
+	if len(measurements) > 0 {
+		dst = append(dst, `,"measurements":`...)
+		return appendJSONFloatMap(dst, measurements)
+	}
+	return dst, nil
+}
+
+// appendJSONStringMap appends a map with keys in sorted order.
+func appendJSONStringMap(dst []byte, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dst = append(dst, '{')
+	for i, k := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, k)
+		dst = append(dst, ':')
+		dst = appendJSONString(dst, m[k])
+	}
+	return append(dst, '}')
+}
+
+// appendJSONFloatMap appends a map with keys in sorted order.
+func appendJSONFloatMap(dst []byte, m map[string]float64) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dst = append(dst, '{')
+	for i, k := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, k)
+		dst = append(dst, ':')
+		var err error
+		if dst, err = appendJSONFloat(dst, m[k]); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSONFloat appends a float using the same formatting as
+// encoding/json.
+func appendJSONFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return dst, fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+
+	return dst, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends a quoted string using the same escaping as
+// encoding/json, including HTML-safe escaping.
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 and U+2029 are valid JSON but break JSONP
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
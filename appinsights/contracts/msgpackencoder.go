@@ -0,0 +1,456 @@
+package contracts
+
+// NOTE: This file is maintained by hand.  It provides reflection-free
+// MessagePack encoders for the contract types, writing the same fields in
+// the same order as the JSON encoders.  Floating point fields are always
+// written as float64, even when their value is integral.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// msgpackAppender is implemented by contract types that can append their
+// MessagePack encoding to a buffer without reflection.
+type msgpackAppender interface {
+	AppendMessagePack(dst []byte) ([]byte, error)
+}
+
+// AppendMessagePack appends the MessagePack encoding of the envelope to dst.
+// On error, the returned slice may contain partial output and should be
+// truncated by the caller.
+func (data *Envelope) AppendMessagePack(dst []byte) ([]byte, error) {
+	fields := 7
+	if len(data.Tags) > 0 {
+		fields++
+	}
+
+	dst = appendMsgpackMapHeader(dst, fields)
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	dst = appendMsgpackString(dst, "time")
+	dst = appendMsgpackString(dst, data.Time)
+	dst = appendMsgpackString(dst, "sampleRate")
+	dst = appendMsgpackFloat(dst, data.SampleRate)
+	dst = appendMsgpackString(dst, "seq")
+	dst = appendMsgpackString(dst, data.Seq)
+	dst = appendMsgpackString(dst, "iKey")
+	dst = appendMsgpackString(dst, data.IKey)
+	if len(data.Tags) > 0 {
+		dst = appendMsgpackString(dst, "tags")
+		dst = appendMsgpackStringMap(dst, data.Tags)
+	}
+	dst = appendMsgpackString(dst, "data")
+	return appendMsgpackValue(dst, data.Data)
+}
+
+// AppendMessagePack appends the MessagePack encoding of the data container
+// to dst.
+func (data *Data) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 2)
+	dst = appendMsgpackString(dst, "baseType")
+	dst = appendMsgpackString(dst, data.BaseType)
+	dst = appendMsgpackString(dst, "baseData")
+	return appendMsgpackValue(dst, data.BaseData)
+}
+
+// AppendMessagePack appends the MessagePack encoding of the event to dst.
+func (data *EventData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 2+customDimensionsFields(data.Properties, data.Measurements))
+	return data.appendMessagePackFields(dst), nil
+}
+
+// appendMessagePackFields appends the event fields without the map header
+// so that they can be shared with PageViewData.
+func (data *EventData) appendMessagePackFields(dst []byte) []byte {
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	return appendMsgpackCustomDimensions(dst, data.Properties, data.Measurements)
+}
+
+// AppendMessagePack appends the MessagePack encoding of the page view to
+// dst.
+func (data *PageViewData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 4+customDimensionsFields(data.Properties, data.Measurements))
+	dst = data.EventData.appendMessagePackFields(dst)
+	dst = appendMsgpackString(dst, "url")
+	dst = appendMsgpackString(dst, data.Url)
+	dst = appendMsgpackString(dst, "duration")
+	dst = appendMsgpackString(dst, data.Duration)
+	return dst, nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the message to dst.
+func (data *MessageData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 3+customDimensionsFields(data.Properties, nil))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "message")
+	dst = appendMsgpackString(dst, data.Message)
+	dst = appendMsgpackString(dst, "severityLevel")
+	dst = appendMsgpackInt(dst, int64(data.SeverityLevel))
+	return appendMsgpackCustomDimensions(dst, data.Properties, nil), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the request to dst.
+func (data *RequestData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 8+customDimensionsFields(data.Properties, data.Measurements))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "id")
+	dst = appendMsgpackString(dst, data.Id)
+	dst = appendMsgpackString(dst, "source")
+	dst = appendMsgpackString(dst, data.Source)
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	dst = appendMsgpackString(dst, "duration")
+	dst = appendMsgpackString(dst, data.Duration)
+	dst = appendMsgpackString(dst, "responseCode")
+	dst = appendMsgpackString(dst, data.ResponseCode)
+	dst = appendMsgpackString(dst, "success")
+	dst = appendMsgpackBool(dst, data.Success)
+	dst = appendMsgpackString(dst, "url")
+	dst = appendMsgpackString(dst, data.Url)
+	return appendMsgpackCustomDimensions(dst, data.Properties, data.Measurements), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the remote
+// dependency to dst.
+func (data *RemoteDependencyData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 9+customDimensionsFields(data.Properties, data.Measurements))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	dst = appendMsgpackString(dst, "id")
+	dst = appendMsgpackString(dst, data.Id)
+	dst = appendMsgpackString(dst, "resultCode")
+	dst = appendMsgpackString(dst, data.ResultCode)
+	dst = appendMsgpackString(dst, "duration")
+	dst = appendMsgpackString(dst, data.Duration)
+	dst = appendMsgpackString(dst, "success")
+	dst = appendMsgpackBool(dst, data.Success)
+	dst = appendMsgpackString(dst, "data")
+	dst = appendMsgpackString(dst, data.Data)
+	dst = appendMsgpackString(dst, "target")
+	dst = appendMsgpackString(dst, data.Target)
+	dst = appendMsgpackString(dst, "type")
+	dst = appendMsgpackString(dst, data.Type)
+	return appendMsgpackCustomDimensions(dst, data.Properties, data.Measurements), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the availability
+// result to dst.
+func (data *AvailabilityData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 7+customDimensionsFields(data.Properties, data.Measurements))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "id")
+	dst = appendMsgpackString(dst, data.Id)
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	dst = appendMsgpackString(dst, "duration")
+	dst = appendMsgpackString(dst, data.Duration)
+	dst = appendMsgpackString(dst, "success")
+	dst = appendMsgpackBool(dst, data.Success)
+	dst = appendMsgpackString(dst, "runLocation")
+	dst = appendMsgpackString(dst, data.RunLocation)
+	dst = appendMsgpackString(dst, "message")
+	dst = appendMsgpackString(dst, data.Message)
+	return appendMsgpackCustomDimensions(dst, data.Properties, data.Measurements), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the metric to dst.
+func (data *MetricData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 2+customDimensionsFields(data.Properties, nil))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "metrics")
+	if data.Metrics == nil {
+		dst = append(dst, 0xc0)
+	} else {
+		dst = appendMsgpackArrayHeader(dst, len(data.Metrics))
+		for _, point := range data.Metrics {
+			var err error
+			if dst, err = appendMsgpackValue(dst, point); err != nil {
+				return dst, err
+			}
+		}
+	}
+	return appendMsgpackCustomDimensions(dst, data.Properties, nil), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the data point to
+// dst.
+func (data *DataPoint) AppendMessagePack(dst []byte) ([]byte, error) {
+	fields := 7
+	if data.Ns != "" {
+		fields++
+	}
+
+	dst = appendMsgpackMapHeader(dst, fields)
+	if data.Ns != "" {
+		dst = appendMsgpackString(dst, "ns")
+		dst = appendMsgpackString(dst, data.Ns)
+	}
+	dst = appendMsgpackString(dst, "name")
+	dst = appendMsgpackString(dst, data.Name)
+	dst = appendMsgpackString(dst, "kind")
+	dst = appendMsgpackInt(dst, int64(data.Kind))
+	dst = appendMsgpackString(dst, "value")
+	dst = appendMsgpackFloat(dst, data.Value)
+	dst = appendMsgpackString(dst, "count")
+	dst = appendMsgpackInt(dst, int64(data.Count))
+	dst = appendMsgpackString(dst, "min")
+	dst = appendMsgpackFloat(dst, data.Min)
+	dst = appendMsgpackString(dst, "max")
+	dst = appendMsgpackFloat(dst, data.Max)
+	dst = appendMsgpackString(dst, "stdDev")
+	dst = appendMsgpackFloat(dst, data.StdDev)
+	return dst, nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the exception to
+// dst.
+func (data *ExceptionData) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 4+customDimensionsFields(data.Properties, data.Measurements))
+	dst = appendMsgpackString(dst, "ver")
+	dst = appendMsgpackInt(dst, int64(data.Ver))
+	dst = appendMsgpackString(dst, "exceptions")
+	if data.Exceptions == nil {
+		dst = append(dst, 0xc0)
+	} else {
+		dst = appendMsgpackArrayHeader(dst, len(data.Exceptions))
+		for _, details := range data.Exceptions {
+			var err error
+			if dst, err = appendMsgpackValue(dst, details); err != nil {
+				return dst, err
+			}
+		}
+	}
+	dst = appendMsgpackString(dst, "severityLevel")
+	dst = appendMsgpackInt(dst, int64(data.SeverityLevel))
+	dst = appendMsgpackString(dst, "problemId")
+	dst = appendMsgpackString(dst, data.ProblemId)
+	return appendMsgpackCustomDimensions(dst, data.Properties, data.Measurements), nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the exception
+// details to dst.
+func (data *ExceptionDetails) AppendMessagePack(dst []byte) ([]byte, error) {
+	fields := 6
+	if len(data.ParsedStack) > 0 {
+		fields++
+	}
+
+	dst = appendMsgpackMapHeader(dst, fields)
+	dst = appendMsgpackString(dst, "id")
+	dst = appendMsgpackInt(dst, int64(data.Id))
+	dst = appendMsgpackString(dst, "outerId")
+	dst = appendMsgpackInt(dst, int64(data.OuterId))
+	dst = appendMsgpackString(dst, "typeName")
+	dst = appendMsgpackString(dst, data.TypeName)
+	dst = appendMsgpackString(dst, "message")
+	dst = appendMsgpackString(dst, data.Message)
+	dst = appendMsgpackString(dst, "hasFullStack")
+	dst = appendMsgpackBool(dst, data.HasFullStack)
+	dst = appendMsgpackString(dst, "stack")
+	dst = appendMsgpackString(dst, data.Stack)
+	if len(data.ParsedStack) > 0 {
+		dst = appendMsgpackString(dst, "parsedStack")
+		dst = appendMsgpackArrayHeader(dst, len(data.ParsedStack))
+		for _, frame := range data.ParsedStack {
+			var err error
+			if dst, err = appendMsgpackValue(dst, frame); err != nil {
+				return dst, err
+			}
+		}
+	}
+	return dst, nil
+}
+
+// AppendMessagePack appends the MessagePack encoding of the stack frame to
+// dst.
+func (data *StackFrame) AppendMessagePack(dst []byte) ([]byte, error) {
+	dst = appendMsgpackMapHeader(dst, 5)
+	dst = appendMsgpackString(dst, "level")
+	dst = appendMsgpackInt(dst, int64(data.Level))
+	dst = appendMsgpackString(dst, "method")
+	dst = appendMsgpackString(dst, data.Method)
+	dst = appendMsgpackString(dst, "assembly")
+	dst = appendMsgpackString(dst, data.Assembly)
+	dst = appendMsgpackString(dst, "fileName")
+	dst = appendMsgpackString(dst, data.FileName)
+	dst = appendMsgpackString(dst, "line")
+	dst = appendMsgpackInt(dst, int64(data.Line))
+	return dst, nil
+}
+
+// appendMsgpackValue appends a contract value.  Unlike the JSON encoders,
+// there is no reflection-based fallback for other types.
+func appendMsgpackValue(dst []byte, value interface{}) ([]byte, error) {
+	if value == nil {
+		return append(dst, 0xc0), nil
+	}
+
+	v, ok := value.(msgpackAppender)
+	if !ok {
+		return dst, fmt.Errorf("msgpack: unsupported value of type %T", value)
+	}
+
+	// Typed nil pointers encode as nil, as in JSON
+	if appender, ok := value.(jsonAppender); ok && isNilAppender(appender) {
+		return append(dst, 0xc0), nil
+	}
+
+	return v.AppendMessagePack(dst)
+}
+
+// customDimensionsFields returns the number of fields written by
+// appendMsgpackCustomDimensions.
+func customDimensionsFields(properties map[string]string, measurements map[string]float64) int {
+	fields := 0
+	if len(properties) > 0 {
+		fields++
+	}
+	if len(measurements) > 0 {
+		fields++
+	}
+	return fields
+}
+
+// appendMsgpackCustomDimensions appends the optional properties and
+// measurements fields shared by most data types.
+func appendMsgpackCustomDimensions(dst []byte, properties map[string]string, measurements map[string]float64) []byte {
+	if len(properties) > 0 {
+		dst = appendMsgpackString(dst, "properties")
+		dst = appendMsgpackStringMap(dst, properties)
+	}
+	if len(measurements) > 0 {
+		dst = appendMsgpackString(dst, "measurements")
+		dst = appendMsgpackFloatMap(dst, measurements)
+	}
+	return dst
+}
+
+// appendMsgpackStringMap appends a map with keys in sorted order.
+func appendMsgpackStringMap(dst []byte, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dst = appendMsgpackMapHeader(dst, len(keys))
+	for _, k := range keys {
+		dst = appendMsgpackString(dst, k)
+		dst = appendMsgpackString(dst, m[k])
+	}
+	return dst
+}
+
+// appendMsgpackFloatMap appends a map with keys in sorted order.
+func appendMsgpackFloatMap(dst []byte, m map[string]float64) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dst = appendMsgpackMapHeader(dst, len(keys))
+	for _, k := range keys {
+		dst = appendMsgpackString(dst, k)
+		dst = appendMsgpackFloat(dst, m[k])
+	}
+	return dst
+}
+
+func appendMsgpackBool(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+func appendMsgpackInt(dst []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(dst, byte(i))
+	case i < 0 && i >= -32:
+		return append(dst, byte(int8(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackFloat(dst []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(f))
+}
+
+// appendMsgpackString appends a string, replacing invalid UTF-8 as the JSON
+// encoder does.
+func appendMsgpackString(dst []byte, s string) []byte {
+	if !utf8.ValidString(s) {
+		s = replaceInvalidUTF8(s)
+	}
+
+	n := len(s)
+	switch {
+	case n <= 31:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+
+	return append(dst, s...)
+}
+
+// replaceInvalidUTF8 replaces each invalid byte with U+FFFD.
+func replaceInvalidUTF8(s string) string {
+	result := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			result = append(result, "\ufffd"...)
+		} else {
+			result = append(result, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(result)
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -28,6 +29,13 @@ type CorrelationContext struct {
 	OperationName string
 }
 
+// Errors returned when parsing IDs that W3C Trace Context defines as
+// invalid because every byte is zero
+var (
+	ErrZeroTraceID = errors.New("invalid trace ID: all zeros")
+	ErrZeroSpanID  = errors.New("invalid span ID: all zeros")
+)
+
 type correlationContextKey struct{}
 
 var correlationKey = correlationContextKey{}
@@ -87,7 +95,26 @@ func (c *CorrelationContext) ToW3CTraceParent() string {
 
 // ParseW3CTraceParent parses a W3C traceparent header value and returns a CorrelationContext
 // Expected format: version-trace_id-span_id-trace_flags
+// All-zero trace and span IDs are rejected with ErrZeroTraceID and ErrZeroSpanID
 func ParseW3CTraceParent(traceParent string) (*CorrelationContext, error) {
+	corrCtx, err := parseW3CTraceParent(traceParent)
+	if err != nil {
+		return nil, err
+	}
+
+	if isZeroID(corrCtx.TraceID) {
+		return nil, ErrZeroTraceID
+	}
+	if isZeroID(corrCtx.SpanID) {
+		return nil, ErrZeroSpanID
+	}
+
+	return corrCtx, nil
+}
+
+// parseW3CTraceParent parses the structure of a traceparent header value,
+// accepting all-zero IDs so that callers can repair them with Normalize
+func parseW3CTraceParent(traceParent string) (*CorrelationContext, error) {
 	parts := strings.Split(traceParent, "-")
 	if len(parts) != 4 {
 		return nil, fmt.Errorf("invalid traceparent format: expected 4 parts, got %d", len(parts))
@@ -98,15 +125,21 @@ func ParseW3CTraceParent(traceParent string) (*CorrelationContext, error) {
 		return nil, fmt.Errorf("unsupported traceparent version: %s", version)
 	}
 
-	traceID := parts[1]
+	traceID := strings.ToLower(parts[1])
 	if len(traceID) != 32 {
 		return nil, fmt.Errorf("invalid trace ID length: expected 32 characters, got %d", len(traceID))
 	}
+	if !isHexID(traceID, 32) {
+		return nil, fmt.Errorf("invalid trace ID: %s", parts[1])
+	}
 
-	spanID := parts[2]
+	spanID := strings.ToLower(parts[2])
 	if len(spanID) != 16 {
 		return nil, fmt.Errorf("invalid span ID length: expected 16 characters, got %d", len(spanID))
 	}
+	if !isHexID(spanID, 16) {
+		return nil, fmt.Errorf("invalid span ID: %s", parts[2])
+	}
 
 	traceFlags, err := hex.DecodeString(parts[3])
 	if err != nil || len(traceFlags) != 1 {
@@ -120,6 +153,84 @@ func ParseW3CTraceParent(traceParent string) (*CorrelationContext, error) {
 	}, nil
 }
 
+// IsValid returns whether the trace ID and span ID are well-formed, non-zero
+// W3C identifiers, and the parent span ID, if set, is too
+func (c *CorrelationContext) IsValid() bool {
+	if c == nil || !isValidTraceID(c.TraceID) || !isValidSpanID(c.SpanID) {
+		return false
+	}
+
+	return c.ParentSpanID == "" || isValidSpanID(c.ParentSpanID)
+}
+
+// Equal returns whether two correlation contexts identify the same span,
+// comparing IDs case-insensitively along with the trace flags.  The
+// operation name is descriptive and is not compared.
+func (c *CorrelationContext) Equal(other *CorrelationContext) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+
+	return strings.EqualFold(c.TraceID, other.TraceID) &&
+		strings.EqualFold(c.SpanID, other.SpanID) &&
+		strings.EqualFold(c.ParentSpanID, other.ParentSpanID) &&
+		c.TraceFlags == other.TraceFlags
+}
+
+// Normalize lowercases the IDs of the correlation context and replaces
+// invalid or all-zero trace and span IDs with newly generated ones, keeping
+// the remaining fields.  An invalid parent span ID is cleared.  Returns
+// whether any ID was replaced or cleared.
+func (c *CorrelationContext) Normalize() bool {
+	c.TraceID = strings.ToLower(c.TraceID)
+	c.SpanID = strings.ToLower(c.SpanID)
+	c.ParentSpanID = strings.ToLower(c.ParentSpanID)
+
+	repaired := false
+	if !isValidTraceID(c.TraceID) {
+		c.TraceID = generateTraceID()
+		repaired = true
+	}
+	if !isValidSpanID(c.SpanID) {
+		c.SpanID = generateSpanID()
+		repaired = true
+	}
+	if c.ParentSpanID != "" && !isValidSpanID(c.ParentSpanID) {
+		c.ParentSpanID = ""
+		repaired = true
+	}
+
+	return repaired
+}
+
+func isValidTraceID(id string) bool {
+	return isHexID(id, 32) && !isZeroID(id)
+}
+
+func isValidSpanID(id string) bool {
+	return isHexID(id, 16) && !isZeroID(id)
+}
+
+// isHexID checks that an ID consists of exactly length hex characters
+func isHexID(id string, length int) bool {
+	if len(id) != length {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isZeroID(id string) bool {
+	return strings.Trim(id, "0") == ""
+}
+
 // generateTraceID generates a random 128-bit trace ID as a 32-character hex string
 func generateTraceID() string {
 	bytes := make([]byte, 16)
@@ -4,15 +4,27 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// EventNameSeparator separates the operation name from the event name when
+// hierarchical event names are enabled
+const EventNameSeparator = "/"
+
 // SpanContext represents a span with correlation context and telemetry client
 type SpanContext struct {
 	Context     *CorrelationContext
 	Client      TelemetryClient
 	StartTime   time.Time
 	OperationID string
+
+	leak     *spanLeak
+	finished atomic.Bool
+
+	// Stops finishing the span when its context is done, if set
+	stopAutoFinish func() bool
 }
 
 // StartSpan creates a new span with the given operation name
@@ -34,19 +46,35 @@ func StartSpan(ctx context.Context, operationName string, client TelemetryClient
 		Client:      client,
 		StartTime:   time.Now(),
 		OperationID: corrCtx.GetOperationID(),
+		leak:        startSpanLeak("span", operationName),
 	}
 
 	newCtx := WithCorrelationContext(ctx, corrCtx)
 	return newCtx, spanCtx
 }
 
-// FinishSpan completes a span and tracks it as a dependency or request telemetry
+// FinishSpan completes a span and tracks it as a dependency or request
+// telemetry.  Only the first call has any effect.
 func (s *SpanContext) FinishSpan(ctx context.Context, success bool, properties map[string]string) {
-	if s == nil || s.Client == nil {
+	if s == nil || s.finished.Swap(true) {
 		return
 	}
 
-	duration := time.Since(s.StartTime)
+	if s.stopAutoFinish != nil {
+		s.stopAutoFinish()
+	}
+
+	s.finish(ctx, success, properties)
+}
+
+// finish tracks the span once it is marked finished
+func (s *SpanContext) finish(ctx context.Context, success bool, properties map[string]string) {
+	s.leak.finish()
+	if s.Client == nil {
+		return
+	}
+
+	duration := elapsed(s.StartTime, time.Now())
 
 	// Track as a dependency by default
 	dependency := NewRemoteDependencyTelemetryWithContext(ctx, s.Context.OperationName, "Internal", "", success)
@@ -104,6 +132,7 @@ func StartOperation(ctx context.Context, operationName string, client TelemetryC
 		Client:        client,
 		StartTime:     time.Now(),
 		OperationName: operationName,
+		leak:          startSpanLeak("operation", operationName),
 	}
 
 	newCtx := WithCorrelationContext(ctx, corrCtx)
@@ -116,15 +145,36 @@ type OperationContext struct {
 	Client        TelemetryClient
 	StartTime     time.Time
 	OperationName string
+
+	leak     *spanLeak
+	finished atomic.Bool
+
+	// Stops finishing the operation when its context is done, if set
+	stopAutoFinish func() bool
 }
 
-// FinishOperation completes an operation and tracks it as a request
+// FinishOperation completes an operation and tracks it as a request.  Only
+// the first call has any effect.
 func (o *OperationContext) FinishOperation(ctx context.Context, responseCode string, success bool, url string, properties map[string]string) {
-	if o == nil || o.Client == nil {
+	if o == nil || o.finished.Swap(true) {
+		return
+	}
+
+	if o.stopAutoFinish != nil {
+		o.stopAutoFinish()
+	}
+
+	o.finish(ctx, responseCode, success, url, properties)
+}
+
+// finish tracks the operation once it is marked finished
+func (o *OperationContext) finish(ctx context.Context, responseCode string, success bool, url string, properties map[string]string) {
+	o.leak.finish()
+	if o.Client == nil {
 		return
 	}
 
-	duration := time.Since(o.StartTime)
+	duration := elapsed(o.StartTime, time.Now())
 
 	request := NewRequestTelemetryWithContext(ctx, "OPERATION", url, duration, responseCode)
 	request.Success = success
@@ -196,7 +246,7 @@ func (h *HTTPOperationContext) FinishHTTPOperation(ctx context.Context, response
 		return
 	}
 
-	duration := time.Since(h.StartTime)
+	duration := elapsed(h.StartTime, time.Now())
 
 	h.Client.TrackRequestWithContext(ctx, h.Request.Method, h.Request.URL.String(), duration, responseCode)
 }
@@ -339,7 +389,7 @@ func TrackHTTPDependency(ctx context.Context, client TelemetryClient, req *http.
 		responseCode = strconv.Itoa(resp.StatusCode)
 	}
 
-	dependency := NewRemoteDependencyTelemetryWithContext(childCtx, req.URL.String(), "HTTP", target, success)
+	dependency := NewRemoteDependencyTelemetryWithContext(childCtx, req.URL.String(), DependencyTypeHTTP, target, success)
 	dependency.Duration = duration
 	dependency.ResultCode = responseCode
 	dependency.Data = req.Method + " " + req.URL.String()
@@ -352,3 +402,19 @@ func TrackHTTPDependency(ctx context.Context, client TelemetryClient, req *http.
 
 	return resp, err
 }
+
+// hierarchicalEventName prefixes an event name with the operation name found
+// in the correlation context, unless it is already prefixed
+func hierarchicalEventName(ctx context.Context, name string) string {
+	corrCtx := GetCorrelationContext(ctx)
+	if corrCtx == nil || corrCtx.OperationName == "" {
+		return name
+	}
+
+	prefix := corrCtx.OperationName + EventNameSeparator
+	if strings.HasPrefix(name, prefix) {
+		return name
+	}
+
+	return prefix + name
+}
@@ -207,6 +207,31 @@ func TestParseW3CTraceParent(t *testing.T) {
 			traceParent: "00-abcdef0123456789abcdef0123456789-abcdef0123456789-zz",
 			expectError: true,
 		},
+		{
+			name:        "non-hex trace ID",
+			traceParent: "00-zzzzzz0123456789abcdef0123456789-abcdef0123456789-01",
+			expectError: true,
+		},
+		{
+			name:        "all-zero trace ID",
+			traceParent: "00-00000000000000000000000000000000-abcdef0123456789-01",
+			expectError: true,
+		},
+		{
+			name:        "all-zero span ID",
+			traceParent: "00-abcdef0123456789abcdef0123456789-0000000000000000-01",
+			expectError: true,
+		},
+		{
+			name:        "uppercase IDs are normalized",
+			traceParent: "00-ABCDEF0123456789ABCDEF0123456789-ABCDEF0123456789-01",
+			expectError: false,
+			expected: &CorrelationContext{
+				TraceID:    "abcdef0123456789abcdef0123456789",
+				SpanID:     "abcdef0123456789",
+				TraceFlags: 1,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -238,6 +263,90 @@ func TestParseW3CTraceParent(t *testing.T) {
 	}
 }
 
+func TestParseW3CTraceParentZeroIDErrors(t *testing.T) {
+	if _, err := ParseW3CTraceParent("00-00000000000000000000000000000000-abcdef0123456789-01"); err != ErrZeroTraceID {
+		t.Errorf("Expected ErrZeroTraceID, got %v", err)
+	}
+	if _, err := ParseW3CTraceParent("00-abcdef0123456789abcdef0123456789-0000000000000000-01"); err != ErrZeroSpanID {
+		t.Errorf("Expected ErrZeroSpanID, got %v", err)
+	}
+}
+
+func TestCorrelationContextIsValid(t *testing.T) {
+	valid := &CorrelationContext{TraceID: "abcdef0123456789abcdef0123456789", SpanID: "abcdef0123456789"}
+
+	tests := []struct {
+		name     string
+		corrCtx  *CorrelationContext
+		expected bool
+	}{
+		{"valid", valid, true},
+		{"generated", NewCorrelationContext(), true},
+		{"child", NewChildCorrelationContext(valid), true},
+		{"nil", nil, false},
+		{"zero trace ID", &CorrelationContext{TraceID: strings.Repeat("0", 32), SpanID: valid.SpanID}, false},
+		{"zero span ID", &CorrelationContext{TraceID: valid.TraceID, SpanID: strings.Repeat("0", 16)}, false},
+		{"short trace ID", &CorrelationContext{TraceID: "abc", SpanID: valid.SpanID}, false},
+		{"non-hex span ID", &CorrelationContext{TraceID: valid.TraceID, SpanID: "zzzzzzzzzzzzzzzz"}, false},
+		{"invalid parent", &CorrelationContext{TraceID: valid.TraceID, SpanID: valid.SpanID, ParentSpanID: "bad"}, false},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.corrCtx.IsValid(); actual != tt.expected {
+			t.Errorf("%s: expected IsValid %v, got %v", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestCorrelationContextEqual(t *testing.T) {
+	a := &CorrelationContext{TraceID: "abcdef0123456789abcdef0123456789", SpanID: "abcdef0123456789", TraceFlags: 1, OperationName: "a"}
+	b := &CorrelationContext{TraceID: "ABCDEF0123456789ABCDEF0123456789", SpanID: "ABCDEF0123456789", TraceFlags: 1, OperationName: "b"}
+
+	if !a.Equal(b) {
+		t.Error("Expected contexts differing in case and operation name to be equal")
+	}
+
+	b.TraceFlags = 0
+	if a.Equal(b) {
+		t.Error("Expected contexts with different trace flags to differ")
+	}
+	if a.Equal(NewChildCorrelationContext(a)) {
+		t.Error("Expected child context to differ from its parent")
+	}
+
+	var nilCtx *CorrelationContext
+	if a.Equal(nil) || !nilCtx.Equal(nil) {
+		t.Error("Unexpected nil comparison result")
+	}
+}
+
+func TestCorrelationContextNormalize(t *testing.T) {
+	corrCtx := &CorrelationContext{
+		TraceID:       strings.Repeat("0", 32),
+		SpanID:        "ABCDEF0123456789",
+		ParentSpanID:  strings.Repeat("0", 16),
+		TraceFlags:    1,
+		OperationName: "GET /",
+	}
+
+	if !corrCtx.Normalize() {
+		t.Error("Expected Normalize to report repairs")
+	}
+	if !corrCtx.IsValid() {
+		t.Errorf("Expected normalized context to be valid: %+v", corrCtx)
+	}
+	if corrCtx.SpanID != "abcdef0123456789" || corrCtx.ParentSpanID != "" {
+		t.Errorf("Unexpected normalized IDs: %+v", corrCtx)
+	}
+	if corrCtx.TraceFlags != 1 || corrCtx.OperationName != "GET /" {
+		t.Error("Expected other fields to be preserved")
+	}
+
+	if corrCtx.Normalize() {
+		t.Error("Expected a valid context to need no repairs")
+	}
+}
+
 func TestRoundTripW3CTraceParent(t *testing.T) {
 	original := NewCorrelationContext()
 	original.TraceFlags = 1
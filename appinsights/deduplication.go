@@ -0,0 +1,166 @@
+package appinsights
+
+import (
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// IdempotencyKeyProperty is the default property used to identify
+// telemetry describing the same logical operation.
+const IdempotencyKeyProperty = "idempotencyKey"
+
+// DeduplicationProcessor is a SamplingProcessor that drops telemetry whose
+// idempotency key was already seen within a time window, so that
+// application-level retries that re-track the same logical operation are
+// not counted twice.  Telemetry without an idempotency key is unaffected.
+// Items that are not duplicates are passed on to the wrapped processor.
+type DeduplicationProcessor struct {
+	// Property holding the idempotency key
+	property string
+
+	// How long a key is remembered
+	window time.Duration
+
+	// Maximum number of keys remembered at once
+	maxKeys int
+
+	next SamplingProcessor
+
+	lock sync.Mutex
+	seen map[string]time.Time
+
+	// Remembered keys in the order they were seen, so that expired keys
+	// can be forgotten oldest first without scanning all of them
+	expiry  []dedupKey
+	dropped int64
+}
+
+type dedupKey struct {
+	key    string
+	seenAt time.Time
+}
+
+// NewDeduplicationProcessor creates a processor that suppresses telemetry
+// with a repeated IdempotencyKeyProperty value within the specified window,
+// and passes everything else to next.  If next is nil, all remaining
+// telemetry is kept.
+func NewDeduplicationProcessor(window time.Duration, next SamplingProcessor) *DeduplicationProcessor {
+	return NewDeduplicationProcessorWithProperty(IdempotencyKeyProperty, window, next)
+}
+
+// NewDeduplicationProcessorWithProperty creates a deduplication processor
+// that reads idempotency keys from the specified property.
+func NewDeduplicationProcessorWithProperty(property string, window time.Duration, next SamplingProcessor) *DeduplicationProcessor {
+	if next == nil {
+		next = NewDisabledSamplingProcessor()
+	}
+
+	return &DeduplicationProcessor{
+		property: property,
+		window:   window,
+		maxKeys:  10000,
+		next:     next,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// SetMaxKeys limits the number of idempotency keys remembered at once.
+// Once reached, new keys are not remembered until older keys expire, so
+// duplicates of them are not suppressed.
+func (p *DeduplicationProcessor) SetMaxKeys(maxKeys int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.maxKeys = maxKeys
+}
+
+// ShouldSample implements the SamplingProcessor interface
+func (p *DeduplicationProcessor) ShouldSample(envelope *contracts.Envelope) bool {
+	if envelope == nil {
+		return false
+	}
+
+	if key, ok := envelopeProperties(envelope)[p.property]; ok && key != "" {
+		if p.isDuplicate(envelope.Name + "|" + key) {
+			return false
+		}
+	}
+
+	return p.next.ShouldSample(envelope)
+}
+
+// GetSamplingRate returns the sampling rate of the wrapped processor
+func (p *DeduplicationProcessor) GetSamplingRate() float64 {
+	return p.next.GetSamplingRate()
+}
+
+// DroppedCount returns the number of duplicates suppressed so far
+func (p *DeduplicationProcessor) DroppedCount() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.dropped
+}
+
+// isDuplicate records the key and reports whether it was already seen
+// within the window
+func (p *DeduplicationProcessor) isDuplicate(key string) bool {
+	now := currentClock.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire(now)
+
+	if _, ok := p.seen[key]; ok {
+		p.dropped++
+		return true
+	}
+
+	if len(p.seen) < p.maxKeys {
+		p.seen[key] = now
+		p.expiry = append(p.expiry, dedupKey{key, now})
+	}
+
+	return false
+}
+
+// expire forgets keys that were seen more than a window ago.  Keys are
+// queued in the order they were seen, so only expired keys are visited.
+func (p *DeduplicationProcessor) expire(now time.Time) {
+	for len(p.expiry) > 0 && now.Sub(p.expiry[0].seenAt) >= p.window {
+		delete(p.seen, p.expiry[0].key)
+		p.expiry[0] = dedupKey{}
+		p.expiry = p.expiry[1:]
+	}
+}
+
+// envelopeProperties returns the custom properties of an envelope's data,
+// or nil if it has none.
+func envelopeProperties(envelope *contracts.Envelope) map[string]string {
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok {
+		return nil
+	}
+
+	switch baseData := data.BaseData.(type) {
+	case *contracts.EventData:
+		return baseData.Properties
+	case *contracts.PageViewData:
+		return baseData.Properties
+	case *contracts.MessageData:
+		return baseData.Properties
+	case *contracts.RequestData:
+		return baseData.Properties
+	case *contracts.RemoteDependencyData:
+		return baseData.Properties
+	case *contracts.AvailabilityData:
+		return baseData.Properties
+	case *contracts.MetricData:
+		return baseData.Properties
+	case *contracts.ExceptionData:
+		return baseData.Properties
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,118 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+)
+
+func trackWithIdempotencyKey(client TelemetryClient, name, key string) {
+	request := NewRequestTelemetry("POST", "https://example.com/"+name, time.Second, "200")
+	if key != "" {
+		request.Properties[IdempotencyKeyProperty] = key
+	}
+	client.Track(request)
+}
+
+func newDeduplicationTestClient(processor SamplingProcessor) (TelemetryClient, *TestTelemetryChannel) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SamplingProcessor = processor
+	return newTestClient(config)
+}
+
+func TestDeduplicationProcessor(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	processor := NewDeduplicationProcessor(time.Minute, nil)
+	client, testChannel := newDeduplicationTestClient(processor)
+
+	trackWithIdempotencyKey(client, "orders", "order-1")
+	trackWithIdempotencyKey(client, "orders", "order-1") // retry
+	trackWithIdempotencyKey(client, "orders", "order-2")
+	trackWithIdempotencyKey(client, "orders", "")
+	trackWithIdempotencyKey(client, "orders", "")
+
+	if testChannel.getSentCount() != 4 {
+		t.Errorf("Expected 4 items, got %d", testChannel.getSentCount())
+	}
+	if processor.DroppedCount() != 1 {
+		t.Errorf("Expected 1 dropped duplicate, got %d", processor.DroppedCount())
+	}
+
+	// Keys expire after the window
+	fakeClock.Increment(time.Minute)
+	trackWithIdempotencyKey(client, "orders", "order-1")
+	if testChannel.getSentCount() != 5 {
+		t.Errorf("Expected key to expire after the window, got %d items", testChannel.getSentCount())
+	}
+
+	// Different telemetry types do not collide
+	event := NewEventTelemetry("order-placed")
+	event.Properties[IdempotencyKeyProperty] = "order-1"
+	client.Track(event)
+	if testChannel.getSentCount() != 6 {
+		t.Errorf("Expected event with the same key to be kept, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestDeduplicationProcessorWrapsNext(t *testing.T) {
+	processor := NewDeduplicationProcessorWithProperty("requestKey", time.Minute, NewFixedRateSamplingProcessor(0))
+	client, testChannel := newDeduplicationTestClient(processor)
+
+	request := NewRequestTelemetry("GET", "https://example.com/", time.Second, "200")
+	request.Properties["requestKey"] = "a"
+	client.Track(request)
+
+	if testChannel.getSentCount() != 0 {
+		t.Error("Expected wrapped processor to sample out the item")
+	}
+	if processor.GetSamplingRate() != 0 {
+		t.Errorf("Expected wrapped processor's sampling rate, got %v", processor.GetSamplingRate())
+	}
+}
+
+func TestDeduplicationProcessorMaxKeys(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	processor := NewDeduplicationProcessor(time.Minute, nil)
+	processor.SetMaxKeys(2)
+	client, testChannel := newDeduplicationTestClient(processor)
+
+	for _, key := range []string{"a", "b", "c", "c", "a"} {
+		trackWithIdempotencyKey(client, "orders", key)
+	}
+
+	// "c" was not remembered, so only the repeated "a" is suppressed
+	if testChannel.getSentCount() != 4 {
+		t.Errorf("Expected 4 items, got %d", testChannel.getSentCount())
+	}
+}
+
+func TestDeduplicationProcessorMaxKeysExpiry(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	processor := NewDeduplicationProcessor(time.Minute, nil)
+	processor.SetMaxKeys(2)
+	client, testChannel := newDeduplicationTestClient(processor)
+
+	trackWithIdempotencyKey(client, "orders", "a")
+	fakeClock.Increment(30 * time.Second)
+	trackWithIdempotencyKey(client, "orders", "b")
+
+	// Only "a" has expired, which makes room for "c"
+	fakeClock.Increment(30 * time.Second)
+	for _, key := range []string{"c", "c", "b", "a"} {
+		trackWithIdempotencyKey(client, "orders", key)
+	}
+
+	// The second "c" and "b" are suppressed, "a" is seen again but the
+	// processor is full
+	if testChannel.getSentCount() != 4 {
+		t.Errorf("Expected 4 items, got %d", testChannel.getSentCount())
+	}
+	if processor.DroppedCount() != 2 {
+		t.Errorf("Expected 2 dropped duplicates, got %d", processor.DroppedCount())
+	}
+}
@@ -0,0 +1,286 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// DeliveryIDProperty identifies telemetry without an ID of its own, such as
+// events and traces, for delivery receipts.
+const DeliveryIDProperty = "deliveryId"
+
+var (
+	// ErrDeliveryDropped is reported by receipts of items that were
+	// dropped before transmission, e.g. by sampling or a full buffer.
+	ErrDeliveryDropped = errors.New("telemetry item was dropped before transmission")
+
+	// ErrDeliveryAbandoned is reported by receipts of items whose
+	// transmission was given up on, e.g. once retries were exhausted.
+	ErrDeliveryAbandoned = errors.New("telemetry item transmission was abandoned")
+)
+
+// DeliveryError is reported by receipts of items that ingestion rejected.
+type DeliveryError struct {
+	// HTTP status code of the item, or of the whole submission
+	StatusCode int
+
+	// Message returned by ingestion for the item, if any
+	Message string
+}
+
+func (err *DeliveryError) Error() string {
+	if err.Message != "" {
+		return fmt.Sprintf("telemetry item rejected by ingestion with status %d: %s", err.StatusCode, err.Message)
+	}
+
+	return fmt.Sprintf("telemetry item rejected by ingestion with status %d", err.StatusCode)
+}
+
+// DeliveryReceipt confirms whether a telemetry item was accepted by
+// ingestion, for an audit trail of compliance-critical telemetry.  Request
+// one with AwaitDelivery.
+type DeliveryReceipt struct {
+	// ID of the awaited item
+	ID string
+
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+// Receipts awaiting an item, keyed by item ID.  Once the item is tracked,
+// its receipts are moved onto its envelope.
+var deliveryReceipts = struct {
+	sync.Mutex
+	byID  map[string][]*DeliveryReceipt
+	count atomic.Int64
+}{
+	byID: make(map[string][]*DeliveryReceipt),
+}
+
+// AwaitDelivery registers for confirmation that the next telemetry item
+// tracked with the specified ID is accepted by ingestion.  Requests,
+// dependencies and availability results are identified by their Id; other
+// telemetry by its DeliveryIDProperty.  The receipt must be requested
+// before the item is tracked.
+//
+// The receipt completes once ingestion accepts the item (2xx), rejects it,
+// or the item is dropped or its transmission is abandoned.  Call Cancel if
+// the item is never tracked.
+func AwaitDelivery(id string) *DeliveryReceipt {
+	receipt := &DeliveryReceipt{
+		ID:   id,
+		done: make(chan struct{}),
+	}
+
+	deliveryReceipts.Lock()
+	defer deliveryReceipts.Unlock()
+
+	deliveryReceipts.byID[id] = append(deliveryReceipts.byID[id], receipt)
+	deliveryReceipts.count.Add(1)
+	return receipt
+}
+
+// Done returns a channel that is closed once the receipt completes.
+func (receipt *DeliveryReceipt) Done() <-chan struct{} {
+	return receipt.done
+}
+
+// Err returns nil if the item was accepted by ingestion, or the reason it
+// wasn't.  Only meaningful once Done is closed.
+func (receipt *DeliveryReceipt) Err() error {
+	select {
+	case <-receipt.done:
+		return receipt.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the receipt to complete and returns its error, or the
+// error of ctx if it is done first.
+func (receipt *DeliveryReceipt) Wait(ctx context.Context) error {
+	select {
+	case <-receipt.done:
+		return receipt.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cancel unregisters a receipt that hasn't completed, e.g. because its item
+// was never tracked.  The receipt completes with context.Canceled.
+func (receipt *DeliveryReceipt) Cancel() {
+	deliveryReceipts.Lock()
+	if removeReceipt(deliveryReceipts.byID, receipt.ID, receipt) {
+		deliveryReceipts.count.Add(-1)
+	}
+	deliveryReceipts.Unlock()
+
+	// A receipt already bound to an envelope stays there, but completing it
+	// now makes the envelope's outcome a no-op
+	receipt.complete(context.Canceled)
+}
+
+func (receipt *DeliveryReceipt) complete(err error) {
+	receipt.once.Do(func() {
+		receipt.err = err
+		close(receipt.done)
+	})
+}
+
+// removeReceipt removes a receipt from a registry.  Must be called with the
+// lock held.
+func removeReceipt(registry map[string][]*DeliveryReceipt, key string, receipt *DeliveryReceipt) bool {
+	receipts := registry[key]
+	for i, r := range receipts {
+		if r == receipt {
+			receipts = append(receipts[:i], receipts[i+1:]...)
+			if len(receipts) == 0 {
+				delete(registry, key)
+			} else {
+				registry[key] = receipts
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// bindDeliveryReceipts moves the receipts awaiting a tracked envelope's ID
+// onto the envelope, so that they are collected along with it if it is never
+// settled, and so that copies of it, such as shadow telemetry, don't complete
+// them
+func bindDeliveryReceipts(envelope *contracts.Envelope) {
+	// Avoid taking the lock on the hot path when nothing is registered
+	if deliveryReceipts.count.Load() == 0 {
+		return
+	}
+
+	id := deliveryID(envelope)
+	if id == "" {
+		return
+	}
+
+	deliveryReceipts.Lock()
+	receipts, ok := deliveryReceipts.byID[id]
+	if ok {
+		delete(deliveryReceipts.byID, id)
+		deliveryReceipts.count.Add(-int64(len(receipts)))
+	}
+	deliveryReceipts.Unlock()
+
+	for _, receipt := range receipts {
+		envelope.Deliveries = append(envelope.Deliveries, deliveryNotifier{receipt})
+	}
+}
+
+// completeDelivery completes the receipts bound to an envelope
+func completeDelivery(envelope *contracts.Envelope, err error) {
+	if envelope == nil || len(envelope.Deliveries) == 0 {
+		return
+	}
+
+	deliveries := envelope.Deliveries
+	envelope.Deliveries = nil
+	for _, delivery := range deliveries {
+		delivery.Complete(err)
+	}
+}
+
+// deliveryNotifier adapts a DeliveryReceipt to contracts.DeliveryNotifier
+// without exporting a method on the receipt itself
+type deliveryNotifier struct {
+	receipt *DeliveryReceipt
+}
+
+func (n deliveryNotifier) Complete(err error) {
+	n.receipt.complete(err)
+}
+
+// settleDeliveries completes the receipts of transmitted items according
+// to the result of the transmission.  Items that may be retried are left
+// pending unless this was the final attempt.
+func settleDeliveries(items telemetryBufferItems, result *transmissionResult, err error, final bool) {
+	if !hasDeliveries(items) {
+		return
+	}
+
+	switch {
+	case err != nil || result == nil:
+		if final {
+			for _, item := range items {
+				completeDelivery(item, ErrDeliveryAbandoned)
+			}
+		}
+
+	case result.IsSuccess():
+		for _, item := range items {
+			completeDelivery(item, nil)
+		}
+
+	case result.statusCode == partialSuccessResponse && result.response != nil:
+		failed := make(map[int]*itemTransmissionResult, len(result.response.Errors))
+		for _, itemResult := range result.response.Errors {
+			failed[itemResult.Index] = itemResult
+		}
+
+		for i, item := range items {
+			if itemResult, ok := failed[i]; !ok {
+				completeDelivery(item, nil)
+			} else if final || !itemResult.CanRetry() {
+				completeDelivery(item, &DeliveryError{StatusCode: itemResult.StatusCode, Message: itemResult.Message})
+			}
+		}
+
+	case final || !result.CanRetry():
+		for _, item := range items {
+			completeDelivery(item, &DeliveryError{StatusCode: result.statusCode})
+		}
+	}
+}
+
+// abandonDeliveries completes the receipts of items whose transmission was
+// given up on
+func abandonDeliveries(items telemetryBufferItems) {
+	for _, item := range items {
+		completeDelivery(item, ErrDeliveryAbandoned)
+	}
+}
+
+// hasDeliveries returns whether any of the items has receipts bound to it
+func hasDeliveries(items telemetryBufferItems) bool {
+	for _, item := range items {
+		if len(item.Deliveries) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deliveryID returns the ID by which receipts identify an envelope
+func deliveryID(envelope *contracts.Envelope) string {
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok {
+		return ""
+	}
+
+	switch baseData := data.BaseData.(type) {
+	case *contracts.RequestData:
+		return baseData.Id
+	case *contracts.RemoteDependencyData:
+		return baseData.Id
+	case *contracts.AvailabilityData:
+		return baseData.Id
+	}
+
+	return envelopeProperties(envelope)[DeliveryIDProperty]
+}
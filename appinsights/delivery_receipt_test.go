@@ -0,0 +1,129 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForReceipt(t *testing.T, receipt *DeliveryReceipt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := receipt.Wait(ctx)
+	if err == context.DeadlineExceeded {
+		t.Fatalf("Timed out waiting for the receipt of %s", receipt.ID)
+	}
+
+	return err
+}
+
+func TestDeliveryReceipts(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
+	config.MaxBatchInterval = ten_seconds
+	client, transmitter := newTestChannelServer(config)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	accepted := AwaitDelivery("audit-1")
+	rejected := AwaitDelivery("audit-2")
+	request := NewRequestTelemetry("POST", "/transfer", time.Second, "200")
+	requestReceipt := AwaitDelivery(request.Id)
+
+	for _, id := range []string{"audit-1", "audit-2"} {
+		event := NewEventTelemetry("transfer approved")
+		event.Properties[DeliveryIDProperty] = id
+		client.Track(event)
+	}
+	client.Track(request)
+
+	transmitter.responses <- &transmissionResult{
+		statusCode: partialSuccessResponse,
+		response: &backendResponse{
+			ItemsReceived: 3,
+			ItemsAccepted: 2,
+			Errors:        itemTransmissionResults{{Index: 1, StatusCode: 400, Message: "invalid"}},
+		},
+	}
+	client.Channel().Flush()
+	transmitter.waitForRequest(t)
+
+	if err := waitForReceipt(t, accepted); err != nil {
+		t.Errorf("Expected the first event to be accepted, got %v", err)
+	}
+	if err := waitForReceipt(t, requestReceipt); err != nil || requestReceipt.Err() != nil {
+		t.Errorf("Expected the request to be accepted, got %v", err)
+	}
+
+	var deliveryErr *DeliveryError
+	if err := waitForReceipt(t, rejected); !errors.As(err, &deliveryErr) || deliveryErr.StatusCode != 400 || deliveryErr.Message != "invalid" {
+		t.Errorf("Expected the second event to be rejected, got %v", err)
+	}
+
+	if deliveryReceipts.count.Load() != 0 {
+		t.Errorf("Expected no pending receipts, got %d", deliveryReceipts.count.Load())
+	}
+}
+
+func TestDeliveryReceiptDropped(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
+	config.SamplingProcessor = NewFixedRateSamplingProcessor(0)
+	client, transmitter := newTestChannelServer(config)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	receipt := AwaitDelivery("dropped")
+	event := NewEventTelemetry("sampled out")
+	event.Properties[DeliveryIDProperty] = "dropped"
+	client.Track(event)
+
+	if err := waitForReceipt(t, receipt); err != ErrDeliveryDropped {
+		t.Errorf("Expected the event to be dropped, got %v", err)
+	}
+}
+
+func TestDeliveryReceiptCancel(t *testing.T) {
+	receipt := AwaitDelivery("never-tracked")
+	select {
+	case <-receipt.Done():
+		t.Fatal("Expected the receipt to be pending")
+	default:
+	}
+	if receipt.Err() != nil {
+		t.Error("Expected no error while pending")
+	}
+
+	receipt.Cancel()
+	if err := waitForReceipt(t, receipt); err != context.Canceled {
+		t.Errorf("Expected a canceled receipt, got %v", err)
+	}
+	if deliveryReceipts.count.Load() != 0 {
+		t.Errorf("Expected no pending receipts, got %d", deliveryReceipts.count.Load())
+	}
+}
+
+func TestDeliveryReceiptBoundToEnvelope(t *testing.T) {
+	receipt := AwaitDelivery("bound")
+	event := NewEventTelemetry("bound")
+	event.Properties[DeliveryIDProperty] = "bound"
+	envelope := telemetryBuffer(event)[0]
+
+	// Once tracked, nothing outside the envelope refers to the receipt, so
+	// an envelope that is never settled does not leak
+	bindDeliveryReceipts(envelope)
+	if len(envelope.Deliveries) != 1 || deliveryReceipts.count.Load() != 0 {
+		t.Fatalf("Expected the receipt to move onto the envelope, got %d", len(envelope.Deliveries))
+	}
+
+	receipt.Cancel()
+	if err := waitForReceipt(t, receipt); err != context.Canceled {
+		t.Errorf("Expected a canceled receipt, got %v", err)
+	}
+
+	// The envelope's outcome no longer affects the canceled receipt
+	completeDelivery(envelope, nil)
+	if receipt.Err() != context.Canceled || len(envelope.Deliveries) != 0 {
+		t.Errorf("Expected the receipt to stay canceled, got %v", receipt.Err())
+	}
+}
@@ -0,0 +1,151 @@
+package appinsights
+
+import (
+	"runtime/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeltaRateMetricSuffix is appended to a counter's name for the metric
+// holding its rate per second.
+const DeltaRateMetricSuffix = "/sec"
+
+// deltaCounter tracks the last value of a cumulative counter
+type deltaCounter struct {
+	// Reads the current value, or nil for counters set with Set
+	read func() (float64, bool)
+
+	// Latest value set with Set
+	value float64
+	set   bool
+
+	// Value and time at the last collection
+	previous   float64
+	previousAt time.Time
+	baseline   bool
+}
+
+// DeltaCollector converts monotonically increasing counters, such as totals
+// of bytes sent or of garbage collections, into the amount they increased
+// by over each collection interval, and their rate per second, so that
+// dashboards chart activity instead of ever-growing totals.  DeltaCollector
+// is a PerformanceCounterCollector: register it as a custom collector.
+//
+// The first collection of a counter only records its baseline.  A counter
+// that decreases is assumed to have been reset, e.g. by a restart, and its
+// new value is reported as the increase.
+type DeltaCollector struct {
+	mu       sync.Mutex
+	counters map[string]*deltaCounter
+}
+
+// NewDeltaCollector creates a collector without counters.
+func NewDeltaCollector() *DeltaCollector {
+	return &DeltaCollector{
+		counters: make(map[string]*deltaCounter),
+	}
+}
+
+// AddCounter registers a counter whose cumulative value is read by read on
+// each collection and reported under name.
+func (collector *DeltaCollector) AddCounter(name string, read func() float64) {
+	collector.add(name, func() (float64, bool) {
+		return read(), true
+	})
+}
+
+// AddRuntimeCounter registers a cumulative runtime/metrics sample, such as
+// "/gc/cycles/total:gc-cycles", reported under name.  Samples the running
+// runtime doesn't report are skipped.
+func (collector *DeltaCollector) AddRuntimeCounter(name, sample string) {
+	collector.add(name, func() (float64, bool) {
+		samples := []metrics.Sample{{Name: sample}}
+		metrics.Read(samples)
+
+		switch samples[0].Value.Kind() {
+		case metrics.KindUint64:
+			return float64(samples[0].Value.Uint64()), true
+		case metrics.KindFloat64:
+			return samples[0].Value.Float64(), true
+		default:
+			return 0, false
+		}
+	})
+}
+
+func (collector *DeltaCollector) add(name string, read func() (float64, bool)) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.counters[name] = &deltaCounter{read: read}
+}
+
+// Set records the current cumulative value of the counter reported under
+// name, registering it if needed.  Use it for counters maintained by the
+// application rather than read on collection.
+func (collector *DeltaCollector) Set(name string, value float64) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	counter, ok := collector.counters[name]
+	if !ok {
+		counter = &deltaCounter{}
+		collector.counters[name] = counter
+	}
+
+	counter.value = value
+	counter.set = true
+}
+
+// Name returns the collector name
+func (collector *DeltaCollector) Name() string {
+	return "Delta Metrics"
+}
+
+// Collect reports the increase of each counter since the last collection,
+// and its rate per second.
+func (collector *DeltaCollector) Collect(client TelemetryClient) {
+	now := currentClock.Now()
+
+	collector.mu.Lock()
+	names := make([]string, 0, len(collector.counters))
+	for name := range collector.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var deltas []*MetricTelemetry
+	for _, name := range names {
+		counter := collector.counters[name]
+
+		value, ok := counter.value, counter.set
+		if counter.read != nil {
+			value, ok = counter.read()
+		}
+		if !ok {
+			continue
+		}
+
+		if counter.baseline {
+			delta := value - counter.previous
+			if delta < 0 {
+				delta = value
+			}
+			deltas = append(deltas, NewMetricTelemetry(name, delta))
+
+			if elapsed := now.Sub(counter.previousAt); elapsed > 0 {
+				deltas = append(deltas, NewMetricTelemetry(name+DeltaRateMetricSuffix, delta/elapsed.Seconds()))
+			}
+		}
+
+		counter.previous = value
+		counter.previousAt = now
+		counter.baseline = true
+	}
+	collector.mu.Unlock()
+
+	for _, metric := range deltas {
+		client.Track(metric)
+	}
+}
@@ -0,0 +1,82 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func collectDeltas(t *testing.T, collector *DeltaCollector) map[string]float64 {
+	client, testChannel := newTestClient()
+
+	collector.Collect(client)
+
+	values := make(map[string]float64)
+	for _, envelope := range testChannel.sentItems {
+		metric := envelope.Data.(*contracts.Data).BaseData.(*contracts.MetricData)
+		values[metric.Metrics[0].Name] = metric.Metrics[0].Value
+	}
+	return values
+}
+
+func TestDeltaCollector(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	requests := 100.0
+	collector := NewDeltaCollector()
+	collector.AddCounter("requests", func() float64 { return requests })
+	collector.Set("bytes", 1000)
+
+	if values := collectDeltas(t, collector); len(values) != 0 {
+		t.Fatalf("Expected the first collection to only record baselines, got %v", values)
+	}
+
+	requests = 130
+	collector.Set("bytes", 4000)
+	fakeClock.Increment(10 * time.Second)
+
+	values := collectDeltas(t, collector)
+	if len(values) != 4 {
+		t.Fatalf("Expected deltas and rates of both counters, got %v", values)
+	}
+	if values["requests"] != 30 || values["requests/sec"] != 3 {
+		t.Errorf("Unexpected requests delta %v and rate %v", values["requests"], values["requests/sec"])
+	}
+	if values["bytes"] != 3000 || values["bytes/sec"] != 300 {
+		t.Errorf("Unexpected bytes delta %v and rate %v", values["bytes"], values["bytes/sec"])
+	}
+
+	// A decreasing counter was reset, and its new value is the increase
+	requests = 20
+	fakeClock.Increment(10 * time.Second)
+
+	values = collectDeltas(t, collector)
+	if values["requests"] != 20 || values["requests/sec"] != 2 {
+		t.Errorf("Expected the reset counter's value as delta, got %v and rate %v", values["requests"], values["requests/sec"])
+	}
+	if values["bytes"] != 0 {
+		t.Errorf("Expected an unchanged counter to report zero, got %v", values["bytes"])
+	}
+}
+
+func TestDeltaCollectorRuntimeCounter(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	collector := NewDeltaCollector()
+	collector.AddRuntimeCounter("gc.cycles", "/gc/cycles/total:gc-cycles")
+	collector.AddRuntimeCounter("unsupported", "/does/not/exist:units")
+
+	collectDeltas(t, collector)
+	fakeClock.Increment(time.Second)
+
+	values := collectDeltas(t, collector)
+	if _, ok := values["gc.cycles"]; !ok {
+		t.Errorf("Expected a runtime counter delta, got %v", values)
+	}
+	if _, ok := values["unsupported"]; ok {
+		t.Error("Did not expect a delta of an unsupported sample")
+	}
+}
@@ -0,0 +1,64 @@
+package appinsights
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The only modules the core packages may import besides the standard
+// library.  Integrations with frameworks such as Gin or Echo are written
+// against interfaces instead, so that the core stays small and builds
+// without cgo for constrained targets such as WASM.
+var allowedCoreImports = []string{
+	"code.cloudfoundry.org/clock",
+	"github.com/gofrs/uuid/v5",
+	"github.com/microsoft/ApplicationInsights-Go/appinsights",
+}
+
+func TestCoreDependencyFootprint(t *testing.T) {
+	for _, dir := range []string{".", "contracts"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+
+			parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %s", file, err)
+			}
+
+			for _, spec := range parsed.Imports {
+				path, _ := strconv.Unquote(spec.Path.Value)
+				if path == "C" {
+					t.Errorf("%s requires cgo", file)
+				} else if !isAllowedCoreImport(path) {
+					t.Errorf("%s imports %s, which isn't an allowed core dependency", file, path)
+				}
+			}
+		}
+	}
+}
+
+func isAllowedCoreImport(path string) bool {
+	// Standard library paths have no dot in their first element
+	if first, _, _ := strings.Cut(path, "/"); !strings.Contains(first, ".") {
+		return true
+	}
+
+	for _, allowed := range allowedCoreImports {
+		if path == allowed || strings.HasPrefix(path, allowed+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package appinsights
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DependencySummaryMetricName is the metric name used for per-target
+	// dependency summaries
+	DependencySummaryMetricName = "dependencies/summary"
+
+	// Properties identifying the target of a dependency summary
+	DependencySummaryTargetProperty = "dependency.target"
+	DependencySummaryTypeProperty   = "dependency.type"
+
+	// dependencySummaryOverflowTarget groups targets beyond MaxTargets
+	dependencySummaryOverflowTarget = "Other"
+)
+
+// DependencySummaryConfig configures per-target dependency summaries: the
+// count, failure count and duration buckets of the calls to each target,
+// emitted as metrics every interval.  Calls are recorded before sampling
+// and the summaries are sent without being sampled, so that Application
+// Map edge statistics remain accurate when dependencies are sampled out.
+type DependencySummaryConfig struct {
+	// Upper bounds of the duration buckets, in ascending order.  Defaults
+	// to DefaultDurationHistogramBuckets.
+	Buckets []time.Duration
+
+	// How often summaries are emitted.  Defaults to one minute.
+	FlushInterval time.Duration
+
+	// Emit summaries on multiples of FlushInterval on the wall clock, so
+	// that windows line up across instances.
+	AlignToWallClock bool
+
+	// Maximum number of distinct targets summarized per interval;
+	// additional targets are grouped under "Other".  Defaults to 100.
+	MaxTargets int
+}
+
+// NewDependencySummaryConfig creates a new configuration with default
+// values.
+func NewDependencySummaryConfig() *DependencySummaryConfig {
+	return &DependencySummaryConfig{
+		Buckets:       DefaultDurationHistogramBuckets,
+		FlushInterval: 60 * time.Second,
+		MaxTargets:    100,
+	}
+}
+
+type dependencySummaryKey struct {
+	target  string
+	depType string
+}
+
+// DependencySummaryCollector aggregates dependency calls per target and type
+// and periodically emits them as aggregated metrics.
+type DependencySummaryCollector struct {
+	send    func(item Telemetry)
+	config  DependencySummaryConfig
+	buckets []time.Duration
+
+	summaries map[dependencySummaryKey]*durationHistogram
+	mu        sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newDependencySummaryCollector creates a collector passing its metrics to
+// send
+func newDependencySummaryCollector(send func(item Telemetry), config *DependencySummaryConfig) *DependencySummaryCollector {
+	cfg := *config
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 60 * time.Second
+	}
+	if cfg.MaxTargets <= 0 {
+		cfg.MaxTargets = 100
+	}
+
+	buckets := make([]time.Duration, len(cfg.Buckets))
+	copy(buckets, cfg.Buckets)
+	if len(buckets) == 0 {
+		buckets = append(buckets, DefaultDurationHistogramBuckets...)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	return &DependencySummaryCollector{
+		send:      send,
+		config:    cfg,
+		buckets:   buckets,
+		summaries: make(map[dependencySummaryKey]*durationHistogram),
+	}
+}
+
+// Start begins periodic flushing of the summaries
+func (c *DependencySummaryCollector) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return // Already running
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.wg.Add(1)
+	go c.flushLoop()
+}
+
+// Stop halts periodic flushing and emits any pending summaries
+func (c *DependencySummaryCollector) Stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		c.wg.Wait()
+	}
+
+	c.Flush()
+}
+
+// flushLoop runs the periodic flush of the summaries
+func (c *DependencySummaryCollector) flushLoop() {
+	defer c.wg.Done()
+
+	if c.config.AlignToWallClock {
+		if !waitForAlignment(c.ctx.Done(), c.config.FlushInterval) {
+			return
+		}
+		c.Flush()
+	}
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.Flush()
+		}
+	}
+}
+
+// Observe records a remote dependency telemetry item.  Other telemetry
+// types are ignored.
+func (c *DependencySummaryCollector) Observe(item Telemetry) {
+	if c == nil {
+		return
+	}
+
+	if dependency, ok := item.(*RemoteDependencyTelemetry); ok {
+		c.Record(dependency.Target, dependency.Type, dependency.Duration, dependency.Success)
+	}
+}
+
+// Record adds a single call to the summary of the specified target and
+// dependency type.
+func (c *DependencySummaryCollector) Record(target, depType string, duration time.Duration, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := dependencySummaryKey{target, depType}
+	summary, ok := c.summaries[key]
+	if !ok {
+		if len(c.summaries) >= c.config.MaxTargets {
+			key = dependencySummaryKey{dependencySummaryOverflowTarget, ""}
+			summary, ok = c.summaries[key]
+		}
+
+		if !ok {
+			summary = &durationHistogram{counts: make([]int64, len(c.buckets)+1)}
+			c.summaries[key] = summary
+		}
+	}
+
+	summary.add(c.buckets, duration, success)
+}
+
+// Flush emits all pending summaries as aggregated metrics, ordered by
+// target, and resets them
+func (c *DependencySummaryCollector) Flush() {
+	c.mu.Lock()
+	summaries := c.summaries
+	c.summaries = make(map[dependencySummaryKey]*durationHistogram)
+	c.mu.Unlock()
+
+	keys := make([]dependencySummaryKey, 0, len(summaries))
+	for key := range summaries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].target != keys[j].target {
+			return keys[i].target < keys[j].target
+		}
+		return keys[i].depType < keys[j].depType
+	})
+
+	for _, key := range keys {
+		c.send(c.buildMetric(key, summaries[key]))
+	}
+}
+
+// buildMetric converts a summary into an aggregated metric telemetry item
+func (c *DependencySummaryCollector) buildMetric(key dependencySummaryKey, summary *durationHistogram) *AggregateMetricTelemetry {
+	metric := NewAggregateMetricTelemetry(DependencySummaryMetricName)
+	metric.Unit = "ms"
+	metric.Value = toMilliseconds(summary.sum)
+	metric.Count = int(summary.count)
+	metric.Min = toMilliseconds(summary.min)
+	metric.Max = toMilliseconds(summary.max)
+	metric.Properties[DependencySummaryTargetProperty] = key.target
+	if key.depType != "" {
+		metric.Properties[DependencySummaryTypeProperty] = key.depType
+	}
+	metric.Properties["failedCount"] = strconv.FormatInt(summary.failed, 10)
+
+	for i, bound := range c.buckets {
+		metric.Properties["bucket.le_"+bound.String()] = strconv.FormatInt(summary.counts[i], 10)
+	}
+	metric.Properties["bucket.le_inf"] = strconv.FormatInt(summary.counts[len(c.buckets)], 10)
+
+	return metric
+}
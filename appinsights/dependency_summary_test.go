@@ -0,0 +1,69 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestDependencySummaries(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SamplingProcessor = NewFixedRateSamplingProcessor(0)
+	config.DependencySummaries = NewDependencySummaryConfig()
+	config.DependencySummaries.Buckets = []time.Duration{100 * time.Millisecond}
+	client, testChannel := newTestClient(config)
+
+	for _, call := range []struct {
+		target   string
+		duration time.Duration
+		success  bool
+	}{
+		{"db.example.com", 50 * time.Millisecond, true},
+		{"db.example.com", 150 * time.Millisecond, false},
+		{"api.example.com", 10 * time.Millisecond, true},
+	} {
+		dependency := NewRemoteDependencyTelemetry("call", "HTTP", call.target, call.success)
+		dependency.Duration = call.duration
+		client.Track(dependency)
+	}
+
+	if testChannel.getSentCount() != 0 {
+		t.Fatalf("Expected the dependencies to be sampled out, got %d items", testChannel.getSentCount())
+	}
+
+	client.(*telemetryClient).dependencySummaries.Stop()
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected a summary per target, got %d items", testChannel.getSentCount())
+	}
+
+	api := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.MetricData)
+	db := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.MetricData)
+	if api.Properties[DependencySummaryTargetProperty] != "api.example.com" || api.Metrics[0].Count != 1 {
+		t.Errorf("Unexpected summary: %v", api.Properties)
+	}
+
+	if db.Properties[DependencySummaryTypeProperty] != "HTTP" || db.Metrics[0].Count != 2 || db.Metrics[0].Value != 200 {
+		t.Errorf("Unexpected summary: %v %v", db.Properties, db.Metrics[0])
+	}
+	if db.Properties["failedCount"] != "1" || db.Properties["bucket.le_100ms"] != "1" || db.Properties["bucket.le_inf"] != "1" {
+		t.Errorf("Unexpected failures or buckets: %v", db.Properties)
+	}
+}
+
+func TestDependencySummaryOverflow(t *testing.T) {
+	var sent []Telemetry
+	collector := newDependencySummaryCollector(func(item Telemetry) { sent = append(sent, item) }, &DependencySummaryConfig{MaxTargets: 1})
+
+	collector.Record("first", "SQL", time.Millisecond, true)
+	collector.Record("second", "SQL", time.Millisecond, true)
+	collector.Record("third", "HTTP", time.Millisecond, true)
+	collector.Flush()
+
+	if len(sent) != 2 {
+		t.Fatalf("Expected the first target and the overflow, got %d", len(sent))
+	}
+	if overflow := sent[0].(*AggregateMetricTelemetry); overflow.Properties[DependencySummaryTargetProperty] != "Other" || overflow.Count != 2 {
+		t.Errorf("Unexpected overflow summary: %v", overflow.Properties)
+	}
+}
@@ -0,0 +1,78 @@
+package appinsights
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Default ports omitted from dependency targets, by URL scheme
+var defaultSchemePorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// DependencyTarget formats the target of a dependency on the endpoint
+// identified by u, so that calls to the same endpoint are grouped together
+// in the Application Map however their URLs are spelled:
+//
+//   - host names are lower-cased, without a trailing dot
+//   - IPv6 literals are written in canonical form, in brackets and without
+//     a zone
+//   - ports are kept, unless they are the default port for the scheme
+//   - unix sockets, addressed as unix:///path or with an http+unix URL
+//     whose host is the socket path, are written as unix:/path
+//
+// An empty string is returned if u has no host.
+func DependencyTarget(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "unix" {
+		return "unix:" + u.Path
+	}
+	if strings.HasSuffix(scheme, "+unix") {
+		if socket, err := url.PathUnescape(u.Host); err == nil {
+			return "unix:" + socket
+		}
+	}
+
+	return formatDependencyHost(strings.TrimSuffix(scheme, "+unix"), u.Host)
+}
+
+// formatDependencyHost normalizes a host with an optional port
+func formatDependencyHost(scheme, hostport string) string {
+	if hostport == "" {
+		return ""
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// No port; brackets may still enclose an IPv6 literal
+		host, port = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), ""
+	}
+
+	if port == defaultSchemePorts[strings.ToLower(scheme)] {
+		port = ""
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		host = addr.WithZone("").Unmap().String()
+		if addr.Is6() && !addr.Is4In6() {
+			host = "[" + host + "]"
+		}
+	} else {
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+	}
+
+	if port != "" {
+		return host + ":" + port
+	}
+
+	return host
+}
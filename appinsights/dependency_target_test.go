@@ -0,0 +1,62 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDependencyTarget(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://Example.COM/path", "example.com"},
+		{"https://example.com:443/path", "example.com"},
+		{"http://example.com:80", "example.com"},
+		{"HTTP://example.com:80", "example.com"},
+		{"http://example.com:443", "example.com:443"},
+		{"https://example.com.:8443", "example.com:8443"},
+		{"wss://example.com:443/socket", "example.com"},
+		{"http://127.0.0.1:8080", "127.0.0.1:8080"},
+		{"http://[::1]:8080/", "[::1]:8080"},
+		{"http://[::1]/", "[::1]"},
+		{"https://[2001:DB8:0:0::0001]:443/", "[2001:db8::1]"},
+		{"http://[fe80::1%25eth0]:9000/", "[fe80::1]:9000"},
+		{"http://[::ffff:10.0.0.1]:81/", "10.0.0.1:81"},
+		{"unix:///var/run/docker.sock", "unix:/var/run/docker.sock"},
+		{"/relative", ""},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatalf("%s: %s", test.url, err)
+		}
+
+		if target := DependencyTarget(u); target != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.url, test.expected, target)
+		}
+	}
+
+	// url.Parse rejects escaped hosts, so http+unix URLs are built directly
+	for _, host := range []string{"/var/run/docker.sock", "%2Fvar%2Frun%2Fdocker.sock"} {
+		u := &url.URL{Scheme: "http+unix", Host: host, Path: "/containers/json"}
+		if target := DependencyTarget(u); target != "unix:/var/run/docker.sock" {
+			t.Errorf("%s: expected the socket path, got %q", host, target)
+		}
+	}
+}
+
+func TestHTTPDependencyTargetFallsBackToHostHeader(t *testing.T) {
+	rt := &instrumentedRoundTripper{}
+	req, _ := http.NewRequest("GET", "http://ignored/", nil)
+	req.URL.Host = ""
+	req.Host = "API.example.com:80"
+
+	dependency := rt.newDependency(req, nil, nil, time.Now(), 0)
+	if dependency.Target != "api.example.com" {
+		t.Errorf("Expected the Host header to be normalized, got %q", dependency.Target)
+	}
+}
@@ -0,0 +1,112 @@
+package appinsights
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Standard dependency types.  These are the exact strings recognized by the
+// Application Insights portal for icons, application map nodes, and
+// type-specific views.
+const (
+	DependencyTypeHTTP            = "HTTP"
+	DependencyTypeSQL             = "SQL"
+	DependencyTypeAzureBlob       = "Azure blob"
+	DependencyTypeAzureTable      = "Azure table"
+	DependencyTypeAzureQueue      = "Azure queue"
+	DependencyTypeAzureServiceBus = "Azure Service Bus"
+	DependencyTypeAzureEventHubs  = "Azure Event Hubs"
+	DependencyTypeAzureCosmosDB   = "Azure DocumentDB"
+	DependencyTypeAzureIotHub     = "Azure IoT Hub"
+	DependencyTypeAzureSearch     = "Azure Search"
+	DependencyTypeWebService      = "Web Service"
+	DependencyTypeWCFService      = "WCF Service"
+	DependencyTypeInProc          = "InProc"
+)
+
+var standardDependencyTypes = []string{
+	DependencyTypeHTTP,
+	DependencyTypeSQL,
+	DependencyTypeAzureBlob,
+	DependencyTypeAzureTable,
+	DependencyTypeAzureQueue,
+	DependencyTypeAzureServiceBus,
+	DependencyTypeAzureEventHubs,
+	DependencyTypeAzureCosmosDB,
+	DependencyTypeAzureIotHub,
+	DependencyTypeAzureSearch,
+	DependencyTypeWebService,
+	DependencyTypeWCFService,
+	DependencyTypeInProc,
+}
+
+// IsStandardDependencyType returns true if the dependency type is one of the
+// standard types, ignoring case.
+func IsStandardDependencyType(dependencyType string) bool {
+	_, ok := lookupStandardDependencyType(dependencyType)
+	return ok
+}
+
+// NormalizeDependencyType returns the canonical spelling of a standard
+// dependency type, ignoring case and surrounding whitespace.  Other types
+// are returned unchanged.
+func NormalizeDependencyType(dependencyType string) string {
+	if canonical, ok := lookupStandardDependencyType(dependencyType); ok {
+		return canonical
+	}
+
+	return dependencyType
+}
+
+func lookupStandardDependencyType(dependencyType string) (string, bool) {
+	trimmed := strings.TrimSpace(dependencyType)
+	for _, standard := range standardDependencyTypes {
+		if strings.EqualFold(trimmed, standard) {
+			return standard, true
+		}
+	}
+
+	return "", false
+}
+
+// NewInProcDependencyTelemetry creates a dependency telemetry item for an
+// internal sub-operation that runs within the current process.
+func NewInProcDependencyTelemetry(ctx context.Context, name string, success bool) *RemoteDependencyTelemetry {
+	return NewRemoteDependencyTelemetryWithContext(ctx, name, DependencyTypeInProc, "", success)
+}
+
+// TrackInProcDependency runs fn within a child span and tracks it as an
+// InProc dependency, so that internal sub-operations show up in the
+// end-to-end transaction view.  The dependency is marked as failed if fn
+// returns an error or panics.
+func TrackInProcDependency(ctx context.Context, name string, client ContextTracker, fn func(context.Context) error) error {
+	childCtx := WithChildSpan(ctx, name)
+	start := time.Now()
+
+	track := func(success bool, errorMessage string) {
+		dependency := NewInProcDependencyTelemetry(childCtx, name, success)
+		dependency.MarkTime(start, time.Now())
+		if errorMessage != "" {
+			dependency.Properties["error"] = errorMessage
+		}
+
+		client.TrackWithContext(childCtx, dependency)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			track(false, "panic")
+			panic(r) // re-throw the panic
+		}
+	}()
+
+	err := fn(childCtx)
+	if err != nil {
+		track(false, err.Error())
+	} else {
+		track(true, "")
+	}
+
+	return err
+}
@@ -0,0 +1,97 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestNormalizeDependencyType(t *testing.T) {
+	tests := map[string]string{
+		"sql":             DependencyTypeSQL,
+		" AZURE BLOB ":    DependencyTypeAzureBlob,
+		"http":            DependencyTypeHTTP,
+		"inproc":          DependencyTypeInProc,
+		"Custom Protocol": "Custom Protocol",
+	}
+
+	for input, expected := range tests {
+		if actual := NormalizeDependencyType(input); actual != expected {
+			t.Errorf("NormalizeDependencyType(%q): expected %q, got %q", input, expected, actual)
+		}
+	}
+
+	if !IsStandardDependencyType("azure service bus") {
+		t.Error("Expected Azure Service Bus to be a standard type")
+	}
+	if IsStandardDependencyType("Redis") {
+		t.Error("Expected Redis not to be a standard type")
+	}
+}
+
+func TestTrackInProcDependency(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	parent := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), parent)
+
+	var innerSpan string
+	err := TrackInProcDependency(ctx, "render-invoice", client, func(ctx context.Context) error {
+		innerSpan = GetCorrelationContext(ctx).SpanID
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	failure := errors.New("template missing")
+	if err := TrackInProcDependency(ctx, "render-receipt", client, func(context.Context) error { return failure }); err != failure {
+		t.Errorf("Expected the function's error to be returned, got %v", err)
+	}
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected 2 dependencies, got %d", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	data := envelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if data.Type != DependencyTypeInProc || data.Name != "render-invoice" || !data.Success {
+		t.Errorf("Unexpected dependency: %+v", data)
+	}
+	if data.Id != innerSpan {
+		t.Errorf("Expected dependency id %s to match the inner span %s", data.Id, innerSpan)
+	}
+	if envelope.Tags[contracts.OperationId] != parent.GetOperationID() || envelope.Tags[contracts.OperationParentId] != parent.SpanID {
+		t.Error("Expected dependency to be a child of the current operation")
+	}
+
+	data = testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if data.Success || data.Properties["error"] != "template missing" {
+		t.Errorf("Expected failed dependency with error, got %+v", data)
+	}
+}
+
+func TestTrackInProcDependencyPanic(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic to be re-thrown")
+		}
+
+		if testChannel.getSentCount() != 1 {
+			t.Fatalf("Expected 1 dependency, got %d", testChannel.getSentCount())
+		}
+
+		data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+		if data.Success {
+			t.Error("Expected panicking dependency to be failed")
+		}
+	}()
+
+	TrackInProcDependency(context.Background(), "explode", client, func(context.Context) error {
+		panic("boom")
+	})
+}
@@ -0,0 +1,72 @@
+package appinsights
+
+import "os"
+
+// DeploymentEventName is the name of the event tracked for each deployment.
+// Together with its category, it matches the events that Application
+// Insights release annotations are stored as, so that deployments show up as
+// markers in charts.
+const DeploymentEventName = "Annotation"
+
+// Properties of deployment events
+const (
+	// DeploymentCategoryProperty holds DeploymentCategory
+	DeploymentCategoryProperty = "Category"
+
+	// DeploymentVersionProperty holds the deployed version
+	DeploymentVersionProperty = "ReleaseName"
+
+	// DeploymentChangesetProperty holds the source control changeset of the
+	// deployed version, e.g. a commit hash
+	DeploymentChangesetProperty = "Changeset"
+)
+
+// DeploymentCategory is the annotation category of deployment events.
+const DeploymentCategory = "Deployment"
+
+// Environment variables read when TelemetryConfiguration.TrackDeploymentOnStartup
+// is set
+const (
+	DeploymentVersionEnvVar   = "APPINSIGHTS_DEPLOYMENT_VERSION"
+	DeploymentChangesetEnvVar = "APPINSIGHTS_DEPLOYMENT_CHANGESET"
+)
+
+// NewDeploymentTelemetry creates an event marking the deployment of version,
+// built from changeset, with the specified additional properties.  The
+// event's application version is set to the deployed version.
+func NewDeploymentTelemetry(version, changeset string, properties map[string]string) *EventTelemetry {
+	event := NewEventTelemetry(DeploymentEventName)
+	for k, v := range properties {
+		event.Properties[k] = v
+	}
+
+	event.Properties[DeploymentCategoryProperty] = DeploymentCategory
+	event.Properties[DeploymentVersionProperty] = version
+	if changeset != "" {
+		event.Properties[DeploymentChangesetProperty] = changeset
+	}
+
+	if version != "" {
+		event.Tags.Application().SetVer(version)
+	}
+
+	return event
+}
+
+// TrackDeployment logs the deployment of a version, built from a source
+// control changeset, as an event that charts show as a release marker.
+func TrackDeployment(client TelemetryClient, version, changeset string, properties map[string]string) {
+	client.Track(NewDeploymentTelemetry(version, changeset, properties))
+}
+
+// trackDeploymentFromEnvironment tracks a deployment event from the
+// deployment environment variables, if the version is set
+func trackDeploymentFromEnvironment(client TelemetryClient) {
+	version := os.Getenv(DeploymentVersionEnvVar)
+	if version == "" {
+		diagnosticsWriter.Printf("Not tracking deployment: %s is not set", DeploymentVersionEnvVar)
+		return
+	}
+
+	TrackDeployment(client, version, os.Getenv(DeploymentChangesetEnvVar), nil)
+}
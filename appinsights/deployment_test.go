@@ -0,0 +1,71 @@
+package appinsights
+
+import (
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestTrackDeployment(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	TrackDeployment(client, "1.4.2", "9fceb02", map[string]string{"environment": "prod", DeploymentCategoryProperty: "Other"})
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 event, got %d", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	event := envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Name != DeploymentEventName {
+		t.Errorf("Expected event %s, got %s", DeploymentEventName, event.Name)
+	}
+
+	expected := map[string]string{
+		DeploymentCategoryProperty:  DeploymentCategory,
+		DeploymentVersionProperty:   "1.4.2",
+		DeploymentChangesetProperty: "9fceb02",
+		"environment":               "prod",
+	}
+	for k, v := range expected {
+		if event.Properties[k] != v {
+			t.Errorf("Expected %s=%s, got %s", k, v, event.Properties[k])
+		}
+	}
+
+	if ver := envelope.Tags[contracts.ApplicationVersion]; ver != "1.4.2" {
+		t.Errorf("Expected application version 1.4.2, got %s", ver)
+	}
+}
+
+func TestTrackDeploymentOnStartup(t *testing.T) {
+	newClient := func() []*contracts.Envelope {
+		var tracked []*contracts.Envelope
+		config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+		config.TrackDeploymentOnStartup = true
+		config.OnTracked = func(envelope *contracts.Envelope) {
+			tracked = append(tracked, envelope)
+		}
+
+		client := NewTelemetryClientFromConfig(config)
+		client.Channel().Stop()
+		return tracked
+	}
+
+	t.Setenv(DeploymentVersionEnvVar, "")
+	if tracked := newClient(); len(tracked) != 0 {
+		t.Errorf("Expected no deployment without a version, got %d items", len(tracked))
+	}
+
+	t.Setenv(DeploymentVersionEnvVar, "2.0.0")
+	t.Setenv(DeploymentChangesetEnvVar, "abc123")
+	tracked := newClient()
+	if len(tracked) != 1 {
+		t.Fatalf("Expected a deployment event, got %d items", len(tracked))
+	}
+
+	event := tracked[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Properties[DeploymentVersionProperty] != "2.0.0" || event.Properties[DeploymentChangesetProperty] != "abc123" {
+		t.Errorf("Unexpected deployment properties: %v", event.Properties)
+	}
+}
@@ -0,0 +1,96 @@
+package appinsights
+
+import (
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// DiagnosticProperty is set to "true" on traces tracked with
+// TrackDiagnostic.
+const DiagnosticProperty = "diagnostic"
+
+// DefaultMaxDiagnosticsPerMinute is the number of diagnostic traces tracked
+// per minute when TelemetryConfiguration.MaxDiagnosticsPerMinute is zero.
+const DefaultMaxDiagnosticsPerMinute = 10
+
+// diagnosticLimiter enforces the rate limit of diagnostic traces over fixed
+// one-minute windows
+type diagnosticLimiter struct {
+	limit int
+
+	lock        sync.Mutex
+	windowStart time.Time
+	count       int
+	dropped     int
+}
+
+func newDiagnosticLimiter(limit int) *diagnosticLimiter {
+	if limit <= 0 {
+		limit = DefaultMaxDiagnosticsPerMinute
+	}
+
+	return &diagnosticLimiter{limit: limit}
+}
+
+// admit returns whether another diagnostic trace may be tracked
+func (limiter *diagnosticLimiter) admit() bool {
+	now := currentClock.Now()
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if now.Sub(limiter.windowStart) >= time.Minute {
+		if limiter.dropped > 0 {
+			diagnosticsWriter.Printf("Dropped %d diagnostic traces exceeding %d per minute", limiter.dropped, limiter.limit)
+		}
+
+		limiter.windowStart = now
+		limiter.count = 0
+		limiter.dropped = 0
+	}
+
+	if limiter.count >= limiter.limit {
+		limiter.dropped++
+		return false
+	}
+
+	limiter.count++
+	return true
+}
+
+// TrackDiagnostic logs a rare, high-value operational message, such as a
+// configuration reload or a failover, that bypasses sampling, essential
+// telemetry mode and operation budgets, and is retained first when the
+// channel is backlogged.  Diagnostic traces are limited to
+// MaxDiagnosticsPerMinute.  Clients not created by this package track the
+// message as an ordinary trace.
+func TrackDiagnostic(client TelemetryClient, message string, severity contracts.SeverityLevel) {
+	if tc, ok := client.(*telemetryClient); ok {
+		tc.trackDiagnostic(message, severity)
+		return
+	}
+
+	if client.IsEnabled() {
+		client.Track(newDiagnosticTrace(message, severity))
+	}
+}
+
+func (tc *telemetryClient) trackDiagnostic(message string, severity contracts.SeverityLevel) {
+	if !tc.IsEnabled() || IsTelemetryDisabled() || !tc.diagnostics.admit() {
+		return
+	}
+
+	envelope := tc.context.envelop(newDiagnosticTrace(message, severity))
+	SetEnvelopePriority(envelope, PriorityCritical)
+	bindDeliveryReceipts(envelope)
+	tc.send(envelope)
+}
+
+// newDiagnosticTrace creates a trace marked with DiagnosticProperty
+func newDiagnosticTrace(message string, severity contracts.SeverityLevel) *TraceTelemetry {
+	trace := NewTraceTelemetry(message, severity)
+	trace.Properties[DiagnosticProperty] = "true"
+	return trace
+}
@@ -0,0 +1,61 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestTrackDiagnostic(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	SetEssentialTelemetryOnly(true)
+	defer SetEssentialTelemetryOnly(false)
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SamplingProcessor = NewFixedRateSamplingProcessor(0)
+	config.MaxDiagnosticsPerMinute = 2
+	client, testChannel := newTestClient(config)
+
+	client.TrackTrace("sampled out", Information)
+	TrackDiagnostic(client, "configuration reloaded", Information)
+	TrackDiagnostic(client, "failed over to secondary", Warning)
+	TrackDiagnostic(client, "rate limited", Warning)
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected 2 diagnostic traces, got %d items", testChannel.getSentCount())
+	}
+
+	for i, message := range []string{"configuration reloaded", "failed over to secondary"} {
+		envelope := testChannel.sentItems[i]
+		data := envelope.Data.(*contracts.Data).BaseData.(*contracts.MessageData)
+		if data.Message != message || data.Properties[DiagnosticProperty] != "true" {
+			t.Errorf("Item %d: unexpected trace %q with properties %v", i, data.Message, data.Properties)
+		}
+		if EnvelopePriority(envelope) != PriorityCritical {
+			t.Errorf("Item %d: expected critical priority, got %d", i, EnvelopePriority(envelope))
+		}
+	}
+
+	// The limit applies per minute
+	fakeClock.Increment(time.Minute)
+	TrackDiagnostic(client, "recovered", Information)
+	if testChannel.getSentCount() != 3 {
+		t.Errorf("Expected a diagnostic trace in the next minute, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestTrackDiagnosticOtherClient(t *testing.T) {
+	var tracked []interface{}
+	client := &mockTelemetryClient{trackFunc: func(item interface{}) { tracked = append(tracked, item) }}
+
+	TrackDiagnostic(client, "configuration reloaded", Information)
+	if len(tracked) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(tracked))
+	}
+	if trace, ok := tracked[0].(*TraceTelemetry); !ok || trace.Properties[DiagnosticProperty] != "true" {
+		t.Errorf("Expected a diagnostic trace, got %#v", tracked[0])
+	}
+}
@@ -0,0 +1,424 @@
+package appinsights
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RequestDurationMetricName is the metric name used for aggregated request durations
+	RequestDurationMetricName = "requests/duration"
+
+	// DependencyDurationMetricName is the metric name used for aggregated dependency durations
+	DependencyDurationMetricName = "dependencies/duration"
+
+	// durationHistogramOverflowName groups operations beyond MaxOperations
+	durationHistogramOverflowName = "Other"
+)
+
+// DefaultDurationHistogramBuckets are the bucket upper bounds used when none are configured
+var DefaultDurationHistogramBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// DurationHistogramConfig configures per-operation latency histograms for
+// requests and dependencies. Durations are recorded before sampling, so the
+// flushed metrics are not biased by the sampling rate.
+type DurationHistogramConfig struct {
+	// Enabled controls whether duration histograms are collected
+	Enabled bool
+
+	// Buckets are the upper bounds of the histogram buckets, in ascending order
+	Buckets []time.Duration
+
+	// Percentiles to approximate on each flush (0-100)
+	Percentiles []float64
+
+	// Compression of the t-digest used to estimate percentiles.  When zero,
+	// percentiles are interpolated from the buckets instead, which is less
+	// accurate for values far from the bucket bounds.
+	TDigestCompression float64
+
+	// FlushInterval specifies how often histograms are emitted as metrics
+	FlushInterval time.Duration
+
+	// AlignToWallClock emits histograms on multiples of FlushInterval on
+	// the wall clock, so that windows line up across instances
+	AlignToWallClock bool
+
+	// MaxOperations limits the number of distinct operation names tracked per
+	// telemetry type; additional operations are grouped under "Other"
+	MaxOperations int
+
+	// TrackRequests enables histograms for request telemetry
+	TrackRequests bool
+
+	// TrackDependencies enables histograms for remote dependency telemetry
+	TrackDependencies bool
+}
+
+// NewDurationHistogramConfig creates a new configuration with default values
+func NewDurationHistogramConfig() *DurationHistogramConfig {
+	return &DurationHistogramConfig{
+		Enabled:            true,
+		Buckets:            DefaultDurationHistogramBuckets,
+		Percentiles:        []float64{50, 95, 99},
+		TDigestCompression: DefaultTDigestCompression,
+		FlushInterval:      60 * time.Second,
+		MaxOperations:      100,
+		TrackRequests:      true,
+		TrackDependencies:  true,
+	}
+}
+
+// DurationHistogramCollector aggregates request and dependency durations per
+// operation and periodically emits them as aggregated metrics.
+type DurationHistogramCollector struct {
+	client  TelemetryClient
+	config  DurationHistogramConfig
+	buckets []time.Duration
+
+	histograms map[durationHistogramKey]*durationHistogram
+	counts     map[string]int
+	mu         sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type durationHistogramKey struct {
+	metric string
+	name   string
+}
+
+// durationHistogram holds bucket counts and summary statistics for one operation
+type durationHistogram struct {
+	counts []int64
+	count  int64
+	failed int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+	sumSq  float64
+
+	// Percentile estimator, if enabled
+	digest *TDigest
+}
+
+// NewDurationHistogramCollector creates a new duration histogram collector
+func NewDurationHistogramCollector(client TelemetryClient, config *DurationHistogramConfig) *DurationHistogramCollector {
+	if config == nil {
+		config = NewDurationHistogramConfig()
+	}
+
+	cfg := *config
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 60 * time.Second
+	}
+	if cfg.MaxOperations <= 0 {
+		cfg.MaxOperations = 100
+	}
+	if len(cfg.Percentiles) == 0 {
+		cfg.Percentiles = []float64{50, 95, 99}
+	}
+
+	buckets := make([]time.Duration, len(cfg.Buckets))
+	copy(buckets, cfg.Buckets)
+	if len(buckets) == 0 {
+		buckets = append(buckets, DefaultDurationHistogramBuckets...)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	return &DurationHistogramCollector{
+		client:     client,
+		config:     cfg,
+		buckets:    buckets,
+		histograms: make(map[durationHistogramKey]*durationHistogram),
+		counts:     make(map[string]int),
+	}
+}
+
+// DurationHistograms returns the duration histogram collector of a client
+// created by this package, if enabled, and nil otherwise
+func DurationHistograms(client TelemetryClient) *DurationHistogramCollector {
+	if tc, ok := client.(*telemetryClient); ok {
+		return tc.durationHistograms
+	}
+
+	return nil
+}
+
+// Start begins periodic flushing of the histograms
+func (c *DurationHistogramCollector) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.config.Enabled || c.cancel != nil {
+		return // Not enabled or already running
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.wg.Add(1)
+	go c.flushLoop()
+}
+
+// Stop halts periodic flushing and emits any pending histograms
+func (c *DurationHistogramCollector) Stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		c.wg.Wait()
+	}
+
+	c.Flush()
+}
+
+// flushLoop runs the periodic flush of the histograms
+func (c *DurationHistogramCollector) flushLoop() {
+	defer c.wg.Done()
+
+	if c.config.AlignToWallClock {
+		if !waitForAlignment(c.ctx.Done(), c.config.FlushInterval) {
+			return
+		}
+		c.Flush()
+	}
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.Flush()
+		}
+	}
+}
+
+// Observe records the duration of a request or dependency telemetry item.
+// Other telemetry types are ignored.
+func (c *DurationHistogramCollector) Observe(item Telemetry) {
+	if c == nil || !c.config.Enabled {
+		return
+	}
+
+	switch telem := item.(type) {
+	case *RequestTelemetry:
+		if c.config.TrackRequests {
+			c.Record(RequestDurationMetricName, telem.Name, telem.Duration, telem.Success)
+		}
+	case *RemoteDependencyTelemetry:
+		if c.config.TrackDependencies {
+			c.Record(DependencyDurationMetricName, telem.Name, telem.Duration, telem.Success)
+		}
+	}
+}
+
+// Record adds a single duration observation for the specified metric and
+// operation name.
+func (c *DurationHistogramCollector) Record(metric, name string, duration time.Duration, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := durationHistogramKey{metric: metric, name: name}
+	hist, ok := c.histograms[key]
+	if !ok {
+		if c.counts[metric] >= c.config.MaxOperations {
+			key.name = durationHistogramOverflowName
+			hist, ok = c.histograms[key]
+		}
+
+		if !ok {
+			hist = &durationHistogram{counts: make([]int64, len(c.buckets)+1)}
+			if c.config.TDigestCompression > 0 {
+				hist.digest = NewTDigest(c.config.TDigestCompression)
+			}
+			c.histograms[key] = hist
+			c.counts[metric]++
+		}
+	}
+
+	hist.add(c.buckets, duration, success)
+}
+
+// Flush emits all pending histograms as aggregated metrics and resets them
+func (c *DurationHistogramCollector) Flush() {
+	c.mu.Lock()
+	histograms := c.histograms
+	c.histograms = make(map[durationHistogramKey]*durationHistogram)
+	c.counts = make(map[string]int)
+	c.mu.Unlock()
+
+	for key, hist := range histograms {
+		if hist.count == 0 {
+			continue
+		}
+
+		c.send(c.buildMetric(key, hist))
+	}
+}
+
+// send submits a histogram directly to the client's channel.  Like the
+// durations they summarize, histograms bypass sampling and the other
+// processing stages, which would otherwise keep or drop every flush of the
+// same metric together.
+func (c *DurationHistogramCollector) send(metric *AggregateMetricTelemetry) {
+	c.client.Channel().Send(c.client.Context().envelop(metric))
+}
+
+// buildMetric converts a histogram into an aggregated metric telemetry item
+func (c *DurationHistogramCollector) buildMetric(key durationHistogramKey, hist *durationHistogram) *AggregateMetricTelemetry {
+	count := float64(hist.count)
+	mean := toMilliseconds(hist.sum) / count
+
+	metric := NewAggregateMetricTelemetry(key.metric)
+	metric.Value = toMilliseconds(hist.sum)
+	metric.Count = int(hist.count)
+	metric.Min = toMilliseconds(hist.min)
+	metric.Max = toMilliseconds(hist.max)
+	if variance := hist.sumSq/count - mean*mean; variance > 0 {
+		metric.Variance = variance
+	}
+	metric.Properties["operation.name"] = key.name
+	metric.Properties["failedCount"] = strconv.FormatInt(hist.failed, 10)
+
+	for _, p := range c.config.Percentiles {
+		var value float64
+		if hist.digest != nil {
+			value = hist.digest.Quantile(p / 100)
+		} else {
+			value = hist.percentile(c.buckets, p)
+		}
+		metric.Properties["p"+strconv.FormatFloat(p, 'f', -1, 64)] = strconv.FormatFloat(value, 'f', 3, 64)
+	}
+
+	for i, bound := range c.buckets {
+		metric.Properties["bucket.le_"+bound.String()] = strconv.FormatInt(hist.counts[i], 10)
+	}
+	metric.Properties["bucket.le_inf"] = strconv.FormatInt(hist.counts[len(c.buckets)], 10)
+
+	return metric
+}
+
+// add records an observation in the histogram
+func (h *durationHistogram) add(buckets []time.Duration, duration time.Duration, success bool) {
+	idx := sort.Search(len(buckets), func(i int) bool { return duration <= buckets[i] })
+	h.counts[idx]++
+
+	if h.count == 0 || duration < h.min {
+		h.min = duration
+	}
+	if duration > h.max {
+		h.max = duration
+	}
+
+	h.count++
+	h.sum += duration
+	if !success {
+		h.failed++
+	}
+
+	ms := toMilliseconds(duration)
+	h.sumSq += ms * ms
+
+	if h.digest != nil {
+		h.digest.Add(ms)
+	}
+}
+
+// percentile approximates the pth percentile in milliseconds by linear
+// interpolation within the bucket containing the target rank.
+func (h *durationHistogram) percentile(buckets []time.Duration, p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	if p <= 0 {
+		return toMilliseconds(h.min)
+	}
+	if p >= 100 {
+		return toMilliseconds(h.max)
+	}
+
+	target := p / 100.0 * float64(h.count)
+	var cumulative int64
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+
+		if float64(cumulative+n) >= target {
+			lower := h.min
+			if i > 0 && buckets[i-1] > lower {
+				lower = buckets[i-1]
+			}
+
+			upper := h.max
+			if i < len(buckets) && buckets[i] < upper {
+				upper = buckets[i]
+			}
+
+			fraction := (target - float64(cumulative)) / float64(n)
+			return toMilliseconds(lower) + fraction*toMilliseconds(upper-lower)
+		}
+
+		cumulative += n
+	}
+
+	return toMilliseconds(h.max)
+}
+
+// toMilliseconds converts a duration to fractional milliseconds, the unit
+// used by the portal for duration metrics.
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// collectorChannel wraps a client's channel so that closing or stopping it
+// also stops the client's periodic collectors, emitting their pending
+// aggregates before the channel shuts down.
+type collectorChannel struct {
+	TelemetryChannel
+	client *telemetryClient
+}
+
+func (channel *collectorChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	channel.stopCollectors()
+	return channel.TelemetryChannel.Close(retryTimeout...)
+}
+
+func (channel *collectorChannel) Stop() {
+	channel.stopCollectors()
+	channel.TelemetryChannel.Stop()
+}
+
+func (channel *collectorChannel) stopCollectors() {
+	if channel.client.durationHistograms != nil {
+		channel.client.durationHistograms.Stop()
+	}
+
+	if channel.client.dependencySummaries != nil {
+		channel.client.dependencySummaries.Stop()
+	}
+}
@@ -0,0 +1,262 @@
+package appinsights
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newHistogramTestClient(config *DurationHistogramConfig, samplingRate float64) (TelemetryClient, *TestTelemetryChannel) {
+	telemetryConfig := NewTelemetryConfiguration("InstrumentationKey=test-key")
+	telemetryConfig.SamplingProcessor = NewFixedRateSamplingProcessor(samplingRate)
+	client, testChannel := newTestClient(telemetryConfig)
+	client.(*telemetryClient).durationHistograms = NewDurationHistogramCollector(client, config)
+
+	return client, testChannel
+}
+
+func findHistogramMetric(t *testing.T, items []*contracts.Envelope, metricName, operation string) (*contracts.DataPoint, map[string]string) {
+	for _, envelope := range items {
+		data, ok := envelope.Data.(*contracts.Data)
+		if !ok {
+			continue
+		}
+
+		metricData, ok := data.BaseData.(*contracts.MetricData)
+		if !ok || len(metricData.Metrics) == 0 {
+			continue
+		}
+
+		if metricData.Metrics[0].Name == metricName && metricData.Properties["operation.name"] == operation {
+			return metricData.Metrics[0], metricData.Properties
+		}
+	}
+
+	t.Fatalf("Metric %s for operation %s not found", metricName, operation)
+	return nil, nil
+}
+
+func TestDurationHistogramConfigDefaults(t *testing.T) {
+	config := NewDurationHistogramConfig()
+
+	if !config.Enabled || !config.TrackRequests || !config.TrackDependencies {
+		t.Error("Expected histograms to be enabled for requests and dependencies by default")
+	}
+	if len(config.Buckets) != len(DefaultDurationHistogramBuckets) {
+		t.Errorf("Expected %d default buckets, got %d", len(DefaultDurationHistogramBuckets), len(config.Buckets))
+	}
+	if config.FlushInterval != 60*time.Second {
+		t.Errorf("Expected flush interval of 60s, got %v", config.FlushInterval)
+	}
+}
+
+func TestDurationHistogramFlushEmitsAggregates(t *testing.T) {
+	client, channel := newHistogramTestClient(NewDurationHistogramConfig(), 100)
+	collector := DurationHistograms(client)
+
+	for i := 1; i <= 10; i++ {
+		request := NewRequestTelemetry("GET", "http://example.com/api", time.Duration(i*10)*time.Millisecond, "200")
+		client.Track(request)
+	}
+
+	failed := NewRequestTelemetry("GET", "http://example.com/api", 100*time.Millisecond, "500")
+	client.Track(failed)
+
+	channel.reset()
+	collector.Flush()
+
+	if channel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 aggregated metric, got %d", channel.getSentCount())
+	}
+
+	dataPoint, props := findHistogramMetric(t, channel.sentItems, RequestDurationMetricName, "GET http://example.com/api")
+	if dataPoint.Count != 11 {
+		t.Errorf("Expected count 11, got %d", dataPoint.Count)
+	}
+	if dataPoint.Kind != contracts.Aggregation {
+		t.Error("Expected aggregation data point")
+	}
+	if dataPoint.Min != 10 || dataPoint.Max != 100 {
+		t.Errorf("Unexpected min/max: %f/%f", dataPoint.Min, dataPoint.Max)
+	}
+	if dataPoint.Value != 650 {
+		t.Errorf("Expected sum of 650ms, got %f", dataPoint.Value)
+	}
+	if props["failedCount"] != "1" {
+		t.Errorf("Expected failedCount 1, got %s", props["failedCount"])
+	}
+	for _, key := range []string{"p50", "p95", "p99", "bucket.le_inf"} {
+		if _, ok := props[key]; !ok {
+			t.Errorf("Expected property %s", key)
+		}
+	}
+
+	// Histograms reset after a flush
+	channel.reset()
+	collector.Flush()
+	if channel.getSentCount() != 0 {
+		t.Errorf("Expected no metrics after reset, got %d", channel.getSentCount())
+	}
+}
+
+func TestDurationHistogramRecordsBeforeSampling(t *testing.T) {
+	client, channel := newHistogramTestClient(NewDurationHistogramConfig(), 0)
+
+	for i := 0; i < 20; i++ {
+		dependency := NewRemoteDependencyTelemetry("SELECT users", "SQL", "db", true)
+		dependency.Duration = 30 * time.Millisecond
+		client.Track(dependency)
+	}
+
+	if channel.getSentCount() != 0 {
+		t.Fatalf("Expected all dependencies to be sampled out, got %d", channel.getSentCount())
+	}
+
+	// The aggregate itself bypasses sampling
+	DurationHistograms(client).Flush()
+
+	dataPoint, _ := findHistogramMetric(t, channel.sentItems, DependencyDurationMetricName, "SELECT users")
+	if dataPoint.Count != 20 {
+		t.Errorf("Expected all 20 dependencies to be counted, got %d", dataPoint.Count)
+	}
+	if rate := channel.sentItems[0].SampleRate; rate != 100 {
+		t.Errorf("Expected the histogram not to be stamped with a sampling rate, got %v", rate)
+	}
+}
+
+func TestDurationHistogramMaxOperations(t *testing.T) {
+	config := NewDurationHistogramConfig()
+	config.MaxOperations = 2
+	client, channel := newHistogramTestClient(config, 100)
+	collector := DurationHistograms(client)
+
+	for i := 0; i < 5; i++ {
+		collector.Record(RequestDurationMetricName, "op"+strconv.Itoa(i), time.Millisecond, true)
+	}
+
+	collector.Flush()
+
+	if channel.getSentCount() != 3 {
+		t.Fatalf("Expected 2 operations plus overflow, got %d", channel.getSentCount())
+	}
+
+	dataPoint, _ := findHistogramMetric(t, channel.sentItems, RequestDurationMetricName, durationHistogramOverflowName)
+	if dataPoint.Count != 3 {
+		t.Errorf("Expected 3 overflow observations, got %d", dataPoint.Count)
+	}
+}
+
+func TestDurationHistogramTDigestPercentiles(t *testing.T) {
+	// 99 requests at 600ms and one at 1s share the (500ms, 1s] bucket
+	record := func(config *DurationHistogramConfig) map[string]string {
+		client, channel := newHistogramTestClient(config, 100)
+		collector := DurationHistograms(client)
+		for i := 0; i < 99; i++ {
+			collector.Record(RequestDurationMetricName, "op", 600*time.Millisecond, true)
+		}
+		collector.Record(RequestDurationMetricName, "op", time.Second, true)
+		collector.Flush()
+
+		_, props := findHistogramMetric(t, channel.sentItems, RequestDurationMetricName, "op")
+		return props
+	}
+
+	if props := record(NewDurationHistogramConfig()); props["p50"] != "600.000" || props["p95"] != "600.000" {
+		t.Errorf("Expected exact percentiles from the digest, got p50=%s p95=%s", props["p50"], props["p95"])
+	}
+
+	// Bucket interpolation spreads values across the bucket
+	config := NewDurationHistogramConfig()
+	config.TDigestCompression = 0
+	if props := record(config); props["p50"] == "600.000" {
+		t.Errorf("Expected an interpolated p50, got %s", props["p50"])
+	}
+}
+
+func TestDurationHistogramPercentileApproximation(t *testing.T) {
+	buckets := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	hist := &durationHistogram{counts: make([]int64, len(buckets)+1)}
+
+	for i := 1; i <= 100; i++ {
+		// Uniform distribution between 0.4ms and 40ms
+		hist.add(buckets, time.Duration(i)*400*time.Microsecond, true)
+	}
+
+	tests := []struct {
+		percentile float64
+		expected   float64
+	}{
+		{0, 0.4},
+		{25, 10},
+		{50, 20},
+		{75, 30},
+		{100, 40},
+	}
+
+	for _, tst := range tests {
+		value := hist.percentile(buckets, tst.percentile)
+		if math.Abs(value-tst.expected) > 1.0 {
+			t.Errorf("p%v: expected ~%v, got %v", tst.percentile, tst.expected, value)
+		}
+	}
+}
+
+func TestDurationHistogramIgnoresOtherTelemetry(t *testing.T) {
+	client, channel := newHistogramTestClient(NewDurationHistogramConfig(), 100)
+
+	client.TrackEvent("event")
+	client.TrackTrace("trace", Information)
+	channel.reset()
+
+	DurationHistograms(client).Flush()
+	if channel.getSentCount() != 0 {
+		t.Errorf("Expected no histogram metrics, got %d", channel.getSentCount())
+	}
+}
+
+func TestDurationHistogramDisabledByDefault(t *testing.T) {
+	client := NewTelemetryClient("test-key")
+	if DurationHistograms(client) != nil {
+		t.Error("Expected no duration histogram collector without configuration")
+	}
+}
+
+func TestDurationHistogramStartStop(t *testing.T) {
+	config := NewDurationHistogramConfig()
+	config.FlushInterval = 10 * time.Millisecond
+	client, channel := newHistogramTestClient(config, 100)
+	collector := DurationHistograms(client)
+
+	collector.Start()
+	collector.Record(RequestDurationMetricName, "op", time.Millisecond, true)
+	time.Sleep(50 * time.Millisecond)
+	collector.Stop()
+
+	if channel.getSentCount() != 1 {
+		t.Errorf("Expected periodic flush to emit 1 metric, got %d", channel.getSentCount())
+	}
+}
+
+func TestDurationHistogramStoppedWithChannel(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
+	config.DurationHistograms = NewDurationHistogramConfig()
+	client := NewTelemetryClientFromConfig(config).(*telemetryClient)
+
+	testChannel := &TestTelemetryChannel{}
+	wrapper := client.channel.(*collectorChannel)
+	wrapper.TelemetryChannel.Stop()
+	wrapper.TelemetryChannel = testChannel
+
+	DurationHistograms(client).Record(RequestDurationMetricName, "op", time.Millisecond, true)
+	<-client.Channel().Close()
+
+	if client.durationHistograms.cancel != nil {
+		t.Error("Expected closing the channel to stop periodic flushing")
+	}
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected pending histograms to be emitted on close, got %d items", testChannel.getSentCount())
+	}
+}
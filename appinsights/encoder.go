@@ -0,0 +1,74 @@
+package appinsights
+
+import (
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Encoder serializes batches of envelopes.  Custom channels, such as ones
+// publishing to Kafka or writing files, can use an Encoder to choose their
+// wire format; the ingestion channel always uses JSONEncoder.  Encoders run
+// any deferred envelope finalizers before encoding, and must be safe for
+// concurrent use.
+type Encoder interface {
+	// ContentType returns the MIME type of encoded batches.
+	ContentType() string
+
+	// Encode appends the encoding of the envelopes to dst.  Envelopes that
+	// fail to encode are skipped and reported through diagnostics.
+	Encode(dst []byte, envelopes []*contracts.Envelope) []byte
+}
+
+// JSONEncoder encodes batches as newline-delimited JSON, the format of the
+// ingestion endpoint.
+type JSONEncoder struct{}
+
+// ContentType returns the MIME type of newline-delimited JSON.
+func (JSONEncoder) ContentType() string {
+	return "application/x-json-stream"
+}
+
+// Encode appends each envelope's JSON encoding to dst, followed by a
+// newline.
+func (JSONEncoder) Encode(dst []byte, envelopes []*contracts.Envelope) []byte {
+	for _, envelope := range envelopes {
+		end := len(dst)
+		FinalizeEnvelope(envelope)
+
+		var err error
+		if dst, err = envelope.AppendJSON(dst); err != nil {
+			diagnosticsWriter.Printf("Telemetry item failed to serialize: %s", err.Error())
+			dst = dst[:end]
+			continue
+		}
+
+		dst = append(dst, '\n')
+	}
+
+	return dst
+}
+
+// MessagePackEncoder encodes batches as a stream of MessagePack maps, one
+// per envelope, with the same keys as the JSON encoding.  It is more
+// compact than JSON and cheaper to decode for internal telemetry buses.
+type MessagePackEncoder struct{}
+
+// ContentType returns the MIME type of MessagePack.
+func (MessagePackEncoder) ContentType() string {
+	return "application/msgpack"
+}
+
+// Encode appends each envelope's MessagePack encoding to dst.
+func (MessagePackEncoder) Encode(dst []byte, envelopes []*contracts.Envelope) []byte {
+	for _, envelope := range envelopes {
+		end := len(dst)
+		FinalizeEnvelope(envelope)
+
+		var err error
+		if dst, err = envelope.AppendMessagePack(dst); err != nil {
+			diagnosticsWriter.Printf("Telemetry item failed to serialize: %s", err.Error())
+			dst = dst[:end]
+		}
+	}
+
+	return dst
+}
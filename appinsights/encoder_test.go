@@ -0,0 +1,155 @@
+package appinsights
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONEncoder(t *testing.T) {
+	items := telemetryBuffer(NewEventTelemetry("first"), NewTraceTelemetry("second", Warning))
+
+	encoded := JSONEncoder{}.Encode([]byte("prefix\n"), items)
+	lines := strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "prefix" {
+		t.Fatalf("Expected the envelopes to be appended as lines, got %q", encoded)
+	}
+	if !bytes.Equal(encoded[len("prefix\n"):], items.serialize()) {
+		t.Error("Expected the channel's serialization to match the JSON encoder")
+	}
+}
+
+func TestMessagePackEncoder(t *testing.T) {
+	event := NewEventTelemetry("event")
+	event.Properties["long"] = strings.Repeat("x", 300)
+	event.Measurements["ratio"] = 0.25
+	event.Measurements["count"] = -70000
+	items := telemetryBuffer(event, NewTraceTelemetry("trace", Error))
+	items = append(items, serializerTestBuffer()...)
+
+	var expected []interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(items.serialize()), []byte("\n")) {
+		var document interface{}
+		json.Unmarshal(line, &document)
+		expected = append(expected, document)
+	}
+
+	encoded := MessagePackEncoder{}.Encode(nil, items)
+	var decoded []interface{}
+	for len(encoded) > 0 {
+		var value interface{}
+		value, encoded = decodeMessagePack(t, encoded)
+		decoded = append(decoded, value)
+	}
+
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected the MessagePack encoding to match JSON:\n%v\n%v", decoded, expected)
+	}
+}
+
+func TestMessagePackEncoderWritesFloats(t *testing.T) {
+	event := NewEventTelemetry("event")
+	event.Measurements["whole"] = 1.0
+
+	// Integral values of float fields are still written as float64
+	encoded := MessagePackEncoder{}.Encode(nil, telemetryBuffer(event))
+	expected := append([]byte("\xa5whole\xcb"), binary.BigEndian.AppendUint64(nil, math.Float64bits(1.0))...)
+	if !bytes.Contains(encoded, expected) {
+		t.Error("Expected the measurement to be encoded as a float64")
+	}
+	if !bytes.Contains(encoded, []byte("\xaasampleRate\xcb")) {
+		t.Error("Expected the sample rate to be encoded as a float64")
+	}
+}
+
+func BenchmarkMessagePackEncoder(b *testing.B) {
+	buffer := benchmarkSerializerBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		dst = MessagePackEncoder{}.Encode(dst[:0], buffer)
+	}
+}
+
+// decodeMessagePack decodes the formats written by MessagePackEncoder into
+// the types produced by encoding/json
+func decodeMessagePack(t *testing.T, data []byte) (interface{}, []byte) {
+	format, data := data[0], data[1:]
+	length := func(size int) (int, []byte) {
+		switch size {
+		case 1:
+			return int(data[0]), data[1:]
+		case 2:
+			return int(binary.BigEndian.Uint16(data)), data[2:]
+		default:
+			return int(binary.BigEndian.Uint32(data)), data[4:]
+		}
+	}
+
+	var n int
+	switch {
+	case format <= 0x7f:
+		return float64(format), data
+	case format >= 0xe0:
+		return float64(int8(format)), data
+	case format == 0xc0:
+		return nil, data
+	case format == 0xc2 || format == 0xc3:
+		return format == 0xc3, data
+	case format == 0xd2:
+		return float64(int32(binary.BigEndian.Uint32(data))), data[4:]
+	case format == 0xd3:
+		return float64(int64(binary.BigEndian.Uint64(data))), data[8:]
+	case format == 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:]
+	case format&0xe0 == 0xa0:
+		n = int(format & 0x1f)
+	case format == 0xd9:
+		n, data = length(1)
+	case format == 0xda:
+		n, data = length(2)
+	case format == 0xdb:
+		n, data = length(4)
+	case format&0xf0 == 0x90, format == 0xdc, format == 0xdd:
+		switch format {
+		case 0xdc:
+			n, data = length(2)
+		case 0xdd:
+			n, data = length(4)
+		default:
+			n = int(format & 0x0f)
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			array[i], data = decodeMessagePack(t, data)
+		}
+		return array, data
+	case format&0xf0 == 0x80, format == 0xde, format == 0xdf:
+		switch format {
+		case 0xde:
+			n, data = length(2)
+		case 0xdf:
+			n, data = length(4)
+		default:
+			n = int(format & 0x0f)
+		}
+		object := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			var key, value interface{}
+			key, data = decodeMessagePack(t, data)
+			value, data = decodeMessagePack(t, data)
+			object[key.(string)] = value
+		}
+		return object, data
+	default:
+		t.Fatalf("Unexpected format 0x%x", format)
+	}
+
+	return string(data[:n]), data[n:]
+}
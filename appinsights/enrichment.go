@@ -0,0 +1,356 @@
+package appinsights
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Enricher adds the results of a lookup, such as the location of a client
+// IP or the host name of a dependency target, to the custom properties of
+// envelopes.  Lookups are cached by key and run under the time budget of
+// an EnrichmentConfig.
+type Enricher interface {
+	// Key returns the lookup key of the envelope, or an empty string if the
+	// envelope needn't be enriched.
+	Key(envelope *contracts.Envelope) string
+
+	// Lookup returns the properties to add to envelopes with the key.  It
+	// should return promptly once ctx is done.
+	Lookup(ctx context.Context, key string) (map[string]string, error)
+}
+
+// EnrichmentConfig configures the enrichment of kept envelopes before they
+// are sent to the channel.  Lookups that miss the cache run in the
+// background: an envelope waits for them at most Budget, and is otherwise
+// sent as is while the result is cached for later envelopes.
+type EnrichmentConfig struct {
+	// Enrichers applied to each envelope, in order
+	Enrichers []Enricher
+
+	// Maximum time an envelope waits for lookups.  Defaults to 5ms.
+	Budget time.Duration
+
+	// Maximum duration of a single lookup.  Defaults to 2s.
+	LookupTimeout time.Duration
+
+	// How long lookup results are cached.  Failed lookups are cached for
+	// a tenth of this.  Defaults to 10 minutes.
+	CacheTTL time.Duration
+
+	// Maximum number of cached results per enricher.  Defaults to 10000.
+	MaxCacheEntries int
+
+	// Maximum number of concurrent lookups.  Envelopes that would need
+	// more are sent without waiting.  Defaults to 8.
+	MaxConcurrentLookups int
+}
+
+// NewEnrichmentConfig creates an enrichment configuration with default
+// values for the specified enrichers.
+func NewEnrichmentConfig(enrichers ...Enricher) *EnrichmentConfig {
+	return &EnrichmentConfig{
+		Enrichers:            enrichers,
+		Budget:               5 * time.Millisecond,
+		LookupTimeout:        2 * time.Second,
+		CacheTTL:             10 * time.Minute,
+		MaxCacheEntries:      10000,
+		MaxConcurrentLookups: 8,
+	}
+}
+
+type enrichmentEntry struct {
+	values  map[string]string
+	expires time.Time
+
+	// Closed once the lookup completes
+	done chan struct{}
+}
+
+type enrichmentCache struct {
+	enricher Enricher
+	entries  map[string]*enrichmentEntry
+}
+
+// enrichmentStage applies enrichers to envelopes within a time budget
+type enrichmentStage struct {
+	config  EnrichmentConfig
+	lock    sync.Mutex
+	caches  []*enrichmentCache
+	lookups chan struct{}
+}
+
+func newEnrichmentStage(config *EnrichmentConfig) *enrichmentStage {
+	if config == nil || len(config.Enrichers) == 0 {
+		return nil
+	}
+
+	stage := &enrichmentStage{config: *config}
+	defaults := NewEnrichmentConfig()
+	if stage.config.Budget <= 0 {
+		stage.config.Budget = defaults.Budget
+	}
+	if stage.config.LookupTimeout <= 0 {
+		stage.config.LookupTimeout = defaults.LookupTimeout
+	}
+	if stage.config.CacheTTL <= 0 {
+		stage.config.CacheTTL = defaults.CacheTTL
+	}
+	if stage.config.MaxCacheEntries <= 0 {
+		stage.config.MaxCacheEntries = defaults.MaxCacheEntries
+	}
+	if stage.config.MaxConcurrentLookups <= 0 {
+		stage.config.MaxConcurrentLookups = defaults.MaxConcurrentLookups
+	}
+
+	stage.lookups = make(chan struct{}, stage.config.MaxConcurrentLookups)
+	for _, enricher := range stage.config.Enrichers {
+		stage.caches = append(stage.caches, &enrichmentCache{enricher, make(map[string]*enrichmentEntry)})
+	}
+
+	return stage
+}
+
+// enrich adds the results of the enrichers' lookups to the envelope,
+// waiting at most the budget for lookups in progress
+func (stage *enrichmentStage) enrich(envelope *contracts.Envelope) {
+	if stage == nil {
+		return
+	}
+
+	properties := envelopeProperties(envelope)
+	if properties == nil {
+		return
+	}
+
+	var deadline <-chan time.Time
+	for _, cache := range stage.caches {
+		key := cache.enricher.Key(envelope)
+		if key == "" {
+			continue
+		}
+
+		entry := stage.entry(cache, key)
+		if entry == nil {
+			continue
+		}
+
+		select {
+		case <-entry.done:
+		default:
+			if deadline == nil {
+				timer := time.NewTimer(stage.config.Budget)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+
+			select {
+			case <-entry.done:
+			case <-deadline:
+				diagnosticsWriter.Printf("Enrichment lookup of %q exceeded the budget", key)
+				continue
+			}
+		}
+
+		for name, value := range entry.values {
+			if _, ok := properties[name]; !ok {
+				properties[name] = value
+			}
+		}
+	}
+}
+
+// entry returns the cached entry of key, starting a lookup if needed.
+// Returns nil if no lookup slot is available.
+func (stage *enrichmentStage) entry(cache *enrichmentCache, key string) *enrichmentEntry {
+	stage.lock.Lock()
+	defer stage.lock.Unlock()
+
+	now := currentClock.Now()
+	if entry, ok := cache.entries[key]; ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return entry
+	}
+
+	select {
+	case stage.lookups <- struct{}{}:
+	default:
+		return nil
+	}
+
+	if len(cache.entries) >= stage.config.MaxCacheEntries {
+		stage.evict(cache, now)
+	}
+
+	entry := &enrichmentEntry{done: make(chan struct{})}
+	cache.entries[key] = entry
+	go stage.lookup(cache.enricher, key, entry)
+	return entry
+}
+
+// evict removes expired entries, or an arbitrary completed entry if none
+// have expired
+func (stage *enrichmentStage) evict(cache *enrichmentCache, now time.Time) {
+	var completed string
+	for key, entry := range cache.entries {
+		if entry.expires.IsZero() {
+			continue
+		}
+		if !now.Before(entry.expires) {
+			delete(cache.entries, key)
+		} else {
+			completed = key
+		}
+	}
+
+	if len(cache.entries) >= stage.config.MaxCacheEntries && completed != "" {
+		delete(cache.entries, completed)
+	}
+}
+
+func (stage *enrichmentStage) lookup(enricher Enricher, key string, entry *enrichmentEntry) {
+	defer func() { <-stage.lookups }()
+
+	defer enterTelemetryCallback()()
+
+	ctx, cancel := context.WithTimeout(SuppressTelemetry(context.Background()), stage.config.LookupTimeout)
+	defer cancel()
+
+	values, err := safeLookup(ctx, enricher, key)
+	ttl := stage.config.CacheTTL
+	if err != nil {
+		diagnosticsWriter.Printf("Enrichment lookup of %q failed: %s", key, err)
+		values, ttl = nil, ttl/10
+	}
+
+	stage.lock.Lock()
+	entry.values = values
+	entry.expires = currentClock.Now().Add(ttl)
+	stage.lock.Unlock()
+
+	close(entry.done)
+}
+
+// safeLookup recovers from panics in enrichers, which run on their own
+// goroutine
+func safeLookup(ctx context.Context, enricher Enricher, key string) (values map[string]string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			diagnosticsWriter.Printf("Enrichment lookup of %q panicked: %v", key, r)
+			values = nil
+		}
+	}()
+
+	return enricher.Lookup(ctx, key)
+}
+
+// GeoLocation is the location of an IP address returned by a GeoIPLookup.
+type GeoLocation struct {
+	Country  string
+	Province string
+	City     string
+}
+
+// GeoIPLookup resolves the location of an IP address, typically from a
+// local GeoIP database.
+type GeoIPLookup func(ctx context.Context, ip net.IP) (GeoLocation, error)
+
+// Properties added by NewGeoIPEnricher
+const (
+	GeoCountryProperty  = "client.country"
+	GeoProvinceProperty = "client.province"
+	GeoCityProperty     = "client.city"
+)
+
+type geoIPEnricher struct {
+	lookup GeoIPLookup
+}
+
+// NewGeoIPEnricher creates an enricher recording the location of the
+// client IP of envelopes, from the ai.location.ip tag, as properties.
+func NewGeoIPEnricher(lookup GeoIPLookup) Enricher {
+	return &geoIPEnricher{lookup}
+}
+
+func (enricher *geoIPEnricher) Key(envelope *contracts.Envelope) string {
+	return envelope.Tags[contracts.LocationIp]
+}
+
+func (enricher *geoIPEnricher) Lookup(ctx context.Context, key string) (map[string]string, error) {
+	ip := net.ParseIP(key)
+	if ip == nil {
+		return nil, nil
+	}
+
+	location, err := enricher.lookup(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for name, value := range map[string]string{
+		GeoCountryProperty:  location.Country,
+		GeoProvinceProperty: location.Province,
+		GeoCityProperty:     location.City,
+	} {
+		if value != "" {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// DependencyTargetHostProperty is added by NewReverseDNSEnricher.
+const DependencyTargetHostProperty = "dependency.targetHost"
+
+type reverseDNSEnricher struct {
+	resolver *net.Resolver
+}
+
+// NewReverseDNSEnricher creates an enricher recording the host name of
+// dependencies whose target is an IP address.  resolver may be nil to use
+// the default resolver.
+func NewReverseDNSEnricher(resolver *net.Resolver) Enricher {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &reverseDNSEnricher{resolver}
+}
+
+func (enricher *reverseDNSEnricher) Key(envelope *contracts.Envelope) string {
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok {
+		return ""
+	}
+
+	dependency, ok := data.BaseData.(*contracts.RemoteDependencyData)
+	if !ok {
+		return ""
+	}
+
+	host := dependency.Target
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+
+	return host
+}
+
+func (enricher *reverseDNSEnricher) Lookup(ctx context.Context, key string) (map[string]string, error) {
+	names, err := enricher.resolver.LookupAddr(ctx, key)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	return map[string]string{DependencyTargetHostProperty: strings.TrimSuffix(names[0], ".")}, nil
+}
@@ -0,0 +1,118 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestGeoIPEnrichment(t *testing.T) {
+	var lookups int
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.Enrichment = NewEnrichmentConfig(NewGeoIPEnricher(func(ctx context.Context, ip net.IP) (GeoLocation, error) {
+		lookups++
+		return GeoLocation{Country: "Norway", City: "Oslo"}, nil
+	}))
+	config.Enrichment.Budget = time.Second
+
+	client, testChannel := newTestClient(config)
+
+	for i := 0; i < 2; i++ {
+		request := NewRequestTelemetry("GET", "https://example.com/", time.Second, "200")
+		request.Tags.Location().SetIp("198.51.100.2")
+		client.Track(request)
+	}
+	client.TrackTrace("no client IP", Information)
+
+	for i, envelope := range testChannel.sentItems[:2] {
+		properties := envelopeProperties(envelope)
+		if properties[GeoCountryProperty] != "Norway" || properties[GeoCityProperty] != "Oslo" {
+			t.Errorf("Item %d: expected the location, got %v", i, properties)
+		}
+		if _, ok := properties[GeoProvinceProperty]; ok {
+			t.Errorf("Item %d: expected no empty province", i)
+		}
+	}
+	if properties := envelopeProperties(testChannel.sentItems[2]); len(properties) != 0 {
+		t.Errorf("Expected the trace not to be enriched, got %v", properties)
+	}
+	if lookups != 1 {
+		t.Errorf("Expected the lookup to be cached, got %d lookups", lookups)
+	}
+}
+
+type slowEnricher struct {
+	release chan struct{}
+	err     error
+}
+
+func (enricher *slowEnricher) Key(envelope *contracts.Envelope) string {
+	return "key"
+}
+
+func (enricher *slowEnricher) Lookup(ctx context.Context, key string) (map[string]string, error) {
+	<-enricher.release
+	return map[string]string{"slow": "done"}, enricher.err
+}
+
+func TestEnrichmentBudget(t *testing.T) {
+	enricher := &slowEnricher{release: make(chan struct{})}
+	config := NewEnrichmentConfig(enricher)
+	config.Budget = time.Millisecond
+	stage := newEnrichmentStage(config)
+
+	envelope := NewTelemetryContext(test_ikey).envelop(NewEventTelemetry("event"))
+	start := time.Now()
+	stage.enrich(envelope)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected enrichment to give up after the budget, took %s", elapsed)
+	}
+	if _, ok := envelopeProperties(envelope)["slow"]; ok {
+		t.Error("Expected the envelope to be sent without waiting for the lookup")
+	}
+
+	// Later envelopes get the cached result
+	close(enricher.release)
+	<-stage.caches[0].entries["key"].done
+
+	envelope = NewTelemetryContext(test_ikey).envelop(NewEventTelemetry("event"))
+	stage.enrich(envelope)
+	if envelopeProperties(envelope)["slow"] != "done" {
+		t.Error("Expected the cached result")
+	}
+}
+
+func TestEnrichmentFailureIsCachedBriefly(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	enricher := &slowEnricher{release: make(chan struct{}), err: errors.New("unavailable")}
+	close(enricher.release)
+	stage := newEnrichmentStage(NewEnrichmentConfig(enricher))
+
+	stage.enrich(NewTelemetryContext(test_ikey).envelop(NewEventTelemetry("event")))
+	entry := stage.caches[0].entries["key"]
+	<-entry.done
+	if entry.values != nil || entry.expires.Sub(currentClock.Now()) != time.Minute {
+		t.Errorf("Expected the failure to be cached for a minute, got %v until %s", entry.values, entry.expires)
+	}
+}
+
+func TestReverseDNSEnricherKey(t *testing.T) {
+	enricher := NewReverseDNSEnricher(nil)
+	for target, expected := range map[string]string{
+		"10.0.0.1:5432":    "10.0.0.1",
+		"[2001:db8::1]":    "2001:db8::1",
+		"db.example.com":   "",
+		"db.example.com:5": "",
+	} {
+		dependency := NewRemoteDependencyTelemetry("query", "SQL", target, true)
+		if key := enricher.Key(NewTelemetryContext(test_ikey).envelop(dependency)); key != expected {
+			t.Errorf("%s: expected %q, got %q", target, expected, key)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package appinsights
+
+import (
+	"sync/atomic"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// EnvelopeFinalizer is invoked on an envelope just before it is serialized
+// for transmission.  It can be used to attach information that is not known
+// when the telemetry is tracked, such as final sampling metadata or a role
+// name that is resolved later.
+type EnvelopeFinalizer func(envelope *contracts.Envelope)
+
+// FinalizationToken represents a finalizer that has been registered on an
+// envelope.  It can be used to cancel the finalizer if the information it
+// would provide is no longer needed.
+type FinalizationToken struct {
+	finalizer EnvelopeFinalizer
+
+	// Set once the finalizer has run, been released or been canceled
+	done atomic.Bool
+}
+
+// DeferFinalization registers a finalizer to run on the envelope just before
+// it is serialized.  Finalizers run in the order they were registered.  They
+// are typically registered by a SamplingProcessor, which sees every envelope
+// before it is sent to the channel.  Finalizers of envelopes that are
+// discarded by sampling or by the channel are released without running.
+//
+// Finalizers are stored on the envelope itself, so those of an envelope that
+// is never serialized are collected along with it.  Channels other than
+// InMemoryChannel must call FinalizeEnvelope before serializing an envelope.
+// Like other changes to an envelope, DeferFinalization must not be called
+// concurrently for the same envelope.
+func DeferFinalization(envelope *contracts.Envelope, finalizer EnvelopeFinalizer) *FinalizationToken {
+	token := &FinalizationToken{finalizer: finalizer}
+
+	if envelope == nil || finalizer == nil {
+		token.done.Store(true)
+		return token
+	}
+
+	envelope.Finalizers = append(envelope.Finalizers, envelopeFinalizer{token})
+	return token
+}
+
+// Cancel prevents the finalizer from running.  Returns false if the
+// finalizer has already run or been released.
+func (token *FinalizationToken) Cancel() bool {
+	return token.done.CompareAndSwap(false, true)
+}
+
+// FinalizeEnvelope runs and releases any finalizers registered on the
+// envelope.  Each finalizer runs at most once.
+func FinalizeEnvelope(envelope *contracts.Envelope) {
+	for _, finalizer := range takeFinalizers(envelope) {
+		finalizer.Finalize(envelope)
+	}
+}
+
+// releaseFinalizers discards the finalizers registered on an envelope that
+// will not be transmitted, and completes its delivery receipts
+func releaseFinalizers(envelope *contracts.Envelope) {
+	for _, finalizer := range takeFinalizers(envelope) {
+		finalizer.Release()
+	}
+
+	completeDelivery(envelope, ErrDeliveryDropped)
+}
+
+// takeFinalizers removes and returns the finalizers registered on the
+// envelope
+func takeFinalizers(envelope *contracts.Envelope) []contracts.Finalizer {
+	if envelope == nil {
+		return nil
+	}
+
+	finalizers := envelope.Finalizers
+	envelope.Finalizers = nil
+	return finalizers
+}
+
+// envelopeFinalizer adapts a FinalizationToken to contracts.Finalizer
+// without exporting the methods on the token itself
+type envelopeFinalizer struct {
+	token *FinalizationToken
+}
+
+func (f envelopeFinalizer) Finalize(envelope *contracts.Envelope) {
+	if !f.token.done.CompareAndSwap(false, true) {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			diagnosticsWriter.Printf("Envelope finalizer panicked: %v", r)
+		}
+	}()
+
+	f.token.finalizer(envelope)
+}
+
+func (f envelopeFinalizer) Release() {
+	f.token.done.Store(true)
+}
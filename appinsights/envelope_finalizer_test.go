@@ -0,0 +1,150 @@
+package appinsights
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// finalizingSamplingProcessor registers a finalizer on every envelope before
+// delegating the sampling decision.
+type finalizingSamplingProcessor struct {
+	SamplingProcessor
+	finalizer EnvelopeFinalizer
+	tokens    []*FinalizationToken
+}
+
+func (p *finalizingSamplingProcessor) ShouldSample(envelope *contracts.Envelope) bool {
+	p.tokens = append(p.tokens, DeferFinalization(envelope, p.finalizer))
+	return p.SamplingProcessor.ShouldSample(envelope)
+}
+
+func TestFinalizerRunsBeforeSerialization(t *testing.T) {
+	roleName := "unresolved"
+
+	envelope := telemetryBuffer(NewTraceTelemetry("msg", Information))[0]
+	DeferFinalization(envelope, func(e *contracts.Envelope) {
+		e.Tags[contracts.CloudRole] = roleName
+	})
+
+	// Resolved after tracking, but before serialization
+	roleName = "late-role"
+
+	j, err := parsePayload(telemetryBufferItems{envelope}.serialize())
+	if err != nil {
+		t.Fatalf("Error parsing payload: %s", err.Error())
+	}
+
+	tags := j[0]["tags"].(map[string]interface{})
+	if tags[contracts.CloudRole] != "late-role" {
+		t.Errorf("Expected late-resolved role name, got %v", tags[contracts.CloudRole])
+	}
+	if len(envelope.Finalizers) != 0 {
+		t.Error("Expected finalizer to be released after running")
+	}
+}
+
+func TestFinalizerOrderAndCancel(t *testing.T) {
+	envelope := contracts.NewEnvelope()
+	var calls []string
+
+	DeferFinalization(envelope, func(*contracts.Envelope) { calls = append(calls, "first") })
+	canceled := DeferFinalization(envelope, func(*contracts.Envelope) { calls = append(calls, "canceled") })
+	DeferFinalization(envelope, func(*contracts.Envelope) { calls = append(calls, "second") })
+
+	if !canceled.Cancel() {
+		t.Error("Expected cancel to succeed")
+	}
+	if canceled.Cancel() {
+		t.Error("Expected second cancel to fail")
+	}
+
+	FinalizeEnvelope(envelope)
+	FinalizeEnvelope(envelope)
+
+	if strings.Join(calls, ",") != "first,second" {
+		t.Errorf("Unexpected finalizer calls: %v", calls)
+	}
+}
+
+func TestFinalizerPanicIsRecovered(t *testing.T) {
+	envelope := contracts.NewEnvelope()
+	ran := false
+
+	DeferFinalization(envelope, func(*contracts.Envelope) { panic("boom") })
+	DeferFinalization(envelope, func(*contracts.Envelope) { ran = true })
+
+	FinalizeEnvelope(envelope)
+
+	if !ran {
+		t.Error("Expected remaining finalizers to run after a panic")
+	}
+}
+
+func TestFinalizerFromSamplingProcessor(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	client, transmitter := newTestChannelServer()
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	client.(*telemetryClient).samplingProcessor = &finalizingSamplingProcessor{
+		SamplingProcessor: NewFixedRateSamplingProcessor(100),
+		finalizer: func(e *contracts.Envelope) {
+			e.Data.(*contracts.Data).BaseData.(*contracts.MessageData).Properties["finalized"] = "yes"
+		},
+	}
+
+	client.TrackTrace("~msg~", Information)
+	transmitter.prepResponse(200)
+	client.Channel().Flush()
+
+	req := transmitter.waitForRequest(t)
+	if !strings.Contains(req.payload, `"finalized":"yes"`) {
+		t.Errorf("Expected finalizer output in payload: %s", req.payload)
+	}
+}
+
+func TestFinalizerReleasedWhenSampledOut(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ran := false
+	processor := &finalizingSamplingProcessor{
+		SamplingProcessor: NewFixedRateSamplingProcessor(0),
+		finalizer:         func(*contracts.Envelope) { ran = true },
+	}
+	client.(*telemetryClient).samplingProcessor = processor
+
+	client.TrackEvent("dropped")
+
+	if testChannel.getSentCount() != 0 {
+		t.Error("Expected event to be sampled out")
+	}
+	if len(processor.tokens) != 1 || processor.tokens[0].Cancel() {
+		t.Error("Expected finalizer to be released")
+	}
+	if ran {
+		t.Error("Expected finalizer not to run")
+	}
+}
+
+func TestFinalizerStoredOnEnvelope(t *testing.T) {
+	envelope := contracts.NewEnvelope()
+	token := DeferFinalization(envelope, func(*contracts.Envelope) {})
+
+	// Nothing outside the envelope refers to it, so an envelope that is
+	// never serialized does not leak
+	if len(envelope.Finalizers) != 1 {
+		t.Fatalf("Expected the finalizer to be stored on the envelope, got %d", len(envelope.Finalizers))
+	}
+
+	releaseFinalizers(envelope)
+	if len(envelope.Finalizers) != 0 {
+		t.Error("Expected released finalizers to be removed from the envelope")
+	}
+	if token.Cancel() {
+		t.Error("Expected cancel to fail after release")
+	}
+}
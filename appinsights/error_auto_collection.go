@@ -105,6 +105,12 @@ func (eac *ErrorAutoCollector) TrackError(err interface{}) {
 
 // TrackErrorWithContext tracks an error with context, applying filtering and sanitization
 func (eac *ErrorAutoCollector) TrackErrorWithContext(ctx context.Context, err interface{}) {
+	eac.trackError(ctx, err, false)
+}
+
+// trackError tracks an error, with the details of the panic if it was
+// recovered from one
+func (eac *ErrorAutoCollector) trackError(ctx context.Context, err interface{}, panicked bool) {
 	if !eac.IsEnabled() || err == nil {
 		return
 	}
@@ -115,10 +121,15 @@ func (eac *ErrorAutoCollector) TrackErrorWithContext(ctx context.Context, err in
 	}
 
 	// Create exception telemetry with enhanced stack trace
-	exceptionTelemetry := eac.createExceptionTelemetry(err, 2)
+	exceptionTelemetry := eac.createExceptionTelemetry(err, 3)
 	
 	// Apply sanitizers
 	exceptionTelemetry = eac.sanitizeException(exceptionTelemetry)
+
+	// Panic details are taken from the sanitized value
+	if panicked {
+		applyPanicDetails(exceptionTelemetry, exceptionTelemetry.Error, false)
+	}
 	
 	// Track the exception
 	if ctx == context.Background() {
@@ -152,7 +163,7 @@ func (eac *ErrorAutoCollector) RecoverPanicWithContext(ctx context.Context, fn f
 	defer func() {
 		if r := recover(); r != nil {
 			if eac.IsEnabled() && eac.config.EnablePanicRecovery {
-				eac.TrackErrorWithContext(ctx, r)
+				eac.trackError(ctx, r, true)
 			} else {
 				// Re-panic if panic recovery is disabled
 				panic(r)
@@ -219,7 +230,13 @@ func (eac *ErrorAutoCollector) getErrorString(err interface{}) string {
 
 // createExceptionTelemetry creates enhanced exception telemetry with better stack traces
 func (eac *ErrorAutoCollector) createExceptionTelemetry(err interface{}, skip int) *ExceptionTelemetry {
-	frames := eac.getEnhancedCallstack(skip + 1)
+	// Prefer the stack of where the error was created, if it carries one
+	frames := StackOf(err)
+	if frames == nil {
+		frames = eac.getEnhancedCallstack(skip + 1)
+	} else if eac.config.MaxStackFrames > 0 && len(frames) > eac.config.MaxStackFrames {
+		frames = frames[:eac.config.MaxStackFrames]
+	}
 	
 	return &ExceptionTelemetry{
 		Error:         err,
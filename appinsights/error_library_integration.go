@@ -93,6 +93,13 @@ func (eli *ErrorLibraryIntegration) getErrorMessage(err interface{}) string {
 func (eli *ErrorLibraryIntegration) extractStackTrace(err interface{}, info *EnhancedErrorInfo) {
 	// Try to extract stack trace using different interfaces
 
+	// Check for stack providers and adapted error libraries anywhere in
+	// the chain
+	if frames := StackOf(err); frames != nil {
+		info.StackFrames = frames
+		return
+	}
+
 	// Check for errors with stack trace (like pkg/errors)
 	if stackErr, ok := err.(ErrorWithStack); ok {
 		info.StackFrames = eli.convertStackTrace(stackErr.StackTrace())
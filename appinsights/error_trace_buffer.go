@@ -0,0 +1,199 @@
+package appinsights
+
+import (
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// RetainedOnErrorProperty is set on items that were sampled out but kept
+// because their operation failed.
+const RetainedOnErrorProperty = "retainedOnError"
+
+// ErrorTraceBufferConfig configures the retention of sampled-out telemetry
+// of failed operations.  Items sampled out within an operation are held in
+// a small buffer per operation; if the operation's request fails, the
+// request and the held items are kept, so that the full trace of failures
+// is available even at low sampling rates.  Otherwise the held items are
+// discarded when the request completes.
+type ErrorTraceBufferConfig struct {
+	// Maximum number of items held per operation.  The oldest items are
+	// discarded first.  Defaults to 50.
+	MaxItemsPerOperation int
+
+	// Maximum number of operations with held items.  The buffer of the
+	// oldest operation is discarded first.  Defaults to 1000.
+	MaxOperations int
+
+	// How long the items of an operation are held if its request is never
+	// tracked.  Defaults to one minute.
+	MaxAge time.Duration
+}
+
+// NewErrorTraceBufferConfig creates a new configuration with default values.
+func NewErrorTraceBufferConfig() *ErrorTraceBufferConfig {
+	return &ErrorTraceBufferConfig{
+		MaxItemsPerOperation: 50,
+		MaxOperations:        1000,
+		MaxAge:               time.Minute,
+	}
+}
+
+// operationTraceBuffer holds the sampled-out items of an operation
+type operationTraceBuffer struct {
+	started time.Time
+	items   []*contracts.Envelope
+}
+
+// errorTraceBuffer holds sampled-out items per operation until the
+// operation's request is tracked.
+type errorTraceBuffer struct {
+	config ErrorTraceBufferConfig
+
+	lock       sync.Mutex
+	operations map[string]*operationTraceBuffer
+
+	// Operation IDs in the order their buffers were created
+	order []string
+}
+
+func newErrorTraceBuffer(config *ErrorTraceBufferConfig) *errorTraceBuffer {
+	if config == nil {
+		return nil
+	}
+
+	defaults := NewErrorTraceBufferConfig()
+	resolved := *config
+	if resolved.MaxItemsPerOperation <= 0 {
+		resolved.MaxItemsPerOperation = defaults.MaxItemsPerOperation
+	}
+	if resolved.MaxOperations <= 0 {
+		resolved.MaxOperations = defaults.MaxOperations
+	}
+	if resolved.MaxAge <= 0 {
+		resolved.MaxAge = defaults.MaxAge
+	}
+
+	return &errorTraceBuffer{
+		config:     resolved,
+		operations: make(map[string]*operationTraceBuffer),
+	}
+}
+
+// hold buffers an envelope that was sampled out, and returns whether it was
+// held.  Envelopes outside of an operation and requests are not held.
+func (buffer *errorTraceBuffer) hold(envelope *contracts.Envelope) bool {
+	if buffer == nil {
+		return false
+	}
+
+	operationID := envelope.Tags[contracts.OperationId]
+	if operationID == "" || isRequestEnvelope(envelope) {
+		return false
+	}
+
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	buffer.expire()
+
+	operation, ok := buffer.operations[operationID]
+	if !ok {
+		if len(buffer.order) >= buffer.config.MaxOperations {
+			buffer.discard(buffer.order[0])
+		}
+
+		operation = &operationTraceBuffer{started: currentClock.Now()}
+		buffer.operations[operationID] = operation
+		buffer.order = append(buffer.order, operationID)
+	}
+
+	if len(operation.items) >= buffer.config.MaxItemsPerOperation {
+		releaseFinalizers(operation.items[0])
+		operation.items = operation.items[1:]
+	}
+
+	operation.items = append(operation.items, envelope)
+	return true
+}
+
+// complete ends the operation of a request envelope.  If the request
+// failed, it returns true with the items held for the operation, which
+// should be kept along with the request.  Otherwise the held items are
+// discarded.
+func (buffer *errorTraceBuffer) complete(envelope *contracts.Envelope) (bool, []*contracts.Envelope) {
+	if buffer == nil || !isRequestEnvelope(envelope) {
+		return false, nil
+	}
+
+	request := envelope.Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	operationID := envelope.Tags[contracts.OperationId]
+
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if request.Success {
+		buffer.discard(operationID)
+		return false, nil
+	}
+
+	var held []*contracts.Envelope
+	if operation, ok := buffer.operations[operationID]; ok {
+		held = operation.items
+		buffer.remove(operationID)
+	}
+
+	return true, held
+}
+
+// expire discards the buffers of operations older than MaxAge.  Must be
+// called with the lock held.
+func (buffer *errorTraceBuffer) expire() {
+	cutoff := currentClock.Now().Add(-buffer.config.MaxAge)
+	for len(buffer.order) > 0 && buffer.operations[buffer.order[0]].started.Before(cutoff) {
+		buffer.discard(buffer.order[0])
+	}
+}
+
+// discard drops the items held for an operation.  Must be called with the
+// lock held.
+func (buffer *errorTraceBuffer) discard(operationID string) {
+	if operation, ok := buffer.operations[operationID]; ok {
+		for _, item := range operation.items {
+			releaseFinalizers(item)
+		}
+
+		buffer.remove(operationID)
+	}
+}
+
+// remove forgets an operation.  Must be called with the lock held.
+func (buffer *errorTraceBuffer) remove(operationID string) {
+	delete(buffer.operations, operationID)
+	for i, id := range buffer.order {
+		if id == operationID {
+			buffer.order = append(buffer.order[:i], buffer.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func isRequestEnvelope(envelope *contracts.Envelope) bool {
+	if data, ok := envelope.Data.(*contracts.Data); ok {
+		_, ok := data.BaseData.(*contracts.RequestData)
+		return ok
+	}
+
+	return false
+}
+
+// retainOnError marks an envelope that is kept because its operation
+// failed.  It represents only itself, whatever its sampling rate.
+func retainOnError(envelope *contracts.Envelope) {
+	envelope.SampleRate = 1.0
+
+	if properties := envelopeProperties(envelope); properties != nil {
+		properties[RetainedOnErrorProperty] = "true"
+	}
+}
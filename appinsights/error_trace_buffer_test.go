@@ -0,0 +1,82 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newErrorTraceBufferClient(config *ErrorTraceBufferConfig) (TelemetryClient, *TestTelemetryChannel) {
+	telemetryConfig := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	telemetryConfig.SamplingProcessor = NewFixedRateSamplingProcessor(0)
+	telemetryConfig.ErrorTraceBuffer = config
+	return newTestClient(telemetryConfig)
+}
+
+func trackOperation(client TelemetryClient, traces int, responseCode string) {
+	ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	for i := 0; i < traces; i++ {
+		client.TrackTraceWithContext(ctx, "message", Information)
+	}
+
+	client.TrackWithContext(ctx, NewRequestTelemetryWithContext(ctx, "GET", "/", time.Second, responseCode))
+}
+
+func TestErrorTraceBufferRetainsFailedOperations(t *testing.T) {
+	config := NewErrorTraceBufferConfig()
+	config.MaxItemsPerOperation = 2
+	client, testChannel := newErrorTraceBufferClient(config)
+
+	trackOperation(client, 3, "200")
+	if testChannel.getSentCount() != 0 {
+		t.Fatalf("Expected successful operations to be sampled out, got %d items", testChannel.getSentCount())
+	}
+
+	trackOperation(client, 3, "500")
+	if testChannel.getSentCount() != 3 {
+		t.Fatalf("Expected the request and 2 held traces, got %d items", testChannel.getSentCount())
+	}
+
+	for _, envelope := range testChannel.sentItems {
+		if envelope.SampleRate != 1 || envelopeProperties(envelope)[RetainedOnErrorProperty] != "true" {
+			t.Errorf("Expected %s to be marked as retained, got rate %v", envelope.Name, envelope.SampleRate)
+		}
+	}
+
+	if _, ok := testChannel.sentItems[2].Data.(*contracts.Data).BaseData.(*contracts.RequestData); !ok {
+		t.Error("Expected the held traces to be sent before the request")
+	}
+}
+
+func TestErrorTraceBufferExpiry(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	config := NewErrorTraceBufferConfig()
+	config.MaxAge = time.Minute
+	buffer := newErrorTraceBuffer(config)
+
+	context := NewTelemetryContext(test_ikey)
+	trace := context.envelop(NewTraceTelemetry("message", Information))
+	trace.Tags[contracts.OperationId] = "first"
+	if !buffer.hold(trace) {
+		t.Fatal("Expected the trace to be held")
+	}
+
+	fakeClock.Increment(2 * time.Minute)
+
+	other := context.envelop(NewTraceTelemetry("message", Information))
+	other.Tags[contracts.OperationId] = "second"
+	buffer.hold(other)
+
+	request := context.envelop(NewRequestTelemetry("GET", "/", time.Second, "500"))
+	request.Tags[contracts.OperationId] = "first"
+	if failed, held := buffer.complete(request); !failed || len(held) != 0 {
+		t.Errorf("Expected the expired operation to hold nothing, got %d items", len(held))
+	}
+	if len(buffer.operations) != 1 {
+		t.Errorf("Expected only the second operation to be held, got %d", len(buffer.operations))
+	}
+}
@@ -0,0 +1,54 @@
+package appinsights
+
+import (
+	"sync/atomic"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// HeartbeatMetricName is the name of the metric used to report that an
+// application is alive.  Heartbeats are essential telemetry.
+const HeartbeatMetricName = "HeartbeatState"
+
+var essentialTelemetryOnly atomic.Bool
+
+// SetEssentialTelemetryOnly switches all telemetry clients into or out of
+// essential telemetry mode.  While enabled, only failed requests,
+// exceptions, and heartbeats are submitted; all other telemetry is dropped
+// before sampling.  This is intended as a cost control during incidents,
+// and can be toggled at any time.
+func SetEssentialTelemetryOnly(enabled bool) {
+	if essentialTelemetryOnly.Swap(enabled) != enabled {
+		diagnosticsWriter.Printf("Essential telemetry only mode: %t", enabled)
+	}
+}
+
+// IsEssentialTelemetryOnly returns whether essential telemetry mode is
+// enabled.
+func IsEssentialTelemetryOnly() bool {
+	return essentialTelemetryOnly.Load()
+}
+
+// IsEssentialTelemetry returns whether an envelope is kept in essential
+// telemetry mode: failed requests, exceptions, and heartbeats.
+func IsEssentialTelemetry(envelope *contracts.Envelope) bool {
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok {
+		return false
+	}
+
+	switch baseData := data.BaseData.(type) {
+	case *contracts.ExceptionData:
+		return true
+	case *contracts.RequestData:
+		return !baseData.Success
+	case *contracts.MetricData:
+		for _, point := range baseData.Metrics {
+			if point.Name == HeartbeatMetricName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
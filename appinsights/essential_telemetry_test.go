@@ -0,0 +1,53 @@
+package appinsights
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestEssentialTelemetryOnly(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	trackAll := func() {
+		client.TrackEvent("event")
+		client.TrackTrace("trace", Error)
+		client.TrackMetric("cpu", 12)
+		client.TrackMetric(HeartbeatMetricName, 0)
+		client.TrackRemoteDependency("dep", "HTTP", "example.com", false)
+		client.TrackRequest("GET", "https://example.com/ok", time.Second, "200")
+		client.TrackRequest("GET", "https://example.com/fail", time.Second, "500")
+		client.TrackException(errors.New("boom"))
+	}
+
+	SetEssentialTelemetryOnly(true)
+	defer SetEssentialTelemetryOnly(false)
+
+	if !IsEssentialTelemetryOnly() {
+		t.Fatal("Expected essential telemetry mode to be enabled")
+	}
+
+	trackAll()
+	if testChannel.getSentCount() != 3 {
+		t.Fatalf("Expected 3 essential items, got %d", testChannel.getSentCount())
+	}
+
+	if metric := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.MetricData); metric.Metrics[0].Name != HeartbeatMetricName {
+		t.Errorf("Expected heartbeat to be kept, got %s", metric.Metrics[0].Name)
+	}
+	if request := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.RequestData); request.Success {
+		t.Error("Expected only the failed request to be kept")
+	}
+	if _, ok := testChannel.sentItems[2].Data.(*contracts.Data).BaseData.(*contracts.ExceptionData); !ok {
+		t.Error("Expected exception to be kept")
+	}
+
+	// Toggling off restores normal tracking
+	SetEssentialTelemetryOnly(false)
+	trackAll()
+	if testChannel.getSentCount() != 11 {
+		t.Errorf("Expected all items after disabling, got %d total", testChannel.getSentCount())
+	}
+}
@@ -0,0 +1,121 @@
+package appinsights
+
+import (
+	"strconv"
+	"sync"
+)
+
+// EventSchemaVersionProperty is the property holding the schema version of
+// versioned custom events.
+const EventSchemaVersionProperty = "ver"
+
+// EventMigration upgrades an event from one schema version to the next,
+// e.g. by renaming properties or converting measurements.
+type EventMigration func(event *EventTelemetry)
+
+// EventVersioning stamps custom events with the version of their schema
+// and upgrades events emitted by call sites still using previous versions.
+// Set it as TelemetryConfiguration.EventVersioning to apply it to every
+// tracked event; events whose name isn't registered are left unchanged.
+//
+//	versioning := appinsights.NewEventVersioning()
+//	versioning.Register("checkout", 2)
+//	versioning.AddMigration("checkout", 1, func(event *appinsights.EventTelemetry) {
+//		event.Properties["cartId"] = event.Properties["cart"]
+//		delete(event.Properties, "cart")
+//	})
+type EventVersioning struct {
+	lock    sync.RWMutex
+	schemas map[string]*eventSchema
+}
+
+type eventSchema struct {
+	version    int
+	migrations map[int]EventMigration
+}
+
+// NewEventVersioning creates an empty set of event schemas.
+func NewEventVersioning() *EventVersioning {
+	return &EventVersioning{
+		schemas: make(map[string]*eventSchema),
+	}
+}
+
+// Register declares the current schema version of the named event.
+func (versioning *EventVersioning) Register(name string, version int) {
+	versioning.lock.Lock()
+	defer versioning.lock.Unlock()
+
+	if schema, ok := versioning.schemas[name]; ok {
+		schema.version = version
+	} else {
+		versioning.schemas[name] = &eventSchema{version: version, migrations: make(map[int]EventMigration)}
+	}
+}
+
+// AddMigration registers a hook upgrading the named event from version
+// from to version from+1.  Events are upgraded through each registered
+// migration in turn until they reach the current version.
+func (versioning *EventVersioning) AddMigration(name string, from int, migrate EventMigration) {
+	versioning.lock.Lock()
+	defer versioning.lock.Unlock()
+
+	schema, ok := versioning.schemas[name]
+	if !ok {
+		schema = &eventSchema{migrations: make(map[int]EventMigration)}
+		versioning.schemas[name] = schema
+	}
+
+	schema.migrations[from] = migrate
+}
+
+// NewEvent creates an event telemetry item stamped with the current
+// schema version of the named event.
+func (versioning *EventVersioning) NewEvent(name string) *EventTelemetry {
+	event := NewEventTelemetry(name)
+	versioning.Apply(event)
+	return event
+}
+
+// Apply stamps an event without a version with the current version of its
+// schema, and upgrades events carrying a previous version.  Events with an
+// unparseable version, or that can't be upgraded because a migration is
+// missing, keep the version they were emitted with.
+func (versioning *EventVersioning) Apply(event *EventTelemetry) {
+	versioning.lock.RLock()
+	defer versioning.lock.RUnlock()
+
+	schema, ok := versioning.schemas[event.Name]
+	if !ok || schema.version == 0 {
+		return
+	}
+
+	if event.Properties == nil {
+		event.Properties = make(map[string]string)
+	}
+
+	current := strconv.Itoa(schema.version)
+	emitted, ok := event.Properties[EventSchemaVersionProperty]
+	if !ok {
+		event.Properties[EventSchemaVersionProperty] = current
+		return
+	}
+
+	version, err := strconv.Atoi(emitted)
+	if err != nil {
+		diagnosticsWriter.Printf("Event %q has invalid schema version %q", event.Name, emitted)
+		return
+	}
+
+	for ; version < schema.version; version++ {
+		migrate, ok := schema.migrations[version]
+		if !ok {
+			diagnosticsWriter.Printf("Event %q has no migration from schema version %d", event.Name, version)
+			break
+		}
+
+		migrate(event)
+	}
+
+	event.Properties[EventSchemaVersionProperty] = strconv.Itoa(version)
+}
@@ -0,0 +1,76 @@
+package appinsights
+
+import (
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestEventVersioningMigrations(t *testing.T) {
+	versioning := NewEventVersioning()
+	versioning.Register("checkout", 3)
+	versioning.AddMigration("checkout", 1, func(event *EventTelemetry) {
+		event.Properties["cartId"] = event.Properties["cart"]
+		delete(event.Properties, "cart")
+	})
+	versioning.AddMigration("checkout", 2, func(event *EventTelemetry) {
+		event.Measurements["total"] = event.Measurements["totalCents"] / 100
+		delete(event.Measurements, "totalCents")
+	})
+
+	if event := versioning.NewEvent("checkout"); event.Properties[EventSchemaVersionProperty] != "3" {
+		t.Errorf("Expected the current version, got %q", event.Properties[EventSchemaVersionProperty])
+	}
+
+	old := NewEventTelemetry("checkout")
+	old.Properties[EventSchemaVersionProperty] = "1"
+	old.Properties["cart"] = "c-42"
+	old.Measurements["totalCents"] = 1250
+	versioning.Apply(old)
+	if old.Properties[EventSchemaVersionProperty] != "3" || old.Properties["cartId"] != "c-42" || old.Measurements["total"] != 12.5 {
+		t.Errorf("Expected the event to be upgraded, got %v %v", old.Properties, old.Measurements)
+	}
+	if _, ok := old.Properties["cart"]; ok {
+		t.Error("Expected the old property to be removed")
+	}
+
+	// Without a migration path the emitted version is kept where it stopped
+	versioning.Register("signup", 2)
+	signup := NewEventTelemetry("signup")
+	signup.Properties[EventSchemaVersionProperty] = "1"
+	versioning.Apply(signup)
+	if signup.Properties[EventSchemaVersionProperty] != "1" {
+		t.Errorf("Expected version 1 to be kept, got %q", signup.Properties[EventSchemaVersionProperty])
+	}
+
+	unregistered := NewEventTelemetry("other")
+	versioning.Apply(unregistered)
+	if _, ok := unregistered.Properties[EventSchemaVersionProperty]; ok {
+		t.Error("Expected unregistered events to be left alone")
+	}
+}
+
+func TestEventVersioningConfiguration(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.EventVersioning = NewEventVersioning()
+	config.EventVersioning.Register("checkout", 2)
+	config.EventVersioning.AddMigration("checkout", 1, func(event *EventTelemetry) {
+		event.Properties["migrated"] = "true"
+	})
+	client, testChannel := newTestClient(config)
+
+	client.TrackEvent("checkout")
+	old := NewEventTelemetry("checkout")
+	old.Properties[EventSchemaVersionProperty] = "1"
+	client.Track(old)
+
+	first := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if first.Properties[EventSchemaVersionProperty] != "2" {
+		t.Errorf("Expected version 2, got %v", first.Properties)
+	}
+
+	second := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if second.Properties[EventSchemaVersionProperty] != "2" || second.Properties["migrated"] != "true" {
+		t.Errorf("Expected the event to be migrated, got %v", second.Properties)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
-	"strings"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
@@ -23,20 +22,30 @@ type ExceptionTelemetry struct {
 
 	// Severity level.
 	SeverityLevel contracts.SeverityLevel
+
+	// Identifier grouping exceptions into problems.  Leave empty to let
+	// the service derive it from the type and call stack.
+	ProblemId string
 }
 
 // Creates a new exception telemetry item with the specified error and the
 // current callstack. This should be used directly from a function that
 // handles a recover(), or to report an unexpected error return value from
-// a function.
+// a function.  If the error carries the stack trace of where it was created,
+// as found by StackOf, that stack is used instead.
 func NewExceptionTelemetry(err interface{}) *ExceptionTelemetry {
 	return newExceptionTelemetry(err, 1)
 }
 
 func newExceptionTelemetry(err interface{}, skip int) *ExceptionTelemetry {
+	frames := StackOf(err)
+	if frames == nil {
+		frames = GetCallstack(2 + skip)
+	}
+
 	return &ExceptionTelemetry{
 		Error:         err,
-		Frames:        GetCallstack(2 + skip),
+		Frames:        frames,
 		SeverityLevel: Error,
 		BaseTelemetry: BaseTelemetry{
 			Timestamp:  currentClock.Now(),
@@ -66,6 +75,9 @@ func (telem *ExceptionTelemetry) TelemetryData() TelemetryData {
 	} else if stringer, ok := telem.Error.(fmt.GoStringer); ok {
 		details.Message = stringer.GoString()
 		details.TypeName = reflect.TypeOf(telem.Error).String()
+	} else if telem.Error != nil {
+		details.Message = fmt.Sprintf("%+v", telem.Error)
+		details.TypeName = reflect.TypeOf(telem.Error).String()
 	} else {
 		details.Message = "<unknown>"
 		details.TypeName = "<unknown>"
@@ -73,6 +85,7 @@ func (telem *ExceptionTelemetry) TelemetryData() TelemetryData {
 
 	data := contracts.NewExceptionData()
 	data.SeverityLevel = telem.SeverityLevel
+	data.ProblemId = telem.ProblemId
 	data.Exceptions = []*contracts.ExceptionDetails{details}
 	data.Properties = telem.Properties
 	data.Measurements = telem.Measurements
@@ -84,8 +97,6 @@ func (telem *ExceptionTelemetry) TelemetryData() TelemetryData {
 // exception telemetry for the current goroutine, skipping a number of frames
 // specified by skip.
 func GetCallstack(skip int) []*contracts.StackFrame {
-	var stackFrames []*contracts.StackFrame
-
 	if skip < 0 {
 		skip = 0
 	}
@@ -93,56 +104,21 @@ func GetCallstack(skip int) []*contracts.StackFrame {
 	stack := make([]uintptr, 64+skip)
 	depth := runtime.Callers(skip+1, stack)
 	if depth == 0 {
-		return stackFrames
-	}
-
-	frames := runtime.CallersFrames(stack[:depth])
-	level := 0
-	for {
-		frame, more := frames.Next()
-
-		stackFrame := &contracts.StackFrame{
-			Level:    level,
-			FileName: frame.File,
-			Line:     frame.Line,
-		}
-
-		if frame.Function != "" {
-			/* Default */
-			stackFrame.Method = frame.Function
-
-			/* Break up function into assembly/function */
-			lastSlash := strings.LastIndexByte(frame.Function, '/')
-			if lastSlash < 0 {
-				// e.g. "runtime.gopanic"
-				// The below works with lastSlash=0
-				lastSlash = 0
-			}
-
-			firstDot := strings.IndexByte(frame.Function[lastSlash:], '.')
-			if firstDot >= 0 {
-				stackFrame.Assembly = frame.Function[:lastSlash+firstDot]
-				stackFrame.Method = frame.Function[lastSlash+firstDot+1:]
-			}
-		}
-
-		stackFrames = append(stackFrames, stackFrame)
-
-		level++
-		if !more {
-			break
-		}
+		return nil
 	}
 
-	return stackFrames
+	return stackFramesFromPCs(stack[:depth])
 }
 
 // Recovers from any active panics and tracks them to the specified
-// TelemetryClient.  If rethrow is set to true, then this will panic.
-// Should be invoked via defer in functions to monitor.
-func TrackPanic(client TelemetryClient, rethrow bool) {
+// client.  If rethrow is set to true, then this will panic.
+// Should be invoked via defer in functions to monitor.  See
+// NewPanicTelemetry for the details recorded.
+func TrackPanic(client Tracker, rethrow bool) {
 	if r := recover(); r != nil {
-		client.Track(newExceptionTelemetry(r, 1))
+		exception := newExceptionTelemetry(r, 1)
+		applyPanicDetails(exception, r, rethrow)
+		client.Track(exception)
 		if rethrow {
 			panic(r)
 		}
@@ -0,0 +1,95 @@
+package appinsights
+
+import (
+	"strconv"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Properties set by ExceptionBuilder
+const (
+	// Where the exception was handled; see the ExceptionHandledAt values
+	ExceptionHandledAtProperty = "handledAt"
+
+	// Whether users were affected by the exception, "true" or "false"
+	ExceptionUserImpactedProperty = "userImpacted"
+)
+
+// Values of the ExceptionHandledAtProperty
+const (
+	// The exception was handled by application code
+	ExceptionHandledAtUserCode = "UserCode"
+
+	// The exception wasn't handled, e.g. a panic that wasn't recovered
+	ExceptionHandledAtUnhandled = "Unhandled"
+)
+
+// ExceptionBuilder builds exception telemetry annotated for triage by
+// severity, handling and user impact rather than as a flat stream:
+//
+//	client.Track(appinsights.NewExceptionBuilder(err).
+//		Severity(appinsights.Critical).
+//		Unhandled().
+//		UserImpacted(true).
+//		Build())
+type ExceptionBuilder struct {
+	telemetry *ExceptionTelemetry
+}
+
+// NewExceptionBuilder starts building exception telemetry for err,
+// capturing the current call stack.  The exception is reported as handled
+// by user code with Error severity unless specified otherwise.
+func NewExceptionBuilder(err interface{}) *ExceptionBuilder {
+	telemetry := newExceptionTelemetry(err, 1)
+	telemetry.Properties[ExceptionHandledAtProperty] = ExceptionHandledAtUserCode
+	return &ExceptionBuilder{telemetry: telemetry}
+}
+
+// Severity sets the severity level of the exception.
+func (builder *ExceptionBuilder) Severity(level contracts.SeverityLevel) *ExceptionBuilder {
+	builder.telemetry.SeverityLevel = level
+	return builder
+}
+
+// Handled marks the exception as handled by application code.
+func (builder *ExceptionBuilder) Handled() *ExceptionBuilder {
+	builder.telemetry.Properties[ExceptionHandledAtProperty] = ExceptionHandledAtUserCode
+	return builder
+}
+
+// Unhandled marks the exception as not handled by the application.
+func (builder *ExceptionBuilder) Unhandled() *ExceptionBuilder {
+	builder.telemetry.Properties[ExceptionHandledAtProperty] = ExceptionHandledAtUnhandled
+	return builder
+}
+
+// ProblemID overrides the identifier grouping exceptions into problems,
+// e.g. to group errors wrapped at different call sites together.
+func (builder *ExceptionBuilder) ProblemID(problemID string) *ExceptionBuilder {
+	builder.telemetry.ProblemId = problemID
+	return builder
+}
+
+// UserImpacted records whether users were affected by the exception.
+func (builder *ExceptionBuilder) UserImpacted(impacted bool) *ExceptionBuilder {
+	builder.telemetry.Properties[ExceptionUserImpactedProperty] = strconv.FormatBool(impacted)
+	return builder
+}
+
+// Property sets a custom property on the exception.
+func (builder *ExceptionBuilder) Property(name, value string) *ExceptionBuilder {
+	builder.telemetry.Properties[name] = value
+	return builder
+}
+
+// Measurement sets a custom measurement on the exception.
+func (builder *ExceptionBuilder) Measurement(name string, value float64) *ExceptionBuilder {
+	builder.telemetry.Measurements[name] = value
+	return builder
+}
+
+// Build returns the exception telemetry.  Changes made to the builder
+// afterwards also apply to the returned item.
+func (builder *ExceptionBuilder) Build() *ExceptionTelemetry {
+	return builder.telemetry
+}
@@ -0,0 +1,55 @@
+package appinsights
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestExceptionBuilder(t *testing.T) {
+	telemetry := NewExceptionBuilder(errors.New("payment declined")).
+		Severity(Critical).
+		Unhandled().
+		ProblemID("payments/declined").
+		UserImpacted(true).
+		Property("orderId", "42").
+		Measurement("amount", 12.5).
+		Build()
+
+	data := telemetry.TelemetryData().(*contracts.ExceptionData)
+	if data.SeverityLevel != Critical {
+		t.Errorf("Expected Critical severity, got %v", data.SeverityLevel)
+	}
+	if data.ProblemId != "payments/declined" {
+		t.Errorf("Expected the problem ID override, got %q", data.ProblemId)
+	}
+	if data.Properties[ExceptionHandledAtProperty] != ExceptionHandledAtUnhandled {
+		t.Errorf("Expected an unhandled exception, got %q", data.Properties[ExceptionHandledAtProperty])
+	}
+	if data.Properties[ExceptionUserImpactedProperty] != "true" || data.Properties["orderId"] != "42" || data.Measurements["amount"] != 12.5 {
+		t.Errorf("Unexpected properties: %v %v", data.Properties, data.Measurements)
+	}
+	if data.Exceptions[0].Message != "payment declined" {
+		t.Errorf("Unexpected message: %s", data.Exceptions[0].Message)
+	}
+
+	// The call stack starts at the caller
+	if frames := data.Exceptions[0].ParsedStack; len(frames) == 0 || !strings.HasSuffix(frames[0].Method, "TestExceptionBuilder") {
+		t.Errorf("Expected the stack to start in the test, got %+v", frames)
+	}
+}
+
+func TestExceptionBuilderDefaults(t *testing.T) {
+	data := NewExceptionBuilder("oops").Build().TelemetryData().(*contracts.ExceptionData)
+	if data.SeverityLevel != Error || data.ProblemId != "" {
+		t.Errorf("Unexpected defaults: %v %q", data.SeverityLevel, data.ProblemId)
+	}
+	if data.Properties[ExceptionHandledAtProperty] != ExceptionHandledAtUserCode {
+		t.Errorf("Expected a handled exception, got %q", data.Properties[ExceptionHandledAtProperty])
+	}
+	if _, ok := data.Properties[ExceptionUserImpactedProperty]; ok {
+		t.Error("Expected no user impact unless specified")
+	}
+}
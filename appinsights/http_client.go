@@ -30,6 +30,36 @@ type HTTPClient struct {
 	// be removed from URLs when tracking dependencies. Common examples:
 	// "password", "key", "token", "secret", "api_key"
 	SensitiveQueryParams []string
+
+	// RetryPolicy enables automatic retries of failed requests (optional).
+	// Each attempt is tracked as a separate dependency linked to the first.
+	RetryPolicy *HTTPRetryPolicy
+
+	// Streaming configures how long-lived responses, such as server-sent
+	// event subscriptions, are reported (optional).  By default, they are
+	// tracked when their headers are received.
+	Streaming *HTTPStreamingConfig
+
+	// DNSLookups enables reporting slow DNS lookups of requests, as
+	// dependencies of their own or measurements of the HTTP dependencies
+	// (optional).
+	DNSLookups *HTTPDNSConfig
+
+	// DisableBodyCounting stops counting the bytes of request and response
+	// bodies of unknown length, such as transparently decompressed or
+	// streamed responses, which may be very large.  Their sizes are then
+	// only recorded when given by Content-Length.
+	DisableBodyCounting bool
+
+	// ExcludedHosts lists hosts to which requests are not tracked as
+	// dependencies, such as metadata services.  Entries match host names
+	// case-insensitively; a leading "*." matches any subdomain.  Requests to
+	// the telemetry client's ingestion endpoint are never tracked.
+	ExcludedHosts []string
+
+	// PropagationFormat selects the correlation headers injected into
+	// requests.  Defaults to both W3C and Request-Id headers.
+	PropagationFormat PropagationFormat
 }
 
 // NewHTTPClient creates a new instrumented HTTP client with the specified
@@ -39,10 +69,8 @@ func NewHTTPClient(telemetryClient TelemetryClient) *HTTPClient {
 		Client:          http.DefaultClient,
 		TelemetryClient: telemetryClient,
 		SanitizeURL:     true,
-		SensitiveQueryParams: []string{
-			"password", "pwd", "secret", "key", "token", "api_key", "apikey",
-			"access_token", "auth", "authorization", "credential", "credentials",
-		},
+		SensitiveQueryParams: DefaultSensitiveQueryParams(),
+		ExcludedHosts:        DefaultExcludedDependencyHosts(),
 	}
 }
 
@@ -53,10 +81,8 @@ func NewHTTPClientWithClient(client *http.Client, telemetryClient TelemetryClien
 		Client:          client,
 		TelemetryClient: telemetryClient,
 		SanitizeURL:     true,
-		SensitiveQueryParams: []string{
-			"password", "pwd", "secret", "key", "token", "api_key", "apikey",
-			"access_token", "auth", "authorization", "credential", "credentials",
-		},
+		SensitiveQueryParams: DefaultSensitiveQueryParams(),
+		ExcludedHosts:        DefaultExcludedDependencyHosts(),
 	}
 }
 
@@ -90,6 +116,10 @@ func (c *HTTPClient) DoWithContext(ctx context.Context, req *http.Request) (*htt
 		telemetryClient:     c.TelemetryClient,
 		sanitizeURL:         c.SanitizeURL,
 		sensitiveQueryParams: c.SensitiveQueryParams,
+		streaming:            c.Streaming,
+		dns:                  c.DNSLookups,
+		disableBodyCounting:  c.DisableBodyCounting,
+		excludedHosts:        c.ExcludedHosts,
 	}
 
 	// Create a temporary client with the instrumented transport
@@ -100,15 +130,8 @@ func (c *HTTPClient) DoWithContext(ctx context.Context, req *http.Request) (*htt
 		Timeout:      c.Client.Timeout,
 	}
 
-	// Inject correlation headers if correlation context exists
-	if corrCtx := GetCorrelationContext(req.Context()); corrCtx != nil {
-		middleware := NewHTTPMiddleware()
-		childCtx := NewChildCorrelationContext(corrCtx)
-		middleware.InjectHeaders(req, childCtx)
-	}
-
-	// Execute the request
-	return tempClient.Do(req)
+	// Execute the request, injecting correlation headers for each attempt
+	return c.doWithRetry(req.Context(), tempClient, req)
 }
 
 // Get performs a GET request to the specified URL and tracks it as a dependency.
@@ -178,13 +201,18 @@ type instrumentedRoundTripper struct {
 	telemetryClient      TelemetryClient
 	sanitizeURL          bool
 	sensitiveQueryParams []string
+	streaming            *HTTPStreamingConfig
+	dns                  *HTTPDNSConfig
+	disableBodyCounting  bool
+	excludedHosts        []string
 }
 
 // RoundTrip implements the http.RoundTripper interface and tracks the request
 // as a dependency telemetry item.
 func (rt *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	if rt.telemetryClient == nil || !rt.telemetryClient.IsEnabled() {
-		// If telemetry is disabled, just pass through to the base transport
+	if rt.telemetryClient == nil || !rt.telemetryClient.IsEnabled() || rt.isExcludedHost(req.URL.Hostname()) || IsTelemetrySuppressed(req.Context()) {
+		// If telemetry is disabled or suppressed, or the host is excluded,
+		// just pass through to the base transport
 		base := rt.base
 		if base == nil {
 			base = http.DefaultTransport
@@ -200,20 +228,62 @@ func (rt *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response
 	if base == nil {
 		base = http.DefaultTransport
 	}
+
+	var lookup *dnsLookup
+	if rt.dns != nil {
+		req, lookup = traceDNSLookup(req)
+	}
 	
-	resp, err := base.RoundTrip(req)
+	sendReq, requestCounter := req, (*countingReadCloser)(nil)
+	if !rt.disableBodyCounting {
+		sendReq, requestCounter = countRequestBody(req)
+	}
+
+	resp, err := base.RoundTrip(sendReq)
+
+	if lookup != nil {
+		rt.reportDNSLookup(req, lookup)
+	}
 	
+	// Streamed responses are tracked as their body is read
+	if err == nil && rt.streaming != nil && rt.streaming.isStreaming(req, resp) {
+		resp.Body = newTrackedStreamBody(rt, req, resp, requestBodySize(req, requestCounter), startTime)
+		return resp, err
+	}
+
 	// Calculate duration
 	duration := time.Since(startTime)
 
+	// Responses of unknown length are tracked once their body is counted
+	if err == nil && !rt.disableBodyCounting && resp.ContentLength < 0 && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = newCountedResponseBody(rt, req, resp, requestCounter, startTime, duration)
+		return resp, err
+	}
+
 	// Track the dependency
-	rt.trackDependency(req, resp, err, startTime, duration)
+	rt.trackDependency(req, resp, err, requestBodySize(req, requestCounter), startTime, duration)
 
 	return resp, err
 }
 
 // trackDependency creates and tracks a RemoteDependencyTelemetry item for the HTTP request.
-func (rt *instrumentedRoundTripper) trackDependency(req *http.Request, resp *http.Response, err error, startTime time.Time, duration time.Duration) {
+func (rt *instrumentedRoundTripper) trackDependency(req *http.Request, resp *http.Response, err error, requestBytes int64, startTime time.Time, duration time.Duration) {
+	dependency := rt.newDependency(req, resp, err, startTime, duration)
+
+	responseBytes := int64(-1)
+	if resp != nil {
+		responseBytes = resp.ContentLength
+		if resp.Body == nil || resp.Body == http.NoBody {
+			responseBytes = 0
+		}
+	}
+	applyBodySizes(dependency, resp, requestBytes, responseBytes)
+
+	rt.track(req, dependency)
+}
+
+// newDependency creates a RemoteDependencyTelemetry item for the HTTP request.
+func (rt *instrumentedRoundTripper) newDependency(req *http.Request, resp *http.Response, err error, startTime time.Time, duration time.Duration) *RemoteDependencyTelemetry {
 	// Determine success status
 	success := err == nil
 	var resultCode string
@@ -232,9 +302,9 @@ func (rt *instrumentedRoundTripper) trackDependency(req *http.Request, resp *htt
 	sanitizedURL := rt.sanitizeURLForTracking(req.URL)
 
 	// Extract target (host:port)
-	target := req.URL.Host
+	target := DependencyTarget(req.URL)
 	if target == "" && req.Host != "" {
-		target = req.Host
+		target = formatDependencyHost(req.URL.Scheme, req.Host)
 	} else if target == "" {
 		target = "unknown"
 	}
@@ -248,9 +318,9 @@ func (rt *instrumentedRoundTripper) trackDependency(req *http.Request, resp *htt
 	// Create the telemetry item
 	var dependency *RemoteDependencyTelemetry
 	if req.Context() != nil {
-		dependency = NewRemoteDependencyTelemetryWithContext(req.Context(), name, "HTTP", target, success)
+		dependency = NewRemoteDependencyTelemetryWithContext(req.Context(), name, DependencyTypeHTTP, target, success)
 	} else {
-		dependency = NewRemoteDependencyTelemetry(name, "HTTP", target, success)
+		dependency = NewRemoteDependencyTelemetry(name, DependencyTypeHTTP, target, success)
 	}
 
 	// Set additional properties
@@ -273,7 +343,16 @@ func (rt *instrumentedRoundTripper) trackDependency(req *http.Request, resp *htt
 		dependency.Properties["error"] = err.Error()
 	}
 
-	// Track the dependency
+	// Link retry attempts of the same logical operation
+	applyRetryAttempt(req.Context(), dependency)
+
+	rt.applyDNSLookup(req, dependency)
+
+	return dependency
+}
+
+// track tracks a dependency of the HTTP request.
+func (rt *instrumentedRoundTripper) track(req *http.Request, dependency *RemoteDependencyTelemetry) {
 	if req.Context() != nil {
 		rt.telemetryClient.TrackWithContext(req.Context(), dependency)
 	} else {
@@ -287,30 +366,8 @@ func (rt *instrumentedRoundTripper) sanitizeURLForTracking(u *url.URL) string {
 		return u.String()
 	}
 
-	// Create a copy of the URL to avoid modifying the original
-	sanitized := *u
-
-	// Remove user information (username:password)
-	sanitized.User = nil
-
-	// Remove or sanitize query parameters
-	if rt.sensitiveQueryParams != nil && len(rt.sensitiveQueryParams) > 0 {
-		query := sanitized.Query()
-		for _, param := range rt.sensitiveQueryParams {
-			for key := range query {
-				// Case-insensitive matching for common patterns
-				if strings.EqualFold(key, param) {
-					query.Set(key, "[REDACTED]")
-				}
-			}
-		}
-		sanitized.RawQuery = query.Encode()
-	}
-
-	// Remove fragment
-	sanitized.Fragment = ""
-
-	return sanitized.String()
+	sanitizer := &Sanitizer{SensitiveQueryParams: rt.sensitiveQueryParams}
+	return sanitizer.SanitizeURL(u)
 }
 
 // WrapClient wraps an existing http.Client with Application Insights instrumentation.
@@ -332,10 +389,8 @@ func NewInstrumentedTransport(telemetryClient TelemetryClient) http.RoundTripper
 		base:                 http.DefaultTransport,
 		telemetryClient:     telemetryClient,
 		sanitizeURL:         true,
-		sensitiveQueryParams: []string{
-			"password", "pwd", "secret", "key", "token", "api_key", "apikey",
-			"access_token", "auth", "authorization", "credential", "credentials",
-		},
+		sensitiveQueryParams: DefaultSensitiveQueryParams(),
+		excludedHosts:        DefaultExcludedDependencyHosts(),
 	}
 }
 
@@ -346,10 +401,8 @@ func NewInstrumentedTransportWithBase(base http.RoundTripper, telemetryClient Te
 		base:                 base,
 		telemetryClient:     telemetryClient,
 		sanitizeURL:         true,
-		sensitiveQueryParams: []string{
-			"password", "pwd", "secret", "key", "token", "api_key", "apikey",
-			"access_token", "auth", "authorization", "credential", "credentials",
-		},
+		sensitiveQueryParams: DefaultSensitiveQueryParams(),
+		excludedHosts:        DefaultExcludedDependencyHosts(),
 	}
 }
 
@@ -416,7 +469,7 @@ func InstrumentFastHTTPClient(telemetryClient TelemetryClient) func(string, stri
 			name += " " + u.Path
 		}
 		
-		dependency := NewRemoteDependencyTelemetry(name, "HTTP", "", true)
+		dependency := NewRemoteDependencyTelemetry(name, DependencyTypeHTTP, "", true)
 		dependency.Duration = duration
 		dependency.Data = reqURL
 		dependency.Timestamp = startTime
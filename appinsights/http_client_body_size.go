@@ -0,0 +1,136 @@
+package appinsights
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Measurements and properties recorded on HTTP dependencies about their
+// bodies
+const (
+	// RequestBodySizeMeasurement holds the number of bytes in the request
+	// body
+	RequestBodySizeMeasurement = "requestBodyBytes"
+
+	// ResponseBodySizeMeasurement holds the number of bytes in the response
+	// body, after any automatic decompression
+	ResponseBodySizeMeasurement = "responseBodyBytes"
+
+	// ResponseDecompressedProperty is "true" when the transport transparently
+	// decompressed the response body
+	ResponseDecompressedProperty = "responseDecompressed"
+)
+
+// countingReadCloser counts the bytes read through it
+type countingReadCloser struct {
+	io.ReadCloser
+	count int64
+}
+
+func (body *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	atomic.AddInt64(&body.count, int64(n))
+	return n, err
+}
+
+func (body *countingReadCloser) bytesRead() int64 {
+	return atomic.LoadInt64(&body.count)
+}
+
+// countRequestBody arranges for the body of a request of unknown length to be
+// counted as it is sent.  Returns the request to send, which is a copy of req
+// if its body was wrapped, and the counter, if any.
+func countRequestBody(req *http.Request) (*http.Request, *countingReadCloser) {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength > 0 {
+		return req, nil
+	}
+
+	counter := &countingReadCloser{ReadCloser: req.Body}
+	counted := new(http.Request)
+	*counted = *req
+	counted.Body = counter
+	return counted, counter
+}
+
+// requestBodySize returns the size of the request body, or -1 if it is
+// unknown
+func requestBodySize(req *http.Request, counter *countingReadCloser) int64 {
+	switch {
+	case req.ContentLength > 0:
+		return req.ContentLength
+	case counter != nil:
+		return counter.bytesRead()
+	case req.Body == nil || req.Body == http.NoBody:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// applyBodySizes records the body sizes on a dependency.  Negative sizes are
+// unknown and not recorded.
+func applyBodySizes(dependency *RemoteDependencyTelemetry, resp *http.Response, requestBytes, responseBytes int64) {
+	if requestBytes >= 0 {
+		dependency.Measurements[RequestBodySizeMeasurement] = float64(requestBytes)
+	}
+	if responseBytes >= 0 {
+		dependency.Measurements[ResponseBodySizeMeasurement] = float64(responseBytes)
+	}
+	if resp != nil && resp.Uncompressed {
+		dependency.Properties[ResponseDecompressedProperty] = "true"
+	}
+}
+
+// countedResponseBody counts the bytes of a response of unknown length, such
+// as one that was transparently decompressed, and tracks its dependency when
+// the body is fully read or closed.  The dependency's duration still covers
+// the time until the headers were received.
+type countedResponseBody struct {
+	countingReadCloser
+	rt       *instrumentedRoundTripper
+	req      *http.Request
+	resp     *http.Response
+	start    time.Time
+	duration time.Duration
+
+	requestCounter *countingReadCloser
+	once           sync.Once
+}
+
+func newCountedResponseBody(rt *instrumentedRoundTripper, req *http.Request, resp *http.Response, requestCounter *countingReadCloser, start time.Time, duration time.Duration) *countedResponseBody {
+	return &countedResponseBody{
+		countingReadCloser: countingReadCloser{ReadCloser: resp.Body},
+		rt:                 rt,
+		req:                req,
+		resp:               resp,
+		start:              start,
+		duration:           duration,
+		requestCounter:     requestCounter,
+	}
+}
+
+func (body *countedResponseBody) Read(p []byte) (int, error) {
+	n, err := body.countingReadCloser.Read(p)
+	if err != nil {
+		body.finish()
+	}
+	return n, err
+}
+
+func (body *countedResponseBody) Close() error {
+	err := body.countingReadCloser.Close()
+	body.finish()
+	return err
+}
+
+// finish tracks the dependency.  Only the first call has any effect.
+func (body *countedResponseBody) finish() {
+	body.once.Do(func() {
+		dependency := body.rt.newDependency(body.req, body.resp, nil, body.start, body.duration)
+		applyBodySizes(dependency, body.resp, requestBodySize(body.req, body.requestCounter), body.bytesRead())
+		body.rt.track(body.req, dependency)
+	})
+}
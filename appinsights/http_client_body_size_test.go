@@ -0,0 +1,125 @@
+package appinsights
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newBodySizeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		if r.URL.Path == "/gzip" && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			writer.Write([]byte(strings.Repeat("compressible ", 100)))
+			writer.Close()
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+}
+
+func TestHTTPClientBodySizes(t *testing.T) {
+	server := newBodySizeServer()
+	defer server.Close()
+
+	httpClient, testChannel := newStreamingTestClient(nil)
+
+	resp, err := httpClient.Post(server.URL+"/plain", "text/plain", "twelve bytes")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", len(dependencies))
+	}
+	if size := dependencies[0].Measurements[RequestBodySizeMeasurement]; size != 12 {
+		t.Errorf("Expected request size 12, got %v", size)
+	}
+	if size := dependencies[0].Measurements[ResponseBodySizeMeasurement]; size != 5 {
+		t.Errorf("Expected response size 5, got %v", size)
+	}
+	if _, ok := dependencies[0].Properties[ResponseDecompressedProperty]; ok {
+		t.Error("Uncompressed response should not be marked as decompressed")
+	}
+}
+
+func TestHTTPClientCountsDecompressedBody(t *testing.T) {
+	server := newBodySizeServer()
+	defer server.Close()
+
+	httpClient, testChannel := newStreamingTestClient(nil)
+
+	// A reader of unknown length is sent chunked
+	body := io.MultiReader(strings.NewReader("chunked "), strings.NewReader("body"))
+	resp, err := httpClient.Post(server.URL+"/gzip", "text/plain", body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !resp.Uncompressed {
+		t.Fatal("Expected the transport to decompress the response")
+	}
+	if testChannel.getSentCount() != 0 {
+		t.Error("Expected no dependency until the body is read")
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", len(dependencies))
+	}
+
+	dependency := dependencies[0]
+	if size := dependency.Measurements[ResponseBodySizeMeasurement]; size != float64(len(data)) {
+		t.Errorf("Expected response size %d, got %v", len(data), size)
+	}
+	if size := dependency.Measurements[RequestBodySizeMeasurement]; size != 12 {
+		t.Errorf("Expected counted request size 12, got %v", size)
+	}
+	if dependency.Properties[ResponseDecompressedProperty] != "true" {
+		t.Error("Expected the response to be marked as decompressed")
+	}
+	if !dependency.Success || dependency.ResultCode != "200" {
+		t.Errorf("Unexpected dependency: %+v", dependency)
+	}
+}
+
+func TestHTTPClientDisableBodyCounting(t *testing.T) {
+	server := newBodySizeServer()
+	defer server.Close()
+
+	httpClient, testChannel := newStreamingTestClient(nil)
+	httpClient.DisableBodyCounting = true
+
+	body := io.MultiReader(strings.NewReader("chunked"))
+	resp, err := httpClient.Post(server.URL+"/gzip", "text/plain", body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected the dependency when the headers are received, got %d", len(dependencies))
+	}
+	if _, ok := dependencies[0].Measurements[ResponseBodySizeMeasurement]; ok {
+		t.Error("Response of unknown length should not have a size")
+	}
+	if _, ok := dependencies[0].Measurements[RequestBodySizeMeasurement]; ok {
+		t.Error("Request of unknown length should not have a size")
+	}
+	if dependencies[0].Properties[ResponseDecompressedProperty] != "true" {
+		t.Error("Expected the response to be marked as decompressed")
+	}
+}
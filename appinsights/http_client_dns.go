@@ -0,0 +1,146 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DependencyTypeDNS is the type of the dependencies tracked for slow DNS
+// lookups of outgoing HTTP requests.
+const DependencyTypeDNS = "DNS"
+
+// DNSLookupMeasurement holds the duration of the DNS lookup of an HTTP
+// dependency, in milliseconds
+const DNSLookupMeasurement = "dnsLookupMs"
+
+// DNSTrackingMode determines how slow DNS lookups are reported.
+type DNSTrackingMode int
+
+const (
+	// DNSTrackDependency tracks each slow lookup as a DNS dependency
+	// nested within the HTTP dependency it was made for.
+	DNSTrackDependency DNSTrackingMode = iota
+
+	// DNSTrackMeasurement records the duration of each slow lookup in the
+	// DNSLookupMeasurement of the HTTP dependency.
+	DNSTrackMeasurement
+)
+
+// HTTPDNSConfig configures how an HTTPClient reports the DNS lookups of
+// outgoing requests, surfacing resolver issues that otherwise hide in the
+// overall duration of the calls.  Lookups are only made for new connections.
+type HTTPDNSConfig struct {
+	// How slow lookups are reported
+	Mode DNSTrackingMode
+
+	// Lookups faster than this aren't reported.  Zero reports all lookups.
+	Threshold time.Duration
+}
+
+// NewHTTPDNSConfig creates a configuration that tracks lookups taking 100ms
+// or more as dependencies.
+func NewHTTPDNSConfig() *HTTPDNSConfig {
+	return &HTTPDNSConfig{
+		Mode:      DNSTrackDependency,
+		Threshold: 100 * time.Millisecond,
+	}
+}
+
+type dnsLookupKey struct{}
+
+// dnsLookup records the DNS lookup made for a request, if any
+type dnsLookup struct {
+	lock      sync.Mutex
+	host      string
+	start     time.Time
+	duration  time.Duration
+	addresses []string
+	coalesced bool
+	err       error
+	done      bool
+}
+
+// traceDNSLookup returns a copy of req that records its DNS lookup
+func traceDNSLookup(req *http.Request) (*http.Request, *dnsLookup) {
+	lookup := &dnsLookup{}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			lookup.lock.Lock()
+			defer lookup.lock.Unlock()
+			lookup.host = info.Host
+			lookup.start = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			lookup.lock.Lock()
+			defer lookup.lock.Unlock()
+			lookup.duration = time.Since(lookup.start)
+			lookup.coalesced = info.Coalesced
+			lookup.err = info.Err
+			lookup.done = true
+			for _, addr := range info.Addrs {
+				lookup.addresses = append(lookup.addresses, addr.String())
+			}
+		},
+	}
+
+	ctx := context.WithValue(httptrace.WithClientTrace(req.Context(), trace), dnsLookupKey{}, lookup)
+	return req.WithContext(ctx), lookup
+}
+
+// reportDNSLookup tracks the DNS lookup of a request as a dependency if it
+// was slow, in DNSTrackDependency mode
+func (rt *instrumentedRoundTripper) reportDNSLookup(req *http.Request, lookup *dnsLookup) {
+	if rt.dns.Mode != DNSTrackDependency {
+		return
+	}
+
+	lookup.lock.Lock()
+	defer lookup.lock.Unlock()
+
+	if !lookup.done || lookup.duration < rt.dns.Threshold {
+		return
+	}
+
+	// Nested within the span of the HTTP dependency, if it has one
+	ctx := req.Context()
+	if GetCorrelationContext(ctx) != nil {
+		ctx = WithChildSpan(ctx, "")
+	}
+	dependency := NewRemoteDependencyTelemetryWithContext(ctx, lookup.host, DependencyTypeDNS, lookup.host, lookup.err == nil)
+	dependency.MarkTime(lookup.start, lookup.start.Add(lookup.duration))
+	dependency.Data = strings.Join(lookup.addresses, ",")
+	dependency.Properties["addressCount"] = strconv.Itoa(len(lookup.addresses))
+	if lookup.coalesced {
+		dependency.Properties["coalesced"] = "true"
+	}
+	if lookup.err != nil {
+		dependency.Properties["error"] = lookup.err.Error()
+	}
+
+	rt.telemetryClient.TrackWithContext(ctx, dependency)
+}
+
+// applyDNSLookup records the duration of a slow DNS lookup on an HTTP
+// dependency, in DNSTrackMeasurement mode
+func (rt *instrumentedRoundTripper) applyDNSLookup(req *http.Request, dependency *RemoteDependencyTelemetry) {
+	if rt.dns == nil || rt.dns.Mode != DNSTrackMeasurement {
+		return
+	}
+
+	lookup, ok := req.Context().Value(dnsLookupKey{}).(*dnsLookup)
+	if !ok {
+		return
+	}
+
+	lookup.lock.Lock()
+	defer lookup.lock.Unlock()
+
+	if lookup.done && lookup.duration >= rt.dns.Threshold {
+		dependency.Measurements[DNSLookupMeasurement] = toMilliseconds(lookup.duration)
+	}
+}
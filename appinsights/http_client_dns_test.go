@@ -0,0 +1,116 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newDNSTestClient(dns *HTTPDNSConfig) (*HTTPClient, *TestTelemetryChannel) {
+	client, testChannel := newTestClient()
+
+	// A fresh transport, so that each request resolves its host
+	httpClient := NewHTTPClientWithClient(&http.Client{Transport: &http.Transport{DisableKeepAlives: true}}, client)
+	httpClient.DNSLookups = dns
+	return httpClient, testChannel
+}
+
+// localhostURL addresses the server by name, so that requests need a DNS
+// lookup
+func localhostURL(t *testing.T, server *httptest.Server) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	return fmt.Sprintf("http://localhost:%s/dns", u.Port())
+}
+
+func TestHTTPDNSLookupDependency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dns := NewHTTPDNSConfig()
+	dns.Threshold = 0
+	httpClient, testChannel := newDNSTestClient(dns)
+
+	ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	resp, err := httpClient.GetWithContext(ctx, localhostURL(t, server))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 2 {
+		t.Fatalf("Expected DNS and HTTP dependencies, got %d items", len(dependencies))
+	}
+
+	lookup, request := dependencies[0], dependencies[1]
+	if lookup.Type != DependencyTypeDNS || lookup.Name != "localhost" || lookup.Target != "localhost" {
+		t.Errorf("Unexpected DNS dependency: %s %s %s", lookup.Type, lookup.Name, lookup.Target)
+	}
+	if !lookup.Success || lookup.Data == "" {
+		t.Errorf("Expected a successful lookup with addresses, got %v %q", lookup.Success, lookup.Data)
+	}
+	if request.Type != DependencyTypeHTTP {
+		t.Errorf("Expected the HTTP dependency last, got %s", request.Type)
+	}
+	if _, ok := request.Measurements[DNSLookupMeasurement]; ok {
+		t.Error("Did not expect a lookup measurement in dependency mode")
+	}
+
+	if parent := contracts.ContextTags(testChannel.sentItems[0].Tags).Operation().GetParentId(); parent != request.Id {
+		t.Errorf("Expected the lookup to be nested in the HTTP dependency %s, got %s", request.Id, parent)
+	}
+}
+
+func TestHTTPDNSLookupMeasurement(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient, testChannel := newDNSTestClient(&HTTPDNSConfig{Mode: DNSTrackMeasurement})
+
+	resp, err := httpClient.Get(localhostURL(t, server))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected only the HTTP dependency, got %d items", len(dependencies))
+	}
+	if _, ok := dependencies[0].Measurements[DNSLookupMeasurement]; !ok {
+		t.Errorf("Expected a lookup measurement, got %v", dependencies[0].Measurements)
+	}
+}
+
+func TestHTTPDNSLookupThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, mode := range []DNSTrackingMode{DNSTrackDependency, DNSTrackMeasurement} {
+		httpClient, testChannel := newDNSTestClient(&HTTPDNSConfig{Mode: mode, Threshold: time.Hour})
+
+		resp, err := httpClient.Get(localhostURL(t, server))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp.Body.Close()
+
+		dependencies := sentDependencies(testChannel)
+		if len(dependencies) != 1 {
+			t.Fatalf("Expected only the HTTP dependency for mode %d, got %d items", mode, len(dependencies))
+		}
+		if _, ok := dependencies[0].Measurements[DNSLookupMeasurement]; ok {
+			t.Errorf("Did not expect a lookup measurement for mode %d", mode)
+		}
+	}
+}
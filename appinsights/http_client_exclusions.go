@@ -0,0 +1,51 @@
+package appinsights
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultExcludedDependencyHosts returns the hosts to which requests are not
+// tracked as dependencies by default: the Azure instance metadata service
+// and wire server, which are polled by infrastructure libraries.
+func DefaultExcludedDependencyHosts() []string {
+	return []string{"169.254.169.254", "168.63.129.16"}
+}
+
+// isExcludedHost returns whether requests to host aren't tracked.  Requests
+// to the telemetry client's own ingestion endpoint are always excluded so
+// that submitting telemetry through an instrumented transport doesn't track
+// itself.
+func (rt *instrumentedRoundTripper) isExcludedHost(host string) bool {
+	if host == "" {
+		return false
+	}
+
+	if matchesExcludedHost(host, rt.excludedHosts) {
+		return true
+	}
+
+	if channel := rt.telemetryClient.Channel(); channel != nil {
+		if endpoint, err := url.Parse(channel.EndpointAddress()); err == nil && strings.EqualFold(endpoint.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesExcludedHost matches a host name against exclusion patterns.
+// Patterns match case-insensitively; a leading "*." matches any subdomain.
+func matchesExcludedHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if len(host) > len(suffix)+1 && strings.EqualFold(host[len(host)-len(suffix)-1:], "."+suffix) {
+				return true
+			}
+		} else if strings.EqualFold(host, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
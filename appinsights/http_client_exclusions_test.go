@@ -0,0 +1,80 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// endpointChannel is a test channel reporting a specific endpoint address
+type endpointChannel struct {
+	TestTelemetryChannel
+	endpoint string
+}
+
+func (c *endpointChannel) EndpointAddress() string { return c.endpoint }
+
+func TestMatchesExcludedHost(t *testing.T) {
+	patterns := []string{"169.254.169.254", "*.Internal.example.com"}
+
+	tests := []struct {
+		host     string
+		excluded bool
+	}{
+		{"169.254.169.254", true},
+		{"metadata.internal.example.com", true},
+		{"A.B.INTERNAL.EXAMPLE.COM", true},
+		{"internal.example.com", false},
+		{"notinternal.example.com", false},
+		{"example.com", false},
+	}
+
+	for _, test := range tests {
+		if excluded := matchesExcludedHost(test.host, patterns); excluded != test.excluded {
+			t.Errorf("%s: expected excluded=%t", test.host, test.excluded)
+		}
+	}
+}
+
+func TestHTTPClientExcludedHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	testChannel := &endpointChannel{}
+	client := newTelemetryClient(NewTelemetryConfiguration("InstrumentationKey="+test_ikey), testChannel)
+
+	httpClient := NewHTTPClient(client)
+	get := func() {
+		resp, err := httpClient.Get(server.URL + "/path")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Tracked by default
+	get()
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected the request to be tracked, got %d items", testChannel.getSentCount())
+	}
+
+	// Excluded explicitly
+	testChannel.reset()
+	httpClient.ExcludedHosts = append(DefaultExcludedDependencyHosts(), "127.0.0.1")
+	get()
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected the excluded host not to be tracked, got %d items", testChannel.getSentCount())
+	}
+
+	// The ingestion endpoint is always excluded
+	httpClient.ExcludedHosts = nil
+	serverURL, _ := url.Parse(server.URL)
+	testChannel.endpoint = "http://" + serverURL.Host + "/v2/track"
+	get()
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected the ingestion endpoint not to be tracked, got %d items", testChannel.getSentCount())
+	}
+}
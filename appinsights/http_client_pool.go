@@ -0,0 +1,92 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// CorrelatedClientPool hands out http.Clients bound to the correlation
+// context of an operation, so that code deep in a call stack, or libraries
+// accepting an *http.Client, can issue correlated and tracked requests
+// without threading the context into each request:
+//
+//	client := pool.Get(ctx)
+//	defer pool.Put(client)
+//	resp, err := client.Get(url) // tracked as a dependency of ctx's operation
+//
+// Requests that already carry a correlation context in their own context
+// keep it.  Only correlation data is bound; cancellation is still
+// controlled by each request's context.
+type CorrelatedClientPool struct {
+	client *HTTPClient
+	pool   sync.Pool
+}
+
+// boundTransport sends requests through an HTTPClient, attaching an
+// operation's correlation data to requests lacking their own
+type boundTransport struct {
+	client     *HTTPClient
+	corrCtx    *CorrelationContext
+	properties map[string]string
+}
+
+// NewCorrelatedClientPool creates a pool of clients sending requests
+// through client, which tracks them, injects correlation headers, and
+// applies its retry policy, timeout and redirect policy.
+func NewCorrelatedClientPool(client *HTTPClient) *CorrelatedClientPool {
+	pool := &CorrelatedClientPool{client: client}
+	pool.pool.New = func() interface{} {
+		return &http.Client{
+			Transport: &boundTransport{},
+
+			// Redirects are followed by the underlying client
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return pool
+}
+
+// Get returns a client bound to the correlation context and operation
+// properties of ctx.  Return it with Put once its requests are complete.
+func (pool *CorrelatedClientPool) Get(ctx context.Context) *http.Client {
+	client := pool.pool.Get().(*http.Client)
+	transport := client.Transport.(*boundTransport)
+
+	transport.client = pool.client
+	transport.corrCtx = GetCorrelationContext(ctx)
+	transport.properties = OperationProperties(ctx)
+	return client
+}
+
+// Put returns a client obtained from Get to the pool.  The client must not
+// be used afterwards.
+func (pool *CorrelatedClientPool) Put(client *http.Client) {
+	transport, ok := client.Transport.(*boundTransport)
+	if !ok {
+		return
+	}
+
+	transport.client = nil
+	transport.corrCtx = nil
+	transport.properties = nil
+	pool.pool.Put(client)
+}
+
+// RoundTrip adds the bound correlation data to the request's context and
+// sends the request through the underlying client.
+func (transport *boundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if transport.corrCtx != nil && GetCorrelationContext(ctx) == nil {
+		ctx = WithCorrelationContext(ctx, transport.corrCtx)
+	}
+	if transport.properties != nil && OperationProperties(ctx) == nil {
+		ctx = WithOperationProperties(ctx, transport.properties)
+	}
+
+	// The underlying client sets the context on a copy of the request
+	return transport.client.DoWithContext(ctx, req)
+}
@@ -0,0 +1,81 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestCorrelatedClientPoolInjectsHeaders(t *testing.T) {
+	headers := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get(TraceParentHeader)
+	}))
+	defer server.Close()
+
+	pool := NewCorrelatedClientPool(NewHTTPClient(nil))
+	corrCtx := NewCorrelationContext()
+	client := pool.Get(WithCorrelationContext(context.Background(), corrCtx))
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if header := <-headers; !strings.Contains(header, corrCtx.TraceID) {
+		t.Errorf("Expected the bound trace ID, got %q", header)
+	}
+
+	// A request's own correlation context takes precedence
+	other := NewCorrelationContext()
+	req, _ := http.NewRequestWithContext(WithCorrelationContext(context.Background(), other), "GET", server.URL, nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if header := <-headers; !strings.Contains(header, other.TraceID) {
+		t.Errorf("Expected the request's trace ID, got %q", header)
+	}
+
+	pool.Put(client)
+	if transport := client.Transport.(*boundTransport); transport.corrCtx != nil {
+		t.Error("Expected the returned client to be unbound")
+	}
+}
+
+func TestCorrelatedClientPoolTracksDependencies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tc, testChannel := newTestClient()
+
+	pool := NewCorrelatedClientPool(NewHTTPClient(tc))
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithOperationProperties(WithCorrelationContext(context.Background(), corrCtx), map[string]string{"tenant": "contoso"})
+	client := pool.Get(ctx)
+	defer pool.Put(client)
+
+	resp, err := client.Get(server.URL + "/orders")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected one dependency, got %d", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	if envelope.Tags[contracts.OperationId] != corrCtx.TraceID {
+		t.Errorf("Expected operation ID %s, got %s", corrCtx.TraceID, envelope.Tags[contracts.OperationId])
+	}
+	if dependency := envelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData); dependency.Properties["tenant"] != "contoso" {
+		t.Errorf("Expected operation properties on the dependency, got %v", dependency.Properties)
+	}
+}
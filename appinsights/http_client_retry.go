@@ -0,0 +1,168 @@
+package appinsights
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Properties used to link retry attempts of the same logical operation
+const (
+	// RetryAttemptProperty holds the 1-based attempt number of a dependency call
+	RetryAttemptProperty = "attempt"
+
+	// RetryOfProperty holds the span ID of the first attempt of a retried call
+	RetryOfProperty = "retryOf"
+)
+
+// HTTPRetryPolicy configures automatic retries of requests made through an
+// HTTPClient.  Each attempt is tracked as its own dependency with its own
+// span ID, and attempts after the first are linked to the first attempt via
+// the retryOf and attempt properties.
+type HTTPRetryPolicy struct {
+	// MaxRetries is the maximum number of retries after the first attempt
+	MaxRetries int
+
+	// Backoff is the delay before each retry.  It is multiplied by the
+	// retry number, so the second retry waits twice as long as the first.
+	Backoff time.Duration
+
+	// ShouldRetry decides whether an attempt should be retried.  Defaults to
+	// retrying network errors, 408, 429, and 5xx responses.
+	ShouldRetry func(resp *http.Response, err error) bool
+}
+
+// NewHTTPRetryPolicy creates a retry policy with the specified number of
+// retries and backoff, using the default retry condition.
+func NewHTTPRetryPolicy(maxRetries int, backoff time.Duration) *HTTPRetryPolicy {
+	return &HTTPRetryPolicy{
+		MaxRetries: maxRetries,
+		Backoff:    backoff,
+	}
+}
+
+// DefaultShouldRetry retries network errors, request timeouts, throttling,
+// and server errors.
+func DefaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500
+}
+
+// shouldRetry applies the policy's retry condition
+func (p *HTTPRetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err)
+	}
+
+	return DefaultShouldRetry(resp, err)
+}
+
+// retryAttempt describes which attempt of a logical operation a request is
+type retryAttempt struct {
+	attempt int
+	retryOf string
+}
+
+type retryAttemptContextKey struct{}
+
+var retryAttemptKey = retryAttemptContextKey{}
+
+// withRetryAttempt records retry attempt information in the context
+func withRetryAttempt(ctx context.Context, attempt int, retryOf string) context.Context {
+	return context.WithValue(ctx, retryAttemptKey, &retryAttempt{
+		attempt: attempt,
+		retryOf: retryOf,
+	})
+}
+
+// applyRetryAttempt adds retry link properties to the dependency if the
+// context carries retry attempt information
+func applyRetryAttempt(ctx context.Context, dependency *RemoteDependencyTelemetry) {
+	info, ok := ctx.Value(retryAttemptKey).(*retryAttempt)
+	if !ok {
+		return
+	}
+
+	dependency.Properties[RetryAttemptProperty] = strconv.Itoa(info.attempt)
+	if info.retryOf != "" {
+		dependency.Properties[RetryOfProperty] = info.retryOf
+	}
+}
+
+// doWithRetry executes the request through the specified client, retrying
+// according to the policy.  Each attempt is executed under its own child
+// span of the correlation context found on ctx.
+func (c *HTTPClient) doWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	policy := c.RetryPolicy
+	maxRetries := 0
+	if policy != nil && policy.MaxRetries > 0 && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		maxRetries = policy.MaxRetries
+	}
+
+	parentCorr := GetCorrelationContext(ctx)
+	firstSpanID := ""
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		attemptCtx := ctx
+
+		if attempt > 1 {
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		// Each attempt gets its own span so it can be told apart in traces
+		if parentCorr != nil {
+			childCtx := NewChildCorrelationContext(parentCorr)
+			attemptCtx = WithCorrelationContext(attemptCtx, childCtx)
+			injectCorrelationHeaders(attemptReq.Header, childCtx, c.PropagationFormat)
+
+			if attempt == 1 {
+				firstSpanID = childCtx.SpanID
+			}
+		}
+
+		if policy != nil {
+			attemptCtx = withRetryAttempt(attemptCtx, attempt, firstSpanIDFor(attempt, firstSpanID))
+		}
+
+		resp, err := client.Do(attemptReq.WithContext(attemptCtx))
+		if attempt > maxRetries || !policy.shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		// Discard the failed response before trying again
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(policy.Backoff * time.Duration(attempt)):
+		}
+	}
+}
+
+// firstSpanIDFor returns the span ID to link to for the specified attempt
+func firstSpanIDFor(attempt int, firstSpanID string) string {
+	if attempt == 1 {
+		return ""
+	}
+
+	return firstSpanID
+}
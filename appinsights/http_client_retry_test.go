@@ -0,0 +1,210 @@
+package appinsights
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRetryTestServer(failures int, status int) (*httptest.Server, *[]*http.Request, *[]string) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+
+		if len(requests) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, &requests, &bodies
+}
+
+func newRetryTestClient(policy *HTTPRetryPolicy) (*HTTPClient, *[]*RemoteDependencyTelemetry) {
+	var mu sync.Mutex
+	var tracked []*RemoteDependencyTelemetry
+
+	client := NewHTTPClient(&mockTelemetryClient{
+		trackFunc: func(telemetry interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			if dep, ok := telemetry.(*RemoteDependencyTelemetry); ok {
+				tracked = append(tracked, dep)
+			}
+		},
+	})
+	client.RetryPolicy = policy
+
+	return client, &tracked
+}
+
+func TestHTTPClientRetryLinksAttempts(t *testing.T) {
+	server, requests, _ := newRetryTestServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client, tracked := newRetryTestClient(NewHTTPRetryPolicy(3, time.Millisecond))
+
+	ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	resp, err := client.GetWithContext(ctx, server.URL+"/resource")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected final status 200, got %d", resp.StatusCode)
+	}
+	if len(*requests) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", len(*requests))
+	}
+	if len(*tracked) != 3 {
+		t.Fatalf("Expected 3 dependencies, got %d", len(*tracked))
+	}
+
+	first := (*tracked)[0]
+	if first.Properties[RetryAttemptProperty] != "1" {
+		t.Errorf("Expected first attempt number 1, got %q", first.Properties[RetryAttemptProperty])
+	}
+	if _, ok := first.Properties[RetryOfProperty]; ok {
+		t.Error("First attempt should not have retryOf")
+	}
+
+	seenSpans := map[string]bool{}
+	for i, dep := range *tracked {
+		if i > 0 {
+			if dep.Properties[RetryOfProperty] != first.Id {
+				t.Errorf("Attempt %d: expected retryOf %s, got %s", i+1, first.Id, dep.Properties[RetryOfProperty])
+			}
+			if dep.Properties[RetryAttemptProperty] != []string{"1", "2", "3"}[i] {
+				t.Errorf("Attempt %d: unexpected attempt property %q", i+1, dep.Properties[RetryAttemptProperty])
+			}
+		}
+
+		// The dependency ID must match the span sent downstream
+		traceParent := (*requests)[i].Header.Get(TraceParentHeader)
+		if !strings.Contains(traceParent, dep.Id) {
+			t.Errorf("Attempt %d: dependency id %s not found in traceparent %s", i+1, dep.Id, traceParent)
+		}
+
+		if seenSpans[dep.Id] {
+			t.Errorf("Attempt %d reused span id %s", i+1, dep.Id)
+		}
+		seenSpans[dep.Id] = true
+	}
+}
+
+func TestHTTPClientRetryReplaysBody(t *testing.T) {
+	server, requests, bodies := newRetryTestServer(1, http.StatusInternalServerError)
+	defer server.Close()
+
+	client, _ := newRetryTestClient(NewHTTPRetryPolicy(2, time.Millisecond))
+
+	resp, err := client.Post(server.URL, "text/plain", "payload")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(*requests))
+	}
+	for i, body := range *bodies {
+		if body != "payload" {
+			t.Errorf("Attempt %d: expected body to be replayed, got %q", i+1, body)
+		}
+	}
+}
+
+func TestHTTPClientRetryGivesUp(t *testing.T) {
+	server, requests, _ := newRetryTestServer(10, http.StatusBadGateway)
+	defer server.Close()
+
+	client, tracked := newRetryTestClient(NewHTTPRetryPolicy(2, time.Millisecond))
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected last failure to be returned, got %d", resp.StatusCode)
+	}
+	if len(*requests) != 3 || len(*tracked) != 3 {
+		t.Errorf("Expected 3 attempts and dependencies, got %d and %d", len(*requests), len(*tracked))
+	}
+}
+
+func TestHTTPClientRetryCustomCondition(t *testing.T) {
+	server, requests, _ := newRetryTestServer(1, http.StatusNotFound)
+	defer server.Close()
+
+	policy := NewHTTPRetryPolicy(2, time.Millisecond)
+	policy.ShouldRetry = func(resp *http.Response, err error) bool {
+		return err == nil && resp.StatusCode == http.StatusNotFound
+	}
+	client, _ := newRetryTestClient(policy)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*requests) != 2 {
+		t.Errorf("Expected custom condition to trigger a retry, got %d attempts", len(*requests))
+	}
+}
+
+func TestHTTPClientWithoutRetryPolicy(t *testing.T) {
+	server, requests, _ := newRetryTestServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client, tracked := newRetryTestClient(nil)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*requests) != 1 {
+		t.Errorf("Expected a single attempt, got %d", len(*requests))
+	}
+	if _, ok := (*tracked)[0].Properties[RetryAttemptProperty]; ok {
+		t.Error("Expected no retry properties without a retry policy")
+	}
+}
+
+func TestHTTPClientRetryCanceled(t *testing.T) {
+	server, requests, _ := newRetryTestServer(10, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client, _ := newRetryTestClient(NewHTTPRetryPolicy(5, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetWithContext(ctx, server.URL)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("Expected a single attempt before cancellation, got %d", len(*requests))
+	}
+}
@@ -0,0 +1,239 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Properties and measurements recorded on dependencies of streamed responses
+const (
+	// StreamSegmentProperty holds the 1-based number of a progress
+	// dependency within its stream
+	StreamSegmentProperty = "streamSegment"
+
+	// StreamCompleteProperty is "true" on the dependency tracked when the
+	// stream ends
+	StreamCompleteProperty = "streamComplete"
+
+	// StreamBytesMeasurement holds the number of body bytes read during the
+	// period the dependency covers
+	StreamBytesMeasurement = "streamBytes"
+)
+
+// StreamingMode determines how long-lived responses, such as server-sent
+// event subscriptions, are reported.
+type StreamingMode int
+
+const (
+	// StreamingTrackOnHeaders tracks a single dependency when the response
+	// headers are received, as for any other request.  The time spent
+	// reading the body isn't reported.
+	StreamingTrackOnHeaders StreamingMode = iota
+
+	// StreamingTrackOnCompletion tracks a single dependency covering the
+	// whole stream when its body is fully read or closed.
+	StreamingTrackOnCompletion
+
+	// StreamingTrackProgress tracks a dependency for every ProgressInterval
+	// of the stream, and a final one when its body is fully read or closed,
+	// so that long subscriptions show up while they are open.
+	StreamingTrackProgress
+)
+
+// HTTPStreamingConfig configures how an HTTPClient reports long-lived
+// responses.
+type HTTPStreamingConfig struct {
+	// How streamed responses are reported
+	Mode StreamingMode
+
+	// Period covered by each progress dependency
+	ProgressInterval time.Duration
+
+	// Decides whether a response is streamed.  Defaults to responses with a
+	// Content-Type of text/event-stream.
+	IsStreaming func(req *http.Request, resp *http.Response) bool
+}
+
+// NewHTTPStreamingConfig creates a streaming configuration that reports
+// streams with progress dependencies every minute.
+func NewHTTPStreamingConfig() *HTTPStreamingConfig {
+	return &HTTPStreamingConfig{
+		Mode:             StreamingTrackProgress,
+		ProgressInterval: time.Minute,
+	}
+}
+
+// DefaultIsStreaming treats server-sent event responses as streamed.
+func DefaultIsStreaming(req *http.Request, resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// isStreaming applies the configuration's streaming condition
+func (config *HTTPStreamingConfig) isStreaming(req *http.Request, resp *http.Response) bool {
+	if config.Mode == StreamingTrackOnHeaders {
+		return false
+	}
+
+	if config.IsStreaming != nil {
+		return config.IsStreaming(req, resp)
+	}
+
+	return DefaultIsStreaming(req, resp)
+}
+
+// trackedStreamBody wraps the body of a streamed response and tracks its
+// dependencies as it is read
+type trackedStreamBody struct {
+	io.ReadCloser
+	rt   *instrumentedRoundTripper
+	req  *http.Request
+	resp *http.Response
+
+	mode         StreamingMode
+	start        time.Time
+	requestBytes int64
+
+	lock         sync.Mutex
+	segment      int
+	segmentStart time.Time
+	segmentBytes int64
+	totalBytes   int64
+	readErr      error
+	finished     bool
+	stop         chan struct{}
+}
+
+func newTrackedStreamBody(rt *instrumentedRoundTripper, req *http.Request, resp *http.Response, requestBytes int64, start time.Time) *trackedStreamBody {
+	body := &trackedStreamBody{
+		ReadCloser:   resp.Body,
+		rt:           rt,
+		req:          req,
+		resp:         resp,
+		mode:         rt.streaming.Mode,
+		start:        start,
+		requestBytes: requestBytes,
+		segmentStart: start,
+		stop:         make(chan struct{}),
+	}
+
+	if body.mode == StreamingTrackProgress && rt.streaming.ProgressInterval > 0 {
+		go body.trackProgress(rt.streaming.ProgressInterval)
+	}
+
+	return body
+}
+
+func (body *trackedStreamBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+
+	body.lock.Lock()
+	body.segmentBytes += int64(n)
+	body.totalBytes += int64(n)
+	if err != nil && err != io.EOF && body.readErr == nil {
+		body.readErr = err
+	}
+	body.lock.Unlock()
+
+	if err != nil {
+		body.finish()
+	}
+
+	return n, err
+}
+
+func (body *trackedStreamBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.finish()
+	return err
+}
+
+// trackProgress tracks a progress dependency every interval until the
+// stream ends
+func (body *trackedStreamBody) trackProgress(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			body.lock.Lock()
+			if !body.finished {
+				body.trackSegment(false)
+			}
+			body.lock.Unlock()
+		case <-body.stop:
+			return
+		}
+	}
+}
+
+// finish tracks the final dependency of the stream.  Only the first call
+// has any effect.
+func (body *trackedStreamBody) finish() {
+	body.lock.Lock()
+	defer body.lock.Unlock()
+
+	if body.finished {
+		return
+	}
+
+	body.finished = true
+	close(body.stop)
+	body.trackSegment(true)
+}
+
+// trackSegment tracks the dependency covering the stream since the last
+// one.  Must be called with the lock held.
+func (body *trackedStreamBody) trackSegment(complete bool) {
+	now := time.Now()
+
+	// Reading is interrupted when the caller gives up on the stream, which
+	// isn't a failure of the dependency
+	err := body.readErr
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+
+	var dependency *RemoteDependencyTelemetry
+	if body.mode == StreamingTrackOnCompletion {
+		dependency = body.rt.newDependency(body.req, body.resp, err, body.start, now.Sub(body.start))
+	} else {
+		body.segment++
+		dependency = body.rt.newDependency(body.req, body.resp, err, body.segmentStart, now.Sub(body.segmentStart))
+		dependency.Properties[StreamSegmentProperty] = strconv.Itoa(body.segment)
+
+		// Progress dependencies get their own IDs; the final one keeps the
+		// span ID so that it remains the parent of nested telemetry
+		if !complete {
+			dependency.Id = dependency.Id + "." + strconv.Itoa(body.segment)
+		}
+	}
+
+	if err != nil {
+		dependency.Success = false
+	}
+	if complete {
+		dependency.Properties[StreamCompleteProperty] = "true"
+	}
+
+	// Byte counts are left out when counting is disabled for large streams
+	if !body.rt.disableBodyCounting {
+		dependency.Measurements[StreamBytesMeasurement] = float64(body.segmentBytes)
+		if complete {
+			applyBodySizes(dependency, body.resp, body.requestBytes, body.totalBytes)
+		}
+	} else if complete {
+		applyBodySizes(dependency, body.resp, body.requestBytes, -1)
+	}
+
+	body.segmentStart = now
+	body.segmentBytes = 0
+	body.rt.track(body.req, dependency)
+}
@@ -0,0 +1,158 @@
+package appinsights
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newSSEServer(events int, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			fmt.Fprint(w, "ok")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		for i := 0; i < events; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(delay)
+		}
+	}))
+}
+
+func newStreamingTestClient(streaming *HTTPStreamingConfig) (*HTTPClient, *TestTelemetryChannel) {
+	client, testChannel := newTestClient()
+
+	httpClient := NewHTTPClient(client)
+	httpClient.Streaming = streaming
+	return httpClient, testChannel
+}
+
+func sentDependencies(testChannel *TestTelemetryChannel) []*contracts.RemoteDependencyData {
+	var dependencies []*contracts.RemoteDependencyData
+	for _, envelope := range testChannel.sentItems {
+		dependencies = append(dependencies, envelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData))
+	}
+	return dependencies
+}
+
+func TestHTTPStreamingProgress(t *testing.T) {
+	server := newSSEServer(6, 25*time.Millisecond)
+	defer server.Close()
+
+	streaming := NewHTTPStreamingConfig()
+	streaming.ProgressInterval = 40 * time.Millisecond
+	httpClient, testChannel := newStreamingTestClient(streaming)
+
+	resp, err := httpClient.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if testChannel.getSentCount() != 0 {
+		t.Error("Expected no dependency when the headers are received")
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) < 2 {
+		t.Fatalf("Expected progress and final dependencies, got %d", len(dependencies))
+	}
+
+	var totalBytes float64
+	ids := make(map[string]bool)
+	for i, dependency := range dependencies {
+		if !dependency.Success || dependency.Type != DependencyTypeHTTP {
+			t.Errorf("Unexpected dependency: %+v", dependency)
+		}
+		if dependency.Properties[StreamSegmentProperty] != fmt.Sprint(i+1) {
+			t.Errorf("Expected segment %d, got %s", i+1, dependency.Properties[StreamSegmentProperty])
+		}
+		if complete := dependency.Properties[StreamCompleteProperty] == "true"; complete != (i == len(dependencies)-1) {
+			t.Errorf("Expected only the last dependency to be complete, got %v for segment %d", complete, i+1)
+		}
+		if ids[dependency.Id] {
+			t.Errorf("Duplicate dependency id %s", dependency.Id)
+		}
+		ids[dependency.Id] = true
+		totalBytes += dependency.Measurements[StreamBytesMeasurement]
+	}
+
+	if totalBytes != float64(len(body)) {
+		t.Errorf("Expected segments to account for %d bytes, got %f", len(body), totalBytes)
+	}
+	if size := dependencies[len(dependencies)-1].Measurements[ResponseBodySizeMeasurement]; size != float64(len(body)) {
+		t.Errorf("Expected the final dependency to record %d response bytes, got %f", len(body), size)
+	}
+
+	// Closing again doesn't track another dependency
+	count := testChannel.getSentCount()
+	resp.Body.Close()
+	time.Sleep(2 * streaming.ProgressInterval)
+	if testChannel.getSentCount() != count {
+		t.Error("Expected no dependencies after the stream ended")
+	}
+}
+
+func TestHTTPStreamingOnCompletion(t *testing.T) {
+	server := newSSEServer(4, 20*time.Millisecond)
+	defer server.Close()
+
+	httpClient, testChannel := newStreamingTestClient(&HTTPStreamingConfig{Mode: StreamingTrackOnCompletion})
+
+	resp, err := httpClient.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected a single dependency, got %d", len(dependencies))
+	}
+	if dependencies[0].Measurements[StreamBytesMeasurement] != float64(len(body)) {
+		t.Errorf("Expected %d bytes, got %f", len(body), dependencies[0].Measurements[StreamBytesMeasurement])
+	}
+	if _, ok := dependencies[0].Properties[StreamSegmentProperty]; ok {
+		t.Error("Expected no segment number in completion mode")
+	}
+
+	// Non-streamed responses are tracked on headers as usual
+	resp, err = httpClient.Get(server.URL + "/plain")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if testChannel.getSentCount() != 2 {
+		t.Errorf("Expected plain response to be tracked immediately, got %d items", testChannel.getSentCount())
+	}
+	resp.Body.Close()
+}
+
+func TestHTTPStreamingClosedEarly(t *testing.T) {
+	server := newSSEServer(100, 10*time.Millisecond)
+	defer server.Close()
+
+	httpClient, testChannel := newStreamingTestClient(&HTTPStreamingConfig{Mode: StreamingTrackOnCompletion})
+
+	resp, err := httpClient.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	buf := make([]byte, 8)
+	resp.Body.Read(buf)
+	resp.Body.Close()
+
+	dependencies := sentDependencies(testChannel)
+	if len(dependencies) != 1 || !dependencies[0].Success || dependencies[0].Properties[StreamCompleteProperty] != "true" {
+		t.Errorf("Expected a successful, complete dependency when the caller closes the stream, got %+v", dependencies)
+	}
+}
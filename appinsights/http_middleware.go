@@ -63,6 +63,67 @@ func (rw *responseWriter) Size() int64 {
 type HTTPMiddleware struct {
 	// Optional callback to get the telemetry client for requests
 	GetClient func(*http.Request) TelemetryClient
+
+	// ClientIP controls how the client IP address is recorded on request
+	// telemetry.  Defaults to leaving it unset.
+	ClientIP ClientIPMode
+
+	// TrustForwardedFor uses the X-Forwarded-For header to determine the
+	// client IP address.  Only enable this behind a trusted proxy.
+	TrustForwardedFor bool
+
+	// CaptureTLSInfo records the negotiated TLS version and cipher suite,
+	// the SNI server name, and a hash of the client certificate subject as
+	// request properties, for requests received over TLS.
+	CaptureTLSInfo bool
+
+	// AuthInfo optionally returns authentication scheme, role, and
+	// authorization outcome dimensions to record as request properties.
+	// See DefaultAuthInfo for a starting point.
+	AuthInfo AuthInfoFunc
+
+	// TrackServerErrors tracks exception telemetry linked to the request
+	// for responses with a status code of 500 or above.  Handlers can
+	// attach error details with RecordError; otherwise the exception
+	// describes the response status.
+	TrackServerErrors bool
+
+	// LatencyBudgets optionally declares per-operation latency budgets.
+	// Budgeted requests are annotated with whether they exceeded their
+	// budget.
+	LatencyBudgets *LatencyBudgets
+
+	// ProfileCapture optionally captures a runtime profile when requests
+	// trip its error or latency thresholds.
+	ProfileCapture *ProfileCapturer
+
+	// JWTClaims optionally records identity claims of the request's
+	// validated JWT on the request and the telemetry tracked within it.
+	JWTClaims *JWTClaimsEnrichment
+
+	// PropagationFormat selects the correlation headers injected into
+	// outgoing requests and set on responses.  Defaults to both W3C and
+	// Request-Id headers.
+	PropagationFormat PropagationFormat
+
+	// ResponseHeaders selects the correlation headers set on responses, for
+	// API gateways that reject unexpected response headers.  Defaults to
+	// the Request-Id header unless PropagationFormat is PropagateW3C.
+	ResponseHeaders ResponseHeaderMode
+
+	// ResponseHeaderFunc sets custom correlation headers on responses when
+	// ResponseHeaders is ResponseHeadersCustom.
+	ResponseHeaderFunc func(header http.Header, corrCtx *CorrelationContext)
+
+	// OperationIDHeader optionally names a response header, such as
+	// "x-ms-request-id", that returns the request's operation ID so that
+	// customers can quote it to support.  See TransactionLink.
+	OperationIDHeader string
+
+	// RequestCounter optionally counts the requests handled by the
+	// middleware, for the Requests/Sec Windows performance counter.  See
+	// PerformanceCounterConfig.
+	RequestCounter *RequestCounter
 }
 
 // NewHTTPMiddleware creates a new HTTP middleware instance
@@ -73,37 +134,19 @@ func NewHTTPMiddleware() *HTTPMiddleware {
 // ExtractHeaders extracts correlation context from HTTP request headers
 // Supports both W3C Trace Context and Request-Id headers
 func (m *HTTPMiddleware) ExtractHeaders(r *http.Request) *CorrelationContext {
-	// Try W3C Trace Context first (preferred)
-	if traceParent := r.Header.Get(TraceParentHeader); traceParent != "" {
-		if corrCtx, err := ParseW3CTraceParent(traceParent); err == nil {
-			// TODO: Handle tracestate header if needed in the future
-			return corrCtx
-		}
-	}
-
-	// Fall back to Request-Id header for backward compatibility
-	if requestID := r.Header.Get(RequestIDHeader); requestID != "" {
-		if corrCtx, err := ParseRequestID(requestID); err == nil {
-			return corrCtx
-		}
-	}
-
-	// No correlation headers found, return nil
-	return nil
+	// TODO: Handle tracestate header if needed in the future
+	return extractCorrelation(HeaderCarrier(r.Header))
 }
 
 // InjectHeaders injects correlation headers into an HTTP request
-// Adds both W3C Trace Context and Request-Id headers for compatibility
+// Adds W3C Trace Context and/or Request-Id headers according to the
+// middleware's PropagationFormat
 func (m *HTTPMiddleware) InjectHeaders(r *http.Request, corrCtx *CorrelationContext) {
 	if corrCtx == nil {
 		return
 	}
 
-	// Set W3C Trace Context header (primary)
-	r.Header.Set(TraceParentHeader, corrCtx.ToW3CTraceParent())
-
-	// Set Request-Id header for backward compatibility
-	r.Header.Set(RequestIDHeader, corrCtx.ToRequestID())
+	injectCorrelationHeaders(r.Header, corrCtx, m.PropagationFormat)
 
 	// TODO: Handle tracestate header if needed in the future
 }
@@ -128,8 +171,14 @@ func (m *HTTPMiddleware) Middleware(next http.Handler) http.Handler {
 			corrCtx = NewChildCorrelationContext(corrCtx)
 		}
 
+		// Name the operation after the route if it is already known,
+		// e.g. when wrapping a handler registered on an http.ServeMux
+		if name := routeOperationName(r); name != "" {
+			corrCtx.OperationName = name
+		}
+
 		// Add correlation context to request context
-		ctx := WithCorrelationContext(r.Context(), corrCtx)
+		ctx := m.requestContext(WithCorrelationContext(r.Context(), corrCtx), r)
 		r = r.WithContext(ctx)
 
 		// Wrap response writer to capture status code and response size
@@ -141,30 +190,132 @@ func (m *HTTPMiddleware) Middleware(next http.Handler) http.Handler {
 		// Call the next handler
 		next.ServeHTTP(rw, r)
 
-		// Track the request telemetry after completion if client getter is provided
-		if m.GetClient != nil {
-			if client := m.GetClient(r); client != nil {
-				// Calculate request duration
-				duration := time.Since(startTime)
-				
-				// Get status code as string
-				responseCode := strconv.Itoa(rw.Status())
-				
-				// Track the completed request with accurate timing and status
-				client.TrackRequestWithContext(ctx, r.Method, r.URL.String(), duration, responseCode)
-			}
+		if m.RequestCounter != nil {
+			m.RequestCounter.Increment()
 		}
+
+		// Track the request telemetry after completion
+		m.trackRequest(ctx, r, rw.Status(), startTime)
 	})
 }
 
+// trackRequest tracks request telemetry for a completed request if a client
+// getter is provided
+func (m *HTTPMiddleware) trackRequest(ctx context.Context, r *http.Request, statusCode int, startTime time.Time) {
+	if m.GetClient == nil {
+		return
+	}
+
+	client := m.GetClient(r)
+	if client == nil {
+		return
+	}
+
+	// Calculate request duration
+	duration := time.Since(startTime)
+
+	// Requests abandoned by the client are recorded with a distinct code
+	// rather than whatever status the handler wrote
+	aborted := requestAborted(r)
+	if aborted {
+		statusCode = ClientClosedRequestCode
+	}
+
+	// Get status code as string
+	responseCode := strconv.Itoa(statusCode)
+
+	// Track the completed request with accurate timing and status
+	request := NewRequestTelemetryWithContext(ctx, r.Method, r.URL.String(), duration, responseCode)
+
+	// Requests routed by an http.ServeMux are named after the matched
+	// pattern, which keeps the cardinality of operation names low
+	if name := routeOperationName(r); name != "" {
+		request.Name = name
+		request.Tags.Operation().SetName(name)
+	}
+
+	if aborted {
+		request.Properties[RequestCanceledProperty] = "true"
+	}
+
+	if ip := applyClientIP(r, m.ClientIP, m.TrustForwardedFor); ip != "" {
+		request.Tags.Location().SetIp(ip)
+	}
+
+	if m.CaptureTLSInfo {
+		applyTLSInfo(request, r.TLS)
+	}
+
+	applyJWTIdentity(ctx, request)
+
+	if m.AuthInfo != nil {
+		applyAuthInfo(request, m.AuthInfo(r, statusCode), statusCode)
+	}
+
+	var budget time.Duration
+	var breached bool
+	if m.LatencyBudgets != nil {
+		budget, breached = m.LatencyBudgets.apply(request)
+	}
+
+	client.TrackWithContext(ctx, request)
+
+	if breached && m.LatencyBudgets.TrackBreachEvents {
+		trackSLABreach(ctx, client, request, budget)
+	}
+
+	if m.ProfileCapture != nil {
+		m.ProfileCapture.ObserveRequest(request.Duration, request.Success)
+	}
+
+	if m.TrackServerErrors && statusCode >= 500 {
+		trackServerErrors(ctx, client, request, statusCode)
+	}
+}
+
+// requestContext adds per-request state used by the middleware's optional
+// features to the request context
+func (m *HTTPMiddleware) requestContext(ctx context.Context, r *http.Request) context.Context {
+	if m.TrackServerErrors {
+		ctx = withErrorRecorder(ctx)
+	}
+
+	if m.JWTClaims != nil {
+		ctx = m.JWTClaims.withClaims(ctx, r)
+	}
+
+	return ctx
+}
+
 // setResponseHeaders sets correlation headers in the HTTP response
 func (m *HTTPMiddleware) setResponseHeaders(w http.ResponseWriter, corrCtx *CorrelationContext) {
 	if corrCtx == nil {
 		return
 	}
 
-	// Set Request-Id header in response for client correlation
-	w.Header().Set(RequestIDHeader, corrCtx.ToRequestID())
+	switch m.ResponseHeaders {
+	case ResponseHeadersRequestID:
+		w.Header().Set(RequestIDHeader, corrCtx.ToRequestID())
+
+	case ResponseHeadersTraceParent:
+		w.Header().Set(TraceParentHeader, corrCtx.ToW3CTraceParent())
+
+	case ResponseHeadersCustom:
+		if m.ResponseHeaderFunc != nil {
+			m.ResponseHeaderFunc(w.Header(), corrCtx)
+		}
+
+	case ResponseHeadersDefault:
+		// Set Request-Id header in response for client correlation, unless
+		// legacy headers are disabled
+		if m.PropagationFormat.requestID() {
+			w.Header().Set(RequestIDHeader, corrCtx.ToRequestID())
+		}
+	}
+
+	if m.OperationIDHeader != "" {
+		w.Header().Set(m.OperationIDHeader, corrCtx.GetOperationID())
+	}
 }
 
 // WrapRoundTripper wraps an http.RoundTripper to automatically inject correlation headers
@@ -269,7 +420,7 @@ func (m *HTTPMiddleware) GinMiddleware() interface{} {
 		}
 
 		// Add correlation context to request context and Gin context
-		ctx := WithCorrelationContext(req.Context(), corrCtx)
+		ctx := m.requestContext(WithCorrelationContext(req.Context(), corrCtx), req)
 		ginContext.SetRequest(req.WithContext(ctx))
 		ginContext.Set("appinsights_correlation", corrCtx)
 
@@ -279,23 +430,14 @@ func (m *HTTPMiddleware) GinMiddleware() interface{} {
 		// Call the next middleware/handler
 		ginContext.Next()
 
-		// Track the request telemetry after completion if client getter is provided
-		if m.GetClient != nil {
-			if client := m.GetClient(req); client != nil {
-				// Calculate request duration
-				duration := time.Since(startTime)
-				
-				// Get status code - for Gin we need to get it from the writer
-				statusCode := 200 // Default
-				if rw, ok := w.(interface{ Status() int }); ok {
-					statusCode = rw.Status()
-				}
-				responseCode := strconv.Itoa(statusCode)
-				
-				// Track the completed request with accurate timing and status
-				client.TrackRequestWithContext(ctx, req.Method, req.URL.String(), duration, responseCode)
-			}
+		// Get status code - for Gin we need to get it from the writer
+		statusCode := 200 // Default
+		if rw, ok := w.(interface{ Status() int }); ok {
+			statusCode = rw.Status()
 		}
+
+		// Track the request telemetry after completion
+		m.trackRequest(ctx, req, statusCode, startTime)
 	}
 }
 
@@ -343,7 +485,7 @@ func (m *HTTPMiddleware) EchoMiddleware() interface{} {
 			}
 
 			// Add correlation context to request context and Echo context
-			ctx := WithCorrelationContext(req.Context(), corrCtx)
+			ctx := m.requestContext(WithCorrelationContext(req.Context(), corrCtx), req)
 			echoContext.SetRequest(req.WithContext(ctx))
 			echoContext.Set("appinsights_correlation", corrCtx)
 
@@ -354,19 +496,8 @@ func (m *HTTPMiddleware) EchoMiddleware() interface{} {
 			nextHandler := next.(func(interface{}) error)
 			err := nextHandler(c)
 
-			// Track the request telemetry after completion if client getter is provided
-			if m.GetClient != nil {
-				if client := m.GetClient(req); client != nil {
-					// Calculate request duration
-					duration := time.Since(startTime)
-					
-					// Get status code from Echo response
-					responseCode := strconv.Itoa(res.Status())
-					
-					// Track the completed request with accurate timing and status
-					client.TrackRequestWithContext(ctx, req.Method, req.URL.String(), duration, responseCode)
-				}
-			}
+			// Track the request telemetry after completion
+			m.trackRequest(ctx, req, res.Status(), startTime)
 
 			return err
 		}
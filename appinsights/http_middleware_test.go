@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,6 +43,26 @@ func TestExtractHeadersW3C(t *testing.T) {
 	}
 }
 
+func TestExtractHeadersW3CZeroIDs(t *testing.T) {
+	middleware := NewHTTPMiddleware()
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(TraceParentHeader, "00-abcdef0123456789abcdef0123456789-0000000000000000-01")
+
+	corrCtx := middleware.ExtractHeaders(req)
+	if corrCtx == nil {
+		t.Fatal("Expected correlation context from repaired W3C headers")
+	}
+
+	// The zero span ID is replaced; the trace ID and flags are preserved
+	if corrCtx.TraceID != "abcdef0123456789abcdef0123456789" || corrCtx.TraceFlags != 1 {
+		t.Errorf("Expected trace ID and flags to be preserved, got %+v", corrCtx)
+	}
+	if !corrCtx.IsValid() {
+		t.Errorf("Expected repaired context to be valid, got %+v", corrCtx)
+	}
+}
+
 func TestExtractHeadersRequestID(t *testing.T) {
 	middleware := NewHTTPMiddleware()
 
@@ -386,6 +407,10 @@ func (c *mockTelemetryClient) TrackWithContext(ctx context.Context, telemetry Te
 	if c.trackFunc != nil {
 		c.trackFunc(telemetry)
 	}
+	if request, ok := telemetry.(*RequestTelemetry); ok && c.trackRequestFunc != nil {
+		method := strings.SplitN(request.Name, " ", 2)[0]
+		c.trackRequestFunc(ctx, method, request.Url, request.Duration, request.ResponseCode)
+	}
 }
 func (c *mockTelemetryClient) TrackEvent(name string)                              {}
 func (c *mockTelemetryClient) TrackMetric(name string, value float64)             {}
@@ -2,6 +2,7 @@ package appinsights
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/clock"
@@ -21,9 +22,15 @@ type InMemoryChannel struct {
 	controlChan     chan *inMemoryChannelControl
 	batchSize       int
 	batchInterval   time.Duration
+	alignBatches    bool
 	waitgroup       sync.WaitGroup
 	throttle        *throttleManager
 	transmitter     transmitter
+	serialize       func(items telemetryBufferItems) []byte
+	maxPendingBytes int64
+	backpressure    BackpressurePolicy
+	pendingBytes    atomic.Int64
+	watchdog        *transmitWatchdog
 }
 
 type inMemoryChannelControl struct {
@@ -52,8 +59,35 @@ func NewInMemoryChannel(config *TelemetryConfiguration) *InMemoryChannel {
 		controlChan:     make(chan *inMemoryChannelControl),
 		batchSize:       config.MaxBatchSize,
 		batchInterval:   config.MaxBatchInterval,
+		alignBatches:    config.AlignBatchesToWallClock,
 		throttle:        newThrottleManager(),
-		transmitter:     newTransmitter(config.EndpointUrl, config.Client),
+		transmitter:     newTransmitter(config.EndpointUrl, config.Client, config.TransmitTimeout),
+		serialize:       telemetryBufferItems.serialize,
+		maxPendingBytes: config.MaxPendingBytes,
+		backpressure:    config.BackpressurePolicy,
+		watchdog:        newTransmitWatchdog(config),
+	}
+
+	if transmitter, ok := channel.transmitter.(*httpTransmitter); ok {
+		transmitter.cache = config.metadataCache()
+		if config.AccessToken != nil {
+			transmitter.token = NewCachedTokenFetcher(transmitter.cache, "token:"+config.InstrumentationKey, config.AccessToken)
+		}
+	}
+
+	// The OTLP transmitter converts the items itself, so batches are only
+	// serialized when recorded
+	if config.IngestionProtocol == IngestionProtocolOTLP {
+		channel.endpointAddress = config.OTLPEndpoint
+		channel.transmitter = newOTLPTransmitter(config.OTLPEndpoint, config.Client, config.TransmitTimeout)
+		channel.serialize = func(telemetryBufferItems) []byte { return nil }
+	}
+
+	if config.Recorder != nil {
+		channel.transmitter = config.Recorder
+		if config.IngestionProtocol == IngestionProtocolOTLP {
+			channel.serialize = serializeOTLP
+		}
 	}
 
 	go channel.acceptLoop()
@@ -98,6 +132,32 @@ func (channel *InMemoryChannel) IsThrottled() bool {
 	return channel.throttle != nil && channel.throttle.IsThrottled()
 }
 
+// ThrottleState returns when and why the channel is throttled by the data
+// collector.
+func (channel *InMemoryChannel) ThrottleState() ThrottleState {
+	if channel.throttle == nil {
+		return ThrottleState{}
+	}
+
+	return channel.throttle.observers.current()
+}
+
+// OnThrottleChange registers a callback invoked when the channel's
+// throttling state changes.  The returned function unregisters it.
+func (channel *InMemoryChannel) OnThrottleChange(callback func(ThrottleState)) func() {
+	if channel.throttle == nil {
+		return func() {}
+	}
+
+	return channel.throttle.observers.subscribe(callback)
+}
+
+// Returns the approximate number of bytes of telemetry held by this channel,
+// including batches that are waiting to be retransmitted.
+func (channel *InMemoryChannel) PendingBytes() int64 {
+	return channel.pendingBytes.Load()
+}
+
 // Flushes and tears down the submission goroutine and closes internal
 // channels.  Returns a channel that is closed when all pending telemetry
 // items have been submitted and it is safe to shut down without losing
@@ -158,6 +218,12 @@ type inMemoryChannelState struct {
 	retryTimeout time.Duration
 	callback     chan struct{}
 	timer        clock.Timer
+
+	// Approximate size of the items in buffer
+	bufferBytes int64
+
+	// Number of items dropped due to MaxPendingBytes since the last send
+	memoryDropped int
 }
 
 func newInMemoryChannelState(channel *InMemoryChannel) *inMemoryChannelState {
@@ -191,7 +257,7 @@ func (state *inMemoryChannelState) start() bool {
 			panic("Received nil event")
 		}
 
-		state.buffer = append(state.buffer, event)
+		state.accept(event)
 
 	case ctl := <-state.channel.controlChan:
 		// The buffer is empty, so there would be no point in flushing
@@ -218,7 +284,7 @@ func (state *inMemoryChannelState) waitToSend() bool {
 	state.callback = nil
 
 	// Delay until timeout passes or buffer fills up
-	state.timer.Reset(state.channel.batchInterval)
+	state.timer.Reset(state.channel.batchDelay())
 
 	for {
 		if len(state.buffer) >= state.channel.batchSize {
@@ -236,7 +302,7 @@ func (state *inMemoryChannelState) waitToSend() bool {
 				panic("Received nil event")
 			}
 
-			state.buffer = append(state.buffer, event)
+			state.accept(event)
 
 		case ctl := <-state.channel.controlChan:
 			if ctl.stop {
@@ -244,6 +310,7 @@ func (state *inMemoryChannelState) waitToSend() bool {
 				state.retry = ctl.retry
 				if !ctl.flush {
 					// No flush? Just exit.
+					state.discard()
 					state.channel.signalWhenDone(ctl.callback)
 					return false
 				}
@@ -266,14 +333,38 @@ func (state *inMemoryChannelState) waitToSend() bool {
 	}
 }
 
+// batchDelay returns how long to wait for a batch to fill before sending it
+func (channel *InMemoryChannel) batchDelay() time.Duration {
+	if channel.alignBatches {
+		return alignedDelay(currentClock.Now(), channel.batchInterval)
+	}
+
+	return channel.batchInterval
+}
+
 // Part of channel accept loop: Check and wait on throttle, submit pending telemetry
 func (state *inMemoryChannelState) send() bool {
 	// Hold up transmission if we're being throttled
+	backlogged := false
 	if !state.stopping && state.channel.throttle.IsThrottled() {
 		if !state.waitThrottle() {
 			// Stopped
 			return false
 		}
+
+		backlogged = true
+	}
+
+	if state.memoryDropped > 0 {
+		diagnosticsWriter.Printf("Channel dropped %d events exceeding MaxPendingBytes", state.memoryDropped)
+		state.memoryDropped = 0
+	}
+
+	// Include metrics reported by the watchdog
+	if state.channel.watchdog != nil {
+		for _, report := range state.channel.watchdog.drain() {
+			state.accept(report)
+		}
 	}
 
 	// Send
@@ -284,10 +375,24 @@ func (state *inMemoryChannelState) send() bool {
 		// incremented.
 		state.channel.signalWhenDone(state.callback)
 
-		go func(buffer telemetryBufferItems, retry bool, retryTimeout time.Duration) {
+		// The batch's bytes remain pending until it is done transmitting,
+		// including any retries.
+		// A backlog is transmitted highest priority first, in batches if
+		// it exceeds the batch size.
+		batches := []telemetryBufferItems{state.buffer}
+		if backlogged || len(state.buffer) > state.channel.batchSize {
+			batches = byPriority(state.buffer, state.channel.batchSize)
+		}
+
+		go func(batches []telemetryBufferItems, bufferBytes int64, retry bool, retryTimeout time.Duration) {
 			defer state.channel.waitgroup.Done()
-			state.channel.transmitRetry(buffer, retry, retryTimeout)
-		}(state.buffer, state.retry, state.retryTimeout)
+			defer state.channel.pendingBytes.Add(-bufferBytes)
+			for _, batch := range batches {
+				state.channel.transmitRetry(batch, retry, retryTimeout)
+			}
+		}(batches, state.bufferBytes, state.retry, state.retryTimeout)
+
+		state.bufferBytes = 0
 	} else if state.callback != nil {
 		state.channel.signalWhenDone(state.callback)
 	}
@@ -295,6 +400,81 @@ func (state *inMemoryChannelState) send() bool {
 	return true
 }
 
+// Part of channel accept loop: Add an event to the buffer, applying the
+// backpressure policy if MaxPendingBytes would be exceeded.  Returns false if
+// the event was dropped.
+func (state *inMemoryChannelState) accept(event *contracts.Envelope) bool {
+	channel := state.channel
+	size := estimateEnvelopeSize(event)
+
+	if channel.maxPendingBytes > 0 {
+		// Make room by evicting the oldest items of the lowest priority:
+		// items of lower priority than the event, or with
+		// BackpressureDropOldest, of equal priority as well.  If evicting
+		// all of them would still not make room, e.g. because of batches
+		// awaiting retry, drop only the event instead.
+		dropOldest := channel.backpressure == BackpressureDropOldest
+		if channel.pendingBytes.Load()-state.evictableBytes(event.Priority, dropOldest)+size > channel.maxPendingBytes {
+			releaseFinalizers(event)
+			state.dropForMemory()
+			return false
+		}
+
+		for channel.pendingBytes.Load()+size > channel.maxPendingBytes {
+			i := lowestPriorityIndex(state.buffer, event.Priority, dropOldest)
+			if i < 0 {
+				break
+			}
+
+			state.evict(i)
+			state.dropForMemory()
+		}
+
+		if channel.pendingBytes.Load()+size > channel.maxPendingBytes {
+			releaseFinalizers(event)
+			state.dropForMemory()
+			return false
+		}
+	}
+
+	state.buffer = append(state.buffer, event)
+	state.bufferBytes += size
+	channel.pendingBytes.Add(size)
+	return true
+}
+
+// Part of channel accept loop: Total size of the buffered events that accept
+// may evict to make room for an event of the specified priority
+func (state *inMemoryChannelState) evictableBytes(limit int, inclusive bool) int64 {
+	var total int64
+	for _, item := range state.buffer {
+		if item.Priority < limit || (item.Priority == limit && inclusive) {
+			total += estimateEnvelopeSize(item)
+		}
+	}
+
+	return total
+}
+
+// Part of channel accept loop: Remove a buffered event that will not be sent
+func (state *inMemoryChannelState) evict(i int) {
+	evicted := state.buffer[i]
+	size := estimateEnvelopeSize(evicted)
+	releaseFinalizers(evicted)
+
+	state.buffer = append(state.buffer[:i], state.buffer[i+1:]...)
+	state.bufferBytes -= size
+	state.channel.pendingBytes.Add(-size)
+}
+
+func (state *inMemoryChannelState) dropForMemory() {
+	if state.memoryDropped == 0 {
+		diagnosticsWriter.Write("Pending telemetry exceeds MaxPendingBytes, dropping events.")
+	}
+
+	state.memoryDropped++
+}
+
 // Part of channel accept loop: Wait for throttle to expire while dropping messages
 func (state *inMemoryChannelState) waitThrottle() bool {
 	// Channel is currently throttled.  Once the buffer fills, messages will
@@ -315,13 +495,23 @@ func (state *inMemoryChannelState) waitThrottle() bool {
 
 		case event := <-state.channel.collectChan:
 			// If there's still room in the buffer, then go ahead and add it.
+			// Otherwise, it may replace an item of lower priority.
+			if len(state.buffer) >= state.channel.batchSize {
+				if i := lowestPriorityIndex(state.buffer, event.Priority, false); i >= 0 {
+					state.evict(i)
+					dropped++
+				}
+			}
+
 			if len(state.buffer) < state.channel.batchSize {
-				state.buffer = append(state.buffer, event)
+				state.accept(event)
 			} else {
 				if dropped == 0 {
 					diagnosticsWriter.Write("Buffer is full, dropping further events.")
 				}
 
+				releaseFinalizers(event)
+
 				dropped++
 			}
 
@@ -330,6 +520,7 @@ func (state *inMemoryChannelState) waitThrottle() bool {
 				state.stopping = true
 				state.retry = ctl.retry
 				if !ctl.flush {
+					state.discard()
 					state.channel.signalWhenDone(ctl.callback)
 					return false
 				} else {
@@ -347,6 +538,17 @@ func (state *inMemoryChannelState) waitThrottle() bool {
 	}
 }
 
+// Part of channel accept loop: Discard buffered events that will not be sent
+func (state *inMemoryChannelState) discard() {
+	for _, event := range state.buffer {
+		releaseFinalizers(event)
+	}
+
+	state.buffer = state.buffer[:0]
+	state.channel.pendingBytes.Add(-state.bufferBytes)
+	state.bufferBytes = 0
+}
+
 // Part of channel accept loop: Clean up and close telemetry channel
 func (state *inMemoryChannelState) stop() {
 	close(state.channel.collectChan)
@@ -363,11 +565,18 @@ func (state *inMemoryChannelState) stop() {
 }
 
 func (channel *InMemoryChannel) transmitRetry(items telemetryBufferItems, retry bool, retryTimeout time.Duration) {
-	payload := items.serialize()
+	payload := channel.serialize(items)
 	retryTimeRemaining := retryTimeout
 
 	for _, wait := range submit_retries {
+		start := currentClock.Now()
 		result, err := channel.transmitter.Transmit(payload, items)
+		if channel.watchdog != nil {
+			channel.watchdog.observe(currentClock.Since(start), err)
+		}
+
+		settleDeliveries(items, result, err, !retry)
+
 		if err == nil && result != nil && result.IsSuccess() {
 			return
 		}
@@ -382,7 +591,7 @@ func (channel *InMemoryChannel) transmitRetry(items telemetryBufferItems, retry
 			if result.CanRetry() {
 				// Filter down to failed items
 				payload, items = result.GetRetryItems(payload, items)
-				if len(payload) == 0 || len(items) == 0 {
+				if len(items) == 0 {
 					return
 				}
 			} else {
@@ -394,7 +603,7 @@ func (channel *InMemoryChannel) transmitRetry(items telemetryBufferItems, retry
 			if result.IsThrottled() {
 				if result.retryAfter != nil {
 					diagnosticsWriter.Printf("Channel is throttled until %s", *result.retryAfter)
-					channel.throttle.RetryAfter(*result.retryAfter)
+					channel.throttle.RetryAfter(*result.retryAfter, result.statusCode)
 				} else {
 					// TODO: Pick a time
 				}
@@ -427,13 +636,15 @@ func (channel *InMemoryChannel) transmitRetry(items telemetryBufferItems, retry
 			close(ch)
 
 			if !result {
+				abandonDeliveries(items)
 				return
 			}
 		}
 	}
 
 	// One final try
-	_, err := channel.transmitter.Transmit(payload, items)
+	result, err := channel.transmitter.Transmit(payload, items)
+	settleDeliveries(items, result, err, true)
 	if err != nil {
 		diagnosticsWriter.Write("Gave up transmitting payload; exhausted retries")
 	}
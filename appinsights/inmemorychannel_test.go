@@ -626,3 +626,218 @@ func TestThrottleStacking(t *testing.T) {
 
 	transmitter.assertNoRequest(t)
 }
+
+func newMemoryLimitedChannelServer(items int, policy BackpressurePolicy) (TelemetryClient, *testTransmitter) {
+	client, transmitter := newTestChannelServer()
+
+	// Allow room for the specified number of items plus some slack for
+	// variations in timestamp length.
+	size := estimateEnvelopeSize(client.Context().envelop(NewTraceTelemetry("~msg-0~", Information)))
+	channel := client.Channel().(*InMemoryChannel)
+	channel.maxPendingBytes = int64(items)*size + size/2
+	channel.backpressure = policy
+
+	return client, transmitter
+}
+
+func waitForPendingBytes(t *testing.T, channel *InMemoryChannel, expected int64) {
+	for i := 0; i < 100; i++ {
+		if channel.PendingBytes() == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Errorf("Expected %d pending bytes, got %d", expected, channel.PendingBytes())
+}
+
+func TestMaxPendingBytesDropNewest(t *testing.T) {
+	mockClock()
+	defer resetClock()
+	client, transmitter := newMemoryLimitedChannelServer(3, BackpressureDropNewest)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	for i := 0; i < 5; i++ {
+		client.TrackTrace(fmt.Sprintf("~msg-%d~", i), Information)
+	}
+
+	if client.Channel().(*InMemoryChannel).PendingBytes() == 0 {
+		t.Error("Expected pending bytes to be tracked")
+	}
+
+	transmitter.prepResponse(200)
+	client.Channel().Flush()
+
+	req := transmitter.waitForRequest(t)
+	if len(req.items) != 3 {
+		t.Errorf("Expected 3 items, got %d", len(req.items))
+	}
+	for i := 0; i < 3; i++ {
+		if !strings.Contains(req.payload, fmt.Sprintf("~msg-%d~", i)) {
+			t.Errorf("Payload does not contain ~msg-%d~", i)
+		}
+	}
+
+	waitForPendingBytes(t, client.Channel().(*InMemoryChannel), 0)
+}
+
+func TestMaxPendingBytesDropOldest(t *testing.T) {
+	mockClock()
+	defer resetClock()
+	client, transmitter := newMemoryLimitedChannelServer(3, BackpressureDropOldest)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	for i := 0; i < 5; i++ {
+		client.TrackTrace(fmt.Sprintf("~msg-%d~", i), Information)
+	}
+
+	transmitter.prepResponse(200)
+	client.Channel().Flush()
+
+	req := transmitter.waitForRequest(t)
+	if len(req.items) != 3 {
+		t.Errorf("Expected 3 items, got %d", len(req.items))
+	}
+	for i := 2; i < 5; i++ {
+		if !strings.Contains(req.payload, fmt.Sprintf("~msg-%d~", i)) {
+			t.Errorf("Payload does not contain ~msg-%d~", i)
+		}
+	}
+
+	waitForPendingBytes(t, client.Channel().(*InMemoryChannel), 0)
+}
+
+func TestMaxPendingBytesIncludesRetries(t *testing.T) {
+	mockClock()
+	defer resetClock()
+	client, transmitter := newMemoryLimitedChannelServer(3, BackpressureDropOldest)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	transmitter.prepResponse(500, 200, 200)
+
+	client.TrackTrace("~msg-0~", Information)
+	client.TrackTrace("~msg-1~", Information)
+	client.Channel().Flush()
+
+	// First batch fails and is held for retry
+	req1 := transmitter.waitForRequest(t)
+	if len(req1.items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(req1.items))
+	}
+
+	// Only one more item fits while the batch awaits retransmission.
+	// Batches in flight cannot be evicted, even with DropOldest.
+	client.TrackTrace("~msg-2~", Information)
+	client.TrackTrace("~msg-3~", Information)
+	client.Channel().Flush()
+
+	req2 := transmitter.waitForRequest(t)
+	if len(req2.items) != 1 || !strings.Contains(req2.payload, "~msg-3~") {
+		t.Errorf("Expected only the newest item, got %q", req2.payload)
+	}
+
+	slowTick(10)
+	req3 := transmitter.waitForRequest(t)
+	if req3.payload != req1.payload {
+		t.Error("Expected failed batch to be retried")
+	}
+
+	waitForPendingBytes(t, client.Channel().(*InMemoryChannel), 0)
+}
+
+func TestMaxPendingBytesKeepsBufferWhenEvictionCannotMakeRoom(t *testing.T) {
+	mockClock()
+	defer resetClock()
+	client, transmitter := newMemoryLimitedChannelServer(3, BackpressureDropOldest)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	transmitter.prepResponse(500, 200, 200)
+
+	client.TrackTrace("~msg-0~", Information)
+	client.TrackTrace("~msg-1~", Information)
+	client.Channel().Flush()
+
+	// First batch fails and is held for retry
+	req1 := transmitter.waitForRequest(t)
+	if len(req1.items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(req1.items))
+	}
+
+	// The large item would not fit even if ~msg-2~ were evicted, so only
+	// the large item is dropped.
+	client.TrackTrace("~msg-2~", Information)
+	client.TrackTrace("~big~"+strings.Repeat("x", 500), Information)
+	client.Channel().Flush()
+
+	req2 := transmitter.waitForRequest(t)
+	if len(req2.items) != 1 || !strings.Contains(req2.payload, "~msg-2~") {
+		t.Errorf("Expected the buffered item to be kept, got %q", req2.payload)
+	}
+
+	slowTick(10)
+	req3 := transmitter.waitForRequest(t)
+	if req3.payload != req1.payload {
+		t.Error("Expected failed batch to be retried")
+	}
+
+	waitForPendingBytes(t, client.Channel().(*InMemoryChannel), 0)
+}
+
+func TestEstimateEnvelopeSize(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	for _, item := range serializerTestBuffer() {
+		encoded, _ := item.AppendJSON(nil)
+		estimate := estimateEnvelopeSize(item)
+		if estimate < int64(len(encoded))/2 || estimate > int64(len(encoded))*2 {
+			t.Errorf("Estimate %d is far from encoded size %d for %s", estimate, len(encoded), item.Name)
+		}
+	}
+}
+
+func TestAlignedDelay(t *testing.T) {
+	minute := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		now      time.Time
+		interval time.Duration
+		expected time.Duration
+	}{
+		{minute.Add(3 * time.Second), 30 * time.Second, 27 * time.Second},
+		{minute.Add(45 * time.Second), 30 * time.Second, 15 * time.Second},
+		{minute, 30 * time.Second, 30 * time.Second},
+		{minute.Add(1500 * time.Millisecond), time.Minute, 58500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		if delay := alignedDelay(test.now, test.interval); delay != test.expected {
+			t.Errorf("Expected a delay of %s at %s with interval %s, got %s", test.expected, test.now.Format(time.TimeOnly), test.interval, delay)
+		}
+	}
+}
+
+func TestAlignBatchesToWallClock(t *testing.T) {
+	start := time.Now().Round(time.Minute).Add(3 * time.Second)
+	mockClock(start)
+	defer resetClock()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
+	config.MaxBatchInterval = ten_seconds
+	config.AlignBatchesToWallClock = true
+	client, transmitter := newTestChannelServer(config)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	client.TrackTrace("~msg~", Information)
+	transmitter.prepResponse(200)
+
+	// Sent at the next multiple of ten seconds rather than ten seconds later
+	slowTick(8)
+	req := transmitter.waitForRequest(t)
+	assertTimeApprox(t, req.timestamp, start.Add(7*time.Second))
+}
@@ -0,0 +1,99 @@
+package appinsights
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Common categories of expensive local work.  The category is reported as
+// the target of the InProc dependency, so that the end-to-end transaction
+// view groups similar work together.
+const (
+	InProcCategoryTemplate      = "template"
+	InProcCategorySerialization = "serialization"
+	InProcCategoryCrypto        = "crypto"
+	InProcCategoryCompression   = "compression"
+)
+
+// InProcSpan measures a piece of expensive local work, such as template
+// rendering, serialization or cryptography, and tracks it as an InProc
+// dependency when ended.
+type InProcSpan struct {
+	// Name of the work being measured
+	Name string
+
+	// Category of the work being measured
+	Category string
+
+	// StartTime is when the span was started
+	StartTime time.Time
+
+	// Properties added to the tracked dependency
+	Properties map[string]string
+
+	// Measurements added to the tracked dependency
+	Measurements map[string]float64
+
+	ctx    context.Context
+	client ContextTracker
+	once   sync.Once
+}
+
+// StartInProcSpan starts a child span for expensive local work.  The
+// returned context carries the child span and should be passed to any work
+// nested within it, so that it shows up beneath this span in the
+// end-to-end transaction view.  The span is tracked when End is called.
+func StartInProcSpan(ctx context.Context, name, category string, client ContextTracker) (context.Context, *InProcSpan) {
+	childCtx := WithChildSpan(ctx, name)
+	span := &InProcSpan{
+		Name:         name,
+		Category:     category,
+		StartTime:    time.Now(),
+		Properties:   make(map[string]string),
+		Measurements: make(map[string]float64),
+		ctx:          childCtx,
+		client:       client,
+	}
+
+	return childCtx, span
+}
+
+// End tracks the span as an InProc dependency.  The dependency is marked as
+// failed if err is non-nil.  Only the first call has any effect.
+func (span *InProcSpan) End(err error) {
+	span.once.Do(func() {
+		dependency := NewInProcDependencyTelemetry(span.ctx, span.Name, err == nil)
+		dependency.Target = span.Category
+		dependency.MarkTime(span.StartTime, time.Now())
+
+		for k, v := range span.Properties {
+			dependency.Properties[k] = v
+		}
+		for k, v := range span.Measurements {
+			dependency.Measurements[k] = v
+		}
+		if err != nil {
+			dependency.Properties["error"] = err.Error()
+		}
+
+		span.client.TrackWithContext(span.ctx, dependency)
+	})
+}
+
+// TemplateExecutor is implemented by both text/template and html/template
+// templates.
+type TemplateExecutor interface {
+	Name() string
+	Execute(wr io.Writer, data interface{}) error
+}
+
+// ExecuteTemplate renders tmpl to w and tracks the rendering as an InProc
+// dependency named after the template.
+func ExecuteTemplate(ctx context.Context, tmpl TemplateExecutor, w io.Writer, data interface{}, client ContextTracker) error {
+	_, span := StartInProcSpan(ctx, tmpl.Name(), InProcCategoryTemplate, client)
+	err := tmpl.Execute(w, data)
+	span.End(err)
+	return err
+}
@@ -0,0 +1,80 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"text/template"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestStartInProcSpan(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	parent := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), parent)
+
+	spanCtx, span := StartInProcSpan(ctx, "serialize-order", InProcCategorySerialization, client)
+	span.Measurements["bytes"] = 512
+
+	// A nested span is a child of the outer one
+	_, inner := StartInProcSpan(spanCtx, "sign-order", InProcCategoryCrypto, client)
+	inner.End(errors.New("bad key"))
+
+	span.End(nil)
+	span.End(nil)
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected 2 dependencies, got %d", testChannel.getSentCount())
+	}
+
+	innerEnvelope := testChannel.sentItems[0]
+	innerData := innerEnvelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if innerData.Type != DependencyTypeInProc || innerData.Target != InProcCategoryCrypto || innerData.Success {
+		t.Errorf("Unexpected inner dependency: %+v", innerData)
+	}
+	if innerData.Properties["error"] != "bad key" {
+		t.Errorf("Expected error property, got %v", innerData.Properties)
+	}
+
+	outerEnvelope := testChannel.sentItems[1]
+	outerData := outerEnvelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if outerData.Name != "serialize-order" || outerData.Target != InProcCategorySerialization || !outerData.Success {
+		t.Errorf("Unexpected outer dependency: %+v", outerData)
+	}
+	if outerData.Measurements["bytes"] != 512 {
+		t.Error("Expected measurement to be tracked")
+	}
+	if outerData.Id != GetCorrelationContext(spanCtx).SpanID {
+		t.Error("Expected dependency id to match the span")
+	}
+	if outerEnvelope.Tags[contracts.OperationParentId] != parent.SpanID {
+		t.Error("Expected outer span to be a child of the current operation")
+	}
+	if innerEnvelope.Tags[contracts.OperationParentId] != outerData.Id {
+		t.Error("Expected inner span to be a child of the outer span")
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	tmpl := template.Must(template.New("greeting").Parse("Hello, {{.}}!"))
+	var buf bytes.Buffer
+	if err := ExecuteTemplate(context.Background(), tmpl, &buf, "world", client); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if buf.String() != "Hello, world!" {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", testChannel.getSentCount())
+	}
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if data.Name != "greeting" || data.Target != InProcCategoryTemplate || !data.Success {
+		t.Errorf("Unexpected dependency: %+v", data)
+	}
+}
@@ -1,25 +1,14 @@
 package appinsights
 
 import (
-	"bytes"
-	"encoding/json"
-
 	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
 type telemetryBufferItems []*contracts.Envelope
 
+// serialize encodes the items as newline-delimited JSON.  Contract types
+// append their own encoding to a shared buffer, which avoids the reflection
+// and intermediate allocations of encoding/json.
 func (items telemetryBufferItems) serialize() []byte {
-	var result bytes.Buffer
-	encoder := json.NewEncoder(&result)
-
-	for _, item := range items {
-		end := result.Len()
-		if err := encoder.Encode(item); err != nil {
-			diagnosticsWriter.Printf("Telemetry item failed to serialize: %s", err.Error())
-			result.Truncate(end)
-		}
-	}
-
-	return result.Bytes()
+	return JSONEncoder{}.Encode(nil, items)
 }
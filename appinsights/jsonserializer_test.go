@@ -9,6 +9,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
 const test_ikey = "01234567-0000-89ab-cdef-000000000000"
@@ -32,6 +34,7 @@ func TestJsonSerializerEvents(t *testing.T) {
 
 	agg := NewAggregateMetricTelemetry("agg-metric")
 	agg.AddData([]float64{1, 2, 3})
+	agg.Namespace = "storage"
 	buffer.add(agg)
 
 	remdep := NewRemoteDependencyTelemetry("bing-remote-dep", "http", "www.bing.com", false)
@@ -91,6 +94,9 @@ func TestJsonSerializerEvents(t *testing.T) {
 	j[2].assertPath(t, "data.baseData.metrics.[0].count", 1)
 	j[2].assertPath(t, "data.baseData.metrics.[0].kind", 0)
 	j[2].assertPath(t, "data.baseData.metrics.[0].name", "a-metric")
+	if _, err := j[2].getPath("data.baseData.metrics.[0].ns"); err == nil {
+		t.Error("Expected no namespace on a metric without one")
+	}
 	j[2].assertPath(t, "data.baseData.ver", 2)
 
 	// Request
@@ -121,6 +127,7 @@ func TestJsonSerializerEvents(t *testing.T) {
 	j[4].assertPath(t, "data.baseData.metrics.[0].max", 3)
 	j[4].assertPath(t, "data.baseData.metrics.[0].stdDev", 0.8164)
 	j[4].assertPath(t, "data.baseData.metrics.[0].name", "agg-metric")
+	j[4].assertPath(t, "data.baseData.metrics.[0].ns", "storage")
 	j[4].assertPath(t, "data.baseData.ver", 2)
 
 	// Remote dependency
@@ -481,3 +488,229 @@ func (msg jsonMessage) getPath(path string) (interface{}, error) {
 
 	return obj, nil
 }
+
+// Types without the hand-written encoders, used to produce reference output
+// from encoding/json's reflection-based encoder.
+type (
+	reflectEnvelope         contracts.Envelope
+	reflectData             contracts.Data
+	reflectEventData        contracts.EventData
+	reflectMessageData      contracts.MessageData
+	reflectRequestData      contracts.RequestData
+	reflectDependencyData   contracts.RemoteDependencyData
+	reflectAvailabilityData contracts.AvailabilityData
+	reflectMetricData       contracts.MetricData
+	reflectDataPoint        contracts.DataPoint
+	reflectExceptionData    contracts.ExceptionData
+	reflectExceptionDetails contracts.ExceptionDetails
+	reflectStackFrame       contracts.StackFrame
+)
+
+// reflectionEncode encodes an envelope with encoding/json only.  Nested
+// slices still hold contract types, which are verified separately.
+func reflectionEncode(envelope *contracts.Envelope) ([]byte, error) {
+	data := envelope.Data.(*contracts.Data)
+	rdata := reflectData(*data)
+
+	switch baseData := data.BaseData.(type) {
+	case *contracts.EventData:
+		rdata.BaseData = (*reflectEventData)(baseData)
+	case *contracts.MessageData:
+		rdata.BaseData = (*reflectMessageData)(baseData)
+	case *contracts.RequestData:
+		rdata.BaseData = (*reflectRequestData)(baseData)
+	case *contracts.RemoteDependencyData:
+		rdata.BaseData = (*reflectDependencyData)(baseData)
+	case *contracts.AvailabilityData:
+		rdata.BaseData = (*reflectAvailabilityData)(baseData)
+	case *contracts.MetricData:
+		rdata.BaseData = (*reflectMetricData)(baseData)
+	case *contracts.ExceptionData:
+		rdata.BaseData = (*reflectExceptionData)(baseData)
+	}
+
+	renvelope := reflectEnvelope(*envelope)
+	renvelope.Data = &rdata
+	return json.Marshal(&renvelope)
+}
+
+const trickyString = "<a href=\"x\">&amp;</a> \\ \b\f\n\r\t\x01\x1f \u2028 \u2029 café \xff\xfe 日本"
+
+func serializerTestBuffer() telemetryBufferItems {
+	var buffer telemetryBufferItems
+
+	event := NewEventTelemetry(trickyString)
+	event.Properties[trickyString] = trickyString
+	event.Properties["a"] = "b"
+	event.Measurements["tiny"] = 1e-7
+	event.Measurements["huge"] = 1e21
+	event.Measurements["neg"] = -0.5
+	buffer.add(event)
+
+	trace := NewTraceTelemetry(trickyString, Critical)
+	trace.Properties["k"] = "v"
+	buffer.add(trace)
+
+	req := NewRequestTelemetry("GET", "http://example.com/a?b=<c>", 1234*time.Millisecond, "500")
+	req.Source = trickyString
+	req.Measurements["m"] = 3.25
+	buffer.add(req)
+
+	dep := NewRemoteDependencyTelemetry("dep", "SQL", "db", true)
+	dep.Data = trickyString
+	buffer.add(dep)
+
+	avail := NewAvailabilityTelemetry("avail", time.Second, false)
+	avail.Message = trickyString
+	buffer.add(avail)
+
+	agg := NewAggregateMetricTelemetry("agg")
+	agg.AddData([]float64{0.000001, 2.5, 1e22})
+	agg.Namespace = trickyString
+	buffer.add(agg)
+
+	exc := NewExceptionTelemetry(fmt.Errorf("boom: %s", trickyString))
+	buffer.add(exc)
+
+	// Empty and nil collections
+	empty := NewEventTelemetry("")
+	empty.Properties = nil
+	buffer.add(empty)
+
+	return buffer
+}
+
+func TestJsonSerializerMatchesEncodingJson(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	for i, envelope := range serializerTestBuffer() {
+		actual, err := envelope.AppendJSON(nil)
+		if err != nil {
+			t.Fatalf("Item %d: unexpected error: %s", i, err)
+		}
+
+		expected, err := reflectionEncode(envelope)
+		if err != nil {
+			t.Fatalf("Item %d: reference encoding failed: %s", i, err)
+		}
+
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("Item %d: encoding mismatch\nexpected: %s\nactual:   %s", i, expected, actual)
+		}
+	}
+}
+
+func TestJsonSerializerNestedTypesMatchEncodingJson(t *testing.T) {
+	point := &contracts.DataPoint{Ns: "ns", Name: trickyString, Kind: contracts.Aggregation, Value: 1e-9, Count: 3, Min: -1e21, Max: 123456789.125, StdDev: 0}
+	frame := &contracts.StackFrame{Level: 2, Method: trickyString, Assembly: "asm", FileName: "/a/<b>.go", Line: 42}
+	details := &contracts.ExceptionDetails{Id: 1, OuterId: 2, TypeName: "*errors.errorString", Message: trickyString, HasFullStack: true, Stack: "stack"}
+
+	tests := []struct {
+		name      string
+		actual    func() ([]byte, error)
+		reference interface{}
+	}{
+		{"DataPoint", point.MarshalJSON, (*reflectDataPoint)(point)},
+		{"StackFrame", frame.MarshalJSON, (*reflectStackFrame)(frame)},
+		{"ExceptionDetails without stack", details.MarshalJSON, (*reflectExceptionDetails)(details)},
+	}
+
+	for _, tst := range tests {
+		actual, err := tst.actual()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tst.name, err)
+		}
+
+		expected, err := json.Marshal(tst.reference)
+		if err != nil {
+			t.Fatalf("%s: reference encoding failed: %s", tst.name, err)
+		}
+
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("%s: encoding mismatch\nexpected: %s\nactual:   %s", tst.name, expected, actual)
+		}
+	}
+}
+
+func TestJsonSerializerPageView(t *testing.T) {
+	data := contracts.NewPageViewData()
+	data.Name = "view"
+	data.Url = "http://bing.com/?a=1&b=2"
+	data.Duration = "0.00:00:01.0000000"
+	data.Properties = map[string]string{"p": "v"}
+
+	actual, err := data.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `{"ver":2,"name":"view","properties":{"p":"v"},"url":"http://bing.com/?a=1\u0026b=2","duration":"0.00:00:01.0000000"}`
+	if string(actual) != expected {
+		t.Errorf("Encoding mismatch\nexpected: %s\nactual:   %s", expected, actual)
+	}
+}
+
+func TestJsonSerializerUnsupportedValue(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	var buffer telemetryBufferItems
+	buffer.add(NewMetricTelemetry("before", 1))
+	buffer.add(NewMetricTelemetry("nan", math.NaN()))
+	buffer.add(NewMetricTelemetry("after", 2))
+
+	j, err := parsePayload(buffer.serialize())
+	if err != nil {
+		t.Fatalf("Error parsing payload: %s", err.Error())
+	}
+
+	if len(j) != 2 {
+		t.Fatalf("Expected unsupported item to be dropped, got %d items", len(j))
+	}
+
+	j[0].assertPath(t, "data.baseData.metrics.<len>", 1)
+	j[0].assertPath(t, "data.baseData.metrics.[0].name", "before")
+	j[1].assertPath(t, "data.baseData.metrics.[0].name", "after")
+}
+
+func benchmarkSerializerBuffer() telemetryBufferItems {
+	var buffer telemetryBufferItems
+	for i := 0; i < 500; i++ {
+		req := NewRequestTelemetry("GET", "http://example.com/api/items/"+strconv.Itoa(i), time.Duration(i)*time.Millisecond, "200")
+		req.Properties["tenant"] = "contoso"
+		req.Properties["route"] = "/api/items/{id}"
+		req.Measurements["bytes"] = float64(i * 100)
+		dep := NewRemoteDependencyTelemetry("SELECT items", "SQL", "db.internal", true)
+		dep.Data = "SELECT * FROM items WHERE id = @id"
+		dep.Properties["attempt"] = "1"
+		buffer.add(req, dep, NewTraceTelemetry("processed item "+strconv.Itoa(i), Information))
+	}
+
+	return buffer
+}
+
+func BenchmarkJsonSerializer(b *testing.B) {
+	buffer := benchmarkSerializerBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buffer.serialize()
+	}
+}
+
+func BenchmarkJsonSerializerReflection(b *testing.B) {
+	buffer := benchmarkSerializerBuffer()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var result bytes.Buffer
+		for _, item := range buffer {
+			encoded, _ := reflectionEncode(item)
+			result.Write(encoded)
+			result.WriteByte('\n')
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// JWTClaimsParser returns the claims of the validated JWT carried by a
+// request, or nil if the request carries none.  The SDK never parses or
+// validates tokens itself: the parser is expected to reuse the application's
+// own validation so that claims of forged tokens are never recorded.
+type JWTClaimsParser func(r *http.Request) (map[string]interface{}, error)
+
+// JWTClaimsEnrichment extracts selected claims from validated JWTs into the
+// user and session tags of request telemetry, and into properties of all
+// telemetry tracked with the request context.  Set it as
+// HTTPMiddleware.JWTClaims to opt in.
+type JWTClaimsEnrichment struct {
+	// Parse returns the validated claims of a request.  Required.
+	Parse JWTClaimsParser
+
+	// Claim recorded as the authenticated user ID.  Not recorded if empty.
+	UserIDClaim string
+
+	// Claim recorded as the user account ID.  Not recorded if empty.
+	AccountIDClaim string
+
+	// Claim recorded as the session ID.  Not recorded if empty.
+	SessionIDClaim string
+
+	// Maps claims to the names of the properties they are recorded as.
+	// Multi-valued claims are joined with commas.
+	PropertyClaims map[string]string
+}
+
+// NewJWTClaimsEnrichment creates an enrichment recording the "sub" claim as
+// the authenticated user ID, "tid" as the account ID, "sid" as the session ID,
+// and "roles" as the auth.roles property.
+func NewJWTClaimsEnrichment(parse JWTClaimsParser) *JWTClaimsEnrichment {
+	return &JWTClaimsEnrichment{
+		Parse:          parse,
+		UserIDClaim:    "sub",
+		AccountIDClaim: "tid",
+		SessionIDClaim: "sid",
+		PropertyClaims: map[string]string{"roles": "auth.roles"},
+	}
+}
+
+// jwtIdentity holds the claims extracted from a request
+type jwtIdentity struct {
+	userID    string
+	accountID string
+	sessionID string
+}
+
+type jwtIdentityContextKey struct{}
+
+// withClaims parses the claims of a request and adds the extracted identity
+// and properties to ctx
+func (enrichment *JWTClaimsEnrichment) withClaims(ctx context.Context, r *http.Request) context.Context {
+	if enrichment.Parse == nil {
+		return ctx
+	}
+
+	claims, err := enrichment.Parse(r)
+	if err != nil {
+		diagnosticsWriter.Printf("Failed to parse JWT claims: %s", err.Error())
+		return ctx
+	}
+	if len(claims) == 0 {
+		return ctx
+	}
+
+	identity := &jwtIdentity{
+		userID:    claimValue(claims, enrichment.UserIDClaim),
+		accountID: claimValue(claims, enrichment.AccountIDClaim),
+		sessionID: claimValue(claims, enrichment.SessionIDClaim),
+	}
+	ctx = context.WithValue(ctx, jwtIdentityContextKey{}, identity)
+
+	properties := make(map[string]string)
+	for claim, property := range enrichment.PropertyClaims {
+		if value := claimValue(claims, claim); value != "" {
+			properties[property] = value
+		}
+	}
+	if len(properties) > 0 {
+		ctx = WithOperationProperties(ctx, properties)
+	}
+
+	return ctx
+}
+
+// applyJWTIdentity records the identity extracted from the request's claims
+// on its telemetry
+func applyJWTIdentity(ctx context.Context, request *RequestTelemetry) {
+	identity, ok := ctx.Value(jwtIdentityContextKey{}).(*jwtIdentity)
+	if !ok {
+		return
+	}
+
+	if identity.userID != "" {
+		request.Tags.User().SetAuthUserId(identity.userID)
+	}
+	if identity.accountID != "" {
+		request.Tags.User().SetAccountId(identity.accountID)
+	}
+	if identity.sessionID != "" {
+		request.Tags.Session().SetId(identity.sessionID)
+	}
+}
+
+// claimValue formats a claim as a string.  Returns an empty string if the
+// claim is missing.
+func claimValue(claims map[string]interface{}, claim string) string {
+	if claim == "" {
+		return ""
+	}
+
+	switch value := claims[claim].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
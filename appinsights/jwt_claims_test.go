@@ -0,0 +1,105 @@
+package appinsights
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestJWTClaimsEnrichment(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	middleware := NewHTTPMiddleware()
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+	middleware.JWTClaims = NewJWTClaimsEnrichment(func(r *http.Request) (map[string]interface{}, error) {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return nil, nil
+		case "Bearer valid":
+			return map[string]interface{}{
+				"sub":   "user-1",
+				"tid":   "tenant-1",
+				"roles": []interface{}{"reader", "writer"},
+			}, nil
+		default:
+			return nil, errors.New("invalid token")
+		}
+	})
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.TrackWithContext(r.Context(), NewTraceTelemetry("handling", Information))
+	}))
+
+	serve := func(authorization string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("Bearer valid")
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected 2 items, got %d", testChannel.getSentCount())
+	}
+
+	trace := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.MessageData)
+	if trace.Properties["auth.roles"] != "reader,writer" {
+		t.Errorf("Expected roles on the trace, got %q", trace.Properties["auth.roles"])
+	}
+
+	request := testChannel.sentItems[1]
+	if request.Tags[contracts.UserAuthUserId] != "user-1" || request.Tags[contracts.UserAccountId] != "tenant-1" {
+		t.Errorf("Unexpected user tags: %v", request.Tags)
+	}
+	if _, ok := request.Tags[contracts.SessionId]; ok {
+		t.Error("Expected no session ID without a sid claim")
+	}
+	requestData := request.Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if requestData.Properties["auth.roles"] != "reader,writer" {
+		t.Errorf("Expected roles on the request, got %q", requestData.Properties["auth.roles"])
+	}
+
+	// Anonymous and invalid tokens record nothing
+	for _, authorization := range []string{"", "Bearer forged"} {
+		testChannel.reset()
+		serve(authorization)
+
+		request := testChannel.sentItems[1]
+		if _, ok := request.Tags[contracts.UserAuthUserId]; ok {
+			t.Errorf("%q: expected no user ID", authorization)
+		}
+		requestData := request.Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+		if _, ok := requestData.Properties["auth.roles"]; ok {
+			t.Errorf("%q: expected no roles", authorization)
+		}
+	}
+}
+
+func TestClaimValue(t *testing.T) {
+	claims := map[string]interface{}{
+		"sub":   "abc",
+		"roles": []string{"a", "b"},
+		"exp":   1700000000,
+	}
+
+	tests := []struct {
+		claim    string
+		expected string
+	}{
+		{"sub", "abc"},
+		{"roles", "a,b"},
+		{"exp", "1700000000"},
+		{"missing", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if value := claimValue(claims, test.claim); value != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.claim, test.expected, value)
+		}
+	}
+}
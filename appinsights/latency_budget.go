@@ -0,0 +1,101 @@
+package appinsights
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Request annotations recording whether a request stayed within its latency
+// budget
+const (
+	// SLABreachedProperty is "true" if the request exceeded its budget and
+	// "false" otherwise
+	SLABreachedProperty = "slaBreached"
+
+	// SLABudgetMeasurement holds the request's budget in milliseconds
+	SLABudgetMeasurement = "budgetMs"
+)
+
+// SLABreachEventName is the name of the event tracked when a request
+// exceeds its latency budget.
+const SLABreachEventName = "SLABreach"
+
+// LatencyBudgets declares the latency budget of operations.  Requests with a
+// budget are annotated with SLABreachedProperty and SLABudgetMeasurement, so
+// that burn rates can be charted by counting breached requests against all
+// budgeted requests.  Budgets must not be modified while in use.
+type LatencyBudgets struct {
+	// Budgets by operation name, e.g. "GET /orders"
+	Budgets map[string]time.Duration
+
+	// Budget for operations not listed in Budgets.  Zero means such
+	// operations have no budget.
+	Default time.Duration
+
+	// Whether to track an SLABreachEventName event, linked to the request,
+	// for each request that exceeds its budget
+	TrackBreachEvents bool
+}
+
+// NewLatencyBudgets creates an empty set of latency budgets.
+func NewLatencyBudgets() *LatencyBudgets {
+	return &LatencyBudgets{
+		Budgets: make(map[string]time.Duration),
+	}
+}
+
+// Set declares the budget of an operation.  Returns the receiver so that
+// calls can be chained.
+func (budgets *LatencyBudgets) Set(operationName string, budget time.Duration) *LatencyBudgets {
+	if budgets.Budgets == nil {
+		budgets.Budgets = make(map[string]time.Duration)
+	}
+
+	budgets.Budgets[operationName] = budget
+	return budgets
+}
+
+// Budget returns the budget of an operation, if it has one.
+func (budgets *LatencyBudgets) Budget(operationName string) (time.Duration, bool) {
+	if budget, ok := budgets.Budgets[operationName]; ok && budget > 0 {
+		return budget, true
+	}
+
+	if budgets.Default > 0 {
+		return budgets.Default, true
+	}
+
+	return 0, false
+}
+
+// apply annotates a request with its budget.  Returns the budget and whether
+// the request exceeded it.
+func (budgets *LatencyBudgets) apply(request *RequestTelemetry) (time.Duration, bool) {
+	budget, ok := budgets.Budget(request.Name)
+	if !ok {
+		return 0, false
+	}
+
+	breached := request.Duration > budget
+	request.Properties[SLABreachedProperty] = strconv.FormatBool(breached)
+	request.Measurements[SLABudgetMeasurement] = toMilliseconds(budget)
+
+	return budget, breached
+}
+
+// trackSLABreach tracks an event for a request that exceeded its budget,
+// linked to the request telemetry
+func trackSLABreach(ctx context.Context, client ContextTracker, request *RequestTelemetry, budget time.Duration) {
+	event := NewEventTelemetry(SLABreachEventName)
+	if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+		event.Tags.Operation().SetId(corrCtx.GetOperationID())
+	}
+	event.Tags.Operation().SetParentId(request.Id)
+	event.Properties["requestName"] = request.Name
+	event.Properties["responseCode"] = request.ResponseCode
+	event.Measurements["durationMs"] = toMilliseconds(request.Duration)
+	event.Measurements[SLABudgetMeasurement] = toMilliseconds(budget)
+
+	client.TrackWithContext(ctx, event)
+}
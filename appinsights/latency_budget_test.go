@@ -0,0 +1,85 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestLatencyBudgets(t *testing.T) {
+	budgets := NewLatencyBudgets().
+		Set("GET /slow", time.Millisecond).
+		Set("GET /fast", time.Hour)
+	budgets.TrackBreachEvents = true
+
+	if budget, ok := budgets.Budget("GET /other"); ok {
+		t.Errorf("Expected no budget for unlisted operation, got %s", budget)
+	}
+	budgets.Default = time.Minute
+	if budget, ok := budgets.Budget("GET /other"); !ok || budget != time.Minute {
+		t.Errorf("Expected default budget, got %s", budget)
+	}
+	budgets.Default = 0
+
+	client, testChannel := newTestClient()
+
+	middleware := NewHTTPMiddleware()
+	middleware.LatencyBudgets = budgets
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+
+	serve := func(path string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Within budget
+	serve("/fast")
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected only the request, got %d items", testChannel.getSentCount())
+	}
+	request := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.Properties[SLABreachedProperty] != "false" || request.Measurements[SLABudgetMeasurement] != 3600000 {
+		t.Errorf("Unexpected annotations: %v %v", request.Properties, request.Measurements)
+	}
+
+	// No budget
+	testChannel.reset()
+	serve("/other")
+	request = testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if _, ok := request.Properties[SLABreachedProperty]; ok {
+		t.Error("Expected requests without a budget not to be annotated")
+	}
+
+	// Breached
+	testChannel.reset()
+	serve("/slow")
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected request and breach event, got %d items", testChannel.getSentCount())
+	}
+	request = testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.Properties[SLABreachedProperty] != "true" || request.Measurements[SLABudgetMeasurement] != 1 {
+		t.Errorf("Unexpected annotations: %v %v", request.Properties, request.Measurements)
+	}
+
+	envelope := testChannel.sentItems[1]
+	event := envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Name != SLABreachEventName || event.Properties["requestName"] != "GET /slow" {
+		t.Errorf("Unexpected breach event: %+v", event)
+	}
+	if event.Measurements["durationMs"] < 5 || event.Measurements[SLABudgetMeasurement] != 1 {
+		t.Errorf("Unexpected breach event measurements: %v", event.Measurements)
+	}
+	if envelope.Tags[contracts.OperationParentId] != request.Id {
+		t.Error("Expected breach event to be a child of the request")
+	}
+	if envelope.Tags[contracts.OperationId] != testChannel.sentItems[0].Tags[contracts.OperationId] {
+		t.Error("Expected breach event to share the request's operation")
+	}
+}
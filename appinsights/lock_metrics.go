@@ -0,0 +1,277 @@
+package appinsights
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics reported by LockMetrics for each named lock
+const (
+	// LockWaitMetricName aggregates the time spent waiting for a lock that
+	// was held by someone else, in milliseconds
+	LockWaitMetricName = "lock.wait"
+
+	// LockContentionsMetricName counts the acquisitions that had to wait
+	LockContentionsMetricName = "lock.contentions"
+
+	// LockAcquisitionsMetricName counts all acquisitions
+	LockAcquisitionsMetricName = "lock.acquisitions"
+
+	// LockNameProperty holds the name of the lock
+	LockNameProperty = "lock.name"
+)
+
+// lockStats accumulates the acquisitions of a lock over an interval
+type lockStats struct {
+	acquisitions int64
+	contentions  int64
+	waitSum      float64
+	waitSumSq    float64
+	waitMin      float64
+	waitMax      float64
+}
+
+// LockMetrics creates instrumented locks and semaphores and aggregates how
+// often, and for how long, they are waited on.  This helps diagnose latency
+// that isn't attributable to dependencies.  LockMetrics is a
+// PerformanceCounterCollector: register it as a custom collector to report
+// the metrics of each named lock every collection interval.
+type LockMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*lockStats
+}
+
+// NewLockMetrics creates an empty set of lock metrics.
+func NewLockMetrics() *LockMetrics {
+	return &LockMetrics{
+		stats: make(map[string]*lockStats),
+	}
+}
+
+// NewMutex creates a mutex whose contention is reported under name.
+func (metrics *LockMetrics) NewMutex(name string) *InstrumentedMutex {
+	return &InstrumentedMutex{name: name, metrics: metrics}
+}
+
+// NewRWMutex creates a reader/writer mutex whose contention is reported
+// under name.
+func (metrics *LockMetrics) NewRWMutex(name string) *InstrumentedRWMutex {
+	return &InstrumentedRWMutex{name: name, metrics: metrics}
+}
+
+// NewSemaphore creates a semaphore with the specified number of slots whose
+// contention is reported under name.
+func (metrics *LockMetrics) NewSemaphore(name string, slots int) *InstrumentedSemaphore {
+	return &InstrumentedSemaphore{
+		name:    name,
+		metrics: metrics,
+		slots:   make(chan struct{}, slots),
+	}
+}
+
+// Name returns the collector name
+func (metrics *LockMetrics) Name() string {
+	return "Lock Metrics"
+}
+
+// Collect reports and resets the metrics of each lock acquired since the
+// last collection.
+func (metrics *LockMetrics) Collect(client TelemetryClient) {
+	metrics.mu.Lock()
+	stats := metrics.stats
+	metrics.stats = make(map[string]*lockStats)
+	metrics.mu.Unlock()
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := stats[name]
+
+		acquisitions := NewMetricTelemetry(LockAcquisitionsMetricName, float64(s.acquisitions))
+		acquisitions.Properties[LockNameProperty] = name
+		client.Track(acquisitions)
+
+		contentions := NewMetricTelemetry(LockContentionsMetricName, float64(s.contentions))
+		contentions.Properties[LockNameProperty] = name
+		client.Track(contentions)
+
+		if s.contentions == 0 {
+			continue
+		}
+
+		wait := NewAggregateMetricTelemetry(LockWaitMetricName)
+		wait.Unit = "ms"
+		wait.Value = s.waitSum
+		wait.Count = int(s.contentions)
+		wait.Min = s.waitMin
+		wait.Max = s.waitMax
+		mean := s.waitSum / float64(s.contentions)
+		wait.Variance = s.waitSumSq/float64(s.contentions) - mean*mean
+		wait.Properties[LockNameProperty] = name
+		client.Track(wait)
+	}
+}
+
+// record accumulates an acquisition of the named lock, and how long it
+// waited if the lock was contended
+func (metrics *LockMetrics) record(name string, contended bool, wait time.Duration) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	s, ok := metrics.stats[name]
+	if !ok {
+		s = &lockStats{}
+		metrics.stats[name] = s
+	}
+
+	s.acquisitions++
+	if !contended {
+		return
+	}
+
+	ms := float64(wait) / float64(time.Millisecond)
+	if s.contentions == 0 || ms < s.waitMin {
+		s.waitMin = ms
+	}
+	if ms > s.waitMax {
+		s.waitMax = ms
+	}
+
+	s.contentions++
+	s.waitSum += ms
+	s.waitSumSq += ms * ms
+}
+
+// InstrumentedMutex is a sync.Mutex that reports its contention to
+// LockMetrics.  Create one with LockMetrics.NewMutex.
+type InstrumentedMutex struct {
+	mu      sync.Mutex
+	name    string
+	metrics *LockMetrics
+}
+
+// Lock locks the mutex, recording how long it waited if the mutex was held.
+func (m *InstrumentedMutex) Lock() {
+	if m.mu.TryLock() {
+		m.metrics.record(m.name, false, 0)
+		return
+	}
+
+	start := time.Now()
+	m.mu.Lock()
+	m.metrics.record(m.name, true, time.Since(start))
+}
+
+// TryLock tries to lock the mutex without waiting.
+func (m *InstrumentedMutex) TryLock() bool {
+	if m.mu.TryLock() {
+		m.metrics.record(m.name, false, 0)
+		return true
+	}
+
+	return false
+}
+
+// Unlock unlocks the mutex.
+func (m *InstrumentedMutex) Unlock() {
+	m.mu.Unlock()
+}
+
+// InstrumentedRWMutex is a sync.RWMutex that reports its contention to
+// LockMetrics.  Readers and writers are reported under the same name.
+// Create one with LockMetrics.NewRWMutex.
+type InstrumentedRWMutex struct {
+	mu      sync.RWMutex
+	name    string
+	metrics *LockMetrics
+}
+
+// Lock locks the mutex for writing, recording how long it waited if the
+// mutex was held.
+func (m *InstrumentedRWMutex) Lock() {
+	if m.mu.TryLock() {
+		m.metrics.record(m.name, false, 0)
+		return
+	}
+
+	start := time.Now()
+	m.mu.Lock()
+	m.metrics.record(m.name, true, time.Since(start))
+}
+
+// Unlock unlocks the mutex for writing.
+func (m *InstrumentedRWMutex) Unlock() {
+	m.mu.Unlock()
+}
+
+// RLock locks the mutex for reading, recording how long it waited if the
+// mutex was held by a writer.
+func (m *InstrumentedRWMutex) RLock() {
+	if m.mu.TryRLock() {
+		m.metrics.record(m.name, false, 0)
+		return
+	}
+
+	start := time.Now()
+	m.mu.RLock()
+	m.metrics.record(m.name, true, time.Since(start))
+}
+
+// RUnlock unlocks the mutex for reading.
+func (m *InstrumentedRWMutex) RUnlock() {
+	m.mu.RUnlock()
+}
+
+// InstrumentedSemaphore limits concurrent access to a resource to a number
+// of slots, and reports its contention to LockMetrics.  Create one with
+// LockMetrics.NewSemaphore.
+type InstrumentedSemaphore struct {
+	name    string
+	metrics *LockMetrics
+	slots   chan struct{}
+}
+
+// Acquire takes a slot, waiting until one is free or ctx is done.
+func (s *InstrumentedSemaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		s.metrics.record(s.name, false, 0)
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	select {
+	case s.slots <- struct{}{}:
+		s.metrics.record(s.name, true, time.Since(start))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot if one is free, without waiting.
+func (s *InstrumentedSemaphore) TryAcquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		s.metrics.record(s.name, false, 0)
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire or TryAcquire.
+func (s *InstrumentedSemaphore) Release() {
+	<-s.slots
+}
@@ -0,0 +1,66 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestLockMetrics(t *testing.T) {
+	metrics := NewLockMetrics()
+	mutex := metrics.NewMutex("cache")
+
+	mutex.Lock()
+	locked := make(chan struct{})
+	go func() {
+		mutex.Lock()
+		close(locked)
+		mutex.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	mutex.Unlock()
+	<-locked
+
+	semaphore := metrics.NewSemaphore("pool", 1)
+	if !semaphore.TryAcquire() {
+		t.Fatal("Expected a free slot")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := semaphore.Acquire(ctx); err == nil {
+		t.Error("Expected the acquisition to time out")
+	}
+	semaphore.Release()
+
+	client, testChannel := newTestClient()
+
+	metrics.Collect(client)
+
+	values := make(map[string]*contracts.DataPoint)
+	for _, envelope := range testChannel.sentItems {
+		metric := envelope.Data.(*contracts.Data).BaseData.(*contracts.MetricData)
+		values[metric.Properties[LockNameProperty]+" "+metric.Metrics[0].Name] = metric.Metrics[0]
+	}
+
+	if len(values) != 5 {
+		t.Fatalf("Expected 5 metrics, got %d", len(values))
+	}
+	if values["cache lock.acquisitions"].Value != 2 || values["cache lock.contentions"].Value != 1 {
+		t.Errorf("Unexpected cache counts %v %v", values["cache lock.acquisitions"].Value, values["cache lock.contentions"].Value)
+	}
+	if wait := values["cache lock.wait"]; wait.Count != 1 || wait.Value < 5 {
+		t.Errorf("Expected a single wait of at least 5ms, got %d totaling %v", wait.Count, wait.Value)
+	}
+	if values["pool lock.acquisitions"].Value != 1 || values["pool lock.contentions"].Value != 0 {
+		t.Error("Expected timed out acquisitions not to be counted")
+	}
+
+	testChannel.reset()
+	metrics.Collect(client)
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected the metrics to be reset, got %d items", testChannel.getSentCount())
+	}
+}
@@ -0,0 +1,103 @@
+package appinsights
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Names of the log fields carrying the operation of the current request.
+// They match the column names in Log Analytics, so log search can join log
+// records with request telemetry.
+const (
+	LogOperationIDField       = "operation_Id"
+	LogOperationParentIDField = "operation_ParentId"
+)
+
+// LogFields returns the operation fields for the correlation context in
+// ctx, or nil if ctx doesn't carry one.  The result can be passed directly
+// to logrus:
+//
+//	logger.WithFields(logrus.Fields(appinsights.LogFields(ctx))).Info("...")
+func LogFields(ctx context.Context) map[string]interface{} {
+	corrCtx := GetCorrelationContext(ctx)
+	if corrCtx == nil {
+		return nil
+	}
+
+	fields := map[string]interface{}{LogOperationIDField: corrCtx.GetOperationID()}
+	if parentID := corrCtx.GetParentID(); parentID != "" {
+		fields[LogOperationParentIDField] = parentID
+	}
+
+	return fields
+}
+
+// LogKeyValues returns the operation fields for the correlation context in
+// ctx as alternating keys and values, or nil if ctx doesn't carry one.  The
+// result suits loggers taking loosely typed pairs, such as zap's
+// SugaredLogger and slog.Logger:
+//
+//	sugar.With(appinsights.LogKeyValues(ctx)...).Info("...")
+func LogKeyValues(ctx context.Context) []interface{} {
+	corrCtx := GetCorrelationContext(ctx)
+	if corrCtx == nil {
+		return nil
+	}
+
+	keyValues := []interface{}{LogOperationIDField, corrCtx.GetOperationID()}
+	if parentID := corrCtx.GetParentID(); parentID != "" {
+		keyValues = append(keyValues, LogOperationParentIDField, parentID)
+	}
+
+	return keyValues
+}
+
+// CorrelatedLogHandler is a slog.Handler adding the operation fields from
+// the context of each record before passing it on.  Records logged without
+// a context, or outside a request, are passed on unchanged.  Attributes
+// are added to the innermost open group, so wrap the handler before
+// calling WithGroup to keep them at the top level.
+type CorrelatedLogHandler struct {
+	next slog.Handler
+}
+
+// NewCorrelatedLogHandler wraps a slog.Handler to add operation fields to
+// its records:
+//
+//	logger := slog.New(appinsights.NewCorrelatedLogHandler(slog.NewJSONHandler(os.Stdout, nil)))
+//	logger.InfoContext(r.Context(), "...")
+func NewCorrelatedLogHandler(next slog.Handler) *CorrelatedLogHandler {
+	return &CorrelatedLogHandler{next: next}
+}
+
+// Enabled reports whether the wrapped handler handles records at level.
+func (h *CorrelatedLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the operation fields to the record and passes it on.
+func (h *CorrelatedLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+			record = record.Clone()
+			record.AddAttrs(slog.String(LogOperationIDField, corrCtx.GetOperationID()))
+			if parentID := corrCtx.GetParentID(); parentID != "" {
+				record.AddAttrs(slog.String(LogOperationParentIDField, parentID))
+			}
+		}
+	}
+
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a correlated handler wrapping the result of the wrapped
+// handler's WithAttrs.
+func (h *CorrelatedLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CorrelatedLogHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a correlated handler wrapping the result of the wrapped
+// handler's WithGroup.
+func (h *CorrelatedLogHandler) WithGroup(name string) slog.Handler {
+	return &CorrelatedLogHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLogFields(t *testing.T) {
+	if LogFields(context.Background()) != nil || LogKeyValues(context.Background()) != nil {
+		t.Error("Expected no fields outside an operation")
+	}
+
+	parent := NewCorrelationContext()
+	child := NewChildCorrelationContext(parent)
+	ctx := WithCorrelationContext(context.Background(), child)
+
+	fields := LogFields(ctx)
+	if fields[LogOperationIDField] != parent.TraceID || fields[LogOperationParentIDField] != parent.SpanID {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+
+	keyValues := LogKeyValues(ctx)
+	if len(keyValues) != 4 || keyValues[0] != LogOperationIDField || keyValues[1] != parent.TraceID ||
+		keyValues[2] != LogOperationParentIDField || keyValues[3] != parent.SpanID {
+		t.Errorf("Unexpected key values: %v", keyValues)
+	}
+
+	// Root operations have no parent
+	ctx = WithCorrelationContext(context.Background(), parent)
+	if fields := LogFields(ctx); len(fields) != 1 {
+		t.Errorf("Expected only the operation ID, got %v", fields)
+	}
+}
+
+func TestCorrelatedLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelatedLogHandler(slog.NewJSONHandler(&buf, nil))).With("service", "orders")
+
+	corrCtx := NewChildCorrelationContext(NewCorrelationContext())
+	logger.InfoContext(WithCorrelationContext(context.Background(), corrCtx), "in request")
+	logger.Info("outside request")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(lines))
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(lines[0], &record); err != nil {
+		t.Fatal(err)
+	}
+	if record[LogOperationIDField] != corrCtx.GetOperationID() || record[LogOperationParentIDField] != corrCtx.GetParentID() {
+		t.Errorf("Expected operation fields, got %v", record)
+	}
+	if record["service"] != "orders" {
+		t.Errorf("Expected attributes to be preserved, got %v", record)
+	}
+
+	record = nil
+	if err := json.Unmarshal(lines[1], &record); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record[LogOperationIDField]; ok {
+		t.Errorf("Expected no operation fields, got %v", record)
+	}
+}
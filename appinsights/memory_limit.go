@@ -0,0 +1,88 @@
+package appinsights
+
+import (
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// BackpressurePolicy determines which telemetry is discarded when the
+// channel cannot hold any more.
+type BackpressurePolicy int
+
+const (
+	// BackpressureDropNewest discards incoming telemetry until enough
+	// pending telemetry has been transmitted.  This is the default.
+	BackpressureDropNewest BackpressurePolicy = iota
+
+	// BackpressureDropOldest discards the oldest telemetry that has not yet
+	// been handed to the transmitter to make room for incoming telemetry.
+	BackpressureDropOldest
+)
+
+// Fixed per-item overhead used when estimating envelope sizes.  Accounts for
+// field names, punctuation, and numeric fields in the serialized form.
+const envelopeSizeOverhead = 256
+
+// estimateEnvelopeSize approximates the memory held by an envelope, based on
+// the length of its variable-sized fields.  The estimate tracks the size of
+// the serialized form closely enough to bound memory use without encoding
+// each item.
+func estimateEnvelopeSize(envelope *contracts.Envelope) int64 {
+	size := envelopeSizeOverhead + len(envelope.Name) + len(envelope.Time) + len(envelope.IKey) + len(envelope.Seq)
+	size += stringMapSize(envelope.Tags)
+
+	if data, ok := envelope.Data.(*contracts.Data); ok {
+		size += len(data.BaseType)
+
+		switch baseData := data.BaseData.(type) {
+		case *contracts.EventData:
+			size += len(baseData.Name) + stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		case *contracts.PageViewData:
+			size += len(baseData.Name) + len(baseData.Url) + len(baseData.Duration) +
+				stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		case *contracts.MessageData:
+			size += len(baseData.Message) + stringMapSize(baseData.Properties)
+		case *contracts.RequestData:
+			size += len(baseData.Id) + len(baseData.Source) + len(baseData.Name) + len(baseData.Duration) +
+				len(baseData.ResponseCode) + len(baseData.Url) +
+				stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		case *contracts.RemoteDependencyData:
+			size += len(baseData.Name) + len(baseData.Id) + len(baseData.ResultCode) + len(baseData.Duration) +
+				len(baseData.Data) + len(baseData.Target) + len(baseData.Type) +
+				stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		case *contracts.AvailabilityData:
+			size += len(baseData.Id) + len(baseData.Name) + len(baseData.Duration) + len(baseData.RunLocation) +
+				len(baseData.Message) + stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		case *contracts.MetricData:
+			for _, point := range baseData.Metrics {
+				size += 96 + len(point.Name)
+			}
+			size += stringMapSize(baseData.Properties)
+		case *contracts.ExceptionData:
+			for _, details := range baseData.Exceptions {
+				size += 64 + len(details.TypeName) + len(details.Message) + len(details.Stack)
+				for _, frame := range details.ParsedStack {
+					size += 64 + len(frame.Method) + len(frame.Assembly) + len(frame.FileName)
+				}
+			}
+			size += len(baseData.ProblemId) + stringMapSize(baseData.Properties) + floatMapSize(baseData.Measurements)
+		}
+	}
+
+	return int64(size)
+}
+
+func stringMapSize(m map[string]string) int {
+	size := 0
+	for k, v := range m {
+		size += len(k) + len(v) + 6
+	}
+	return size
+}
+
+func floatMapSize(m map[string]float64) int {
+	size := 0
+	for k := range m {
+		size += len(k) + 24
+	}
+	return size
+}
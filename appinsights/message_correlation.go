@@ -0,0 +1,190 @@
+package appinsights
+
+import (
+	"context"
+	"strings"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Application properties that carry correlation across message-based hops,
+// such as queues and topics.  These follow the conventions of the Azure
+// messaging SDKs so that producers and consumers instrumented by other
+// Application Insights SDKs interoperate.
+const (
+	// MessageTraceParentProperty carries the W3C traceparent of the send
+	MessageTraceParentProperty = TraceParentHeader
+
+	// MessageDiagnosticIDProperty carries the Request-Id of the send
+	MessageDiagnosticIDProperty = "Diagnostic-Id"
+
+	// MessageRequestContextProperty carries the producer's application ID
+	// and role name, in the format of the Request-Context header
+	MessageRequestContextProperty = RequestContextHeader
+)
+
+// Properties of the request telemetry of processed messages
+const (
+	// MessageSourceAppIDProperty holds the application ID of the producer
+	MessageSourceAppIDProperty = "sourceAppId"
+
+	// MessageSourceRoleNameProperty holds the role name of the producer
+	MessageSourceRoleNameProperty = "sourceRoleName"
+)
+
+// requestContextAppIDPrefix prefixes application IDs in Request-Context
+const requestContextAppIDPrefix = "cid-v1:"
+
+// MessageSource describes the producer of a message, as recorded in its
+// properties by NewMessageSendTelemetry.
+type MessageSource struct {
+	// Correlation context of the send, or nil if the message carries none
+	Correlation *CorrelationContext
+
+	// Application ID of the producer
+	AppID string
+
+	// Cloud role name of the producer
+	RoleName string
+}
+
+// MessageEndpoint returns the name that identifies an entity, such as a
+// queue or topic, on a broker.  It is the target of dependencies that send
+// to the entity and the source of requests that process its messages, which
+// lets the application map connect producers and consumers through the
+// broker.
+func MessageEndpoint(broker, entity string) string {
+	return broker + " | " + entity
+}
+
+// NewMessageSendTelemetry starts a child span for sending a message to
+// entity on broker, and records its correlation and the client's identity
+// in the message properties.  The returned dependency should be tracked with
+// the returned context once the message has been sent.
+func NewMessageSendTelemetry(ctx context.Context, client TelemetryClient, dependencyType, broker, entity string, properties map[string]string) (context.Context, *RemoteDependencyTelemetry) {
+	var corrCtx *CorrelationContext
+	if parent := GetCorrelationContext(ctx); parent != nil {
+		corrCtx = NewChildCorrelationContext(parent)
+	} else {
+		corrCtx = NewCorrelationContext()
+	}
+
+	ctx = WithCorrelationContext(ctx, corrCtx)
+	dependency := NewRemoteDependencyTelemetryWithContext(ctx, "Send "+entity, dependencyType, MessageEndpoint(broker, entity), true)
+	InjectMessageProperties(ctx, client, properties)
+
+	return ctx, dependency
+}
+
+// InjectMessageProperties records the correlation context of ctx and the
+// application ID and role name of client in the message properties.
+func InjectMessageProperties(ctx context.Context, client TelemetryClient, properties map[string]string) {
+	if properties == nil {
+		return
+	}
+
+	if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+		properties[MessageTraceParentProperty] = corrCtx.ToW3CTraceParent()
+		properties[MessageDiagnosticIDProperty] = corrCtx.ToRequestID()
+	}
+
+	if client != nil {
+		appId, _ := client.Context().GetTag(contracts.ApplicationId)
+		roleName, _ := client.Context().GetTag(contracts.CloudRole)
+		if value := FormatRequestContext(appId, roleName); value != "" {
+			properties[MessageRequestContextProperty] = value
+		}
+	}
+}
+
+// ExtractMessageSource reads the producer of a message from its properties.
+func ExtractMessageSource(properties map[string]string) *MessageSource {
+	source := &MessageSource{}
+
+	if traceParent := properties[MessageTraceParentProperty]; traceParent != "" {
+		if corrCtx, err := parseW3CTraceParent(traceParent); err == nil {
+			corrCtx.Normalize()
+			source.Correlation = corrCtx
+		}
+	}
+
+	if source.Correlation == nil {
+		if diagnosticID := properties[MessageDiagnosticIDProperty]; diagnosticID != "" {
+			if corrCtx, err := ParseRequestID(diagnosticID); err == nil {
+				source.Correlation = corrCtx
+			}
+		}
+	}
+
+	source.AppID, source.RoleName = ParseRequestContext(properties[MessageRequestContextProperty])
+	return source
+}
+
+// NewMessageProcessTelemetry starts the operation that processes a message
+// received from entity on broker.  The returned request continues the
+// producer's trace and records the producer's identity, and should be
+// tracked with the returned context once the message has been processed.
+func NewMessageProcessTelemetry(ctx context.Context, broker, entity string, properties map[string]string) (context.Context, *RequestTelemetry) {
+	source := ExtractMessageSource(properties)
+
+	var corrCtx *CorrelationContext
+	if source.Correlation != nil {
+		corrCtx = NewChildCorrelationContext(source.Correlation)
+	} else {
+		corrCtx = NewCorrelationContext()
+	}
+
+	name := "Process " + entity
+	corrCtx.OperationName = name
+	ctx = WithCorrelationContext(ctx, corrCtx)
+
+	request := NewRequestTelemetryWithContext(ctx, "", "", 0, "0")
+	request.Name = name
+	request.Source = MessageEndpoint(broker, entity)
+	request.Success = true
+	request.Tags.Operation().SetName(name)
+
+	if source.AppID != "" {
+		request.Properties[MessageSourceAppIDProperty] = source.AppID
+	}
+	if source.RoleName != "" {
+		request.Properties[MessageSourceRoleNameProperty] = source.RoleName
+	}
+
+	return ctx, request
+}
+
+// FormatRequestContext formats an application ID and role name in the
+// format of the Request-Context header, e.g.
+// "appId=cid-v1:<id>, roleName=<role>".  Empty values are omitted.
+func FormatRequestContext(appID, roleName string) string {
+	var parts []string
+	if appID != "" {
+		parts = append(parts, RequestContextCorrelationKey+"="+requestContextAppIDPrefix+appID)
+	}
+	if roleName != "" {
+		parts = append(parts, "roleName="+roleName)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// ParseRequestContext extracts the application ID and role name from a
+// Request-Context value.
+func ParseRequestContext(value string) (appID, roleName string) {
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case RequestContextCorrelationKey:
+			appID = strings.TrimPrefix(strings.TrimSpace(val), requestContextAppIDPrefix)
+		case "roleName":
+			roleName = strings.TrimSpace(val)
+		}
+	}
+
+	return appID, roleName
+}
@@ -0,0 +1,69 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestMessageCorrelationRoundTrip(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.ApplicationId = "producer-app"
+	producer := NewTelemetryClientFromConfig(config)
+	defer producer.Channel().Stop()
+	producer.Context().SetTag(contracts.CloudRole, "producer")
+
+	parent := NewCorrelationContext()
+	properties := make(map[string]string)
+	sendCtx, dependency := NewMessageSendTelemetry(WithCorrelationContext(context.Background(), parent), producer, DependencyTypeAzureServiceBus, "sb://contoso.servicebus.windows.net/", "orders", properties)
+
+	if dependency.Target != "sb://contoso.servicebus.windows.net/ | orders" {
+		t.Errorf("Unexpected target %q", dependency.Target)
+	}
+	if send := GetCorrelationContext(sendCtx); send.ParentSpanID != parent.SpanID || dependency.Id != send.SpanID {
+		t.Error("Expected the send to be a child span of the caller")
+	}
+	if properties[MessageRequestContextProperty] != "appId=cid-v1:producer-app, roleName=producer" {
+		t.Errorf("Unexpected Request-Context %q", properties[MessageRequestContextProperty])
+	}
+
+	processCtx, request := NewMessageProcessTelemetry(context.Background(), "sb://contoso.servicebus.windows.net/", "orders", properties)
+	if request.Source != dependency.Target {
+		t.Errorf("Expected the request source %q to match the dependency target", request.Source)
+	}
+	if request.Name != "Process orders" || !request.Success {
+		t.Errorf("Unexpected request %q %t", request.Name, request.Success)
+	}
+	if request.Properties[MessageSourceAppIDProperty] != "producer-app" || request.Properties[MessageSourceRoleNameProperty] != "producer" {
+		t.Errorf("Unexpected source properties %v", request.Properties)
+	}
+
+	process := GetCorrelationContext(processCtx)
+	if process.TraceID != parent.TraceID || process.ParentSpanID != dependency.Id || request.Id != process.SpanID {
+		t.Error("Expected the processing to continue the producer's trace")
+	}
+}
+
+func TestExtractMessageSourceDiagnosticID(t *testing.T) {
+	corrCtx := NewCorrelationContext()
+	source := ExtractMessageSource(map[string]string{MessageDiagnosticIDProperty: corrCtx.ToRequestID()})
+	if source.Correlation == nil || source.Correlation.GetOperationID() != corrCtx.GetOperationID() {
+		t.Error("Expected the Diagnostic-Id to be used without a traceparent")
+	}
+
+	if source := ExtractMessageSource(nil); source.Correlation != nil || source.AppID != "" {
+		t.Error("Expected an empty source without properties")
+	}
+}
+
+func TestParseRequestContext(t *testing.T) {
+	appID, roleName := ParseRequestContext(" roleName = worker ,appId=cid-v1:abc, other=value")
+	if appID != "abc" || roleName != "worker" {
+		t.Errorf("Unexpected app ID %q and role %q", appID, roleName)
+	}
+
+	if value := FormatRequestContext("", ""); value != "" {
+		t.Errorf("Expected an empty value, got %q", value)
+	}
+}
@@ -0,0 +1,173 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lifetimes of the cached endpoint metadata
+const (
+	appIDCacheTTL    = 24 * time.Hour
+	redirectCacheTTL = time.Hour
+
+	// Tokens are refreshed this long before they expire
+	tokenExpiryMargin = 5 * time.Minute
+)
+
+// MetadataCache stores endpoint metadata shared by telemetry clients: the
+// application IDs of instrumentation keys, ingestion redirect targets, and
+// access tokens.  Sharing one cache across the clients of a process, or a
+// distributed cache across a fleet, avoids querying the profile and token
+// endpoints on every start.  Implementations must be safe for concurrent
+// use, and should treat their own failures as cache misses.
+type MetadataCache interface {
+	// Get returns the value stored under key, if it hasn't expired.
+	Get(key string) (string, bool)
+
+	// Set stores a value under key for the specified duration.
+	Set(key, value string, ttl time.Duration)
+}
+
+// defaultMetadataCache is shared by all configurations that don't specify
+// a cache
+var defaultMetadataCache = NewMemoryMetadataCache()
+
+type memoryMetadataEntry struct {
+	value   string
+	expires time.Time
+}
+
+// MemoryMetadataCache is an in-process MetadataCache.
+type MemoryMetadataCache struct {
+	lock    sync.Mutex
+	entries map[string]memoryMetadataEntry
+}
+
+// NewMemoryMetadataCache creates an empty in-process cache.
+func NewMemoryMetadataCache() *MemoryMetadataCache {
+	return &MemoryMetadataCache{
+		entries: make(map[string]memoryMetadataEntry),
+	}
+}
+
+// Get returns the value stored under key, if it hasn't expired.
+func (cache *MemoryMetadataCache) Get(key string) (string, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	if !currentClock.Now().Before(entry.expires) {
+		delete(cache.entries, key)
+		return "", false
+	}
+
+	return entry.value, true
+}
+
+// Set stores a value under key for the specified duration.
+func (cache *MemoryMetadataCache) Set(key, value string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = memoryMetadataEntry{value, currentClock.Now().Add(ttl)}
+}
+
+// metadataCache returns the cache used by the configuration
+func (config *TelemetryConfiguration) metadataCache() MetadataCache {
+	if config.MetadataCache != nil {
+		return config.MetadataCache
+	}
+
+	return defaultMetadataCache
+}
+
+// TokenFetcher acquires an access token for the ingestion endpoint, such as
+// an Azure AD token, and returns it with its expiry.
+type TokenFetcher func(ctx context.Context) (token string, expiresOn time.Time, err error)
+
+// NewCachedTokenFetcher wraps fetch so that its tokens are shared through
+// the cache under key until shortly before they expire.
+func NewCachedTokenFetcher(cache MetadataCache, key string, fetch TokenFetcher) TokenFetcher {
+	return func(ctx context.Context) (string, time.Time, error) {
+		if token, ok := cache.Get(key); ok {
+			return token, time.Time{}, nil
+		}
+
+		token, expiresOn, err := fetch(ctx)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		cache.Set(key, token, expiresOn.Sub(currentClock.Now())-tokenExpiryMargin)
+		return token, expiresOn, nil
+	}
+}
+
+// ResolveApplicationID returns the application ID of the configuration's
+// instrumentation key.  The ID is taken from the configuration if set, then
+// from the metadata cache, and is otherwise queried from the profile
+// endpoint of the ingestion service and cached.
+func ResolveApplicationID(ctx context.Context, config *TelemetryConfiguration) (string, error) {
+	if config.ApplicationId != "" {
+		return config.ApplicationId, nil
+	}
+
+	cache := config.metadataCache()
+	key := "appId:" + config.InstrumentationKey
+	if appID, ok := cache.Get(key); ok {
+		return appID, nil
+	}
+
+	endpoint, err := url.Parse(config.EndpointUrl)
+	if err != nil {
+		return "", err
+	}
+
+	profileURL := endpoint.Scheme + "://" + endpoint.Host + "/api/profiles/" + url.PathEscape(config.InstrumentationKey) + "/appId"
+	req, err := http.NewRequestWithContext(SuppressTelemetry(ctx), "GET", profileURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("application ID lookup failed: %s", resp.Status)
+	}
+
+	appID := strings.TrimSpace(string(body))
+	if appID == "" {
+		return "", fmt.Errorf("application ID lookup returned an empty ID")
+	}
+
+	cache.Set(key, appID, appIDCacheTTL)
+	return appID, nil
+}
@@ -0,0 +1,126 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetadataCache(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	cache := NewMemoryMetadataCache()
+	cache.Set("key", "value", time.Minute)
+	cache.Set("ignored", "value", 0)
+
+	if value, ok := cache.Get("key"); !ok || value != "value" {
+		t.Errorf("Expected the cached value, got %q %t", value, ok)
+	}
+	if _, ok := cache.Get("ignored"); ok {
+		t.Error("Expected values without a lifetime not to be cached")
+	}
+
+	fakeClock.Increment(time.Minute)
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected the value to expire")
+	}
+}
+
+func TestCachedTokenFetcher(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	var fetches int
+	fetch := NewCachedTokenFetcher(NewMemoryMetadataCache(), "token", func(ctx context.Context) (string, time.Time, error) {
+		fetches++
+		return "token-" + strconv.Itoa(fetches), currentClock.Now().Add(time.Hour), nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if token, _, err := fetch(context.Background()); err != nil || token != "token-1" {
+			t.Fatalf("Expected the cached token, got %q %v", token, err)
+		}
+	}
+
+	// Refreshed ahead of expiry
+	fakeClock.Increment(time.Hour - tokenExpiryMargin)
+	if token, _, _ := fetch(context.Background()); token != "token-2" || fetches != 2 {
+		t.Errorf("Expected a refreshed token, got %q after %d fetches", token, fetches)
+	}
+}
+
+func TestResolveApplicationID(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		if r.URL.Path != "/api/profiles/"+test_ikey+"/appId" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("app-id\n"))
+	}))
+	defer server.Close()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey + ";IngestionEndpoint=" + server.URL)
+	config.MetadataCache = NewMemoryMetadataCache()
+
+	for i := 0; i < 2; i++ {
+		appID, err := ResolveApplicationID(context.Background(), config)
+		if err != nil || appID != "app-id" {
+			t.Fatalf("Expected app-id, got %q %v", appID, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected a single lookup, got %d", lookups)
+	}
+
+	config.ApplicationId = "configured"
+	if appID, _ := ResolveApplicationID(context.Background(), config); appID != "configured" {
+		t.Errorf("Expected the configured ID, got %q", appID)
+	}
+}
+
+func TestTransmitterRedirectAndToken(t *testing.T) {
+	var regionalHits, globalHits int32
+	var authorization atomic.Value
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&regionalHits, 1)
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Write([]byte(`{"itemsReceived":1,"itemsAccepted":1,"errors":[]}`))
+	}))
+	defer regional.Close()
+
+	global := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&globalHits, 1)
+		http.Redirect(w, r, regional.URL+"/v2/track", http.StatusPermanentRedirect)
+	}))
+	defer global.Close()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey + ";IngestionEndpoint=" + global.URL)
+	config.MetadataCache = NewMemoryMetadataCache()
+	config.AccessToken = func(ctx context.Context) (string, time.Time, error) {
+		return "secret", time.Now().Add(time.Hour), nil
+	}
+
+	channel := NewInMemoryChannel(config)
+	defer channel.Stop()
+
+	for i := 0; i < 2; i++ {
+		result, err := channel.transmitter.Transmit([]byte("{}"), telemetryBuffer(NewTraceTelemetry("message", Information)))
+		if err != nil || !result.IsSuccess() {
+			t.Fatalf("Expected the submission to succeed: %v", err)
+		}
+	}
+
+	if globalHits != 1 || regionalHits != 2 {
+		t.Errorf("Expected the redirect to be cached, got %d global and %d regional hits", globalHits, regionalHits)
+	}
+	if authorization.Load() != "Bearer secret" {
+		t.Errorf("Expected a bearer token, got %q", authorization.Load())
+	}
+}
@@ -0,0 +1,157 @@
+package appinsights
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// OperationTruncatedProperty is set on the request of an operation whose
+// telemetry exceeded its budget, to the number of items dropped.
+const OperationTruncatedProperty = "truncatedItemCount"
+
+// OperationBudgetConfig caps the number of telemetry items tracked within a
+// single operation, protecting against loops that emit unbounded child
+// telemetry for one request.  Items beyond the cap are dropped, and the
+// operation's request records how many were dropped.
+type OperationBudgetConfig struct {
+	// Maximum number of items tracked per operation, excluding its request.
+	// Defaults to 200.
+	MaxItemsPerOperation int
+
+	// Maximum number of operations counted at once.  The oldest operation
+	// is forgotten first.  Defaults to 10000.
+	MaxOperations int
+
+	// How long an operation is counted if its request is never tracked.
+	// Defaults to ten minutes.
+	MaxAge time.Duration
+}
+
+// NewOperationBudgetConfig creates a new configuration with default values.
+func NewOperationBudgetConfig() *OperationBudgetConfig {
+	return &OperationBudgetConfig{
+		MaxItemsPerOperation: 200,
+		MaxOperations:        10000,
+		MaxAge:               10 * time.Minute,
+	}
+}
+
+// operationUsage counts the items of an operation
+type operationUsage struct {
+	started time.Time
+	items   int
+	dropped int
+}
+
+// operationBudget enforces OperationBudgetConfig
+type operationBudget struct {
+	config OperationBudgetConfig
+
+	lock       sync.Mutex
+	operations map[string]*operationUsage
+
+	// Operation IDs in the order they were first seen
+	order []string
+}
+
+func newOperationBudget(config *OperationBudgetConfig) *operationBudget {
+	if config == nil {
+		return nil
+	}
+
+	defaults := NewOperationBudgetConfig()
+	resolved := *config
+	if resolved.MaxItemsPerOperation <= 0 {
+		resolved.MaxItemsPerOperation = defaults.MaxItemsPerOperation
+	}
+	if resolved.MaxOperations <= 0 {
+		resolved.MaxOperations = defaults.MaxOperations
+	}
+	if resolved.MaxAge <= 0 {
+		resolved.MaxAge = defaults.MaxAge
+	}
+
+	return &operationBudget{
+		config:     resolved,
+		operations: make(map[string]*operationUsage),
+	}
+}
+
+// admit returns whether an envelope fits in its operation's budget.
+// Requests are always admitted, and end their operation: if items were
+// dropped, the request is annotated with their number.
+func (budget *operationBudget) admit(envelope *contracts.Envelope) bool {
+	if budget == nil {
+		return true
+	}
+
+	operationID := envelope.Tags[contracts.OperationId]
+	if operationID == "" {
+		return true
+	}
+
+	budget.lock.Lock()
+	defer budget.lock.Unlock()
+
+	if isRequestEnvelope(envelope) {
+		if usage, ok := budget.operations[operationID]; ok {
+			if usage.dropped > 0 {
+				if properties := envelopeProperties(envelope); properties != nil {
+					properties[OperationTruncatedProperty] = strconv.Itoa(usage.dropped)
+				}
+			}
+
+			budget.remove(operationID)
+		}
+
+		return true
+	}
+
+	budget.expire()
+
+	usage, ok := budget.operations[operationID]
+	if !ok {
+		if len(budget.order) >= budget.config.MaxOperations {
+			budget.remove(budget.order[0])
+		}
+
+		usage = &operationUsage{started: currentClock.Now()}
+		budget.operations[operationID] = usage
+		budget.order = append(budget.order, operationID)
+	}
+
+	if usage.items >= budget.config.MaxItemsPerOperation {
+		if usage.dropped == 0 {
+			diagnosticsWriter.Printf("Operation %s exceeded its budget of %d telemetry items; further items are dropped", operationID, budget.config.MaxItemsPerOperation)
+		}
+
+		usage.dropped++
+		return false
+	}
+
+	usage.items++
+	return true
+}
+
+// expire forgets operations older than MaxAge.  Must be called with the
+// lock held.
+func (budget *operationBudget) expire() {
+	cutoff := currentClock.Now().Add(-budget.config.MaxAge)
+	for len(budget.order) > 0 && budget.operations[budget.order[0]].started.Before(cutoff) {
+		budget.remove(budget.order[0])
+	}
+}
+
+// remove forgets an operation.  Must be called with the lock held.
+func (budget *operationBudget) remove(operationID string) {
+	delete(budget.operations, operationID)
+	for i, id := range budget.order {
+		if id == operationID {
+			budget.order = append(budget.order[:i], budget.order[i+1:]...)
+			break
+		}
+	}
+}
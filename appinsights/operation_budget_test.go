@@ -0,0 +1,42 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestOperationBudget(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.OperationBudget = NewOperationBudgetConfig()
+	config.OperationBudget.MaxItemsPerOperation = 3
+	client, testChannel := newTestClient(config)
+
+	ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	for i := 0; i < 5; i++ {
+		client.TrackTraceWithContext(ctx, "loop", Information)
+	}
+
+	// Other operations have their own budget
+	other := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	client.TrackTraceWithContext(other, "other", Information)
+
+	client.TrackWithContext(ctx, NewRequestTelemetryWithContext(ctx, "GET", "/", time.Second, "200"))
+
+	if testChannel.getSentCount() != 5 {
+		t.Fatalf("Expected 3 traces, another operation's trace and the request, got %d items", testChannel.getSentCount())
+	}
+
+	request := testChannel.sentItems[4].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.Properties[OperationTruncatedProperty] != "2" {
+		t.Errorf("Expected the request to record 2 dropped items, got %q", request.Properties[OperationTruncatedProperty])
+	}
+
+	// The operation's budget ends with its request
+	client.TrackTraceWithContext(ctx, "after", Information)
+	if testChannel.getSentCount() != 6 {
+		t.Errorf("Expected the budget to be reset, got %d items", testChannel.getSentCount())
+	}
+}
@@ -0,0 +1,177 @@
+package appinsights
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OperationHeartbeatEventName is the name of the events tracked while a
+// long operation is in flight.
+const OperationHeartbeatEventName = "OperationHeartbeat"
+
+// Properties and measurements of operation heartbeat events
+const (
+	// HeartbeatOperationProperty holds the name of the operation
+	HeartbeatOperationProperty = "heartbeat.operation"
+
+	// HeartbeatSequenceProperty holds the 1-based number of the heartbeat
+	// within its operation
+	HeartbeatSequenceProperty = "heartbeat.sequence"
+
+	// HeartbeatElapsedMeasurement holds the time since the operation
+	// started, in milliseconds
+	HeartbeatElapsedMeasurement = "heartbeat.elapsedMs"
+
+	// HeartbeatBytesMeasurement holds the number of bytes processed since
+	// the operation started
+	HeartbeatBytesMeasurement = "heartbeat.bytes"
+
+	// HeartbeatItemsMeasurement holds the number of items handled since the
+	// operation started
+	HeartbeatItemsMeasurement = "heartbeat.items"
+)
+
+// OperationHeartbeatConfig configures when heartbeats are tracked for a
+// long operation.
+type OperationHeartbeatConfig struct {
+	// Operations finishing within this duration track no heartbeat.
+	// Defaults to one minute.
+	Threshold time.Duration
+
+	// Period between heartbeats once the threshold is exceeded.  Defaults
+	// to one minute.
+	Interval time.Duration
+}
+
+// NewOperationHeartbeatConfig creates a new configuration with default
+// values.
+func NewOperationHeartbeatConfig() *OperationHeartbeatConfig {
+	return &OperationHeartbeatConfig{
+		Threshold: time.Minute,
+		Interval:  time.Minute,
+	}
+}
+
+// OperationHeartbeat reports the progress of a long operation, such as a
+// streaming import or batch job, while it runs.  Once the operation exceeds
+// its threshold, an event recording the bytes processed and items handled
+// so far is tracked every interval as a child of the operation's span, so
+// that dashboards reflect in-flight work instead of nothing until the
+// operation completes.
+type OperationHeartbeat struct {
+	name   string
+	ctx    context.Context
+	client ContextTracker
+	start  time.Time
+
+	bytes atomic.Int64
+	items atomic.Int64
+
+	lock     sync.Mutex
+	sequence int
+	stopped  bool
+	timer    *time.Timer
+	interval time.Duration
+}
+
+// StartOperationHeartbeat starts reporting the progress of the operation
+// whose span is carried by ctx.  Report progress with AddBytes and
+// AddItems, and call Stop when the operation finishes.  A nil config uses
+// the defaults.
+func StartOperationHeartbeat(ctx context.Context, name string, client ContextTracker, config *OperationHeartbeatConfig) *OperationHeartbeat {
+	defaults := NewOperationHeartbeatConfig()
+	resolved := *defaults
+	if config != nil {
+		resolved = *config
+		if resolved.Threshold <= 0 {
+			resolved.Threshold = defaults.Threshold
+		}
+		if resolved.Interval <= 0 {
+			resolved.Interval = defaults.Interval
+		}
+	}
+
+	heartbeat := &OperationHeartbeat{
+		name:     name,
+		ctx:      ctx,
+		client:   client,
+		start:    time.Now(),
+		interval: resolved.Interval,
+	}
+
+	// The first beat waits for the timer to be recorded
+	heartbeat.lock.Lock()
+	heartbeat.timer = time.AfterFunc(resolved.Threshold, heartbeat.beat)
+	heartbeat.lock.Unlock()
+
+	return heartbeat
+}
+
+// AddBytes records that n more bytes were processed.
+func (heartbeat *OperationHeartbeat) AddBytes(n int64) {
+	if heartbeat != nil {
+		heartbeat.bytes.Add(n)
+	}
+}
+
+// AddItems records that n more items were handled.
+func (heartbeat *OperationHeartbeat) AddItems(n int64) {
+	if heartbeat != nil {
+		heartbeat.items.Add(n)
+	}
+}
+
+// Heartbeats returns the number of heartbeats tracked so far.
+func (heartbeat *OperationHeartbeat) Heartbeats() int {
+	if heartbeat == nil {
+		return 0
+	}
+
+	heartbeat.lock.Lock()
+	defer heartbeat.lock.Unlock()
+	return heartbeat.sequence
+}
+
+// Stop stops tracking heartbeats.  The operation's own telemetry reports
+// its completion.  Safe to call on nil and more than once.
+func (heartbeat *OperationHeartbeat) Stop() {
+	if heartbeat == nil {
+		return
+	}
+
+	heartbeat.lock.Lock()
+	defer heartbeat.lock.Unlock()
+
+	heartbeat.stopped = true
+	heartbeat.timer.Stop()
+}
+
+// beat tracks a heartbeat and schedules the next one
+func (heartbeat *OperationHeartbeat) beat() {
+	heartbeat.lock.Lock()
+	defer heartbeat.lock.Unlock()
+
+	if heartbeat.stopped {
+		return
+	}
+
+	heartbeat.sequence++
+
+	// Link the heartbeat to the operation's span rather than to its parent
+	event := NewEventTelemetry(OperationHeartbeatEventName)
+	if corrCtx := GetCorrelationContext(heartbeat.ctx); corrCtx != nil {
+		event.Tags.Operation().SetId(corrCtx.GetOperationID())
+		event.Tags.Operation().SetParentId(corrCtx.SpanID)
+	}
+	event.Properties[HeartbeatOperationProperty] = heartbeat.name
+	event.Properties[HeartbeatSequenceProperty] = strconv.Itoa(heartbeat.sequence)
+	event.Measurements[HeartbeatElapsedMeasurement] = float64(time.Since(heartbeat.start)) / float64(time.Millisecond)
+	event.Measurements[HeartbeatBytesMeasurement] = float64(heartbeat.bytes.Load())
+	event.Measurements[HeartbeatItemsMeasurement] = float64(heartbeat.items.Load())
+	heartbeat.client.TrackWithContext(heartbeat.ctx, event)
+
+	heartbeat.timer.Reset(heartbeat.interval)
+}
@@ -0,0 +1,92 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestOperationHeartbeat(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ctx := WithNewRootSpan(context.Background(), "import")
+	heartbeat := StartOperationHeartbeat(ctx, "import", client, &OperationHeartbeatConfig{
+		Threshold: 20 * time.Millisecond,
+		Interval:  10 * time.Millisecond,
+	})
+	heartbeat.AddBytes(1024)
+	heartbeat.AddItems(3)
+
+	deadline := time.Now().Add(time.Second)
+	for heartbeat.Heartbeats() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	heartbeat.Stop()
+	count := heartbeat.Heartbeats()
+	if count < 2 {
+		t.Fatalf("Expected periodic heartbeats, got %d", count)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if heartbeat.Heartbeats() != count || testChannel.getSentCount() != count {
+		t.Error("Expected no heartbeat after Stop")
+	}
+
+	first := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	second := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if first.Name != OperationHeartbeatEventName || first.Properties[HeartbeatOperationProperty] != "import" {
+		t.Errorf("Unexpected heartbeat %s for %q", first.Name, first.Properties[HeartbeatOperationProperty])
+	}
+	if first.Properties[HeartbeatSequenceProperty] != "1" || second.Properties[HeartbeatSequenceProperty] != "2" {
+		t.Error("Expected heartbeats to be numbered")
+	}
+	if first.Measurements[HeartbeatBytesMeasurement] != 1024 || first.Measurements[HeartbeatItemsMeasurement] != 3 {
+		t.Errorf("Unexpected progress %v", first.Measurements)
+	}
+	if first.Measurements[HeartbeatElapsedMeasurement] < 20 {
+		t.Errorf("Expected elapsed time past the threshold, got %v", first.Measurements[HeartbeatElapsedMeasurement])
+	}
+}
+
+func TestOperationHeartbeatShortOperation(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ctx := WithNewRootSpan(context.Background(), "quick")
+	heartbeat := StartOperationHeartbeat(ctx, "quick", client, &OperationHeartbeatConfig{Threshold: 50 * time.Millisecond})
+	heartbeat.AddItems(1)
+	heartbeat.Stop()
+	heartbeat.Stop()
+
+	time.Sleep(70 * time.Millisecond)
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected no heartbeat for a short operation, got %d items", testChannel.getSentCount())
+	}
+
+	var nilHeartbeat *OperationHeartbeat
+	nilHeartbeat.AddBytes(1)
+	nilHeartbeat.Stop()
+}
+
+func TestOperationHeartbeatParent(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+	heartbeat := StartOperationHeartbeat(ctx, "job", client, &OperationHeartbeatConfig{Threshold: time.Millisecond, Interval: time.Hour})
+	defer heartbeat.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for testChannel.getSentCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected a heartbeat, got %d items", testChannel.getSentCount())
+	}
+
+	tags := testChannel.sentItems[0].Tags
+	if tags[contracts.OperationId] != corrCtx.GetOperationID() || tags[contracts.OperationParentId] != corrCtx.SpanID {
+		t.Errorf("Expected heartbeat linked to the operation's span, got %v", tags)
+	}
+}
@@ -0,0 +1,38 @@
+package appinsights
+
+import (
+	"context"
+)
+
+// Context key for the properties of the current operation
+type operationPropertiesContextKey struct{}
+
+// WithOperationProperties returns a context carrying properties that are
+// added to every telemetry item tracked with it, or with a context derived
+// from it.  Properties set on the context by an enclosing operation are
+// inherited, with values in properties taking precedence.  Properties set
+// on an item itself take precedence over operation properties, which take
+// precedence over the client's common properties.
+func WithOperationProperties(ctx context.Context, properties map[string]string) context.Context {
+	inherited := OperationProperties(ctx)
+
+	merged := make(map[string]string, len(inherited)+len(properties))
+	for k, v := range inherited {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, operationPropertiesContextKey{}, merged)
+}
+
+// OperationProperties returns the properties set on ctx with
+// WithOperationProperties, or nil.  The returned map must not be modified.
+func OperationProperties(ctx context.Context) map[string]string {
+	if properties, ok := ctx.Value(operationPropertiesContextKey{}).(map[string]string); ok {
+		return properties
+	}
+
+	return nil
+}
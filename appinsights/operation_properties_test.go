@@ -0,0 +1,55 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestOperationProperties(t *testing.T) {
+	client, testChannel := newTestClient()
+	client.Context().CommonProperties["tenant"] = "common"
+	client.Context().CommonProperties["region"] = "westus"
+
+	ctx := WithOperationProperties(context.Background(), map[string]string{"tenant": "contoso", "job": "import"})
+	ctx = WithOperationProperties(ctx, map[string]string{"job": "import-orders", "batch": "7"})
+
+	event := NewEventTelemetry("started")
+	event.Properties["batch"] = "8"
+	client.TrackWithContext(ctx, event)
+	client.TrackWithContext(ctx, NewTraceTelemetry("message", Information))
+	client.Track(NewEventTelemetry("unrelated"))
+
+	expected := map[string]string{"tenant": "contoso", "job": "import-orders", "batch": "8", "region": "westus"}
+	properties := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData).Properties
+	for k, v := range expected {
+		if properties[k] != v {
+			t.Errorf("Expected %s=%s, got %s", k, v, properties[k])
+		}
+	}
+
+	trace := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.MessageData)
+	if trace.Properties["batch"] != "7" || trace.Properties["job"] != "import-orders" {
+		t.Errorf("Expected operation properties on the trace, got %v", trace.Properties)
+	}
+
+	unrelated := testChannel.sentItems[2].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if _, ok := unrelated.Properties["job"]; ok || unrelated.Properties["tenant"] != "common" {
+		t.Errorf("Expected only common properties, got %v", unrelated.Properties)
+	}
+}
+
+func TestWithOperationPropertiesDoesNotModifyParent(t *testing.T) {
+	properties := map[string]string{"a": "1"}
+	parent := WithOperationProperties(context.Background(), properties)
+	WithOperationProperties(parent, map[string]string{"a": "2", "b": "3"})
+	properties["c"] = "4"
+
+	if inherited := OperationProperties(parent); len(inherited) != 1 || inherited["a"] != "1" {
+		t.Errorf("Expected the parent's properties to be unchanged, got %v", inherited)
+	}
+	if OperationProperties(context.Background()) != nil {
+		t.Error("Expected no properties")
+	}
+}
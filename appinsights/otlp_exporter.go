@@ -0,0 +1,809 @@
+package appinsights
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// IngestionProtocol selects how telemetry is submitted to Azure Monitor.
+type IngestionProtocol int
+
+const (
+	// IngestionProtocolApplicationInsights submits envelopes to the
+	// Application Insights ingestion endpoint.  This is the default.
+	IngestionProtocolApplicationInsights IngestionProtocol = iota
+
+	// IngestionProtocolOTLP converts envelopes to OpenTelemetry traces,
+	// logs and metrics, and submits them to an OTLP/HTTP endpoint using the
+	// JSON encoding.
+	IngestionProtocolOTLP
+)
+
+// Paths of the OTLP/HTTP signal endpoints, relative to OTLPEndpoint
+const (
+	otlpTracesPath  = "/v1/traces"
+	otlpLogsPath    = "/v1/logs"
+	otlpMetricsPath = "/v1/metrics"
+)
+
+// Resource attribute holding the instrumentation key of the telemetry
+const otlpInstrumentationKeyAttribute = "appinsights.instrumentation_key"
+
+// OpenTelemetry span kinds, status codes and severity numbers
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+
+	otlpSeverityDebug = 5
+	otlpSeverityInfo  = 9
+	otlpSeverityWarn  = 13
+	otlpSeverityError = 17
+	otlpSeverityFatal = 21
+)
+
+// otlpTransmitter submits telemetry to an OTLP/HTTP endpoint
+type otlpTransmitter struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+func newOTLPTransmitter(endpoint string, client *http.Client, timeout time.Duration) transmitter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &otlpTransmitter{strings.TrimSuffix(endpoint, "/"), client, timeout}
+}
+
+// Transmit converts the items to OTLP and posts each signal to its
+// endpoint.  When only some signals are accepted, the result reports a
+// partial success with an error for each item of the rejected signals, so
+// that only those are retried.  Items that cannot be converted are reported
+// as rejected without being retried.  When none are accepted, the result
+// carries the status of the failure, preferring a throttling status, along
+// with an error.
+func (transmitter *otlpTransmitter) Transmit(payload []byte, items telemetryBufferItems) (*transmissionResult, error) {
+	diagnosticsWriter.Printf("--------- Transmitting %d items via OTLP ---------", len(items))
+
+	batch := newOTLPBatch(items)
+	signals := batch.signals()
+	result := &transmissionResult{statusCode: successResponse}
+	response := &backendResponse{ItemsReceived: len(items), ItemsAccepted: len(items)}
+
+	var failedStatus int
+	var failedMessage string
+	failedSignals := 0
+
+	for _, signal := range signals {
+		statusCode, retryAfter, err := transmitter.post(signal.path, signal.request)
+		if retryAfter != nil {
+			result.retryAfter = retryAfter
+		}
+
+		if err == nil && statusCode >= 200 && statusCode < 300 {
+			continue
+		}
+
+		message := http.StatusText(statusCode)
+		if err != nil {
+			diagnosticsWriter.Printf("Failed to transmit %s: %s", signal.path, err.Error())
+			statusCode = serviceUnavailableResponse
+			message = err.Error()
+		}
+
+		failedSignals++
+		if failedStatus == 0 || statusCode == tooManyRequestsResponse || statusCode == tooManyRequestsOverExtendedTimeResponse {
+			failedStatus, failedMessage = statusCode, message
+		}
+
+		for _, index := range signal.indices {
+			response.Errors = append(response.Errors, &itemTransmissionResult{
+				Index:      index,
+				StatusCode: statusCode,
+				Message:    message,
+			})
+		}
+		response.ItemsAccepted -= len(signal.indices)
+	}
+
+	for _, index := range batch.unsupported {
+		if failedStatus == 0 {
+			failedStatus, failedMessage = http.StatusBadRequest, otlpUnsupportedMessage
+		}
+
+		response.Errors = append(response.Errors, &itemTransmissionResult{
+			Index:      index,
+			StatusCode: http.StatusBadRequest,
+			Message:    otlpUnsupportedMessage,
+		})
+		response.ItemsAccepted--
+	}
+
+	if len(items) > 0 && response.ItemsAccepted == 0 {
+		result.statusCode = failedStatus
+		return result, fmt.Errorf("appinsights: OTLP export failed: %d %s", failedStatus, failedMessage)
+	}
+
+	if len(response.Errors) > 0 {
+		result.statusCode = partialSuccessResponse
+		result.response = response
+	}
+
+	return result, nil
+}
+
+// serializeOTLP encodes the export requests of a batch as they would be
+// posted to an OTLP endpoint, one request per line.
+func serializeOTLP(items telemetryBufferItems) []byte {
+	var payload bytes.Buffer
+	for _, signal := range newOTLPBatch(items).signals() {
+		body, err := json.Marshal(signal.request)
+		if err != nil {
+			diagnosticsWriter.Printf("Failed to serialize %s: %s", signal.path, err.Error())
+			continue
+		}
+
+		payload.Write(body)
+		payload.WriteByte('\n')
+	}
+
+	return payload.Bytes()
+}
+
+func (transmitter *otlpTransmitter) post(path string, request interface{}) (int, *time.Time, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var postBody bytes.Buffer
+	gzipWriter := gzip.NewWriter(&postBody)
+	gzipWriter.Write(body)
+	gzipWriter.Close()
+
+	ctx, cancel := transmitContext(transmitter.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", transmitter.endpoint+path, &postBody)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := transmitter.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	var retryAfter *time.Time
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			t := currentClock.Now().Add(time.Duration(seconds) * time.Second)
+			retryAfter = &t
+		} else if t, err := time.Parse(time.RFC1123, value); err == nil {
+			retryAfter = &t
+		}
+	}
+
+	diagnosticsWriter.Printf("OTLP %s response: %d", path, resp.StatusCode)
+	return resp.StatusCode, retryAfter, nil
+}
+
+// OTLP/HTTP JSON encoding of the export requests
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText,omitempty"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID        string         `json:"traceId,omitempty"`
+	SpanID         string         `json:"spanId,omitempty"`
+}
+
+type otlpNumberDataPoint struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsDouble     float64        `json:"asDouble"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpSummaryDataPoint struct {
+	TimeUnixNano   string              `json:"timeUnixNano"`
+	Count          string              `json:"count"`
+	Sum            float64             `json:"sum"`
+	QuantileValues []otlpQuantileValue `json:"quantileValues"`
+	Attributes     []otlpKeyValue      `json:"attributes,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name    string       `json:"name"`
+	Unit    string       `json:"unit,omitempty"`
+	Gauge   *otlpGauge   `json:"gauge,omitempty"`
+	Summary *otlpSummary `json:"summary,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []*otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// otlpSignal is the export request of a single signal along with the
+// indices of the items it contains
+type otlpSignal struct {
+	path    string
+	request interface{}
+	indices []int
+}
+
+// otlpBatch holds telemetry items converted to OTLP, grouped by signal and
+// resource
+type otlpBatch struct {
+	traces  otlpTracesRequest
+	logs    otlpLogsRequest
+	metrics otlpMetricsRequest
+
+	traceIndices  []int
+	logIndices    []int
+	metricIndices []int
+
+	spansByResource   map[string]*otlpResourceSpans
+	logsByResource    map[string]*otlpResourceLogs
+	metricsByResource map[string]*otlpResourceMetrics
+
+	// Indices of the items with no OTLP representation
+	unsupported []int
+}
+
+// otlpUnsupportedMessage is the error reported for items that cannot be
+// converted to OTLP
+const otlpUnsupportedMessage = "Telemetry type is not supported by OTLP"
+
+var otlpSDKScope = otlpScope{Name: "github.com/microsoft/ApplicationInsights-Go", Version: Version}
+
+func newOTLPBatch(items telemetryBufferItems) *otlpBatch {
+	batch := &otlpBatch{
+		spansByResource:   make(map[string]*otlpResourceSpans),
+		logsByResource:    make(map[string]*otlpResourceLogs),
+		metricsByResource: make(map[string]*otlpResourceMetrics),
+	}
+
+	for index, envelope := range items {
+		batch.add(index, envelope)
+	}
+
+	return batch
+}
+
+// signals returns the export requests of the signals present in the batch
+func (batch *otlpBatch) signals() []otlpSignal {
+	var signals []otlpSignal
+	if len(batch.traceIndices) > 0 {
+		signals = append(signals, otlpSignal{otlpTracesPath, &batch.traces, batch.traceIndices})
+	}
+	if len(batch.logIndices) > 0 {
+		signals = append(signals, otlpSignal{otlpLogsPath, &batch.logs, batch.logIndices})
+	}
+	if len(batch.metricIndices) > 0 {
+		signals = append(signals, otlpSignal{otlpMetricsPath, &batch.metrics, batch.metricIndices})
+	}
+
+	return signals
+}
+
+func (batch *otlpBatch) add(index int, envelope *contracts.Envelope) {
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok {
+		batch.reject(index, envelope)
+		return
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, envelope.Time)
+	if err != nil {
+		timestamp = currentClock.Now()
+	}
+
+	resourceKey, resource := otlpResourceOf(envelope)
+	attributes := otlpTagAttributes(envelope.Tags)
+	traceID := otlpTraceID(envelope.Tags[contracts.OperationId])
+	parentID := otlpParentSpanID(envelope.Tags[contracts.OperationParentId])
+
+	switch baseData := data.BaseData.(type) {
+	case *contracts.RequestData:
+		attributes = append(attributes,
+			otlpString("url.full", baseData.Url),
+			otlpString("http.response.status_code", baseData.ResponseCode))
+		if baseData.Source != "" {
+			attributes = append(attributes, otlpString("ai.request.source", baseData.Source))
+		}
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		batch.addSpan(index, resourceKey, resource, otlpSpanOf(traceID, baseData.Id, parentID, baseData.Name,
+			otlpSpanKindServer, timestamp, baseData.Duration, baseData.Success, attributes))
+
+	case *contracts.RemoteDependencyData:
+		kind := otlpSpanKindClient
+		if baseData.Type == DependencyTypeInProc {
+			kind = otlpSpanKindInternal
+		}
+		attributes = append(attributes,
+			otlpString("ai.dependency.type", baseData.Type),
+			otlpString("ai.dependency.target", baseData.Target),
+			otlpString("ai.dependency.data", baseData.Data),
+			otlpString("ai.dependency.resultCode", baseData.ResultCode))
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		batch.addSpan(index, resourceKey, resource, otlpSpanOf(traceID, baseData.Id, parentID, baseData.Name,
+			kind, timestamp, baseData.Duration, baseData.Success, attributes))
+
+	case *contracts.MessageData:
+		severity, severityText := otlpSeverity(baseData.SeverityLevel)
+		attributes = otlpAppendProperties(attributes, baseData.Properties, nil)
+		batch.addLog(index, resourceKey, resource, otlpLogRecord{
+			SeverityNumber: severity,
+			SeverityText:   severityText,
+			Body:           otlpStringValue(baseData.Message),
+			Attributes:     attributes,
+		}, timestamp, traceID, parentID)
+
+	case *contracts.ExceptionData:
+		if len(baseData.Exceptions) > 0 {
+			exception := baseData.Exceptions[0]
+			attributes = append(attributes,
+				otlpString("exception.type", exception.TypeName),
+				otlpString("exception.message", exception.Message),
+				otlpString("exception.stacktrace", otlpStackTrace(exception)))
+		}
+		severity, severityText := otlpSeverity(baseData.SeverityLevel)
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		batch.addLog(index, resourceKey, resource, otlpLogRecord{
+			SeverityNumber: severity,
+			SeverityText:   severityText,
+			Body:           otlpStringValue(otlpExceptionMessage(baseData)),
+			Attributes:     attributes,
+		}, timestamp, traceID, parentID)
+
+	case *contracts.EventData:
+		attributes = append(attributes, otlpString("event.name", baseData.Name))
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		batch.addLog(index, resourceKey, resource, otlpLogRecord{
+			SeverityNumber: otlpSeverityInfo,
+			Body:           otlpStringValue(baseData.Name),
+			Attributes:     attributes,
+		}, timestamp, traceID, parentID)
+
+	case *contracts.PageViewData:
+		attributes = append(attributes,
+			otlpString("event.name", "PageView"),
+			otlpString("url.full", baseData.Url),
+			otlpString("ai.pageView.duration", baseData.Duration))
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		batch.addLog(index, resourceKey, resource, otlpLogRecord{
+			SeverityNumber: otlpSeverityInfo,
+			Body:           otlpStringValue(baseData.Name),
+			Attributes:     attributes,
+		}, timestamp, traceID, parentID)
+
+	case *contracts.AvailabilityData:
+		attributes = append(attributes,
+			otlpString("event.name", "Availability"),
+			otlpBool("ai.availability.success", baseData.Success),
+			otlpString("ai.availability.duration", baseData.Duration),
+			otlpString("ai.availability.runLocation", baseData.RunLocation),
+			otlpString("ai.availability.message", baseData.Message))
+		attributes = otlpAppendProperties(attributes, baseData.Properties, baseData.Measurements)
+		severity := otlpSeverityInfo
+		if !baseData.Success {
+			severity = otlpSeverityError
+		}
+		batch.addLog(index, resourceKey, resource, otlpLogRecord{
+			SeverityNumber: severity,
+			Body:           otlpStringValue(baseData.Name),
+			Attributes:     attributes,
+		}, timestamp, traceID, parentID)
+
+	case *contracts.MetricData:
+		attributes = otlpAppendProperties(attributes, baseData.Properties, nil)
+		var metrics []otlpMetric
+		for _, dataPoint := range baseData.Metrics {
+			metric := otlpMetricOf(dataPoint, timestamp, attributes)
+			metric.Unit = baseData.Properties[MetricUnitProperty]
+			metrics = append(metrics, metric)
+		}
+		batch.addMetrics(index, resourceKey, resource, metrics)
+
+	default:
+		batch.reject(index, envelope)
+	}
+}
+
+// reject records an item that has no OTLP representation
+func (batch *otlpBatch) reject(index int, envelope *contracts.Envelope) {
+	diagnosticsWriter.Printf("Telemetry item %s cannot be exported via OTLP", envelope.Name)
+	batch.unsupported = append(batch.unsupported, index)
+}
+
+func (batch *otlpBatch) addSpan(index int, resourceKey string, resource otlpResource, span otlpSpan) {
+	resourceSpans, ok := batch.spansByResource[resourceKey]
+	if !ok {
+		resourceSpans = &otlpResourceSpans{
+			Resource:   resource,
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpSDKScope}},
+		}
+		batch.spansByResource[resourceKey] = resourceSpans
+		batch.traces.ResourceSpans = append(batch.traces.ResourceSpans, resourceSpans)
+	}
+
+	resourceSpans.ScopeSpans[0].Spans = append(resourceSpans.ScopeSpans[0].Spans, span)
+	batch.traceIndices = append(batch.traceIndices, index)
+}
+
+func (batch *otlpBatch) addLog(index int, resourceKey string, resource otlpResource, record otlpLogRecord, timestamp time.Time, traceID, spanID string) {
+	record.TimeUnixNano = otlpTime(timestamp)
+	record.TraceID = traceID
+	if traceID != "" {
+		record.SpanID = spanID
+	}
+
+	resourceLogs, ok := batch.logsByResource[resourceKey]
+	if !ok {
+		resourceLogs = &otlpResourceLogs{
+			Resource:  resource,
+			ScopeLogs: []otlpScopeLogs{{Scope: otlpSDKScope}},
+		}
+		batch.logsByResource[resourceKey] = resourceLogs
+		batch.logs.ResourceLogs = append(batch.logs.ResourceLogs, resourceLogs)
+	}
+
+	resourceLogs.ScopeLogs[0].LogRecords = append(resourceLogs.ScopeLogs[0].LogRecords, record)
+	batch.logIndices = append(batch.logIndices, index)
+}
+
+func (batch *otlpBatch) addMetrics(index int, resourceKey string, resource otlpResource, metrics []otlpMetric) {
+	resourceMetrics, ok := batch.metricsByResource[resourceKey]
+	if !ok {
+		resourceMetrics = &otlpResourceMetrics{
+			Resource:     resource,
+			ScopeMetrics: []otlpScopeMetrics{{Scope: otlpSDKScope}},
+		}
+		batch.metricsByResource[resourceKey] = resourceMetrics
+		batch.metrics.ResourceMetrics = append(batch.metrics.ResourceMetrics, resourceMetrics)
+	}
+
+	resourceMetrics.ScopeMetrics[0].Metrics = append(resourceMetrics.ScopeMetrics[0].Metrics, metrics...)
+	batch.metricIndices = append(batch.metricIndices, index)
+}
+
+// otlpResourceOf returns the resource that produced an envelope, along with
+// a key identifying it
+func otlpResourceOf(envelope *contracts.Envelope) (string, otlpResource) {
+	role := envelope.Tags[contracts.CloudRole]
+	instance := envelope.Tags[contracts.CloudRoleInstance]
+
+	attributes := []otlpKeyValue{
+		otlpString("telemetry.sdk.name", "appinsights-go"),
+		otlpString("telemetry.sdk.language", "go"),
+		otlpString("telemetry.sdk.version", Version),
+		otlpString(otlpInstrumentationKeyAttribute, envelope.IKey),
+	}
+	if role != "" {
+		attributes = append(attributes, otlpString("service.name", role))
+	}
+	if instance != "" {
+		attributes = append(attributes, otlpString("service.instance.id", instance))
+	}
+
+	return envelope.IKey + "|" + role + "|" + instance, otlpResource{Attributes: attributes}
+}
+
+// otlpTagAttributes converts the context tags of an envelope, other than
+// those mapped to IDs and the resource, to attributes
+func otlpTagAttributes(tags map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		switch k {
+		case contracts.OperationId, contracts.OperationParentId, contracts.CloudRole, contracts.CloudRoleInstance:
+		default:
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, otlpString(k, tags[k]))
+	}
+
+	return attributes
+}
+
+func otlpAppendProperties(attributes []otlpKeyValue, properties map[string]string, measurements map[string]float64) []otlpKeyValue {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attributes = append(attributes, otlpString(k, properties[k]))
+	}
+
+	keys = keys[:0]
+	for k := range measurements {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := measurements[k]
+		attributes = append(attributes, otlpKeyValue{Key: k, Value: otlpAnyValue{DoubleValue: &value}})
+	}
+
+	return attributes
+}
+
+func otlpSpanOf(traceID, id, parentID, name string, kind int, start time.Time, duration string, success bool, attributes []otlpKeyValue) otlpSpan {
+	if traceID == "" {
+		traceID = otlpTraceID(id)
+	}
+
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            otlpSpanID(id),
+		ParentSpanID:      parentID,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(start.Add(parseFormattedDuration(duration))),
+		Attributes:        attributes,
+		Status:            otlpStatus{Code: otlpStatusUnset},
+	}
+
+	if !success {
+		span.Status = otlpStatus{Code: otlpStatusError}
+	}
+
+	return span
+}
+
+func otlpMetricOf(dataPoint *contracts.DataPoint, timestamp time.Time, attributes []otlpKeyValue) otlpMetric {
+	if dataPoint.Ns != "" {
+		attributes = append(attributes[:len(attributes):len(attributes)], otlpString("ai.metric.namespace", dataPoint.Ns))
+	}
+
+	if dataPoint.Kind == contracts.Aggregation {
+		return otlpMetric{
+			Name: dataPoint.Name,
+			Summary: &otlpSummary{DataPoints: []otlpSummaryDataPoint{{
+				TimeUnixNano: otlpTime(timestamp),
+				Count:        strconv.Itoa(dataPoint.Count),
+				Sum:          dataPoint.Value,
+				QuantileValues: []otlpQuantileValue{
+					{Quantile: 0, Value: dataPoint.Min},
+					{Quantile: 1, Value: dataPoint.Max},
+				},
+				Attributes: attributes,
+			}}},
+		}
+	}
+
+	return otlpMetric{
+		Name: dataPoint.Name,
+		Gauge: &otlpGauge{DataPoints: []otlpNumberDataPoint{{
+			TimeUnixNano: otlpTime(timestamp),
+			AsDouble:     dataPoint.Value,
+			Attributes:   attributes,
+		}}},
+	}
+}
+
+func otlpSeverity(level contracts.SeverityLevel) (int, string) {
+	switch level {
+	case contracts.Verbose:
+		return otlpSeverityDebug, "DEBUG"
+	case contracts.Warning:
+		return otlpSeverityWarn, "WARN"
+	case contracts.Error:
+		return otlpSeverityError, "ERROR"
+	case contracts.Critical:
+		return otlpSeverityFatal, "FATAL"
+	default:
+		return otlpSeverityInfo, "INFO"
+	}
+}
+
+func otlpExceptionMessage(data *contracts.ExceptionData) string {
+	if len(data.Exceptions) == 0 {
+		return ""
+	}
+
+	return data.Exceptions[0].Message
+}
+
+func otlpStackTrace(exception *contracts.ExceptionDetails) string {
+	if len(exception.ParsedStack) == 0 {
+		return exception.Stack
+	}
+
+	var builder strings.Builder
+	for _, frame := range exception.ParsedStack {
+		fmt.Fprintf(&builder, "%s\n\t%s:%d\n", frame.Method, frame.FileName, frame.Line)
+	}
+
+	return builder.String()
+}
+
+// otlpTraceID converts an operation ID to a 32-character trace ID.  W3C
+// trace IDs and UUIDs are kept; other IDs are hashed.
+func otlpTraceID(id string) string {
+	return otlpHexID(id, 32)
+}
+
+// otlpSpanID converts a telemetry ID to a 16-character span ID
+func otlpSpanID(id string) string {
+	return otlpHexID(id, 16)
+}
+
+// otlpParentSpanID extracts the parent span ID from a parent ID, which may
+// be a hierarchical Request-Id such as "|trace.span."
+func otlpParentSpanID(parentID string) string {
+	if parentID == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(parentID, "|") {
+		parts := strings.Split(strings.Trim(parentID, "|."), ".")
+		parentID = parts[len(parts)-1]
+	}
+
+	return otlpSpanID(parentID)
+}
+
+func otlpHexID(id string, length int) string {
+	if id == "" {
+		return ""
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if isHexID(normalized, length) && !isZeroID(normalized) {
+		return normalized
+	}
+
+	sum := md5.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])[:length]
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpStringValue(value)}
+}
+
+func otlpStringValue(value string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &value}
+}
+
+func otlpBool(key string, value bool) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &value}}
+}
+
+// parseFormattedDuration parses a duration formatted by formatDuration.
+// Returns zero if the duration is malformed.
+func parseFormattedDuration(value string) time.Duration {
+	var days, hours, minutes, seconds, ticks int64
+	if _, err := fmt.Sscanf(value, "%d.%d:%d:%d.%d", &days, &hours, &minutes, &seconds, &ticks); err != nil {
+		return 0
+	}
+
+	return time.Duration(days)*24*time.Hour +
+		time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(ticks)*100*time.Nanosecond
+}
@@ -0,0 +1,404 @@
+package appinsights
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+type otlpTestServer struct {
+	server *httptest.Server
+
+	lock       sync.Mutex
+	requests   map[string]map[string]interface{}
+	status     map[string]int
+	retryAfter string
+}
+
+func newOTLPTestServer() *otlpTestServer {
+	server := &otlpTestServer{
+		requests: make(map[string]map[string]interface{}),
+		status:   make(map[string]int),
+	}
+	server.server = httptest.NewServer(server)
+	return server
+}
+
+func (server *otlpTestServer) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if req.Header.Get("Content-Encoding") != "gzip" || req.Header.Get("Content-Type") != "application/json" {
+		writer.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	reader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(reader).Decode(&body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	server.requests[req.URL.Path] = body
+	if status, ok := server.status[req.URL.Path]; ok {
+		if server.retryAfter != "" {
+			writer.Header().Set("Retry-After", server.retryAfter)
+		}
+		writer.WriteHeader(status)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (server *otlpTestServer) request(t *testing.T, path string) map[string]interface{} {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	body, ok := server.requests[path]
+	if !ok {
+		t.Fatalf("Nothing was posted to %s", path)
+	}
+
+	return body
+}
+
+// otlpPath walks decoded JSON by object keys and array indices
+func otlpPath(t *testing.T, value interface{}, path ...interface{}) interface{} {
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected an object at %q", s)
+			}
+			value = object[s]
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || len(array) <= s {
+				t.Fatalf("Expected an array of more than %d elements", s)
+			}
+			value = array[s]
+		}
+	}
+
+	return value
+}
+
+func otlpAttribute(t *testing.T, attributes interface{}, key string) map[string]interface{} {
+	for _, attribute := range attributes.([]interface{}) {
+		kv := attribute.(map[string]interface{})
+		if kv["key"] == key {
+			return kv["value"].(map[string]interface{})
+		}
+	}
+
+	t.Fatalf("Attribute %q not found", key)
+	return nil
+}
+
+func TestOTLPSpans(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	server := newOTLPTestServer()
+	defer server.server.Close()
+
+	traceID := "0af7651916cd43dd8448eb211c80319c"
+
+	request := NewRequestTelemetry("GET", "https://example.com/orders", time.Second, "200")
+	request.Id = "b7ad6b7169203331"
+	request.Tags.Operation().SetId(traceID)
+	request.Tags.Cloud().SetRole("orders")
+	request.Properties["tenant"] = "contoso"
+
+	dependency := NewRemoteDependencyTelemetry("SELECT", "SQL", "db", false)
+	dependency.Id = "00f067aa0ba902b7"
+	dependency.Duration = 250 * time.Millisecond
+	dependency.Tags.Operation().SetId(traceID)
+	dependency.Tags.Operation().SetParentId("|" + traceID + ".b7ad6b7169203331.")
+	dependency.Tags.Cloud().SetRole("orders")
+
+	items := telemetryBuffer(request, dependency)
+	result, err := newOTLPTransmitter(server.server.URL+"/", nil, 0).Transmit(nil, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsFailure() {
+		t.Errorf("Transmission failed with status %d", result.statusCode)
+	}
+
+	body := server.request(t, otlpTracesPath)
+	resourceSpans := otlpPath(t, body, "resourceSpans").([]interface{})
+	if len(resourceSpans) != 1 {
+		t.Fatalf("Expected spans of one resource, got %d", len(resourceSpans))
+	}
+
+	resource := otlpPath(t, resourceSpans[0], "resource", "attributes")
+	if name := otlpAttribute(t, resource, "service.name")["stringValue"]; name != "orders" {
+		t.Errorf("service.name: %v", name)
+	}
+	if ikey := otlpAttribute(t, resource, otlpInstrumentationKeyAttribute)["stringValue"]; ikey != test_ikey {
+		t.Errorf("Instrumentation key: %v", ikey)
+	}
+
+	spans := otlpPath(t, resourceSpans[0], "scopeSpans", 0, "spans").([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	server1 := spans[0].(map[string]interface{})
+	if server1["traceId"] != traceID || server1["spanId"] != "b7ad6b7169203331" {
+		t.Errorf("Request span IDs: %v %v", server1["traceId"], server1["spanId"])
+	}
+	if _, ok := server1["parentSpanId"]; ok {
+		t.Error("Request span should have no parent")
+	}
+	if server1["kind"] != float64(otlpSpanKindServer) || server1["name"] != "GET https://example.com/orders" {
+		t.Errorf("Request span: kind %v name %v", server1["kind"], server1["name"])
+	}
+	if tenant := otlpAttribute(t, server1["attributes"], "tenant")["stringValue"]; tenant != "contoso" {
+		t.Errorf("Request property: %v", tenant)
+	}
+
+	start := currentClock.Now().Add(-time.Second)
+	if server1["startTimeUnixNano"] != otlpTime(start) || server1["endTimeUnixNano"] != otlpTime(start.Add(time.Second)) {
+		t.Errorf("Request span times: %v - %v", server1["startTimeUnixNano"], server1["endTimeUnixNano"])
+	}
+
+	client1 := spans[1].(map[string]interface{})
+	if client1["traceId"] != traceID || client1["spanId"] != "00f067aa0ba902b7" || client1["parentSpanId"] != "b7ad6b7169203331" {
+		t.Errorf("Dependency span IDs: %v %v %v", client1["traceId"], client1["spanId"], client1["parentSpanId"])
+	}
+	if client1["kind"] != float64(otlpSpanKindClient) {
+		t.Errorf("Dependency span kind: %v", client1["kind"])
+	}
+	if code := otlpPath(t, client1, "status", "code"); code != float64(otlpStatusError) {
+		t.Errorf("Failed dependency status: %v", code)
+	}
+}
+
+func TestOTLPLogsAndMetrics(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	server := newOTLPTestServer()
+	defer server.server.Close()
+
+	trace := NewTraceTelemetry("disk is full", Warning)
+	trace.Tags.Operation().SetId("0af7651916cd43dd8448eb211c80319c")
+	trace.Tags.Operation().SetParentId("b7ad6b7169203331")
+
+	exception := NewExceptionTelemetry(errors.New("boom"))
+
+	metric := NewMetricTelemetry("queueLength", 12)
+	metric.Namespace = "storage"
+	metric.Unit = "items"
+	aggregate := NewAggregateMetricTelemetry("latency")
+	aggregate.AddData([]float64{1, 2, 6})
+
+	items := telemetryBuffer(trace, exception, metric, aggregate)
+	if _, err := newOTLPTransmitter(server.server.URL, nil, 0).Transmit(nil, items); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := otlpPath(t, server.request(t, otlpLogsPath), "resourceLogs", 0, "scopeLogs", 0, "logRecords").([]interface{})
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 log records, got %d", len(logs))
+	}
+
+	record := logs[0].(map[string]interface{})
+	if record["severityNumber"] != float64(otlpSeverityWarn) || otlpPath(t, record, "body", "stringValue") != "disk is full" {
+		t.Errorf("Trace record: %v", record)
+	}
+	if record["traceId"] != "0af7651916cd43dd8448eb211c80319c" || record["spanId"] != "b7ad6b7169203331" {
+		t.Errorf("Trace record IDs: %v %v", record["traceId"], record["spanId"])
+	}
+
+	record = logs[1].(map[string]interface{})
+	if record["severityNumber"] != float64(otlpSeverityError) {
+		t.Errorf("Exception severity: %v", record["severityNumber"])
+	}
+	if message := otlpAttribute(t, record["attributes"], "exception.message")["stringValue"]; message != "boom" {
+		t.Errorf("Exception message: %v", message)
+	}
+
+	metrics := otlpPath(t, server.request(t, otlpMetricsPath), "resourceMetrics", 0, "scopeMetrics", 0, "metrics").([]interface{})
+	if len(metrics) != 2 {
+		t.Fatalf("Expected 2 metrics, got %d", len(metrics))
+	}
+
+	if value := otlpPath(t, metrics[0], "gauge", "dataPoints", 0, "asDouble"); value != float64(12) {
+		t.Errorf("Gauge value: %v", value)
+	}
+	if unit := metrics[0].(map[string]interface{})["unit"]; unit != "items" {
+		t.Errorf("Gauge unit: %v", unit)
+	}
+	gauge := otlpPath(t, metrics[0], "gauge", "dataPoints", 0).(map[string]interface{})
+	if ns := otlpAttribute(t, gauge["attributes"], "ai.metric.namespace")["stringValue"]; ns != "storage" {
+		t.Errorf("Gauge namespace: %v", ns)
+	}
+
+	summary := otlpPath(t, metrics[1], "summary", "dataPoints", 0).(map[string]interface{})
+	if summary["count"] != "3" || summary["sum"] != float64(9) {
+		t.Errorf("Summary: %v", summary)
+	}
+	if max := otlpPath(t, summary, "quantileValues", 1, "value"); max != float64(6) {
+		t.Errorf("Summary max: %v", max)
+	}
+}
+
+func TestOTLPPartialFailure(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	server := newOTLPTestServer()
+	defer server.server.Close()
+	server.status[otlpLogsPath] = http.StatusServiceUnavailable
+
+	items := telemetryBuffer(
+		NewTraceTelemetry("first", Information),
+		NewEventTelemetry("event"),
+		NewRequestTelemetry("GET", "/", time.Second, "200"),
+		NewTraceTelemetry("second", Information))
+
+	result, err := newOTLPTransmitter(server.server.URL, nil, 0).Transmit(nil, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.statusCode != partialSuccessResponse || result.response == nil {
+		t.Fatalf("Expected partial success, got %d", result.statusCode)
+	}
+	if result.response.ItemsAccepted != 1 || len(result.response.Errors) != 3 {
+		t.Errorf("Accepted %d with %d errors", result.response.ItemsAccepted, len(result.response.Errors))
+	}
+
+	_, retry := result.GetRetryItems(nil, items)
+	if len(retry) != 3 || retry[0] != items[0] || retry[1] != items[1] || retry[2] != items[3] {
+		t.Errorf("Expected the log items to be retried, got %d items", len(retry))
+	}
+}
+
+func TestOTLPThrottled(t *testing.T) {
+	mockClock(time.Unix(1511001321, 0))
+	defer resetClock()
+
+	server := newOTLPTestServer()
+	defer server.server.Close()
+	server.status[otlpTracesPath] = http.StatusServiceUnavailable
+	server.status[otlpLogsPath] = http.StatusTooManyRequests
+	server.retryAfter = "30"
+
+	items := telemetryBuffer(
+		NewTraceTelemetry("trace", Information),
+		NewRequestTelemetry("GET", "/", time.Second, "200"))
+
+	result, err := newOTLPTransmitter(server.server.URL, nil, 0).Transmit(nil, items)
+	if err == nil {
+		t.Error("Expected an error when no signal was accepted")
+	}
+	if result == nil {
+		t.Fatal("Expected a result")
+	}
+
+	if result.statusCode != tooManyRequestsResponse || !result.IsThrottled() || !result.CanRetry() {
+		t.Errorf("Expected a throttled result, got %d", result.statusCode)
+	}
+	if result.retryAfter == nil || !result.retryAfter.Equal(currentClock.Now().Add(30*time.Second)) {
+		t.Errorf("Expected Retry-After to be honored, got %v", result.retryAfter)
+	}
+
+	_, retry := result.GetRetryItems(nil, items)
+	if len(retry) != len(items) {
+		t.Errorf("Expected all items to be retried, got %d items", len(retry))
+	}
+}
+
+func TestOTLPUnsupportedItems(t *testing.T) {
+	server := newOTLPTestServer()
+	defer server.server.Close()
+
+	items := telemetryBuffer(
+		NewTraceTelemetry("trace", Information),
+		NewEventTelemetry("not wrapped"),
+		NewEventTelemetry("unknown"))
+	items[1].Data = items[1].Data.(*contracts.Data).BaseData
+	items[2].Data.(*contracts.Data).BaseData = struct{}{}
+
+	transmitter := newOTLPTransmitter(server.server.URL, nil, 0)
+	result, err := transmitter.Transmit(nil, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.statusCode != partialSuccessResponse || result.response.ItemsAccepted != 1 || len(result.response.Errors) != 2 {
+		t.Fatalf("Expected the unsupported items to be rejected, got %d", result.statusCode)
+	}
+	if _, retry := result.GetRetryItems(nil, items); len(retry) != 0 {
+		t.Errorf("Expected unsupported items not to be retried, got %d items", len(retry))
+	}
+
+	result, err = transmitter.Transmit(nil, items[1:])
+	if err == nil || result.statusCode != http.StatusBadRequest || result.CanRetry() {
+		t.Errorf("Expected a failure when no item is supported, got %v", err)
+	}
+}
+
+func TestOTLPChannelConfiguration(t *testing.T) {
+	server := newOTLPTestServer()
+	defer server.server.Close()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.IngestionProtocol = IngestionProtocolOTLP
+	config.OTLPEndpoint = server.server.URL
+	config.MaxBatchInterval = time.Hour
+
+	client := NewTelemetryClientFromConfig(config)
+	client.TrackEvent("configured")
+	<-client.Channel().Close(time.Second)
+
+	logs := otlpPath(t, server.request(t, otlpLogsPath), "resourceLogs", 0, "scopeLogs", 0, "logRecords").([]interface{})
+	if body := otlpPath(t, logs[0], "body", "stringValue"); body != "configured" {
+		t.Errorf("Event body: %v", body)
+	}
+}
+
+func TestOTLPIDs(t *testing.T) {
+	if id := otlpTraceID("0AF76519-16CD-43DD-8448-EB211C80319C"); id != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("UUID operation ID: %s", id)
+	}
+	if id := otlpTraceID("op1"); len(id) != 32 || !isHexID(id, 32) {
+		t.Errorf("Hashed trace ID: %s", id)
+	}
+	if id := otlpSpanID("00000000000000000000"); len(id) != 16 || isZeroID(id) {
+		t.Errorf("Hashed span ID: %s", id)
+	}
+	if id := otlpParentSpanID("|0af7651916cd43dd8448eb211c80319c.b7ad6b7169203331."); id != "b7ad6b7169203331" {
+		t.Errorf("Request-Id parent: %s", id)
+	}
+}
+
+func TestParseFormattedDuration(t *testing.T) {
+	for _, d := range []time.Duration{0, 1500 * time.Millisecond, 26*time.Hour + 3*time.Minute + 100*time.Nanosecond} {
+		if parsed := parseFormattedDuration(formatDuration(d)); parsed != d {
+			t.Errorf("%s parsed as %s", d, parsed)
+		}
+	}
+
+	if parsed := parseFormattedDuration("garbage"); parsed != 0 {
+		t.Errorf("Malformed duration parsed as %s", parsed)
+	}
+}
@@ -0,0 +1,129 @@
+package appinsights
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Properties of exception telemetry tracked for recovered panics
+const (
+	// PanicValueTypeProperty holds the Go type of the panic value
+	PanicValueTypeProperty = "panic.type"
+
+	// PanicGoroutineProperty holds the ID of the goroutine that panicked
+	PanicGoroutineProperty = "panic.goroutine"
+
+	// PanicRethrownProperty is "true" if the panic was re-raised after
+	// being tracked
+	PanicRethrownProperty = "panic.rethrown"
+
+	// PanicErrorChainProperty holds the types of the errors wrapped by an
+	// error panic value, outermost first, separated by " > "
+	PanicErrorChainProperty = "panic.errorChain"
+
+	// PanicFieldPropertyPrefix prefixes the properties holding the fields
+	// of a struct panic value, or the entries of a map panic value
+	PanicFieldPropertyPrefix = "panic.field."
+)
+
+// Limits on the structured fields recorded from a panic value
+const (
+	maxPanicFields     = 20
+	maxPanicFieldValue = 256
+)
+
+// NewPanicTelemetry creates exception telemetry for a value recovered from
+// a panic.  Besides the message, the panic value's type, its structured
+// fields and wrapped errors, the goroutine that panicked, and whether the
+// panic is re-raised are recorded as properties.  Like NewExceptionTelemetry,
+// it should be called directly from the function that calls recover().
+func NewPanicTelemetry(value interface{}, rethrown bool) *ExceptionTelemetry {
+	exception := newExceptionTelemetry(value, 1)
+	applyPanicDetails(exception, value, rethrown)
+	return exception
+}
+
+// applyPanicDetails records the details of a panic value as properties
+func applyPanicDetails(exception *ExceptionTelemetry, value interface{}, rethrown bool) {
+	properties := exception.Properties
+	properties[PanicGoroutineProperty] = strconv.FormatUint(goroutineID(), 10)
+	properties[PanicRethrownProperty] = strconv.FormatBool(rethrown)
+
+	if value == nil {
+		return
+	}
+
+	properties[PanicValueTypeProperty] = reflect.TypeOf(value).String()
+
+	if err, ok := value.(error); ok {
+		if chain := errorChain(err); len(chain) > 1 {
+			properties[PanicErrorChainProperty] = strings.Join(chain, " > ")
+		}
+	}
+
+	for name, field := range panicFields(value) {
+		properties[PanicFieldPropertyPrefix+name] = field
+	}
+}
+
+// errorChain returns the types of err and the errors it wraps
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil && len(chain) < maxPanicFields {
+		chain = append(chain, reflect.TypeOf(err).String())
+		err = errors.Unwrap(err)
+	}
+
+	return chain
+}
+
+// panicFields returns the exported fields of a struct, or the entries of a
+// map, formatted as strings.  Other values have no fields.
+func panicFields(value interface{}) map[string]string {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	fields := make(map[string]string)
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField() && len(fields) < maxPanicFields; i++ {
+			if field := t.Field(i); field.IsExported() {
+				fields[field.Name] = formatPanicField(v.Field(i))
+			}
+		}
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		for _, key := range keys {
+			if len(fields) >= maxPanicFields {
+				break
+			}
+			fields[fmt.Sprint(key.Interface())] = formatPanicField(v.MapIndex(key))
+		}
+	}
+
+	return fields
+}
+
+func formatPanicField(v reflect.Value) string {
+	formatted := fmt.Sprintf("%+v", v.Interface())
+	if len(formatted) > maxPanicFieldValue {
+		formatted = formatted[:maxPanicFieldValue]
+	}
+
+	return formatted
+}
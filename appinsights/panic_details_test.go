@@ -0,0 +1,80 @@
+package appinsights
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+type orderPanic struct {
+	OrderID  int
+	Customer string
+	secret   string
+}
+
+func TestNewPanicTelemetry(t *testing.T) {
+	exception := NewPanicTelemetry(&orderPanic{OrderID: 42, Customer: "contoso", secret: "hidden"}, true)
+
+	expected := map[string]string{
+		PanicValueTypeProperty:                "*appinsights.orderPanic",
+		PanicRethrownProperty:                 "true",
+		PanicFieldPropertyPrefix + "OrderID":  "42",
+		PanicFieldPropertyPrefix + "Customer": "contoso",
+	}
+	for key, value := range expected {
+		if exception.Properties[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, exception.Properties[key])
+		}
+	}
+	if _, ok := exception.Properties[PanicFieldPropertyPrefix+"secret"]; ok {
+		t.Error("Expected unexported fields to be omitted")
+	}
+	if exception.Properties[PanicGoroutineProperty] == "" {
+		t.Error("Expected the goroutine ID to be recorded")
+	}
+
+	details := exception.TelemetryData().(*contracts.ExceptionData).Exceptions[0]
+	if details.TypeName != "*appinsights.orderPanic" || !strings.Contains(details.Message, "OrderID:42") {
+		t.Errorf("Unexpected exception details %q: %q", details.TypeName, details.Message)
+	}
+}
+
+func TestPanicErrorChain(t *testing.T) {
+	err := fmt.Errorf("checkout: %w", &orderError{errors.New("out of stock")})
+	exception := NewPanicTelemetry(err, false)
+
+	if chain := exception.Properties[PanicErrorChainProperty]; chain != "*fmt.wrapError > *appinsights.orderError > *errors.errorString" {
+		t.Errorf("Unexpected error chain %q", chain)
+	}
+}
+
+type orderError struct {
+	cause error
+}
+
+func (err *orderError) Error() string { return "order failed: " + err.cause.Error() }
+func (err *orderError) Unwrap() error { return err.cause }
+
+func TestTrackPanicDetails(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	func() {
+		defer TrackPanic(client, false)
+		panic(map[string]int{"retries": 3})
+	}()
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected an exception, got %d items", testChannel.getSentCount())
+	}
+
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.ExceptionData)
+	if data.Properties[PanicFieldPropertyPrefix+"retries"] != "3" || data.Properties[PanicRethrownProperty] != "false" {
+		t.Errorf("Unexpected properties %v", data.Properties)
+	}
+	if data.Exceptions[0].TypeName != "map[string]int" {
+		t.Errorf("Expected the panic value's type, got %q", data.Exceptions[0].TypeName)
+	}
+}
@@ -30,12 +30,26 @@ type PerformanceCounterConfig struct {
 	
 	// CollectionInterval specifies how often to collect performance counters
 	CollectionInterval time.Duration
+
+	// AlignToWallClock collects on multiples of CollectionInterval on the
+	// wall clock, after an initial collection on start, so that samples
+	// line up across instances
+	AlignToWallClock bool
 	
 	// EnableSystemMetrics controls collection of CPU, memory, and disk metrics
 	EnableSystemMetrics bool
 	
 	// EnableRuntimeMetrics controls collection of Go runtime metrics
 	EnableRuntimeMetrics bool
+
+	// EnableWindowsCounters controls collection of the classic Windows
+	// performance counters reported by the .NET SDK.  It has no effect on
+	// other platforms.
+	EnableWindowsCounters bool
+
+	// RequestCounter optionally supplies the requests counted by
+	// HTTPMiddleware for the Requests/Sec Windows counter
+	RequestCounter *RequestCounter
 	
 	// CustomCollectors allows registration of custom performance counter collectors
 	CustomCollectors []PerformanceCounterCollector
@@ -80,6 +94,12 @@ func (pcm *PerformanceCounterManager) setupCollectors() {
 	if pcm.config.EnableRuntimeMetrics {
 		pcm.collectors = append(pcm.collectors, NewRuntimeMetricsCollector())
 	}
+
+	if pcm.config.EnableWindowsCounters {
+		if collector := newWindowsCounterCollector(pcm.config.RequestCounter); collector != nil {
+			pcm.collectors = append(pcm.collectors, collector)
+		}
+	}
 	
 	// Add custom collectors
 	pcm.collectors = append(pcm.collectors, pcm.config.CustomCollectors...)
@@ -122,6 +142,14 @@ func (pcm *PerformanceCounterManager) collectLoop() {
 	
 	// Collect immediately on start
 	pcm.collectMetrics()
+
+	if pcm.config.AlignToWallClock {
+		if !waitForAlignment(pcm.ctx.Done(), pcm.config.CollectionInterval) {
+			return
+		}
+		pcm.collectMetrics()
+		ticker.Reset(pcm.config.CollectionInterval)
+	}
 	
 	for {
 		select {
@@ -144,8 +172,12 @@ func (pcm *PerformanceCounterManager) collectMetrics() {
 	}
 }
 
-// RuntimeMetricsCollector collects Go runtime metrics
-type RuntimeMetricsCollector struct{}
+// RuntimeMetricsCollector collects Go runtime metrics.  Metrics introduced
+// by newer Go versions are collected when available; see runtime_metrics.go
+// for the support matrix.
+type RuntimeMetricsCollector struct {
+	samples runtimeMetricSamples
+}
 
 // NewRuntimeMetricsCollector creates a new runtime metrics collector
 func NewRuntimeMetricsCollector() *RuntimeMetricsCollector {
@@ -185,6 +217,9 @@ func (r *RuntimeMetricsCollector) Collect(client TelemetryClient) {
 	client.TrackMetric("runtime.goroutines", float64(runtime.NumGoroutine()))
 	client.TrackMetric("runtime.num_cpu", float64(runtime.NumCPU()))
 	client.TrackMetric("runtime.cgocall", float64(runtime.NumCgoCall()))
+	
+	// runtime/metrics based metrics
+	r.samples.collect(client)
 }
 
 // CustomPerformanceCounterCollector allows users to define custom performance counters
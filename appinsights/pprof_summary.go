@@ -0,0 +1,303 @@
+package appinsights
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// profileFrame is a function that accounts for part of a profile.
+type profileFrame struct {
+	// Fully-qualified function name
+	Function string
+
+	// Sum of the profile values of the samples in which this function is
+	// the innermost non-runtime frame; e.g. CPU nanoseconds or goroutines
+	Value int64
+
+	// Value as a percentage of the profile total
+	Percent float64
+}
+
+// String formats the frame as "percent% function".
+func (frame profileFrame) String() string {
+	return fmt.Sprintf("%.1f%% %s", frame.Percent, frame.Function)
+}
+
+var errMalformedProfile = errors.New("appinsights: malformed profile")
+
+// summarizeProfile decodes a gzipped pprof profile and returns its top
+// frames along with the number of samples.  Frames are attributed to the
+// innermost function outside the Go runtime, so that goroutines parked by
+// the scheduler are reported where they wait.
+func summarizeProfile(data []byte, topFrames int) ([]profileFrame, int, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	profile, err := decodeProfile(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	functionNames := make(map[uint64]string, len(profile.functions))
+	for id, nameIndex := range profile.functions {
+		if nameIndex >= 0 && nameIndex < int64(len(profile.strings)) {
+			functionNames[id] = profile.strings[nameIndex]
+		}
+	}
+
+	values := make(map[string]int64)
+	var total int64
+	for _, sample := range profile.samples {
+		if len(sample.values) == 0 {
+			continue
+		}
+
+		// The last value is the one pprof reports by default
+		value := sample.values[len(sample.values)-1]
+		total += value
+		values[sampleFunction(sample.locations, profile.locations, functionNames)] += value
+	}
+
+	frames := make([]profileFrame, 0, len(values))
+	for function, value := range values {
+		frame := profileFrame{Function: function, Value: value}
+		if total > 0 {
+			frame.Percent = 100 * float64(value) / float64(total)
+		}
+		frames = append(frames, frame)
+	}
+
+	sort.Slice(frames, func(i, j int) bool {
+		if frames[i].Value != frames[j].Value {
+			return frames[i].Value > frames[j].Value
+		}
+		return frames[i].Function < frames[j].Function
+	})
+
+	if topFrames > 0 && len(frames) > topFrames {
+		frames = frames[:topFrames]
+	}
+
+	return frames, len(profile.samples), nil
+}
+
+// sampleFunction returns the innermost non-runtime function of a sample's
+// stack, or its innermost function if the whole stack is in the runtime
+func sampleFunction(locationIDs []uint64, locations map[uint64][]uint64, functionNames map[uint64]string) string {
+	innermost := ""
+	for _, locationID := range locationIDs {
+		// Lines of a location are ordered from the innermost inlined call
+		for _, functionID := range locations[locationID] {
+			name := functionNames[functionID]
+			if name == "" {
+				continue
+			}
+			if innermost == "" {
+				innermost = name
+			}
+			if !strings.HasPrefix(name, "runtime.") && !strings.HasPrefix(name, "runtime/") {
+				return name
+			}
+		}
+	}
+
+	if innermost == "" {
+		return "unknown"
+	}
+
+	return innermost
+}
+
+type profileSample struct {
+	locations []uint64
+	values    []int64
+}
+
+// decodedProfile holds the parts of a pprof profile needed to summarize it
+type decodedProfile struct {
+	samples []profileSample
+
+	// Function IDs of the lines of each location, by location ID
+	locations map[uint64][]uint64
+
+	// Name string index of each function, by function ID
+	functions map[uint64]int64
+
+	strings []string
+}
+
+// Field numbers from the pprof profile.proto
+const (
+	profileSampleField   = 2
+	profileLocationField = 4
+	profileFunctionField = 5
+	profileStringField   = 6
+	sampleLocationField  = 1
+	sampleValueField     = 2
+	locationIDField      = 1
+	locationLineField    = 4
+	lineFunctionField    = 1
+	functionIDField      = 1
+	functionNameField    = 2
+	protoWireVarint      = 0
+	protoWireFixed64     = 1
+	protoWireLengthDelim = 2
+	protoWireFixed32     = 5
+)
+
+func decodeProfile(data []byte) (*decodedProfile, error) {
+	profile := &decodedProfile{
+		locations: make(map[uint64][]uint64),
+		functions: make(map[uint64]int64),
+	}
+
+	err := decodeProtoFields(data, func(field int, wire int, varint uint64, buf []byte) error {
+		switch field {
+		case profileSampleField:
+			var sample profileSample
+			err := decodeProtoFields(buf, func(field int, wire int, varint uint64, buf []byte) error {
+				switch field {
+				case sampleLocationField:
+					return decodeRepeatedVarint(wire, varint, buf, func(v uint64) {
+						sample.locations = append(sample.locations, v)
+					})
+				case sampleValueField:
+					return decodeRepeatedVarint(wire, varint, buf, func(v uint64) {
+						sample.values = append(sample.values, int64(v))
+					})
+				}
+				return nil
+			})
+			profile.samples = append(profile.samples, sample)
+			return err
+
+		case profileLocationField:
+			var id uint64
+			var functions []uint64
+			err := decodeProtoFields(buf, func(field int, wire int, varint uint64, buf []byte) error {
+				switch field {
+				case locationIDField:
+					id = varint
+				case locationLineField:
+					return decodeProtoFields(buf, func(field int, wire int, varint uint64, buf []byte) error {
+						if field == lineFunctionField {
+							functions = append(functions, varint)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			profile.locations[id] = functions
+			return err
+
+		case profileFunctionField:
+			var id uint64
+			var name int64
+			err := decodeProtoFields(buf, func(field int, wire int, varint uint64, buf []byte) error {
+				switch field {
+				case functionIDField:
+					id = varint
+				case functionNameField:
+					name = int64(varint)
+				}
+				return nil
+			})
+			profile.functions[id] = name
+			return err
+
+		case profileStringField:
+			profile.strings = append(profile.strings, string(buf))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// decodeProtoFields calls fn for each field of a protobuf message.  varint
+// is set for varint fields and buf for length-delimited fields.
+func decodeProtoFields(data []byte, fn func(field int, wire int, varint uint64, buf []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errMalformedProfile
+		}
+		data = data[n:]
+
+		field, wire := int(key>>3), int(key&7)
+		var varint uint64
+		var buf []byte
+
+		switch wire {
+		case protoWireVarint:
+			if varint, n = binary.Uvarint(data); n <= 0 {
+				return errMalformedProfile
+			}
+			data = data[n:]
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return errMalformedProfile
+			}
+			data = data[8:]
+		case protoWireLengthDelim:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errMalformedProfile
+			}
+			buf = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return errMalformedProfile
+			}
+			data = data[4:]
+		default:
+			return errMalformedProfile
+		}
+
+		if err := fn(field, wire, varint, buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeRepeatedVarint decodes a repeated varint field, which may be packed
+func decodeRepeatedVarint(wire int, varint uint64, packed []byte, fn func(uint64)) error {
+	if wire == protoWireVarint {
+		fn(varint)
+		return nil
+	}
+
+	for len(packed) > 0 {
+		v, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return errMalformedProfile
+		}
+		fn(v)
+		packed = packed[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package appinsights
+
+import (
+	"sort"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// TelemetryPriority orders telemetry when the channel is backlogged.
+// Higher priority items are transmitted first, and are retained in
+// preference to lower priority items when the channel is throttled or
+// reaches MaxPendingBytes.  The priority of an envelope is stored in its
+// Priority field; it is derived from the telemetry type and severity, and
+// sampling processors may change it.
+type TelemetryPriority int
+
+const (
+	// PriorityLow is assigned to verbose traces.
+	PriorityLow TelemetryPriority = -1
+
+	// PriorityNormal is assigned to most telemetry.
+	PriorityNormal TelemetryPriority = 0
+
+	// PriorityHigh is assigned to failed requests and dependencies, error
+	// traces, and heartbeats.
+	PriorityHigh TelemetryPriority = 1
+
+	// PriorityCritical is assigned to exceptions and critical traces.
+	PriorityCritical TelemetryPriority = 2
+)
+
+// EnvelopePriority returns the priority of an envelope.
+func EnvelopePriority(envelope *contracts.Envelope) TelemetryPriority {
+	return TelemetryPriority(envelope.Priority)
+}
+
+// SetEnvelopePriority sets the priority of an envelope.
+func SetEnvelopePriority(envelope *contracts.Envelope, priority TelemetryPriority) {
+	envelope.Priority = int(priority)
+}
+
+// defaultPriority derives the priority of telemetry data from its type and
+// severity
+func defaultPriority(data interface{}) TelemetryPriority {
+	switch data := data.(type) {
+	case *contracts.ExceptionData:
+		return PriorityCritical
+	case *contracts.MessageData:
+		switch data.SeverityLevel {
+		case contracts.Critical:
+			return PriorityCritical
+		case contracts.Error:
+			return PriorityHigh
+		case contracts.Verbose:
+			return PriorityLow
+		}
+	case *contracts.RequestData:
+		if !data.Success {
+			return PriorityHigh
+		}
+	case *contracts.RemoteDependencyData:
+		if !data.Success {
+			return PriorityHigh
+		}
+	case *contracts.AvailabilityData:
+		if !data.Success {
+			return PriorityHigh
+		}
+	case *contracts.MetricData:
+		for _, point := range data.Metrics {
+			if point.Name == HeartbeatMetricName {
+				return PriorityHigh
+			}
+		}
+	}
+
+	return PriorityNormal
+}
+
+// lowestPriorityIndex returns the index of the oldest item with the lowest
+// priority in items, if that priority is below limit, or at most limit if
+// inclusive.  Returns -1 if there is no such item.
+func lowestPriorityIndex(items telemetryBufferItems, limit int, inclusive bool) int {
+	index := -1
+	for i, item := range items {
+		if item.Priority > limit || (item.Priority == limit && !inclusive) {
+			continue
+		}
+		if index < 0 || item.Priority < items[index].Priority {
+			index = i
+		}
+	}
+
+	return index
+}
+
+// byPriority splits items into batches of at most batchSize, higher
+// priority items first.  Items of equal priority keep their order.
+func byPriority(items telemetryBufferItems, batchSize int) []telemetryBufferItems {
+	sorted := make(telemetryBufferItems, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	if batchSize <= 0 {
+		batchSize = len(sorted)
+	}
+
+	var batches []telemetryBufferItems
+	for len(sorted) > batchSize {
+		batches = append(batches, sorted[:batchSize])
+		sorted = sorted[batchSize:]
+	}
+
+	return append(batches, sorted)
+}
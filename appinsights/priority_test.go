@@ -0,0 +1,94 @@
+package appinsights
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestDefaultPriority(t *testing.T) {
+	context := NewTelemetryContext(test_ikey)
+
+	tests := []struct {
+		item     Telemetry
+		expected TelemetryPriority
+	}{
+		{NewExceptionTelemetry("boom"), PriorityCritical},
+		{NewTraceTelemetry("message", Critical), PriorityCritical},
+		{NewTraceTelemetry("message", Error), PriorityHigh},
+		{NewRequestTelemetry("GET", "https://example.com/", 0, "500"), PriorityHigh},
+		{NewMetricTelemetry(HeartbeatMetricName, 0), PriorityHigh},
+		{NewEventTelemetry("event"), PriorityNormal},
+		{NewRequestTelemetry("GET", "https://example.com/", 0, "200"), PriorityNormal},
+		{NewTraceTelemetry("message", Verbose), PriorityLow},
+	}
+
+	for i, test := range tests {
+		if priority := EnvelopePriority(context.envelop(test.item)); priority != test.expected {
+			t.Errorf("Item %d: expected priority %d, got %d", i, test.expected, priority)
+		}
+	}
+}
+
+func TestByPriority(t *testing.T) {
+	context := NewTelemetryContext(test_ikey)
+
+	var items telemetryBufferItems
+	for i, severity := range []contracts.SeverityLevel{Information, Error, Verbose, Critical, Error} {
+		items = append(items, context.envelop(NewTraceTelemetry(fmt.Sprintf("%d", i), severity)))
+	}
+
+	batches := byPriority(items, 2)
+	if len(batches) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(batches))
+	}
+
+	var order []string
+	for _, batch := range batches {
+		for _, item := range batch {
+			order = append(order, item.Data.(*contracts.Data).BaseData.(*contracts.MessageData).Message)
+		}
+	}
+
+	if strings.Join(order, ",") != "3,1,4,0,2" {
+		t.Errorf("Unexpected order: %v", order)
+	}
+}
+
+func TestMaxPendingBytesKeepsPriority(t *testing.T) {
+	mockClock()
+	defer resetClock()
+	client, transmitter := newMemoryLimitedChannelServer(3, BackpressureDropNewest)
+	defer transmitter.Close()
+	defer client.Channel().Stop()
+
+	for i := 0; i < 3; i++ {
+		client.TrackTrace(fmt.Sprintf("~msg-%d~", i), Information)
+	}
+
+	// Evicts the oldest item of lower priority
+	client.TrackTrace("~msg-E~", Error)
+
+	// Dropped, as nothing has lower priority
+	client.TrackTrace("~msg-4~", Information)
+
+	transmitter.prepResponse(200)
+	client.Channel().Flush()
+
+	req := transmitter.waitForRequest(t)
+	if len(req.items) != 3 {
+		t.Errorf("Expected 3 items, got %d", len(req.items))
+	}
+	for _, msg := range []string{"~msg-1~", "~msg-2~", "~msg-E~"} {
+		if !strings.Contains(req.payload, msg) {
+			t.Errorf("Payload does not contain %s", msg)
+		}
+	}
+	for _, msg := range []string{"~msg-0~", "~msg-4~"} {
+		if strings.Contains(req.payload, msg) {
+			t.Errorf("Payload contains %s", msg)
+		}
+	}
+}
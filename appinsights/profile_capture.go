@@ -0,0 +1,220 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProfileCapturedEventName is the name of the event tracked with the
+// summary of each captured profile.
+const ProfileCapturedEventName = "ProfileCaptured"
+
+// ProfileType is a kind of runtime profile.
+type ProfileType string
+
+const (
+	// ProfileTypeCPU samples CPU usage for ProfileCaptureConfig.Duration
+	ProfileTypeCPU ProfileType = "cpu"
+
+	// ProfileTypeGoroutine captures the stacks of all goroutines
+	ProfileTypeGoroutine ProfileType = "goroutine"
+)
+
+// ProfileUploadFunc stores a captured profile, in pprof format, e.g. in a
+// blob container.  It returns a reference to the stored profile, such as its
+// URL, which is recorded on the ProfileCaptured event.
+type ProfileUploadFunc func(ctx context.Context, profileType ProfileType, profile []byte) (string, error)
+
+// ProfileCaptureConfig configures capturing runtime profiles when error or
+// latency thresholds trip.
+type ProfileCaptureConfig struct {
+	// Type of profile to capture
+	Type ProfileType
+
+	// How long CPU profiles sample for
+	Duration time.Duration
+
+	// Requests slower than this trigger a capture.  Zero disables latency
+	// triggers.
+	LatencyThreshold time.Duration
+
+	// Number of failed requests within ErrorWindow that triggers a capture.
+	// Zero disables error triggers.
+	ErrorThreshold int
+
+	// Window over which failed requests are counted
+	ErrorWindow time.Duration
+
+	// Minimum time between the start of two captures
+	Cooldown time.Duration
+
+	// Number of frames included in the summary
+	TopFrames int
+
+	// Optional hook to store the full profile
+	Upload ProfileUploadFunc
+}
+
+// NewProfileCaptureConfig creates a profile capture configuration with
+// default values.  No triggers are enabled.
+func NewProfileCaptureConfig() *ProfileCaptureConfig {
+	return &ProfileCaptureConfig{
+		Type:        ProfileTypeCPU,
+		Duration:    5 * time.Second,
+		ErrorWindow: time.Minute,
+		Cooldown:    10 * time.Minute,
+		TopFrames:   10,
+	}
+}
+
+// ProfileCapturer captures a short runtime profile when error or latency
+// thresholds trip, and tracks a ProfileCaptured event with its top frames.
+// Captures run in the background and at most one runs at a time.
+type ProfileCapturer struct {
+	config *ProfileCaptureConfig
+	client Tracker
+
+	lock        sync.Mutex
+	capturing   bool
+	lastCapture time.Time
+	errorCount  int
+	errorsSince time.Time
+	captures    sync.WaitGroup
+}
+
+// NewProfileCapturer creates a profile capturer that tracks profile
+// summaries through client.
+func NewProfileCapturer(config *ProfileCaptureConfig, client Tracker) *ProfileCapturer {
+	return &ProfileCapturer{
+		config: config,
+		client: client,
+	}
+}
+
+// ObserveRequest records the outcome of a request and triggers a capture if
+// it trips a threshold.
+func (capturer *ProfileCapturer) ObserveRequest(duration time.Duration, success bool) {
+	config := capturer.config
+	if config.LatencyThreshold > 0 && duration > config.LatencyThreshold {
+		capturer.Capture(fmt.Sprintf("request took %s, exceeding %s", duration, config.LatencyThreshold))
+		return
+	}
+
+	if success || config.ErrorThreshold <= 0 {
+		return
+	}
+
+	now := currentClock.Now()
+
+	capturer.lock.Lock()
+	if now.Sub(capturer.errorsSince) > config.ErrorWindow {
+		capturer.errorCount = 0
+		capturer.errorsSince = now
+	}
+	capturer.errorCount++
+	tripped := capturer.errorCount >= config.ErrorThreshold
+	if tripped {
+		capturer.errorCount = 0
+	}
+	capturer.lock.Unlock()
+
+	if tripped {
+		capturer.Capture(fmt.Sprintf("%d failed requests within %s", config.ErrorThreshold, config.ErrorWindow))
+	}
+}
+
+// Capture starts capturing a profile in the background.  Returns false if a
+// capture is in progress or the cooldown has not elapsed.
+func (capturer *ProfileCapturer) Capture(reason string) bool {
+	now := currentClock.Now()
+
+	capturer.lock.Lock()
+	if capturer.capturing || (!capturer.lastCapture.IsZero() && now.Sub(capturer.lastCapture) < capturer.config.Cooldown) {
+		capturer.lock.Unlock()
+		return false
+	}
+	capturer.capturing = true
+	capturer.lastCapture = now
+	capturer.captures.Add(1)
+	capturer.lock.Unlock()
+
+	go func() {
+		defer capturer.captures.Done()
+		defer func() {
+			capturer.lock.Lock()
+			capturer.capturing = false
+			capturer.lock.Unlock()
+		}()
+
+		if err := capturer.capture(reason); err != nil {
+			diagnosticsWriter.Printf("Failed to capture %s profile: %s", capturer.config.Type, err)
+		}
+	}()
+
+	return true
+}
+
+// Wait blocks until any capture in progress has been tracked.
+func (capturer *ProfileCapturer) Wait() {
+	capturer.captures.Wait()
+}
+
+func (capturer *ProfileCapturer) capture(reason string) error {
+	config := capturer.config
+	start := time.Now()
+
+	var buf bytes.Buffer
+	switch config.Type {
+	case ProfileTypeCPU, "":
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return err
+		}
+		time.Sleep(config.Duration)
+		pprof.StopCPUProfile()
+	case ProfileTypeGoroutine:
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown profile type %q", config.Type)
+	}
+
+	frames, samples, err := summarizeProfile(buf.Bytes(), config.TopFrames)
+	if err != nil {
+		return err
+	}
+
+	profileType := config.Type
+	if profileType == "" {
+		profileType = ProfileTypeCPU
+	}
+
+	event := NewEventTelemetry(ProfileCapturedEventName)
+	event.Properties["profileType"] = string(profileType)
+	event.Properties["reason"] = reason
+	event.Measurements["samples"] = float64(samples)
+	event.Measurements["captureDurationMs"] = toMilliseconds(time.Since(start))
+
+	lines := make([]string, len(frames))
+	for i, frame := range frames {
+		lines[i] = frame.String()
+	}
+	event.Properties["topFrames"] = strings.Join(lines, "\n")
+
+	if config.Upload != nil {
+		location, err := config.Upload(SuppressTelemetry(context.Background()), profileType, buf.Bytes())
+		if err != nil {
+			diagnosticsWriter.Printf("Failed to upload %s profile: %s", profileType, err)
+		} else if location != "" {
+			event.Properties["profileLocation"] = location
+		}
+	}
+
+	capturer.client.Track(event)
+	return nil
+}
@@ -0,0 +1,216 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newProfileTestCapturer(config *ProfileCaptureConfig) (*ProfileCapturer, *TestTelemetryChannel) {
+	client, testChannel := newTestClient()
+	return NewProfileCapturer(config, client), testChannel
+}
+
+func profileTestWaiter(started, release chan struct{}) {
+	started <- struct{}{}
+	<-release
+}
+
+func TestProfileCaptureGoroutine(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 20; i++ {
+		go profileTestWaiter(started, release)
+		<-started
+	}
+
+	config := NewProfileCaptureConfig()
+	config.Type = ProfileTypeGoroutine
+	config.TopFrames = 0
+	var uploaded []byte
+	config.Upload = func(ctx context.Context, profileType ProfileType, profile []byte) (string, error) {
+		uploaded = profile
+		return "https://example.blob.core.windows.net/profiles/1.pb.gz", nil
+	}
+	capturer, testChannel := newProfileTestCapturer(config)
+
+	if !capturer.Capture("manual") {
+		t.Fatal("Expected capture to start")
+	}
+	capturer.Wait()
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 event, got %d", testChannel.getSentCount())
+	}
+	event := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Name != ProfileCapturedEventName || event.Properties["profileType"] != "goroutine" || event.Properties["reason"] != "manual" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if !strings.Contains(event.Properties["topFrames"], "appinsights.profileTestWaiter") {
+		t.Errorf("Expected the parked goroutines in the top frames, got:\n%s", event.Properties["topFrames"])
+	}
+	if event.Measurements["samples"] == 0 {
+		t.Error("Expected samples to be counted")
+	}
+	if len(uploaded) == 0 || event.Properties["profileLocation"] == "" {
+		t.Error("Expected profile to be uploaded and its location recorded")
+	}
+}
+
+func TestProfileCaptureCPU(t *testing.T) {
+	config := NewProfileCaptureConfig()
+	config.Duration = 50 * time.Millisecond
+	config.Upload = func(context.Context, ProfileType, []byte) (string, error) {
+		return "", errors.New("upload failed")
+	}
+	capturer, testChannel := newProfileTestCapturer(config)
+
+	capturer.Capture("manual")
+	capturer.Wait()
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 event, got %d", testChannel.getSentCount())
+	}
+	event := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Properties["profileType"] != "cpu" || event.Measurements["captureDurationMs"] < 50 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if _, ok := event.Properties["profileLocation"]; ok {
+		t.Error("Expected no location after a failed upload")
+	}
+}
+
+func TestProfileCaptureTriggers(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	config := NewProfileCaptureConfig()
+	config.Type = ProfileTypeGoroutine
+	config.LatencyThreshold = time.Second
+	config.ErrorThreshold = 3
+	config.ErrorWindow = time.Minute
+	config.Cooldown = 10 * time.Minute
+	capturer, testChannel := newProfileTestCapturer(config)
+
+	capturer.ObserveRequest(500*time.Millisecond, true)
+	capturer.ObserveRequest(10*time.Millisecond, false)
+	capturer.ObserveRequest(10*time.Millisecond, false)
+	capturer.Wait()
+	if testChannel.getSentCount() != 0 {
+		t.Fatal("Expected no capture below thresholds")
+	}
+
+	// Errors outside the window don't count
+	fakeClock.Increment(2 * time.Minute)
+	capturer.ObserveRequest(10*time.Millisecond, false)
+	capturer.ObserveRequest(10*time.Millisecond, false)
+	capturer.Wait()
+	if testChannel.getSentCount() != 0 {
+		t.Fatal("Expected errors to be counted within the window")
+	}
+
+	capturer.ObserveRequest(10*time.Millisecond, false)
+	capturer.Wait()
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected error threshold to trigger a capture, got %d", testChannel.getSentCount())
+	}
+	event := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if !strings.Contains(event.Properties["reason"], "3 failed requests") {
+		t.Errorf("Unexpected reason: %s", event.Properties["reason"])
+	}
+
+	// Within the cooldown
+	capturer.ObserveRequest(2*time.Second, true)
+	capturer.Wait()
+	if testChannel.getSentCount() != 1 {
+		t.Fatal("Expected no capture during the cooldown")
+	}
+
+	fakeClock.Increment(10 * time.Minute)
+	capturer.ObserveRequest(2*time.Second, true)
+	capturer.Wait()
+	if testChannel.getSentCount() != 2 {
+		t.Fatal("Expected latency threshold to trigger a capture after the cooldown")
+	}
+}
+
+func TestProfileCaptureMiddleware(t *testing.T) {
+	config := NewProfileCaptureConfig()
+	config.Type = ProfileTypeGoroutine
+	config.ErrorThreshold = 1
+	capturer, testChannel := newProfileTestCapturer(config)
+
+	middleware := NewHTTPMiddleware()
+	middleware.ProfileCapture = capturer
+	middleware.GetClient = func(*http.Request) TelemetryClient { return capturer.client.(TelemetryClient) }
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	capturer.Wait()
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected request and profile event, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestSummarizeProfile(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 20; i++ {
+		go profileTestWaiter(started, release)
+		<-started
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, samples, err := summarizeProfile(buf.Bytes(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if samples == 0 || len(frames) == 0 {
+		t.Fatal("Expected samples and frames")
+	}
+
+	var total float64
+	found := false
+	for _, frame := range frames {
+		total += frame.Percent
+		if strings.HasSuffix(frame.Function, "appinsights.profileTestWaiter") {
+			found = true
+			if frame.Value < 20 {
+				t.Errorf("Expected at least 20 goroutines in profileTestWaiter, got %d", frame.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected goroutines to be attributed to profileTestWaiter rather than the runtime")
+	}
+	if total < 99.9 || total > 100.1 {
+		t.Errorf("Expected percentages to add up to 100, got %f", total)
+	}
+
+	if frames, _, _ := summarizeProfile(buf.Bytes(), 1); len(frames) != 1 {
+		t.Errorf("Expected frames to be limited to 1, got %d", len(frames))
+	}
+}
+
+func TestSummarizeProfileMalformed(t *testing.T) {
+	if _, _, err := summarizeProfile([]byte{0x0a, 0xff}, 10); err == nil {
+		t.Error("Expected error for malformed profile")
+	}
+}
@@ -0,0 +1,148 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Carrier carries correlation across a transport, such as HTTP headers,
+// message properties or RPC metadata.  See InjectCorrelation and
+// ExtractCorrelation.
+type Carrier interface {
+	// Get returns the value stored under key, or "" if there is none.
+	Get(key string) string
+
+	// Set stores a value under key, replacing any existing value.
+	Set(key, value string)
+}
+
+// InjectCorrelation records the correlation context of ctx in the carrier,
+// in both W3C and Request-Id formats.  It does nothing if ctx has no
+// correlation context.
+//
+//	InjectCorrelation(ctx, MapCarrier(message.Properties))
+func InjectCorrelation(ctx context.Context, carrier Carrier) {
+	if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+		injectCorrelation(carrier, corrCtx, PropagateBoth)
+	}
+}
+
+// ExtractCorrelation reads the correlation context recorded in the carrier
+// and returns a context with a child of it, so that telemetry tracked with
+// the returned context continues the sender's trace.  If the carrier holds
+// no valid correlation, ctx is returned unchanged.
+//
+//	ctx = ExtractCorrelation(ctx, MapCarrier(message.Properties))
+func ExtractCorrelation(ctx context.Context, carrier Carrier) context.Context {
+	if corrCtx := extractCorrelation(carrier); corrCtx != nil {
+		return WithCorrelationContext(ctx, NewChildCorrelationContext(corrCtx))
+	}
+
+	return ctx
+}
+
+// injectCorrelation records corrCtx in the carrier, in the specified format
+func injectCorrelation(carrier Carrier, corrCtx *CorrelationContext, format PropagationFormat) {
+	if format.w3c() {
+		carrier.Set(TraceParentHeader, corrCtx.ToW3CTraceParent())
+	}
+
+	if format.requestID() {
+		carrier.Set(RequestIDHeader, corrCtx.ToRequestID())
+	}
+}
+
+// extractCorrelation reads the correlation context recorded in the carrier,
+// preferring W3C Trace Context over Request-Id.  Returns nil if there is
+// none.
+func extractCorrelation(carrier Carrier) *CorrelationContext {
+	if traceParent := carrier.Get(TraceParentHeader); traceParent != "" {
+		if corrCtx, err := parseW3CTraceParent(traceParent); err == nil {
+			// Replace all-zero IDs sent by malformed callers, keeping the
+			// rest of the value
+			if corrCtx.Normalize() {
+				diagnosticsWriter.Printf("Replaced invalid IDs in traceparent: %s", traceParent)
+			}
+
+			return corrCtx
+		}
+	}
+
+	if requestID := carrier.Get(RequestIDHeader); requestID != "" {
+		if corrCtx, err := ParseRequestID(requestID); err == nil {
+			return corrCtx
+		}
+	}
+
+	return nil
+}
+
+// HeaderCarrier adapts HTTP headers to a Carrier.
+type HeaderCarrier http.Header
+
+// Get returns the first value of the header.
+func (carrier HeaderCarrier) Get(key string) string {
+	return http.Header(carrier).Get(key)
+}
+
+// Set replaces the values of the header.
+func (carrier HeaderCarrier) Set(key, value string) {
+	http.Header(carrier).Set(key, value)
+}
+
+// MapCarrier adapts a map of strings, such as message application
+// properties or a JSON object decoded into map[string]string, to a Carrier.
+// Keys are case-sensitive.
+type MapCarrier map[string]string
+
+// Get returns the value stored under key.
+func (carrier MapCarrier) Get(key string) string {
+	return carrier[key]
+}
+
+// Set stores a value under key.
+func (carrier MapCarrier) Set(key, value string) {
+	carrier[key] = value
+}
+
+// AMQPTableCarrier adapts an AMQP table, such as the headers of an AMQP
+// 0-9-1 message (amqp.Table), to a Carrier.  Values are stored as strings;
+// string and byte slice values are read.
+type AMQPTableCarrier map[string]interface{}
+
+// Get returns the value stored under key, if it is a string or byte slice.
+func (carrier AMQPTableCarrier) Get(key string) string {
+	switch value := carrier[key].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return ""
+	}
+}
+
+// Set stores a value under key.
+func (carrier AMQPTableCarrier) Set(key, value string) {
+	carrier[key] = value
+}
+
+// MetadataCarrier adapts RPC metadata with multiple values per key and
+// lowercase keys, such as gRPC metadata (metadata.MD), to a Carrier.  Use
+// it with the metadata of protobuf-based transports.
+type MetadataCarrier map[string][]string
+
+// Get returns the first value stored under the lowercase key.
+func (carrier MetadataCarrier) Get(key string) string {
+	if values := carrier[strings.ToLower(key)]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// Set replaces the values stored under the lowercase key.
+func (carrier MetadataCarrier) Set(key, value string) {
+	carrier[strings.ToLower(key)] = []string{value}
+}
@@ -0,0 +1,70 @@
+package appinsights
+
+import "net/http"
+
+// PropagationFormat selects the correlation headers sent with outgoing
+// requests and responses.  Incoming requests are always accepted in either
+// format.
+type PropagationFormat int
+
+const (
+	// PropagateBoth sends both the W3C traceparent header and the legacy
+	// Request-Id header.  This is the default.
+	PropagateBoth PropagationFormat = iota
+
+	// PropagateW3C only sends the W3C traceparent header
+	PropagateW3C
+
+	// PropagateRequestID only sends the legacy Request-Id header
+	PropagateRequestID
+)
+
+// String returns the name of the format.
+func (format PropagationFormat) String() string {
+	switch format {
+	case PropagateW3C:
+		return "W3C"
+	case PropagateRequestID:
+		return "RequestId"
+	default:
+		return "Both"
+	}
+}
+
+// ResponseHeaderMode selects the correlation headers that HTTPMiddleware
+// sets on responses.  HTTPMiddleware.OperationIDHeader is set regardless.
+type ResponseHeaderMode int
+
+const (
+	// ResponseHeadersDefault sets the Request-Id header, unless the
+	// middleware's PropagationFormat is PropagateW3C.
+	ResponseHeadersDefault ResponseHeaderMode = iota
+
+	// ResponseHeadersNone sets no correlation headers.
+	ResponseHeadersNone
+
+	// ResponseHeadersRequestID always sets the Request-Id header.
+	ResponseHeadersRequestID
+
+	// ResponseHeadersTraceParent echoes the request's span in a W3C
+	// traceparent header.
+	ResponseHeadersTraceParent
+
+	// ResponseHeadersCustom sets the headers chosen by the middleware's
+	// ResponseHeaderFunc.
+	ResponseHeadersCustom
+)
+
+func (format PropagationFormat) w3c() bool {
+	return format != PropagateRequestID
+}
+
+func (format PropagationFormat) requestID() bool {
+	return format != PropagateW3C
+}
+
+// injectCorrelationHeaders sets the correlation headers of the specified
+// format on an outgoing request
+func injectCorrelationHeaders(header http.Header, corrCtx *CorrelationContext, format PropagationFormat) {
+	injectCorrelation(HeaderCarrier(header), corrCtx, format)
+}
@@ -0,0 +1,122 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPropagationFormatMiddleware(t *testing.T) {
+	tests := []struct {
+		format      PropagationFormat
+		traceParent bool
+		requestID   bool
+	}{
+		{PropagateBoth, true, true},
+		{PropagateW3C, true, false},
+		{PropagateRequestID, false, true},
+	}
+
+	corrCtx := NewCorrelationContext()
+	for _, test := range tests {
+		middleware := NewHTTPMiddleware()
+		middleware.PropagationFormat = test.format
+
+		req := httptest.NewRequest("GET", "/", nil)
+		middleware.InjectHeaders(req, corrCtx)
+		if (req.Header.Get(TraceParentHeader) != "") != test.traceParent {
+			t.Errorf("%s: unexpected traceparent %q", test.format, req.Header.Get(TraceParentHeader))
+		}
+		if (req.Header.Get(RequestIDHeader) != "") != test.requestID {
+			t.Errorf("%s: unexpected Request-Id %q", test.format, req.Header.Get(RequestIDHeader))
+		}
+
+		recorder := httptest.NewRecorder()
+		middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		if (recorder.Header().Get(RequestIDHeader) != "") != test.requestID {
+			t.Errorf("%s: unexpected response Request-Id %q", test.format, recorder.Header().Get(RequestIDHeader))
+		}
+	}
+}
+
+func TestResponseHeaderModes(t *testing.T) {
+	const incoming = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	tests := []struct {
+		mode        ResponseHeaderMode
+		format      PropagationFormat
+		requestID   bool
+		traceParent bool
+		custom      bool
+	}{
+		{ResponseHeadersDefault, PropagateBoth, true, false, false},
+		{ResponseHeadersDefault, PropagateW3C, false, false, false},
+		{ResponseHeadersNone, PropagateBoth, false, false, false},
+		{ResponseHeadersRequestID, PropagateW3C, true, false, false},
+		{ResponseHeadersTraceParent, PropagateBoth, false, true, false},
+		{ResponseHeadersCustom, PropagateBoth, false, false, true},
+	}
+
+	for _, test := range tests {
+		middleware := NewHTTPMiddleware()
+		middleware.PropagationFormat = test.format
+		middleware.ResponseHeaders = test.mode
+		middleware.OperationIDHeader = "x-ms-request-id"
+		middleware.ResponseHeaderFunc = func(header http.Header, corrCtx *CorrelationContext) {
+			header.Set("x-trace-id", corrCtx.TraceID)
+		}
+
+		var spanID string
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(TraceParentHeader, incoming)
+		recorder := httptest.NewRecorder()
+		middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			spanID = GetCorrelationContext(r.Context()).SpanID
+		})).ServeHTTP(recorder, req)
+
+		header := recorder.Header()
+		if (header.Get(RequestIDHeader) != "") != test.requestID {
+			t.Errorf("Mode %d: unexpected Request-Id %q", test.mode, header.Get(RequestIDHeader))
+		}
+		if (header.Get(TraceParentHeader) != "") != test.traceParent {
+			t.Errorf("Mode %d: unexpected traceparent %q", test.mode, header.Get(TraceParentHeader))
+		}
+		if test.traceParent && header.Get(TraceParentHeader) != "00-0af7651916cd43dd8448eb211c80319c-"+spanID+"-01" {
+			t.Errorf("Expected the request's span to be echoed, got %q", header.Get(TraceParentHeader))
+		}
+		if (header.Get("x-trace-id") == "0af7651916cd43dd8448eb211c80319c") != test.custom {
+			t.Errorf("Mode %d: unexpected custom header %q", test.mode, header.Get("x-trace-id"))
+		}
+		if header.Get("x-ms-request-id") != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("Mode %d: expected the operation ID header regardless of mode", test.mode)
+		}
+	}
+}
+
+func TestPropagationFormatHTTPClient(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	httpClient := NewHTTPClient(nil)
+	httpClient.PropagationFormat = PropagateW3C
+
+	ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := httpClient.DoWithContext(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+
+	header := <-headers
+	if header.Get(TraceParentHeader) == "" {
+		t.Error("Expected a traceparent header")
+	}
+	if header.Get(RequestIDHeader) != "" {
+		t.Errorf("Expected no Request-Id header, got %q", header.Get(RequestIDHeader))
+	}
+}
@@ -0,0 +1,62 @@
+package appinsights
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCarrierRoundTrip(t *testing.T) {
+	carriers := map[string]Carrier{
+		"header":   HeaderCarrier(make(http.Header)),
+		"map":      MapCarrier(make(map[string]string)),
+		"amqp":     AMQPTableCarrier(make(map[string]interface{})),
+		"metadata": MetadataCarrier(make(map[string][]string)),
+	}
+
+	parent := NewCorrelationContext()
+	sendCtx := WithCorrelationContext(context.Background(), parent)
+	for name, carrier := range carriers {
+		InjectCorrelation(sendCtx, carrier)
+
+		corrCtx := GetCorrelationContext(ExtractCorrelation(context.Background(), carrier))
+		if corrCtx == nil {
+			t.Errorf("%s: expected a correlation context", name)
+			continue
+		}
+		if corrCtx.TraceID != parent.TraceID || corrCtx.ParentSpanID != parent.SpanID {
+			t.Errorf("%s: expected a child of the sender's span", name)
+		}
+	}
+
+	if keys := carriers["metadata"].(MetadataCarrier); len(keys["traceparent"]) != 1 || len(keys["request-id"]) != 1 {
+		t.Errorf("Expected lowercase metadata keys, got %v", keys)
+	}
+}
+
+func TestCarrierFallbacks(t *testing.T) {
+	parent := NewCorrelationContext()
+
+	// Request-Id only, with a byte slice value as sent by some AMQP clients
+	table := AMQPTableCarrier{RequestIDHeader: []byte(parent.ToRequestID())}
+	if corrCtx := GetCorrelationContext(ExtractCorrelation(context.Background(), table)); corrCtx == nil || corrCtx.GetOperationID() != parent.GetOperationID() {
+		t.Error("Expected the Request-Id to be extracted")
+	}
+
+	// Carried through JSON
+	carrier := MapCarrier{}
+	InjectCorrelation(WithCorrelationContext(context.Background(), parent), carrier)
+	payload, _ := json.Marshal(carrier)
+
+	var decoded MapCarrier
+	json.Unmarshal(payload, &decoded)
+	if GetCorrelationContext(ExtractCorrelation(context.Background(), decoded)) == nil {
+		t.Error("Expected the correlation to survive JSON encoding")
+	}
+
+	ctx := context.Background()
+	if ExtractCorrelation(ctx, MapCarrier{TraceParentHeader: "invalid"}) != ctx {
+		t.Error("Expected the context to be unchanged without valid correlation")
+	}
+}
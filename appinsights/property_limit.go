@@ -0,0 +1,128 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// DefaultOverflowProperty is the name of the property that holds spilled
+// properties.
+const DefaultOverflowProperty = "propertiesOverflow"
+
+// maxPropertyValueLength is the longest property value accepted by the
+// ingestion endpoint; longer values are truncated during sanitization
+const maxPropertyValueLength = 8192
+
+// PropertyOverflowPolicy determines what happens to the properties of a
+// telemetry item beyond PropertyLimitConfig.MaxProperties.
+type PropertyOverflowPolicy int
+
+const (
+	// PropertyOverflowSpill moves overflowing properties into a single
+	// JSON-encoded property.  Properties that don't fit in its maximum
+	// length are dropped.
+	PropertyOverflowSpill PropertyOverflowPolicy = iota
+
+	// PropertyOverflowDrop drops overflowing properties.
+	PropertyOverflowDrop
+)
+
+// PropertyLimitConfig bounds the number of properties on each telemetry
+// item, so that items with oversized property maps lose their least
+// important properties predictably instead of being rejected or truncated
+// at ingestion.
+type PropertyLimitConfig struct {
+	// Maximum number of properties kept on each item, including the
+	// overflow property
+	MaxProperties int
+
+	// What to do with the properties beyond MaxProperties
+	Policy PropertyOverflowPolicy
+
+	// Priorities of property keys.  Properties with a higher priority are
+	// kept first; unlisted properties have priority zero.  Ties are broken
+	// by key, so the same properties are always kept.
+	Priorities map[string]int
+
+	// Name of the property that holds spilled properties.  Defaults to
+	// DefaultOverflowProperty.
+	OverflowProperty string
+}
+
+// NewPropertyLimitConfig creates a property limit configuration with
+// default values.
+func NewPropertyLimitConfig() *PropertyLimitConfig {
+	return &PropertyLimitConfig{
+		MaxProperties:    200,
+		Policy:           PropertyOverflowSpill,
+		OverflowProperty: DefaultOverflowProperty,
+	}
+}
+
+// apply enforces the limit on the properties of an envelope.  Returns the
+// number of properties that were dropped.
+func (config *PropertyLimitConfig) apply(envelope *contracts.Envelope) int {
+	props := envelopeProperties(envelope)
+	if config.MaxProperties <= 0 || len(props) <= config.MaxProperties {
+		return 0
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := config.Priorities[keys[i]], config.Priorities[keys[j]]
+		if pi != pj {
+			return pi > pj
+		}
+		return keys[i] < keys[j]
+	})
+
+	if config.Policy == PropertyOverflowDrop {
+		for _, k := range keys[config.MaxProperties:] {
+			delete(props, k)
+		}
+
+		return len(keys) - config.MaxProperties
+	}
+
+	overflowProperty := config.OverflowProperty
+	if overflowProperty == "" {
+		overflowProperty = DefaultOverflowProperty
+	}
+
+	// Reserve a slot for the overflow property
+	overflow := keys[config.MaxProperties-1:]
+	spilled := make(map[string]string, len(overflow))
+	length := 2 // braces
+	dropped := 0
+	for _, k := range overflow {
+		v := props[k]
+		delete(props, k)
+
+		// Length of `"key":"value",` once encoded
+		encodedKey, _ := json.Marshal(k)
+		encodedValue, _ := json.Marshal(v)
+		entryLength := len(encodedKey) + len(encodedValue) + 2
+		if length+entryLength > maxPropertyValueLength {
+			dropped++
+			continue
+		}
+
+		spilled[k] = v
+		length += entryLength
+	}
+
+	if len(spilled) > 0 {
+		if encoded, err := json.Marshal(spilled); err == nil && len(encoded) <= maxPropertyValueLength {
+			props[overflowProperty] = string(encoded)
+		} else {
+			dropped += len(spilled)
+		}
+	}
+
+	return dropped
+}
@@ -0,0 +1,101 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newPropertyLimitTestClient(limit *PropertyLimitConfig) (TelemetryClient, *TestTelemetryChannel) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.PropertyLimit = limit
+	return newTestClient(config)
+}
+
+func newEventWithProperties(count int) *EventTelemetry {
+	event := NewEventTelemetry("event")
+	for i := 0; i < count; i++ {
+		event.Properties[fmt.Sprintf("key%02d", i)] = fmt.Sprintf("value%02d", i)
+	}
+	return event
+}
+
+func sentEventProperties(testChannel *TestTelemetryChannel) map[string]string {
+	return testChannel.sentItems[len(testChannel.sentItems)-1].Data.(*contracts.Data).BaseData.(*contracts.EventData).Properties
+}
+
+func TestPropertyLimitSpill(t *testing.T) {
+	limit := NewPropertyLimitConfig()
+	limit.MaxProperties = 5
+	limit.Priorities = map[string]int{"key09": 1}
+	client, testChannel := newPropertyLimitTestClient(limit)
+
+	client.Track(newEventWithProperties(10))
+	props := sentEventProperties(testChannel)
+
+	if len(props) != 5 {
+		t.Fatalf("Expected 5 properties, got %d: %v", len(props), props)
+	}
+	for _, k := range []string{"key09", "key00", "key01", "key02"} {
+		if _, ok := props[k]; !ok {
+			t.Errorf("Expected %s to be kept", k)
+		}
+	}
+
+	var spilled map[string]string
+	if err := json.Unmarshal([]byte(props[DefaultOverflowProperty]), &spilled); err != nil {
+		t.Fatalf("Expected JSON-encoded overflow property: %s", err)
+	}
+	if len(spilled) != 6 || spilled["key03"] != "value03" || spilled["key08"] != "value08" {
+		t.Errorf("Unexpected spilled properties: %v", spilled)
+	}
+
+	// Items within the limit are untouched
+	client.Track(newEventWithProperties(5))
+	if props := sentEventProperties(testChannel); len(props) != 5 || props[DefaultOverflowProperty] != "" {
+		t.Errorf("Expected properties within the limit to be untouched, got %v", props)
+	}
+}
+
+func TestPropertyLimitSpillMaxLength(t *testing.T) {
+	limit := &PropertyLimitConfig{MaxProperties: 1, OverflowProperty: "extra"}
+	client, testChannel := newPropertyLimitTestClient(limit)
+
+	event := NewEventTelemetry("event")
+	event.Properties["a"] = strings.Repeat("<", 1000)
+	event.Properties["b"] = strings.Repeat("x", 8000)
+	event.Properties["c"] = "small"
+	client.Track(event)
+
+	props := sentEventProperties(testChannel)
+	if len(props) != 1 || len(props["extra"]) > maxPropertyValueLength {
+		t.Fatalf("Expected a single overflow property within the maximum length, got %d properties", len(props))
+	}
+
+	var spilled map[string]string
+	if err := json.Unmarshal([]byte(props["extra"]), &spilled); err != nil {
+		t.Fatalf("Expected overflow property to be valid JSON: %s", err)
+	}
+	if _, ok := spilled["b"]; ok || spilled["a"] == "" || spilled["c"] != "small" {
+		t.Errorf("Expected the property that doesn't fit to be dropped, got %d spilled properties", len(spilled))
+	}
+}
+
+func TestPropertyLimitDrop(t *testing.T) {
+	limit := &PropertyLimitConfig{
+		MaxProperties: 3,
+		Policy:        PropertyOverflowDrop,
+		Priorities:    map[string]int{"key07": 10, "key05": 5, "key00": -1},
+	}
+	client, testChannel := newPropertyLimitTestClient(limit)
+
+	client.Track(newEventWithProperties(8))
+	props := sentEventProperties(testChannel)
+
+	if len(props) != 3 || props["key07"] == "" || props["key05"] == "" || props["key01"] == "" {
+		t.Errorf("Expected the highest priority properties to be kept, got %v", props)
+	}
+}
@@ -0,0 +1,119 @@
+package appinsights
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecordedBatch is a batch of telemetry captured by a TelemetryRecorder
+// instead of being transmitted.
+type RecordedBatch struct {
+	// When the batch would have been submitted
+	Time time.Time
+
+	// Number of telemetry items in the batch
+	ItemCount int
+
+	// The payload that would have been submitted: newline-delimited JSON
+	// envelopes in the Application Insights ingestion format, or the OTLP
+	// export requests of the batch, one per line, when the channel is
+	// configured for OTLP
+	Payload []byte
+
+	// File the batch was written to, if the recorder has a directory
+	Path string
+}
+
+// RecordingConfig configures a TelemetryRecorder.
+type RecordingConfig struct {
+	// Directory to which each batch is also written, as a file named after
+	// its time (optional).  The directory must exist.
+	Directory string
+
+	// How long batches are kept, in memory and on disk (optional).  Older
+	// batches are discarded when new batches are recorded or exported.
+	// Zero keeps batches indefinitely.
+	Retention time.Duration
+}
+
+// TelemetryRecorder captures the batches a channel would submit without
+// ever transmitting them, for environments that need to validate what
+// telemetry would leave the host.  Set it as TelemetryConfiguration.Recorder
+// and inspect the batches with Export.
+type TelemetryRecorder struct {
+	config  RecordingConfig
+	lock    sync.Mutex
+	batches []*RecordedBatch
+}
+
+// NewTelemetryRecorder creates a recorder with the specified configuration.
+func NewTelemetryRecorder(config RecordingConfig) *TelemetryRecorder {
+	return &TelemetryRecorder{config: config}
+}
+
+// Export returns the recorded batches that haven't expired, oldest first.
+func (recorder *TelemetryRecorder) Export() []RecordedBatch {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.expire()
+
+	result := make([]RecordedBatch, len(recorder.batches))
+	for i, batch := range recorder.batches {
+		result[i] = *batch
+	}
+
+	return result
+}
+
+// Transmit records a batch in place of submitting it, and reports success
+// to the channel.
+func (recorder *TelemetryRecorder) Transmit(payload []byte, items telemetryBufferItems) (*transmissionResult, error) {
+	batch := &RecordedBatch{
+		Time:      currentClock.Now(),
+		ItemCount: len(items),
+		Payload:   append([]byte(nil), payload...),
+	}
+
+	if recorder.config.Directory != "" {
+		batch.Path = filepath.Join(recorder.config.Directory, fmt.Sprintf("batch-%d.json", batch.Time.UnixNano()))
+		if err := os.WriteFile(batch.Path, batch.Payload, 0600); err != nil {
+			diagnosticsWriter.Printf("Failed to write recorded batch: %s", err.Error())
+			batch.Path = ""
+		}
+	}
+
+	recorder.lock.Lock()
+	recorder.batches = append(recorder.batches, batch)
+	recorder.expire()
+	recorder.lock.Unlock()
+
+	diagnosticsWriter.Printf("Recorded %d items without transmitting", len(items))
+	return &transmissionResult{statusCode: successResponse}, nil
+}
+
+// expire discards batches older than the retention period.  Must be called
+// with the lock held.
+func (recorder *TelemetryRecorder) expire() {
+	if recorder.config.Retention <= 0 {
+		return
+	}
+
+	cutoff := currentClock.Now().Add(-recorder.config.Retention)
+	expired := 0
+	for expired < len(recorder.batches) && recorder.batches[expired].Time.Before(cutoff) {
+		if path := recorder.batches[expired].Path; path != "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				diagnosticsWriter.Printf("Failed to remove expired batch: %s", err.Error())
+			}
+		}
+
+		recorder.batches[expired] = nil
+		expired++
+	}
+
+	recorder.batches = recorder.batches[expired:]
+}
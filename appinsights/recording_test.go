@@ -0,0 +1,92 @@
+package appinsights
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTelemetryRecorder(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewTelemetryRecorder(RecordingConfig{Directory: dir})
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.EndpointUrl = "http://invalid.invalid/v2/track"
+	config.Recorder = recorder
+	client := NewTelemetryClientFromConfig(config)
+
+	client.TrackTrace("~recorded~", Information)
+	client.TrackEvent("~event~")
+
+	select {
+	case <-client.Channel().Close():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Channel didn't close")
+	}
+
+	batches := recorder.Export()
+	if len(batches) != 1 || batches[0].ItemCount != 2 {
+		t.Fatalf("Expected one batch of 2 items, got %+v", batches)
+	}
+	if !bytes.Contains(batches[0].Payload, []byte("~recorded~")) || !bytes.Contains(batches[0].Payload, []byte("~event~")) {
+		t.Errorf("Unexpected payload: %s", batches[0].Payload)
+	}
+
+	written, err := os.ReadFile(batches[0].Path)
+	if err != nil {
+		t.Fatalf("Expected the batch to be written: %s", err)
+	}
+	if !bytes.Equal(written, batches[0].Payload) {
+		t.Error("Written batch doesn't match the payload")
+	}
+}
+
+func TestTelemetryRecorderOTLP(t *testing.T) {
+	recorder := NewTelemetryRecorder(RecordingConfig{})
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.IngestionProtocol = IngestionProtocolOTLP
+	config.OTLPEndpoint = "http://invalid.invalid"
+	config.Recorder = recorder
+	client := NewTelemetryClientFromConfig(config)
+
+	client.TrackTrace("~recorded~", Information)
+	<-client.Channel().Close(time.Second)
+
+	// Batches are recorded as they would be exported
+	batches := recorder.Export()
+	if len(batches) != 1 || !bytes.Contains(batches[0].Payload, []byte(`"resourceLogs"`)) || !bytes.Contains(batches[0].Payload, []byte("~recorded~")) {
+		t.Fatalf("Expected an OTLP batch, got %+v", batches)
+	}
+}
+
+func TestTelemetryRecorderRetention(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	dir := t.TempDir()
+	recorder := NewTelemetryRecorder(RecordingConfig{Directory: dir, Retention: time.Minute})
+	items := telemetryBuffer(NewTraceTelemetry("msg", Information))
+
+	result, err := recorder.Transmit([]byte("first"), items)
+	if err != nil || !result.IsSuccess() {
+		t.Fatalf("Expected success, got %v %v", result, err)
+	}
+	first := recorder.Export()[0]
+
+	fakeClock.Increment(45 * time.Second)
+	recorder.Transmit([]byte("second"), items)
+	if batches := recorder.Export(); len(batches) != 2 {
+		t.Fatalf("Expected 2 batches, got %d", len(batches))
+	}
+
+	fakeClock.Increment(30 * time.Second)
+	batches := recorder.Export()
+	if len(batches) != 1 || string(batches[0].Payload) != "second" {
+		t.Fatalf("Expected only the second batch, got %+v", batches)
+	}
+	if _, err := os.Stat(first.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired batch to be removed from disk, got %v", err)
+	}
+}
@@ -0,0 +1,377 @@
+package appinsights
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// RedactionPolicyEnvVar is the environment variable read by default for a
+// JSON redaction policy.
+const RedactionPolicyEnvVar = "APPLICATIONINSIGHTS_REDACTION_POLICY"
+
+// Replacement used by RedactReplace when a rule specifies none
+const defaultRedactionReplacement = "[REDACTED]"
+
+// RedactionStrategy determines how a redacted value is replaced.
+type RedactionStrategy string
+
+const (
+	// RedactReplace replaces the value with the rule's replacement, or
+	// "[REDACTED]" if it has none.  This is the default.
+	RedactReplace RedactionStrategy = "replace"
+
+	// RedactRemove removes the property, or the matched text.
+	RedactRemove RedactionStrategy = "remove"
+
+	// RedactHash replaces the value with a hash of it, so that equal values
+	// can still be correlated without being disclosed.
+	RedactHash RedactionStrategy = "hash"
+
+	// RedactMask replaces all but the last four characters of the value
+	// with asterisks.
+	RedactMask RedactionStrategy = "mask"
+)
+
+// RedactionRule describes values to redact and how.  A rule with
+// Properties redacts the whole value of the named properties; with a
+// Pattern, it redacts the matches in property values and in free text:
+// trace and exception messages and dependency data.  A rule with both
+// redacts the matches within the named properties only.
+type RedactionRule struct {
+	// Names of the properties to redact, matched case-insensitively
+	Properties []string `json:"properties,omitempty"`
+
+	// Regular expression matching the text to redact
+	Pattern string `json:"pattern,omitempty"`
+
+	// How redacted values are replaced.  Defaults to RedactReplace.
+	Strategy RedactionStrategy `json:"strategy,omitempty"`
+
+	// Replacement used by RedactReplace
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// compiledRedactionRule is a RedactionRule ready to be applied
+type compiledRedactionRule struct {
+	RedactionRule
+	properties map[string]bool
+	pattern    *regexp.Regexp
+}
+
+// RedactionPolicy is a set of redaction rules applied to telemetry before
+// it is sent, so that privacy requirements can be defined declaratively
+// and tightened per environment without changing code.  Policies are
+// written as JSON:
+//
+//	{
+//	  "rules": [
+//	    {"properties": ["email", "userName"], "strategy": "hash"},
+//	    {"pattern": "\\b\\d{3}-\\d{2}-\\d{4}\\b", "replacement": "[SSN]"}
+//	  ]
+//	}
+type RedactionPolicy struct {
+	rules []compiledRedactionRule
+}
+
+// ParseRedactionPolicy parses and compiles a JSON redaction policy.
+func ParseRedactionPolicy(data []byte) (*RedactionPolicy, error) {
+	var document struct {
+		Rules []RedactionRule `json:"rules"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid redaction policy: %w", err)
+	}
+
+	return NewRedactionPolicy(document.Rules...)
+}
+
+// NewRedactionPolicy compiles a redaction policy from rules.
+func NewRedactionPolicy(rules ...RedactionRule) (*RedactionPolicy, error) {
+	policy := &RedactionPolicy{}
+	for i, rule := range rules {
+		compiled := compiledRedactionRule{RedactionRule: rule}
+		if len(rule.Properties) == 0 && rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %d: properties or pattern is required", i)
+		}
+
+		switch rule.Strategy {
+		case "":
+			compiled.Strategy = RedactReplace
+		case RedactReplace, RedactRemove, RedactHash, RedactMask:
+		default:
+			return nil, fmt.Errorf("redaction rule %d: unknown strategy %q", i, rule.Strategy)
+		}
+
+		if len(rule.Properties) > 0 {
+			compiled.properties = make(map[string]bool, len(rule.Properties))
+			for _, name := range rule.Properties {
+				compiled.properties[strings.ToLower(name)] = true
+			}
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+			}
+			compiled.pattern = pattern
+		}
+
+		policy.rules = append(policy.rules, compiled)
+	}
+
+	return policy, nil
+}
+
+// RedactProperties redacts custom properties in place.
+func (policy *RedactionPolicy) RedactProperties(properties map[string]string) {
+	if policy == nil {
+		return
+	}
+
+	for _, rule := range policy.rules {
+		for name, value := range properties {
+			if rule.properties != nil && !rule.properties[strings.ToLower(name)] {
+				continue
+			}
+
+			if rule.pattern != nil {
+				properties[name] = rule.redactMatches(value)
+			} else if rule.Strategy == RedactRemove {
+				delete(properties, name)
+			} else {
+				properties[name] = rule.redact(value)
+			}
+		}
+	}
+}
+
+// RedactText redacts the matches of the policy's patterns in free text.
+// Rules restricted to named properties don't apply.
+func (policy *RedactionPolicy) RedactText(text string) string {
+	if policy == nil {
+		return text
+	}
+
+	for _, rule := range policy.rules {
+		if rule.pattern != nil && rule.properties == nil {
+			text = rule.redactMatches(text)
+		}
+	}
+
+	return text
+}
+
+// apply redacts a telemetry item
+func (policy *RedactionPolicy) apply(data interface{}) {
+	switch data := data.(type) {
+	case *contracts.EventData:
+		policy.RedactProperties(data.Properties)
+	case *contracts.PageViewData:
+		policy.RedactProperties(data.Properties)
+	case *contracts.MessageData:
+		data.Message = policy.RedactText(data.Message)
+		policy.RedactProperties(data.Properties)
+	case *contracts.RequestData:
+		policy.RedactProperties(data.Properties)
+	case *contracts.RemoteDependencyData:
+		data.Data = policy.RedactText(data.Data)
+		policy.RedactProperties(data.Properties)
+	case *contracts.AvailabilityData:
+		data.Message = policy.RedactText(data.Message)
+		policy.RedactProperties(data.Properties)
+	case *contracts.MetricData:
+		policy.RedactProperties(data.Properties)
+	case *contracts.ExceptionData:
+		for _, exception := range data.Exceptions {
+			exception.Message = policy.RedactText(exception.Message)
+		}
+		policy.RedactProperties(data.Properties)
+	}
+}
+
+// redactMatches redacts each match of the rule's pattern
+func (rule *compiledRedactionRule) redactMatches(value string) string {
+	return rule.pattern.ReplaceAllStringFunc(value, rule.redact)
+}
+
+// redact returns the replacement of a value
+func (rule *compiledRedactionRule) redact(value string) string {
+	switch rule.Strategy {
+	case RedactHash:
+		hash := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(hash[:8])
+	case RedactMask:
+		runes := []rune(value)
+		for i := 0; i < len(runes)-4; i++ {
+			runes[i] = '*'
+		}
+		return string(runes)
+	case RedactRemove:
+		return ""
+	default:
+		if rule.Replacement != "" {
+			return rule.Replacement
+		}
+		return defaultRedactionReplacement
+	}
+}
+
+// RedactionPolicyConfig configures where the redaction policy applied to
+// all telemetry is loaded from.  A policy file is checked for changes every
+// ReloadInterval, so that rules can be tightened without redeploying.  If
+// the file or variable can't be read or parsed, the previous policy is
+// kept and the error is reported through diagnostics.
+type RedactionPolicyConfig struct {
+	// Path of a JSON policy file.  Takes precedence over EnvVar.
+	Path string
+
+	// Environment variable holding a JSON policy, read once.  Defaults to
+	// RedactionPolicyEnvVar.
+	EnvVar string
+
+	// How often the policy file is checked for changes.  Defaults to 30
+	// seconds.
+	ReloadInterval time.Duration
+}
+
+// NewRedactionPolicyConfig creates a configuration that loads the policy
+// from the file at path, or from RedactionPolicyEnvVar if path is empty.
+func NewRedactionPolicyConfig(path string) *RedactionPolicyConfig {
+	return &RedactionPolicyConfig{
+		Path:           path,
+		EnvVar:         RedactionPolicyEnvVar,
+		ReloadInterval: 30 * time.Second,
+	}
+}
+
+// redactionStage applies the current redaction policy and reloads it when
+// its file changes
+type redactionStage struct {
+	config RedactionPolicyConfig
+	policy atomic.Pointer[RedactionPolicy]
+
+	// Identifies the version of the file last loaded
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newRedactionStage(config *RedactionPolicyConfig) *redactionStage {
+	if config == nil {
+		return nil
+	}
+
+	defaults := NewRedactionPolicyConfig("")
+	stage := &redactionStage{config: *config}
+	if stage.config.EnvVar == "" {
+		stage.config.EnvVar = defaults.EnvVar
+	}
+	if stage.config.ReloadInterval <= 0 {
+		stage.config.ReloadInterval = defaults.ReloadInterval
+	}
+
+	if stage.config.Path == "" {
+		if value := os.Getenv(stage.config.EnvVar); value != "" {
+			stage.load([]byte(value), stage.config.EnvVar)
+		}
+		return stage
+	}
+
+	stage.reload()
+	stage.stop = make(chan struct{})
+	stage.done = make(chan struct{})
+	go stage.watch()
+	return stage
+}
+
+// apply redacts a telemetry item with the current policy
+func (stage *redactionStage) apply(data interface{}) {
+	if stage == nil {
+		return
+	}
+
+	stage.policy.Load().apply(data)
+}
+
+// watch reloads the policy file every ReloadInterval until stopped
+func (stage *redactionStage) watch() {
+	defer close(stage.done)
+
+	ticker := time.NewTicker(stage.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			stage.reload()
+		case <-stage.stop:
+			return
+		}
+	}
+}
+
+// reload loads the policy file if it changed since it was last loaded
+func (stage *redactionStage) reload() {
+	info, err := os.Stat(stage.config.Path)
+	if err != nil {
+		diagnosticsWriter.Printf("Failed to read redaction policy: %s", err)
+		return
+	}
+
+	if info.ModTime().Equal(stage.modTime) && info.Size() == stage.size {
+		return
+	}
+
+	data, err := os.ReadFile(stage.config.Path)
+	if err != nil {
+		diagnosticsWriter.Printf("Failed to read redaction policy: %s", err)
+		return
+	}
+
+	// A file that fails to parse isn't retried until it changes again
+	stage.modTime = info.ModTime()
+	stage.size = info.Size()
+	stage.load(data, stage.config.Path)
+}
+
+// load parses and installs a policy, keeping the current one on error
+func (stage *redactionStage) load(data []byte, source string) {
+	policy, err := ParseRedactionPolicy(data)
+	if err != nil {
+		diagnosticsWriter.Printf("Keeping the current redaction policy; failed to load %s: %s", source, err)
+		return
+	}
+
+	stage.policy.Store(policy)
+	diagnosticsWriter.Printf("Loaded redaction policy with %d rules from %s", len(policy.rules), source)
+}
+
+// Stop stops watching the policy file.  Safe to call more than once.
+func (stage *redactionStage) Stop() {
+	if stage == nil || stage.stop == nil {
+		return
+	}
+
+	stage.stopOnce.Do(func() {
+		close(stage.stop)
+		<-stage.done
+	})
+}
@@ -0,0 +1,152 @@
+package appinsights
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestRedactionPolicy(t *testing.T) {
+	policy, err := ParseRedactionPolicy([]byte(`{
+		"rules": [
+			{"properties": ["Email"], "strategy": "hash"},
+			{"properties": ["password"], "strategy": "remove"},
+			{"properties": ["card"], "strategy": "mask"},
+			{"pattern": "\\b\\d{3}-\\d{2}-\\d{4}\\b", "replacement": "[SSN]"},
+			{"properties": ["note"], "pattern": "secret-\\w+"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	properties := map[string]string{
+		"email":    "someone@example.com",
+		"password": "hunter2",
+		"card":     "4111111111111111",
+		"customer": "SSN 123-45-6789 on file",
+		"note":     "uses secret-abc",
+		"other":    "secret-def",
+	}
+	policy.RedactProperties(properties)
+
+	if hashed := properties["email"]; !strings.HasPrefix(hashed, "sha256:") || strings.Contains(hashed, "example") {
+		t.Errorf("Expected hashed email, got %q", hashed)
+	}
+	if _, ok := properties["password"]; ok {
+		t.Error("Expected password to be removed")
+	}
+	if properties["card"] != "************1111" {
+		t.Errorf("Expected masked card, got %q", properties["card"])
+	}
+	if properties["customer"] != "SSN [SSN] on file" {
+		t.Errorf("Expected pattern to be redacted, got %q", properties["customer"])
+	}
+	if properties["note"] != "uses [REDACTED]" || properties["other"] != "secret-def" {
+		t.Errorf("Expected property-restricted pattern, got %q and %q", properties["note"], properties["other"])
+	}
+
+	if text := policy.RedactText("SSN 123-45-6789, secret-abc"); text != "SSN [SSN], secret-abc" {
+		t.Errorf("Unexpected redacted text %q", text)
+	}
+
+	// Equal values hash alike, so they can still be correlated
+	again := map[string]string{"EMAIL": "someone@example.com"}
+	policy.RedactProperties(again)
+	if again["EMAIL"] != properties["email"] {
+		t.Error("Expected equal values to have equal hashes")
+	}
+}
+
+func TestRedactionPolicyErrors(t *testing.T) {
+	invalid := []string{
+		`{"rules": [{"strategy": "hash"}]}`,
+		`{"rules": [{"properties": ["a"], "strategy": "encrypt"}]}`,
+		`{"rules": [{"pattern": "("}]}`,
+		`{"rulez": []}`,
+		`not json`,
+	}
+
+	for _, policy := range invalid {
+		if _, err := ParseRedactionPolicy([]byte(policy)); err == nil {
+			t.Errorf("Expected error for %s", policy)
+		}
+	}
+}
+
+func TestRedactionPolicyFromEnvironment(t *testing.T) {
+	t.Setenv(RedactionPolicyEnvVar, `{"rules": [{"pattern": "\\d{4}-\\d{4}"}]}`)
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.RedactionPolicy = NewRedactionPolicyConfig("")
+	client, testChannel := newTestClient(config)
+
+	client.TrackTrace("card 1234-5678 declined", Warning)
+	exception := NewExceptionTelemetry("card 1234-5678 expired")
+	client.Track(exception)
+
+	message := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.MessageData)
+	if message.Message != "card [REDACTED] declined" {
+		t.Errorf("Expected trace message to be redacted, got %q", message.Message)
+	}
+	exceptionData := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.ExceptionData)
+	if exceptionData.Exceptions[0].Message != "card [REDACTED] expired" {
+		t.Errorf("Expected exception message to be redacted, got %q", exceptionData.Exceptions[0].Message)
+	}
+}
+
+func TestRedactionPolicyReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [{"properties": ["user"]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stage := newRedactionStage(&RedactionPolicyConfig{Path: path, ReloadInterval: 5 * time.Millisecond})
+	defer stage.Stop()
+
+	redact := func() map[string]string {
+		event := NewEventTelemetry("login")
+		event.Properties["user"] = "alice"
+		event.Properties["ip"] = "10.0.0.1"
+		data := event.TelemetryData()
+		stage.apply(data)
+		return data.(*contracts.EventData).Properties
+	}
+
+	if properties := redact(); properties["user"] != "[REDACTED]" || properties["ip"] != "10.0.0.1" {
+		t.Fatalf("Unexpected initial redaction %v", properties)
+	}
+
+	// Tightened policy is picked up without restarting
+	tightened := []byte(`{"rules": [{"properties": ["user", "ip"], "strategy": "remove"}]}`)
+	if err := os.WriteFile(path, tightened, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if properties := redact(); len(properties) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if properties := redact(); len(properties) != 0 {
+		t.Fatalf("Expected reloaded policy to remove both properties, got %v", properties)
+	}
+
+	// An invalid file keeps the current policy
+	if err := os.WriteFile(path, []byte(`{"rules": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if properties := redact(); len(properties) != 0 {
+		t.Errorf("Expected the previous policy to be kept, got %v", properties)
+	}
+
+	stage.Stop()
+	stage.Stop()
+}
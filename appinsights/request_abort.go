@@ -0,0 +1,25 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ClientClosedRequestCode is the response code recorded for requests whose
+// client disconnected before the handler completed, following the nginx
+// convention.  The status written by the handler, if any, never reached the
+// client.
+const ClientClosedRequestCode = 499
+
+// RequestCanceledProperty is set to "true" on request telemetry for requests
+// aborted by the client.
+const RequestCanceledProperty = "canceled"
+
+// requestAborted returns whether the client went away while the request was
+// being handled.  The server cancels the request context when the
+// connection closes; deadlines set by handlers or timeout middleware aren't
+// client aborts.
+func requestAborted(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
@@ -0,0 +1,94 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestMiddlewareClientAbort(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	middleware := NewHTTPMiddleware()
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+	middleware.TrackServerErrors = true
+
+	// The handler writes an error after the client has gone away
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil).WithContext(ctx))
+
+	// Deadlines aren't client aborts
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil).WithContext(ctx))
+
+	// Only the second request's server error is tracked as an exception
+	if testChannel.getSentCount() != 3 {
+		t.Fatalf("Expected 3 items, got %d", testChannel.getSentCount())
+	}
+
+	aborted := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if aborted.ResponseCode != "499" {
+		t.Errorf("Expected response code 499, got %s", aborted.ResponseCode)
+	}
+	if aborted.Properties[RequestCanceledProperty] != "true" {
+		t.Errorf("Expected the canceled property, got %v", aborted.Properties)
+	}
+
+	timedOut := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if timedOut.ResponseCode != "500" {
+		t.Errorf("Expected response code 500, got %s", timedOut.ResponseCode)
+	}
+	if _, ok := timedOut.Properties[RequestCanceledProperty]; ok {
+		t.Error("Expected no canceled property for a deadline")
+	}
+}
+
+func TestClientAbortOverHTTP(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	tracked := make(chan struct{})
+	middleware := NewHTTPMiddleware()
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(tracked)
+		middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+		})).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/slow", nil)
+	go func() {
+		<-started
+		cancel()
+	}()
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	select {
+	case <-tracked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request wasn't tracked")
+	}
+
+	request := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.ResponseCode != "499" || request.Properties[RequestCanceledProperty] != "true" {
+		t.Errorf("Expected an aborted request, got %s %v", request.ResponseCode, request.Properties)
+	}
+}
@@ -0,0 +1,181 @@
+package appinsights
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryStormProperty is set to "true" on failed dependencies tracked while
+// their target is in a retry storm.
+const RetryStormProperty = "retryStorm"
+
+// RetryStormEventName is the name of the event tracked once when a retry
+// storm is detected.
+const RetryStormEventName = "RetryStorm"
+
+// Properties and measurements of retry storm events
+const (
+	// RetryStormTargetProperty holds the target of the failing dependency
+	RetryStormTargetProperty = "retryStorm.target"
+
+	// RetryStormTypeProperty holds the type of the failing dependency
+	RetryStormTypeProperty = "retryStorm.type"
+
+	// RetryStormFailuresMeasurement holds the number of failures within
+	// the window that triggered detection
+	RetryStormFailuresMeasurement = "retryStorm.failures"
+
+	// RetryStormWindowMeasurement holds the window, in milliseconds
+	RetryStormWindowMeasurement = "retryStorm.windowMs"
+)
+
+// RetryStormConfig configures the detection of retry storms: a dependency
+// target failing repeatedly within a short window, typical of callers
+// retrying against an unhealthy service and amplifying a cascading failure.
+// While a target is in a storm, its failed dependencies are tagged with
+// RetryStormProperty, and a single RetryStormEventName event is tracked
+// when the storm starts.  The storm ends once the target hasn't failed for
+// a whole window.
+type RetryStormConfig struct {
+	// Number of failures of the same target within Window that starts a
+	// storm.  Defaults to 10.
+	Failures int
+
+	// Window within which failures are counted.  Defaults to one minute.
+	Window time.Duration
+
+	// Maximum number of targets whose failures are counted at once.
+	// Defaults to 1000.
+	MaxTargets int
+}
+
+// NewRetryStormConfig creates a new configuration with default values.
+func NewRetryStormConfig() *RetryStormConfig {
+	return &RetryStormConfig{
+		Failures:   10,
+		Window:     time.Minute,
+		MaxTargets: 1000,
+	}
+}
+
+// targetFailures records the recent failures of a dependency target
+type targetFailures struct {
+	// Times of the failures within the window, oldest first
+	failures []time.Time
+	storming bool
+}
+
+// retryStormDetector enforces RetryStormConfig
+type retryStormDetector struct {
+	config RetryStormConfig
+
+	lock    sync.Mutex
+	targets map[string]*targetFailures
+}
+
+func newRetryStormDetector(config *RetryStormConfig) *retryStormDetector {
+	if config == nil {
+		return nil
+	}
+
+	defaults := NewRetryStormConfig()
+	resolved := *config
+	if resolved.Failures <= 0 {
+		resolved.Failures = defaults.Failures
+	}
+	if resolved.Window <= 0 {
+		resolved.Window = defaults.Window
+	}
+	if resolved.MaxTargets <= 0 {
+		resolved.MaxTargets = defaults.MaxTargets
+	}
+
+	return &retryStormDetector{
+		config:  resolved,
+		targets: make(map[string]*targetFailures),
+	}
+}
+
+// observe records a failed dependency, tagging it if its target is in a
+// storm.  Returns the event to track if the dependency starts a storm.
+func (detector *retryStormDetector) observe(item Telemetry) *EventTelemetry {
+	if detector == nil {
+		return nil
+	}
+
+	dependency, ok := item.(*RemoteDependencyTelemetry)
+	if !ok || dependency.Success {
+		return nil
+	}
+
+	target := dependency.Target
+	if target == "" {
+		target = dependency.Name
+	}
+	key := dependency.Type + "|" + target
+
+	now := currentClock.Now()
+	cutoff := now.Add(-detector.config.Window)
+
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+
+	state, ok := detector.targets[key]
+	if !ok {
+		if len(detector.targets) >= detector.config.MaxTargets {
+			detector.sweep(cutoff)
+			if len(detector.targets) >= detector.config.MaxTargets {
+				return nil
+			}
+		}
+
+		state = &targetFailures{}
+		detector.targets[key] = state
+	}
+
+	// A target that hasn't failed for a whole window is out of its storm
+	if n := len(state.failures); n > 0 && !state.failures[n-1].After(cutoff) {
+		state.storming = false
+	}
+
+	expired := 0
+	for expired < len(state.failures) && !state.failures[expired].After(cutoff) {
+		expired++
+	}
+	state.failures = append(state.failures[expired:], now)
+
+	// Only the failures needed for detection are remembered
+	if len(state.failures) > detector.config.Failures {
+		state.failures = state.failures[len(state.failures)-detector.config.Failures:]
+	}
+
+	if state.storming {
+		dependency.Properties[RetryStormProperty] = "true"
+		return nil
+	}
+
+	if len(state.failures) < detector.config.Failures {
+		return nil
+	}
+
+	state.storming = true
+	dependency.Properties[RetryStormProperty] = "true"
+	diagnosticsWriter.Printf("Retry storm: %d failures of %s dependency %s within %s", len(state.failures), dependency.Type, target, detector.config.Window)
+
+	event := NewEventTelemetry(RetryStormEventName)
+	event.Properties[RetryStormTargetProperty] = target
+	event.Properties[RetryStormTypeProperty] = dependency.Type
+	event.Measurements[RetryStormFailuresMeasurement] = float64(len(state.failures))
+	event.Measurements[RetryStormWindowMeasurement] = toMilliseconds(detector.config.Window)
+	return event
+}
+
+// sweep forgets targets without failures within the window.  Must be
+// called with the lock held.
+func (detector *retryStormDetector) sweep(cutoff time.Time) {
+	for key, state := range detector.targets {
+		if n := len(state.failures); n == 0 || !state.failures[n-1].After(cutoff) {
+			delete(detector.targets, key)
+		}
+	}
+}
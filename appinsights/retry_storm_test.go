@@ -0,0 +1,106 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestRetryStorm(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.RetryStorms = &RetryStormConfig{Failures: 3, Window: 10 * time.Second}
+	client, testChannel := newTestClient(config)
+
+	failure := func(target string) {
+		dependency := NewRemoteDependencyTelemetry("GET /orders", "HTTP", target, false)
+		client.TrackWithContext(context.Background(), dependency)
+	}
+	dependencyProperties := func(i int) map[string]string {
+		return testChannel.sentItems[i].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData).Properties
+	}
+
+	// Failures spread beyond the window don't start a storm
+	failure("orders")
+	fakeClock.Increment(11 * time.Second)
+	failure("orders")
+	failure("inventory")
+	client.TrackRemoteDependency("GET /orders", "HTTP", "orders", true)
+	if testChannel.getSentCount() != 4 {
+		t.Fatalf("Expected 4 dependencies, got %d items", testChannel.getSentCount())
+	}
+	for i := 0; i < 4; i++ {
+		if _, ok := dependencyProperties(i)[RetryStormProperty]; ok {
+			t.Errorf("Dependency %d: unexpected retry storm tag", i)
+		}
+	}
+
+	// The third failure within the window starts the storm
+	fakeClock.Increment(time.Second)
+	failure("orders")
+	failure("orders")
+	if testChannel.getSentCount() != 7 {
+		t.Fatalf("Expected the dependencies and the storm event, got %d items", testChannel.getSentCount())
+	}
+	if _, ok := dependencyProperties(4)[RetryStormProperty]; ok {
+		t.Error("Expected failures before the storm not to be tagged")
+	}
+	if dependencyProperties(5)[RetryStormProperty] != "true" {
+		t.Error("Expected the dependency starting the storm to be tagged")
+	}
+
+	event := testChannel.sentItems[6].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if event.Name != RetryStormEventName || event.Properties[RetryStormTargetProperty] != "orders" || event.Properties[RetryStormTypeProperty] != "HTTP" {
+		t.Errorf("Unexpected storm event %s: %v", event.Name, event.Properties)
+	}
+	if event.Measurements[RetryStormFailuresMeasurement] != 3 || event.Measurements[RetryStormWindowMeasurement] != 10000 {
+		t.Errorf("Unexpected storm measurements %v", event.Measurements)
+	}
+
+	// Further failures are tagged without another event
+	failure("orders")
+	if testChannel.getSentCount() != 8 || dependencyProperties(7)[RetryStormProperty] != "true" {
+		t.Fatal("Expected further failures to be tagged without another event")
+	}
+
+	// The storm ends once the target hasn't failed for a whole window
+	fakeClock.Increment(10 * time.Second)
+	failure("orders")
+	if testChannel.getSentCount() != 9 {
+		t.Fatalf("Expected no event after the storm, got %d items", testChannel.getSentCount())
+	}
+	if _, ok := dependencyProperties(8)[RetryStormProperty]; ok {
+		t.Error("Expected failures after the storm not to be tagged")
+	}
+}
+
+func TestRetryStormMaxTargets(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	detector := newRetryStormDetector(&RetryStormConfig{Failures: 2, MaxTargets: 1})
+	detector.observe(NewRemoteDependencyTelemetry("a", "SQL", "a", false))
+
+	// Untracked targets aren't detected while the limit is reached
+	for i := 0; i < 2; i++ {
+		if detector.observe(NewRemoteDependencyTelemetry("b", "SQL", "b", false)) != nil {
+			t.Error("Expected no storm for a target beyond the limit")
+		}
+	}
+
+	// Targets without failures within the window are forgotten
+	fakeClock.Increment(2 * time.Minute)
+	detector.observe(NewRemoteDependencyTelemetry("b", "SQL", "b", false))
+	if detector.observe(NewRemoteDependencyTelemetry("b", "SQL", "b", false)) == nil {
+		t.Error("Expected a storm once the other target expired")
+	}
+
+	var nilDetector *retryStormDetector
+	if nilDetector.observe(NewRemoteDependencyTelemetry("a", "SQL", "a", false)) != nil {
+		t.Error("Expected no detection when disabled")
+	}
+}
@@ -0,0 +1,91 @@
+package appinsights
+
+import (
+	"runtime/metrics"
+	"sync"
+)
+
+// Runtime metrics support matrix
+//
+// The package builds on go1.23 and later, the oldest version declared in
+// go.mod.  RuntimeMetricsCollector always reports the runtime.MemStats based
+// metrics, which every supported version provides.  Metrics read through
+// runtime/metrics are listed in the tables below along with the Go version
+// that introduced them:
+//
+//	go1.21  baseRuntimeMetrics (live heap, GOGC, memory limit, GOMAXPROCS,
+//	        mutex wait time, GC CPU time)
+//	go1.26  versionedRuntimeMetrics in runtime_metrics_go126.go (goroutine
+//	        states, goroutines created, OS threads)
+//
+// Tables for newer runtimes live in files carrying a matching build
+// constraint, with an empty fallback for older toolchains, so the package
+// never references metrics its compiler doesn't know about.  Metrics that the
+// running runtime doesn't report are skipped at collection time.
+
+// runtimeMetric maps a runtime/metrics name to the name it is tracked under
+type runtimeMetric struct {
+	// Name of the tracked metric
+	name string
+
+	// Name of the runtime/metrics sample
+	sample string
+
+	// Go version that introduced the sample
+	since string
+}
+
+// Metrics available on every supported Go version
+var baseRuntimeMetrics = []runtimeMetric{
+	{"runtime.gc.heap_live", "/gc/heap/live:bytes", "go1.21"},
+	{"runtime.gc.gogc_percent", "/gc/gogc:percent", "go1.21"},
+	{"runtime.memory.limit", "/gc/gomemlimit:bytes", "go1.21"},
+	{"runtime.sched.gomaxprocs", "/sched/gomaxprocs:threads", "go1.20"},
+	{"runtime.sync.mutex_wait_seconds", "/sync/mutex/wait/total:seconds", "go1.20"},
+	{"runtime.gc.cpu_seconds", "/cpu/classes/gc/total:cpu-seconds", "go1.20"},
+}
+
+// runtimeMetricSamples holds the samples read on every collection
+type runtimeMetricSamples struct {
+	once    sync.Once
+	names   []string
+	samples []metrics.Sample
+}
+
+// init selects the metrics supported by both the compiler and the running
+// runtime
+func (s *runtimeMetricSamples) init() {
+	s.once.Do(func() {
+		supported := make(map[string]bool)
+		for _, description := range metrics.All() {
+			supported[description.Name] = true
+		}
+
+		for _, table := range [][]runtimeMetric{baseRuntimeMetrics, versionedRuntimeMetrics} {
+			for _, metric := range table {
+				if supported[metric.sample] {
+					s.names = append(s.names, metric.name)
+					s.samples = append(s.samples, metrics.Sample{Name: metric.sample})
+				}
+			}
+		}
+	})
+}
+
+// collect reads the samples and tracks scalar values
+func (s *runtimeMetricSamples) collect(client TelemetryClient) {
+	s.init()
+	if len(s.samples) == 0 {
+		return
+	}
+
+	metrics.Read(s.samples)
+	for i, sample := range s.samples {
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			client.TrackMetric(s.names[i], float64(sample.Value.Uint64()))
+		case metrics.KindFloat64:
+			client.TrackMetric(s.names[i], sample.Value.Float64())
+		}
+	}
+}
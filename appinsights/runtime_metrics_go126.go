@@ -0,0 +1,13 @@
+//go:build go1.26
+
+package appinsights
+
+// Metrics introduced in go1.26
+var versionedRuntimeMetrics = []runtimeMetric{
+	{"runtime.goroutines.running", "/sched/goroutines/running:goroutines", "go1.26"},
+	{"runtime.goroutines.runnable", "/sched/goroutines/runnable:goroutines", "go1.26"},
+	{"runtime.goroutines.waiting", "/sched/goroutines/waiting:goroutines", "go1.26"},
+	{"runtime.goroutines.not_in_go", "/sched/goroutines/not-in-go:goroutines", "go1.26"},
+	{"runtime.goroutines.created", "/sched/goroutines-created:goroutines", "go1.26"},
+	{"runtime.threads", "/sched/threads/total:threads", "go1.26"},
+}
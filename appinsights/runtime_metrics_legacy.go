@@ -0,0 +1,6 @@
+//go:build !go1.26
+
+package appinsights
+
+// Runtimes older than go1.26 only report baseRuntimeMetrics
+var versionedRuntimeMetrics []runtimeMetric
@@ -0,0 +1,54 @@
+package appinsights
+
+import (
+	"go/version"
+	"runtime"
+	"testing"
+)
+
+func TestRuntimeMetricsSupportMatrix(t *testing.T) {
+	for _, table := range [][]runtimeMetric{baseRuntimeMetrics, versionedRuntimeMetrics} {
+		for _, metric := range table {
+			if !version.IsValid(metric.since) {
+				t.Errorf("%s: invalid version %q", metric.name, metric.since)
+			} else if version.Compare(metric.since, runtime.Version()) > 0 && version.IsValid(runtime.Version()) {
+				t.Errorf("%s: requires %s but was compiled with %s", metric.name, metric.since, runtime.Version())
+			}
+		}
+	}
+}
+
+func TestRuntimeMetricsCollectorSamples(t *testing.T) {
+	client := newMockTelemetryClientForPC()
+	collector := NewRuntimeMetricsCollector()
+	collector.Collect(client)
+
+	for _, table := range [][]runtimeMetric{baseRuntimeMetrics, versionedRuntimeMetrics} {
+		for _, metric := range table {
+			if _, exists := client.getMetric(metric.name); !exists {
+				t.Errorf("Expected metric '%s' was not collected", metric.name)
+			}
+		}
+	}
+
+	if gomaxprocs, _ := client.getMetric("runtime.sched.gomaxprocs"); gomaxprocs != float64(runtime.GOMAXPROCS(0)) {
+		t.Errorf("Expected GOMAXPROCS %d, got %f", runtime.GOMAXPROCS(0), gomaxprocs)
+	}
+}
+
+func TestRuntimeMetricsUnsupportedSkipped(t *testing.T) {
+	original := baseRuntimeMetrics
+	defer func() { baseRuntimeMetrics = original }()
+	baseRuntimeMetrics = append([]runtimeMetric{{"runtime.future", "/future/metric:units", "go1.99"}}, original...)
+
+	client := newMockTelemetryClientForPC()
+	var samples runtimeMetricSamples
+	samples.collect(client)
+
+	if _, exists := client.getMetric("runtime.future"); exists {
+		t.Error("Expected the unsupported metric to be skipped")
+	}
+	if _, exists := client.getMetric("runtime.gc.heap_live"); !exists {
+		t.Error("Expected supported metrics to be collected")
+	}
+}
@@ -1,6 +1,7 @@
 package appinsights
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/binary"
 	"sort"
@@ -72,11 +73,7 @@ func (p *FixedRateSamplingProcessor) ShouldSample(envelope *contracts.Envelope)
 		operationId = envelope.Name + envelope.IKey
 	}
 
-	// Calculate hash-based sampling decision
-	hash := calculateSamplingHash(operationId)
-	threshold := uint32((p.samplingRate / 100.0) * 0xFFFFFFFF)
-
-	return hash < threshold
+	return isSampledIn(operationId, p.samplingRate)
 }
 
 // GetSamplingRate returns the current sampling rate
@@ -211,11 +208,7 @@ func (p *PerTypeSamplingProcessor) ShouldSample(envelope *contracts.Envelope) bo
 		operationId = envelope.Name + envelope.IKey
 	}
 
-	// Calculate hash-based sampling decision
-	hash := calculateSamplingHash(operationId)
-	threshold := uint32((samplingRate / 100.0) * 0xFFFFFFFF)
-
-	return hash < threshold
+	return isSampledIn(operationId, samplingRate)
 }
 
 // GetSamplingRate returns the default sampling rate
@@ -501,11 +494,7 @@ func (p *AdaptiveSamplingProcessor) ShouldSample(envelope *contracts.Envelope) b
 		operationId = envelope.Name + envelope.IKey
 	}
 
-	// Calculate hash-based sampling decision
-	hash := calculateSamplingHash(operationId)
-	threshold := uint32((samplingRate / 100.0) * 0xFFFFFFFF)
-
-	return hash < threshold
+	return isSampledIn(operationId, samplingRate)
 }
 
 // evaluateAndAdjustRates adjusts sampling rates based on current volume
@@ -635,15 +624,42 @@ type SamplingRule interface {
 	GetPriority() int
 }
 
-// ErrorPrioritySamplingRule ensures errors and exceptions are always sampled
+// ErrorPrioritySamplingRule ensures errors and exceptions are always sampled.
+// Its exported fields select what counts as an error; they are initialized
+// by NewErrorPrioritySamplingRule and may be changed before the rule is added
+// to an engine.
 type ErrorPrioritySamplingRule struct {
 	priority int
+
+	// Leading digits of the request and dependency result codes that count
+	// as errors, such as '4' and '5' for the 4xx and 5xx classes
+	ResponseCodeClasses []byte
+
+	// Severities of the traces that are prioritized
+	TraceSeverities []contracts.SeverityLevel
+
+	// Types of the failed dependencies that are prioritized, matched
+	// case-insensitively.  Failed dependencies of any type are prioritized
+	// if empty.
+	DependencyTypes []string
+
+	// Successful requests taking longer than this are prioritized too.
+	// Disabled if zero.
+	SlowRequestThreshold time.Duration
+
+	// Sampling rate (0-100] applied to errors.  Lower it to thin out error
+	// storms; values outside the range sample every error.
+	SamplingRate float64
 }
 
-// NewErrorPrioritySamplingRule creates a rule that always samples errors and exceptions
+// NewErrorPrioritySamplingRule creates a rule that always samples exceptions,
+// 4xx and 5xx requests, failed dependencies, and error and critical traces.
 func NewErrorPrioritySamplingRule() *ErrorPrioritySamplingRule {
 	return &ErrorPrioritySamplingRule{
-		priority: 1000, // High priority to ensure errors are always sampled
+		priority:            1000, // High priority to ensure errors are always sampled
+		ResponseCodeClasses: []byte{'4', '5'},
+		TraceSeverities:     []contracts.SeverityLevel{contracts.Error, contracts.Critical},
+		SamplingRate:        100.0,
 	}
 }
 
@@ -659,69 +675,76 @@ func (r *ErrorPrioritySamplingRule) ShouldApply(envelope *contracts.Envelope) bo
 		return true
 	}
 
-	// Check for failed requests (HTTP errors)
-	if telType == TelemetryTypeRequest {
-		// Access the request data to check success status
-		if envelope.Data != nil {
-			if data, ok := envelope.Data.(*contracts.Data); ok && data.BaseData != nil {
-				if requestData, ok := data.BaseData.(*contracts.RequestData); ok {
-					// Consider 4xx and 5xx status codes as errors
-					if requestData.ResponseCode != "" {
-						if len(requestData.ResponseCode) > 0 {
-							firstChar := requestData.ResponseCode[0]
-							if firstChar == '4' || firstChar == '5' {
-								return true
-							}
-						}
-					}
-				}
-			}
-		}
+	data, ok := envelope.Data.(*contracts.Data)
+	if !ok || data.BaseData == nil {
+		return false
 	}
 
-	// Check for failed dependencies
-	if telType == TelemetryTypeRemoteDependency {
-		if envelope.Data != nil {
-			if data, ok := envelope.Data.(*contracts.Data); ok && data.BaseData != nil {
-				if depData, ok := data.BaseData.(*contracts.RemoteDependencyData); ok {
-					// Check success flag
-					if !depData.Success {
-						return true
-					}
-					// Check result code for errors
-					if depData.ResultCode != "" {
-						if len(depData.ResultCode) > 0 {
-							firstChar := depData.ResultCode[0]
-							if firstChar == '4' || firstChar == '5' {
-								return true
-							}
-						}
-					}
-				}
+	switch baseData := data.BaseData.(type) {
+	case *contracts.RequestData:
+		if telType != TelemetryTypeRequest {
+			return false
+		}
+
+		// Check for failed requests (HTTP errors)
+		if r.isErrorCode(baseData.ResponseCode) {
+			return true
+		}
+
+		return r.SlowRequestThreshold > 0 && parseFormattedDuration(baseData.Duration) > r.SlowRequestThreshold
+
+	case *contracts.RemoteDependencyData:
+		if telType != TelemetryTypeRemoteDependency || !r.isPrioritizedDependencyType(baseData.Type) {
+			return false
+		}
+
+		// Check success flag and result code for errors
+		return !baseData.Success || r.isErrorCode(baseData.ResultCode)
+
+	case *contracts.MessageData:
+		if telType != TelemetryTypeTrace {
+			return false
+		}
+
+		for _, severity := range r.TraceSeverities {
+			if baseData.SeverityLevel == severity {
+				return true
 			}
 		}
 	}
 
-	// Check for error-level traces
-	if telType == TelemetryTypeTrace {
-		if envelope.Data != nil {
-			if data, ok := envelope.Data.(*contracts.Data); ok && data.BaseData != nil {
-				if traceData, ok := data.BaseData.(*contracts.MessageData); ok {
-					// Sample error and critical level traces
-					if traceData.SeverityLevel == contracts.Error || traceData.SeverityLevel == contracts.Critical {
-						return true
-					}
-				}
-			}
+	return false
+}
+
+// isErrorCode returns whether a result code belongs to an error class
+func (r *ErrorPrioritySamplingRule) isErrorCode(code string) bool {
+	return code != "" && bytes.IndexByte(r.ResponseCodeClasses, code[0]) >= 0
+}
+
+// isPrioritizedDependencyType returns whether failures of a dependency type
+// are prioritized
+func (r *ErrorPrioritySamplingRule) isPrioritizedDependencyType(dependencyType string) bool {
+	if len(r.DependencyTypes) == 0 {
+		return true
+	}
+
+	for _, t := range r.DependencyTypes {
+		if strings.EqualFold(t, dependencyType) {
+			return true
 		}
 	}
 
 	return false
 }
 
-// GetSamplingRate returns 100% for error priority rule (always sample errors)
+// GetSamplingRate returns the sampling rate applied to errors, 100% unless
+// configured otherwise
 func (r *ErrorPrioritySamplingRule) GetSamplingRate() float64 {
-	return 100.0
+	if r.SamplingRate <= 0 || r.SamplingRate > 100 {
+		return 100.0
+	}
+
+	return r.SamplingRate
 }
 
 // GetPriority returns the priority of this rule
@@ -879,18 +902,23 @@ func (e *CustomRuleEngine) RemoveRule(name string) {
 
 // GetSamplingRate determines the sampling rate for the given envelope
 func (e *CustomRuleEngine) GetSamplingRate(envelope *contracts.Envelope) float64 {
+	return e.matchRule(envelope).GetSamplingRate()
+}
+
+// matchRule returns the rule deciding the sampling rate for the envelope
+func (e *CustomRuleEngine) matchRule(envelope *contracts.Envelope) SamplingRule {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 
 	// Check rules in priority order
 	for _, rule := range e.rules {
 		if rule.ShouldApply(envelope) {
-			return rule.GetSamplingRate()
+			return rule
 		}
 	}
 
 	// Use default rule if no other rule applies
-	return e.defaultRule.GetSamplingRate()
+	return e.defaultRule
 }
 
 // IntelligentSamplingProcessor combines dependency-aware sampling with custom rules and error priority
@@ -0,0 +1,141 @@
+package appinsights
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// SamplingDecision describes why a telemetry item was kept or dropped by
+// sampling.
+type SamplingDecision struct {
+	// Envelope name of the item
+	EnvelopeName string
+
+	// Operation ID the decision was derived from, if any
+	OperationID string
+
+	// Whether the item was kept
+	Kept bool
+
+	// Type of the sampling processor that decided
+	Processor string
+
+	// Rule or per-type setting that chose the rate, if the processor
+	// distinguishes between them
+	Rule string
+
+	// Sampling rate applied, in percent
+	Rate float64
+}
+
+// String formats the decision for diagnostics output.
+func (decision SamplingDecision) String() string {
+	outcome := "dropped"
+	if decision.Kept {
+		outcome = "kept"
+	}
+
+	result := fmt.Sprintf("Sampling %s %s (operation %q) by %s", outcome, decision.EnvelopeName, decision.OperationID, decision.Processor)
+	if decision.Rule != "" {
+		result += fmt.Sprintf(" rule %q", decision.Rule)
+	}
+
+	return result + fmt.Sprintf(" at %g%%", decision.Rate)
+}
+
+// SamplingAuditProcessor wraps a sampling processor to record why each
+// item was kept or dropped, as a debugging aid for custom and intelligent
+// rule engines.  Decisions are written to the diagnostics output, and the
+// envelopes themselves are left unchanged.  Auditing every item is costly;
+// enable it temporarily while investigating.
+type SamplingAuditProcessor struct {
+	processor SamplingProcessor
+
+	// Only audit dropped items
+	OnlyDropped bool
+
+	// Optionally receives each decision in addition to the diagnostics
+	// output
+	OnDecision func(SamplingDecision)
+}
+
+// NewSamplingAuditProcessor wraps processor to audit its decisions.
+func NewSamplingAuditProcessor(processor SamplingProcessor) *SamplingAuditProcessor {
+	return &SamplingAuditProcessor{processor: processor}
+}
+
+// ShouldSample asks the wrapped processor and audits its decision.
+func (p *SamplingAuditProcessor) ShouldSample(envelope *contracts.Envelope) bool {
+	kept := p.processor.ShouldSample(envelope)
+	if envelope == nil || (kept && p.OnlyDropped) {
+		return kept
+	}
+
+	if p.OnDecision == nil && !diagnosticsWriter.hasListeners() {
+		return kept
+	}
+
+	decision := SamplingDecision{
+		EnvelopeName: envelope.Name,
+		OperationID:  envelope.Tags[contracts.OperationId],
+		Kept:         kept,
+		Processor:    strings.TrimPrefix(fmt.Sprintf("%T", p.processor), "*appinsights."),
+		Rule:         samplingDecisionRule(p.processor, envelope),
+		Rate:         p.processor.GetSamplingRate(),
+	}
+
+	// The rate actually applied is recorded on the envelope
+	if envelope.SampleRate > 0 {
+		decision.Rate = 100.0 / envelope.SampleRate
+	} else if !kept {
+		decision.Rate = 0
+	}
+
+	diagnosticsWriter.Printf("%s", decision)
+	if p.OnDecision != nil {
+		p.OnDecision(decision)
+	}
+
+	return kept
+}
+
+// GetSamplingRate returns the wrapped processor's sampling rate.
+func (p *SamplingAuditProcessor) GetSamplingRate() float64 {
+	return p.processor.GetSamplingRate()
+}
+
+// samplingDecisionRule names the rule or setting that chose the rate for an
+// envelope, for processors that have them
+func samplingDecisionRule(processor SamplingProcessor, envelope *contracts.Envelope) string {
+	switch processor := processor.(type) {
+	case *IntelligentSamplingProcessor:
+		return samplingRuleName(processor.GetRuleEngine().matchRule(envelope))
+	case *PerTypeSamplingProcessor:
+		telType := extractTelemetryTypeFromName(envelope.Name)
+		if _, ok := processor.typeRates[telType]; ok {
+			return "type:" + string(telType)
+		}
+		return "default"
+	case *AdaptiveSamplingProcessor:
+		if telType := extractTelemetryTypeFromName(envelope.Name); telType != "" {
+			return "adaptive:" + string(telType)
+		}
+		return "adaptive"
+	}
+
+	return ""
+}
+
+// samplingRuleName returns a name identifying a sampling rule
+func samplingRuleName(rule SamplingRule) string {
+	switch rule := rule.(type) {
+	case interface{ Name() string }:
+		return rule.Name()
+	case *ErrorPrioritySamplingRule:
+		return "error-priority"
+	default:
+		return strings.TrimPrefix(fmt.Sprintf("%T", rule), "*")
+	}
+}
@@ -0,0 +1,83 @@
+package appinsights
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestSamplingAuditIntelligentRules(t *testing.T) {
+	inner := NewIntelligentSamplingProcessor(0)
+	inner.AddRule(NewCustomSamplingRule("keep-events", 50, 100, func(envelope *contracts.Envelope) bool {
+		return strings.HasSuffix(envelope.Name, ".Event")
+	}))
+
+	var decisions []SamplingDecision
+	audit := NewSamplingAuditProcessor(inner)
+	audit.OnDecision = func(decision SamplingDecision) { decisions = append(decisions, decision) }
+
+	context := NewTelemetryContext(test_ikey)
+	event := context.envelop(NewEventTelemetry("checkout"))
+	trace := context.envelop(NewTraceTelemetry("noise", Information))
+	exception := context.envelop(NewExceptionTelemetry("boom"))
+
+	if !audit.ShouldSample(event) || audit.ShouldSample(trace) || !audit.ShouldSample(exception) {
+		t.Fatal("Unexpected sampling decisions")
+	}
+
+	expected := []struct {
+		kept bool
+		rule string
+		rate float64
+	}{
+		{true, "keep-events", 100},
+		{false, "default", 0},
+		{true, "error-priority", 100},
+	}
+
+	if len(decisions) != len(expected) {
+		t.Fatalf("Expected %d decisions, got %d", len(expected), len(decisions))
+	}
+	for i, e := range expected {
+		d := decisions[i]
+		if d.Kept != e.kept || d.Rule != e.rule || d.Rate != e.rate || d.Processor != "IntelligentSamplingProcessor" {
+			t.Errorf("Decision %d: expected %+v, got %+v", i, e, d)
+		}
+		if d.OperationID == "" {
+			t.Errorf("Decision %d: expected an operation ID", i)
+		}
+	}
+}
+
+func TestSamplingAuditDiagnostics(t *testing.T) {
+	var lock sync.Mutex
+	var messages []string
+	listener := NewDiagnosticsMessageListener(func(message string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		if strings.HasPrefix(message, "Sampling ") {
+			messages = append(messages, message)
+		}
+		return nil
+	})
+	defer listener.Remove()
+
+	audit := NewSamplingAuditProcessor(NewPerTypeSamplingProcessor(100, map[TelemetryType]float64{TelemetryTypeTrace: 0}))
+	audit.OnlyDropped = true
+
+	context := NewTelemetryContext(test_ikey)
+	audit.ShouldSample(context.envelop(NewEventTelemetry("kept")))
+	audit.ShouldSample(context.envelop(NewTraceTelemetry("dropped", Information)))
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one audit message, got %v", messages)
+	}
+	if !strings.Contains(messages[0], "dropped") || !strings.Contains(messages[0], `rule "type:Message"`) ||
+		!strings.Contains(messages[0], "PerTypeSamplingProcessor") {
+		t.Errorf("Unexpected audit message: %s", messages[0])
+	}
+}
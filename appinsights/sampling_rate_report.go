@@ -0,0 +1,115 @@
+package appinsights
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// SamplingRateMetricName is the name of the metric reporting the effective
+// sampling percentage of each telemetry type: the percentage of the items
+// tracked during the reporting interval that were kept by sampling.
+const SamplingRateMetricName = "ApplicationInsights.SamplingRate"
+
+// Properties of the sampling rate metric
+const (
+	// SamplingTelemetryTypeProperty holds the telemetry type, e.g. "Request"
+	SamplingTelemetryTypeProperty = "telemetryType"
+
+	// SamplingItemsTrackedProperty holds the number of items tracked
+	SamplingItemsTrackedProperty = "itemsTracked"
+
+	// SamplingItemsKeptProperty holds the number of items kept
+	SamplingItemsKeptProperty = "itemsKept"
+)
+
+type samplingRateCounts struct {
+	tracked int
+	kept    int
+}
+
+// samplingRateReporter counts sampling decisions per telemetry type and
+// reports the effective rates once per interval.  Reports are produced
+// while tracking, so no goroutine is needed; they are sent directly to the
+// channel so that sampling doesn't drop them.
+type samplingRateReporter struct {
+	interval time.Duration
+	context  *TelemetryContext
+
+	lock        sync.Mutex
+	windowStart time.Time
+	counts      map[TelemetryType]*samplingRateCounts
+}
+
+func newSamplingRateReporter(config *TelemetryConfiguration) *samplingRateReporter {
+	if config.SamplingRateReportInterval <= 0 {
+		return nil
+	}
+
+	return &samplingRateReporter{
+		interval:    config.SamplingRateReportInterval,
+		context:     NewTelemetryContext(config.InstrumentationKey),
+		windowStart: currentClock.Now(),
+		counts:      make(map[TelemetryType]*samplingRateCounts),
+	}
+}
+
+// observe records a sampling decision, and returns the reports due at the
+// end of an interval
+func (reporter *samplingRateReporter) observe(envelope *contracts.Envelope, kept bool) []*contracts.Envelope {
+	if reporter == nil {
+		return nil
+	}
+
+	telType := extractTelemetryTypeFromName(envelope.Name)
+
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	counts, ok := reporter.counts[telType]
+	if !ok {
+		counts = &samplingRateCounts{}
+		reporter.counts[telType] = counts
+	}
+
+	counts.tracked++
+	if kept {
+		counts.kept++
+	}
+
+	now := currentClock.Now()
+	if now.Sub(reporter.windowStart) < reporter.interval {
+		return nil
+	}
+
+	reports := reporter.report()
+	reporter.windowStart = now
+	reporter.counts = make(map[TelemetryType]*samplingRateCounts)
+	return reports
+}
+
+// report creates the metrics of the current interval, ordered by type
+func (reporter *samplingRateReporter) report() []*contracts.Envelope {
+	types := make([]string, 0, len(reporter.counts))
+	for telType := range reporter.counts {
+		types = append(types, string(telType))
+	}
+	sort.Strings(types)
+
+	reports := make([]*contracts.Envelope, 0, len(types))
+	for _, telType := range types {
+		counts := reporter.counts[TelemetryType(telType)]
+
+		metric := NewMetricTelemetry(SamplingRateMetricName, 100*float64(counts.kept)/float64(counts.tracked))
+		metric.Unit = "%"
+		metric.Properties[SamplingTelemetryTypeProperty] = telType
+		metric.Properties[SamplingItemsTrackedProperty] = strconv.Itoa(counts.tracked)
+		metric.Properties[SamplingItemsKeptProperty] = strconv.Itoa(counts.kept)
+		reports = append(reports, reporter.context.envelop(metric))
+	}
+
+	return reports
+}
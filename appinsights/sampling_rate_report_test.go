@@ -0,0 +1,51 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestSamplingRateReport(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SamplingProcessor = NewPerTypeSamplingProcessor(100, map[TelemetryType]float64{TelemetryTypeEvent: 0})
+	config.SamplingRateReportInterval = time.Minute
+	client, testChannel := newTestClient(config)
+
+	for i := 0; i < 4; i++ {
+		client.TrackEvent("dropped")
+		client.TrackTrace("kept", Information)
+	}
+	if testChannel.getSentCount() != 4 {
+		t.Fatalf("Expected only the traces before the interval ends, got %d items", testChannel.getSentCount())
+	}
+
+	fakeClock.Increment(time.Minute)
+	client.TrackTrace("kept", Information)
+
+	var reports []*contracts.MetricData
+	for _, envelope := range testChannel.sentItems {
+		if metric, ok := envelope.Data.(*contracts.Data).BaseData.(*contracts.MetricData); ok && metric.Metrics[0].Name == SamplingRateMetricName {
+			reports = append(reports, metric)
+		}
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("Expected a report per telemetry type, got %d", len(reports))
+	}
+
+	event, trace := reports[0], reports[1]
+	if event.Properties[SamplingTelemetryTypeProperty] != "Event" || event.Metrics[0].Value != 0 || event.Properties[SamplingItemsTrackedProperty] != "4" {
+		t.Errorf("Unexpected event report: %v %v", event.Metrics[0].Value, event.Properties)
+	}
+	if trace.Properties[SamplingTelemetryTypeProperty] != "Message" || trace.Metrics[0].Value != 100 || trace.Properties[SamplingItemsKeptProperty] != "5" {
+		t.Errorf("Unexpected trace report: %v %v", trace.Metrics[0].Value, trace.Properties)
+	}
+	if trace.Properties[MetricUnitProperty] != "%" {
+		t.Errorf("Expected a percentage unit, got %q", trace.Properties[MetricUnitProperty])
+	}
+}
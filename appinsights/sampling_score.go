@@ -0,0 +1,88 @@
+package appinsights
+
+import (
+	"math"
+	"sync/atomic"
+	"unicode/utf16"
+)
+
+var samplingCompatibilityMode atomic.Bool
+
+// SetSamplingCompatibilityMode switches the built-in sampling processors
+// between this SDK's own hash and the sampling score used by the .NET, Java
+// and JavaScript Application Insights SDKs.  Enable compatibility mode in
+// distributed systems that mix languages, so that every service sampling at
+// the same percentage keeps or drops the same operations and traces remain
+// complete.  The two algorithms make different decisions for the same
+// operation, so all Go services in a system should use the same mode.
+func SetSamplingCompatibilityMode(enabled bool) {
+	if samplingCompatibilityMode.Swap(enabled) != enabled {
+		diagnosticsWriter.Printf("Sampling compatibility mode: %t", enabled)
+	}
+}
+
+// IsSamplingCompatibilityMode returns whether sampling compatibility mode is
+// enabled.
+func IsSamplingCompatibilityMode() bool {
+	return samplingCompatibilityMode.Load()
+}
+
+// SamplingScore computes the sampling score of an operation ID the way the
+// other Application Insights SDKs do, as a value between 0 and 100.  An
+// item is kept if its score is less than the sampling percentage.
+//
+// The score is a 32-bit djb2 hash of the UTF-16 code units of the value,
+// repeated until it is at least 8 characters long, scaled to the range of
+// positive 32-bit integers.
+func SamplingScore(value string) float64 {
+	return float64(samplingHashCode(value)) / math.MaxInt32 * 100
+}
+
+func samplingHashCode(value string) int32 {
+	if value == "" {
+		return 0
+	}
+
+	units := utf16.Encode([]rune(value))
+	for len(units) < 8 {
+		units = append(units, units...)
+	}
+
+	hash := int32(5381)
+	for _, c := range units {
+		hash = (hash << 5) + hash + int32(c)
+	}
+
+	if hash == math.MinInt32 {
+		return math.MaxInt32
+	}
+	if hash < 0 {
+		return -hash
+	}
+
+	return hash
+}
+
+// OperationSampleScore returns the score that the built-in sampling
+// processors compute for an operation ID in the current sampling mode, as a
+// value between 0 and 100.  An operation is kept at a sampling percentage
+// if its score is less than the percentage, so applications can make
+// decisions aligned with sampling for their own data, such as only storing
+// the request bodies of sampled traces:
+//
+//	if OperationSampleScore(corrCtx.GetOperationID()) < samplingPercentage {
+//		store(body)
+//	}
+func OperationSampleScore(operationId string) float64 {
+	if IsSamplingCompatibilityMode() {
+		return SamplingScore(operationId)
+	}
+
+	return float64(calculateSamplingHash(operationId)) / math.MaxUint32 * 100
+}
+
+// isSampledIn makes the sampling decision for an operation at the specified
+// sampling percentage
+func isSampledIn(operationId string, samplingRate float64) bool {
+	return OperationSampleScore(operationId) < samplingRate
+}
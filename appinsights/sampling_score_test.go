@@ -0,0 +1,111 @@
+package appinsights
+
+import (
+	"math"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestSamplingScore(t *testing.T) {
+	// Expected values are computed with the algorithm used by the .NET SDK
+	tests := []struct {
+		value    string
+		hashCode int32
+	}{
+		{"", 0},
+		{"a", 348946573},
+		{"abcdefgh", 1722392489},
+		{"0af7651916cd43dd8448eb211c80319c", 1133633597},
+		{"4bf92f3577b34da6a3ce929d0e0e4736", 718577102},
+		{"ü", 822559717},
+		{"😀", 404552455},
+	}
+
+	for _, test := range tests {
+		if hashCode := samplingHashCode(test.value); hashCode != test.hashCode {
+			t.Errorf("samplingHashCode(%q) = %d, want %d", test.value, hashCode, test.hashCode)
+		}
+
+		expectedScore := float64(test.hashCode) / math.MaxInt32 * 100
+		if score := SamplingScore(test.value); score != expectedScore {
+			t.Errorf("SamplingScore(%q) = %f, want %f", test.value, score, expectedScore)
+		}
+	}
+}
+
+func TestSamplingCompatibilityMode(t *testing.T) {
+	SetSamplingCompatibilityMode(true)
+	defer SetSamplingCompatibilityMode(false)
+
+	if !IsSamplingCompatibilityMode() {
+		t.Fatal("Expected compatibility mode to be enabled")
+	}
+
+	newEnvelope := func(operationId string) *contracts.Envelope {
+		envelope := contracts.NewEnvelope()
+		envelope.Name = "Microsoft.ApplicationInsights.Request"
+		envelope.Tags = map[string]string{contracts.OperationId: operationId}
+		return envelope
+	}
+
+	// Score is ~52.79 for this operation
+	operationId := "0af7651916cd43dd8448eb211c80319c"
+	processors := []struct {
+		name  string
+		build func(rate float64) SamplingProcessor
+	}{
+		{"fixed", func(rate float64) SamplingProcessor { return NewFixedRateSamplingProcessor(rate) }},
+		{"per-type", func(rate float64) SamplingProcessor { return NewPerTypeSamplingProcessor(rate, nil) }},
+		{"intelligent", func(rate float64) SamplingProcessor { return NewIntelligentSamplingProcessor(rate) }},
+	}
+
+	for _, processor := range processors {
+		if processor.build(52).ShouldSample(newEnvelope(operationId)) {
+			t.Errorf("%s: expected operation to be dropped at 52%%", processor.name)
+		}
+		if !processor.build(53).ShouldSample(newEnvelope(operationId)) {
+			t.Errorf("%s: expected operation to be kept at 53%%", processor.name)
+		}
+	}
+
+	// Retention still tracks the sampling percentage
+	kept := 0
+	processor := NewFixedRateSamplingProcessor(20)
+	for i := 0; i < 10000; i++ {
+		if processor.ShouldSample(newEnvelope(newUUID().String())) {
+			kept++
+		}
+	}
+	if kept < 1700 || kept > 2300 {
+		t.Errorf("Expected about 2000 items to be kept, got %d", kept)
+	}
+}
+
+func TestOperationSampleScore(t *testing.T) {
+	newEnvelope := func(operationId string) *contracts.Envelope {
+		envelope := contracts.NewEnvelope()
+		envelope.Name = "Microsoft.ApplicationInsights.Request"
+		envelope.Tags = map[string]string{contracts.OperationId: operationId}
+		return envelope
+	}
+
+	for _, compatibility := range []bool{false, true} {
+		SetSamplingCompatibilityMode(compatibility)
+
+		processor := NewFixedRateSamplingProcessor(30)
+		for i := 0; i < 1000; i++ {
+			operationId := newUUID().String()
+			score := OperationSampleScore(operationId)
+			if score < 0 || score > 100 {
+				t.Fatalf("Score %f out of range", score)
+			}
+
+			if kept := processor.ShouldSample(newEnvelope(operationId)); kept != (score < 30) {
+				t.Fatalf("Compatibility %t: score %f of %s disagrees with the sampling decision", compatibility, score, operationId)
+			}
+		}
+	}
+
+	SetSamplingCompatibilityMode(false)
+}
@@ -211,12 +211,8 @@ func TestTelemetryClientWithSampling(t *testing.T) {
 	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
 	config.SamplingProcessor = NewFixedRateSamplingProcessor(0) // 0% sampling
 
-	client := NewTelemetryClientFromConfig(config)
-
 	// Create a test channel to verify no telemetry is sent
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	// Track some telemetry
 	client.TrackEvent("test-event")
@@ -229,10 +225,7 @@ func TestTelemetryClientWithSampling(t *testing.T) {
 
 	// Now test with 100% sampling
 	config.SamplingProcessor = NewFixedRateSamplingProcessor(100)
-	client = NewTelemetryClientFromConfig(config)
-	tc = client.(*telemetryClient)
-	tc.channel = testChannel
-	testChannel.reset()
+	client, testChannel = newTestClient(config)
 
 	client.TrackEvent("test-event")
 	client.TrackTrace("test-trace", contracts.Information)
@@ -248,10 +241,7 @@ func TestTelemetryClientWithContextSampling(t *testing.T) {
 	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
 	config.SamplingProcessor = NewFixedRateSamplingProcessor(0) // 0% sampling
 
-	client := NewTelemetryClientFromConfig(config)
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	ctx := context.Background()
 	client.TrackEventWithContext(ctx, "test-event")
@@ -267,10 +257,7 @@ func TestTelemetryClientDefaultSampling(t *testing.T) {
 	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
 	// Don't set SamplingProcessor - should default to disabled
 
-	client := NewTelemetryClientFromConfig(config)
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	client.TrackEvent("test-event")
 
@@ -471,10 +458,7 @@ func TestTelemetryClientWithAdaptiveSampling(t *testing.T) {
 	}
 	config.SamplingProcessor = NewAdaptiveSamplingProcessor(adaptiveConfig)
 
-	client := NewTelemetryClientFromConfig(config)
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	// Track some telemetry
 	client.TrackEvent("test-event")
@@ -864,10 +848,7 @@ func TestTelemetryClientWithPerTypeSampling(t *testing.T) {
 	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
 	config.SamplingProcessor = NewPerTypeSamplingProcessor(50, typeRates)
 
-	client := NewTelemetryClientFromConfig(config)
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	// Track some telemetry
 	client.TrackEvent("test-event")                        // Should be blocked (0%)
@@ -1318,6 +1299,66 @@ func TestErrorPrioritySamplingRule_Properties(t *testing.T) {
 	}
 }
 
+func TestErrorPrioritySamplingRule_Configuration(t *testing.T) {
+	request := func(code string, duration time.Duration) *contracts.Envelope {
+		return &contracts.Envelope{
+			Name: "Microsoft.ApplicationInsights.test.Request",
+			Data: &contracts.Data{BaseData: &contracts.RequestData{ResponseCode: code, Duration: formatDuration(duration)}},
+		}
+	}
+	dependency := func(dependencyType string) *contracts.Envelope {
+		return &contracts.Envelope{
+			Name: "Microsoft.ApplicationInsights.test.RemoteDependency",
+			Data: &contracts.Data{BaseData: &contracts.RemoteDependencyData{Type: dependencyType, Success: false}},
+		}
+	}
+	trace := func(severity contracts.SeverityLevel) *contracts.Envelope {
+		return &contracts.Envelope{
+			Name: "Microsoft.ApplicationInsights.test.Message",
+			Data: &contracts.Data{BaseData: &contracts.MessageData{SeverityLevel: severity}},
+		}
+	}
+
+	rule := NewErrorPrioritySamplingRule()
+	rule.ResponseCodeClasses = []byte{'5'}
+	rule.TraceSeverities = []contracts.SeverityLevel{contracts.Warning, contracts.Error, contracts.Critical}
+	rule.DependencyTypes = []string{"SQL"}
+	rule.SlowRequestThreshold = 2 * time.Second
+	rule.SamplingRate = 25.0
+
+	tests := []struct {
+		name     string
+		envelope *contracts.Envelope
+		expected bool
+	}{
+		{"4xx request no longer an error", request("404", time.Millisecond), false},
+		{"5xx request", request("503", time.Millisecond), true},
+		{"Slow successful request", request("200", 3*time.Second), true},
+		{"Fast successful request", request("200", time.Second), false},
+		{"Failed SQL dependency", dependency("sql"), true},
+		{"Failed HTTP dependency", dependency("Http"), false},
+		{"Warning trace", trace(contracts.Warning), true},
+		{"Information trace", trace(contracts.Information), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := rule.ShouldApply(tt.envelope); result != tt.expected {
+				t.Errorf("ShouldApply() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+
+	if rate := rule.GetSamplingRate(); rate != 25.0 {
+		t.Errorf("GetSamplingRate() = %v, want 25.0", rate)
+	}
+
+	rule.SamplingRate = 0
+	if rate := rule.GetSamplingRate(); rate != 100.0 {
+		t.Errorf("GetSamplingRate() with no rate = %v, want 100.0", rate)
+	}
+}
+
 func TestCustomSamplingRule(t *testing.T) {
 	// Create a rule that applies to events with "important" in the name
 	rule := NewCustomSamplingRule("important-events", 500, 75.0, func(envelope *contracts.Envelope) bool {
@@ -1751,10 +1792,7 @@ func TestTelemetryClientWithIntelligentSampling(t *testing.T) {
 	config := NewTelemetryConfiguration("InstrumentationKey=test-key")
 	config.SamplingProcessor = NewIntelligentSamplingProcessor(25.0)
 
-	client := NewTelemetryClientFromConfig(config)
-	testChannel := &TestTelemetryChannel{}
-	tc := client.(*telemetryClient)
-	tc.channel = testChannel
+	client, testChannel := newTestClient(config)
 
 	// Track an exception - should always be sent
 	client.TrackException("test error")
@@ -1835,3 +1873,15 @@ func (c *TestTelemetryChannel) reset() {
 	defer c.mutex.Unlock()
 	c.sentItems = nil
 }
+
+// newTestClient creates a client, from the configuration if one is specified,
+// that submits its telemetry to a new TestTelemetryChannel.  The client is
+// built on the test channel, so no in-memory channel is left running.
+func newTestClient(config ...*TelemetryConfiguration) (TelemetryClient, *TestTelemetryChannel) {
+	testChannel := &TestTelemetryChannel{}
+	if len(config) > 0 {
+		return newTelemetryClient(config[0], testChannel), testChannel
+	}
+
+	return newTelemetryClient(NewTelemetryConfiguration("InstrumentationKey="+test_ikey), testChannel), testChannel
+}
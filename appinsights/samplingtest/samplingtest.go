@@ -0,0 +1,213 @@
+// Package samplingtest provides utilities for validating sampling
+// processors against synthetic, correlated workloads.  It applies the same
+// checks used for the built-in processors: retention rates, per-operation
+// consistency, and item count fidelity.
+package samplingtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Workload describes a synthetic stream of correlated telemetry.
+type Workload struct {
+	// Number of operations to generate
+	Operations int
+
+	// Number of telemetry items in each operation
+	ItemsPerOperation int
+
+	// Telemetry types assigned to the items of each operation, in turn.
+	// Defaults to a request followed by dependencies.
+	Types []appinsights.TelemetryType
+
+	// Fraction of requests and dependencies that fail, between 0 and 1
+	FailureRate float64
+
+	// Seed for the generated IDs and failures, so runs are reproducible
+	Seed int64
+}
+
+// TypeResult summarizes how a processor treated a single telemetry type.
+type TypeResult struct {
+	// Number of items submitted to the processor
+	Total int
+
+	// Number of items kept by the processor
+	Kept int
+
+	// Sum of the SampleRate of kept items; the number of items the kept
+	// items represent once sampling is accounted for
+	EstimatedCount float64
+}
+
+// RetentionRate returns the percentage of items kept.
+func (r TypeResult) RetentionRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+
+	return 100 * float64(r.Kept) / float64(r.Total)
+}
+
+// Result summarizes how a processor treated a workload.
+type Result struct {
+	TypeResult
+
+	// Results broken down by telemetry type
+	ByType map[appinsights.TelemetryType]*TypeResult
+
+	// Number of operations generated
+	Operations int
+
+	// Number of operations for which some, but not all, items were kept
+	PartialOperations int
+}
+
+// Run submits the workload to the processor and records its decisions.
+func Run(processor appinsights.SamplingProcessor, workload Workload) *Result {
+	types := workload.Types
+	if len(types) == 0 {
+		types = []appinsights.TelemetryType{appinsights.TelemetryTypeRequest, appinsights.TelemetryTypeRemoteDependency}
+	}
+
+	random := rand.New(rand.NewSource(workload.Seed))
+	result := &Result{
+		ByType:     make(map[appinsights.TelemetryType]*TypeResult),
+		Operations: workload.Operations,
+	}
+
+	for op := 0; op < workload.Operations; op++ {
+		operationID := fmt.Sprintf("%016x%016x", random.Uint64(), random.Uint64())
+		kept := 0
+
+		for i := 0; i < workload.ItemsPerOperation; i++ {
+			telemetryType := types[i%len(types)]
+			failed := random.Float64() < workload.FailureRate
+			envelope := newEnvelope(telemetryType, operationID, failed)
+
+			typeResult := result.ByType[telemetryType]
+			if typeResult == nil {
+				typeResult = &TypeResult{}
+				result.ByType[telemetryType] = typeResult
+			}
+
+			typeResult.Total++
+			result.Total++
+			if processor.ShouldSample(envelope) {
+				kept++
+				typeResult.Kept++
+				typeResult.EstimatedCount += envelope.SampleRate
+				result.Kept++
+				result.EstimatedCount += envelope.SampleRate
+			}
+		}
+
+		if kept > 0 && kept < workload.ItemsPerOperation {
+			result.PartialOperations++
+		}
+	}
+
+	return result
+}
+
+// newEnvelope creates a minimal envelope of the specified type
+func newEnvelope(telemetryType appinsights.TelemetryType, operationID string, failed bool) *contracts.Envelope {
+	var baseData interface{}
+	switch telemetryType {
+	case appinsights.TelemetryTypeRequest:
+		request := contracts.NewRequestData()
+		request.Success = !failed
+		request.ResponseCode = "200"
+		if failed {
+			request.ResponseCode = "500"
+		}
+		baseData = request
+	case appinsights.TelemetryTypeRemoteDependency:
+		dependency := contracts.NewRemoteDependencyData()
+		dependency.Success = !failed
+		baseData = dependency
+	case appinsights.TelemetryTypeException:
+		baseData = contracts.NewExceptionData()
+	case appinsights.TelemetryTypeTrace:
+		message := contracts.NewMessageData()
+		message.SeverityLevel = contracts.Information
+		if failed {
+			message.SeverityLevel = contracts.Error
+		}
+		baseData = message
+	case appinsights.TelemetryTypeMetric:
+		baseData = contracts.NewMetricData()
+	case appinsights.TelemetryTypeAvailability:
+		baseData = contracts.NewAvailabilityData()
+	case appinsights.TelemetryTypePageView:
+		baseData = contracts.NewPageViewData()
+	default:
+		baseData = contracts.NewEventData()
+	}
+
+	data := contracts.NewData()
+	data.BaseType = string(telemetryType) + "Data"
+	data.BaseData = baseData
+
+	envelope := contracts.NewEnvelope()
+	envelope.Name = "Microsoft.ApplicationInsights.samplingtest." + string(telemetryType)
+	envelope.IKey = "samplingtest"
+	envelope.Data = data
+	envelope.Tags = map[string]string{contracts.OperationId: operationID}
+
+	return envelope
+}
+
+// AssertRetentionRate checks that the percentage of items kept is within
+// tolerance percentage points of expected.
+func AssertRetentionRate(t testing.TB, result *Result, expected, tolerance float64) {
+	t.Helper()
+	if rate := result.RetentionRate(); math.Abs(rate-expected) > tolerance {
+		t.Errorf("Retention rate %.2f%% is not within %.2f of %.2f%%", rate, tolerance, expected)
+	}
+}
+
+// AssertTypeRetentionRate checks the retention rate of a single telemetry
+// type.
+func AssertTypeRetentionRate(t testing.TB, result *Result, telemetryType appinsights.TelemetryType, expected, tolerance float64) {
+	t.Helper()
+	typeResult, ok := result.ByType[telemetryType]
+	if !ok {
+		t.Errorf("Workload contained no %s items", telemetryType)
+		return
+	}
+
+	if rate := typeResult.RetentionRate(); math.Abs(rate-expected) > tolerance {
+		t.Errorf("%s retention rate %.2f%% is not within %.2f of %.2f%%", telemetryType, rate, tolerance, expected)
+	}
+}
+
+// AssertOperationConsistency checks that every operation was either kept
+// or dropped in its entirety.
+func AssertOperationConsistency(t testing.TB, result *Result) {
+	t.Helper()
+	if result.PartialOperations > 0 {
+		t.Errorf("%d of %d operations were only partially kept", result.PartialOperations, result.Operations)
+	}
+}
+
+// AssertItemCountFidelity checks that the kept items, weighted by their
+// SampleRate, represent the submitted items to within the specified
+// relative tolerance; e.g. 0.1 for 10%.
+func AssertItemCountFidelity(t testing.TB, result *Result, tolerance float64) {
+	t.Helper()
+	if result.Total == 0 {
+		return
+	}
+
+	if deviation := math.Abs(result.EstimatedCount-float64(result.Total)) / float64(result.Total); deviation > tolerance {
+		t.Errorf("Kept items represent %.0f items, but %d were submitted (%.1f%% deviation)",
+			result.EstimatedCount, result.Total, deviation*100)
+	}
+}
@@ -0,0 +1,107 @@
+package samplingtest
+
+import (
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+var defaultWorkload = Workload{
+	Operations:        2000,
+	ItemsPerOperation: 4,
+	Seed:              1,
+}
+
+func TestFixedRateProcessor(t *testing.T) {
+	result := Run(appinsights.NewFixedRateSamplingProcessor(25), defaultWorkload)
+
+	if result.Total != 8000 {
+		t.Fatalf("Expected 8000 items, got %d", result.Total)
+	}
+
+	AssertRetentionRate(t, result, 25, 3)
+	AssertTypeRetentionRate(t, result, appinsights.TelemetryTypeRequest, 25, 3)
+	AssertOperationConsistency(t, result)
+	AssertItemCountFidelity(t, result, 0.1)
+}
+
+func TestDisabledProcessor(t *testing.T) {
+	result := Run(appinsights.NewDisabledSamplingProcessor(), defaultWorkload)
+
+	AssertRetentionRate(t, result, 100, 0)
+	AssertOperationConsistency(t, result)
+	AssertItemCountFidelity(t, result, 0)
+}
+
+func TestPerTypeProcessor(t *testing.T) {
+	processor := appinsights.NewPerTypeSamplingProcessor(100, map[appinsights.TelemetryType]float64{
+		appinsights.TelemetryTypeRemoteDependency: 50,
+	})
+	result := Run(processor, defaultWorkload)
+
+	AssertTypeRetentionRate(t, result, appinsights.TelemetryTypeRequest, 100, 0)
+	AssertTypeRetentionRate(t, result, appinsights.TelemetryTypeRemoteDependency, 50, 5)
+	AssertItemCountFidelity(t, result, 0.1)
+}
+
+// Drops every other item, regardless of operation
+type alternatingProcessor struct {
+	count int
+}
+
+func (p *alternatingProcessor) ShouldSample(envelope *contracts.Envelope) bool {
+	p.count++
+	envelope.SampleRate = 1
+	return p.count%2 == 0
+}
+
+func (p *alternatingProcessor) GetSamplingRate() float64 {
+	return 50
+}
+
+// Records assertion failures without failing the test
+type recordingTB struct {
+	testing.TB
+	failures int
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.failures++
+}
+
+func TestAssertionsDetectFaultyProcessor(t *testing.T) {
+	result := Run(&alternatingProcessor{}, Workload{Operations: 10, ItemsPerOperation: 2})
+
+	if result.PartialOperations != 10 {
+		t.Errorf("Expected every operation to be partial, got %d", result.PartialOperations)
+	}
+
+	recorder := &recordingTB{TB: t}
+	AssertOperationConsistency(recorder, result)
+	AssertItemCountFidelity(recorder, result, 0.1)
+	if recorder.failures != 2 {
+		t.Errorf("Expected both assertions to fail for an inconsistent processor, got %d failures", recorder.failures)
+	}
+}
+
+func TestWorkloadTypesAndFailures(t *testing.T) {
+	workload := Workload{
+		Operations:        500,
+		ItemsPerOperation: 3,
+		Types:             []appinsights.TelemetryType{appinsights.TelemetryTypeRequest, appinsights.TelemetryTypeTrace, appinsights.TelemetryTypeException},
+		FailureRate:       1,
+	}
+
+	// Error priority keeps failed requests, error traces and exceptions
+	processor := appinsights.NewIntelligentSamplingProcessor(0)
+	processor.AddRule(appinsights.NewErrorPrioritySamplingRule())
+	result := Run(processor, workload)
+
+	AssertRetentionRate(t, result, 100, 0)
+	if len(result.ByType) != 3 {
+		t.Errorf("Expected 3 telemetry types, got %d", len(result.ByType))
+	}
+}
@@ -0,0 +1,243 @@
+package appinsights
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Telemetry segments are batches of serialized telemetry encoded for storage
+// outside of process memory, such as when spilling to disk.  Each segment
+// begins with a header identifying the codec used to compress it and
+// whether it is encrypted, so that segments written with one codec can still
+// be read after the codec changes.  Once a cipher is configured, only
+// encrypted segments are accepted, and the header is authenticated along with
+// the body so that it cannot be altered.
+//
+//	"AIS" | version | codec ID | flags | body
+
+const (
+	segmentVersion   = 1
+	segmentEncrypted = 1 << 0
+)
+
+var segmentMagic = []byte("AIS")
+
+const segmentHeaderSize = 6
+
+// SegmentCodec compresses and decompresses telemetry segments.  Codecs such
+// as zstd that depend on third-party packages can be plugged in with
+// RegisterSegmentCodec.
+type SegmentCodec interface {
+	// Unique identifier of the codec, recorded in segment headers.
+	ID() byte
+
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// SegmentCipher encrypts telemetry segments at rest, since spilled
+// telemetry may contain sensitive data.  Open must detect tampering with
+// either the ciphertext or the additional data, which holds the segment
+// header.
+type SegmentCipher interface {
+	Seal(plaintext, additionalData []byte) ([]byte, error)
+	Open(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// Identifiers of the built-in segment codecs.  IDs below 16 are reserved.
+const (
+	SegmentCodecNone byte = 0
+	SegmentCodecGzip byte = 1
+)
+
+var (
+	segmentCodecLock sync.RWMutex
+	segmentCodecs    = map[byte]SegmentCodec{
+		SegmentCodecNone: noSegmentCodec{},
+		SegmentCodecGzip: NewGzipSegmentCodec(gzip.DefaultCompression),
+	}
+)
+
+// RegisterSegmentCodec makes a codec available for decoding segments that
+// were written with it.  Registering a codec with the ID of an existing
+// codec replaces it.
+func RegisterSegmentCodec(codec SegmentCodec) {
+	segmentCodecLock.Lock()
+	defer segmentCodecLock.Unlock()
+	segmentCodecs[codec.ID()] = codec
+}
+
+func lookupSegmentCodec(id byte) (SegmentCodec, bool) {
+	segmentCodecLock.RLock()
+	defer segmentCodecLock.RUnlock()
+	codec, ok := segmentCodecs[id]
+	return codec, ok
+}
+
+// SegmentEncoder encodes telemetry segments with the configured codec and
+// cipher.  The zero value stores segments uncompressed and unencrypted.
+type SegmentEncoder struct {
+	// Codec used to compress new segments (optional)
+	Codec SegmentCodec
+
+	// Cipher used to encrypt new segments, and required to read encrypted
+	// segments (optional)
+	Cipher SegmentCipher
+}
+
+// Encode compresses and optionally encrypts a segment.
+func (encoder *SegmentEncoder) Encode(payload []byte) ([]byte, error) {
+	codec := encoder.Codec
+	if codec == nil {
+		codec = noSegmentCodec{}
+	}
+
+	body, err := codec.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if encoder.Cipher != nil {
+		flags |= segmentEncrypted
+	}
+
+	header := make([]byte, 0, segmentHeaderSize)
+	header = append(header, segmentMagic...)
+	header = append(header, segmentVersion, codec.ID(), flags)
+
+	if encoder.Cipher != nil {
+		if body, err = encoder.Cipher.Seal(body, header); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(header, body...), nil
+}
+
+// Decode reads a segment written by Encode, using the codec recorded in its
+// header regardless of the encoder's configured Codec.  If a Cipher is
+// configured, unencrypted segments are rejected.
+func (encoder *SegmentEncoder) Decode(segment []byte) ([]byte, error) {
+	if len(segment) < segmentHeaderSize || !bytes.Equal(segment[:3], segmentMagic) {
+		return nil, errors.New("appinsights: not a telemetry segment")
+	}
+	if segment[3] != segmentVersion {
+		return nil, fmt.Errorf("appinsights: unsupported segment version %d", segment[3])
+	}
+
+	codec, ok := lookupSegmentCodec(segment[4])
+	if !ok {
+		return nil, fmt.Errorf("appinsights: unknown segment codec %d", segment[4])
+	}
+
+	header, body := segment[:segmentHeaderSize], segment[segmentHeaderSize:]
+	if header[5]&segmentEncrypted != 0 {
+		if encoder.Cipher == nil {
+			return nil, errors.New("appinsights: segment is encrypted but no cipher is configured")
+		}
+
+		var err error
+		if body, err = encoder.Cipher.Open(body, header); err != nil {
+			return nil, err
+		}
+	} else if encoder.Cipher != nil {
+		return nil, errors.New("appinsights: segment is not encrypted but a cipher is configured")
+	}
+
+	return codec.Decompress(body)
+}
+
+type noSegmentCodec struct{}
+
+func (noSegmentCodec) ID() byte                               { return SegmentCodecNone }
+func (noSegmentCodec) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (noSegmentCodec) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+type gzipSegmentCodec struct {
+	level int
+}
+
+// NewGzipSegmentCodec creates a codec that compresses segments with gzip at
+// the specified compression level.
+func NewGzipSegmentCodec(level int) SegmentCodec {
+	return &gzipSegmentCodec{level}
+}
+
+func (codec *gzipSegmentCodec) ID() byte {
+	return SegmentCodecGzip
+}
+
+func (codec *gzipSegmentCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, codec.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (codec *gzipSegmentCodec) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+type aesGCMSegmentCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMSegmentCipher creates a cipher that encrypts segments with
+// AES-GCM.  The key must be 16, 24 or 32 bytes long.
+func NewAESGCMSegmentCipher(key []byte) (SegmentCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesGCMSegmentCipher{aead}, nil
+}
+
+func (c *aesGCMSegmentCipher) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (c *aesGCMSegmentCipher) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("appinsights: encrypted segment is truncated")
+	}
+
+	return c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], additionalData)
+}
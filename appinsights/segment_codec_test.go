@@ -0,0 +1,146 @@
+package appinsights
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+var segmentTestPayload = []byte(strings.Repeat(`{"name":"Microsoft.ApplicationInsights.Event"}`+"\n", 50))
+
+func TestSegmentRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	aesCipher, err := NewAESGCMSegmentCipher(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	encoders := map[string]*SegmentEncoder{
+		"plain":          {},
+		"gzip":           {Codec: NewGzipSegmentCodec(gzip.BestSpeed)},
+		"encrypted":      {Cipher: aesCipher},
+		"gzip+encrypted": {Codec: NewGzipSegmentCodec(gzip.DefaultCompression), Cipher: aesCipher},
+	}
+
+	for name, encoder := range encoders {
+		segment, err := encoder.Encode(segmentTestPayload)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		if encoder.Cipher != nil && bytes.Contains(segment, []byte("ApplicationInsights")) {
+			t.Errorf("%s: expected segment body to be encrypted", name)
+		}
+		if encoder.Codec != nil && len(segment) >= len(segmentTestPayload) {
+			t.Errorf("%s: expected segment to be compressed, got %d bytes", name, len(segment))
+		}
+
+		decoded, err := encoder.Decode(segment)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if !bytes.Equal(decoded, segmentTestPayload) {
+			t.Errorf("%s: decoded payload does not match", name)
+		}
+	}
+}
+
+func TestSegmentDecodeUsesRecordedCodec(t *testing.T) {
+	segment, err := (&SegmentEncoder{Codec: NewGzipSegmentCodec(gzip.BestCompression)}).Encode(segmentTestPayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Segments written before a configuration change must remain readable
+	decoded, err := (&SegmentEncoder{}).Decode(segment)
+	if err != nil || !bytes.Equal(decoded, segmentTestPayload) {
+		t.Errorf("Expected gzip segment to decode without a configured codec, got %v", err)
+	}
+}
+
+type reverseSegmentCodec struct{}
+
+func (reverseSegmentCodec) ID() byte { return 200 }
+func (reverseSegmentCodec) Compress(data []byte) ([]byte, error) {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[len(data)-1-i] = b
+	}
+	return result, nil
+}
+func (c reverseSegmentCodec) Decompress(data []byte) ([]byte, error) { return c.Compress(data) }
+
+func TestSegmentCustomCodec(t *testing.T) {
+	encoder := &SegmentEncoder{Codec: reverseSegmentCodec{}}
+	segment, err := encoder.Encode(segmentTestPayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if _, err := encoder.Decode(segment); err == nil {
+		t.Error("Expected decoding with an unregistered codec to fail")
+	}
+
+	RegisterSegmentCodec(reverseSegmentCodec{})
+	if decoded, err := encoder.Decode(segment); err != nil || !bytes.Equal(decoded, segmentTestPayload) {
+		t.Errorf("Expected registered codec to decode, got %v", err)
+	}
+}
+
+func TestSegmentDecodeErrors(t *testing.T) {
+	aesCipher, _ := NewAESGCMSegmentCipher(bytes.Repeat([]byte{1}, 16))
+	otherCipher, _ := NewAESGCMSegmentCipher(bytes.Repeat([]byte{2}, 16))
+
+	encrypted, err := (&SegmentEncoder{Cipher: aesCipher}).Encode(segmentTestPayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	plain, err := (&SegmentEncoder{}).Encode(segmentTestPayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Clearing the encrypted flag must not let the body through as plaintext
+	downgraded := append([]byte(nil), encrypted...)
+	downgraded[5] &^= segmentEncrypted
+
+	// The header is authenticated, so switching the codec is detected even
+	// though the body is untouched
+	gzipEncrypted, err := (&SegmentEncoder{Codec: NewGzipSegmentCodec(gzip.BestSpeed), Cipher: aesCipher}).Encode(segmentTestPayload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	recodec := append([]byte(nil), gzipEncrypted...)
+	recodec[4] = SegmentCodecNone
+
+	tests := []struct {
+		name    string
+		encoder *SegmentEncoder
+		segment []byte
+	}{
+		{"garbage", &SegmentEncoder{}, []byte("not a segment")},
+		{"truncated", &SegmentEncoder{}, []byte("AIS")},
+		{"bad version", &SegmentEncoder{}, []byte("AIS\x09\x00\x00")},
+		{"missing cipher", &SegmentEncoder{}, encrypted},
+		{"wrong key", &SegmentEncoder{Cipher: otherCipher}, encrypted},
+		{"tampered", &SegmentEncoder{Cipher: aesCipher}, tampered},
+		{"unencrypted with cipher", &SegmentEncoder{Cipher: aesCipher}, plain},
+		{"downgraded", &SegmentEncoder{Cipher: aesCipher}, downgraded},
+		{"tampered header", &SegmentEncoder{Cipher: aesCipher}, recodec},
+	}
+
+	for _, test := range tests {
+		if _, err := test.encoder.Decode(test.segment); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	if _, err := NewAESGCMSegmentCipher([]byte("short")); err == nil {
+		t.Error("Expected an error for an invalid key size")
+	}
+}
@@ -0,0 +1,47 @@
+package appinsights
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ServeMux wraps mux with the middleware.  The route pattern matched by the
+// mux, such as "GET /orders/{id}", is resolved before the request is handled,
+// so that the request and all telemetry tracked while handling it are named
+// after the route rather than the raw URL.
+func (m *HTTPMiddleware) ServeMux(mux *http.ServeMux) http.Handler {
+	handler := m.Middleware(mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The mux sets the pattern on the request as it routes it; setting
+		// it first only makes it visible to the middleware earlier.  The
+		// caller's request is left untouched.
+		if r.Pattern == "" {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				r = r.WithContext(r.Context())
+				r.Pattern = pattern
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// routeOperationName returns the operation name of a request routed by an
+// http.ServeMux, derived from its matched pattern, or "" if the request has
+// not been routed by pattern.  Patterns without a method are prefixed with
+// the request method.
+func routeOperationName(r *http.Request) string {
+	pattern := r.Pattern
+	if pattern == "" {
+		return ""
+	}
+
+	// A pattern is "[METHOD ][HOST]/[PATH]"; the path always starts with a
+	// slash and the method, if any, is separated by spaces or tabs
+	slash := strings.IndexByte(pattern, '/')
+	if space := strings.IndexAny(pattern, " \t"); space >= 0 && (slash < 0 || space < slash) {
+		return pattern[:space] + " " + strings.TrimLeft(pattern[space:], " \t")
+	}
+
+	return r.Method + " " + pattern
+}
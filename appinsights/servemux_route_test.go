@@ -0,0 +1,95 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newServeMuxTestClient() (TelemetryClient, *TestTelemetryChannel, *HTTPMiddleware) {
+	client, testChannel := newTestClient()
+
+	middleware := NewHTTPMiddleware()
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+	return client, testChannel, middleware
+}
+
+func TestRouteOperationName(t *testing.T) {
+	tests := []struct {
+		method  string
+		pattern string
+		name    string
+	}{
+		{"GET", "", ""},
+		{"GET", "GET /orders/{id}", "GET /orders/{id}"},
+		{"POST", "/items/", "POST /items/"},
+		{"DELETE", "example.com/items/{id}", "DELETE example.com/items/{id}"},
+		{"PUT", "PUT \t/items/{id...}", "PUT /items/{id...}"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/", nil)
+		r.Pattern = test.pattern
+		if name := routeOperationName(r); name != test.name {
+			t.Errorf("Pattern %q: expected %q, got %q", test.pattern, test.name, name)
+		}
+	}
+}
+
+func TestMiddlewareServeMuxPattern(t *testing.T) {
+	_, testChannel, middleware := newServeMuxTestClient()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := middleware.Middleware(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders/42?expand=true", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected 2 requests, got %d", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	request := envelope.Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.Name != "GET /orders/{id}" || envelope.Tags[contracts.OperationName] != "GET /orders/{id}" {
+		t.Errorf("Expected the request to be named after its pattern, got %q and %q", request.Name, envelope.Tags[contracts.OperationName])
+	}
+	if request.Url != "/orders/42?expand=true" {
+		t.Errorf("Expected the URL to be kept, got %s", request.Url)
+	}
+
+	// Unrouted requests keep their URL name
+	request = testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if request.Name != "GET /missing" {
+		t.Errorf("Expected the unrouted request to be named after its URL, got %q", request.Name)
+	}
+}
+
+func TestMiddlewareServeMuxNamesNestedTelemetry(t *testing.T) {
+	client, testChannel, middleware := newServeMuxTestClient()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items/", func(w http.ResponseWriter, r *http.Request) {
+		client.TrackWithContext(r.Context(), NewTraceTelemetry("handling", Information))
+	})
+	handler := middleware.ServeMux(mux)
+
+	r := httptest.NewRequest("POST", "/items/7", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if r.Pattern != "" {
+		t.Errorf("Expected the caller's request to be left untouched, got pattern %q", r.Pattern)
+	}
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected a trace and a request, got %d items", testChannel.getSentCount())
+	}
+
+	for _, envelope := range testChannel.sentItems {
+		if name := envelope.Tags[contracts.OperationName]; name != "POST /items/" {
+			t.Errorf("Expected %s to be named after the route, got %q", envelope.Name, name)
+		}
+	}
+}
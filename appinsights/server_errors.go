@@ -0,0 +1,96 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// recordedError is an error recorded by a handler along with the callstack
+// at the point it was recorded
+type recordedError struct {
+	err    interface{}
+	frames []*contracts.StackFrame
+}
+
+// errorRecorder collects errors recorded while handling a request
+type errorRecorder struct {
+	lock   sync.Mutex
+	errors []recordedError
+}
+
+type errorRecorderContextKey struct{}
+
+var errorRecorderKey = errorRecorderContextKey{}
+
+// withErrorRecorder returns a context that collects errors recorded by
+// RecordError
+func withErrorRecorder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, errorRecorderKey, &errorRecorder{})
+}
+
+// RecordError records an error that occurred while handling the current
+// request.  If the request fails with a 5xx response and the middleware has
+// TrackServerErrors enabled, the error is tracked as exception telemetry
+// linked to the request.  err may be a string, error or Stringer.  Returns
+// false if the context does not belong to such a request.
+func RecordError(ctx context.Context, err interface{}) bool {
+	recorder, ok := ctx.Value(errorRecorderKey).(*errorRecorder)
+	if !ok || err == nil {
+		return false
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.errors = append(recorder.errors, recordedError{
+		err:    err,
+		frames: GetCallstack(2),
+	})
+
+	return true
+}
+
+// recordedErrors returns the errors recorded on the context
+func recordedErrors(ctx context.Context) []recordedError {
+	recorder, ok := ctx.Value(errorRecorderKey).(*errorRecorder)
+	if !ok {
+		return nil
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return append([]recordedError(nil), recorder.errors...)
+}
+
+// trackServerErrors tracks exception telemetry for a failed request, linked
+// to the request telemetry.  If the handler did not record any errors, a
+// single exception describing the response status is tracked so that every
+// failed request has an exception to drill into.
+func trackServerErrors(ctx context.Context, client ContextTracker, request *RequestTelemetry, statusCode int) {
+	errors := recordedErrors(ctx)
+	if len(errors) == 0 {
+		errors = []recordedError{{
+			err: fmt.Sprintf("HTTP %d %s", statusCode, http.StatusText(statusCode)),
+		}}
+	}
+
+	for _, recorded := range errors {
+		exception := newExceptionTelemetry(recorded.err, 0)
+		exception.Frames = recorded.frames
+
+		// Parent the exception to the request rather than to its caller
+		if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+			exception.Tags.Operation().SetId(corrCtx.GetOperationID())
+		}
+		exception.Tags.Operation().SetParentId(request.Id)
+		exception.Properties["requestName"] = request.Name
+		exception.Properties["responseCode"] = request.ResponseCode
+
+		client.TrackWithContext(ctx, exception)
+	}
+}
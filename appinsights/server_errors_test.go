@@ -0,0 +1,118 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func newServerErrorTestMiddleware() (*HTTPMiddleware, *TestTelemetryChannel) {
+	client, testChannel := newTestClient()
+
+	middleware := NewHTTPMiddleware()
+	middleware.TrackServerErrors = true
+	middleware.GetClient = func(*http.Request) TelemetryClient { return client }
+
+	return middleware, testChannel
+}
+
+func serveStatus(middleware *HTTPMiddleware, status int, handle func(r *http.Request)) {
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil {
+			handle(r)
+		}
+		w.WriteHeader(status)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+}
+
+func TestServerErrorWithRecordedError(t *testing.T) {
+	middleware, testChannel := newServerErrorTestMiddleware()
+
+	serveStatus(middleware, http.StatusInternalServerError, func(r *http.Request) {
+		if !RecordError(r.Context(), errors.New("database unavailable")) {
+			t.Error("Expected error to be recorded")
+		}
+	})
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected request and exception, got %d items", testChannel.getSentCount())
+	}
+
+	request := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	envelope := testChannel.sentItems[1]
+	exception := envelope.Data.(*contracts.Data).BaseData.(*contracts.ExceptionData)
+
+	if exception.Exceptions[0].Message != "database unavailable" {
+		t.Errorf("Unexpected exception message %q", exception.Exceptions[0].Message)
+	}
+	if envelope.Tags[contracts.OperationParentId] != request.Id {
+		t.Errorf("Expected exception parent %s to be the request %s", envelope.Tags[contracts.OperationParentId], request.Id)
+	}
+	if envelope.Tags[contracts.OperationId] != testChannel.sentItems[0].Tags[contracts.OperationId] {
+		t.Error("Expected exception to share the request's operation")
+	}
+	if exception.Properties["responseCode"] != "500" {
+		t.Errorf("Expected response code property, got %q", exception.Properties["responseCode"])
+	}
+
+	// The callstack starts where the error was recorded
+	frames := exception.Exceptions[0].ParsedStack
+	if len(frames) == 0 || !strings.Contains(frames[0].Method, "TestServerErrorWithRecordedError") {
+		t.Errorf("Expected callstack to start at the handler, got %+v", frames)
+	}
+}
+
+func TestServerErrorWithoutRecordedError(t *testing.T) {
+	middleware, testChannel := newServerErrorTestMiddleware()
+
+	serveStatus(middleware, http.StatusBadGateway, nil)
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected request and exception, got %d items", testChannel.getSentCount())
+	}
+
+	exception := testChannel.sentItems[1].Data.(*contracts.Data).BaseData.(*contracts.ExceptionData)
+	if exception.Exceptions[0].Message != "HTTP 502 Bad Gateway" {
+		t.Errorf("Unexpected exception message %q", exception.Exceptions[0].Message)
+	}
+}
+
+func TestServerErrorNotTrackedForSuccess(t *testing.T) {
+	middleware, testChannel := newServerErrorTestMiddleware()
+
+	serveStatus(middleware, http.StatusNotFound, func(r *http.Request) {
+		RecordError(r.Context(), "not found")
+	})
+
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected only the request, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestServerErrorDisabled(t *testing.T) {
+	middleware, testChannel := newServerErrorTestMiddleware()
+	middleware.TrackServerErrors = false
+
+	serveStatus(middleware, http.StatusInternalServerError, func(r *http.Request) {
+		if RecordError(r.Context(), "ignored") {
+			t.Error("Expected RecordError to report no recorder")
+		}
+	})
+
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected only the request, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestRecordErrorWithoutMiddleware(t *testing.T) {
+	if RecordError(context.Background(), "error") {
+		t.Error("Expected RecordError to report no recorder")
+	}
+}
@@ -0,0 +1,164 @@
+package appinsights
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// shadowSelectionSalt decorrelates the selection of shadowed operations
+// from the sampling decisions made for the same operations
+const shadowSelectionSalt = "shadow:"
+
+// ShadowConfig configures the duplication of a percentage of telemetry to a
+// second destination, such as a staging resource, so that changes to
+// processors, sampling policies or schemas can be validated against real
+// traffic without affecting the primary destination.
+type ShadowConfig struct {
+	// Configuration of the shadow destination: its instrumentation key,
+	// endpoint and channel settings.  If it has a SamplingProcessor, it
+	// decides which copies are kept instead of the primary's processor, so
+	// that a new sampling policy can be compared with the current one.
+	Config *TelemetryConfiguration
+
+	// Percentage of operations duplicated, between 0 and 100.  All items
+	// of a selected operation are duplicated.
+	Percentage float64
+}
+
+// ShadowChannel is a TelemetryChannel that sends telemetry to a primary
+// channel and duplicates a percentage of the tracked telemetry to a shadow
+// channel.  Telemetry is duplicated before the primary's sampling, but
+// after essential-telemetry-only mode and operation budgets are applied,
+// and copies are addressed to the shadow's instrumentation key.  Flushing
+// and closing apply to both channels.
+type ShadowChannel struct {
+	TelemetryChannel
+
+	shadow     TelemetryChannel
+	percentage float64
+	sampling   SamplingProcessor
+	iKey       string
+	nameIKey   string
+}
+
+// NewShadowChannel creates a channel sending to primary and duplicating to
+// the destination described by config.
+func NewShadowChannel(primary TelemetryChannel, config *ShadowConfig) *ShadowChannel {
+	return &ShadowChannel{
+		TelemetryChannel: primary,
+		shadow:           NewInMemoryChannel(config.Config),
+		percentage:       config.Percentage,
+		sampling:         config.Config.SamplingProcessor,
+		iKey:             config.Config.InstrumentationKey,
+		nameIKey:         strings.Replace(config.Config.InstrumentationKey, "-", "", -1),
+	}
+}
+
+// Shadow returns the channel that receives the duplicated telemetry.
+func (channel *ShadowChannel) Shadow() TelemetryChannel {
+	return channel.shadow
+}
+
+// Duplicate sends a copy of the envelope to the shadow channel if its
+// operation is selected.
+func (channel *ShadowChannel) Duplicate(envelope *contracts.Envelope) {
+	if channel == nil || channel.percentage <= 0 {
+		return
+	}
+
+	key := envelope.Tags[contracts.OperationId]
+	if key == "" {
+		key = envelope.Name + envelope.IKey
+	}
+
+	if channel.percentage < 100 && !isSampledIn(shadowSelectionSalt+key, channel.percentage) {
+		return
+	}
+
+	duplicate := *envelope
+	duplicate.IKey = channel.iKey
+
+	// Finalizers and delivery receipts belong to the original
+	duplicate.Finalizers = nil
+	duplicate.Deliveries = nil
+	if channel.nameIKey != "" {
+		duplicate.Name = strings.Replace(envelope.Name, "."+strings.Replace(envelope.IKey, "-", "", -1)+".", "."+channel.nameIKey+".", 1)
+	}
+
+	duplicate.Tags = make(contracts.ContextTags, len(envelope.Tags))
+	for k, v := range envelope.Tags {
+		duplicate.Tags[k] = v
+	}
+
+	// The original's properties may still be modified, e.g. by enrichment
+	if data, ok := envelope.Data.(*contracts.Data); ok {
+		dataCopy := *data
+		dataCopy.BaseData = copyBaseData(data.BaseData)
+		duplicate.Data = &dataCopy
+	}
+
+	if channel.sampling != nil && !channel.sampling.ShouldSample(&duplicate) {
+		return
+	}
+
+	channel.shadow.Send(&duplicate)
+}
+
+// Flush flushes both channels.
+func (channel *ShadowChannel) Flush() {
+	channel.TelemetryChannel.Flush()
+	channel.shadow.Flush()
+}
+
+// Stop stops both channels without flushing.
+func (channel *ShadowChannel) Stop() {
+	channel.TelemetryChannel.Stop()
+	channel.shadow.Stop()
+}
+
+// Close closes both channels.  The returned channel is closed once both
+// have shut down.
+func (channel *ShadowChannel) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	primary := channel.TelemetryChannel.Close(retryTimeout...)
+	shadow := channel.shadow.Close(retryTimeout...)
+
+	done := make(chan struct{})
+	go func() {
+		<-primary
+		<-shadow
+		close(done)
+	}()
+
+	return done
+}
+
+// copyBaseData returns a copy of a telemetry data contract with its own
+// properties and measurements
+func copyBaseData(baseData interface{}) interface{} {
+	original := reflect.ValueOf(baseData)
+	if original.Kind() != reflect.Pointer || original.Elem().Kind() != reflect.Struct {
+		return baseData
+	}
+
+	duplicate := reflect.New(original.Elem().Type())
+	duplicate.Elem().Set(original.Elem())
+
+	for i := 0; i < duplicate.Elem().NumField(); i++ {
+		field := duplicate.Elem().Field(i)
+		if field.Kind() != reflect.Map || field.IsNil() || !field.CanSet() {
+			continue
+		}
+
+		copied := reflect.MakeMapWithSize(field.Type(), field.Len())
+		iter := field.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), iter.Value())
+		}
+		field.Set(copied)
+	}
+
+	return duplicate.Interface()
+}
@@ -0,0 +1,96 @@
+package appinsights
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+const shadowIKey = "11111111-2222-3333-4444-555555555555"
+
+func newShadowedClient(percentage float64, shadowSampling SamplingProcessor) (TelemetryClient, *TestTelemetryChannel, *TestTelemetryChannel) {
+	shadowConfig := NewTelemetryConfiguration("InstrumentationKey=" + shadowIKey)
+	shadowConfig.SamplingProcessor = shadowSampling
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SamplingProcessor = NewFixedRateSamplingProcessor(0)
+	config.Shadow = &ShadowConfig{Config: shadowConfig, Percentage: percentage}
+	client, primary := newTestClient(config)
+
+	shadow := &TestTelemetryChannel{}
+	shadowChannel := client.(*telemetryClient).shadow
+	shadowChannel.shadow.Stop()
+	shadowChannel.shadow = shadow
+	return client, primary, shadow
+}
+
+func TestShadowChannel(t *testing.T) {
+	client, primary, shadow := newShadowedClient(100, NewPerTypeSamplingProcessor(100, map[TelemetryType]float64{TelemetryTypeEvent: 0}))
+
+	TrackTraceWithProperties(client, "message", Information, map[string]string{"key": "value"})
+	client.TrackEvent("event")
+
+	if primary.getSentCount() != 0 {
+		t.Errorf("Expected the primary to sample out everything, got %d items", primary.getSentCount())
+	}
+	if shadow.getSentCount() != 1 {
+		t.Fatalf("Expected the shadow's sampling policy to keep the trace, got %d items", shadow.getSentCount())
+	}
+
+	duplicate := shadow.sentItems[0]
+	if duplicate.IKey != shadowIKey || !strings.Contains(duplicate.Name, strings.Replace(shadowIKey, "-", "", -1)) {
+		t.Errorf("Expected the copy to be addressed to the shadow, got %s %s", duplicate.IKey, duplicate.Name)
+	}
+}
+
+func TestShadowChannelCopiesData(t *testing.T) {
+	client, _, shadow := newShadowedClient(100, nil)
+
+	envelope := client.Context().envelop(NewTraceTelemetry("message", Information))
+	client.(*telemetryClient).shadow.Duplicate(envelope)
+	envelopeProperties(envelope)["added"] = "later"
+	envelope.Tags[contracts.OperationName] = "changed"
+
+	if _, ok := envelopeProperties(shadow.sentItems[0])["added"]; ok {
+		t.Error("Expected the copy's properties to be independent")
+	}
+	if shadow.sentItems[0].Tags[contracts.OperationName] == "changed" {
+		t.Error("Expected the copy's tags to be independent")
+	}
+}
+
+func TestShadowChannelPercentage(t *testing.T) {
+	client, _, shadow := newShadowedClient(50, nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx := WithCorrelationContext(context.Background(), NewCorrelationContext())
+		client.TrackTraceWithContext(ctx, "first", Information)
+		client.TrackTraceWithContext(ctx, "second", Information)
+	}
+
+	// Both items of a selected operation are duplicated
+	count := shadow.getSentCount()
+	if count%2 != 0 || count < 800 || count > 1200 {
+		t.Errorf("Expected about half of the operations to be duplicated, got %d items", count)
+	}
+}
+
+func TestShadowChannelEssentialTelemetryOnly(t *testing.T) {
+	client, _, shadow := newShadowedClient(100, nil)
+
+	SetEssentialTelemetryOnly(true)
+	defer SetEssentialTelemetryOnly(false)
+
+	client.TrackTrace("verbose", Information)
+	client.TrackRequest("GET", "https://example.com/", time.Second, "500")
+
+	if shadow.getSentCount() != 1 {
+		t.Fatalf("Expected only essential telemetry to be duplicated, got %d items", shadow.getSentCount())
+	}
+	if _, ok := shadow.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData); !ok {
+		t.Error("Expected the failed request to be duplicated")
+	}
+}
@@ -0,0 +1,73 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+)
+
+// SpanStatusProperty is set on spans and operations finished because their
+// context was done before they were finished explicitly.
+const SpanStatusProperty = "spanStatus"
+
+// Statuses of spans and operations finished when their context is done.
+// Operations also report the status as their response code.
+const (
+	// SpanStatusCanceled is reported when the context was canceled
+	SpanStatusCanceled = "canceled"
+
+	// SpanStatusTimeout is reported when the context's deadline passed
+	SpanStatusTimeout = "timeout"
+)
+
+// AutoFinish finishes the span as failed if ctx is canceled or reaches its
+// deadline before FinishSpan is called, so that early returns don't leave
+// the trace dangling.  The span's status is recorded in SpanStatusProperty.
+// Typically ctx is the context returned by StartSpan.
+//
+//	ctx, span := StartSpan(ctx, "export", client)
+//	span.AutoFinish(ctx)
+func (s *SpanContext) AutoFinish(ctx context.Context) {
+	if s == nil || ctx == nil || ctx.Done() == nil {
+		return
+	}
+
+	s.stopAutoFinish = context.AfterFunc(ctx, func() {
+		if s.finished.Swap(true) {
+			return
+		}
+
+		s.finish(context.WithoutCancel(ctx), false, map[string]string{
+			SpanStatusProperty: contextDoneStatus(ctx),
+		})
+	})
+}
+
+// AutoFinish finishes the operation as failed if ctx is canceled or reaches
+// its deadline before FinishOperation is called.  The operation's status is
+// recorded as its response code and in SpanStatusProperty.  Typically ctx is
+// the context returned by StartOperation.
+func (o *OperationContext) AutoFinish(ctx context.Context) {
+	if o == nil || ctx == nil || ctx.Done() == nil {
+		return
+	}
+
+	o.stopAutoFinish = context.AfterFunc(ctx, func() {
+		if o.finished.Swap(true) {
+			return
+		}
+
+		status := contextDoneStatus(ctx)
+		o.finish(context.WithoutCancel(ctx), status, false, "", map[string]string{
+			SpanStatusProperty: status,
+		})
+	})
+}
+
+// contextDoneStatus returns the status describing why ctx is done
+func contextDoneStatus(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return SpanStatusTimeout
+	}
+
+	return SpanStatusCanceled
+}
@@ -0,0 +1,89 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func waitForSentCount(testChannel *TestTelemetryChannel, count int) {
+	deadline := time.Now().Add(time.Second)
+	for testChannel.getSentCount() < count && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSpanAutoFinishCanceled(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	spanCtx, span := StartSpan(ctx, "export", client)
+	span.AutoFinish(spanCtx)
+
+	cancel()
+	waitForSentCount(testChannel, 1)
+
+	// Finishing after the span was auto-finished has no effect
+	span.FinishSpan(spanCtx, true, nil)
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected the span to be tracked once, got %d items", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	data := envelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if data.Success || data.Properties[SpanStatusProperty] != SpanStatusCanceled {
+		t.Errorf("Expected a canceled span, got success=%v status=%q", data.Success, data.Properties[SpanStatusProperty])
+	}
+	if data.Name != "export" || envelope.Tags[contracts.OperationId] != span.OperationID {
+		t.Errorf("Expected the span's own telemetry, got %s in %s", data.Name, envelope.Tags[contracts.OperationId])
+	}
+}
+
+func TestSpanAutoFinishNotTriggered(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	spanCtx, span := StartSpan(ctx, "export", client)
+	span.AutoFinish(spanCtx)
+
+	span.FinishSpan(spanCtx, true, nil)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected the span to be tracked once, got %d items", testChannel.getSentCount())
+	}
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if !data.Success || data.Properties[SpanStatusProperty] != "" {
+		t.Errorf("Expected the explicitly finished span, got success=%v status=%q", data.Success, data.Properties[SpanStatusProperty])
+	}
+
+	// Contexts that are never done are ignored
+	_, background := StartSpan(context.Background(), "background", client)
+	background.AutoFinish(context.Background())
+	var nilSpan *SpanContext
+	nilSpan.AutoFinish(ctx)
+}
+
+func TestOperationAutoFinishTimeout(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	opCtx, operation := StartOperation(ctx, "import", client)
+	operation.AutoFinish(opCtx)
+
+	waitForSentCount(testChannel, 1)
+	operation.FinishOperation(opCtx, "200", true, "", nil)
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected the operation to be tracked once, got %d items", testChannel.getSentCount())
+	}
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RequestData)
+	if data.Success || data.ResponseCode != SpanStatusTimeout || data.Properties[SpanStatusProperty] != SpanStatusTimeout {
+		t.Errorf("Expected a timed out operation, got success=%v code=%q", data.Success, data.ResponseCode)
+	}
+}
@@ -0,0 +1,88 @@
+package appinsights
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Maximum size of the creation stack recorded for each tracked span
+const spanLeakStackSize = 8192
+
+var spanLeakTimeout atomic.Int64
+
+// SetSpanLeakDetection enables detection of spans and operations that are
+// never finished.  While enabled, each span started with StartSpan or
+// StartOperation records the stack of the goroutine that started it, and
+// is reported through diagnostics if it isn't finished within timeout.  Spans
+// finished after being reported are reported again.  This is intended for
+// development, as capturing stacks is costly.  A timeout of zero disables
+// detection for spans started from then on.
+func SetSpanLeakDetection(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	if time.Duration(spanLeakTimeout.Swap(int64(timeout))) != timeout {
+		diagnosticsWriter.Printf("Span leak detection timeout: %s", timeout)
+	}
+}
+
+// spanLeak tracks an unfinished span while leak detection is enabled
+type spanLeak struct {
+	kind    string
+	name    string
+	started time.Time
+	timeout time.Duration
+	stack   []byte
+	timer   *time.Timer
+
+	reported atomic.Bool
+	finished atomic.Bool
+}
+
+// startSpanLeak starts tracking a span if leak detection is enabled.
+// Returns nil otherwise.
+func startSpanLeak(kind, name string) *spanLeak {
+	timeout := time.Duration(spanLeakTimeout.Load())
+	if timeout <= 0 {
+		return nil
+	}
+
+	// The stack's header identifies the goroutine that started the span
+	stack := make([]byte, spanLeakStackSize)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	leak := &spanLeak{
+		kind:    kind,
+		name:    name,
+		started: time.Now(),
+		timeout: timeout,
+		stack:   stack,
+	}
+	leak.timer = time.AfterFunc(timeout, leak.report)
+	return leak
+}
+
+func (leak *spanLeak) report() {
+	if leak.finished.Load() {
+		return
+	}
+
+	leak.reported.Store(true)
+	diagnosticsWriter.Printf("Span leak: %s %q was not finished within %s of being started by %s",
+		leak.kind, leak.name, leak.timeout, leak.stack)
+}
+
+// finish stops tracking the span.  Safe to call on nil and more than once.
+func (leak *spanLeak) finish() {
+	if leak == nil || leak.finished.Swap(true) {
+		return
+	}
+
+	leak.timer.Stop()
+	if leak.reported.Load() {
+		diagnosticsWriter.Printf("Span leak: %s %q finished %s after being started",
+			leak.kind, leak.name, time.Since(leak.started))
+	}
+}
@@ -0,0 +1,76 @@
+package appinsights
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpanLeakDetection(t *testing.T) {
+	var lock sync.Mutex
+	var messages []string
+	listener := NewDiagnosticsMessageListener(func(message string) error {
+		if strings.HasPrefix(message, "Span leak:") {
+			lock.Lock()
+			messages = append(messages, message)
+			lock.Unlock()
+		}
+		return nil
+	})
+	defer listener.Remove()
+
+	received := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), messages...)
+	}
+
+	client, _ := newTestClient()
+
+	SetSpanLeakDetection(20 * time.Millisecond)
+	defer SetSpanLeakDetection(0)
+
+	ctx := context.Background()
+	_, finished := StartSpan(ctx, "finished", client)
+	_, leaked := StartSpan(ctx, "leaked", client)
+	_, operation := StartOperation(ctx, "leakedOperation", client)
+	finished.FinishSpan(ctx, true, nil)
+
+	time.Sleep(60 * time.Millisecond)
+
+	reports := received()
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 leak reports, got %d: %v", len(reports), reports)
+	}
+
+	for _, report := range reports {
+		if strings.Contains(report, `"finished"`) {
+			t.Errorf("Finished span reported as leaked: %s", report)
+		}
+		if !strings.Contains(report, "goroutine ") || !strings.Contains(report, "TestSpanLeakDetection") {
+			t.Errorf("Expected the report to include the creation stack: %s", report)
+		}
+	}
+	if !strings.Contains(strings.Join(reports, "\n"), `span "leaked"`) {
+		t.Errorf("Expected the leaked span to be reported: %v", reports)
+	}
+	if !strings.Contains(strings.Join(reports, "\n"), `operation "leakedOperation"`) {
+		t.Errorf("Expected the leaked operation to be reported: %v", reports)
+	}
+
+	// Late finishes are reported once
+	leaked.FinishSpan(ctx, true, nil)
+	leaked.FinishSpan(ctx, true, nil)
+	operation.FinishOperation(ctx, "200", true, "", nil)
+	if reports := received(); len(reports) != 4 || !strings.Contains(reports[2], "finished") {
+		t.Errorf("Expected late finishes to be reported, got %v", reports)
+	}
+
+	// Spans started while disabled aren't tracked
+	SetSpanLeakDetection(0)
+	if _, span := StartSpan(ctx, "untracked", client); span.leak != nil {
+		t.Error("Expected no tracking while detection is disabled")
+	}
+}
@@ -0,0 +1,82 @@
+package appinsights
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SQLCommenter appends sqlcommenter-style comments carrying the trace
+// context to SQL statements, so that statements in database-side logs,
+// such as slow query logs, can be correlated with the dependency telemetry
+// tracked for them.  See https://google.github.io/sqlcommenter/spec/.
+type SQLCommenter struct {
+	// Additional key-value pairs added to every comment, e.g. the
+	// application or driver name
+	Tags map[string]string
+
+	// Whether to add the name of the current operation as the route tag
+	IncludeRoute bool
+}
+
+// NewSQLCommenter creates a commenter adding the trace context only.
+func NewSQLCommenter() *SQLCommenter {
+	return &SQLCommenter{}
+}
+
+// Comment returns query with a comment describing the span in ctx.  Queries
+// that already contain a comment are returned unchanged, as required by the
+// specification.
+func (commenter *SQLCommenter) Comment(ctx context.Context, query string) string {
+	if strings.Contains(query, "/*") || strings.Contains(query, "--") {
+		return query
+	}
+
+	tags := make(map[string]string, len(commenter.Tags)+2)
+	for k, v := range commenter.Tags {
+		tags[k] = v
+	}
+
+	if ctx != nil {
+		if corrCtx := GetCorrelationContext(ctx); corrCtx != nil && corrCtx.IsValid() {
+			tags["traceparent"] = corrCtx.ToW3CTraceParent()
+			if commenter.IncludeRoute && corrCtx.OperationName != "" {
+				tags["route"] = corrCtx.OperationName
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return query
+	}
+
+	// Keys are serialized in lexicographic order
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = sqlCommentEscape(k) + "='" + strings.ReplaceAll(sqlCommentEscape(tags[k]), "'", `\'`) + "'"
+	}
+
+	return strings.TrimRight(query, " \t\r\n;") + " /*" + strings.Join(pairs, ",") + "*/" + sqlStatementTerminator(query)
+}
+
+// sqlCommentEscape URL-encodes a key or value, encoding spaces as %20
+func sqlCommentEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// sqlStatementTerminator returns ";" if the query ends with one, so that the
+// comment is placed before it
+func sqlStatementTerminator(query string) string {
+	if strings.HasSuffix(strings.TrimRight(query, " \t\r\n"), ";") {
+		return ";"
+	}
+
+	return ""
+}
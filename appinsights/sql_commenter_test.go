@@ -0,0 +1,105 @@
+package appinsights
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+)
+
+// Driver recording the statements it prepares
+type recordingSQLDriver struct{}
+type recordingSQLConn struct{ fakeSQLConn }
+
+var (
+	recordedSQLLock    sync.Mutex
+	recordedStatements []string
+)
+
+func (recordingSQLDriver) Open(name string) (driver.Conn, error) { return recordingSQLConn{}, nil }
+
+func (recordingSQLConn) Prepare(query string) (driver.Stmt, error) {
+	recordedSQLLock.Lock()
+	recordedStatements = append(recordedStatements, query)
+	recordedSQLLock.Unlock()
+	return fakeSQLStmt{query}, nil
+}
+
+func init() {
+	sql.Register("appinsights-recording", recordingSQLDriver{})
+}
+
+func TestSQLCommenterComment(t *testing.T) {
+	corrCtx := &CorrelationContext{
+		TraceID:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:        "00f067aa0ba902b7",
+		TraceFlags:    1,
+		OperationName: "GET /orders/{id}",
+	}
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+
+	commenter := NewSQLCommenter()
+	commenter.Tags = map[string]string{"application": "order's service"}
+	commenter.IncludeRoute = true
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			"SELECT * FROM orders",
+			"SELECT * FROM orders /*application='order%27s%20service',route='GET%20%2Forders%2F%7Bid%7D',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/",
+		},
+		{
+			"DELETE FROM orders; ",
+			"DELETE FROM orders /*application='order%27s%20service',route='GET%20%2Forders%2F%7Bid%7D',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/;",
+		},
+		{"SELECT 1 /* existing */", "SELECT 1 /* existing */"},
+		{"SELECT 1 -- existing", "SELECT 1 -- existing"},
+	}
+
+	for _, test := range tests {
+		if commented := commenter.Comment(ctx, test.query); commented != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.query, test.expected, commented)
+		}
+	}
+
+	if commented := NewSQLCommenter().Comment(context.Background(), "SELECT 1"); commented != "SELECT 1" {
+		t.Errorf("Expected no comment without a span, got %q", commented)
+	}
+}
+
+func TestSQLTxCommenter(t *testing.T) {
+	db, err := sql.Open("appinsights-recording", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	client, testChannel := newTestClient()
+
+	tx, err := BeginSQLTx(WithCorrelationContext(context.Background(), NewCorrelationContext()), db, nil, "orders", client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	tx.Commenter = NewSQLCommenter()
+
+	recordedSQLLock.Lock()
+	recordedStatements = nil
+	recordedSQLLock.Unlock()
+
+	tx.ExecContext(tx.Context(), "UPDATE orders SET state = 1")
+	tx.Commit()
+
+	dependency := sqlDependency(testChannel.sentItems[0])
+	if dependency.Data != "UPDATE orders SET state = 1" {
+		t.Errorf("Expected the tracked statement without the comment, got %q", dependency.Data)
+	}
+
+	recordedSQLLock.Lock()
+	defer recordedSQLLock.Unlock()
+	expected := "UPDATE orders SET state = 1 /*traceparent='00-" + testChannel.sentItems[0].Tags["ai.operation.id"] + "-" + dependency.Id + "-00'*/"
+	if len(recordedStatements) != 1 || recordedStatements[0] != expected {
+		t.Errorf("Expected %q to be executed, got %q", expected, recordedStatements)
+	}
+}
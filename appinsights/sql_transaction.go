@@ -0,0 +1,269 @@
+package appinsights
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Outcomes reported in the ResultCode of SQL transaction dependencies
+const (
+	SQLTxCommitted  = "commit"
+	SQLTxRolledBack = "rollback"
+)
+
+// SQLTransactionName is the name of the InProc dependency tracked for each
+// instrumented SQL transaction.
+const SQLTransactionName = "SQL transaction"
+
+// Measurements recorded on SQL transaction dependencies, separating the time
+// spent waiting for a pooled connection from the time the database spent
+// executing, since pool saturation is a frequent source of hidden latency.
+const (
+	// SQLPoolWaitMeasurement is the time, in milliseconds, spent acquiring a
+	// connection from the database/sql pool
+	SQLPoolWaitMeasurement = "poolWaitMs"
+
+	// SQLExecutionMeasurement is the time, in milliseconds, spent beginning
+	// the transaction and executing its statements
+	SQLExecutionMeasurement = "executionMs"
+)
+
+// SQLTx wraps a sql.Tx so that statements executed within the transaction
+// are tracked as SQL dependencies grouped under a parent InProc dependency.
+// The parent is tracked when the transaction is committed or rolled back,
+// and reports the outcome, the number of statements, the total time the
+// transaction was open, and how much of it was spent waiting for a pooled
+// connection and executing statements.
+type SQLTx struct {
+	// The underlying transaction.  Statements executed on it directly are
+	// not tracked.
+	Tx *sql.Tx
+
+	// Commenter optionally adds the trace context of each statement to the
+	// SQL sent to the database.  Tracked dependencies record the statement
+	// without the comment.
+	Commenter *SQLCommenter
+
+	client ContextTracker
+	target string
+	ctx    context.Context
+	start  time.Time
+	conn   *sql.Conn
+
+	// Time spent waiting for the pool, and beginning and executing
+	poolWait  time.Duration
+	execution time.Duration
+
+	lock sync.Mutex
+	done bool
+
+	// Statement counts by owning span ID; the transaction span and any
+	// batch spans started within it
+	statements map[string]int
+}
+
+// BeginSQLTx starts a transaction on db and returns a wrapper that tracks
+// its statements as children of a transaction span derived from ctx.
+// Target identifies the database, typically "server | database".  The
+// transaction's connection is returned to the pool by Commit or Rollback,
+// which must be called on the wrapper rather than on Tx.
+func BeginSQLTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, target string, client ContextTracker) (*SQLTx, error) {
+	txCtx := WithChildSpan(ctx, SQLTransactionName)
+
+	// Acquire the connection separately so that waiting for the pool is
+	// distinguished from beginning the transaction
+	start := time.Now()
+	conn, err := db.Conn(txCtx)
+	if err != nil {
+		return nil, err
+	}
+	acquired := time.Now()
+
+	tx, err := conn.BeginTx(txCtx, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &SQLTx{
+		Tx:         tx,
+		client:     client,
+		target:     target,
+		ctx:        txCtx,
+		start:      start,
+		conn:       conn,
+		poolWait:   acquired.Sub(start),
+		execution:  time.Since(acquired),
+		statements: map[string]int{GetCorrelationContext(txCtx).SpanID: 0},
+	}, nil
+}
+
+// Context returns the context carrying the transaction span.
+func (tx *SQLTx) Context() context.Context {
+	return tx.ctx
+}
+
+// ExecContext executes a statement within the transaction and tracks it as
+// a SQL dependency.
+func (tx *SQLTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmtCtx, start := tx.startStatement(ctx)
+	result, err := tx.Tx.ExecContext(stmtCtx, tx.comment(stmtCtx, query), args...)
+	tx.trackStatement(stmtCtx, query, start, err)
+	return result, err
+}
+
+// QueryContext executes a query within the transaction and tracks it as a
+// SQL dependency.  Only the time taken to execute the query is recorded,
+// not the time spent reading rows.
+func (tx *SQLTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmtCtx, start := tx.startStatement(ctx)
+	rows, err := tx.Tx.QueryContext(stmtCtx, tx.comment(stmtCtx, query), args...)
+	tx.trackStatement(stmtCtx, query, start, err)
+	return rows, err
+}
+
+// QueryRowContext executes a query that is expected to return at most one
+// row within the transaction and tracks it as a SQL dependency.
+func (tx *SQLTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmtCtx, start := tx.startStatement(ctx)
+	row := tx.Tx.QueryRowContext(stmtCtx, tx.comment(stmtCtx, query), args...)
+	err := row.Err()
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	tx.trackStatement(stmtCtx, query, start, err)
+	return row
+}
+
+// Batch groups the statements executed by fn under an InProc dependency
+// with the specified name, nested within the transaction.  Statements must
+// be executed with the context passed to fn to be grouped.
+func (tx *SQLTx) Batch(ctx context.Context, name string, fn func(context.Context) error) error {
+	batchCtx := WithChildSpan(tx.parentContext(ctx), name)
+	spanID := GetCorrelationContext(batchCtx).SpanID
+
+	tx.lock.Lock()
+	tx.statements[spanID] = 0
+	tx.lock.Unlock()
+
+	start := time.Now()
+	err := fn(batchCtx)
+
+	tx.lock.Lock()
+	count := tx.statements[spanID]
+	tx.lock.Unlock()
+
+	dependency := NewInProcDependencyTelemetry(batchCtx, name, err == nil)
+	dependency.Target = tx.target
+	dependency.MarkTime(start, time.Now())
+	dependency.Measurements["statementCount"] = float64(count)
+	if err != nil {
+		dependency.Properties["error"] = err.Error()
+	}
+
+	tx.client.TrackWithContext(batchCtx, dependency)
+	return err
+}
+
+// Commit commits the transaction and tracks the transaction dependency.
+func (tx *SQLTx) Commit() error {
+	err := tx.Tx.Commit()
+	tx.finish(SQLTxCommitted, err)
+	return err
+}
+
+// Rollback aborts the transaction and tracks the transaction dependency.
+// Calling Rollback after Commit, as with a deferred Rollback, returns
+// sql.ErrTxDone without tracking the transaction a second time.
+func (tx *SQLTx) Rollback() error {
+	err := tx.Tx.Rollback()
+	tx.finish(SQLTxRolledBack, err)
+	return err
+}
+
+// parentContext returns ctx if it carries a span belonging to this
+// transaction; otherwise the transaction's own context.
+func (tx *SQLTx) parentContext(ctx context.Context) context.Context {
+	if ctx != nil {
+		if corrCtx := GetCorrelationContext(ctx); corrCtx != nil {
+			tx.lock.Lock()
+			_, ok := tx.statements[corrCtx.SpanID]
+			tx.lock.Unlock()
+			if ok {
+				return ctx
+			}
+		}
+	}
+
+	return tx.ctx
+}
+
+func (tx *SQLTx) startStatement(ctx context.Context) (context.Context, time.Time) {
+	parentCtx := tx.parentContext(ctx)
+	parentID := GetCorrelationContext(parentCtx).SpanID
+
+	tx.lock.Lock()
+	tx.statements[parentID]++
+	tx.lock.Unlock()
+
+	return WithChildSpan(parentCtx, ""), time.Now()
+}
+
+// comment applies the commenter, if any, to a statement
+func (tx *SQLTx) comment(ctx context.Context, query string) string {
+	if tx.Commenter == nil {
+		return query
+	}
+
+	return tx.Commenter.Comment(ctx, query)
+}
+
+func (tx *SQLTx) trackStatement(ctx context.Context, query string, start time.Time, err error) {
+	end := time.Now()
+
+	tx.lock.Lock()
+	tx.execution += end.Sub(start)
+	tx.lock.Unlock()
+
+	dependency := NewRemoteDependencyTelemetryWithContext(ctx, tx.target, DependencyTypeSQL, tx.target, err == nil)
+	dependency.Data = query
+	dependency.MarkTime(start, end)
+	if err != nil {
+		dependency.Properties["error"] = err.Error()
+	}
+
+	tx.client.TrackWithContext(ctx, dependency)
+}
+
+func (tx *SQLTx) finish(outcome string, err error) {
+	tx.lock.Lock()
+	if tx.done {
+		tx.lock.Unlock()
+		return
+	}
+	tx.done = true
+	count := 0
+	for _, n := range tx.statements {
+		count += n
+	}
+	execution := tx.execution
+	tx.lock.Unlock()
+
+	// Return the connection to the pool
+	tx.conn.Close()
+
+	dependency := NewInProcDependencyTelemetry(tx.ctx, SQLTransactionName, outcome == SQLTxCommitted && err == nil)
+	dependency.Target = tx.target
+	dependency.ResultCode = outcome
+	dependency.MarkTime(tx.start, time.Now())
+	dependency.Measurements["statementCount"] = float64(count)
+	dependency.Measurements[SQLPoolWaitMeasurement] = float64(tx.poolWait) / float64(time.Millisecond)
+	dependency.Measurements[SQLExecutionMeasurement] = float64(execution) / float64(time.Millisecond)
+	if err != nil {
+		dependency.Properties["error"] = err.Error()
+	}
+
+	tx.client.TrackWithContext(tx.ctx, dependency)
+}
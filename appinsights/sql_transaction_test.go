@@ -0,0 +1,241 @@
+package appinsights
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Minimal database/sql driver; statements containing "FAIL" return an error
+type fakeSQLDriver struct{}
+type fakeSQLConn struct{}
+type fakeSQLStmt struct{ query string }
+type fakeSQLRows struct{}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) { return fakeSQLConn{}, nil }
+
+func (fakeSQLConn) Prepare(query string) (driver.Stmt, error) { return fakeSQLStmt{query}, nil }
+func (fakeSQLConn) Close() error                              { return nil }
+func (fakeSQLConn) Begin() (driver.Tx, error)                 { return fakeSQLConn{}, nil }
+func (fakeSQLConn) Commit() error                             { return nil }
+func (fakeSQLConn) Rollback() error                           { return nil }
+
+func (s fakeSQLStmt) Close() error  { return nil }
+func (s fakeSQLStmt) NumInput() int { return -1 }
+func (s fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "FAIL") {
+		return nil, errors.New("statement failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "FAIL") {
+		return nil, errors.New("query failed")
+	}
+	return fakeSQLRows{}, nil
+}
+
+func (fakeSQLRows) Columns() []string              { return []string{"id"} }
+func (fakeSQLRows) Close() error                   { return nil }
+func (fakeSQLRows) Next(dest []driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("appinsights-fake", fakeSQLDriver{})
+}
+
+func newSQLTxTest(t *testing.T) (*sql.DB, TelemetryClient, *TestTelemetryChannel, *CorrelationContext, context.Context) {
+	db, err := sql.Open("appinsights-fake", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	return db, client, testChannel, corrCtx, WithCorrelationContext(context.Background(), corrCtx)
+}
+
+func sqlDependency(envelope *contracts.Envelope) *contracts.RemoteDependencyData {
+	return envelope.Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+}
+
+func TestSQLTxGroupsStatements(t *testing.T) {
+	db, client, testChannel, corrCtx, ctx := newSQLTxTest(t)
+	defer db.Close()
+
+	tx, err := BeginSQLTx(ctx, db, nil, "server | orders", client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO orders VALUES (1)"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM orders")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rows.Close()
+	if _, err := tx.ExecContext(ctx, "FAIL"); err == nil {
+		t.Error("Expected statement error")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if testChannel.getSentCount() != 4 {
+		t.Fatalf("Expected 3 statements and the transaction, got %d items", testChannel.getSentCount())
+	}
+
+	txEnvelope := testChannel.sentItems[3]
+	txData := sqlDependency(txEnvelope)
+	if txData.Name != SQLTransactionName || txData.Type != DependencyTypeInProc {
+		t.Errorf("Unexpected transaction dependency %s (%s)", txData.Name, txData.Type)
+	}
+	if txData.ResultCode != SQLTxCommitted || !txData.Success {
+		t.Errorf("Expected successful commit, got %s/%v", txData.ResultCode, txData.Success)
+	}
+	if txData.Measurements["statementCount"] != 3 {
+		t.Errorf("Expected 3 statements, got %v", txData.Measurements["statementCount"])
+	}
+	if txEnvelope.Tags[contracts.OperationParentId] != corrCtx.SpanID {
+		t.Error("Expected transaction to be a child of the caller's span")
+	}
+
+	for i, envelope := range testChannel.sentItems[:3] {
+		data := sqlDependency(envelope)
+		if data.Type != DependencyTypeSQL || data.Target != "server | orders" {
+			t.Errorf("Statement %d: unexpected dependency %s (%s)", i, data.Type, data.Target)
+		}
+		if envelope.Tags[contracts.OperationParentId] != txData.Id {
+			t.Errorf("Statement %d: expected parent %s, got %s", i, txData.Id, envelope.Tags[contracts.OperationParentId])
+		}
+		if envelope.Tags[contracts.OperationId] != corrCtx.GetOperationID() {
+			t.Errorf("Statement %d: expected to share the operation", i)
+		}
+	}
+
+	if failed := sqlDependency(testChannel.sentItems[2]); failed.Success || failed.Data != "FAIL" {
+		t.Errorf("Expected failed statement, got %+v", failed)
+	}
+}
+
+func TestSQLTxRollback(t *testing.T) {
+	db, client, testChannel, _, ctx := newSQLTxTest(t)
+	defer db.Close()
+
+	tx, err := BeginSQLTx(ctx, db, nil, "orders", client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tx.ExecContext(ctx, "DELETE FROM orders")
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := tx.Rollback(); err != sql.ErrTxDone {
+		t.Errorf("Expected ErrTxDone, got %v", err)
+	}
+
+	if testChannel.getSentCount() != 2 {
+		t.Fatalf("Expected the transaction to be tracked once, got %d items", testChannel.getSentCount())
+	}
+	if data := sqlDependency(testChannel.sentItems[1]); data.ResultCode != SQLTxRolledBack || data.Success {
+		t.Errorf("Expected unsuccessful rollback, got %s/%v", data.ResultCode, data.Success)
+	}
+}
+
+func TestSQLTxBatch(t *testing.T) {
+	db, client, testChannel, _, ctx := newSQLTxTest(t)
+	defer db.Close()
+
+	tx, err := BeginSQLTx(ctx, db, nil, "orders", client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	err = tx.Batch(ctx, "import lines", func(batchCtx context.Context) error {
+		tx.ExecContext(batchCtx, "INSERT INTO lines VALUES (1)")
+		tx.ExecContext(batchCtx, "INSERT INTO lines VALUES (2)")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	tx.ExecContext(ctx, "UPDATE orders SET lines = 2")
+	tx.Commit()
+
+	if testChannel.getSentCount() != 5 {
+		t.Fatalf("Expected 5 items, got %d", testChannel.getSentCount())
+	}
+
+	batch := sqlDependency(testChannel.sentItems[2])
+	txData := sqlDependency(testChannel.sentItems[4])
+	if batch.Name != "import lines" || batch.Measurements["statementCount"] != 2 {
+		t.Errorf("Unexpected batch dependency %s with %v statements", batch.Name, batch.Measurements["statementCount"])
+	}
+	if testChannel.sentItems[2].Tags[contracts.OperationParentId] != txData.Id {
+		t.Error("Expected batch to be a child of the transaction")
+	}
+	for i := 0; i < 2; i++ {
+		if testChannel.sentItems[i].Tags[contracts.OperationParentId] != batch.Id {
+			t.Errorf("Statement %d: expected to be a child of the batch", i)
+		}
+	}
+	if testChannel.sentItems[3].Tags[contracts.OperationParentId] != txData.Id {
+		t.Error("Expected statement outside the batch to be a child of the transaction")
+	}
+	if txData.Measurements["statementCount"] != 3 {
+		t.Errorf("Expected 3 statements in the transaction, got %v", txData.Measurements["statementCount"])
+	}
+}
+
+func TestSQLTxPoolWait(t *testing.T) {
+	db, client, testChannel, _, ctx := newSQLTxTest(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Hold the only connection so that the transaction waits for it
+	held, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.Close()
+	}()
+
+	tx, err := BeginSQLTx(ctx, db, nil, "orders", client)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	tx.ExecContext(ctx, "UPDATE orders SET total = 0")
+	tx.Commit()
+
+	txData := sqlDependency(testChannel.sentItems[1])
+	poolWait, ok := txData.Measurements[SQLPoolWaitMeasurement]
+	if !ok || poolWait < 40 {
+		t.Errorf("Expected the pool wait to be measured, got %v", poolWait)
+	}
+	execution, ok := txData.Measurements[SQLExecutionMeasurement]
+	if !ok || execution >= poolWait {
+		t.Errorf("Expected execution time to exclude the pool wait, got %v", execution)
+	}
+
+	// The connection is returned to the pool
+	if _, err := BeginSQLTx(ctx, db, nil, "orders", client); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if stats := db.Stats(); stats.InUse != 1 {
+		t.Errorf("Expected a single connection in use, got %d", stats.InUse)
+	}
+}
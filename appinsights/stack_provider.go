@@ -0,0 +1,263 @@
+package appinsights
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Maximum depth of the error chains searched for stacks
+const maxErrorChainDepth = 32
+
+// StackProvider is implemented by errors that carry the stack trace of where
+// they were created.  Exception telemetry tracked for such errors reports
+// the provided frames rather than the stack of the tracking call site.
+type StackProvider interface {
+	StackFrames() []*contracts.StackFrame
+}
+
+// RuntimeStack adapts program counters, as returned by runtime.Callers, to
+// a StackProvider.  Error types can capture one with CaptureRuntimeStack
+// when they are created and return its frames from StackFrames.
+type RuntimeStack []uintptr
+
+// CaptureRuntimeStack captures the stack of the calling goroutine, skipping
+// the specified number of frames above the caller.
+func CaptureRuntimeStack(skip int) RuntimeStack {
+	if skip < 0 {
+		skip = 0
+	}
+
+	stack := make([]uintptr, 64)
+	depth := runtime.Callers(skip+2, stack)
+	return RuntimeStack(stack[:depth])
+}
+
+// StackFrames returns the frames of the captured stack.
+func (stack RuntimeStack) StackFrames() []*contracts.StackFrame {
+	return stackFramesFromPCs(stack)
+}
+
+// stackProviderFunc adapts a function to a StackProvider
+type stackProviderFunc func() []*contracts.StackFrame
+
+func (f stackProviderFunc) StackFrames() []*contracts.StackFrame {
+	return f()
+}
+
+// PkgErrorsStack adapts errors created by github.com/pkg/errors, which
+// expose their stack through a StackTrace method returning a slice of
+// program counters.  The package is matched structurally rather than
+// imported.  Returns nil if err has no such method.
+func PkgErrorsStack(err error) StackProvider {
+	if err == nil {
+		return nil
+	}
+
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 ||
+		methodType.Out(0).Kind() != reflect.Slice || methodType.Out(0).Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	return stackProviderFunc(func() []*contracts.StackFrame {
+		trace := method.Call(nil)[0]
+		pcs := make([]uintptr, trace.Len())
+		for i := range pcs {
+			pcs[i] = uintptr(trace.Index(i).Uint())
+		}
+
+		return stackFramesFromPCs(pcs)
+	})
+}
+
+// XErrorsStack adapts errors created by golang.org/x/xerrors, whose frames
+// are only exposed through their detailed "%+v" formatting.  The frames of
+// every error in the formatted chain are returned, outermost first.
+// Returns nil if err has no FormatError method.
+func XErrorsStack(err error) StackProvider {
+	if err == nil || !reflect.ValueOf(err).MethodByName("FormatError").IsValid() {
+		return nil
+	}
+
+	return stackProviderFunc(func() []*contracts.StackFrame {
+		return parseFormattedStack(fmt.Sprintf("%+v", err))
+	})
+}
+
+// StackOf returns the richest stack trace carried by err or the errors it
+// wraps, or nil if there is none.  Errors implementing StackProvider or
+// ErrorWithStack are used directly; errors from github.com/pkg/errors and
+// golang.org/x/xerrors are adapted.  The stack with the most frames wins,
+// preferring inner errors on ties since they are closer to the origin.
+func StackOf(err interface{}) []*contracts.StackFrame {
+	e, ok := err.(error)
+	if !ok {
+		return nil
+	}
+
+	var richest []*contracts.StackFrame
+	var visit func(err error, depth int)
+	visit = func(err error, depth int) {
+		// Guard against cyclic chains
+		if err == nil || depth > maxErrorChainDepth {
+			return
+		}
+
+		if frames := errorStackFrames(err); len(frames) > 0 && len(frames) >= len(richest) {
+			richest = frames
+		}
+
+		for _, wrapped := range unwrapCauses(err) {
+			visit(wrapped, depth+1)
+		}
+	}
+
+	visit(e, 0)
+	return richest
+}
+
+// errorStackFrames returns the frames carried by a single error
+func errorStackFrames(err error) []*contracts.StackFrame {
+	switch e := err.(type) {
+	case StackProvider:
+		return e.StackFrames()
+	case ErrorWithStack:
+		return stackFramesFromPCs(e.StackTrace())
+	}
+
+	if provider := PkgErrorsStack(err); provider != nil {
+		return provider.StackFrames()
+	}
+
+	if provider := XErrorsStack(err); provider != nil {
+		return provider.StackFrames()
+	}
+
+	return nil
+}
+
+// unwrapCauses returns the errors wrapped by err through Unwrap, including
+// errors joined by errors.Join, or the Cause method used by
+// github.com/pkg/errors
+func unwrapCauses(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	case interface{ Unwrap() error }:
+		return []error{e.Unwrap()}
+	case ErrorWithCause:
+		if cause := e.Cause(); cause != err {
+			return []error{cause}
+		}
+	}
+
+	return nil
+}
+
+// stackFramesFromPCs resolves program counters into stack frames
+func stackFramesFromPCs(pcs []uintptr) []*contracts.StackFrame {
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var stackFrames []*contracts.StackFrame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		stackFrames = append(stackFrames, newStackFrame(len(stackFrames), frame.Function, frame.File, frame.Line))
+
+		if !more {
+			break
+		}
+	}
+
+	return stackFrames
+}
+
+// newStackFrame creates a stack frame, splitting the fully qualified
+// function name into assembly and method
+func newStackFrame(level int, function, file string, line int) *contracts.StackFrame {
+	stackFrame := &contracts.StackFrame{
+		Level:    level,
+		Method:   function,
+		FileName: file,
+		Line:     line,
+	}
+
+	lastSlash := strings.LastIndexByte(function, '/')
+	if lastSlash < 0 {
+		lastSlash = 0
+	}
+
+	if firstDot := strings.IndexByte(function[lastSlash:], '.'); firstDot >= 0 {
+		stackFrame.Assembly = function[:lastSlash+firstDot]
+		stackFrame.Method = function[lastSlash+firstDot+1:]
+	}
+
+	return stackFrame
+}
+
+// parseFormattedStack extracts the frames from stack traces formatted as a
+// function name followed by an indented "file:line" line, as printed by
+// github.com/pkg/errors and golang.org/x/xerrors.  Other lines, such as
+// error messages, are skipped.
+func parseFormattedStack(text string) []*contracts.StackFrame {
+	lines := strings.Split(text, "\n")
+
+	var stackFrames []*contracts.StackFrame
+	for i := 0; i+1 < len(lines); i++ {
+		function := strings.TrimSpace(lines[i])
+		if function == "" || strings.ContainsAny(function, " \t") {
+			continue
+		}
+
+		location := lines[i+1]
+		if indentWidth(location) <= indentWidth(lines[i]) {
+			continue
+		}
+
+		location = strings.TrimSpace(location)
+		colon := strings.LastIndexByte(location, ':')
+		if colon <= 0 {
+			continue
+		}
+
+		line, err := strconv.Atoi(location[colon+1:])
+		if err != nil {
+			continue
+		}
+
+		stackFrames = append(stackFrames, newStackFrame(len(stackFrames), function, location[:colon], line))
+		i++
+	}
+
+	return stackFrames
+}
+
+// indentWidth returns the width of a line's leading whitespace, counting tabs as
+// eight columns
+func indentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 8
+		default:
+			return width
+		}
+	}
+
+	return width
+}
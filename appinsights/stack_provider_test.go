@@ -0,0 +1,128 @@
+package appinsights
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// pkgErrorsFrame and pkgErrorsStackTrace mirror the types of
+// github.com/pkg/errors
+type pkgErrorsFrame uintptr
+type pkgErrorsStackTrace []pkgErrorsFrame
+
+type pkgErrorsError struct {
+	msg   string
+	stack []uintptr
+}
+
+func newPkgErrorsError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	return &pkgErrorsError{msg: msg, stack: pcs[:n]}
+}
+
+func (e *pkgErrorsError) Error() string { return e.msg }
+
+func (e *pkgErrorsError) StackTrace() pkgErrorsStackTrace {
+	trace := make(pkgErrorsStackTrace, len(e.stack))
+	for i, pc := range e.stack {
+		trace[i] = pkgErrorsFrame(pc)
+	}
+	return trace
+}
+
+// xerrorsError formats like an error wrapped with golang.org/x/xerrors
+type xerrorsError struct {
+	msg string
+	err error
+}
+
+func (e *xerrorsError) Error() string { return e.msg + ": " + e.err.Error() }
+
+func (e *xerrorsError) Unwrap() error { return e.err }
+
+func (e *xerrorsError) FormatError(p interface{}) error { return e.err }
+
+func (e *xerrorsError) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, "%s:\n    main.load\n        /src/app/main.go:42\n  - open failed:\n    github.com/example/app/store.open\n        /src/app/store/file.go:7\n  - %s",
+		e.msg, e.err.Error())
+}
+
+// providedStackError supplies its own frames
+type providedStackError struct{}
+
+func (providedStackError) Error() string { return "provided" }
+
+func (providedStackError) StackFrames() []*contracts.StackFrame {
+	return []*contracts.StackFrame{{Method: "handler", FileName: "handler.go", Line: 3}}
+}
+
+func TestCaptureRuntimeStack(t *testing.T) {
+	frames := CaptureRuntimeStack(0).StackFrames()
+	if len(frames) == 0 {
+		t.Fatal("Expected frames")
+	}
+	if frames[0].Method != "TestCaptureRuntimeStack" || !strings.HasSuffix(frames[0].FileName, "stack_provider_test.go") {
+		t.Errorf("Unexpected top frame: %s %s", frames[0].Method, frames[0].FileName)
+	}
+}
+
+func TestStackOfPkgErrors(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", newPkgErrorsError("boom"))
+
+	frames := StackOf(err)
+	if len(frames) == 0 {
+		t.Fatal("Expected frames from the wrapped error")
+	}
+	if frames[0].Method != "TestStackOfPkgErrors" {
+		t.Errorf("Expected the stack of where the error was created, got %s", frames[0].Method)
+	}
+
+	if StackOf(errors.New("plain")) != nil || StackOf("string") != nil {
+		t.Error("Expected no stack for errors that don't carry one")
+	}
+}
+
+func TestStackOfXErrors(t *testing.T) {
+	frames := StackOf(&xerrorsError{msg: "load config", err: errors.New("not found")})
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(frames))
+	}
+
+	if frames[0].Assembly != "main" || frames[0].Method != "load" || frames[0].FileName != "/src/app/main.go" || frames[0].Line != 42 {
+		t.Errorf("Unexpected first frame: %+v", frames[0])
+	}
+	if frames[1].Assembly != "github.com/example/app/store" || frames[1].Method != "open" || frames[1].Level != 1 {
+		t.Errorf("Unexpected second frame: %+v", frames[1])
+	}
+}
+
+func TestStackOfRichest(t *testing.T) {
+	// The provider's single frame loses to the pkg/errors stack
+	err := fmt.Errorf("%w: %w", providedStackError{}, newPkgErrorsError("boom"))
+	if frames := StackOf(err); len(frames) == 0 {
+		t.Fatal("Expected frames")
+	}
+
+	frames := StackOf(fmt.Errorf("wrapped: %w", providedStackError{}))
+	if len(frames) != 1 || frames[0].Method != "handler" {
+		t.Errorf("Expected the provided frames, got %v", frames)
+	}
+}
+
+func TestExceptionTelemetryUsesErrorStack(t *testing.T) {
+	telem := NewExceptionTelemetry(providedStackError{})
+	if len(telem.Frames) != 1 || telem.Frames[0].FileName != "handler.go" {
+		t.Errorf("Expected the error's own stack, got %v", telem.Frames)
+	}
+
+	telem = NewExceptionTelemetry(errors.New("plain"))
+	if len(telem.Frames) == 0 || telem.Frames[0].Method != "TestExceptionTelemetryUsesErrorStack" {
+		t.Error("Expected the call site stack for errors without one")
+	}
+}
@@ -0,0 +1,262 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StructTagName is the struct tag used to map struct fields to telemetry
+// properties and measurements.  The tag value is a name optionally followed
+// by comma-separated options:
+//
+//	Field int `ai:"name"`                   // property "name"
+//	Field int `ai:"name,measurement"`       // measurement "name"
+//	Field int `ai:",omitempty"`             // property "Field", omitted if zero
+//	Field int `ai:"-"`                      // ignored
+//
+// Untagged exported fields are recorded as properties named after the field.
+// Fields of embedded structs are flattened into the parent.  Nil pointers
+// are always omitted.  Measurements must be numeric, or a time.Duration,
+// which is recorded in milliseconds.
+const StructTagName = "ai"
+
+// structField describes how a single struct field is mapped
+type structField struct {
+	index       []int
+	name        string
+	measurement bool
+	omitEmpty   bool
+}
+
+// Field mappings, cached by type
+var structFieldCache sync.Map
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// NewEventTelemetryFromStruct creates an event telemetry item whose
+// properties and measurements are populated from the fields of v, which
+// must be a struct or a pointer to one.  See StructTagName for the mapping
+// rules.
+func NewEventTelemetryFromStruct(name string, v interface{}) (*EventTelemetry, error) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, fmt.Errorf("appinsights: cannot map nil %s", value.Type())
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("appinsights: cannot map %s, expected a struct", value.Type())
+	}
+
+	fields, err := structFieldsFor(value.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	event := NewEventTelemetry(name)
+	for _, field := range fields {
+		fv, ok := fieldByIndex(value, field.index)
+		if !ok || (field.omitEmpty && fv.IsZero()) {
+			continue
+		}
+
+		if field.measurement {
+			event.Measurements[field.name] = measurementValue(fv)
+		} else {
+			event.Properties[field.name] = propertyValue(fv)
+		}
+	}
+
+	return event, nil
+}
+
+// TrackStruct tracks a custom event whose properties and measurements are
+// populated from the fields of v using the correlation context found on
+// ctx.  See StructTagName for the mapping rules.
+func TrackStruct(ctx context.Context, name string, v interface{}, client ContextTracker) error {
+	event, err := NewEventTelemetryFromStruct(name, v)
+	if err != nil {
+		return err
+	}
+
+	client.TrackWithContext(ctx, event)
+	return nil
+}
+
+// structFieldsFor returns the cached field mappings for a struct type
+func structFieldsFor(t reflect.Type) ([]structField, error) {
+	if cached, ok := structFieldCache.Load(t); ok {
+		return cached.([]structField), nil
+	}
+
+	fields, err := buildStructFields(t, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	structFieldCache.Store(t, fields)
+	return fields, nil
+}
+
+// buildStructFields computes the field mappings for a struct type
+func buildStructFields(t reflect.Type, parentIndex []int) ([]structField, error) {
+	var fields []structField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(StructTagName)
+		if tag == "-" {
+			continue
+		}
+
+		index := append(append([]int(nil), parentIndex...), i)
+
+		// Flatten untagged embedded structs
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			embedded, err := buildStructFields(ft, index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		field := structField{
+			index: index,
+			name:  parts[0],
+		}
+		if field.name == "" {
+			field.name = sf.Name
+		}
+
+		for _, option := range parts[1:] {
+			switch option {
+			case "measurement":
+				field.measurement = true
+			case "omitempty":
+				field.omitEmpty = true
+			default:
+				return nil, fmt.Errorf("appinsights: unknown option %q on field %s.%s", option, t.Name(), sf.Name)
+			}
+		}
+
+		if field.measurement && !isNumericType(ft) {
+			return nil, fmt.Errorf("appinsights: field %s.%s of type %s cannot be a measurement", t.Name(), sf.Name, sf.Type)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// fieldByIndex returns the field at the specified index, dereferencing
+// pointers.  Returns false if a nil pointer is encountered.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		// Prefer the pointer's own String method, if any
+		if !v.Type().Implements(stringerType) {
+			v = v.Elem()
+		}
+	}
+
+	return v, true
+}
+
+func isNumericType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// measurementValue converts a numeric field to a measurement
+func measurementValue(v reflect.Value) float64 {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Type() == durationType {
+		return float64(time.Duration(v.Int())) / float64(time.Millisecond)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// propertyValue formats a field as a property value
+func propertyValue(v reflect.Value) string {
+	// Fields promoted from unexported embedded structs cannot be accessed
+	// through Interface, but their values can still be formatted
+	if !v.CanInterface() {
+		return fmt.Sprint(v)
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,145 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+type orderAudit struct {
+	TenantID string
+}
+
+type orderPlaced struct {
+	orderAudit
+
+	OrderID  string        `ai:"orderId"`
+	Total    float64       `ai:"total,measurement"`
+	Items    int           `ai:"itemCount,measurement"`
+	Latency  time.Duration `ai:"latency,measurement"`
+	Coupon   string        `ai:"coupon,omitempty"`
+	Express  bool
+	PlacedAt time.Time `ai:"placedAt"`
+	Priority *int      `ai:"priority,measurement"`
+	Secret   string    `ai:"-"`
+	internal string
+}
+
+func TestNewEventTelemetryFromStruct(t *testing.T) {
+	placed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	event, err := NewEventTelemetryFromStruct("OrderPlaced", &orderPlaced{
+		orderAudit: orderAudit{TenantID: "contoso"},
+		OrderID:    "o-1",
+		Total:      42.5,
+		Items:      3,
+		Latency:    1500 * time.Millisecond,
+		Express:    true,
+		PlacedAt:   placed,
+		Secret:     "hunter2",
+		internal:   "x",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if event.Name != "OrderPlaced" {
+		t.Errorf("Unexpected event name %q", event.Name)
+	}
+
+	expectedProperties := map[string]string{
+		"TenantID": "contoso",
+		"orderId":  "o-1",
+		"Express":  "true",
+		"placedAt": "2024-03-01T12:00:00Z",
+	}
+	if len(event.Properties) != len(expectedProperties) {
+		t.Errorf("Unexpected properties: %v", event.Properties)
+	}
+	for k, v := range expectedProperties {
+		if event.Properties[k] != v {
+			t.Errorf("Property %s: expected %q, got %q", k, v, event.Properties[k])
+		}
+	}
+
+	expectedMeasurements := map[string]float64{
+		"total":     42.5,
+		"itemCount": 3,
+		"latency":   1500,
+	}
+	if len(event.Measurements) != len(expectedMeasurements) {
+		t.Errorf("Unexpected measurements: %v", event.Measurements)
+	}
+	for k, v := range expectedMeasurements {
+		if event.Measurements[k] != v {
+			t.Errorf("Measurement %s: expected %v, got %v", k, v, event.Measurements[k])
+		}
+	}
+}
+
+func TestNewEventTelemetryFromStructPointerFields(t *testing.T) {
+	priority := 7
+	event, err := NewEventTelemetryFromStruct("OrderPlaced", orderPlaced{Priority: &priority, Coupon: "SAVE10"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if event.Measurements["priority"] != 7 {
+		t.Errorf("Expected dereferenced pointer measurement, got %v", event.Measurements["priority"])
+	}
+	if event.Properties["coupon"] != "SAVE10" {
+		t.Errorf("Expected non-empty omitempty field, got %q", event.Properties["coupon"])
+	}
+}
+
+func TestNewEventTelemetryFromStructErrors(t *testing.T) {
+	type badMeasurement struct {
+		Name string `ai:"name,measurement"`
+	}
+	type badOption struct {
+		Name string `ai:"name,bogus"`
+	}
+
+	var nilPtr *orderPlaced
+	tests := map[string]interface{}{
+		"nil pointer":       nilPtr,
+		"not a struct":      42,
+		"bad measurement":   badMeasurement{},
+		"unknown tag value": badOption{},
+	}
+
+	for name, v := range tests {
+		if _, err := NewEventTelemetryFromStruct("event", v); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTrackStruct(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+
+	if err := TrackStruct(ctx, "OrderPlaced", orderPlaced{OrderID: "o-2", Total: 10}, client); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := TrackStruct(ctx, "Invalid", "not a struct", client); err == nil {
+		t.Error("Expected an error for a non-struct value")
+	}
+
+	if testChannel.getSentCount() != 1 {
+		t.Fatalf("Expected 1 item, got %d", testChannel.getSentCount())
+	}
+
+	envelope := testChannel.sentItems[0]
+	if envelope.Tags[contracts.OperationId] != corrCtx.GetOperationID() {
+		t.Error("Expected event to be correlated with the operation")
+	}
+
+	data := envelope.Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if data.Properties["orderId"] != "o-2" || data.Measurements["total"] != 10 {
+		t.Errorf("Unexpected event data: %v %v", data.Properties, data.Measurements)
+	}
+}
@@ -0,0 +1,173 @@
+package appinsights
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultTDigestCompression balances accuracy and memory for latency
+// percentiles: digests keep at most a few hundred centroids, and estimates
+// of extreme percentiles such as p99 are typically within a fraction of a
+// percent.
+const DefaultTDigestCompression = 100
+
+// TDigest estimates quantiles of a stream of values in bounded memory,
+// using the merging t-digest of Dunning and Ertl.  Values are clustered
+// into centroids that are small near the tails of the distribution, so
+// extreme quantiles remain accurate.  A TDigest is not safe for concurrent
+// use.
+type TDigest struct {
+	compression float64
+	centroids   []tdigestCentroid
+	buffer      []tdigestCentroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+type tdigestCentroid struct {
+	mean   float64
+	weight float64
+}
+
+// NewTDigest creates an empty digest with the specified compression; higher
+// values trade memory for accuracy.  Non-positive values select
+// DefaultTDigestCompression.
+func NewTDigest(compression float64) *TDigest {
+	if compression <= 0 {
+		compression = DefaultTDigestCompression
+	}
+
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add records a value.
+func (d *TDigest) Add(value float64) {
+	d.AddWeighted(value, 1)
+}
+
+// AddWeighted records a value occurring weight times.  NaN values and
+// non-positive weights are ignored.
+func (d *TDigest) AddWeighted(value, weight float64) {
+	if math.IsNaN(value) || weight <= 0 {
+		return
+	}
+
+	d.buffer = append(d.buffer, tdigestCentroid{mean: value, weight: weight})
+	d.count += weight
+	d.min = math.Min(d.min, value)
+	d.max = math.Max(d.max, value)
+
+	if len(d.buffer) >= int(d.compression)*5 {
+		d.compress()
+	}
+}
+
+// Merge adds the values recorded by other to this digest.
+func (d *TDigest) Merge(other *TDigest) {
+	if other == nil || other.count == 0 {
+		return
+	}
+
+	for _, c := range other.centroids {
+		d.AddWeighted(c.mean, c.weight)
+	}
+	for _, c := range other.buffer {
+		d.AddWeighted(c.mean, c.weight)
+	}
+
+	// Keep the exact extremes rather than those of other's centroids
+	d.min = math.Min(d.min, other.min)
+	d.max = math.Max(d.max, other.max)
+}
+
+// Count returns the total weight of the recorded values.
+func (d *TDigest) Count() float64 {
+	return d.count
+}
+
+// Quantile estimates the qth quantile (0-1) of the recorded values.  It
+// returns NaN if no values were recorded.
+func (d *TDigest) Quantile(q float64) float64 {
+	if d.count == 0 {
+		return math.NaN()
+	}
+
+	d.compress()
+	if q <= 0 {
+		return d.min
+	}
+	if q >= 1 {
+		return d.max
+	}
+
+	// Each centroid's mean is placed at the center of its weight, with the
+	// minimum and maximum at either end
+	index := q * d.count
+	first := d.centroids[0]
+	if index < first.weight/2 {
+		return d.min + index/(first.weight/2)*(first.mean-d.min)
+	}
+
+	cumulative := first.weight / 2
+	for i := 1; i < len(d.centroids); i++ {
+		previous, current := d.centroids[i-1], d.centroids[i]
+		step := (previous.weight + current.weight) / 2
+		if index < cumulative+step {
+			return previous.mean + (index-cumulative)/step*(current.mean-previous.mean)
+		}
+		cumulative += step
+	}
+
+	last := d.centroids[len(d.centroids)-1]
+	remaining := last.weight / 2
+	return last.mean + math.Min(1, (index-cumulative)/remaining)*(d.max-last.mean)
+}
+
+// compress merges buffered values into the centroids
+func (d *TDigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	all := append(d.centroids, d.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]tdigestCentroid, 0, len(d.centroids)+1)
+	current := all[0]
+	completed := 0.0
+	limit := d.quantileLimit(0)
+
+	for _, c := range all[1:] {
+		if (completed+current.weight+c.weight)/d.count <= limit {
+			current.weight += c.weight
+			current.mean += (c.mean - current.mean) * c.weight / current.weight
+			continue
+		}
+
+		merged = append(merged, current)
+		completed += current.weight
+		limit = d.quantileLimit(completed / d.count)
+		current = c
+	}
+
+	d.centroids = append(merged, current)
+	d.buffer = d.buffer[:0]
+}
+
+// quantileLimit returns the largest quantile a centroid starting at q may
+// reach, using the k1 scale function k(q) = δ/2π·asin(2q-1), which allows
+// a centroid to span one unit of k.
+func (d *TDigest) quantileLimit(q float64) float64 {
+	k := d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+	next := (k + 1) * 2 * math.Pi / d.compression
+	if next >= math.Pi/2 {
+		return 1
+	}
+
+	return (math.Sin(next) + 1) / 2
+}
@@ -0,0 +1,105 @@
+package appinsights
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// exactQuantile returns the qth quantile of sorted values
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[int(math.Min(float64(len(sorted)-1), q*float64(len(sorted))))]
+}
+
+func TestTDigestAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	distributions := map[string]func() float64{
+		"uniform":     func() float64 { return r.Float64() * 1000 },
+		"exponential": func() float64 { return r.ExpFloat64() * 50 },
+		"lognormal":   func() float64 { return math.Exp(r.NormFloat64()) * 20 },
+	}
+
+	for name, sample := range distributions {
+		digest := NewTDigest(0)
+		values := make([]float64, 100000)
+		for i := range values {
+			values[i] = sample()
+			digest.Add(values[i])
+		}
+		sort.Float64s(values)
+
+		for _, q := range []float64{0.5, 0.9, 0.95, 0.99, 0.999} {
+			expected := exactQuantile(values, q)
+			estimate := digest.Quantile(q)
+
+			// Compare ranks, which is how t-digest accuracy is defined
+			rank := float64(sort.SearchFloat64s(values, estimate)) / float64(len(values))
+			if math.Abs(rank-q) > 0.005 {
+				t.Errorf("%s q=%v: expected ~%v, got %v (rank %v)", name, q, expected, estimate, rank)
+			}
+		}
+
+		if digest.Quantile(0) != values[0] || digest.Quantile(1) != values[len(values)-1] {
+			t.Errorf("%s: expected exact extremes", name)
+		}
+		if digest.Count() != float64(len(values)) {
+			t.Errorf("%s: expected count %d, got %v", name, len(values), digest.Count())
+		}
+		if len(digest.centroids) > 2*DefaultTDigestCompression {
+			t.Errorf("%s: expected bounded centroids, got %d", name, len(digest.centroids))
+		}
+	}
+}
+
+func TestTDigestSmallAndEmpty(t *testing.T) {
+	digest := NewTDigest(0)
+	if !math.IsNaN(digest.Quantile(0.5)) {
+		t.Error("Expected NaN for an empty digest")
+	}
+
+	digest.Add(42)
+	for _, q := range []float64{0, 0.5, 0.99, 1} {
+		if v := digest.Quantile(q); v != 42 {
+			t.Errorf("q=%v: expected 42, got %v", q, v)
+		}
+	}
+
+	digest = NewTDigest(0)
+	for _, v := range []float64{1, 2, 3, 4, 5} {
+		digest.Add(v)
+	}
+	if median := digest.Quantile(0.5); median != 3 {
+		t.Errorf("Expected median 3, got %v", median)
+	}
+
+	digest.Add(math.NaN())
+	digest.AddWeighted(10, 0)
+	if digest.Count() != 5 {
+		t.Errorf("Expected NaN and zero weights to be ignored, got count %v", digest.Count())
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	a, b := NewTDigest(0), NewTDigest(0)
+	values := make([]float64, 0, 20000)
+	for i := 0; i < 10000; i++ {
+		x, y := r.Float64()*100, 100+r.Float64()*100
+		a.Add(x)
+		b.Add(y)
+		values = append(values, x, y)
+	}
+	sort.Float64s(values)
+
+	a.Merge(b)
+	if a.Count() != 20000 {
+		t.Fatalf("Expected count 20000, got %v", a.Count())
+	}
+	for _, q := range []float64{0.25, 0.5, 0.75, 0.99} {
+		if estimate, expected := a.Quantile(q), exactQuantile(values, q); math.Abs(estimate-expected) > 2 {
+			t.Errorf("q=%v: expected ~%v, got %v", q, expected, estimate)
+		}
+	}
+}
@@ -166,6 +166,10 @@ func (event *EventTelemetry) TelemetryData() TelemetryData {
 	return data
 }
 
+// MetricUnitProperty is the custom property carrying the unit of a metric,
+// which the data point schema has no field for.
+const MetricUnitProperty = "unit"
+
 // Metric telemetry items each represent a single data point.
 type MetricTelemetry struct {
 	BaseTelemetry
@@ -176,6 +180,12 @@ type MetricTelemetry struct {
 
 	// Sampled value
 	Value float64
+
+	// Optional namespace under which the metric is organized
+	Namespace string
+
+	// Optional unit of the value, such as "ms", "By" or "%"
+	Unit string
 }
 
 // Creates a metric telemetry sample with the specified name and value.
@@ -193,6 +203,7 @@ func NewMetricTelemetry(name string, value float64) *MetricTelemetry {
 
 func (metric *MetricTelemetry) TelemetryData() TelemetryData {
 	dataPoint := contracts.NewDataPoint()
+	dataPoint.Ns = metric.Namespace
 	dataPoint.Name = metric.Name
 	dataPoint.Value = metric.Value
 	dataPoint.Count = 1
@@ -200,11 +211,27 @@ func (metric *MetricTelemetry) TelemetryData() TelemetryData {
 
 	data := contracts.NewMetricData()
 	data.Metrics = []*contracts.DataPoint{dataPoint}
-	data.Properties = metric.Properties
+	data.Properties = metricProperties(metric.Properties, metric.Unit)
 
 	return data
 }
 
+// metricProperties returns the properties of a metric with its unit added,
+// leaving the item's own map unchanged.
+func metricProperties(properties map[string]string, unit string) map[string]string {
+	if unit == "" {
+		return properties
+	}
+
+	result := make(map[string]string, len(properties)+1)
+	for k, v := range properties {
+		result[k] = v
+	}
+
+	result[MetricUnitProperty] = unit
+	return result
+}
+
 // Aggregated metric telemetry items represent an aggregation of data points
 // over time. These values can be calculated by the caller or with the AddData
 // function.
@@ -234,6 +261,12 @@ type AggregateMetricTelemetry struct {
 	// either this or the StdDev should be zero at any given time.
 	// If both are non-zero then StdDev takes precedence.
 	Variance float64
+
+	// Optional namespace under which the metric is organized
+	Namespace string
+
+	// Optional unit of the values, such as "ms", "By" or "%"
+	Unit string
 }
 
 // Creates a new aggregated metric telemetry item with the specified name.
@@ -326,7 +359,16 @@ func (agg *AggregateMetricTelemetry) addData(values []float64, vsum float64) flo
 }
 
 func (agg *AggregateMetricTelemetry) TelemetryData() TelemetryData {
+	data := contracts.NewMetricData()
+	data.Metrics = []*contracts.DataPoint{agg.dataPoint()}
+	data.Properties = metricProperties(agg.Properties, agg.Unit)
+
+	return data
+}
+
+func (agg *AggregateMetricTelemetry) dataPoint() *contracts.DataPoint {
 	dataPoint := contracts.NewDataPoint()
+	dataPoint.Ns = agg.Namespace
 	dataPoint.Name = agg.Name
 	dataPoint.Value = agg.Value
 	dataPoint.Kind = contracts.Aggregation
@@ -340,9 +382,70 @@ func (agg *AggregateMetricTelemetry) TelemetryData() TelemetryData {
 		dataPoint.StdDev = math.Sqrt(agg.Variance)
 	}
 
+	return dataPoint
+}
+
+// Multi-metric telemetry items carry several data points in a single
+// envelope, each of which is either a single measurement or an aggregation.
+// Metrics aggregated outside of the SDK can be forwarded as-is by setting
+// the Kind, Count, Min, Max and StdDev of each data point.
+type MultiMetricTelemetry struct {
+	BaseTelemetry
+	BaseTelemetryNoMeasurements
+
+	// Data points submitted in this item
+	DataPoints []*contracts.DataPoint
+}
+
+// Creates a new, empty multi-metric telemetry item.  Data points should be
+// added to the object returned before submission.
+func NewMultiMetricTelemetry() *MultiMetricTelemetry {
+	return &MultiMetricTelemetry{
+		BaseTelemetry: BaseTelemetry{
+			Timestamp:  currentClock.Now(),
+			Tags:       make(contracts.ContextTags),
+			Properties: make(map[string]string),
+		},
+	}
+}
+
+// Adds a single measurement with the specified name and value.
+func (multi *MultiMetricTelemetry) AddMeasurement(name string, value float64) {
+	dataPoint := contracts.NewDataPoint()
+	dataPoint.Name = name
+	dataPoint.Value = value
+	dataPoint.Count = 1
+	dataPoint.Kind = contracts.Measurement
+
+	multi.DataPoints = append(multi.DataPoints, dataPoint)
+}
+
+// Adds a pre-aggregated data point with the specified name, sum of
+// measurements, count, minimum, maximum, and standard deviation.
+func (multi *MultiMetricTelemetry) AddAggregation(name string, sum float64, count int, min, max, stdDev float64) {
+	dataPoint := contracts.NewDataPoint()
+	dataPoint.Name = name
+	dataPoint.Value = sum
+	dataPoint.Count = count
+	dataPoint.Min = min
+	dataPoint.Max = max
+	dataPoint.StdDev = stdDev
+	dataPoint.Kind = contracts.Aggregation
+
+	multi.DataPoints = append(multi.DataPoints, dataPoint)
+}
+
+// Adds the data point of an aggregated metric telemetry item.  The item's
+// properties are not copied.
+func (multi *MultiMetricTelemetry) AddAggregateMetric(agg *AggregateMetricTelemetry) {
+	multi.DataPoints = append(multi.DataPoints, agg.dataPoint())
+}
+
+func (multi *MultiMetricTelemetry) TelemetryData() TelemetryData {
 	data := contracts.NewMetricData()
-	data.Metrics = []*contracts.DataPoint{dataPoint}
-	data.Properties = agg.Properties
+	data.Metrics = make([]*contracts.DataPoint, len(multi.DataPoints))
+	copy(data.Metrics, multi.DataPoints)
+	data.Properties = multi.Properties
 
 	return data
 }
@@ -482,7 +585,7 @@ func NewRequestTelemetryWithContext(ctx context.Context, method, uri string, dur
 // start and end times.
 func (request *RequestTelemetry) MarkTime(startTime, endTime time.Time) {
 	request.Timestamp = startTime
-	request.Duration = endTime.Sub(startTime)
+	request.Duration = elapsed(startTime, endTime)
 }
 
 func (request *RequestTelemetry) TelemetryData() TelemetryData {
@@ -594,7 +697,7 @@ func NewRemoteDependencyTelemetryWithContext(ctx context.Context, name, dependen
 // start and end times.
 func (telem *RemoteDependencyTelemetry) MarkTime(startTime, endTime time.Time) {
 	telem.Timestamp = startTime
-	telem.Duration = endTime.Sub(startTime)
+	telem.Duration = elapsed(startTime, endTime)
 }
 
 func (telem *RemoteDependencyTelemetry) TelemetryData() TelemetryData {
@@ -690,7 +793,7 @@ func NewAvailabilityTelemetryWithContext(ctx context.Context, name string, durat
 // start and end times.
 func (telem *AvailabilityTelemetry) MarkTime(startTime, endTime time.Time) {
 	telem.Timestamp = startTime
-	telem.Duration = endTime.Sub(startTime)
+	telem.Duration = elapsed(startTime, endTime)
 }
 
 func (telem *AvailabilityTelemetry) TelemetryData() TelemetryData {
@@ -743,7 +846,7 @@ func NewPageViewTelemetry(name, url string) *PageViewTelemetry {
 // start and end times.
 func (telem *PageViewTelemetry) MarkTime(startTime, endTime time.Time) {
 	telem.Timestamp = startTime
-	telem.Duration = endTime.Sub(startTime)
+	telem.Duration = elapsed(startTime, endTime)
 }
 
 func (telem *PageViewTelemetry) TelemetryData() TelemetryData {
@@ -757,6 +860,10 @@ func (telem *PageViewTelemetry) TelemetryData() TelemetryData {
 }
 
 func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
 	ticks := int64(d/(time.Nanosecond*100)) % 10000000
 	seconds := int64(d/time.Second) % 60
 	minutes := int64(d/time.Minute) % 60
@@ -259,3 +259,75 @@ func TestCorrelationWithMultipleSpansInSameTrace(t *testing.T) {
 		t.Error("Different child requests should have different span IDs")
 	}
 }
+
+func TestOperationNameInferredWhenOperationIdPresent(t *testing.T) {
+	corrCtx := NewCorrelationContext()
+	corrCtx.OperationName = "GET /orders"
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+
+	telemetryContext := NewTelemetryContext(test_ikey)
+
+	// The item already belongs to the operation
+	event := NewEventTelemetry("order-viewed")
+	event.Tags.Operation().SetId(corrCtx.GetOperationID())
+	envelope := telemetryContext.envelopWithContext(ctx, event)
+	if envelope.Tags[contracts.OperationName] != "GET /orders" {
+		t.Errorf("Expected inferred operation name, got %q", envelope.Tags[contracts.OperationName])
+	}
+
+	// An explicit operation name is kept
+	event = NewEventTelemetry("order-viewed")
+	event.Tags.Operation().SetName("custom")
+	envelope = telemetryContext.envelopWithContext(ctx, event)
+	if envelope.Tags[contracts.OperationName] != "custom" {
+		t.Errorf("Expected explicit operation name to be kept, got %q", envelope.Tags[contracts.OperationName])
+	}
+
+	// Items from a different operation are left alone
+	event = NewEventTelemetry("order-viewed")
+	event.Tags.Operation().SetId("other-operation")
+	envelope = telemetryContext.envelopWithContext(ctx, event)
+	if _, ok := envelope.Tags[contracts.OperationName]; ok {
+		t.Error("Expected no operation name for an item from another operation")
+	}
+}
+
+func TestHierarchicalEventNames(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.HierarchicalEventNames = true
+	client, testChannel := newTestClient(config)
+
+	corrCtx := NewCorrelationContext()
+	corrCtx.OperationName = "POST /cart"
+	ctx := WithCorrelationContext(context.Background(), corrCtx)
+
+	client.TrackEventWithContext(ctx, "checkout-started")
+	client.TrackEventWithContext(ctx, "POST /cart/already-prefixed")
+	client.TrackEventWithContext(context.Background(), "no-operation")
+	client.TrackEvent("untracked-context")
+
+	expected := []string{"POST /cart/checkout-started", "POST /cart/already-prefixed", "no-operation", "untracked-context"}
+	if testChannel.getSentCount() != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), testChannel.getSentCount())
+	}
+
+	for i, name := range expected {
+		data := testChannel.sentItems[i].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+		if data.Name != name {
+			t.Errorf("Item %d: expected name %q, got %q", i, name, data.Name)
+		}
+	}
+}
+
+func TestHierarchicalEventNamesDisabledByDefault(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	corrCtx := NewCorrelationContext()
+	corrCtx.OperationName = "POST /cart"
+	client.TrackEventWithContext(WithCorrelationContext(context.Background(), corrCtx), "checkout-started")
+
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.EventData)
+	if data.Name != "checkout-started" {
+		t.Errorf("Expected unprefixed name, got %q", data.Name)
+	}
+}
@@ -0,0 +1,21 @@
+package appinsights
+
+import "sync/atomic"
+
+var telemetryDisabled atomic.Bool
+
+// SetTelemetryDisabled disables or re-enables all telemetry clients at once.
+// While disabled, every tracking path returns before constructing or
+// enveloping telemetry, and items queued for asynchronous tracking are
+// dropped.  This is intended as an emergency kill switch and takes effect
+// immediately.
+func SetTelemetryDisabled(disabled bool) {
+	if telemetryDisabled.Swap(disabled) != disabled {
+		diagnosticsWriter.Printf("Telemetry disabled globally: %t", disabled)
+	}
+}
+
+// IsTelemetryDisabled returns whether telemetry is disabled globally.
+func IsTelemetryDisabled() bool {
+	return telemetryDisabled.Load()
+}
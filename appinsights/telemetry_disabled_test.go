@@ -0,0 +1,56 @@
+package appinsights
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTelemetryDisabled(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	SetTelemetryDisabled(true)
+	defer SetTelemetryDisabled(false)
+
+	if client.IsEnabled() {
+		t.Error("Expected the client to report being disabled")
+	}
+
+	client.TrackEvent("event")
+	TrackTracef(client, Information, "trace %d", 1)
+	client.TrackWithContext(context.Background(), NewMetricTelemetry("cpu", 12))
+	if testChannel.getSentCount() != 0 {
+		t.Fatalf("Expected no telemetry while disabled, got %d items", testChannel.getSentCount())
+	}
+
+	SetTelemetryDisabled(false)
+	client.TrackEvent("event")
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected telemetry once re-enabled, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestTelemetryDisabledDropsQueuedItems(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	// Asynchronous tracking workers process items accepted before the
+	// switch was flipped
+	SetTelemetryDisabled(true)
+	client.(*telemetryClient).process(nil, NewEventTelemetry("queued"))
+	SetTelemetryDisabled(false)
+
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected items processed while disabled to be dropped, got %d items", testChannel.getSentCount())
+	}
+}
+
+func BenchmarkTrackDisabled(b *testing.B) {
+	client := NewTelemetryClient(test_ikey)
+	client.SetIsEnabled(false)
+	defer client.Channel().Close(time.Minute)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		TrackTracef(client, Information, "A message %d", i)
+	}
+}
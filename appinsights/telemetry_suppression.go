@@ -0,0 +1,90 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type suppressTelemetryKey struct{}
+
+// SuppressTelemetry returns a context in which telemetry is not tracked:
+// TrackWithContext drops items tracked with it, and instrumented HTTP
+// clients don't track requests made with it.  The SDK uses it for its own
+// requests, such as telemetry submissions, so that an instrumented
+// http.Client set as TelemetryConfiguration.Client doesn't track them.
+func SuppressTelemetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressTelemetryKey{}, true)
+}
+
+// IsTelemetrySuppressed returns whether telemetry is suppressed in ctx.
+func IsTelemetrySuppressed(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	suppressed, _ := ctx.Value(suppressTelemetryKey{}).(bool)
+	return suppressed
+}
+
+// Callbacks invoked by the SDK, such as diagnostics listeners and OnTracked,
+// may track telemetry without a context, which would loop back into the
+// callback.  The goroutines running them are marked so that such telemetry
+// is dropped.  Identifying the goroutine is relatively expensive, so it is
+// only done while a callback is running somewhere.
+var (
+	guardedCallbacks  atomic.Int32
+	guardedGoroutines sync.Map
+)
+
+// enterTelemetryCallback marks the current goroutine as running an SDK
+// callback until the returned function is called.  Nested calls are
+// allowed.
+func enterTelemetryCallback() func() {
+	id := goroutineID()
+	guardedCallbacks.Add(1)
+
+	depth, _ := guardedGoroutines.LoadOrStore(id, new(int32))
+	atomic.AddInt32(depth.(*int32), 1)
+
+	return func() {
+		if atomic.AddInt32(depth.(*int32), -1) == 0 {
+			guardedGoroutines.Delete(id)
+		}
+		guardedCallbacks.Add(-1)
+	}
+}
+
+// inTelemetryCallback returns whether the current goroutine is running an
+// SDK callback
+func inTelemetryCallback() bool {
+	if guardedCallbacks.Load() == 0 {
+		return false
+	}
+
+	_, ok := guardedGoroutines.Load(goroutineID())
+	return ok
+}
+
+// isTrackingSuppressed returns whether telemetry tracked with ctx, which
+// may be nil, must be dropped to avoid tracking the SDK's own activity
+func isTrackingSuppressed(ctx context.Context) bool {
+	return IsTelemetrySuppressed(ctx) || inTelemetryCallback()
+}
+
+// goroutineID returns the ID of the current goroutine, parsed from the
+// header of its stack trace: "goroutine 18 [running]:"
+func goroutineID() uint64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i >= 0 {
+		stack = stack[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(stack), 10, 64)
+	return id
+}
@@ -0,0 +1,100 @@
+package appinsights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestSuppressTelemetry(t *testing.T) {
+	client, testChannel := newSuppressionTestClient(nil)
+
+	ctx := SuppressTelemetry(context.Background())
+	client.TrackWithContext(ctx, NewEventTelemetry("suppressed"))
+	client.TrackWithContext(context.Background(), NewEventTelemetry("tracked"))
+
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected only the unsuppressed item, got %d items", testChannel.getSentCount())
+	}
+	if IsTelemetrySuppressed(nil) || !IsTelemetrySuppressed(ctx) {
+		t.Error("Unexpected suppression state")
+	}
+}
+
+func TestOnTrackedRecursion(t *testing.T) {
+	var client TelemetryClient
+	var callbacks int
+	client, testChannel := newSuppressionTestClient(func(envelope *contracts.Envelope) {
+		callbacks++
+		client.TrackTrace("tracked from the callback", Information)
+	})
+
+	client.TrackEvent("event")
+
+	if callbacks != 1 || testChannel.getSentCount() != 1 {
+		t.Errorf("Expected the nested item to be dropped, got %d callbacks and %d items", callbacks, testChannel.getSentCount())
+	}
+
+	// Tracking resumes once the callback returns
+	client.TrackEvent("event")
+	if testChannel.getSentCount() != 2 {
+		t.Errorf("Expected tracking to resume, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestDiagnosticsListenerRecursion(t *testing.T) {
+	client, testChannel := newSuppressionTestClient(nil)
+
+	listener := NewDiagnosticsMessageListener(func(message string) error {
+		client.TrackTrace(message, Verbose)
+		return nil
+	})
+	defer listener.Remove()
+
+	diagnosticsWriter.Write("diagnostics")
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected telemetry tracked by listeners to be dropped, got %d items", testChannel.getSentCount())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.TrackEvent("concurrent")
+	}()
+	wg.Wait()
+
+	if testChannel.getSentCount() != 1 {
+		t.Errorf("Expected telemetry from other goroutines to be tracked, got %d items", testChannel.getSentCount())
+	}
+}
+
+func TestTransmissionsAreNotTracked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"itemsReceived":1,"itemsAccepted":1,"errors":[]}`))
+	}))
+	defer server.Close()
+
+	tracker, testChannel := newSuppressionTestClient(nil)
+
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey + ";IngestionEndpoint=" + server.URL)
+	config.Client = &http.Client{Transport: &instrumentedRoundTripper{base: http.DefaultTransport, telemetryClient: tracker}}
+	transmitter := newTransmitter(config.EndpointUrl, config.Client, config.TransmitTimeout)
+
+	if _, err := transmitter.Transmit([]byte("{}"), telemetryBuffer(NewEventTelemetry("event"))); err != nil {
+		t.Fatal(err)
+	}
+	if testChannel.getSentCount() != 0 {
+		t.Errorf("Expected the submission not to be tracked as a dependency, got %d items", testChannel.getSentCount())
+	}
+}
+
+func newSuppressionTestClient(onTracked func(*contracts.Envelope)) (TelemetryClient, *TestTelemetryChannel) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.OnTracked = onTracked
+	return newTestClient(config)
+}
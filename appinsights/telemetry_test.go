@@ -1,8 +1,10 @@
 package appinsights
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,6 +132,38 @@ func TestMetricTelemetry(t *testing.T) {
 	}
 }
 
+func TestMetricUnitAndNamespace(t *testing.T) {
+	telem := NewMetricTelemetry("queue length", 12.0)
+	telem.Properties["prop1"] = "value!"
+	telem.Namespace = "storage"
+	telem.Unit = "items"
+	d := telem.TelemetryData().(*contracts.MetricData)
+
+	checkDataContract(t, "DataPoint.Ns", d.Metrics[0].Ns, "storage")
+	checkDataContract(t, "Properties[unit]", d.Properties[MetricUnitProperty], "items")
+	checkDataContract(t, "Properties[prop1]", d.Properties["prop1"], "value!")
+	if _, ok := telem.Properties[MetricUnitProperty]; ok {
+		t.Error("The unit should not be added to the item's own properties")
+	}
+
+	agg := NewAggregateMetricTelemetry("latency")
+	agg.AddData([]float64{1.0, 2.0})
+	agg.Namespace = "http"
+	agg.Unit = "ms"
+	d = agg.TelemetryData().(*contracts.MetricData)
+
+	checkDataContract(t, "DataPoint.Ns", d.Metrics[0].Ns, "http")
+	checkDataContract(t, "Properties[unit]", d.Properties[MetricUnitProperty], "ms")
+
+	// No unit leaves the properties alone
+	telem = NewMetricTelemetry("plain", 1.0)
+	d = telem.TelemetryData().(*contracts.MetricData)
+	checkDataContract(t, "DataPoint.Ns", d.Metrics[0].Ns, "")
+	if _, ok := d.Properties[MetricUnitProperty]; ok {
+		t.Error("Expected no unit property")
+	}
+}
+
 type statsTest struct {
 	data          []float64
 	stdDev        float64
@@ -196,6 +230,51 @@ func checkDataPoint(t *testing.T, telem *AggregateMetricTelemetry, tst statsTest
 	}
 }
 
+func TestMultiMetricTelemetry(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	agg := NewAggregateMetricTelemetry("queue length")
+	agg.AddData([]float64{9.0, 10.0, 11.0, 7.0, 13.0})
+
+	telem := NewMultiMetricTelemetry()
+	telem.Properties["prop1"] = "value!"
+	telem.AddMeasurement("cpu", 42.0)
+	telem.AddAggregation("latency", 300.0, 3, 50.0, 150.0, 40.8)
+	telem.AddAggregateMetric(agg)
+
+	d := telem.TelemetryData().(*contracts.MetricData)
+	checkDataContract(t, "len(Metrics)", len(d.Metrics), 3)
+	checkDataContract(t, "Properties[prop1]", d.Properties["prop1"], "value!")
+	checkDataContract(t, "Timestamp", telem.Time(), currentClock.Now())
+
+	dp := d.Metrics[0]
+	checkDataContract(t, "DataPoint[0].Name", dp.Name, "cpu")
+	checkDataContract(t, "DataPoint[0].Value", dp.Value, 42.0)
+	checkDataContract(t, "DataPoint[0].Kind", dp.Kind, Measurement)
+	checkDataContract(t, "DataPoint[0].Count", dp.Count, 1)
+
+	dp = d.Metrics[1]
+	checkDataContract(t, "DataPoint[1].Name", dp.Name, "latency")
+	checkDataContract(t, "DataPoint[1].Value", dp.Value, 300.0)
+	checkDataContract(t, "DataPoint[1].Kind", dp.Kind, Aggregation)
+	checkDataContract(t, "DataPoint[1].Count", dp.Count, 3)
+	checkDataContract(t, "DataPoint[1].Min", dp.Min, 50.0)
+	checkDataContract(t, "DataPoint[1].Max", dp.Max, 150.0)
+	checkDataContract(t, "DataPoint[1].StdDev", dp.StdDev, 40.8)
+
+	dp = d.Metrics[2]
+	checkDataContract(t, "DataPoint[2].Name", dp.Name, "queue length")
+	checkDataContract(t, "DataPoint[2].Kind", dp.Kind, Aggregation)
+	checkDataContract(t, "DataPoint[2].Count", dp.Count, 5)
+	checkDataContract(t, "DataPoint[2].StdDev", dp.StdDev, 2.0)
+
+	var telemInterface Telemetry
+	if telemInterface = telem; telemInterface.GetMeasurements() != nil {
+		t.Errorf("MultiMetric.(Telemetry).GetMeasurements should return nil")
+	}
+}
+
 func TestRequestTelemetry(t *testing.T) {
 	mockClock()
 	defer resetClock()
@@ -357,6 +436,7 @@ func TestFormatDuration(t *testing.T) {
 		durationTest{time.Millisecond, "0.00:00:00.0010000"},
 		durationTest{100 * time.Nanosecond, "0.00:00:00.0000001"},
 		durationTest{(31 * time.Hour) + (25 * time.Minute) + (30 * time.Second) + time.Millisecond, "1.07:25:30.0010000"},
+		durationTest{-time.Second, "0.00:00:00.0000000"},
 	}
 
 	for _, tst := range durationTests {
@@ -366,3 +446,51 @@ func TestFormatDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestMarkTimeClockStep(t *testing.T) {
+	start := time.Now()
+
+	// Readings from time.Now are measured with the monotonic clock
+	request := NewRequestTelemetry("GET", "https://example.com/", 0, "200")
+	request.MarkTime(start, start.Add(time.Second))
+	if request.Duration != time.Second {
+		t.Errorf("Expected 1s, got %s", request.Duration)
+	}
+
+	// A wall clock reading taken after the clock was stepped back an hour
+	stepped := start.Round(0).Add(-time.Hour)
+
+	request.MarkTime(start, stepped)
+	dependency := NewRemoteDependencyTelemetry("dep", "HTTP", "example.com", true)
+	dependency.MarkTime(start, stepped)
+	availability := NewAvailabilityTelemetry("test", 0, true)
+	availability.MarkTime(start, stepped)
+	pageView := NewPageViewTelemetry("page", "https://example.com/")
+	pageView.MarkTime(start, stepped)
+
+	for _, duration := range []time.Duration{request.Duration, dependency.Duration, availability.Duration, pageView.Duration} {
+		if duration != 0 {
+			t.Errorf("Expected negative duration to be clamped to zero, got %s", duration)
+		}
+	}
+
+	data := dependency.TelemetryData().(*contracts.RemoteDependencyData)
+	if data.Duration != "0.00:00:00.0000000" {
+		t.Errorf("Unexpected formatted duration: %s", data.Duration)
+	}
+}
+
+func TestFinishSpanClockStep(t *testing.T) {
+	client, testChannel := newTestClient()
+
+	// A start time without a monotonic reading that is ahead of the wall
+	// clock, as after the clock is stepped back
+	ctx, span := StartSpan(context.Background(), "work", client)
+	span.StartTime = time.Now().Round(0).Add(time.Hour)
+	span.FinishSpan(ctx, true, nil)
+
+	data := testChannel.sentItems[0].Data.(*contracts.Data).BaseData.(*contracts.RemoteDependencyData)
+	if strings.HasPrefix(data.Duration, "-") || data.Duration != "0.00:00:00.0000000" {
+		t.Errorf("Expected zero duration, got %s", data.Duration)
+	}
+}
@@ -14,8 +14,7 @@ type TelemetryChannel interface {
 	// Queues a single telemetry item
 	Send(*contracts.Envelope)
 
-	// Forces the current queue to be sent
-	Flush()
+	Flusher
 
 	// Tears down the submission goroutines, closes internal channels.
 	// Any telemetry waiting to be sent is discarded.  Further calls to
@@ -3,6 +3,7 @@ package appinsights
 import (
 	"context"
 	"strings"
+	"sync"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
@@ -17,13 +18,40 @@ type TelemetryContext struct {
 	// Stripped-down instrumentation key used in envelope name
 	nameIKey string
 
-	// Collection of tag data to attach to the telemetry item.
+	// Collection of tag data to attach to the telemetry item.  Modifying
+	// Tags directly is not safe once a client uses the context: use SetTag,
+	// GetTag and UpdateTags instead, which replace the map rather than
+	// modify it so that envelopes being created concurrently see a
+	// consistent snapshot.
 	Tags contracts.ContextTags
 
+	// Guards replacement of Tags
+	tagsLock sync.RWMutex
+
+	// Context whose tags apply where Tags doesn't set them, for contexts
+	// created by WithTags
+	parent *TelemetryContext
+
 	// Common properties to add to each telemetry item.  This only has
 	// an effect from the TelemetryClient's context instance.  This will
 	// be nil on telemetry items.
 	CommonProperties map[string]string
+
+	// Correction applied to envelope timestamps.  Only has an effect from
+	// the TelemetryClient's context instance.
+	clockOffset ClockOffsetProvider
+
+	// Limit on the number of properties of each item.  Only has an effect
+	// from the TelemetryClient's context instance.
+	propertyLimit *PropertyLimitConfig
+
+	// Sanitizer applied to the URLs of each item.  Only has an effect from
+	// the TelemetryClient's context instance.
+	sanitizer *Sanitizer
+
+	// Redaction policy applied to each item.  Only has an effect from the
+	// TelemetryClient's context instance.
+	redaction *redactionStage
 }
 
 // Creates a new, empty TelemetryContext
@@ -42,6 +70,109 @@ func (context *TelemetryContext) InstrumentationKey() string {
 	return context.iKey
 }
 
+// SetTag sets a tag applied to all telemetry created with this context, or
+// removes it if value is empty.  It is safe for concurrent use.
+func (context *TelemetryContext) SetTag(key, value string) {
+	context.UpdateTags(func(tags contracts.ContextTags) {
+		if value != "" {
+			tags[key] = value
+		} else {
+			delete(tags, key)
+		}
+	})
+}
+
+// UpdateTags applies update to a copy of the context's tags, then replaces
+// them with the copy.  It is safe for concurrent use, for example:
+//
+//	client.Context().UpdateTags(func(tags contracts.ContextTags) {
+//		tags.Cloud().SetRole("worker")
+//	})
+func (context *TelemetryContext) UpdateTags(update func(tags contracts.ContextTags)) {
+	context.tagsLock.Lock()
+	defer context.tagsLock.Unlock()
+
+	tags := make(contracts.ContextTags, len(context.Tags)+1)
+	for k, v := range context.Tags {
+		tags[k] = v
+	}
+
+	update(tags)
+	context.Tags = tags
+}
+
+// GetTag returns the value of a tag of this context, including tags
+// inherited from the context it was derived from.
+func (context *TelemetryContext) GetTag(key string) (string, bool) {
+	for c := context; c != nil; c = c.parent {
+		if value, ok := c.tags()[key]; ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// WithTags derives a context that adds tags to, or overrides tags of, this
+// one.  Derivation copies only the specified tags, so per-request contexts
+// are cheap; later changes to this context's tags apply to the derived
+// context too.  Pass the result to WithTelemetryContext to apply it to the
+// telemetry tracked with a Go context.
+func (context *TelemetryContext) WithTags(tags map[string]string) *TelemetryContext {
+	derived := &TelemetryContext{
+		iKey:     context.iKey,
+		nameIKey: context.nameIKey,
+		Tags:     make(contracts.ContextTags, len(tags)),
+		parent:   context,
+	}
+
+	for k, v := range tags {
+		derived.Tags[k] = v
+	}
+
+	return derived
+}
+
+// tags returns the current snapshot of the context's own tags, which must
+// not be modified
+func (context *TelemetryContext) tags() contracts.ContextTags {
+	context.tagsLock.RLock()
+	defer context.tagsLock.RUnlock()
+
+	return context.Tags
+}
+
+// copyTags adds the tags of this context and the contexts it was derived
+// from to dst, unless dst already sets them
+func (context *TelemetryContext) copyTags(dst map[string]string) {
+	for c := context; c != nil; c = c.parent {
+		for k, v := range c.tags() {
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	}
+}
+
+type telemetryContextKey struct{}
+
+// WithTelemetryContext returns a Go context carrying a TelemetryContext,
+// usually derived with WithTags, whose tags are applied to the telemetry
+// tracked with it in place of the client's.
+func WithTelemetryContext(ctx context.Context, telemetryContext *TelemetryContext) context.Context {
+	return context.WithValue(ctx, telemetryContextKey{}, telemetryContext)
+}
+
+// GetTelemetryContext returns the TelemetryContext carried by ctx, or nil.
+func GetTelemetryContext(ctx context.Context) *TelemetryContext {
+	if ctx == nil {
+		return nil
+	}
+
+	telemetryContext, _ := ctx.Value(telemetryContextKey{}).(*TelemetryContext)
+	return telemetryContext
+}
+
 // Wraps a telemetry item in an envelope with the information found in this
 // context.
 func (context *TelemetryContext) envelop(item Telemetry) *contracts.Envelope {
@@ -51,6 +182,15 @@ func (context *TelemetryContext) envelop(item Telemetry) *contracts.Envelope {
 // Wraps a telemetry item in an envelope with the information found in this
 // context and optional Go context for correlation support.
 func (context *TelemetryContext) envelopWithContext(ctx context.Context, item Telemetry) *contracts.Envelope {
+	// Apply operation properties
+	if props := item.GetProperties(); props != nil && ctx != nil {
+		for k, v := range OperationProperties(ctx) {
+			if _, ok := props[k]; !ok {
+				props[k] = v
+			}
+		}
+	}
+
 	// Apply common properties
 	if props := item.GetProperties(); props != nil && context.CommonProperties != nil {
 		for k, v := range context.CommonProperties {
@@ -69,31 +209,32 @@ func (context *TelemetryContext) envelopWithContext(ctx context.Context, item Te
 	envelope.Name = tdata.EnvelopeName(context.nameIKey)
 	envelope.Data = data
 	envelope.IKey = context.iKey
+	envelope.Priority = int(defaultPriority(tdata))
 
 	timestamp := item.Time()
 	if timestamp.IsZero() {
 		timestamp = currentClock.Now()
 	}
 
+	timestamp = applyClockOffset(context.clockOffset, timestamp)
 	envelope.Time = timestamp.UTC().Format("2006-01-02T15:04:05.999999Z")
 
+	// Tags of a context derived for the Go context replace the client's
+	tagSource := context
+	if derived := GetTelemetryContext(ctx); derived != nil {
+		tagSource = derived
+	}
+
 	if contextTags := item.ContextTags(); contextTags != nil {
 		envelope.Tags = contextTags
-
-		// Copy in default tag values.
-		for tagkey, tagval := range context.Tags {
-			if _, ok := contextTags[tagkey]; !ok {
-				contextTags[tagkey] = tagval
-			}
-		}
 	} else {
 		// Create new tags object
 		envelope.Tags = make(map[string]string)
-		for k, v := range context.Tags {
-			envelope.Tags[k] = v
-		}
 	}
 
+	// Copy in default tag values.
+	tagSource.copyTags(envelope.Tags)
+
 	// Create operation ID if it does not exist
 	if _, ok := envelope.Tags[contracts.OperationId]; !ok {
 		// Check if we have correlation context from Go context
@@ -105,11 +246,6 @@ func (context *TelemetryContext) envelopWithContext(ctx context.Context, item Te
 				if parentID := corrCtx.GetParentID(); parentID != "" {
 					envelope.Tags[contracts.OperationParentId] = parentID
 				}
-
-				// Set operation name if available
-				if corrCtx.OperationName != "" {
-					envelope.Tags[contracts.OperationName] = corrCtx.OperationName
-				}
 			} else {
 				envelope.Tags[contracts.OperationId] = newUUID().String()
 			}
@@ -118,6 +254,28 @@ func (context *TelemetryContext) envelopWithContext(ctx context.Context, item Te
 		}
 	}
 
+	// Infer operation name from the correlation context if the item
+	// belongs to the same operation and doesn't already have one
+	if ctx != nil {
+		if corrCtx := GetCorrelationContext(ctx); corrCtx != nil && corrCtx.OperationName != "" {
+			if _, ok := envelope.Tags[contracts.OperationName]; !ok && envelope.Tags[contracts.OperationId] == corrCtx.GetOperationID() {
+				envelope.Tags[contracts.OperationName] = corrCtx.OperationName
+			}
+		}
+	}
+
+	context.sanitizer.apply(tdata)
+
+	if context.redaction != nil {
+		context.redaction.apply(tdata)
+	}
+
+	if context.propertyLimit != nil {
+		if dropped := context.propertyLimit.apply(envelope); dropped > 0 {
+			diagnosticsWriter.Printf("Telemetry data warning: dropped %d properties exceeding the property limit", dropped)
+		}
+	}
+
 	// Sanitize.
 	for _, warn := range tdata.Sanitize() {
 		diagnosticsWriter.Printf("Telemetry data warning: %s", warn)
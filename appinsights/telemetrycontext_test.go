@@ -1,7 +1,9 @@
 package appinsights
 
 import (
+	"context"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,8 +12,8 @@ import (
 
 func TestDefaultTags(t *testing.T) {
 	context := NewTelemetryContext(test_ikey)
-	context.Tags["test"] = "OK"
-	context.Tags["no-write"] = "Fail"
+	context.SetTag("test", "OK")
+	context.SetTag("no-write", "Fail")
 
 	telem := NewTraceTelemetry("Hello world.", Verbose)
 	telem.Tags["no-write"] = "OK"
@@ -27,6 +29,65 @@ func TestDefaultTags(t *testing.T) {
 	}
 }
 
+func TestConcurrentTagUpdates(t *testing.T) {
+	tc := NewTelemetryContext(test_ikey)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.SetTag(contracts.CloudRole, "role")
+				tc.UpdateTags(func(tags contracts.ContextTags) {
+					tags.Application().SetVer("1.0")
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.envelop(NewTraceTelemetry("message", Verbose))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if role, ok := tc.GetTag(contracts.CloudRole); !ok || role != "role" {
+		t.Errorf("Expected the role tag, got %q", role)
+	}
+
+	tc.SetTag(contracts.CloudRole, "")
+	if _, ok := tc.GetTag(contracts.CloudRole); ok {
+		t.Error("Expected an empty value to remove the tag")
+	}
+}
+
+func TestWithTags(t *testing.T) {
+	base := NewTelemetryContext(test_ikey)
+	base.UpdateTags(func(tags contracts.ContextTags) {
+		tags.Cloud().SetRole("api")
+		tags.Application().SetVer("1.0")
+	})
+
+	derived := base.WithTags(map[string]string{contracts.CloudRole: "api-tenant-a", contracts.UserAccountId: "tenant-a"})
+	base.SetTag(contracts.ApplicationVersion, "2.0")
+
+	ctx := WithTelemetryContext(context.Background(), derived)
+	envelope := base.envelopWithContext(ctx, NewTraceTelemetry("message", Verbose))
+	if envelope.Tags[contracts.CloudRole] != "api-tenant-a" || envelope.Tags[contracts.UserAccountId] != "tenant-a" {
+		t.Errorf("Expected the derived tags, got %v", envelope.Tags)
+	}
+	if envelope.Tags[contracts.ApplicationVersion] != "2.0" {
+		t.Errorf("Expected later base tags to be inherited, got %q", envelope.Tags[contracts.ApplicationVersion])
+	}
+
+	envelope = base.envelop(NewTraceTelemetry("message", Verbose))
+	if envelope.Tags[contracts.CloudRole] != "api" || envelope.Tags[contracts.UserAccountId] != "" {
+		t.Errorf("Expected the base context to be unchanged, got %v", envelope.Tags)
+	}
+}
+
 func TestCommonProperties(t *testing.T) {
 	context := NewTelemetryContext(test_ikey)
 	context.CommonProperties = map[string]string{
@@ -80,7 +141,7 @@ func TestSanitize(t *testing.T) {
 	ev.Measurements[name] = 55.0
 
 	ctx := NewTelemetryContext(test_ikey)
-	ctx.Tags.Session().SetId(name)
+	ctx.SetTag(contracts.SessionId, name)
 
 	// We'll be looking for messages with these values:
 	found := map[string]int{
@@ -143,3 +204,33 @@ func TestTimestamp(t *testing.T) {
 		t.Errorf("Unexpected timestamp: %s", envelope.Time)
 	}
 }
+
+func TestTimestampAcrossTimeZones(t *testing.T) {
+	context := NewTelemetryContext(test_ikey)
+
+	// The same instant on either side of a daylight saving transition,
+	// expressed in standard and daylight time
+	instant := time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC)
+	standard := instant.In(time.FixedZone("EST", -5*60*60))
+	daylight := instant.In(time.FixedZone("EDT", -4*60*60))
+
+	for _, timestamp := range []time.Time{instant, standard, daylight, time.Now().Round(0)} {
+		ev := NewEventTelemetry("event")
+		ev.Timestamp = timestamp
+
+		envelope := context.envelop(ev)
+		expected := timestamp.UTC().Format("2006-01-02T15:04:05.999999Z")
+		if envelope.Time != expected {
+			t.Errorf("Expected %s, got %s", expected, envelope.Time)
+		}
+		if !strings.HasSuffix(envelope.Time, "Z") {
+			t.Errorf("Expected UTC timestamp, got %s", envelope.Time)
+		}
+	}
+
+	ev := NewEventTelemetry("event")
+	ev.Timestamp = daylight
+	if envelope := context.envelop(ev); envelope.Time != "2024-03-10T07:30:00Z" {
+		t.Errorf("Unexpected timestamp: %s", envelope.Time)
+	}
+}
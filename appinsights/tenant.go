@@ -0,0 +1,192 @@
+package appinsights
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantResolver maps an incoming request to the connection string of the
+// Application Insights resource that should receive its telemetry.  It
+// returns an empty string if the request doesn't belong to a known tenant.
+type TenantResolver func(r *http.Request) string
+
+// TenantFromHeader resolves the tenant from a request header, such as
+// "X-Tenant-Id", and looks up its connection string.
+func TenantFromHeader(header string, connectionStrings map[string]string) TenantResolver {
+	return func(r *http.Request) string {
+		return connectionStrings[r.Header.Get(header)]
+	}
+}
+
+// TenantFromJWTClaim resolves the tenant from a claim of the bearer token in
+// the Authorization header, such as "tid", and looks up its connection
+// string.  The token signature is not verified, so this must only be used
+// behind middleware that authenticates the request.
+func TenantFromJWTClaim(claim string, connectionStrings map[string]string) TenantResolver {
+	return func(r *http.Request) string {
+		tenant, ok := bearerTokenClaim(r, claim)
+		if !ok {
+			return ""
+		}
+
+		return connectionStrings[tenant]
+	}
+}
+
+// bearerTokenClaim returns a string claim from the payload of the request's
+// bearer token
+func bearerTokenClaim(r *http.Request, claim string) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", false
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", false
+	}
+
+	switch value := claims[claim].(type) {
+	case string:
+		return value, value != ""
+	case float64:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
+}
+
+// TenantClients routes telemetry for a multi-tenant service to a separate
+// telemetry client per tenant, so that each customer's telemetry is kept in
+// its own Application Insights resource.  Clients are created on first use
+// and share the same configuration apart from the connection string.
+//
+// Use GetClient as the HTTPMiddleware's GetClient callback, and from handlers
+// to track telemetry for the current request:
+//
+//	tenants := appinsights.NewTenantClients(appinsights.TenantFromHeader("X-Tenant-Id", connectionStrings), defaultClient)
+//	middleware.GetClient = tenants.GetClient
+type TenantClients struct {
+	// Resolver maps requests to connection strings
+	Resolver TenantResolver
+
+	// Default is used for requests that don't resolve to a tenant, or whose
+	// connection string is invalid.  If nil, such requests aren't tracked.
+	Default TelemetryClient
+
+	// NewConfig optionally customizes the configuration of tenant clients,
+	// e.g. to set a sampling processor.  Defaults to
+	// NewTelemetryConfiguration.
+	NewConfig func(connectionString string) *TelemetryConfiguration
+
+	lock    sync.Mutex
+	clients map[string]TelemetryClient
+}
+
+// NewTenantClients creates a set of per-tenant clients using the specified
+// resolver.
+func NewTenantClients(resolver TenantResolver, defaultClient TelemetryClient) *TenantClients {
+	return &TenantClients{
+		Resolver: resolver,
+		Default:  defaultClient,
+		clients:  make(map[string]TelemetryClient),
+	}
+}
+
+// GetClient returns the telemetry client for the tenant of the request.
+func (tenants *TenantClients) GetClient(r *http.Request) TelemetryClient {
+	if tenants.Resolver == nil {
+		return tenants.Default
+	}
+
+	return tenants.Client(tenants.Resolver(r))
+}
+
+// Client returns the telemetry client for the specified connection string,
+// creating it if necessary.
+func (tenants *TenantClients) Client(connectionString string) TelemetryClient {
+	if connectionString == "" {
+		return tenants.Default
+	}
+
+	tenants.lock.Lock()
+	defer tenants.lock.Unlock()
+
+	if client, ok := tenants.clients[connectionString]; ok {
+		return client
+	}
+
+	if _, _, _, err := parseConnectionString(connectionString); err != nil {
+		diagnosticsWriter.Printf("Invalid tenant connection string: %s", err)
+		return tenants.Default
+	}
+
+	newConfig := tenants.NewConfig
+	if newConfig == nil {
+		newConfig = NewTelemetryConfiguration
+	}
+
+	if tenants.clients == nil {
+		tenants.clients = make(map[string]TelemetryClient)
+	}
+
+	client := NewTelemetryClientFromConfig(newConfig(connectionString))
+	tenants.clients[connectionString] = client
+	return client
+}
+
+// Flush flushes the channels of all tenant clients.
+func (tenants *TenantClients) Flush() {
+	for _, client := range tenants.snapshot() {
+		client.Channel().Flush()
+	}
+}
+
+// Close closes the channels of all tenant clients.  The returned channel is
+// closed once all of them have finished submitting pending telemetry.  The
+// default client is left open.
+func (tenants *TenantClients) Close(retryTimeout ...time.Duration) <-chan struct{} {
+	clients := tenants.snapshot()
+
+	waits := make([]<-chan struct{}, 0, len(clients))
+	for _, client := range clients {
+		waits = append(waits, client.Channel().Close(retryTimeout...))
+	}
+
+	result := make(chan struct{})
+	go func() {
+		for _, wait := range waits {
+			<-wait
+		}
+		close(result)
+	}()
+
+	return result
+}
+
+func (tenants *TenantClients) snapshot() []TelemetryClient {
+	tenants.lock.Lock()
+	defer tenants.lock.Unlock()
+
+	clients := make([]TelemetryClient, 0, len(tenants.clients))
+	for _, client := range tenants.clients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
@@ -0,0 +1,140 @@
+package appinsights
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	tenantAConnectionString = "InstrumentationKey=aaaaaaaa-0000-0000-0000-000000000000;IngestionEndpoint=https://a.example.com"
+	tenantBConnectionString = "InstrumentationKey=bbbbbbbb-0000-0000-0000-000000000000;IngestionEndpoint=https://b.example.com"
+)
+
+var tenantConnectionStrings = map[string]string{
+	"tenant-a": tenantAConnectionString,
+	"tenant-b": tenantBConnectionString,
+	"broken":   "IngestionEndpoint=https://broken.example.com",
+}
+
+func newTestJWT(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(payload)) + ".sig"
+}
+
+func TestTenantFromHeader(t *testing.T) {
+	resolver := TenantFromHeader("X-Tenant-Id", tenantConnectionStrings)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant-Id", "tenant-a")
+	if resolver(r) != tenantAConnectionString {
+		t.Errorf("Expected tenant-a connection string, got %q", resolver(r))
+	}
+
+	r.Header.Set("X-Tenant-Id", "unknown")
+	if resolver(r) != "" {
+		t.Errorf("Expected no connection string for unknown tenant, got %q", resolver(r))
+	}
+}
+
+func TestTenantFromJWTClaim(t *testing.T) {
+	resolver := TenantFromJWTClaim("tid", tenantConnectionStrings)
+
+	tests := []struct {
+		authorization string
+		expected      string
+	}{
+		{"Bearer " + newTestJWT(`{"tid":"tenant-b","sub":"user"}`), tenantBConnectionString},
+		{"bearer " + newTestJWT(`{"tid":"tenant-a"}`), tenantAConnectionString},
+		{"Bearer " + newTestJWT(`{"sub":"user"}`), ""},
+		{"Bearer " + newTestJWT(`not json`), ""},
+		{"Bearer not-a-token", ""},
+		{"Basic dXNlcjpwYXNz", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+
+		if actual := resolver(r); actual != test.expected {
+			t.Errorf("For %q, expected %q, got %q", test.authorization, test.expected, actual)
+		}
+	}
+}
+
+func TestTenantClients(t *testing.T) {
+	defaultClient := NewTelemetryClient(test_ikey)
+	tenants := NewTenantClients(TenantFromHeader("X-Tenant-Id", tenantConnectionStrings), defaultClient)
+	defer func() { <-tenants.Close() }()
+
+	request := func(tenant string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant-Id", tenant)
+		return r
+	}
+
+	clientA := tenants.GetClient(request("tenant-a"))
+	clientB := tenants.GetClient(request("tenant-b"))
+
+	if clientA.InstrumentationKey() != "aaaaaaaa-0000-0000-0000-000000000000" {
+		t.Errorf("Unexpected tenant-a key: %s", clientA.InstrumentationKey())
+	}
+	if clientA.Channel().EndpointAddress() == clientB.Channel().EndpointAddress() {
+		t.Error("Expected tenants to send to their own endpoints")
+	}
+	if tenants.GetClient(request("tenant-a")) != clientA {
+		t.Error("Expected tenant clients to be reused")
+	}
+
+	if tenants.GetClient(request("unknown")) != defaultClient {
+		t.Error("Expected unknown tenants to use the default client")
+	}
+	if tenants.GetClient(request("broken")) != defaultClient {
+		t.Error("Expected invalid connection strings to use the default client")
+	}
+
+	configured := 0
+	tenants.NewConfig = func(connectionString string) *TelemetryConfiguration {
+		configured++
+		config := NewTelemetryConfiguration(connectionString)
+		config.SamplingProcessor = NewFixedRateSamplingProcessor(10)
+		return config
+	}
+	tenants.Client("InstrumentationKey=cccccccc-0000-0000-0000-000000000000")
+	if configured != 1 {
+		t.Errorf("Expected NewConfig to be used once, got %d", configured)
+	}
+}
+
+func TestTenantClientsWithMiddleware(t *testing.T) {
+	defaultClient, defaultChannel := newTestClient()
+	tenants := NewTenantClients(TenantFromHeader("X-Tenant-Id", tenantConnectionStrings), defaultClient)
+
+	tenantClient, tenantChannel := newTestClient(NewTelemetryConfiguration(tenantAConnectionString))
+	tenants.clients[tenantAConnectionString] = tenantClient
+
+	middleware := NewHTTPMiddleware()
+	middleware.GetClient = tenants.GetClient
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest("GET", "/orders", nil)
+	r.Header.Set("X-Tenant-Id", "tenant-a")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	if tenantChannel.getSentCount() != 1 {
+		t.Errorf("Expected 1 request for tenant-a, got %d", tenantChannel.getSentCount())
+	} else if tenantChannel.sentItems[0].IKey != "aaaaaaaa-0000-0000-0000-000000000000" {
+		t.Errorf("Unexpected ikey: %s", tenantChannel.sentItems[0].IKey)
+	}
+	if defaultChannel.getSentCount() != 1 {
+		t.Errorf("Expected 1 request for the default client, got %d", defaultChannel.getSentCount())
+	}
+}
@@ -5,7 +5,8 @@ import (
 )
 
 type throttleManager struct {
-	msgs chan *throttleMessage
+	msgs      chan *throttleMessage
+	observers throttleObservers
 }
 
 type throttleMessage struct {
@@ -26,7 +27,8 @@ func newThrottleManager() *throttleManager {
 	return result
 }
 
-func (throttle *throttleManager) RetryAfter(t time.Time) {
+func (throttle *throttleManager) RetryAfter(t time.Time, statusCode int) {
+	throttle.observers.throttled(t, statusCode)
 	throttle.msgs <- &throttleMessage{
 		throttle:  true,
 		timestamp: t,
@@ -99,6 +101,7 @@ func (throttle *throttleManager) waitForThrottle() (time.Time, bool) {
 func (throttle *throttleManager) waitForReady(throttledUntil time.Time) bool {
 	duration := throttledUntil.Sub(currentClock.Now())
 	if duration <= 0 {
+		throttle.observers.released(throttledUntil)
 		return true
 	}
 
@@ -110,6 +113,7 @@ func (throttle *throttleManager) waitForReady(throttledUntil time.Time) bool {
 	for {
 		select {
 		case <-t.C():
+			throttle.observers.released(throttledUntil)
 			for _, n := range notify {
 				n <- true
 			}
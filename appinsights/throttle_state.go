@@ -0,0 +1,152 @@
+package appinsights
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottleReason describes why the ingestion endpoint throttled the channel.
+type ThrottleReason string
+
+const (
+	// ThrottleTooManyRequests indicates the endpoint rejected submissions
+	// with 429 Too Many Requests.
+	ThrottleTooManyRequests ThrottleReason = "TooManyRequests"
+
+	// ThrottleQuotaExceeded indicates the daily quota was exceeded (439).
+	ThrottleQuotaExceeded ThrottleReason = "QuotaExceeded"
+
+	// ThrottleServerBackoff indicates the endpoint asked for a backoff with
+	// Retry-After alongside another status, such as 503 Service
+	// Unavailable.
+	ThrottleServerBackoff ThrottleReason = "ServerBackoff"
+)
+
+// ThrottleState describes whether a channel is throttled by the ingestion
+// endpoint.
+type ThrottleState struct {
+	// Whether submissions are held up
+	Throttled bool
+
+	// When submissions resume, from the Retry-After header
+	Until time.Time
+
+	// Why the channel is throttled
+	Reason ThrottleReason
+
+	// Status code of the response that throttled the channel
+	StatusCode int
+}
+
+// ThrottleNotifier is implemented by channels that expose details of
+// ingestion throttling.  Applications, or components such as samplers, can
+// use it to react to throttling, e.g. by sampling more aggressively:
+//
+//	if notifier, ok := client.Channel().(appinsights.ThrottleNotifier); ok {
+//		notifier.OnThrottleChange(func(state appinsights.ThrottleState) { ... })
+//	}
+type ThrottleNotifier interface {
+	// ThrottleState returns the current throttling state.
+	ThrottleState() ThrottleState
+
+	// OnThrottleChange registers a callback invoked when the channel
+	// becomes throttled, when the throttle deadline is extended, and when
+	// throttling ends.  Callbacks are invoked synchronously by the channel
+	// and must not block.  The returned function unregisters the callback.
+	OnThrottleChange(callback func(ThrottleState)) (unsubscribe func())
+}
+
+// throttleReason derives the reason for a throttled transmission
+func throttleReason(statusCode int) ThrottleReason {
+	switch statusCode {
+	case tooManyRequestsResponse:
+		return ThrottleTooManyRequests
+	case tooManyRequestsOverExtendedTimeResponse:
+		return ThrottleQuotaExceeded
+	default:
+		return ThrottleServerBackoff
+	}
+}
+
+// throttleObservers holds the throttling state reported by a throttle
+// manager and the callbacks subscribed to it
+type throttleObservers struct {
+	lock      sync.Mutex
+	state     ThrottleState
+	callbacks map[int]func(ThrottleState)
+	nextID    int
+}
+
+func (observers *throttleObservers) current() ThrottleState {
+	observers.lock.Lock()
+	defer observers.lock.Unlock()
+	return observers.state
+}
+
+func (observers *throttleObservers) subscribe(callback func(ThrottleState)) func() {
+	observers.lock.Lock()
+	defer observers.lock.Unlock()
+
+	if observers.callbacks == nil {
+		observers.callbacks = make(map[int]func(ThrottleState))
+	}
+
+	id := observers.nextID
+	observers.nextID++
+	observers.callbacks[id] = callback
+
+	return func() {
+		observers.lock.Lock()
+		defer observers.lock.Unlock()
+		delete(observers.callbacks, id)
+	}
+}
+
+// throttled records a throttle deadline, unless an equal or later deadline
+// is already in effect
+func (observers *throttleObservers) throttled(until time.Time, statusCode int) {
+	observers.update(func(state *ThrottleState) bool {
+		if state.Throttled && !until.After(state.Until) {
+			return false
+		}
+
+		*state = ThrottleState{
+			Throttled:  true,
+			Until:      until,
+			Reason:     throttleReason(statusCode),
+			StatusCode: statusCode,
+		}
+		return true
+	})
+}
+
+// released clears the throttling state once the deadline has passed
+func (observers *throttleObservers) released(until time.Time) {
+	observers.update(func(state *ThrottleState) bool {
+		if !state.Throttled || state.Until.After(until) {
+			return false
+		}
+
+		*state = ThrottleState{}
+		return true
+	})
+}
+
+func (observers *throttleObservers) update(fn func(*ThrottleState) bool) {
+	observers.lock.Lock()
+	if !fn(&observers.state) {
+		observers.lock.Unlock()
+		return
+	}
+
+	state := observers.state
+	callbacks := make([]func(ThrottleState), 0, len(observers.callbacks))
+	for _, callback := range observers.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	observers.lock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(state)
+	}
+}
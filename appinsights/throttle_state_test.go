@@ -0,0 +1,70 @@
+package appinsights
+
+import (
+	"testing"
+	"time"
+)
+
+var _ ThrottleNotifier = (*InMemoryChannel)(nil)
+
+func TestThrottleStateNotifications(t *testing.T) {
+	mockClock()
+	defer resetClock()
+
+	throttle := newThrottleManager()
+	defer throttle.Stop()
+
+	states := make(chan ThrottleState, 10)
+	unsubscribe := throttle.observers.subscribe(func(state ThrottleState) { states <- state })
+
+	next := func() ThrottleState {
+		select {
+		case state := <-states:
+			return state
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a throttle notification")
+			return ThrottleState{}
+		}
+	}
+
+	now := currentClock.Now()
+	throttle.RetryAfter(now.Add(10*time.Second), tooManyRequestsResponse)
+	if state := next(); !state.Throttled || !state.Until.Equal(now.Add(10*time.Second)) ||
+		state.Reason != ThrottleTooManyRequests || state.StatusCode != 429 {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	// Earlier deadlines don't change the state
+	throttle.RetryAfter(now.Add(5*time.Second), serviceUnavailableResponse)
+	if state := throttle.observers.current(); state.Reason != ThrottleTooManyRequests {
+		t.Errorf("Expected the state to be unchanged, got %+v", state)
+	}
+
+	throttle.RetryAfter(now.Add(20*time.Second), tooManyRequestsOverExtendedTimeResponse)
+	if state := next(); !state.Until.Equal(now.Add(20*time.Second)) || state.Reason != ThrottleQuotaExceeded {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	if !throttle.IsThrottled() {
+		t.Fatal("Expected to be throttled")
+	}
+
+	fakeClock.Increment(21 * time.Second)
+	if state := next(); state.Throttled {
+		t.Errorf("Expected throttling to end, got %+v", state)
+	}
+	if state := throttle.observers.current(); state.Throttled {
+		t.Errorf("Expected throttling to end, got %+v", state)
+	}
+
+	unsubscribe()
+	throttle.RetryAfter(currentClock.Now().Add(10*time.Second), serviceUnavailableResponse)
+	if state := throttle.observers.current(); state.Reason != ThrottleServerBackoff {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+	select {
+	case state := <-states:
+		t.Errorf("Unexpected notification after unsubscribing: %+v", state)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,45 @@
+package appinsights
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+)
+
+// Request properties recorded by HTTPMiddleware when CaptureTLSInfo is set
+const (
+	// TLSVersionProperty holds the negotiated TLS version, e.g. "TLS 1.3"
+	TLSVersionProperty = "tls.version"
+
+	// TLSCipherSuiteProperty holds the negotiated cipher suite
+	TLSCipherSuiteProperty = "tls.cipherSuite"
+
+	// TLSServerNameProperty holds the server name requested by the client
+	// through SNI
+	TLSServerNameProperty = "tls.serverName"
+
+	// TLSClientCertSubjectProperty holds the SHA-256 hash of the subject of
+	// the client certificate, if one was presented.  The subject is hashed
+	// so that it can be correlated without being disclosed.
+	TLSClientCertSubjectProperty = "tls.clientCertSubjectHash"
+)
+
+// applyTLSInfo records the TLS connection state of a request, if it was
+// received over TLS
+func applyTLSInfo(request *RequestTelemetry, state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+
+	request.Properties[TLSVersionProperty] = tls.VersionName(state.Version)
+	request.Properties[TLSCipherSuiteProperty] = tls.CipherSuiteName(state.CipherSuite)
+
+	if state.ServerName != "" {
+		request.Properties[TLSServerNameProperty] = state.ServerName
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		subject := sha256.Sum256([]byte(state.PeerCertificates[0].Subject.String()))
+		request.Properties[TLSClientCertSubjectProperty] = hex.EncodeToString(subject[:])
+	}
+}
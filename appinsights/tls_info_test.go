@@ -0,0 +1,54 @@
+package appinsights
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareCaptureTLSInfo(t *testing.T) {
+	var captured *RequestTelemetry
+	middleware := NewHTTPMiddleware()
+	middleware.CaptureTLSInfo = true
+	middleware.GetClient = func(*http.Request) TelemetryClient {
+		return &mockTelemetryClient{trackFunc: func(item interface{}) {
+			captured = item.(*RequestTelemetry)
+		}}
+	}
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	subject := pkix.Name{CommonName: "client.contoso.com", Organization: []string{"Contoso"}}
+	req := httptest.NewRequest("GET", "https://api.contoso.com/", nil)
+	req.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		ServerName:       "api.contoso.com",
+		PeerCertificates: []*x509.Certificate{{Subject: subject}},
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	hash := sha256.Sum256([]byte(subject.String()))
+	expected := map[string]string{
+		TLSVersionProperty:           "TLS 1.3",
+		TLSCipherSuiteProperty:       "TLS_AES_128_GCM_SHA256",
+		TLSServerNameProperty:        "api.contoso.com",
+		TLSClientCertSubjectProperty: hex.EncodeToString(hash[:]),
+	}
+	for key, value := range expected {
+		if captured.Properties[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, captured.Properties[key])
+		}
+	}
+
+	// Plain HTTP requests have no TLS properties
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if _, ok := captured.Properties[TLSVersionProperty]; ok {
+		t.Error("Expected no TLS properties for plain HTTP")
+	}
+}
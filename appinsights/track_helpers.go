@@ -0,0 +1,98 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// The helpers below build on TelemetryClient rather than extending it, so
+// that existing implementations of the interface keep compiling.  Like the
+// client's own helpers, they check IsEnabled before constructing telemetry
+// items.
+
+// TrackEventWithMeasurements logs a user action with the specified name,
+// custom properties and measurements.
+func TrackEventWithMeasurements(client TelemetryClient, name string, properties map[string]string, measurements map[string]float64) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.Track(newEventTelemetryWithMeasurements(name, properties, measurements))
+}
+
+// TrackEventWithMeasurementsAndContext logs a user action with custom
+// properties, measurements and correlation context.
+func TrackEventWithMeasurementsAndContext(ctx context.Context, client TelemetryClient, name string, properties map[string]string, measurements map[string]float64) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.TrackWithContext(ctx, newEventTelemetryWithMeasurements(name, properties, measurements))
+}
+
+// newEventTelemetryWithMeasurements creates an event telemetry item holding
+// copies of the specified properties and measurements.
+func newEventTelemetryWithMeasurements(name string, properties map[string]string, measurements map[string]float64) *EventTelemetry {
+	item := NewEventTelemetry(name)
+	for k, v := range properties {
+		item.Properties[k] = v
+	}
+	for k, v := range measurements {
+		item.Measurements[k] = v
+	}
+
+	return item
+}
+
+// TrackTracef logs a trace message formatted according to the specified
+// format specifier with the specified severity level.
+func TrackTracef(client TelemetryClient, severity contracts.SeverityLevel, format string, args ...interface{}) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.Track(NewTraceTelemetry(fmt.Sprintf(format, args...), severity))
+}
+
+// TrackTraceWithProperties logs a trace message with the specified severity
+// level and custom properties.
+func TrackTraceWithProperties(client TelemetryClient, message string, severity contracts.SeverityLevel, properties map[string]string) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.Track(newTraceTelemetryWithProperties(message, severity, properties))
+}
+
+// TrackTracefWithContext logs a formatted trace message with the specified
+// severity level and correlation context.
+func TrackTracefWithContext(ctx context.Context, client TelemetryClient, severity contracts.SeverityLevel, format string, args ...interface{}) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.TrackWithContext(ctx, NewTraceTelemetry(fmt.Sprintf(format, args...), severity))
+}
+
+// TrackTraceWithPropertiesAndContext logs a trace message with custom
+// properties and correlation context.
+func TrackTraceWithPropertiesAndContext(ctx context.Context, client TelemetryClient, message string, severity contracts.SeverityLevel, properties map[string]string) {
+	if !client.IsEnabled() {
+		return
+	}
+
+	client.TrackWithContext(ctx, newTraceTelemetryWithProperties(message, severity, properties))
+}
+
+// newTraceTelemetryWithProperties creates a trace telemetry item holding a
+// copy of the specified properties.
+func newTraceTelemetryWithProperties(message string, severity contracts.SeverityLevel, properties map[string]string) *TraceTelemetry {
+	item := NewTraceTelemetry(message, severity)
+	for k, v := range properties {
+		item.Properties[k] = v
+	}
+
+	return item
+}
@@ -0,0 +1,34 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// DefaultTransactionLinkTemplate opens the transaction search of an
+// Application Insights resource in the Azure portal, filtered to an
+// operation ID.  Use a template with a different host for sovereign clouds.
+const DefaultTransactionLinkTemplate = "https://portal.azure.com/#blade/AppInsightsExtension/BladeRedirect/BladeName/searchV1/ResourceId/{resourceId}/BladeInputs/{bladeInputs}"
+
+// TransactionLink formats a portal deep link to the telemetry of an
+// operation, such as the operation ID returned in the middleware's
+// OperationIDHeader.  The resource ID is the Azure resource ID of the
+// Application Insights component, e.g.
+// "/subscriptions/{id}/resourceGroups/{group}/providers/microsoft.insights/components/{name}".
+func TransactionLink(resourceID, operationID string) string {
+	return FormatTransactionLink(DefaultTransactionLinkTemplate, resourceID, operationID)
+}
+
+// FormatTransactionLink formats a deep link from template, replacing the
+// {resourceId}, {operationId} and {bladeInputs} placeholders with their
+// escaped values.
+func FormatTransactionLink(template, resourceID, operationID string) string {
+	inputs, _ := json.Marshal(map[string]string{"searchText": operationID})
+
+	return strings.NewReplacer(
+		"{resourceId}", url.PathEscape(resourceID),
+		"{operationId}", url.PathEscape(operationID),
+		"{bladeInputs}", url.PathEscape(string(inputs)),
+	).Replace(template)
+}
@@ -0,0 +1,45 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOperationIDHeader(t *testing.T) {
+	middleware := NewHTTPMiddleware()
+	middleware.OperationIDHeader = "x-ms-request-id"
+
+	var operationID string
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operationID = GetCorrelationContext(r.Context()).GetOperationID()
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if header := recorder.Header().Get("x-ms-request-id"); header == "" || header != operationID {
+		t.Errorf("Expected the operation ID %q, got %q", operationID, header)
+	}
+}
+
+func TestTransactionLink(t *testing.T) {
+	resourceID := "/subscriptions/sub/resourceGroups/group/providers/microsoft.insights/components/app"
+	link := TransactionLink(resourceID, "0af7651916cd43dd8448eb211c80319c")
+
+	if !strings.HasPrefix(link, "https://portal.azure.com/#blade/") {
+		t.Errorf("Unexpected link: %s", link)
+	}
+	if !strings.Contains(link, "/ResourceId/%2Fsubscriptions%2Fsub%2FresourceGroups%2Fgroup%2F") {
+		t.Errorf("Expected an escaped resource ID: %s", link)
+	}
+	if !strings.Contains(link, "0af7651916cd43dd8448eb211c80319c") {
+		t.Errorf("Expected the operation ID: %s", link)
+	}
+
+	custom := FormatTransactionLink("https://example.com/{resourceId}?op={operationId}", "a/b", "id 1")
+	if custom != "https://example.com/a%2Fb?op=id%201" {
+		t.Errorf("Unexpected custom link: %s", custom)
+	}
+}
@@ -0,0 +1,92 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// SlowIngestionMetricName is the name of the metric tracked when the
+// ingestion endpoint is flagged as slow.  Its value is the average duration,
+// in milliseconds, of the consecutive slow submissions.
+const SlowIngestionMetricName = "ApplicationInsights.SlowIngestion"
+
+// Number of consecutive slow submissions after which the endpoint is flagged
+const slowTransmitStreak = 3
+
+// transmitWatchdog flags persistently slow ingestion.  Submissions are slow
+// if they exceed the threshold or time out.
+type transmitWatchdog struct {
+	threshold time.Duration
+	context   *TelemetryContext
+
+	lock     sync.Mutex
+	streak   int
+	total    time.Duration
+	timeouts int
+	flagged  bool
+	reports  []*contracts.Envelope
+}
+
+func newTransmitWatchdog(config *TelemetryConfiguration) *transmitWatchdog {
+	return &transmitWatchdog{
+		threshold: config.SlowTransmitThreshold,
+		context:   NewTelemetryContext(config.InstrumentationKey),
+	}
+}
+
+// observe records the outcome of a submission
+func (watchdog *transmitWatchdog) observe(duration time.Duration, err error) {
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	slow := timedOut || (watchdog.threshold > 0 && duration > watchdog.threshold)
+
+	watchdog.lock.Lock()
+	defer watchdog.lock.Unlock()
+
+	if !slow {
+		if watchdog.flagged {
+			diagnosticsWriter.Printf("Ingestion endpoint recovered: submission took %s", duration)
+		}
+
+		watchdog.streak = 0
+		watchdog.total = 0
+		watchdog.timeouts = 0
+		watchdog.flagged = false
+		return
+	}
+
+	watchdog.streak++
+	watchdog.total += duration
+	if timedOut {
+		watchdog.timeouts++
+	}
+
+	if watchdog.streak < slowTransmitStreak || watchdog.flagged {
+		return
+	}
+
+	// Flag once per streak of slow submissions
+	watchdog.flagged = true
+	average := watchdog.total / time.Duration(watchdog.streak)
+	diagnosticsWriter.Printf("Ingestion endpoint is slow: %d consecutive submissions averaged %s, %d timed out",
+		watchdog.streak, average, watchdog.timeouts)
+
+	metric := NewMetricTelemetry(SlowIngestionMetricName, toMilliseconds(average))
+	metric.Properties["slowSubmissions"] = strconv.Itoa(watchdog.streak)
+	metric.Properties["timedOutSubmissions"] = strconv.Itoa(watchdog.timeouts)
+	watchdog.reports = append(watchdog.reports, watchdog.context.envelop(metric))
+}
+
+// drain returns the metrics waiting to be sent with the next batch
+func (watchdog *transmitWatchdog) drain() []*contracts.Envelope {
+	watchdog.lock.Lock()
+	defer watchdog.lock.Unlock()
+
+	reports := watchdog.reports
+	watchdog.reports = nil
+	return reports
+}
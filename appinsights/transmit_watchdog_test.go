@@ -0,0 +1,87 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+func TestTransmitTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	transmitter := newTransmitter(server.URL, nil, 50*time.Millisecond)
+	start := time.Now()
+	_, err := transmitter.Transmit([]byte("{}"), telemetryBuffer(NewTraceTelemetry("msg", Information)))
+	if err == nil {
+		t.Fatal("Expected the hung submission to fail")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline error, got %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Submission wasn't cancelled promptly: %s", elapsed)
+	}
+}
+
+func TestTransmitWatchdog(t *testing.T) {
+	config := NewTelemetryConfiguration("InstrumentationKey=" + test_ikey)
+	config.SlowTransmitThreshold = time.Second
+	watchdog := newTransmitWatchdog(config)
+
+	// A fast submission interrupts the streak
+	watchdog.observe(2*time.Second, nil)
+	watchdog.observe(2*time.Second, nil)
+	watchdog.observe(10*time.Millisecond, nil)
+	watchdog.observe(2*time.Second, nil)
+	if reports := watchdog.drain(); len(reports) != 0 {
+		t.Fatalf("Expected no reports, got %d", len(reports))
+	}
+
+	watchdog.observe(10*time.Millisecond, context.DeadlineExceeded)
+	watchdog.observe(3990*time.Millisecond, nil)
+	reports := watchdog.drain()
+	if len(reports) != 1 {
+		t.Fatalf("Expected one report, got %d", len(reports))
+	}
+
+	metric := reports[0].Data.(*contracts.Data).BaseData.(*contracts.MetricData)
+	if metric.Metrics[0].Name != SlowIngestionMetricName {
+		t.Errorf("Unexpected metric name: %s", metric.Metrics[0].Name)
+	}
+	if metric.Metrics[0].Value != 2000.0 {
+		t.Errorf("Unexpected metric value: %f", metric.Metrics[0].Value)
+	}
+	if metric.Properties["slowSubmissions"] != "3" || metric.Properties["timedOutSubmissions"] != "1" {
+		t.Errorf("Unexpected properties: %v", metric.Properties)
+	}
+	if reports[0].IKey != test_ikey {
+		t.Errorf("Unexpected ikey: %s", reports[0].IKey)
+	}
+
+	// Flagged once per streak
+	watchdog.observe(4*time.Second, nil)
+	if reports := watchdog.drain(); len(reports) != 0 {
+		t.Errorf("Expected no further reports, got %d", len(reports))
+	}
+
+	watchdog.observe(10*time.Millisecond, nil)
+	for i := 0; i < slowTransmitStreak; i++ {
+		watchdog.observe(2*time.Second, nil)
+	}
+	if reports := watchdog.drain(); len(reports) != 1 {
+		t.Errorf("Expected a report after recovering, got %d", len(reports))
+	}
+}
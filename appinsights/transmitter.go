@@ -3,6 +3,7 @@ package appinsights
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -17,6 +18,13 @@ type transmitter interface {
 type httpTransmitter struct {
 	endpoint string
 	client   *http.Client
+	timeout  time.Duration
+
+	// Caches redirect targets of the endpoint, if set
+	cache MetadataCache
+
+	// Acquires bearer tokens, if set
+	token TokenFetcher
 }
 
 type transmissionResult struct {
@@ -51,11 +59,11 @@ const (
 	serviceUnavailableResponse              = 503
 )
 
-func newTransmitter(endpointAddress string, client *http.Client) transmitter {
+func newTransmitter(endpointAddress string, client *http.Client, timeout time.Duration) transmitter {
 	if client == nil {
 		client = http.DefaultClient
 	}
-	return &httpTransmitter{endpointAddress, client}
+	return &httpTransmitter{endpoint: endpointAddress, client: client, timeout: timeout}
 }
 
 func (transmitter *httpTransmitter) Transmit(payload []byte, items telemetryBufferItems) (*transmissionResult, error) {
@@ -73,7 +81,11 @@ func (transmitter *httpTransmitter) Transmit(payload []byte, items telemetryBuff
 
 	gzipWriter.Close()
 
-	req, err := http.NewRequest("POST", transmitter.endpoint, &postBody)
+	ctx, cancel := transmitContext(transmitter.timeout)
+	defer cancel()
+
+	target := transmitter.target()
+	req, err := http.NewRequestWithContext(ctx, "POST", target, &postBody)
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +94,16 @@ func (transmitter *httpTransmitter) Transmit(payload []byte, items telemetryBuff
 	req.Header.Set("Content-Type", "application/x-json-stream")
 	req.Header.Set("Accept-Encoding", "gzip, deflate")
 
+	if transmitter.token != nil {
+		token, _, err := transmitter.token(ctx)
+		if err != nil {
+			diagnosticsWriter.Printf("Failed to acquire an access token: %s", err.Error())
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
 	resp, err := transmitter.client.Do(req)
 	if err != nil {
 		diagnosticsWriter.Printf("Failed to transmit telemetry: %s", err.Error())
@@ -90,6 +112,8 @@ func (transmitter *httpTransmitter) Transmit(payload []byte, items telemetryBuff
 
 	defer resp.Body.Close()
 
+	transmitter.observeRedirect(target, resp)
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		diagnosticsWriter.Printf("Failed to read response from server: %s", err.Error())
@@ -134,6 +158,47 @@ func (transmitter *httpTransmitter) Transmit(payload []byte, items telemetryBuff
 	return result, nil
 }
 
+// redirectCacheKey returns the metadata cache key of the endpoint's
+// redirect target
+func (transmitter *httpTransmitter) redirectCacheKey() string {
+	return "redirect:" + transmitter.endpoint
+}
+
+// target returns the URL submissions are posted to: the cached redirect
+// target of the endpoint, if any, or the endpoint itself
+func (transmitter *httpTransmitter) target() string {
+	if transmitter.cache != nil {
+		if target, ok := transmitter.cache.Get(transmitter.redirectCacheKey()); ok {
+			return target
+		}
+	}
+
+	return transmitter.endpoint
+}
+
+// observeRedirect caches the URL a submission was redirected to, so that
+// later submissions are posted there directly
+func (transmitter *httpTransmitter) observeRedirect(target string, resp *http.Response) {
+	if transmitter.cache == nil || resp.Request == nil || resp.StatusCode >= 300 {
+		return
+	}
+
+	if final := resp.Request.URL.String(); final != target {
+		diagnosticsWriter.Printf("Ingestion endpoint redirected to %s", final)
+		transmitter.cache.Set(transmitter.redirectCacheKey(), final, redirectCacheTTL)
+	}
+}
+
+// transmitContext returns the context of a submission, which is cancelled
+// after timeout, if any
+func transmitContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(SuppressTelemetry(context.Background()), timeout)
+	}
+
+	return context.WithCancel(SuppressTelemetry(context.Background()))
+}
+
 func (result *transmissionResult) IsSuccess() bool {
 	return result.statusCode == successResponse ||
 		// Partial response but all items accepted
@@ -0,0 +1,127 @@
+package appinsights
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+)
+
+// Replacement for the values of sensitive query parameters
+const redactedQueryValue = "[REDACTED]"
+
+// URLs embedded in free text, such as trace and availability messages
+var textURLPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s"'<>]+`)
+
+// DefaultSensitiveQueryParams returns the names of the query parameters
+// redacted by default.
+func DefaultSensitiveQueryParams() []string {
+	return []string{
+		"password", "pwd", "secret", "key", "token", "api_key", "apikey",
+		"access_token", "auth", "authorization", "credential", "credentials",
+	}
+}
+
+// Sanitizer removes sensitive information from URLs: user information,
+// fragments, and the values of sensitive query parameters.  Set it as
+// TelemetryConfiguration.URLSanitizer to redact URLs consistently across
+// request, availability and, optionally, trace telemetry.
+type Sanitizer struct {
+	// Names of the query parameters whose values are redacted, matched
+	// case-insensitively
+	SensitiveQueryParams []string
+
+	// Whether to also sanitize URLs found in trace messages
+	SanitizeTraceMessages bool
+}
+
+// NewSanitizer creates a sanitizer that redacts the default sensitive query
+// parameters.
+func NewSanitizer() *Sanitizer {
+	return &Sanitizer{
+		SensitiveQueryParams: DefaultSensitiveQueryParams(),
+	}
+}
+
+// SanitizeURL returns a sanitized copy of u, formatted as a string.
+func (sanitizer *Sanitizer) SanitizeURL(u *url.URL) string {
+	// Create a copy of the URL to avoid modifying the original
+	sanitized := *u
+
+	// Remove user information (username:password)
+	sanitized.User = nil
+
+	// Redact sensitive query parameters
+	if len(sanitizer.SensitiveQueryParams) > 0 {
+		query := sanitized.Query()
+		for _, param := range sanitizer.SensitiveQueryParams {
+			for key := range query {
+				// Case-insensitive matching for common patterns
+				if strings.EqualFold(key, param) {
+					query.Set(key, redactedQueryValue)
+				}
+			}
+		}
+		sanitized.RawQuery = query.Encode()
+	}
+
+	// Remove fragment
+	sanitized.Fragment = ""
+
+	return sanitized.String()
+}
+
+// SanitizeURLString sanitizes a URL given as a string.  Strings that can't
+// be parsed as URLs are returned unchanged.
+func (sanitizer *Sanitizer) SanitizeURLString(rawURL string) string {
+	if rawURL == "" {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return sanitizer.SanitizeURL(u)
+}
+
+// SanitizeText sanitizes the http and https URLs embedded in free text.
+func (sanitizer *Sanitizer) SanitizeText(text string) string {
+	if !strings.Contains(text, "://") {
+		return text
+	}
+
+	return textURLPattern.ReplaceAllStringFunc(text, func(match string) string {
+		// Punctuation ending a sentence isn't part of the URL
+		trimmed := strings.TrimRight(match, ".,;:!?)]}")
+		return sanitizer.SanitizeURLString(trimmed) + match[len(trimmed):]
+	})
+}
+
+// apply sanitizes the URLs of a telemetry item.  The auth dimensions of
+// requests are sanitized even without a sanitizer.
+func (sanitizer *Sanitizer) apply(data interface{}) {
+	if request, ok := data.(*contracts.RequestData); ok {
+		sanitizeAuthProperties(request.Properties)
+	}
+
+	if sanitizer == nil {
+		return
+	}
+
+	switch data := data.(type) {
+	case *contracts.RequestData:
+		data.Url = sanitizer.SanitizeURLString(data.Url)
+	case *contracts.AvailabilityData:
+		data.Message = sanitizer.SanitizeText(data.Message)
+		for k, v := range data.Properties {
+			data.Properties[k] = sanitizer.SanitizeText(v)
+		}
+	case *contracts.MessageData:
+		if sanitizer.SanitizeTraceMessages {
+			data.Message = sanitizer.SanitizeText(data.Message)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package appinsights
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Names of the classic Windows performance counters, as reported by the
+// .NET SDK, so that dashboards and alerts built on them find equivalent
+// data.  They are collected by PerformanceCounterManager when
+// EnableWindowsCounters is set.
+const (
+	ProcessorTimeCounter        = `\Processor(_Total)\% Processor Time`
+	ProcessProcessorTimeCounter = `\Process(??APP_WIN32_PROC??)\% Processor Time`
+	ProcessPrivateBytesCounter  = `\Process(??APP_WIN32_PROC??)\Private Bytes`
+	ProcessIODataBytesCounter   = `\Process(??APP_WIN32_PROC??)\IO Data Bytes/sec`
+	RequestsPerSecondCounter    = `\ASP.NET Applications(??APP_W3SVC_PROC??)\Requests/Sec`
+)
+
+// RequestCounter counts the requests handled by HTTPMiddleware.  Share one
+// counter between the middleware and PerformanceCounterConfig to report the
+// Requests/Sec counter.
+type RequestCounter struct {
+	count atomic.Int64
+}
+
+// NewRequestCounter creates a request counter.
+func NewRequestCounter() *RequestCounter {
+	return &RequestCounter{}
+}
+
+// Increment counts a request.
+func (counter *RequestCounter) Increment() {
+	counter.count.Add(1)
+}
+
+// Count returns the number of requests counted so far.
+func (counter *RequestCounter) Count() int64 {
+	if counter == nil {
+		return 0
+	}
+
+	return counter.count.Load()
+}
+
+// windowsCounterSample holds the raw values that the Windows counters are
+// derived from.  Times are in 100ns units, as reported by Windows.
+type windowsCounterSample struct {
+	time         time.Time
+	systemIdle   uint64
+	systemTotal  uint64
+	processTime  uint64
+	privateBytes uint64
+	ioBytes      uint64
+	requests     int64
+}
+
+// windowsCounterValues derives the counter values from consecutive samples.
+// Rates are only reported once a previous sample is available.
+func windowsCounterValues(previous, current *windowsCounterSample, numCPU int) map[string]float64 {
+	values := map[string]float64{
+		ProcessPrivateBytesCounter: float64(current.privateBytes),
+	}
+
+	if previous == nil {
+		return values
+	}
+
+	if total := current.systemTotal - previous.systemTotal; total > 0 {
+		idle := current.systemIdle - previous.systemIdle
+		values[ProcessorTimeCounter] = 100 * (1 - float64(idle)/float64(total))
+	}
+
+	seconds := current.time.Sub(previous.time).Seconds()
+	if seconds <= 0 {
+		return values
+	}
+
+	// Process times are summed across processors, so are scaled to the
+	// capacity of the machine like the .NET SDK's normalized counter
+	cpuSeconds := float64(current.processTime-previous.processTime) / 1e7
+	values[ProcessProcessorTimeCounter] = 100 * cpuSeconds / (seconds * float64(numCPU))
+	values[ProcessIODataBytesCounter] = float64(current.ioBytes-previous.ioBytes) / seconds
+	values[RequestsPerSecondCounter] = float64(current.requests-previous.requests) / seconds
+
+	return values
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package appinsights
+
+// The Windows performance counters are not available on other platforms
+func newWindowsCounterCollector(requests *RequestCounter) PerformanceCounterCollector {
+	return nil
+}
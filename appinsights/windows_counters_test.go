@@ -0,0 +1,61 @@
+package appinsights
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWindowsCounterValues(t *testing.T) {
+	start := time.Now()
+	previous := &windowsCounterSample{
+		time:        start,
+		systemIdle:  100,
+		systemTotal: 400,
+		processTime: 0,
+		ioBytes:     1000,
+		requests:    10,
+	}
+	current := &windowsCounterSample{
+		time:         start.Add(2 * time.Second),
+		systemIdle:   200,
+		systemTotal:  800,
+		processTime:  2e7,
+		privateBytes: 4096,
+		ioBytes:      5000,
+		requests:     30,
+	}
+
+	if values := windowsCounterValues(nil, previous, 4); len(values) != 1 {
+		t.Errorf("Expected only gauges without a previous sample, got %v", values)
+	}
+
+	values := windowsCounterValues(previous, current, 4)
+	expected := map[string]float64{
+		ProcessorTimeCounter:        75,
+		ProcessProcessorTimeCounter: 25,
+		ProcessPrivateBytesCounter:  4096,
+		ProcessIODataBytesCounter:   2000,
+		RequestsPerSecondCounter:    10,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("%s: expected %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+func TestMiddlewareRequestCounter(t *testing.T) {
+	middleware := NewHTTPMiddleware()
+	middleware.RequestCounter = NewRequestCounter()
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	if count := middleware.RequestCounter.Count(); count != 3 {
+		t.Errorf("Expected 3 requests, got %d", count)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build windows
+
+package appinsights
+
+import (
+	"runtime"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetSystemTimes       = kernel32.NewProc("GetSystemTimes")
+	procGetProcessIoCounters = kernel32.NewProc("GetProcessIoCounters")
+	procGetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+)
+
+// processMemoryCountersEx mirrors PROCESS_MEMORY_COUNTERS_EX
+type processMemoryCountersEx struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+	privateUsage               uintptr
+}
+
+// ioCounters mirrors IO_COUNTERS
+type ioCounters struct {
+	readOperationCount  uint64
+	writeOperationCount uint64
+	otherOperationCount uint64
+	readTransferCount   uint64
+	writeTransferCount  uint64
+	otherTransferCount  uint64
+}
+
+// WindowsPerformanceCounterCollector collects the classic Windows
+// performance counters reported by the .NET SDK: processor time, process
+// processor time, private bytes, IO data bytes/sec, and requests/sec.
+type WindowsPerformanceCounterCollector struct {
+	requests *RequestCounter
+	last     *windowsCounterSample
+}
+
+// NewWindowsPerformanceCounterCollector creates a Windows performance
+// counter collector.  Requests/Sec is reported from the requests counted by
+// requests, if specified.
+func NewWindowsPerformanceCounterCollector(requests *RequestCounter) *WindowsPerformanceCounterCollector {
+	return &WindowsPerformanceCounterCollector{requests: requests}
+}
+
+func newWindowsCounterCollector(requests *RequestCounter) PerformanceCounterCollector {
+	return NewWindowsPerformanceCounterCollector(requests)
+}
+
+// Name returns the collector name
+func (w *WindowsPerformanceCounterCollector) Name() string {
+	return "Windows Performance Counters"
+}
+
+// Collect gathers the Windows performance counters
+func (w *WindowsPerformanceCounterCollector) Collect(client TelemetryClient) {
+	sample, err := readWindowsCounterSample()
+	if err != nil {
+		diagnosticsWriter.Printf("Failed to read Windows performance counters: %s", err.Error())
+		return
+	}
+
+	sample.requests = w.requests.Count()
+	values := windowsCounterValues(w.last, sample, runtime.NumCPU())
+	w.last = sample
+
+	if w.requests == nil {
+		delete(values, RequestsPerSecondCounter)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		client.TrackMetric(name, values[name])
+	}
+}
+
+func readWindowsCounterSample() (*windowsCounterSample, error) {
+	sample := &windowsCounterSample{time: currentClock.Now()}
+
+	var idle, kernel, user syscall.Filetime
+	if r, _, err := procGetSystemTimes.Call(uintptr(unsafe.Pointer(&idle)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user))); r == 0 {
+		return nil, err
+	}
+
+	// Kernel time includes idle time
+	sample.systemIdle = filetimeTicks(idle)
+	sample.systemTotal = filetimeTicks(kernel) + filetimeTicks(user)
+
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+
+	var creation, exit syscall.Filetime
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return nil, err
+	}
+	sample.processTime = filetimeTicks(kernel) + filetimeTicks(user)
+
+	memory := processMemoryCountersEx{}
+	memory.cb = uint32(unsafe.Sizeof(memory))
+	if r, _, err := procGetProcessMemoryInfo.Call(uintptr(process), uintptr(unsafe.Pointer(&memory)), uintptr(memory.cb)); r == 0 {
+		return nil, err
+	}
+	sample.privateBytes = uint64(memory.privateUsage)
+
+	var io ioCounters
+	if r, _, err := procGetProcessIoCounters.Call(uintptr(process), uintptr(unsafe.Pointer(&io))); r == 0 {
+		return nil, err
+	}
+	sample.ioBytes = io.readTransferCount + io.writeTransferCount
+
+	return sample, nil
+}
+
+func filetimeTicks(ft syscall.Filetime) uint64 {
+	return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+}